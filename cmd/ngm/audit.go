@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"mynginx/internal/app"
+	"mynginx/internal/config"
+	"mynginx/internal/store"
+)
+
+// readOnlyCommands change nothing and are left out of the audit trail, as are
+// their read-only subcommands (readOnlySubcommands) and --dry-run runs.
+var (
+	readOnlyCommands    = map[string]bool{"serve": true, "drift": true, "conflicts": true, "activity": true, "monitoring": true, "audit": true, "render": true, "logs": true}
+	readOnlySubcommands = map[string]bool{
+		"list": true, "targets": true, "reach": true, "backups": true, "origin": true, "trace": true,
+		"info": true, "check": true, "test": true, "status": true, "saturation": true, "pools": true,
+		"zones": true, "queue": true, "diff": true, "lint": true, "encrypt": true, "history": true,
+	}
+)
+
+// startCLIAudit begins the audit entry of a mutating command; the returned func
+// records it with the command's outcome (nil for a read-only command).
+func startCLIAudit(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) func(error) {
+	if readOnlyCommands[args[0]] || (len(args) > 1 && readOnlySubcommands[args[1]]) {
+		return nil
+	}
+	action, params := cliAuditArgs(args)
+	if params["dry-run"] == "true" || (args[0] == "apply" && params["show"] != "") {
+		return nil
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return nil
+	}
+	act := core.StartAudit("cli", action, params["domain"])
+	act.Actor, act.Params = cliActor(), params
+	return func(err error) {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		core.FinishAudit(act, err)
+	}
+}
+
+// cliAuditArgs splits a command line into its action ("ngm site edit": the leading
+// words, at most two) and its flags and other arguments, secrets redacted. A flag
+// without a value ("--yes", or one followed by another flag) is recorded as true.
+func cliAuditArgs(args []string) (string, map[string]string) {
+	words := []string{"ngm"}
+	i := 0
+	for ; i < len(args) && i < 2 && !strings.HasPrefix(args[i], "-"); i++ {
+		words = append(words, args[i])
+	}
+	params := map[string]string{}
+	var rest []string
+	for ; i < len(args); i++ {
+		a := args[i]
+		if !strings.HasPrefix(a, "-") || a == "-" {
+			rest = append(rest, a)
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		if !ok {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				value = args[i+1]
+				i++
+			}
+		}
+		params[name] = app.AuditParam(name, value)
+	}
+	if len(rest) > 0 {
+		params["args"] = fmt.Sprint(rest)
+	}
+	return strings.Join(words, " "), params
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"mynginx/internal/app"
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+// Exit codes, the same for every command, so scripts can branch on the outcome.
+const (
+	exitOK        = 0 // success (also "nothing to do")
+	exitFailure   = 1 // the command failed, or only part of it succeeded (e.g. some sites failed to apply)
+	exitUsage     = 2 // unknown command/flag or a missing required flag
+	exitInvalid   = 3 // invalid config.yaml, rejected input or a plan limit
+	exitNginxTest = 4 // nginx -t rejected the configuration (changes were rolled back)
+	exitNotFound  = 5 // the site, user, plan, certificate or run does not exist
+	exitConflict  = 6 // the site was modified concurrently (revision mismatch)
+)
+
+const exitCodesHelp = "Exit codes: 0 ok, 1 failure or partial failure, 2 usage, 3 invalid config/input, 4 nginx -t failed, 5 not found, 6 conflict"
+
+// verbose is set by -v: external commands are traced and commands print extra detail.
+var verbose bool
+
+// usageError is a command line mistake (exit 2).
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// parseFlags is fs.Parse with flag errors reported as usage errors.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return &usageError{msg: err.Error()}
+	}
+	return nil
+}
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	var ue *usageError
+	var ve *app.ValidationError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &ue):
+		return exitUsage
+	case errors.Is(err, nginx.ErrConfigTest):
+		return exitNginxTest
+	case errors.As(err, &ve), errors.Is(err, app.ErrPlanLimit):
+		return exitInvalid
+	case errors.Is(err, sql.ErrNoRows):
+		return exitNotFound
+	case errors.Is(err, store.ErrRevisionConflict):
+		return exitConflict
+	default:
+		return exitFailure
+	}
+}
+
+// exit ends the process for a command's result: errors are logged to stderr
+// (also with -q) and mapped to an exit code.
+func exit(cmd string, err error) {
+	code := exitCode(err)
+	if err != nil && code != exitOK {
+		log.Printf("%s: %v", cmd, err)
+	}
+	if verbose {
+		log.Printf("exit %d", code)
+	}
+	os.Exit(code)
+}
+
+// silenceStdout makes -q drop everything a command prints on stdout; errors
+// still go to stderr.
+func silenceStdout() {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	os.Stdout = null
+}
@@ -2,24 +2,35 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/mail"
 	"os"
 	"os/signal"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
+	"mynginx/internal/auth"
+	"mynginx/internal/certs"
 	"mynginx/internal/config"
+	"mynginx/internal/health"
+	"mynginx/internal/monitoring"
 	"mynginx/internal/nginx"
+	"mynginx/internal/notify"
 	"mynginx/internal/store"
 	storesqlite "mynginx/internal/store/sqlite"
 	"mynginx/internal/util"
 
 	"mynginx/internal/app"
 
+	"mynginx/internal/sandbox"
 	"mynginx/internal/web"
 
 	"golang.org/x/crypto/bcrypt"
@@ -30,16 +41,60 @@ var (
 	BuildTime = "unknown"
 )
 
+// runner executes every external command; -trace-exec / -dry-exec wrap it.
+var runner util.Runner = util.ExecRunner{}
+
 func main() {
 	var cfgPath string
+	var traceExec, dryExec, quiet bool
+	var sandboxDir string
 	flag.StringVar(&cfgPath, "c", "config.yaml", "Path to config.yaml")
+	flag.StringVar(&sandboxDir, "sandbox", "", "Re-root every path under this directory and stub external commands (no root or nginx needed)")
+	flag.BoolVar(&traceExec, "trace-exec", false, "Log every external command (nginx, certbot, openssl, useradd, systemctl) to stderr")
+	flag.BoolVar(&dryExec, "dry-exec", false, "Log external commands instead of running them")
+	flag.BoolVar(&quiet, "q", false, "Print nothing but errors; rely on the exit code")
+	flag.BoolVar(&quiet, "quiet", false, "Same as -q")
+	flag.BoolVar(&verbose, "v", false, "Print extra detail and trace external commands (implies -trace-exec)")
+	flag.BoolVar(&verbose, "verbose", false, "Same as -v")
 	flag.Parse()
 
+	if quiet && verbose {
+		log.Printf("-q and -v are mutually exclusive")
+		os.Exit(exitUsage)
+	}
+	if quiet {
+		silenceStdout()
+	}
+	if verbose {
+		traceExec = true
+	}
+	if dryExec {
+		runner = util.DryRunner{Out: os.Stderr}
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "config" {
+		// runs before config.Load: reports an invalid config instead of failing on it
+		exit("config", cmdConfig(cfgPath, sandboxDir, traceExec, args[1:]))
+	}
 	cfg, err := config.Load(cfgPath)
 	if err != nil {
-		log.Fatalf("config: %v", err)
+		log.Printf("config: %v", err)
+		os.Exit(exitInvalid)
+	}
+	if sandboxDir != "" {
+		if err := sandbox.Reroot(cfg, sandboxDir); err != nil {
+			log.Fatalf("sandbox: %v", err)
+		}
+		p := cfg.ResolvePaths()
+		runner = sandbox.Runner{LetsEncryptLive: p.LetsEncryptLive, PIDFile: p.NginxPIDFile}
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "SANDBOX: paths re-rooted under %s, external commands stubbed\n", cfg.Sandbox)
+		}
+	}
+	if traceExec {
+		runner = &util.TraceRunner{Next: runner, Out: os.Stderr}
 	}
 	paths := cfg.ResolvePaths()
+	app.Version = Version
 
 	// Open store early (for CLI commands)
 	st, err := storesqlite.Open(cfg.Storage.SQLitePath)
@@ -47,6 +102,7 @@ func main() {
 		log.Fatalf("store: %v", err)
 	}
 	defer st.Close()
+	st.SetSlowQuery(cfg.Storage.SlowQueryThreshold())
 
 	if err := st.Migrate(); err != nil {
 		log.Fatalf("store migrate: %v", err)
@@ -58,296 +114,2955 @@ func main() {
 		return
 	}
 
+	// every command but the read-only ones lands in the audit trail
+	audit := startCLIAudit(st, cfg, paths, args)
+
 	switch args[0] {
 	case "serve":
-		if err := cmdServe(st, cfg, paths); err != nil {
-			log.Fatalf("serve: %v", err)
-		}
+		err = cmdServe(st, cfg, paths)
 
 	case "site":
-		if err := cmdSite(st, cfg, paths, args[1:]); err != nil {
-			log.Fatalf("site: %v", err)
-		}
+		err = cmdSite(st, cfg, paths, args[1:])
 	case "apply":
-		if err := cmdApply(st, cfg, paths, args[1:]); err != nil {
-			log.Fatalf("apply: %v", err)
-		}
+		err = cmdApply(st, cfg, paths, args[1:])
 
 	case "cert":
-		if err := cmdCert(st, cfg, paths, args[1:]); err != nil {
-			log.Fatalf("cert: %v", err)
-		}
+		err = cmdCert(st, cfg, paths, args[1:])
+
+	case "plan":
+		err = cmdPlan(st, cfg, paths, args[1:])
+
+	case "tls":
+		err = cmdTLS(st, cfg, paths, args[1:])
+
+	case "nginx":
+		err = cmdNginx(st, cfg, paths, args[1:])
+
+	case "global":
+		err = cmdGlobal(st, cfg, paths, args[1:])
+
+	case "template":
+		err = cmdTemplate(st, cfg, paths, args[1:])
+
+	case "fpm":
+		err = cmdFPM(st, cfg, paths, args[1:])
+
+	case "php":
+		err = cmdPHP(st, cfg, paths, args[1:])
+
+	case "drift":
+		err = cmdDrift(st, cfg, paths)
+
+	case "prune":
+		err = cmdPrune(st, cfg, paths, args[1:])
+
+	case "gc":
+		err = cmdGC(st, cfg, paths, args[1:])
+
+	case "conflicts":
+		err = cmdConflicts(st, cfg, paths)
+
+	case "preview":
+		err = cmdPreview(st, cfg, paths, args[1:])
+
+	case "render":
+		err = cmdRender(st, cfg, paths, args[1:])
+
+	case "logs":
+		err = cmdLogs(st, cfg, paths, args[1:])
+
+	case "dns":
+		err = cmdDNS(st, cfg, paths, args[1:])
+
+	case "notify":
+		err = cmdNotify(st, cfg, args[1:])
+
+	case "token":
+		err = cmdToken(st, cfg, paths, args[1:])
+
+	case "sftp":
+		err = cmdSFTP(st, cfg, paths, args[1:])
+
+	case "activity":
+		err = cmdActivity(st, cfg, paths, args[1:])
+
+	case "audit":
+		err = cmdAudit(st, cfg, paths, args[1:])
+
+	case "monitoring":
+		err = cmdMonitoring(args[1:])
+
+	case "standby":
+		err = cmdStandby(st, cfg, paths, args[1:])
+
+	case "health":
+		err = cmdHealth(st, cfg, args[1:])
 
 	case "panel-user":
-		if err := cmdPanelUser(st, args[1:]); err != nil {
-			log.Fatalf("panel-user: %v", err)
-		}
+		err = cmdPanelUser(st, cfg, args[1:])
+
+	case "snapshot":
+		err = cmdSnapshot(st, cfg, paths, args[1:])
 
 	default:
-		fmt.Printf("Unknown command: %s\n", args[0])
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", args[0])
+		fmt.Println("Global flags: -c <config.yaml> [-q|-v] [-trace-exec] [-dry-exec] [-sandbox <dir>]")
 		fmt.Println("Commands:")
 		fmt.Println("  serve                                (start local UI on cfg.api.listen)")
-		fmt.Println("  site add --user <u> --domain <d> [--mode php|proxy|static] [--php 8.3] [--webroot <path>] [--http3=true|false] [--skip-cert] [--apply-now=true|false]")
+		fmt.Println("  config validate [--strict] [--json] (check config.yaml against this system: binaries, dirs, PHP-FPM services)")
+		fmt.Println("  site add --user <u> --domain <d> [--mode php|proxy|static] [--php 8.3] [--webroot <path>] [--http3=true|false] [--skip-cert] [--apply-now=true|false] [--dns]")
 		fmt.Println("  site edit --domain <d> [--user <u>] [--mode php|proxy|static] [--php 8.3] [--webroot <path>] [--http3=true|false] [--enabled=true|false] [--apply-now=true|false]")
-		fmt.Println("  site list")
-		fmt.Println("  site rm --domain <d>")
-		fmt.Println("  apply [--domain <d>] [--all] [--dry-run] [--limit N]")
+		fmt.Println("  site list [--sort domain|owner|mode|enabled|cert|state|last_applied|php] [--desc] [--search <text>] [--owner <u>] [--mode <m>] [--state OK|PENDING|ERROR|DISABLED] [--limit N] [--offset N]")
+		fmt.Println("  site rm --domain <d> [--grace 24h [--status 410|503]] (graceful: a retired page until the grace period ends)")
+		fmt.Println("  site target --domain <d> --addr <host:port> [--weight 100] [--backup] [--enabled=true|false] [--group blue|green]")
+		fmt.Println("  site targets --domain <d>   (proxy targets with 5xx rate and latency over the last 15 min)")
+		fmt.Println("  site discover --domain <d> (--srv <_svc._tcp.name> | --consul <service> | --off) (targets from DNS SRV / Consul)")
+		fmt.Println("  site cutover --domain <d> --to <group|all> (switch proxy upstream to a target group)")
+		fmt.Println("  site mirror --domain <d> (--target <host:port> [--percent 10] | --off) (shadow traffic)")
+		fmt.Println("  site dualcert --domain <d> [--off]   (serve RSA + ECDSA certificates side by side)")
+		fmt.Println("  site certsource --domain <d> --source <letsencrypt|path|remote|shared> [--cert <file> --key <file>] [--lineage <name>]")
+		fmt.Println("  site syslog --domain <d> (--server <host:port> | --off) (ship the access log to a SIEM)")
+		fmt.Println("  site keepalive --domain <d> [--connections 32] [--requests 1000] [--timeout 60s] (upstream connection pool of a proxy site; no flag = defaults)")
+		fmt.Println("  site health --domain <d> (--path /healthz | --off) (expose the backend health endpoint of a proxy site to health.backend.allow)")
+		fmt.Println("  site logsample --domain <d> --sample <all|errors|1/N> (thin the access log of a busy site)")
+		fmt.Println("  site header --domain <d> [--set <Name=Value> | --hide <Name> | --rm <Name>] (custom response headers; no flag lists them)")
+		fmt.Println("  site var --domain <d> [--set <name=value> | --rm <name>] (template variables, .Vars.<name> in site.tmpl; no flag lists them)")
+		fmt.Println("  site preload --domain <d> [--add <url> --as <style|script|font|image|fetch> [--crossorigin] | --rm <url>] (Link preload / early hints; no flag lists them)")
+		fmt.Println("  site expire --domain <d> (--at <YYYY-MM-DD[THH:MM]> [--notify <email>] | --off) | --sweep (auto-disable)")
+		fmt.Println("  site reach --domain <d>    (fetch the site over IPv4 and IPv6 and compare the served certificate)")
+		fmt.Println("  site backups --domain <d>  (saved vhosts, newest first; rollback restores the newest good one)")
+		fmt.Println("  site origin (--file <path> | --domain <d>) (which apply run and user published a vhost, from its stamp header)")
+		fmt.Println("  site deploy --domain <d> [--repo <url> [--branch main]] [--run] [--rotate] [--off] [--log 20] (git deploy of the webroot; push webhook at /api/v1/sites/<d>/deploy)")
+		fmt.Println("  site fix-perms (--domain <d> | --all) [--dry-run] [--list] (reset owner/group/modes of the site tree)")
+		fmt.Println("  site tag --domain <d> [--set a,b | --clear] (site tags for bulk operations; no flag lists them)")
+		fmt.Println("  site trace --domain <d> (--id <X-Request-ID> | --slow 1s) (find a request and its log lines, or the slowest ones)")
+		fmt.Println("  site reapply --domain <d> (--cron \"*/15 * * * *\" | --off) (scheduled re-render in serve mode, applied on change)")
+		fmt.Println("  apply [--domain <d>] [--all] [--dry-run] [--limit N] | --show <run>")
+		fmt.Println("  apply status                       (who holds the apply lock and its current step)")
+		fmt.Println("  apply history --domain <d> [-n 20] (past applies of a site: run, status, render hash, error)")
+		fmt.Println("  global apply [--dry-run]            (render zones/maps/log formats/default server into conf/ngm.d)")
+		fmt.Println("  template lint [--golden <dir>] [--update] [--nginx-test=true|false] (render every site mode permutation, compare with golden files, nginx -t each)")
+		fmt.Println("  fpm pools                          (php-fpm pools in pools_dir not managed by ngm, mapped to sites)")
+		fmt.Println("  fpm adopt --file <pool.conf> [--domain <d>] (bring a pool under ngm: keep its php values, replace the file)")
+		fmt.Println("  php migrate --from 8.1 --to 8.3 [--tag <t>] [--batch 5] [--dry-run] (move php sites in health-checked batches)")
+		fmt.Println("  drift                              (vhost files without an enabled site, enabled sites without a vhost)")
+		fmt.Println("  prune --orphans [--yes]            (back up and remove the orphaned vhosts of drift, then reload)")
+		fmt.Println("  gc [--grace 720h] [--yes]          (remove staged renders, backups and self-signed certs of deleted sites)")
+		fmt.Println("  conflicts                          (hostnames claimed by more than one vhost: sites, previews, foreign files)")
+		fmt.Println("  preview --domain <d> [--off]       (serve the site on <d>.hosting.preview.domain to test it before the DNS switch)")
+		fmt.Println("  render --domain <d> [--diff]       (print the vhost the next apply would publish, or its diff against the live one)")
+		fmt.Println("  logs --domain <d> [--log error|access] [-n 20] [--follow] [--idle 10m] (tail a site log, or follow it live)")
+		fmt.Println("  dns zones                          (dns.zones and whether each provider accepts its credentials)")
+		fmt.Println("  dns encrypt                        (read a provider secret on stdin, print it sealed for dns.zones[].credentials)")
+		fmt.Println("  dns record --domain <d>            (point A/AAAA of <d> at dns.addresses through its zone's provider)")
+		fmt.Println("  notify test --to <addr>            (send a test mail through notify.smtp now and show the result)")
+		fmt.Println("  notify queue [--limit 50]          (recent outgoing mail and its delivery status)")
+		fmt.Println("  token create --name <n> --scopes metrics,read,sites,certs,apply,write,admin [--days N] [--domains a.com,b.com] [--user <u>] (API token, shown once; --domains/--user limit it to those sites)")
+		fmt.Println("  token list | token rotate --name <n> [--grace 1h] | token revoke --name <n>")
+		fmt.Println("  monitoring export-rules [--out <dir>] [--job ngm] [--cert-days 14] [--dashboard] (Prometheus alert rules + Grafana dashboard for /metrics)")
+		fmt.Println("  standby status | standby pull      (warm standby of cluster.standby.primary: last snapshot / pull now)")
+		fmt.Println("  standby promote [--no-apply]       (stop ngm serve first: make the pulled database live and apply every site)")
+		fmt.Println("  snapshot take [--notify]           (archive the managed nginx tree under snapshots.dir; print what changed)")
+		fmt.Println("  snapshot list | snapshot diff [--from <name>] [--to <name>] (archives / unified diff, default: the two newest)")
+		fmt.Println("  sftp jail --user <u> [--off]       (sftp-only chroot holding bind mounts of the user's sites)")
+		fmt.Println("  sftp list | sftp sync              (jailed users and their sites / re-bind every jail after a reboot)")
+		fmt.Println("  activity --user <u> [-n 50]        (activity feed of a hosting user: applies, certs, deploys, logins)")
+		fmt.Println("  audit [--actor <a>] [--domain <d>] [--via cli|ui|api] [-n 50] (who changed what, from the CLI, panel and API)")
 		fmt.Println("  cert list                          (show all certificates)")
 		fmt.Println("  cert info --domain <d>             (show cert details)")
 		fmt.Println("  cert issue --domain <d>            (issue/renew certificate)")
 		fmt.Println("  cert renew [--domain <d>] [--all] (renew expiring certs)")
 		fmt.Println("  cert check [--days 30]             (check expiring soon)")
-		fmt.Println("  panel-user add --user <u> --pass <p> [--role admin] [--enabled=true|false]")
-		os.Exit(2)
+		fmt.Println("  cert revoke --domain <d> [--reason keycompromise] (revoke at the CA; the files stay until the next issue)")
+		fmt.Println("  cert test --domain <d>             (fetch a test token through the HTTP-01 challenge path, no certbot attempt)")
+		fmt.Println("  cert dns --domain <d> [--off]      (delegate DNS-01 to acme-dns; issue then adds *.<d>)")
+		fmt.Println("  cert ca --domain <d> [--ca <name> | --default] (ACME CA of a site: letsencrypt, zerossl, buypass or certs.cas)")
+		fmt.Println("  plan list                          (show plans and user usage)")
+		fmt.Println("  plan add --name <n> [--max-sites N] [--max-targets N] [--php 8.3,8.4] [--bandwidth-mb N] [--disk-mb N]")
+		fmt.Println("  plan rm --name <n>")
+		fmt.Println("  plan assign --user <u> [--plan <n>] (empty plan = unlimited)")
+		fmt.Println("  tls scan --domain <d> [--connect host:port] (grade the live TLS endpoint)")
+		fmt.Println("  nginx status|start|restart         (nginx master state / control; see nginx.apply.reload_mode)")
+		fmt.Println("  nginx wire                         (add the sites_dir include to nginx.conf, with backup)")
+		fmt.Println("  nginx saturation                   (connection and worker CPU usage; needs saturation.enabled + global apply)")
+		fmt.Println("  nginx modules [enable|disable <m>] (dynamic modules: brotli, geoip2, modsecurity; load_module via nginx -t)")
+		fmt.Println("  health check                       (check all enabled sites once and record results)")
+		fmt.Println("  health check --report-to <url> --secret <s> --domains a,b [--location <name>] (external check location)")
+		fmt.Println("  panel-user add --user <u> --pass <p> [--role admin] [--enabled=true|false] [--lang en|el] [--email <addr>] [--must-change]")
+		fmt.Println("  panel-user passwd --user <u> [--pass <p>] [--must-change]   (no --pass: read from stdin; signs the user out)")
+		fmt.Println(exitCodesHelp)
+		st.Close()
+		os.Exit(exitUsage)
 	}
+	if audit != nil {
+		audit(err)
+	}
+	st.Close()
+	exit(args[0], err)
 }
 
 
 func cmdServe(st store.SiteStore, cfg *config.Config, paths config.Paths) error {
-	srv, err := web.New(cfg, paths, st)
+	srv, err := web.New(cfg, paths, st, runner)
 	if err != nil {
 		return err
 	}
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	// SIGTERM is how systemd stops the unit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 	fmt.Println("NGM UI listening on:", cfg.API.Listen)
 	fmt.Println("Open: http://" + cfg.API.Listen + "/ui/login")
 	return srv.Serve(ctx, cfg.API.Listen)
 }
 
-func cmdPanelUser(st store.SiteStore, args []string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("usage: panel-user add --user <u> --pass <p> [--role admin] [--enabled=true|false]")
+func cmdConfig(cfgPath, sandboxDir string, traceExec bool, args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return usagef("usage: config validate [--strict] [--json]")
 	}
-	switch args[0] {
-	case "add":
-		fs := flag.NewFlagSet("panel-user add", flag.ContinueOnError)
-		user := fs.String("user", "", "Username")
-		pass := fs.String("pass", "", "Password")
-		role := fs.String("role", "admin", "Role")
-		enabled := fs.Bool("enabled", true, "Enabled")
-		if err := fs.Parse(args[1:]); err != nil {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	var (
+		strict  = fs.Bool("strict", false, "Fail on warnings too")
+		jsonOut = fs.Bool("json", false, "Print the report as JSON")
+	)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	cfg, err := config.Read(cfgPath)
+	if err != nil {
+		return err
+	}
+	if sandboxDir != "" {
+		if err := sandbox.Reroot(cfg, sandboxDir); err != nil {
 			return err
 		}
-		if strings.TrimSpace(*user) == "" || *pass == "" {
-			return fmt.Errorf("required: --user and --pass")
+		p := cfg.ResolvePaths()
+		runner = sandbox.Runner{LetsEncryptLive: p.LetsEncryptLive, PIDFile: p.NginxPIDFile}
+		if traceExec {
+			runner = &util.TraceRunner{Next: runner, Out: os.Stderr}
 		}
+	}
 
-		hash, err := bcrypt.GenerateFromPassword([]byte(*pass), bcrypt.DefaultCost)
-		if err != nil {
-			return err
-		}
-		pu, err := st.CreatePanelUser(strings.TrimSpace(*user), string(hash), strings.TrimSpace(*role), *enabled)
-		if err != nil {
+	rep := app.CheckConfig(context.Background(), cfg, runner)
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
 			return err
 		}
-		fmt.Println("OK: panel user saved:", pu.Username)
-		return nil
-	default:
-		return fmt.Errorf("unknown panel-user subcommand: %s", args[0])
-	}
-}
-
-
-
-
-func runStatus(cfg *config.Config, paths config.Paths) {
-	fmt.Println("NGM config loaded OK")
-	fmt.Printf("Version: %s  BuildTime: %s\n", Version, BuildTime)
-
-	fmt.Println("---- Nginx ----")
-	fmt.Printf("root        : %s\n", paths.NginxRoot)
-	fmt.Printf("bin         : %s\n", paths.NginxBin)
-	fmt.Printf("main_conf   : %s\n", paths.NginxMainConf)
-	fmt.Printf("sites_dir   : %s\n", paths.NginxSitesDir)
-	fmt.Printf("staging_dir : %s\n", paths.NginxStageDir)
-	fmt.Printf("backup_dir  : %s\n", paths.NginxBackupDir)
-
-	mgr := nginx.NewManager(paths.NginxRoot, paths.NginxBin, paths.NginxMainConf, paths.NginxSitesDir, paths.NginxStageDir, paths.NginxBackupDir)
-	if err := mgr.EnsureLayout(); err != nil {
-		log.Fatalf("nginx layout: %v", err)
+		return rep.Err(*strict)
 	}
-	fmt.Println("---- Layout ----")
-	fmt.Println("nginx directories ensured (sites/staging/backup)")
-
-	fmt.Println("---- Nginx Test ----")
-	if err := mgr.TestConfig(); err != nil {
-		log.Fatalf("nginx test: %v", err)
+	fmt.Println("Config:", rep.Path)
+	section := ""
+	for _, c := range rep.Checks {
+		if c.Level == "ok" && !verbose && c.Section != "config" {
+			continue
+		}
+		if c.Section != section {
+			section = c.Section
+			fmt.Printf("---- %s ----\n", section)
+		}
+		item := c.Item
+		if item != "" {
+			item += ": "
+		}
+		fmt.Printf("%-5s  %s%s\n", strings.ToUpper(c.Level), item, c.Message)
 	}
-	fmt.Println("nginx config test OK")
-
-	fmt.Println("---- API ----")
-	fmt.Printf("listen      : %s\n", cfg.API.Listen)
-	fmt.Printf("allow_ips   : %v\n", cfg.API.AllowIPs)
-
-	fmt.Println("---- Certs ----")
-	fmt.Printf("mode        : %s\n", cfg.Certs.Mode)
-	fmt.Printf("certbot_bin : %s\n", paths.CertbotBin)
-	fmt.Printf("webroot     : %s\n", paths.ACMEWebroot)
-	fmt.Printf("live_dir    : %s\n", paths.LetsEncryptLive)
-
-	fmt.Println("---- PHP-FPM ----")
-	fmt.Printf("default     : %s\n", cfg.PHPFPM.DefaultVersion)
-	fmt.Printf("versions    : %d\n", len(cfg.PHPFPM.Versions))
+	fmt.Printf("%d check(s), %d error(s), %d warning(s)\n", len(rep.Checks), rep.Errors, rep.Warnings)
+	return rep.Err(*strict)
 }
 
-func cmdSite(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+func cmdPlan(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: site <add|list|rm> ...")
+		return usagef("usage: plan <list|add|rm|assign> ...")
 	}
 
-	core, err := app.New(cfg, paths, st)
+	core, err := app.New(cfg, paths, st, runner)
 	if err != nil {
 		return err
 	}
 
 	switch args[0] {
+	case "list":
+		plans, err := core.PlanList()
+		if err != nil {
+			return err
+		}
+		if len(plans) == 0 {
+			fmt.Println("(no plans)")
+		} else {
+			fmt.Printf("%-15s  %-9s  %-11s  %-15s  %-12s  %s\n",
+				"PLAN", "MAX_SITES", "MAX_TARGETS", "PHP", "BANDWIDTH_MB", "DISK_MB")
+			for _, p := range plans {
+				php := strings.Join(p.PHPVersions, ",")
+				if php == "" {
+					php = "any"
+				}
+				fmt.Printf("%-15s  %-9d  %-11d  %-15s  %-12d  %d\n",
+					p.Name, p.MaxSites, p.MaxProxyTargets, php, p.BandwidthMB, p.DiskMB)
+			}
+		}
+
+		users, err := core.UserUsageList()
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Printf("%-20s  %-15s  %s\n", "USER", "PLAN", "SITES")
+		for _, u := range users {
+			plan, limit := "-", ""
+			if u.Plan != nil {
+				plan = u.Plan.Name
+				if u.Plan.MaxSites > 0 {
+					limit = fmt.Sprintf("/%d", u.Plan.MaxSites)
+				}
+			}
+			fmt.Printf("%-20s  %-15s  %d%s\n", u.User.Username, plan, u.Sites, limit)
+		}
+		return nil
+
 	case "add":
-		fs := flag.NewFlagSet("site add", flag.ContinueOnError)
+		fs := flag.NewFlagSet("plan add", flag.ContinueOnError)
 		var (
-			user      = fs.String("user", "", "Owner username")
-			domain    = fs.String("domain", "", "Domain (e.g. example.com)")
-			mode      = fs.String("mode", "php", "Mode: php|proxy|static")
-			phpv      = fs.String("php", cfg.PHPFPM.DefaultVersion, "PHP version (e.g. 8.3)")
-			webroot   = fs.String("webroot", "", "Webroot path (optional; default derived from user+domain)")
-			http3     = fs.Bool("http3", true, "Enable HTTP/3")
-			provision = fs.Bool("provision", true, "Create linux user (if missing) + create site dirs")
-			skipCert  = fs.Bool("skip-cert", false, "Skip automatic certificate issuance")
-			applyNow  = fs.Bool("apply-now", true, "Apply this vhost immediately (needed for HTTP-01)")
+			name       = fs.String("name", "", "Plan name")
+			maxSites   = fs.Int("max-sites", 0, "Max sites per user (0 = unlimited)")
+			maxTargets = fs.Int("max-targets", 0, "Max proxy targets per site (0 = unlimited)")
+			php        = fs.String("php", "", "Allowed PHP versions, comma separated (empty = all)")
+			bandwidth  = fs.Int64("bandwidth-mb", 0, "Monthly bandwidth quota in MB (0 = unlimited)")
+			disk       = fs.Int64("disk-mb", 0, "Disk quota in MB (0 = unlimited)")
 		)
-		if err := fs.Parse(args[1:]); err != nil {
+		if err := parseFlags(fs, args[1:]); err != nil {
 			return err
 		}
-		if *user == "" || *domain == "" {
-			return fmt.Errorf("required: --user and --domain")
+		if strings.TrimSpace(*name) == "" {
+			return usagef("required: --name")
 		}
-
-		res, err := core.SiteAdd(context.Background(), app.SiteAddRequest{
-			User:      *user,
-			Domain:    *domain,
-			Mode:      *mode,
-			PHP:       *phpv,
-			Webroot:   *webroot,
-			HTTP3:     *http3,
-			Provision: *provision,
-			SkipCert:  *skipCert,
-			ApplyNow:  *applyNow,
-		})
+		p := store.Plan{
+			Name:            *name,
+			MaxSites:        *maxSites,
+			MaxProxyTargets: *maxTargets,
+			BandwidthMB:     *bandwidth,
+			DiskMB:          *disk,
+		}
+		for _, v := range strings.Split(*php, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				p.PHPVersions = append(p.PHPVersions, v)
+			}
+		}
+		saved, err := core.PlanSave(p)
 		if err != nil {
 			return err
 		}
+		fmt.Println("OK: plan saved:", saved.Name)
+		return nil
 
-		s := res.Site
-		fmt.Println("OK: site saved")
-		fmt.Printf("  domain : %s\n", s.Domain)
-		fmt.Printf("  user_id: %d\n", s.UserID)
-		fmt.Printf("  mode   : %s\n", s.Mode)
-		fmt.Printf("  webroot: %s\n", s.Webroot)
-		fmt.Printf("  php    : %s\n", s.PHPVersion)
-		fmt.Printf("  http3  : %v\n", s.EnableHTTP3)
-		for _, w := range res.Warnings {
-			fmt.Println("WARNING:", w)
+	case "rm":
+		fs := flag.NewFlagSet("plan rm", flag.ContinueOnError)
+		name := fs.String("name", "", "Plan name")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if err := core.PlanDelete(*name); err != nil {
+			return err
 		}
+		fmt.Println("OK: plan removed:", *name)
 		return nil
 
+	case "assign":
+		fs := flag.NewFlagSet("plan assign", flag.ContinueOnError)
+		user := fs.String("user", "", "Hosting (system) user")
+		plan := fs.String("plan", "", "Plan name (empty = remove plan)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*user) == "" {
+			return usagef("required: --user")
+		}
+		if err := core.UserSetPlan(*user, *plan); err != nil {
+			return err
+		}
+		fmt.Println("OK: plan assigned")
+		return nil
 
+	default:
+		return usagef("unknown plan subcommand: %s", args[0])
+	}
+}
 
-
-
-
-
-
-
-
-
-	case "list":
-		items, err := core.SiteList(context.Background())
+func cmdFPM(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 || (args[0] != "pools" && args[0] != "adopt") {
+		return usagef("usage: fpm <pools|adopt> ...")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	if args[0] == "pools" {
+		pools, err := core.FPMPools()
 		if err != nil {
 			return err
 		}
-		if len(items) == 0 {
-			fmt.Println("(no sites)")
+		if len(pools) == 0 {
+			fmt.Println("OK: every php-fpm pool is managed by ngm")
 			return nil
 		}
-
-		fmt.Printf("%-25s  %-6s  %-5s  %-9s  %-10s  %-20s  %-40s  %s\n",
-			"DOMAIN", "MODE", "HTTP3", "ENABLED", "STATE", "LAST_APPLIED", "WEBROOT", "PHP")
-
-		for _, it := range items {
-			s := it.Site
-			enabledStr := "yes"
-			if !s.Enabled {
-				enabledStr = "no"
+		for _, p := range pools {
+			site := "-"
+			if p.Domain != "" {
+				site = fmt.Sprintf("%s (by %s)", p.Domain, p.Match)
 			}
-			fmt.Printf("%-25s  %-6s  %-5v  %-9s  %-10s  %-20s  %-40s  %s\n",
-				s.Domain, s.Mode, s.EnableHTTP3, enabledStr, it.State, it.Last, trimLen(s.Webroot, 40), s.PHPVersion)
+			fmt.Printf("%-5s %-24s %-40s site=%s settings=%d\n", p.Version, p.Name, p.File, site, len(p.Overrides()))
 		}
+		fmt.Println("Adopt with: ngm fpm adopt --file <pool.conf> [--domain <d>]")
 		return nil
+	}
 
+	fs := flag.NewFlagSet("fpm adopt", flag.ContinueOnError)
+	var (
+		file   = fs.String("file", "", "Pool file to adopt (required)")
+		domain = fs.String("domain", "", "Site the pool serves (default: the mapped site)")
+	)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*file) == "" {
+		return usagef("required: --file")
+	}
+	p, bak, err := core.FPMAdopt(context.Background(), *file, *domain)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("OK: pool %s now managed as the pool of %s (%d setting(s) kept; original: %s)\n", p.Name, p.Domain, len(p.Overrides()), bak)
+	return nil
+}
 
-
-
-	case "rm":
-		fs := flag.NewFlagSet("site rm", flag.ContinueOnError)
-		var domain = fs.String("domain", "", "Domain to remove (soft delete)")
-		if err := fs.Parse(args[1:]); err != nil {
-			return err
+func cmdPHP(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return usagef("usage: php migrate --from <ver> --to <ver> [--tag <t>] [--batch 5] [--dry-run]")
+	}
+	fs := flag.NewFlagSet("php migrate", flag.ContinueOnError)
+	var (
+		from   = fs.String("from", "", "PHP version the sites are on (required)")
+		to     = fs.String("to", "", "PHP version to move them to (required)")
+		tag    = fs.String("tag", "", "Only sites with this tag")
+		batch  = fs.Int("batch", 5, "Sites per batch; each batch is health-checked before the next")
+		dryRun = fs.Bool("dry-run", false, "List the sites and batches without changing anything")
+	)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*from) == "" || strings.TrimSpace(*to) == "" {
+		return usagef("required: --from and --to")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	rep, err := core.PHPMigrate(context.Background(), app.PHPMigrateRequest{
+		From: *from, To: *to, Tag: *tag, Batch: *batch, DryRun: *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if len(rep.Sites) == 0 {
+		fmt.Printf("OK: no php sites on PHP %s to migrate\n", rep.From)
+		return nil
+	}
+	for _, s := range rep.Sites {
+		batch := "-"
+		if s.Batch > 0 {
+			batch = fmt.Sprint(s.Batch)
 		}
-		if *domain == "" {
-			return fmt.Errorf("required: --domain")
+		line := fmt.Sprintf("%-3s %-14s %s", batch, s.Status, s.Domain)
+		if s.Detail != "" {
+			line += " (" + s.Detail + ")"
 		}
-		if err := core.SiteDisable(context.Background(), *domain); err != nil { return err }
-                d := strings.ToLower(strings.TrimSpace(*domain))
-                fmt.Println("OK: site disabled (pending delete):", d)
-		return nil
-
+		fmt.Println(line)
+	}
+	switch {
+	case rep.DryRun:
+		fmt.Printf("DRY-RUN: %d site(s) would move from PHP %s to %s in %d batch(es), %d skipped\n",
+			rep.Count("would-migrate"), rep.From, rep.To, rep.Batches, rep.Count("skipped"))
+	case rep.Stopped != "":
+		return fmt.Errorf("stopped at %s: %d migrated, %d rolled back, %d not attempted",
+			rep.Stopped, rep.Count("migrated"), rep.Count("rolled-back")+rep.Count("failed"), rep.Count("not-attempted"))
+	default:
+		fmt.Printf("OK: %d site(s) moved from PHP %s to %s, %d skipped\n", rep.Count("migrated"), rep.From, rep.To, rep.Count("skipped"))
+	}
+	return nil
+}
 
+func cmdDrift(st store.SiteStore, cfg *config.Config, paths config.Paths) error {
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	rep, err := core.Drift()
+	if err != nil {
+		return err
+	}
+	if rep.Empty() {
+		fmt.Printf("OK: %s matches the database\n", paths.NginxSitesDir)
+		return nil
+	}
+	printOrphans(rep.Orphans)
+	for _, d := range rep.Missing {
+		fmt.Printf("missing  %s (enabled and applied, but %s.conf is gone; run: ngm apply --domain %s)\n", d, d, d)
+	}
+	if len(rep.Orphans) > 0 {
+		fmt.Println("Remove orphans with: ngm prune --orphans --yes")
+	}
+	return nil
+}
 
-	case "edit":
-		fs := flag.NewFlagSet("site edit", flag.ContinueOnError)
-		var (
+func cmdConflicts(st store.SiteStore, cfg *config.Config, paths config.Paths) error {
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	conflicts, err := core.ServerNameConflicts()
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		fmt.Println("OK: every hostname is claimed by one vhost")
+		return nil
+	}
+	for _, c := range conflicts {
+		fmt.Printf("%-9s %s\n", c.Kind, c.Name)
+		for _, cl := range c.Claims {
+			fmt.Printf("          %s\n", cl)
+		}
+		fmt.Printf("          hint: %s\n", c.Hint)
+	}
+	return fmt.Errorf("%d server_name conflict(s)", len(conflicts))
+}
+
+func printOrphans(orphans []app.OrphanConf) {
+	for _, o := range orphans {
+		why := "no such site"
+		if o.Site == "disabled" {
+			why = "site disabled"
+		}
+		fmt.Printf("orphan   %s (%s, %d bytes, modified %s)\n", o.File, why, o.Size, o.ModTime.Format("2006-01-02 15:04"))
+	}
+}
+
+func cmdSFTP(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: sftp <jail|list|sync>")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "jail":
+		fs := flag.NewFlagSet("sftp jail", flag.ContinueOnError)
+		var (
+			user = fs.String("user", "", "Hosting user (required)")
+			off  = fs.Bool("off", false, "Lift the jail (normal ssh login again)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*user) == "" {
+			return usagef("required: --user")
+		}
+		j, err := core.UserSFTPJail(context.Background(), *user, !*off)
+		if err != nil {
+			return err
+		}
+		if *off {
+			fmt.Printf("OK: %s is no longer jailed\n", j.Username)
+			return nil
+		}
+		fmt.Printf("OK: %s is sftp-only, chrooted to %s\n", j.Username, j.Dir)
+		for _, d := range j.Sites {
+			fmt.Printf("  /%s\n", d)
+		}
+		return nil
+
+	case "list":
+		jails, err := core.SFTPJails()
+		if err != nil {
+			return err
+		}
+		if len(jails) == 0 {
+			fmt.Println("(no jailed users)")
+			return nil
+		}
+		for _, j := range jails {
+			fmt.Printf("%-16s %-28s %s\n", j.Username, j.Dir, strings.Join(j.Sites, ","))
+		}
+		return nil
+
+	case "sync":
+		if err := core.SyncSFTPJails(); err != nil {
+			return err
+		}
+		fmt.Println("OK: jails re-bound")
+		return nil
+	}
+	return usagef("unknown sftp subcommand %q (use jail|list|sync)", args[0])
+}
+
+func cmdActivity(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("activity", flag.ContinueOnError)
+	var (
+		user = fs.String("user", "", "Hosting user (required)")
+		n    = fs.Int("n", 50, "Number of entries")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*user) == "" {
+		return usagef("required: --user")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	entries, err := core.OwnerActivity(*user, *n)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("no activity")
+	}
+	for _, e := range entries {
+		d := e.Domain
+		if d == "" {
+			d = "-"
+		}
+		fmt.Printf("%s  %-7s  %-10s  %-24s  %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Level, e.Source, d, e.Message)
+	}
+	return nil
+}
+
+func cmdAudit(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	var (
+		actor  = fs.String("actor", "", "Only this actor (OS user, panel user or token:<name>)")
+		domain = fs.String("domain", "", "Only actions on this site")
+		via    = fs.String("via", "", "Only this channel: cli, ui or api")
+		n      = fs.Int("n", 50, "Number of entries")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	entries, err := core.AuditEntries(store.AuditQuery{Actor: *actor, Target: strings.ToLower(*domain), Via: *via, Limit: *n})
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("no audit entries")
+	}
+	for _, e := range entries {
+		d := e.Target
+		if d == "" {
+			d = "-"
+		}
+		fmt.Printf("%s  %-3s  %-16s  %-24s  %s  %s\n", e.At.Local().Format("2006-01-02 15:04:05"), e.Via, e.Actor, d, e.Status, e.Action)
+		if e.Error != "" {
+			fmt.Printf("    error: %s\n", e.Error)
+		}
+		if e.Old != "" || e.New != "" {
+			fmt.Printf("    old: %s\n    new: %s\n", e.Old, e.New)
+		}
+	}
+	return nil
+}
+
+func cmdStandby(st *storesqlite.Store, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: standby <status|pull|promote>")
+	}
+	switch args[0] {
+	case "status":
+		s, err := app.ReadStandbyState(cfg)
+		if err != nil {
+			return err
+		}
+		primary := cfg.Cluster.Standby.Primary
+		if primary == "" {
+			primary = "(none: not a standby)"
+		}
+		fmt.Printf("primary:   %s\n", primary)
+		fmt.Printf("dir:       %s\n", cfg.Cluster.Standby.Dir)
+		if s.PulledAt.IsZero() {
+			fmt.Println("pulled:    never")
+		} else {
+			fmt.Printf("pulled:    %s (%s ago)\n", s.PulledAt.Local().Format(time.RFC3339), time.Since(s.PulledAt).Round(time.Second))
+			fmt.Printf("snapshot:  %s, %d byte database, %d config file(s)\n", s.Snapshot.Local().Format(time.RFC3339), s.DBBytes, s.Files)
+		}
+		if s.LastError != "" {
+			fmt.Printf("last pull: FAILED: %s\n", s.LastError)
+		}
+		if s.Promoted != nil {
+			fmt.Printf("promoted:  %s\n", s.Promoted.Local().Format(time.RFC3339))
+		}
+		return nil
+
+	case "pull":
+		core, err := app.New(cfg, paths, st, runner)
+		if err != nil {
+			return err
+		}
+		s, err := core.StandbyPull(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: pulled %d byte database and %d config file(s) from %s\n", s.DBBytes, s.Files, s.Primary)
+		return nil
+
+	case "promote":
+		fs := flag.NewFlagSet("standby promote", flag.ContinueOnError)
+		noApply := fs.Bool("no-apply", false, "Only install the database (apply later)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		// the pulled database replaces ours: nothing may hold it open
+		if err := st.Close(); err != nil {
+			return err
+		}
+		s, err := app.PromoteStandby(cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: promoted snapshot of %s taken %s (previous database: %s.pre-promote)\n",
+			s.Primary, s.Snapshot.Local().Format(time.RFC3339), cfg.Storage.SQLitePath)
+		fmt.Println("Remove cluster.standby.primary from the config before the old primary comes back.")
+		if *noApply {
+			return nil
+		}
+		nst, err := storesqlite.Open(cfg.Storage.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer nst.Close()
+		if err := nst.Migrate(); err != nil {
+			return err
+		}
+		core, err := app.New(cfg, paths, nst, runner)
+		if err != nil {
+			return err
+		}
+		core.Audit("warning", "standby", "promoted: now serving the snapshot of %s taken %s", s.Primary, s.Snapshot.Format(time.RFC3339))
+		res, err := core.Apply(context.Background(), app.ApplyRequest{All: true})
+		for _, r := range res.Domains {
+			if r.Status == "fail" {
+				fmt.Println("FAIL:", r.Domain, "-", r.Error)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("apply after promote: %w (pulled configs for comparison: %s)", err, app.StandbyConfDir(cfg))
+		}
+		fmt.Printf("OK: applied %d site(s)\n", len(res.Domains))
+		return nil
+
+	default:
+		return usagef("usage: standby <status|pull|promote>")
+	}
+}
+
+func cmdMonitoring(args []string) error {
+	if len(args) == 0 || args[0] != "export-rules" {
+		return usagef("usage: monitoring export-rules [--out <dir>] [--job ngm] [--cert-days 14] [--dashboard]")
+	}
+	o := monitoring.DefaultOptions()
+	fs := flag.NewFlagSet("monitoring export-rules", flag.ContinueOnError)
+	var (
+		out       = fs.String("out", "", "Write ngm-rules.yml and ngm-dashboard.json into this directory (default: print)")
+		dashboard = fs.Bool("dashboard", false, "Print the Grafana dashboard instead of the rules")
+	)
+	fs.StringVar(&o.Job, "job", o.Job, "Prometheus job label of the ngm scrape (empty = any)")
+	fs.IntVar(&o.CertDays, "cert-days", o.CertDays, "Alert when a certificate expires within this many days")
+	fs.IntVar(&o.CheckMaxAge, "check-max-age", o.CheckMaxAge, "Alert after this many minutes without an uptime check")
+	fs.StringVar(&o.DownFor, "down-for", o.DownFor, "How long a site must fail its uptime check before alerting")
+	fs.StringVar(&o.DatasourceID, "datasource", "", "Grafana Prometheus datasource uid (default: asked on import)")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if o.CertDays <= 0 || o.CheckMaxAge <= 0 {
+		return usagef("--cert-days and --check-max-age must be positive")
+	}
+	rules, err := monitoring.Rules(o)
+	if err != nil {
+		return err
+	}
+	dash, err := monitoring.Dashboard(o)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		if *dashboard {
+			fmt.Println(string(dash))
+		} else {
+			fmt.Print(string(rules))
+		}
+		return nil
+	}
+	if err := util.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"ngm-rules.yml", rules}, {"ngm-dashboard.json", dash}} {
+		path := filepath.Join(*out, f.name)
+		if err := util.WriteFileAtomic(path, f.data, 0644); err != nil {
+			return err
+		}
+		fmt.Println("wrote", path)
+	}
+	return nil
+}
+
+func cmdToken(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: token <create|list|rotate|revoke>")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("token create", flag.ContinueOnError)
+		var (
+			name   = fs.String("name", "", "Token name, e.g. prometheus (required)")
+			scopes = fs.String("scopes", "", "Comma-separated scopes: metrics, read, sites, certs, apply, write, admin (required)")
+			days    = fs.Int("days", 0, "Expire after N days (0 = never)")
+			domains = fs.String("domains", "", "Comma-separated domains the token is limited to (each covers its subdomains)")
+			user    = fs.String("user", "", "Hosting user whose sites the token is limited to")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *name == "" || *scopes == "" {
+			return usagef("required: --name and --scopes")
+		}
+		lim := app.APITokenLimit{User: *user}
+		if *domains != "" {
+			lim.Domains = strings.Split(*domains, ",")
+		}
+		tok, t, err := core.APITokenCreate(*name, strings.Split(*scopes, ","), time.Duration(*days)*24*time.Hour, lim)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: token %s (scopes %s, expires %s, sites %s)\n", t.Name, strings.Join(t.Scopes, ","), fmtTokenTime(t.ExpiresAt, "never"), fmtTokenLimit(t))
+		fmt.Println(tok)
+		fmt.Println("Store it now: it is not shown again.")
+		return nil
+
+	case "list":
+		list, err := core.APITokens()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("(no tokens)")
+			return nil
+		}
+		fmt.Printf("%-20s  %-18s  %-22s  %-16s  %-16s  %-16s  %-6s  %s\n", "NAME", "ID", "SCOPES", "EXPIRES", "LAST_USED", "FROM", "USES", "SITES")
+		for _, t := range list {
+			expires := fmtTokenTime(t.ExpiresAt, "never")
+			if t.RevokedAt != nil {
+				expires = "revoked"
+			}
+			fmt.Printf("%-20s  %-18s  %-22s  %-16s  %-16s  %-16s  %-6d  %s\n",
+				t.Name, "ngm_"+t.Prefix, strings.Join(t.Scopes, ","), expires, fmtTokenTime(t.LastUsedAt, "-"), t.LastUsedIP, t.Uses, fmtTokenLimit(t))
+		}
+		return nil
+
+	case "rotate":
+		fs := flag.NewFlagSet("token rotate", flag.ContinueOnError)
+		var (
+			name  = fs.String("name", "", "Token name (required)")
+			grace = fs.Duration("grace", 0, "Keep accepting the old token this long (e.g. 1h)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return usagef("required: --name")
+		}
+		tok, err := core.APITokenRotate(*name, *grace)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: token %s rotated (old token valid for %s)\n", *name, *grace)
+		fmt.Println(tok)
+		fmt.Println("Store it now: it is not shown again.")
+		return nil
+
+	case "revoke":
+		fs := flag.NewFlagSet("token revoke", flag.ContinueOnError)
+		var name = fs.String("name", "", "Token name (required)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *name == "" {
+			return usagef("required: --name")
+		}
+		if err := core.APITokenRevoke(*name); err != nil {
+			return err
+		}
+		fmt.Printf("OK: token %s revoked\n", *name)
+		return nil
+
+	default:
+		return usagef("usage: token <create|list|rotate|revoke>")
+	}
+}
+
+func fmtTokenTime(t *time.Time, none string) string {
+	if t == nil {
+		return none
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// fmtTokenLimit is the sites a token is limited to ("all" when it is not).
+func fmtTokenLimit(t store.APIToken) string {
+	var parts []string
+	if len(t.Domains) > 0 {
+		parts = append(parts, strings.Join(t.Domains, ","))
+	}
+	if t.HostingUser != "" {
+		parts = append(parts, "user:"+t.HostingUser)
+	}
+	if len(parts) == 0 {
+		return "all"
+	}
+	return strings.Join(parts, " ")
+}
+
+func cmdNotify(st store.SiteStore, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: notify <test|queue>")
+	}
+	switch args[0] {
+	case "test":
+		fs := flag.NewFlagSet("notify test", flag.ContinueOnError)
+		var to = fs.String("to", "", "Recipient address (required)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*to) == "" {
+			return usagef("required: --to")
+		}
+		mailer := notify.NewQueuedMailer(cfg.Notify.SMTP, st)
+		defer mailer.Close()
+		msg, err := mailer.Test(*to)
+		if err != nil {
+			return err
+		}
+		if msg.Status != store.MailSent {
+			return fmt.Errorf("test mail to %s failed: %s", msg.To, msg.LastError)
+		}
+		fmt.Printf("OK: test mail sent to %s via %s:%d\n", msg.To, cfg.Notify.SMTP.Host, cfg.Notify.SMTP.Port)
+		return nil
+
+	case "queue":
+		fs := flag.NewFlagSet("notify queue", flag.ContinueOnError)
+		var limit = fs.Int("limit", 50, "Messages to show (newest first)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		list, err := st.ListMail(*limit)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("(no mail)")
+			return nil
+		}
+		fmt.Printf("%-6s  %-16s  %-7s  %-3s  %-30s  %-40s  %s\n", "ID", "CREATED", "STATUS", "TRY", "TO", "SUBJECT", "LAST ERROR / NEXT ATTEMPT")
+		for _, m := range list {
+			detail := m.LastError
+			if m.Status == store.MailQueued && m.NextAttemptAt != nil {
+				detail = "next " + m.NextAttemptAt.Local().Format("2006-01-02 15:04") + " " + detail
+			}
+			fmt.Printf("%-6d  %-16s  %-7s  %-3d  %-30s  %-40s  %s\n",
+				m.ID, m.CreatedAt.Local().Format("2006-01-02 15:04"), m.Status, m.Attempts, trimLen(m.To, 30), trimLen(m.Subject, 40), detail)
+		}
+		return nil
+
+	default:
+		return usagef("usage: notify <test|queue>")
+	}
+}
+
+func cmdRender(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	var (
+		domain = fs.String("domain", "", "Site domain")
+		diff   = fs.Bool("diff", false, "Print the diff against the live vhost instead")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *domain == "" {
+		return usagef("usage: render --domain <d> [--diff]")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	r, err := core.SiteRender(context.Background(), *domain)
+	if err != nil {
+		return err
+	}
+	if !*diff {
+		_, err := os.Stdout.Write(r.Conf)
+		return err
+	}
+	switch {
+	case !r.Enabled:
+		fmt.Fprintf(os.Stderr, "note: %s is disabled; an apply would remove its vhost\n", r.Domain)
+	case r.Live == nil:
+		fmt.Fprintf(os.Stderr, "note: %s has no live vhost yet\n", r.Domain)
+	}
+	if r.Diff == "" {
+		fmt.Println("OK: same as the live vhost")
+		return nil
+	}
+	fmt.Print(r.Diff)
+	fmt.Fprintf(os.Stderr, "%d line(s) added, %d removed (render %s)\n", r.Added, r.Removed, r.Hash)
+	return nil
+}
+
+func cmdLogs(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	var (
+		domain = fs.String("domain", "", "Site domain")
+		name   = fs.String("log", "error", "Log: error or access")
+		n      = fs.Int("n", 20, "Number of lines (at most 2000)")
+		follow = fs.Bool("follow", false, "Keep printing the lines appended to the log")
+		idle   = fs.Duration("idle", 0, "With --follow: stop once nothing was logged for this long (0 = never)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *domain == "" {
+		return usagef("usage: logs --domain <d> [--log error|access] [-n 20] [--follow] [--idle 10m]")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	// opened before the tail is read: a line logged in between shows twice, not never
+	var fl *app.LogFollow
+	if *follow {
+		if fl, err = core.FollowSiteLog(*domain, *name); err != nil {
+			return err
+		}
+		defer fl.Close()
+	}
+	tail, err := core.SiteLogTail(*domain, *name, *n)
+	if err != nil {
+		return err
+	}
+	if tail.Missing {
+		fmt.Fprintf(os.Stderr, "note: %s does not exist yet\n", tail.Path)
+	}
+	for _, l := range tail.Lines {
+		fmt.Println(l.Text)
+	}
+	if fl == nil {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	poll := time.NewTicker(app.FollowPoll)
+	defer poll.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		}
+		c, err := fl.Next()
+		if err != nil {
+			return err
+		}
+		if c.Rotated {
+			fmt.Fprintf(os.Stderr, "-- %s was rotated --\n", fl.Path)
+		}
+		if c.Skipped > 0 || c.SkippedBytes > 0 {
+			fmt.Fprintf(os.Stderr, "-- skipped %d line(s) and %d byte(s): logged faster than printed --\n", c.Skipped, c.SkippedBytes)
+		}
+		for _, l := range c.Lines {
+			fmt.Println(l.Text)
+		}
+		if len(c.Lines) > 0 || c.Rotated {
+			last = time.Now()
+		} else if *idle > 0 && time.Since(last) > *idle {
+			fmt.Fprintf(os.Stderr, "-- nothing logged for %s: stopped --\n", *idle)
+			return nil
+		}
+	}
+}
+
+func cmdPreview(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ContinueOnError)
+	var (
+		domain = fs.String("domain", "", "Site to preview")
+		off    = fs.Bool("off", false, "Stop serving the preview hostname and delete its certificate")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *domain == "" {
+		return usagef("usage: preview --domain <d> [--off]")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	if *off {
+		if err := core.SitePreviewOff(context.Background(), *domain); err != nil {
+			return err
+		}
+		fmt.Printf("OK: preview of %s removed\n", *domain)
+		return nil
+	}
+	info, err := core.SitePreview(context.Background(), *domain)
+	if err != nil {
+		return err
+	}
+	if info.Host != "" {
+		fmt.Printf("OK: %s is served on %s\n", info.Domain, info.URL)
+		if info.CertError != "" {
+			fmt.Printf("certificate: self-signed (browsers will warn): %s\n", info.CertError)
+		} else {
+			fmt.Printf("certificate: %s\n", info.Cert)
+		}
+	} else {
+		fmt.Println("no preview hostname (hosting.preview.domain is not set)")
+	}
+	fmt.Printf("\nTo test %s under its own name, add to /etc/hosts (remove it after the DNS switch):\n", info.Domain)
+	if len(info.HostsLines) == 0 {
+		fmt.Printf("  <this server's IP> %s\n", info.Domain)
+	}
+	for _, l := range info.HostsLines {
+		fmt.Println("  " + l)
+	}
+	fmt.Println("It is served with its own certificate if it has one, self-signed otherwise.")
+	return nil
+}
+
+func cmdDNS(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: dns <zones|encrypt|record>")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "zones":
+		zones := core.DNSZones(context.Background())
+		if len(zones) == 0 {
+			fmt.Println("(no dns.zones configured)")
+			return nil
+		}
+		fmt.Printf("%-30s  %-13s  %-6s  %s\n", "ZONE", "PROVIDER", "DNS01", "STATUS")
+		for _, z := range zones {
+			status := "ok"
+			if z.Error != "" {
+				status = "ERROR: " + z.Error
+			}
+			fmt.Printf("%-30s  %-13s  %-6v  %s\n", z.Zone, z.Provider, z.DNS01, status)
+		}
+		return nil
+
+	case "encrypt":
+		b, err := io.ReadAll(io.LimitReader(os.Stdin, 64<<10))
+		if err != nil {
+			return err
+		}
+		enc, err := core.DNSEncrypt(string(b))
+		if err != nil {
+			return err
+		}
+		fmt.Println(enc)
+		return nil
+
+	case "record":
+		fs := flag.NewFlagSet("dns record", flag.ContinueOnError)
+		var domain = fs.String("domain", "", "Domain to point at dns.addresses (required)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		addrs, err := core.SiteDNSRecords(context.Background(), *domain)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: %s -> %s\n", *domain, strings.Join(addrs, ", "))
+		return nil
+
+	default:
+		return usagef("usage: dns <zones|encrypt|record>")
+	}
+}
+
+func cmdSnapshot(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: snapshot <take|list|diff>")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "take":
+		fs := flag.NewFlagSet("snapshot take", flag.ContinueOnError)
+		var notifyFlag = fs.Bool("notify", false, "Mail/post the changes like `ngm serve` does (snapshots.notify_emails, snapshots.webhooks)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		rep, err := core.SnapshotTake()
+		if err != nil {
+			return err
+		}
+		switch {
+		case !rep.Changed():
+			fmt.Printf("OK: unchanged since %s\n", rep.Snapshot)
+			return nil
+		case rep.Previous == "":
+			fmt.Printf("OK: %s (the first snapshot)\n", rep.Snapshot)
+			return nil
+		}
+		fmt.Printf("OK: %s, %d file(s) changed since %s\n", rep.Snapshot, len(rep.Changes), rep.Previous)
+		printSnapshotChanges(rep)
+		if *notifyFlag {
+			mailer := notify.NewQueuedMailer(cfg.Notify.SMTP, st)
+			defer mailer.Close()
+			core.NotifySnapshot(context.Background(), mailer, rep)
+		}
+		return nil
+
+	case "list":
+		list, err := core.ConfigSnapshots()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Printf("(no snapshots under %s)\n", cfg.Snapshots.Dir)
+			return nil
+		}
+		fmt.Printf("%-40s  %-20s  %s\n", "NAME", "TAKEN", "SIZE")
+		for _, sn := range list {
+			fmt.Printf("%-40s  %-20s  %d\n", sn.Name, sn.CreatedAt.Local().Format("2006-01-02 15:04:05"), sn.Size)
+		}
+		return nil
+
+	case "diff":
+		fs := flag.NewFlagSet("snapshot diff", flag.ContinueOnError)
+		var (
+			from = fs.String("from", "", "Older snapshot (default: the one before --to)")
+			to   = fs.String("to", "", "Newer snapshot (default: the newest)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		rep, err := core.SnapshotDiff(*from, *to)
+		if err != nil {
+			return err
+		}
+		if !rep.Changed() {
+			fmt.Printf("%s and %s are the same\n", rep.Previous, rep.Snapshot)
+			return nil
+		}
+		printSnapshotChanges(rep)
+		fmt.Print("\n" + rep.Diff)
+		return nil
+
+	default:
+		return usagef("usage: snapshot <take|list|diff>")
+	}
+}
+
+func printSnapshotChanges(rep app.SnapshotReport) {
+	for _, c := range rep.Changes {
+		fmt.Printf("  %-8s  %s  (+%d -%d)\n", c.Change, c.Path, c.Added, c.Removed)
+	}
+}
+
+func cmdPrune(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	var (
+		orphans = fs.Bool("orphans", false, "Prune vhost files in sites_dir without an enabled site")
+		yes     = fs.Bool("yes", false, "Really remove them (otherwise only list what would go)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !*orphans {
+		return usagef("usage: prune --orphans [--yes]")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		rep, err := core.Drift()
+		if err != nil {
+			return err
+		}
+		if len(rep.Orphans) == 0 {
+			fmt.Println("OK: no orphaned vhosts")
+			return nil
+		}
+		printOrphans(rep.Orphans)
+		fmt.Printf("dry-run: %d file(s) would be backed up and removed; re-run with --yes\n", len(rep.Orphans))
+		return nil
+	}
+	pruned, bak, err := core.PruneOrphans(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(pruned) == 0 {
+		fmt.Println("OK: no orphaned vhosts")
+		return nil
+	}
+	printOrphans(pruned)
+	fmt.Printf("OK: removed %d file(s), nginx reloaded (backup: %s)\n", len(pruned), bak)
+	return nil
+}
+
+func cmdGC(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	var (
+		grace = fs.Duration("grace", cfg.GC.GraceDuration(), "Keep leftovers changed within this long")
+		yes   = fs.Bool("yes", false, "Really remove them (otherwise only list what would go)")
+	)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *grace < 0 {
+		return usagef("--grace cannot be negative")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	rep, err := core.GC(*grace, !*yes)
+	if err != nil {
+		return err
+	}
+	if len(rep.Items) == 0 {
+		fmt.Println("OK: no leftovers of deleted sites")
+		return nil
+	}
+	stale := 0
+	for _, it := range rep.Items {
+		what := "stale"
+		switch {
+		case it.Kept:
+			what = "kept"
+		case *yes:
+			what = "removed"
+		}
+		if !it.Kept {
+			stale++
+		}
+		fmt.Printf("%-8s %-10s %s (%s, %d bytes, modified %s)\n", what, it.Kind, it.Path, it.Name, it.Size, it.ModTime.Format("2006-01-02 15:04"))
+	}
+	if !*yes {
+		fmt.Printf("dry-run: %d leftover(s) would be removed, %d kept (changed within %s); re-run with --yes\n", stale, len(rep.Items)-stale, *grace)
+		return nil
+	}
+	fmt.Printf("OK: removed %d leftover(s), %d bytes\n", rep.Removed, rep.Freed)
+	return nil
+}
+
+func cmdGlobal(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 || args[0] != "apply" {
+		return usagef("usage: global apply [--dry-run]")
+	}
+	fs := flag.NewFlagSet("global apply", flag.ContinueOnError)
+	dry := fs.Bool("dry-run", false, "Render and show the snippets without publishing")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	res, err := core.GlobalApply(context.Background(), *dry)
+	if res.Warning != "" {
+		fmt.Println("WARNING:", res.Warning)
+	}
+	if res.Diagnostics != "" {
+		fmt.Println(res.Diagnostics)
+	}
+	if err != nil {
+		return err
+	}
+	for _, f := range res.Files {
+		switch {
+		case f.Removed:
+			fmt.Printf("- %s (removed)\n", f.Name)
+		case f.Changed:
+			fmt.Printf("* %s (changed)\n", f.Name)
+		default:
+			fmt.Printf("  %s (unchanged)\n", f.Name)
+		}
+		if *dry && f.Changed {
+			fmt.Print(f.Content)
+		}
+	}
+	switch {
+	case *dry:
+		fmt.Println("dry-run: nothing published")
+	case len(res.Changed) == 0:
+		fmt.Println("OK: global snippets up to date")
+	default:
+		fmt.Printf("OK: published %d file(s) to %s (reloaded=%v)\n", len(res.Changed), paths.NginxGlobalDir, res.Reloaded)
+	}
+	return nil
+}
+
+func cmdTemplate(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 || args[0] != "lint" {
+		return usagef("usage: template lint [--golden <dir>] [--update] [--nginx-test=true|false]")
+	}
+	fs := flag.NewFlagSet("template lint", flag.ContinueOnError)
+	golden := fs.String("golden", app.DefaultGoldenDir, "Directory of the golden renders")
+	update := fs.Bool("update", false, "Rewrite the golden files from the current templates")
+	nginxTest := fs.Bool("nginx-test", true, "Also run nginx -t on each render in a sandbox conf")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	cases, err := core.TemplateLint(app.TemplateLintOptions{GoldenDir: *golden, Update: *update, NginxTest: *nginxTest})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, c := range cases {
+		mark := " "
+		if c.Failed() {
+			mark = "!"
+			failed++
+		}
+		fmt.Printf("%s %-16s golden=%s\n", mark, c.Name, c.Golden)
+		if c.Diff != "" {
+			fmt.Println("    " + c.Diff)
+		}
+		if c.NginxTest != "" {
+			fmt.Println(c.NginxTest)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d template case(s) failed (run with --update after reviewing intended changes)", failed, len(cases))
+	}
+	fmt.Printf("OK: %d template case(s) passed\n", len(cases))
+	return nil
+}
+
+func cmdNginx(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: nginx <status|start|restart|wire|saturation|modules>")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+	case "start":
+		if err := core.NginxStart(ctx); err != nil {
+			return err
+		}
+	case "restart":
+		if err := core.NginxRestart(ctx); err != nil {
+			return err
+		}
+	case "wire":
+		changed, err := core.NginxWire(ctx)
+		if err != nil {
+			return err
+		}
+		if changed {
+			fmt.Printf("Added includes for %s and %s to %s\n", paths.NginxGlobalDir, paths.NginxSitesDir, paths.NginxMainConf)
+		} else {
+			fmt.Printf("%s already includes %s and %s\n", paths.NginxMainConf, paths.NginxGlobalDir, paths.NginxSitesDir)
+		}
+		return nil
+	case "saturation":
+		sat, err := core.SaturationSample(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("connections: %d active of %d (%.1f%%; %d workers x %d worker_connections)\n",
+			sat.Active, sat.MaxConnections, sat.ConnPercent, sat.Workers, sat.WorkerConnections)
+		fmt.Printf("  reading %d, writing %d, waiting %d\n", sat.Reading, sat.Writing, sat.Waiting)
+		fmt.Printf("worker cpu:  %.1f%% average over %d running workers (%d CPUs)\n", sat.CPUPercent, sat.RunningWorkers, sat.CPUs)
+		fmt.Printf("thresholds:  connections %d%%, cpu %d%% for %s\n", cfg.Saturation.ConnPercent, cfg.Saturation.CPUPercent, cfg.Saturation.Sustain)
+		return nil
+	case "modules":
+		return nginxModules(ctx, core, args[1:])
+	default:
+		return usagef("unknown nginx subcommand %q (use status|start|restart|wire|saturation|modules)", args[0])
+	}
+	state, err := core.NginxProbe(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case state.Running && state.PID > 0:
+		fmt.Printf("nginx is running (master pid %d)\n", state.PID)
+	case state.Running:
+		fmt.Println("nginx is running")
+	default:
+		fmt.Println("nginx is NOT running")
+	}
+	return nil
+}
+
+// nginxModules lists the dynamic modules, or enables/disables loading one.
+func nginxModules(ctx context.Context, core *app.App, args []string) error {
+	if len(args) == 0 {
+		mods, err := core.NginxModules()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-12s %-10s %-10s %s\n", "MODULE", "ENABLED", "AVAILABLE", "FILES")
+		for _, m := range mods {
+			avail := "no"
+			switch {
+			case m.BuiltIn:
+				avail = "built-in"
+			case m.Installed:
+				avail = "yes"
+			}
+			fmt.Printf("%-12s %-10t %-10s %s\n", m.Name, m.Enabled, avail, strings.Join(m.Files, ", "))
+		}
+		return nil
+	}
+	if len(args) != 2 || (args[0] != "enable" && args[0] != "disable") {
+		return usagef("usage: nginx modules [enable|disable <name>]")
+	}
+	if err := core.NginxModuleSet(ctx, args[1], args[0] == "enable"); err != nil {
+		return err
+	}
+	fmt.Printf("OK: %s %sd\n", args[1], args[0])
+	return nil
+}
+
+func cmdTLS(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 || args[0] != "scan" {
+		return usagef("usage: tls scan --domain <d> [--connect host:port]")
+	}
+	fs := flag.NewFlagSet("tls scan", flag.ContinueOnError)
+	var (
+		domain  = fs.String("domain", "", "Domain to scan (required)")
+		connect = fs.String("connect", "", "Address to connect to (default: tls_scan.connect)")
+	)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*domain) == "" {
+		return usagef("required: --domain")
+	}
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+	rep, err := core.TLSScan(context.Background(), *domain, *connect)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Domain : %s (%s)\n", rep.Domain, rep.Address)
+	fmt.Printf("Grade  : %s\n", rep.Grade)
+	if rep.Error != "" {
+		fmt.Printf("Error  : %s\n", rep.Error)
+		return nil
+	}
+	var protos []string
+	for _, p := range rep.Protocols {
+		if p.Enabled {
+			protos = append(protos, p.Name)
+		}
+	}
+	fmt.Printf("Proto  : %s\n", strings.Join(protos, ", "))
+	fmt.Printf("Ciphers: %d accepted (TLS <= 1.2)\n", len(rep.Ciphers))
+	fmt.Printf("Cert   : %s (issuer %s, expires %s)\n", rep.CertSubject, rep.CertIssuer, rep.CertNotAfter.Format("2006-01-02"))
+	fmt.Printf("Chain  : %d cert(s), trusted=%v complete=%v hostname=%v\n", rep.ChainLength, rep.Trusted, rep.ChainComplete, rep.HostnameOK)
+	if rep.HSTS {
+		fmt.Printf("HSTS   : max-age=%d\n", rep.HSTSMaxAge)
+	} else {
+		fmt.Println("HSTS   : no")
+	}
+	fmt.Printf("OCSP   : %s\n", rep.OCSP)
+	for _, f := range rep.Findings {
+		fmt.Println("  -", f)
+	}
+	return nil
+}
+
+func cmdHealth(st store.SiteStore, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return usagef("usage: health check [--report-to <url> --secret <s> --domains a,b [--location <name>]]")
+	}
+	fs := flag.NewFlagSet("health check", flag.ContinueOnError)
+	var (
+		reportTo = fs.String("report-to", "", "Act as an external check location: POST results to this panel URL (…/api/v1/health/report)")
+		secret   = fs.String("secret", "", "Report secret (health.report_secret of the receiving panel)")
+		domains  = fs.String("domains", "", "Comma-separated domains to check (with --report-to)")
+		location = fs.String("location", "", "Location name sent with reports (default: health.location)")
+	)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var res []health.Result
+	if *reportTo != "" {
+		if *secret == "" || *domains == "" {
+			return usagef("required with --report-to: --secret and --domains")
+		}
+		hc := cfg.Health
+		hc.Connect = "" // external location: reach sites through public DNS
+		if *location != "" {
+			hc.Location = *location
+		}
+		c := health.NewChecker(hc, st, nil)
+		for _, d := range strings.Split(*domains, ",") {
+			if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+				res = append(res, c.Check(context.Background(), store.Site{Domain: d}))
+			}
+		}
+		if err := health.SendReports(context.Background(), *reportTo, *secret, res); err != nil {
+			return err
+		}
+	} else {
+		c := health.NewChecker(cfg.Health, st, notify.NewQueuedMailer(cfg.Notify.SMTP, st))
+		var err error
+		res, err = c.CheckAll(context.Background())
+		c.Wait()
+		if err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Domain < res[j].Domain })
+	fmt.Printf("%-35s %-6s %-6s %-8s %s\n", "DOMAIN", "STATE", "HTTP", "LATENCY", "ERROR")
+	for _, r := range res {
+		state := "up"
+		if !r.OK {
+			state = "DOWN"
+		}
+		fmt.Printf("%-35s %-6s %-6d %-8s %s\n", r.Domain, state, r.StatusCode, fmt.Sprintf("%dms", r.LatencyMS), r.Error)
+	}
+	if *reportTo != "" {
+		fmt.Println("OK: reported", len(res), "result(s) to", *reportTo)
+	}
+	return nil
+}
+
+func cmdPanelUser(st store.SiteStore, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: panel-user add --user <u> --pass <p> [--role admin|user] [--hosting-user <u>] [--enabled=true|false] [--email <addr>] [--must-change]\n       panel-user passwd --user <u> [--pass <p>] [--must-change]")
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("panel-user add", flag.ContinueOnError)
+		user := fs.String("user", "", "Username")
+		pass := fs.String("pass", "", "Password")
+		role := fs.String("role", auth.RoleAdmin, "Role: admin (everything) or user (own sites only)")
+		hostingUser := fs.String("hosting-user", "", "Role user: hosting user whose sites it manages (default: same as --user)")
+		enabled := fs.Bool("enabled", true, "Enabled")
+		lang := fs.String("lang", "", "UI language (e.g. en, el; empty = panel default)")
+		email := fs.String("email", "", "Email address (used for password reset; verified from the UI profile page)")
+		mustChange := fs.Bool("must-change", false, "Force a password change on first login")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*user) == "" || *pass == "" {
+			return usagef("required: --user and --pass")
+		}
+		if !auth.ValidRole(strings.TrimSpace(*role)) {
+			return usagef("invalid --role %q (want %s)", *role, strings.Join(auth.Roles, ", "))
+		}
+		if err := auth.ValidatePassword(cfg.Security.PasswordPolicy, *pass); err != nil {
+			return err
+		}
+		if e := strings.TrimSpace(*email); e != "" {
+			if _, err := mail.ParseAddress(e); err != nil {
+				return fmt.Errorf("invalid --email %q: %v", e, err)
+			}
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(*pass), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		pu, err := st.CreatePanelUser(strings.TrimSpace(*user), string(hash), strings.TrimSpace(*role), *enabled)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(*lang) != "" {
+			if err := st.UpdatePanelUserLanguage(pu.ID, *lang); err != nil {
+				return err
+			}
+		}
+		if strings.TrimSpace(*email) != "" {
+			if err := st.UpdatePanelUserEmail(pu.ID, *email); err != nil {
+				return err
+			}
+		}
+		if err := st.SetPanelUserMustChangePassword(pu.ID, *mustChange); err != nil {
+			return err
+		}
+		if err := st.SetPanelUserHostingUser(pu.ID, *hostingUser); err != nil {
+			return err
+		}
+		fmt.Println("OK: panel user saved:", pu.Username)
+		return nil
+	case "passwd":
+		fs := flag.NewFlagSet("panel-user passwd", flag.ContinueOnError)
+		user := fs.String("user", "", "Username")
+		pass := fs.String("pass", "", "New password (empty = read one line from stdin)")
+		mustChange := fs.Bool("must-change", false, "Force another password change on next login")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*user) == "" {
+			return usagef("required: --user")
+		}
+		pu, err := st.GetPanelUserByUsername(strings.TrimSpace(*user))
+		if err != nil {
+			return fmt.Errorf("panel user %q: %w", *user, err)
+		}
+		p := *pass
+		if p == "" {
+			b, err := io.ReadAll(io.LimitReader(os.Stdin, 4<<10))
+			if err != nil {
+				return err
+			}
+			p = strings.TrimRight(strings.SplitN(string(b), "\n", 2)[0], "\r")
+		}
+		if p == "" {
+			return usagef("empty password: pass --pass or one line on stdin")
+		}
+		if err := auth.ValidatePassword(cfg.Security.PasswordPolicy, p); err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		if err := st.UpdatePanelUserPassword(pu.ID, string(hash)); err != nil {
+			return err
+		}
+		if err := st.SetPanelUserMustChangePassword(pu.ID, *mustChange); err != nil {
+			return err
+		}
+		// open panel sessions carry a stamp of the old hash and end on their next request
+		fmt.Println("OK: password changed:", pu.Username, "(signed out of the panel)")
+		return nil
+	default:
+		return usagef("unknown panel-user subcommand: %s", args[0])
+	}
+}
+
+
+
+
+func runStatus(cfg *config.Config, paths config.Paths) {
+	fmt.Println("NGM config loaded OK")
+	fmt.Printf("Version: %s  BuildTime: %s\n", Version, BuildTime)
+
+	fmt.Println("---- Nginx ----")
+	fmt.Printf("root        : %s\n", paths.NginxRoot)
+	fmt.Printf("bin         : %s\n", paths.NginxBin)
+	fmt.Printf("main_conf   : %s\n", paths.NginxMainConf)
+	fmt.Printf("sites_dir   : %s\n", paths.NginxSitesDir)
+	fmt.Printf("staging_dir : %s\n", paths.NginxStageDir)
+	fmt.Printf("backup_dir  : %s\n", paths.NginxBackupDir)
+	fmt.Printf("global_dir  : %s\n", paths.NginxGlobalDir)
+
+	mgr := nginx.NewManager(paths.NginxRoot, paths.NginxBin, paths.NginxMainConf, paths.NginxSitesDir, paths.NginxStageDir, paths.NginxBackupDir)
+	mgr.Runner = runner
+	mgr.GlobalDir = paths.NginxGlobalDir
+	mgr.BackupKeep = cfg.Nginx.Apply.BackupKeep
+	tmo := cfg.Timeouts.Durations()
+	mgr.TestTimeout, mgr.ReloadTimeout = tmo.NginxTest, tmo.NginxReload
+	if err := mgr.EnsureLayout(); err != nil {
+		log.Fatalf("nginx layout: %v", err)
+	}
+	fmt.Println("---- Layout ----")
+	fmt.Println("nginx directories ensured (sites/staging/backup)")
+
+	fmt.Println("---- Nginx Test ----")
+	if err := mgr.TestConfig(); err != nil {
+		log.Fatalf("nginx test: %v", err)
+	}
+	fmt.Println("nginx config test OK")
+
+	fmt.Println("---- Includes ----")
+	if err := mgr.CheckSitesIncluded(); err != nil {
+		fmt.Println("WARNING:", err)
+	} else {
+		fmt.Printf("%s is included by %s\n", paths.NginxSitesDir, paths.NginxMainConf)
+	}
+	if err := mgr.CheckGlobalIncluded(); err != nil {
+		fmt.Println("WARNING:", err)
+	} else {
+		fmt.Printf("%s is included by %s\n", paths.NginxGlobalDir, paths.NginxMainConf)
+	}
+
+	fmt.Println("---- API ----")
+	fmt.Printf("listen      : %s\n", cfg.API.Listen)
+	fmt.Printf("allow_ips   : %v\n", cfg.API.AllowIPs)
+	fmt.Printf("proxies     : %v\n", cfg.API.TrustedProxies)
+	if cfg.API.MetricsListen != "" {
+		fmt.Printf("metrics     : %s\n", cfg.API.MetricsListen)
+	}
+	if rl := cfg.API.RateLimit; rl.Enabled {
+		fmt.Printf("rate_limit  : %g/s per IP, %g/s per token, %g/min logins\n", rl.PerIP, rl.PerToken, rl.LoginPerMinute)
+	} else {
+		fmt.Println("rate_limit  : off")
+	}
+
+	fmt.Println("---- Certs ----")
+	fmt.Printf("mode        : %s\n", cfg.Certs.Mode)
+	fmt.Printf("certbot_bin : %s\n", paths.CertbotBin)
+	fmt.Printf("webroot     : %s\n", paths.ACMEWebroot)
+	fmt.Printf("live_dir    : %s\n", paths.LetsEncryptLive)
+
+	fmt.Println("---- PHP-FPM ----")
+	fmt.Printf("default     : %s\n", cfg.PHPFPM.DefaultVersion)
+	fmt.Printf("versions    : %d\n", len(cfg.PHPFPM.Versions))
+}
+
+func cmdSite(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) == 0 {
+		return usagef("usage: site <add|list|rm|edit|target|targets|cutover|mirror|redirect|placeholder|harden|fix-perms|reapply|tag|trace|discover|dualcert|certsource|syslog|header|preload|expire|reach|backups|origin|deploy> ...")
+	}
+
+	core, err := app.New(cfg, paths, st, runner)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("site add", flag.ContinueOnError)
+		var (
+			user      = fs.String("user", "", "Owner username")
+			domain    = fs.String("domain", "", "Domain (e.g. example.com)")
+			mode      = fs.String("mode", "php", "Mode: php|proxy|static|redirect")
+			phpv      = fs.String("php", cfg.PHPFPM.DefaultVersion, "PHP version (e.g. 8.3)")
+			webroot   = fs.String("webroot", "", "Webroot path (optional; default derived from user+domain)")
+			http3     = fs.Bool("http3", true, "Enable HTTP/3")
+			provision = fs.Bool("provision", true, "Create linux user (if missing) + create site dirs")
+			skipCert  = fs.Bool("skip-cert", false, "Skip automatic certificate issuance")
+			applyNow  = fs.Bool("apply-now", true, "Apply this vhost immediately (needed for HTTP-01)")
+			to        = fs.String("to", "", "Redirect mode: target URL (e.g. https://example.com)")
+			code      = fs.Int("code", 301, "Redirect mode: status 301|302|307|308")
+			keepPath  = fs.Bool("keep-path", false, "Redirect mode: append the request path to the target")
+			parked    = fs.Bool("placeholder", false, "Serve a \"coming soon\" page until files are deployed (php/static)")
+			hardened  = fs.Bool("hardened", false, "Apply the php hardening preset (see: site harden)")
+			dnsRec    = fs.Bool("dns", false, "Point A/AAAA at dns.addresses through the zone's DNS provider (see: dns record)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *user == "" || *domain == "" {
+			return usagef("required: --user and --domain")
+		}
+		if *mode == "redirect" && strings.TrimSpace(*to) == "" {
+			return usagef("redirect mode requires --to")
+		}
+
+		res, err := core.SiteAdd(context.Background(), app.SiteAddRequest{
+			User:      *user,
+			Domain:    *domain,
+			Mode:      *mode,
+			PHP:       *phpv,
+			Webroot:   *webroot,
+			HTTP3:     *http3,
+			Provision: *provision,
+			SkipCert:  *skipCert,
+			ApplyNow:  *applyNow,
+
+			RedirectTo:       *to,
+			RedirectCode:     *code,
+			RedirectKeepPath: *keepPath,
+			Placeholder:      *parked,
+			Hardened:         *hardened,
+			DNSRecords:       *dnsRec,
+		})
+		if err != nil {
+			return err
+		}
+
+		s := res.Site
+		fmt.Println("OK: site saved")
+		fmt.Printf("  domain : %s\n", s.Domain)
+		fmt.Printf("  user_id: %d\n", s.UserID)
+		fmt.Printf("  mode   : %s\n", s.Mode)
+		fmt.Printf("  webroot: %s\n", s.Webroot)
+		fmt.Printf("  php    : %s\n", s.PHPVersion)
+		fmt.Printf("  http3  : %v\n", s.EnableHTTP3)
+		if s.Mode == "redirect" {
+			fmt.Printf("  target : %d %s%s\n", s.RedirectCode, s.RedirectURL, keepPathSuffix(s.RedirectKeepPath))
+		}
+		for _, w := range res.Warnings {
+			fmt.Println("WARNING:", w)
+		}
+		return nil
+
+
+
+
+
+
+
+
+
+
+
+	case "list":
+		fs := flag.NewFlagSet("site list", flag.ContinueOnError)
+		var sortBy = fs.String("sort", "domain", "Sort by: "+strings.Join(store.SiteSortColumns, "|"))
+		var desc = fs.Bool("desc", false, "Sort descending")
+		var (
+			search = fs.String("search", "", "Only domains containing this")
+			owner  = fs.String("owner", "", "Only the sites of this hosting user")
+			mode   = fs.String("mode", "", "Only this mode: php|proxy|static|redirect")
+			state  = fs.String("state", "", "Only this state: "+strings.Join(store.SiteStates, "|"))
+			limit  = fs.Int("limit", 0, "Show at most N sites (0 = all)")
+			offset = fs.Int("offset", 0, "Skip the first N matching sites")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		opts := store.SiteListOptions{Sort: *sortBy, Desc: *desc, Owner: strings.TrimSpace(*owner),
+			Search: *search, Mode: strings.ToLower(*mode), State: strings.ToUpper(*state), Limit: *limit, Offset: *offset}
+		items, err := core.SiteListQuery(context.Background(), opts)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Println("(no sites)")
+			return nil
+		}
+
+		fmt.Printf("%-25s  %-6s  %-5s  %-9s  %-10s  %-20s  %-40s  %-4s  %s\n",
+			"DOMAIN", "MODE", "HTTP3", "ENABLED", "STATE", "LAST_APPLIED", "WEBROOT", "PHP", "EXPIRES")
+
+		for _, it := range items {
+			s := it.Site
+			enabledStr := "yes"
+			if !s.Enabled {
+				enabledStr = "no"
+			}
+			expires := "-"
+			if s.ExpiresAt != nil {
+				expires = s.ExpiresAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-25s  %-6s  %-5v  %-9s  %-10s  %-20s  %-40s  %-4s  %s\n",
+				s.Domain, s.Mode, s.EnableHTTP3, enabledStr, it.State, it.Last, trimLen(s.Webroot, 40), s.PHPVersion, expires)
+		}
+		if *limit > 0 || *offset > 0 {
+			total, err := core.SiteListCount(opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("(%d-%d of %d)\n", *offset+1, *offset+len(items), total)
+		}
+		return nil
+
+
+
+
+	case "rm":
+		fs := flag.NewFlagSet("site rm", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Domain to remove (soft delete)")
+			grace  = fs.Duration("grace", 0, "Keep serving a retired page for this long before the vhost goes (e.g. 24h)")
+			status = fs.Int("status", 410, "Status of the retired page with --grace: 410|503")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *domain == "" {
+			return usagef("required: --domain")
+		}
+		if *grace > 0 {
+			until, err := core.SiteRetire(context.Background(), *domain, *grace, *status)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("OK: site disabled, answering %d until %s (then the vhost is removed by ngm serve)\n", *status, until.Local().Format("2006-01-02 15:04"))
+			return nil
+		}
+		if err := core.SiteDisable(context.Background(), *domain); err != nil { return err }
+                d := strings.ToLower(strings.TrimSpace(*domain))
+                fmt.Println("OK: site disabled (pending delete):", d)
+		return nil
+
+
+
+	case "edit":
+		fs := flag.NewFlagSet("site edit", flag.ContinueOnError)
+		var (
 			domain  = fs.String("domain", "", "Domain (required)")
 			user    = fs.String("user", "", "Owner username (optional)")
-			mode    = fs.String("mode", "", "Mode: php|proxy|static (optional)")
+			mode    = fs.String("mode", "", "Mode: php|proxy|static|redirect (optional)")
 			phpv    = fs.String("php", "", "PHP version (optional)")
 			webroot = fs.String("webroot", "", "Webroot (optional)")
 			http3S  = fs.String("http3", "", "Enable HTTP/3: true|false (optional)")
 			enS     = fs.String("enabled", "", "Enabled: true|false (optional)")
 			applyNow = fs.Bool("apply-now", false, "Apply immediately after edit")
 		)
-		if err := fs.Parse(args[1:]); err != nil { return err }
-		if strings.TrimSpace(*domain) == "" { return fmt.Errorf("required: --domain") }
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" { return usagef("required: --domain") }
+
+		var http3 *bool
+		if strings.TrimSpace(*http3S) != "" {
+			v := strings.EqualFold(strings.TrimSpace(*http3S), "true") || strings.TrimSpace(*http3S) == "1"
+			http3 = &v
+		}
+		var enabled *bool
+		if strings.TrimSpace(*enS) != "" {
+			v := strings.EqualFold(strings.TrimSpace(*enS), "true") || strings.TrimSpace(*enS) == "1"
+			enabled = &v
+		}
+
+		updated, err := core.SiteEdit(context.Background(), app.SiteEditRequest{
+			Domain: *domain,
+			User: *user,
+			Mode: *mode,
+			PHP: *phpv,
+			Webroot: *webroot,
+			HTTP3: http3,
+			Enabled: enabled,
+			ApplyNow: *applyNow,
+		})
+		if err != nil { return err }
+		fmt.Println("OK: site updated")
+		fmt.Printf("  domain : %s\n", updated.Domain)
+		fmt.Printf("  user_id: %d\n", updated.UserID)
+		fmt.Printf("  mode   : %s\n", updated.Mode)
+		fmt.Printf("  webroot: %s\n", updated.Webroot)
+		fmt.Printf("  php    : %s\n", updated.PHPVersion)
+		fmt.Printf("  http3  : %v\n", updated.EnableHTTP3)
+		fmt.Printf("  enabled: %v\n", updated.Enabled)
+		return nil
+
+	case "target":
+		fs := flag.NewFlagSet("site target", flag.ContinueOnError)
+		var (
+			domain  = fs.String("domain", "", "Proxy site domain (required)")
+			addr    = fs.String("addr", "", "Upstream address, e.g. 127.0.0.1:8080 (required)")
+			weight  = fs.Int("weight", 100, "Weight")
+			backup  = fs.Bool("backup", false, "Backup server")
+			enabled = fs.Bool("enabled", true, "Enabled")
+			group   = fs.String("group", "", "Target group for blue/green (empty = shared)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" || strings.TrimSpace(*addr) == "" {
+			return usagef("required: --domain and --addr")
+		}
+		if err := core.ProxyTargetUpsert(context.Background(), *domain, *addr, *weight, *backup, *enabled, *group); err != nil {
+			return err
+		}
+		fmt.Println("OK: proxy target saved:", strings.TrimSpace(*addr))
+		return nil
+
+	case "targets":
+		fs := flag.NewFlagSet("site targets", flag.ContinueOnError)
+		domain := fs.String("domain", "", "Proxy site domain (required)")
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		site, err := core.SiteGet(context.Background(), *domain)
+		if err != nil {
+			return err
+		}
+		targetStats, err := core.ProxyTargetStats(context.Background(), site.Domain)
+		if err != nil {
+			return err
+		}
+		targets, err := st.ListProxyTargetsBySiteID(site.ID)
+		if err != nil {
+			return err
+		}
+		if site.Discovery != "" {
+			fmt.Printf("discovery: %s (* = discovered)\n", site.Discovery)
+		}
+		fmt.Printf("%-28s  %-8s  %-6s  %-7s  %8s  %6s  %9s  %9s\n", "TARGET", "GROUP", "WEIGHT", "ENABLED", "REQUESTS", "5XX", "AVG MS", "P95 MS")
+		for _, t := range targets {
+			ts, ok := targetStats[t.Addr]
+			addr := t.Addr
+			if t.Discovered {
+				addr += " *"
+			}
+			line := fmt.Sprintf("%-28s  %-8s  %-6d  %-7v", addr, t.Group, t.Weight, t.Enabled)
+			if !ok {
+				fmt.Printf("%s  %8s\n", line, "-")
+				continue
+			}
+			mark := ""
+			if ts.Degraded {
+				mark = "  DEGRADED"
+			}
+			fmt.Printf("%s  %8d  %5.1f%%  %9.0f  %9.0f%s\n", line, ts.Requests, ts.ErrorRate(), ts.AvgMS, ts.P95MS, mark)
+		}
+		return nil
+
+	case "discover":
+		fs := flag.NewFlagSet("site discover", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Proxy site domain (required)")
+			srv    = fs.String("srv", "", "DNS SRV name, e.g. _http._tcp.api.example.com")
+			consul = fs.String("consul", "", "Consul service name (healthy instances)")
+			off    = fs.Bool("off", false, "Stop discovery and drop the discovered targets")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		set := 0
+		for _, v := range []bool{*srv != "", *consul != "", *off} {
+			if v {
+				set++
+			}
+		}
+		if strings.TrimSpace(*domain) == "" || set != 1 {
+			return usagef("required: --domain and one of --srv, --consul or --off")
+		}
+		spec := ""
+		switch {
+		case *srv != "":
+			spec = "srv:" + *srv
+		case *consul != "":
+			spec = "consul:" + *consul
+		}
+		targets, err := core.SiteDiscovery(context.Background(), *domain, spec)
+		if err != nil {
+			return err
+		}
+		if *off {
+			fmt.Println("OK: discovery off, discovered targets removed")
+			return nil
+		}
+		fmt.Printf("OK: targets of %s from %s (refreshed by ngm serve every %s)\n", *domain, spec, cfg.Discovery.Interval)
+		for _, t := range targets {
+			kind := "primary"
+			if t.Backup {
+				kind = "backup"
+			}
+			fmt.Printf("  %-28s  weight %-4d  %s\n", t.Addr, t.Weight, kind)
+		}
+		return nil
+
+	case "cutover":
+		fs := flag.NewFlagSet("site cutover", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Proxy site domain (required)")
+			to     = fs.String("to", "", "Target group to switch to, e.g. green (required; \"all\" renders every group)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" || strings.TrimSpace(*to) == "" {
+			return usagef("required: --domain and --to")
+		}
+		group := strings.TrimSpace(*to)
+		if strings.EqualFold(group, "all") {
+			group = ""
+		}
+		if err := core.SiteCutover(context.Background(), *domain, group); err != nil {
+			return err
+		}
+		fmt.Printf("OK: %s now serves target group %q\n", strings.ToLower(strings.TrimSpace(*domain)), strings.TrimSpace(*to))
+		return nil
+
+	case "dualcert":
+		fs := flag.NewFlagSet("site dualcert", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			off    = fs.Bool("off", false, "Serve a single certificate again (deletes the alternate one)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if err := core.SiteDualCert(context.Background(), *domain, !*off); err != nil {
+			return err
+		}
+		if *off {
+			fmt.Println("OK: dual certificates disabled")
+		} else {
+			fmt.Println("OK: dual certificates (RSA + ECDSA) enabled")
+		}
+		return nil
+
+	case "certsource":
+		fs := flag.NewFlagSet("site certsource", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			source  = fs.String("source", "", "letsencrypt | path (files kept current elsewhere) | remote (synced from another node) | shared (another lineage)")
+			cert    = fs.String("cert", "", "Certificate (fullchain) path for path/remote")
+			key     = fs.String("key", "", "Private key path for path/remote")
+			lineage = fs.String("lineage", "", "Let's Encrypt lineage to share, e.g. a wildcard's (shared)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if strings.TrimSpace(*source) == "" {
+			site, err := core.SiteGet(context.Background(), *domain)
+			if err != nil {
+				return err
+			}
+			src := site.CertSource
+			if src == "" {
+				src = app.CertSourceLetsEncrypt
+			}
+			fmt.Printf("source : %s\n", src)
+			if site.TLSCertPath != "" {
+				fmt.Printf("cert   : %s\nkey    : %s\n", site.TLSCertPath, site.TLSKeyPath)
+			}
+			if site.CertLineage != "" {
+				fmt.Printf("lineage: %s\n", site.CertLineage)
+			}
+			return nil
+		}
+		if err := core.SiteCertSource(context.Background(), *domain, *source, *cert, *key, *lineage); err != nil {
+			return err
+		}
+		fmt.Printf("OK: certificate source of %s set to %s\n", strings.TrimSpace(*domain), strings.ToLower(strings.TrimSpace(*source)))
+		return nil
+
+	case "logsample":
+		fs := flag.NewFlagSet("site logsample", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			sample = fs.String("sample", "", "all | errors | 1/N (errors plus one in N of the other requests)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" || strings.TrimSpace(*sample) == "" {
+			return usagef("required: --domain and --sample")
+		}
+		if err := core.SiteAccessLogSample(context.Background(), *domain, *sample); err != nil {
+			return err
+		}
+		fmt.Printf("OK: access log sampling of %s: %s\n", *domain, *sample)
+		return nil
+
+	case "keepalive":
+		fs := flag.NewFlagSet("site keepalive", flag.ContinueOnError)
+		var (
+			domain   = fs.String("domain", "", "Proxy site domain (required)")
+			conns    = fs.Int("connections", 0, "Idle upstream connections kept per worker (0 = hosting.upstream_keepalive)")
+			requests = fs.Int("requests", 0, "Requests per upstream connection (0 = default)")
+			timeout  = fs.String("timeout", "", "Idle timeout of a kept connection, e.g. 60s (empty = default)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if err := core.SiteKeepalive(context.Background(), *domain, *conns, *requests, *timeout); err != nil {
+			return err
+		}
+		fmt.Printf("OK: upstream keepalive of %s set (unset values follow hosting.upstream_keepalive)\n", *domain)
+		return nil
 
-		var http3 *bool
-		if strings.TrimSpace(*http3S) != "" {
-			v := strings.EqualFold(strings.TrimSpace(*http3S), "true") || strings.TrimSpace(*http3S) == "1"
-			http3 = &v
+	case "health":
+		fs := flag.NewFlagSet("site health", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Proxy site domain (required)")
+			path   = fs.String("path", "", "Health endpoint on the backend, e.g. /healthz")
+			off    = fs.Bool("off", false, "Stop exposing the backend health endpoint")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
 		}
-		var enabled *bool
-		if strings.TrimSpace(*enS) != "" {
-			v := strings.EqualFold(strings.TrimSpace(*enS), "true") || strings.TrimSpace(*enS) == "1"
-			enabled = &v
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if *off == (strings.TrimSpace(*path) != "") {
+			return usagef("required: --path or --off")
+		}
+		if err := core.SiteBackendHealth(context.Background(), *domain, *path); err != nil {
+			return err
+		}
+		if *off {
+			fmt.Printf("OK: backend health endpoint of %s no longer exposed\n", *domain)
+			return nil
+		}
+		fmt.Printf("OK: %s on the backend of %s is served at %s to %s\n", *path, *domain,
+			cfg.Health.Backend.Location, strings.Join(cfg.Health.Backend.Allow, ", "))
+		return nil
+
+	case "syslog":
+		fs := flag.NewFlagSet("site syslog", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			server = fs.String("server", "", "Syslog collector host:port (UDP) or unix:/path")
+			off    = fs.Bool("off", false, "Stop shipping the access log")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if !*off && strings.TrimSpace(*server) == "" {
+			return usagef("required: --server (or --off)")
+		}
+		srv := strings.TrimSpace(*server)
+		if *off {
+			srv = ""
+		}
+		if err := core.SiteAccessSyslog(context.Background(), *domain, srv); err != nil {
+			return err
+		}
+		if srv == "" {
+			fmt.Println("OK: access log syslog shipping disabled")
+		} else {
+			fmt.Printf("OK: access log also shipped to syslog:server=%s\n", srv)
+		}
+		return nil
+
+	case "header":
+		fs := flag.NewFlagSet("site header", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			set    = fs.String("set", "", "Add a response header: Name=Value (nginx variables allowed)")
+			hide   = fs.String("hide", "", "Strip a header from php/proxied responses (e.g. X-Powered-By); Server turns server_tokens off")
+			rm     = fs.String("rm", "", "Remove a custom header (added or hidden)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		ctx := context.Background()
+		switch {
+		case *set != "":
+			name, value, ok := strings.Cut(*set, "=")
+			if !ok {
+				return usagef("--set wants Name=Value")
+			}
+			if err := core.SiteHeaderSet(ctx, *domain, name, value, false); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s: %s\n", http.CanonicalHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value))
+			return nil
+		case *hide != "":
+			if err := core.SiteHeaderSet(ctx, *domain, *hide, "", true); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s hidden\n", http.CanonicalHeaderKey(strings.TrimSpace(*hide)))
+			return nil
+		case *rm != "":
+			if err := core.SiteHeaderRemove(ctx, *domain, *rm); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s removed\n", http.CanonicalHeaderKey(strings.TrimSpace(*rm)))
+			return nil
+		}
+		hs, err := core.SiteHeaders(ctx, *domain)
+		if err != nil {
+			return err
+		}
+		if len(hs) == 0 {
+			fmt.Println("(no custom headers)")
+			return nil
+		}
+		for _, h := range hs {
+			if h.Hide {
+				fmt.Printf("%-30s  (hidden)\n", h.Name)
+			} else {
+				fmt.Printf("%-30s  %s\n", h.Name, h.Value)
+			}
+		}
+		return nil
+
+	case "var":
+		fs := flag.NewFlagSet("site var", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			set    = fs.String("set", "", "Set a template variable: name=value")
+			rm     = fs.String("rm", "", "Remove a template variable")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		ctx := context.Background()
+		switch {
+		case *set != "":
+			name, value, ok := strings.Cut(*set, "=")
+			if !ok {
+				return usagef("--set wants name=value")
+			}
+			if err := core.SiteVarSet(ctx, *domain, name, value); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s=%s\n", strings.TrimSpace(name), value)
+			return nil
+		case *rm != "":
+			if err := core.SiteVarRemove(ctx, *domain, *rm); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s removed\n", strings.TrimSpace(*rm))
+			return nil
+		}
+		vars, err := core.SiteVars(ctx, *domain)
+		if err != nil {
+			return err
+		}
+		if len(vars) == 0 {
+			fmt.Println("(no template variables)")
+			return nil
+		}
+		for _, v := range vars {
+			fmt.Printf("%-30s  %s\n", v.Name, v.Value)
+		}
+		return nil
+
+	case "preload":
+		fs := flag.NewFlagSet("site preload", flag.ContinueOnError)
+		var (
+			domain      = fs.String("domain", "", "Site domain (required)")
+			add         = fs.String("add", "", "Announce a resource on page responses: /path or https:// URL")
+			as          = fs.String("as", "", "Resource type for --add: style|script|font|image|fetch")
+			crossorigin = fs.Bool("crossorigin", false, "Fetch in CORS mode (implied for fonts)")
+			rm          = fs.String("rm", "", "Remove a preload by URL")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		ctx := context.Background()
+		switch {
+		case *add != "":
+			if strings.TrimSpace(*as) == "" {
+				return usagef("--add needs --as")
+			}
+			if err := core.SitePreloadSet(ctx, *domain, *add, *as, *crossorigin); err != nil {
+				return err
+			}
+			fmt.Printf("OK: preloading %s (%s)\n", strings.TrimSpace(*add), strings.ToLower(strings.TrimSpace(*as)))
+			return nil
+		case *rm != "":
+			if err := core.SitePreloadRemove(ctx, *domain, *rm); err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s removed\n", strings.TrimSpace(*rm))
+			return nil
+		}
+		ps, err := core.SitePreloads(ctx, *domain)
+		if err != nil {
+			return err
+		}
+		if len(ps) == 0 {
+			fmt.Println("(no preloads)")
+			return nil
+		}
+		for _, p := range ps {
+			co := ""
+			if p.Crossorigin {
+				co = "  crossorigin"
+			}
+			fmt.Printf("%-7s  %s%s\n", p.As, p.URL, co)
+		}
+		return nil
+
+	case "expire":
+		fs := flag.NewFlagSet("site expire", flag.ContinueOnError)
+		var (
+			domain  = fs.String("domain", "", "Site domain")
+			at      = fs.String("at", "", "Expiry, YYYY-MM-DD or YYYY-MM-DDTHH:MM (local time)")
+			contact = fs.String("notify", "", "Owner email warned before expiry (needs notify.smtp)")
+			off     = fs.Bool("off", false, "Remove the expiry")
+			sweep   = fs.Bool("sweep", false, "Warn about / disable expiring sites now (what serve runs every expiry.interval)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if *sweep {
+			return core.SweepSiteExpiry(context.Background(), core.Mailer())
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if !*off && strings.TrimSpace(*at) == "" {
+			return usagef("required: --at (or --off)")
+		}
+		var when *time.Time
+		if !*off {
+			t, err := app.ParseExpiry(*at)
+			if err != nil {
+				return err
+			}
+			when = &t
+		}
+		if err := core.SiteExpiry(context.Background(), *domain, when, *contact); err != nil {
+			return err
+		}
+		if when == nil {
+			fmt.Println("OK: expiry removed")
+		} else {
+			fmt.Printf("OK: %s will be disabled at %s\n", strings.ToLower(strings.TrimSpace(*domain)), when.Format(time.RFC3339))
+		}
+		return nil
+
+	case "redirect":
+		fs := flag.NewFlagSet("site redirect", flag.ContinueOnError)
+		var (
+			domain   = fs.String("domain", "", "Site domain (required)")
+			to       = fs.String("to", "", "Target URL, e.g. https://example.com (required)")
+			code     = fs.Int("code", 301, "Status: 301|302|307|308")
+			keepPath = fs.Bool("keep-path", false, "Append the request path to the target")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" || strings.TrimSpace(*to) == "" {
+			return usagef("required: --domain and --to")
+		}
+		if err := core.SiteRedirect(context.Background(), *domain, *to, *code, *keepPath); err != nil {
+			return err
+		}
+		fmt.Printf("OK: %s redirects %d to %s%s\n", strings.ToLower(strings.TrimSpace(*domain)), *code, strings.TrimSpace(*to), keepPathSuffix(*keepPath))
+		return nil
+
+	case "placeholder":
+		fs := flag.NewFlagSet("site placeholder", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			off    = fs.Bool("off", false, "Remove the placeholder page")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if err := core.SitePlaceholder(context.Background(), *domain, !*off); err != nil {
+			return err
+		}
+		if *off {
+			fmt.Println("OK: placeholder removed")
+		} else {
+			fmt.Println("OK: placeholder page served until files appear in the webroot")
+		}
+		return nil
+
+	case "fix-perms":
+		fs := flag.NewFlagSet("site fix-perms", flag.ContinueOnError)
+		var (
+			domain  = fs.String("domain", "", "Site domain")
+			all     = fs.Bool("all", false, "Every site")
+			dryRun  = fs.Bool("dry-run", false, "Only report what would change")
+			listAll = fs.Bool("list", false, "List every changed path (default: the first 20)")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if (strings.TrimSpace(*domain) == "") == !*all {
+			return usagef("required: --domain or --all")
+		}
+		domains := []string{*domain}
+		if *all {
+			sites, err := st.ListSites()
+			if err != nil {
+				return err
+			}
+			domains = domains[:0]
+			for _, s := range sites {
+				domains = append(domains, s.Domain)
+			}
+		}
+		verb := "fixed"
+		if *dryRun {
+			verb = "would fix"
+		}
+		var failed int
+		for _, d := range domains {
+			rep, err := core.SiteFixPerms(context.Background(), d, *dryRun)
+			if err != nil {
+				log.Printf("fix-perms: %v", err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: %s %d of %d path(s) under %s\n", d, verb, len(rep.Changes), rep.Checked, rep.SiteRoot)
+			for i, c := range rep.Changes {
+				if i == 20 && !*listAll {
+					fmt.Printf("  ... %d more (--list shows all)\n", len(rep.Changes)-i)
+					break
+				}
+				fmt.Printf("  %s: %s -> %s\n", c.Path, c.From, c.To)
+			}
+			if len(rep.Skipped) > 0 {
+				fmt.Printf("  %d symlink(s)/special file(s) left alone\n", len(rep.Skipped))
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d site(s) could not be fixed", failed, len(domains))
+		}
+		return nil
+
+	case "trace":
+		fs := flag.NewFlagSet("site trace", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			id     = fs.String("id", "", "Request id (the X-Request-ID response header)")
+			slow   = fs.Duration("slow", 0, "List the slowest recent requests that took at least this long")
+			top    = fs.Int("n", 20, "With --slow: how many requests to list")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if (strings.TrimSpace(*id) == "") == (*slow == 0) {
+			return usagef("required: --id or --slow")
+		}
+		if *slow > 0 {
+			reqs, err := core.SiteSlowRequests(*domain, *slow, *top)
+			if err != nil {
+				return err
+			}
+			if len(reqs) == 0 {
+				fmt.Printf("no requests of %s or more in the recent access log\n", *slow)
+			}
+			for _, r := range reqs {
+				fmt.Printf("%8s  %s  %s\n", r.Duration.Round(time.Millisecond), r.Time.Format(time.RFC3339), r.ID)
+			}
+			return nil
+		}
+		tr, err := core.SiteTrace(*domain, *id)
+		if err != nil {
+			return err
+		}
+		if len(tr.Requests) == 0 {
+			fmt.Println("request not found in the recent access log")
+		}
+		for _, r := range tr.Requests {
+			fmt.Printf("request (%s):\n  %s\n", r.Duration, r.Line)
+		}
+		if len(tr.Related) > 0 {
+			fmt.Println("related log lines:")
+		}
+		for _, l := range tr.Related {
+			fmt.Printf("  %s: %s\n", l.File, l.Line)
+		}
+		return nil
+
+	case "harden":
+		fs := flag.NewFlagSet("site harden", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "PHP site domain (required)")
+			off    = fs.Bool("off", false, "Turn the hardening preset off")
+			check  = fs.Bool("check", false, "Only print the hardening checklist of the live config")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		ctx := context.Background()
+		if !*check {
+			if err := core.SiteHarden(ctx, *domain, !*off); err != nil {
+				return err
+			}
+			if *off {
+				fmt.Println("OK: hardening preset off")
+			} else {
+				fmt.Println("OK: hardening preset on")
+			}
+		}
+		checks, err := core.SiteHardening(ctx, *domain)
+		if err != nil {
+			return err
+		}
+		for _, c := range checks {
+			mark := "[ ]"
+			if c.OK {
+				mark = "[x]"
+			}
+			fmt.Printf("  %s %-24s %s\n", mark, c.Name, c.Detail)
+		}
+		return nil
+
+	case "tag":
+		fs := flag.NewFlagSet("site tag", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			set    = fs.String("set", "", "Comma-separated tags (replaces the current ones)")
+			clear  = fs.Bool("clear", false, "Remove every tag")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if *clear {
+			*set = ""
+		}
+		var tags []string
+		if *set == "" && !*clear {
+			site, err := st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(*domain)))
+			if err != nil {
+				return err
+			}
+			tags = site.Tags
+		} else if tags, err = core.SiteTags(*domain, strings.Split(*set, ",")); err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			fmt.Println("(no tags)")
+		} else {
+			fmt.Println(strings.Join(tags, ","))
+		}
+		return nil
+
+	case "reapply":
+		fs := flag.NewFlagSet("site reapply", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			cron   = fs.String("cron", "", `Cron schedule, e.g. "*/15 * * * *" or @hourly`)
+			off    = fs.Bool("off", false, "Stop the scheduled re-render")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" || (*cron == "") == !*off {
+			return usagef("required: --domain and one of --cron or --off")
+		}
+		if err := core.SiteReapply(*domain, *cron); err != nil {
+			return err
+		}
+		if *off {
+			fmt.Println("OK: scheduled re-render off")
+		} else {
+			fmt.Printf("OK: re-rendered on %q by ngm serve, applied when the output changes\n", *cron)
+		}
+		return nil
+
+	case "mirror":
+		fs := flag.NewFlagSet("site mirror", flag.ContinueOnError)
+		var (
+			domain  = fs.String("domain", "", "Proxy site domain (required)")
+			target  = fs.String("target", "", "Shadow upstream, e.g. 10.0.0.20:8080")
+			percent = fs.Int("percent", 10, "Share of requests to mirror (1-100)")
+			off     = fs.Bool("off", false, "Turn mirroring off")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if !*off && strings.TrimSpace(*target) == "" {
+			return usagef("required: --target (or --off)")
+		}
+		t := strings.TrimSpace(*target)
+		if *off {
+			t = ""
+		}
+		if err := core.SiteMirror(context.Background(), *domain, t, *percent); err != nil {
+			return err
+		}
+		if t == "" {
+			fmt.Println("OK: mirroring disabled")
+		} else {
+			fmt.Printf("OK: mirroring %d%% of requests to %s\n", *percent, t)
+		}
+		return nil
+
+	case "reach":
+		fs := flag.NewFlagSet("site reach", flag.ContinueOnError)
+		domain := fs.String("domain", "", "Site domain (required)")
+		if err := parseFlags(fs, args[1:]); err != nil { return err }
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		rep, err := core.SiteReachCheck(ctx, *domain)
+		if err != nil {
+			return err
+		}
+		printReach([]app.ReachReport{rep})
+		if rep.Mismatch() {
+			return fmt.Errorf("%s: IPv4 and IPv6 do not reach the same server", rep.Domain)
+		}
+		return nil
+
+	case "deploy":
+		fs := flag.NewFlagSet("site deploy", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			repo   = fs.String("repo", "", "Git repository to deploy into the webroot (https://..., ssh://... or git@host:path)")
+			branch = fs.String("branch", "main", "Branch to deploy (with --repo)")
+			run    = fs.Bool("run", false, "Deploy now")
+			rotate = fs.Bool("rotate", false, "Replace the webhook secret")
+			off    = fs.Bool("off", false, "Turn the git deploy off (the checkout stays)")
+			logN   = fs.Int("log", 0, "Show the last N deploys")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		printSecret := func(d store.SiteDeploy) {
+			fmt.Printf("webhook: %s\n", core.DeployWebhookURL(d.Domain))
+			fmt.Printf("secret : %s\n", d.Secret)
+			fmt.Println("(GitHub: content type application/json + this secret; GitLab: this secret as the secret token; push events)")
+		}
+		switch {
+		case *off:
+			if err := core.SiteDeployOff(*domain); err != nil {
+				return err
+			}
+			fmt.Printf("OK: git deploy of %s off\n", *domain)
+			return nil
+		case *repo != "":
+			d, err := core.SiteDeploySet(*domain, *repo, *branch)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("OK: %s deploys %s (%s)\n", d.Domain, d.Repo, d.Branch)
+			printSecret(d)
+		case *rotate:
+			d, err := core.SiteDeployRotate(*domain)
+			if err != nil {
+				return err
+			}
+			printSecret(d)
+		}
+		if *run {
+			r, err := core.Deploy(context.Background(), *domain, "cli")
+			fmt.Print(r.Output)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("OK: deployed %.12s\n", r.Commit)
+		}
+		if *logN > 0 {
+			runs, err := core.DeployRuns(*domain, *logN)
+			if err != nil {
+				return err
+			}
+			for _, r := range runs {
+				fmt.Printf("%s  %-7s  %-7s  %-12.12s  %s\n", r.StartedAt.Local().Format("2006-01-02 15:04:05"), r.Trigger, r.Status, r.Commit, r.Ref)
+				if r.Status == "skipped" {
+					fmt.Printf("    %s\n", r.Output)
+				}
+			}
+		}
+		if *repo == "" && !*rotate && !*run && *logN == 0 {
+			d, err := core.SiteDeploy(*domain)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s deploys %s (%s) into its webroot\nwebhook: %s\n", d.Domain, d.Repo, d.Branch, core.DeployWebhookURL(d.Domain))
+		}
+		return nil
+
+	case "backups":
+		fs := flag.NewFlagSet("site backups", flag.ContinueOnError)
+		domain := fs.String("domain", "", "Site domain (required)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		list, err := core.SiteBackups(*domain)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("no backups yet (one is kept each time an apply replaces or removes the vhost)")
+			return nil
+		}
+		for _, b := range list {
+			var notes []string
+			switch {
+			case !b.Valid:
+				notes = append(notes, "CORRUPT (skipped by rollback)")
+			case b.Size == 0:
+				notes = append(notes, "no vhost")
+			}
+			if b.Live {
+				notes = append(notes, "live")
+			}
+			if b.Applied {
+				notes = append(notes, "last applied")
+			}
+			fmt.Printf("%s  %8d  %.12s  %s\n", b.Time.Local().Format("2006-01-02 15:04:05"), b.Size, b.Hash, strings.Join(notes, ", "))
 		}
+		return nil
 
-		updated, err := core.SiteEdit(context.Background(), app.SiteEditRequest{
-			Domain: *domain,
-			User: *user,
-			Mode: *mode,
-			PHP: *phpv,
-			Webroot: *webroot,
-			HTTP3: http3,
-			Enabled: enabled,
-			ApplyNow: *applyNow,
-		})
-		if err != nil { return err }
-		fmt.Println("OK: site updated")
-		fmt.Printf("  domain : %s\n", updated.Domain)
-		fmt.Printf("  user_id: %d\n", updated.UserID)
-		fmt.Printf("  mode   : %s\n", updated.Mode)
-		fmt.Printf("  webroot: %s\n", updated.Webroot)
-		fmt.Printf("  php    : %s\n", updated.PHPVersion)
-		fmt.Printf("  http3  : %v\n", updated.EnableHTTP3)
-		fmt.Printf("  enabled: %v\n", updated.Enabled)
+	case "origin":
+		fs := flag.NewFlagSet("site origin", flag.ContinueOnError)
+		file := fs.String("file", "", "Vhost file to trace (a live file or a backup)")
+		domain := fs.String("domain", "", "Site domain (traces its live vhost)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*file) == "" && strings.TrimSpace(*domain) == "" {
+			return usagef("required: --file or --domain")
+		}
+		o, err := core.VhostOrigin(*file, *domain)
+		if err != nil {
+			return err
+		}
+		fmt.Println("file   :", o.File)
+		fmt.Println("render :", o.Stamp.RenderHash)
+		if o.Stamped {
+			fmt.Printf("stamp  : %s by %s (ngm %s)\n", o.Stamp.Time.Local().Format("2006-01-02 15:04:05"), o.Stamp.Actor, o.Stamp.Version)
+		} else {
+			fmt.Println("stamp  : none (published before stamping, or not written by ngm)")
+		}
+		if o.Edited {
+			fmt.Println("WARNING: the config was edited after it was published (it no longer matches the render hash)")
+		}
+		if o.Run != nil {
+			fmt.Printf("run    : #%d %s by %s at %s (ngm apply --show %d)\n", o.Run.ID, o.Run.Request, o.Run.Actor, o.Run.StartedAt.Local().Format("2006-01-02 15:04:05"), o.Run.ID)
+		}
+		if len(o.Publishes) == 0 {
+			fmt.Println("not in the stamp index")
+			return nil
+		}
+		fmt.Println("published:")
+		for _, p := range o.Publishes {
+			fmt.Printf("  %s  %-30s  run #%-6d  %s (ngm %s)\n", p.StampedAt.Local().Format("2006-01-02 15:04:05"), p.Domain, p.RunID, p.Actor, p.Version)
+		}
 		return nil
 
 
@@ -355,16 +3070,16 @@ func cmdSite(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 
 
 	default:
-		return fmt.Errorf("unknown site subcommand: %s", args[0])
+		return usagef("unknown site subcommand: %s", args[0])
 	}
 }
 
 func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("usage: cert <list|info|issue|renew|check> ...")
+		return usagef("usage: cert <list|info|issue|renew|check|test|dns|ca> ...")
 	}
 
-	core, err := app.New(cfg, paths, st)
+	core, err := app.New(cfg, paths, st, runner)
 	if err != nil { return err }
 
 	switch args[0] {
@@ -378,7 +3093,7 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 			return nil
 		}
 
-		fmt.Printf("%-30s  %-12s  %-20s  %-20s\n", "DOMAIN", "DAYS LEFT", "NOT BEFORE", "NOT AFTER")
+		fmt.Printf("%-30s  %-5s  %-12s  %-20s  %-20s\n", "DOMAIN", "KEY", "DAYS LEFT", "NOT BEFORE", "NOT AFTER")
 		for _, c := range certList {
 			status := fmt.Sprintf("%d days", c.DaysLeft)
 			if c.DaysLeft < 0 {
@@ -386,8 +3101,9 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 			} else if c.DaysLeft <= 7 {
 				status = fmt.Sprintf("%d days (!)", c.DaysLeft)
 			}
-			fmt.Printf("%-30s  %-12s  %-20s  %-20s\n",
+			fmt.Printf("%-30s  %-5s  %-12s  %-20s  %-20s\n",
 				c.Domain,
+				c.KeyType,
 				status,
 				c.NotBefore.Format("2006-01-02 15:04"),
 				c.NotAfter.Format("2006-01-02 15:04"),
@@ -395,14 +3111,47 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 		}
 		return nil
 
+	case "test":
+		fs := flag.NewFlagSet("cert test", flag.ContinueOnError)
+		domain := fs.String("domain", "", "Site domain")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if *domain == "" {
+			return usagef("required: --domain")
+		}
+		rep, err := core.CertChallengeTest(context.Background(), *domain)
+		if err != nil {
+			return err
+		}
+		if rep.Problem != "" {
+			return fmt.Errorf("%s", rep.Problem)
+		}
+		fmt.Println("fetched:", rep.URL)
+		for _, p := range rep.Probes {
+			for _, h := range p.Hops {
+				fmt.Printf("  %s  %s\n", p.Addr, h)
+			}
+			if p.OK {
+				fmt.Printf("  %s  OK (%s)\n", p.Addr, p.Status)
+			} else {
+				fmt.Printf("  %s  FAIL: %s\n", p.Addr, p.Problem)
+			}
+		}
+		if !rep.OK() {
+			return fmt.Errorf("HTTP-01 validation of %s would fail", rep.Domain)
+		}
+		fmt.Println("OK: HTTP-01 validation should pass")
+		return nil
+
 	case "info":
 		fs := flag.NewFlagSet("cert info", flag.ContinueOnError)
 		domain := fs.String("domain", "", "Domain")
-		if err := fs.Parse(args[1:]); err != nil {
+		if err := parseFlags(fs, args[1:]); err != nil {
 			return err
 		}
 		if *domain == "" {
-			return fmt.Errorf("required: --domain")
+			return usagef("required: --domain")
 		}
 
 		info, err := core.CertInfo(*domain)
@@ -418,6 +3167,9 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 		fmt.Printf("Domain      : %s\n", info.Domain)
 		fmt.Printf("Cert Path   : %s\n", info.CertPath)
 		fmt.Printf("Key Path    : %s\n", info.KeyPath)
+		if info.Source != "" {
+			fmt.Printf("Source      : %s (not issued by ngm)\n", info.Source)
+		}
 		fmt.Printf("Not Before  : %s\n", info.NotBefore.Format(time.RFC3339))
 		fmt.Printf("Not After   : %s\n", info.NotAfter.Format(time.RFC3339))
 		fmt.Printf("Days Left   : %d\n", info.DaysLeft)
@@ -436,18 +3188,15 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 		fs := flag.NewFlagSet("cert issue", flag.ContinueOnError)
 		domain := fs.String("domain", "", "Domain")
 		applyNow := fs.Bool("apply", true, "Re-apply nginx config for this domain after successful issuance")
-		if err := fs.Parse(args[1:]); err != nil {
+		if err := parseFlags(fs, args[1:]); err != nil {
 			return err
 		}
 		if *domain == "" {
-			return fmt.Errorf("required: --domain")
+			return usagef("required: --domain")
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer cancel()
-
 		fmt.Printf("Issuing certificate for %s...\n", *domain)
-		if err := core.CertIssue(ctx, *domain, *applyNow); err != nil { return err }
+		if err := core.CertIssue(context.Background(), *domain, *applyNow); err != nil { return err }
 		fmt.Println("Certificate issued successfully!")
 
 		return nil
@@ -457,21 +3206,36 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 		domain := fs.String("domain", "", "Domain (optional, renews all if not specified)")
 		all := fs.Bool("all", false, "Renew all certificates")
 		applyNow := fs.Bool("apply", true, "Reload nginx after renewal")
-		if err := fs.Parse(args[1:]); err != nil {
+		if err := parseFlags(fs, args[1:]); err != nil {
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		defer cancel()
-
-		if err := core.CertRenew(ctx, strings.TrimSpace(*domain), *all, *applyNow); err != nil { return err }
+		if err := core.CertRenew(context.Background(), strings.TrimSpace(*domain), *all, *applyNow); err != nil { return err }
 		fmt.Println("Renewal complete!")
 		return nil
 
+	case "revoke":
+		fs := flag.NewFlagSet("cert revoke", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Domain (required)")
+			reason = fs.String("reason", "unspecified", "Reason: "+strings.Join(certs.RevokeReasons, ", "))
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if err := core.CertRevoke(context.Background(), *domain, *reason); err != nil {
+			return err
+		}
+		fmt.Printf("OK: certificate of %s revoked; run `ngm cert issue --domain %s` to replace it\n", *domain, *domain)
+		return nil
+
 	case "check":
 		fs := flag.NewFlagSet("cert check", flag.ContinueOnError)
 		days := fs.Int("days", 30, "Check for certs expiring within N days")
-		if err := fs.Parse(args[1:]); err != nil {
+		if err := parseFlags(fs, args[1:]); err != nil {
 			return err
 		}
 
@@ -496,43 +3260,108 @@ func cmdCert(st store.SiteStore, cfg *config.Config, paths config.Paths, args []
 		}
 		return nil
 
+	case "dns":
+		fs := flag.NewFlagSet("cert dns", flag.ContinueOnError)
+		domain := fs.String("domain", "", "Domain to delegate DNS-01 validation for (wildcard certs)")
+		off := fs.Bool("off", false, "Remove the delegation (new certificates use HTTP-01 again)")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if *off {
+			if err := core.AcmeDNSRemove(context.Background(), *domain); err != nil {
+				return err
+			}
+			fmt.Println("OK: acme-dns delegation removed")
+			return nil
+		}
+
+		st, err := core.AcmeDNSRegister(context.Background(), *domain)
+		if err != nil {
+			return err
+		}
+		if st.New {
+			fmt.Printf("Registered at %s. Create this DNS record once:\n\n", st.Server)
+		}
+		fmt.Printf("  %s. CNAME %s.\n\n", st.Record, st.Target)
+		if st.Delegated {
+			fmt.Println("Delegation OK: `cert issue` now requests the domain and its wildcard over DNS-01.")
+		} else {
+			fmt.Printf("Not delegated yet: %s\n", st.CheckError)
+		}
+		return nil
+
+	case "acme-dns-hook":
+		// run by certbot (--manual-auth-hook) for domains delegated with `cert dns`
+		return core.AcmeDNSHook(context.Background(), os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION"))
+
+	case "dns-hook":
+		// run by certbot (--manual-auth-hook) for domains in a dns.zones entry with dns01
+		return core.DNSChallengeHook(context.Background(), os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION"))
+
+	case "dns-cleanup":
+		// run by certbot (--manual-cleanup-hook) after the challenge
+		return core.DNSCleanupHook(context.Background(), os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION"))
+
+	case "ca":
+		fs := flag.NewFlagSet("cert ca", flag.ContinueOnError)
+		var (
+			domain = fs.String("domain", "", "Site domain (required)")
+			ca     = fs.String("ca", "", "CA to issue from: "+strings.Join(cfg.Certs.ACMECANames(), ", "))
+			def    = fs.Bool("default", false, "Use certs.ca again")
+		)
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if strings.TrimSpace(*domain) == "" {
+			return usagef("required: --domain")
+		}
+		if strings.TrimSpace(*ca) == "" && !*def {
+			name, issuedBy := core.CertCA(*domain)
+			fmt.Printf("ca        : %s\n", name)
+			if issuedBy != "" {
+				fmt.Printf("issued by : %s\n", issuedBy)
+			}
+			return nil
+		}
+		name := *ca
+		if *def {
+			name = ""
+		}
+		if err := core.SiteACMECA(context.Background(), *domain, name); err != nil {
+			return err
+		}
+		if name == "" {
+			name = cfg.Certs.CA + " (certs.ca)"
+		}
+		fmt.Printf("OK: %s now issues from %s; `cert issue --domain %s` moves the current certificate\n",
+			strings.ToLower(strings.TrimSpace(*domain)), name, strings.ToLower(strings.TrimSpace(*domain)))
+		return nil
+
 	default:
-		return fmt.Errorf("unknown cert subcommand: %s", args[0])
+		return usagef("unknown cert subcommand: %s", args[0])
 	}
 }
 
-func siteState(s store.Site) (state string, last string) {
-	last = "-"
-	if s.LastAppliedAt != nil {
-		last = s.LastAppliedAt.Format("2006-01-02 15:04")
+// keepPathSuffix marks a redirect that keeps the request path.
+func keepPathSuffix(keep bool) string {
+	if keep {
+		return " (+ request path)"
 	}
-
-	if !s.Enabled {
-		return "DISABLED", last
-	}
-	if s.LastApplyStatus == "fail" {
-		return "ERROR", last
-	}
-	if siteNeedsApply(s) {
-		return "PENDING", last
-	}
-	if s.LastApplyStatus == "ok" {
-		return "OK", last
-	}
-	return "PENDING", last
+	return ""
 }
 
-func siteNeedsApply(s store.Site) bool {
-	if !s.Enabled {
-		return false
-	}
-	if s.LastAppliedAt == nil {
-		return true
-	}
-	if s.LastApplyStatus != "ok" {
-		return true
+// cliActor is who runs the command, for the stamp of the vhosts it publishes: the
+// user behind sudo when there is one.
+func cliActor() string {
+	for _, k := range []string{"SUDO_USER", "USER", "LOGNAME"} {
+		if u := strings.TrimSpace(os.Getenv(k)); u != "" {
+			return u
+		}
 	}
-	return s.UpdatedAt.After(*s.LastAppliedAt)
+	return "cli"
 }
 
 func trimLen(s string, max int) string {
@@ -545,72 +3374,177 @@ func trimLen(s string, max int) string {
 	return s[:max-3] + "..."
 }
 
-func fileExists(p string) bool {
-	_, err := os.Stat(p)
-	return err == nil
-}
-
-// ensureSelfSignedCert creates a per-domain self-signed cert used only as a bootstrap fallback
-// so nginx can start before Let's Encrypt files exist.
-func ensureSelfSignedCert(domain, certPath, keyPath string) error {
-	if fileExists(certPath) && fileExists(keyPath) {
-		return nil
+// printApplyImpact summarizes what a reload changed; per-site lines only with -v.
+func printApplyImpact(imp *app.ApplyImpact) {
+	if imp == nil {
+		return
+	}
+	fmt.Printf("Impact: %d site(s) changed, ~%.1f req/min recent traffic\n", len(imp.Sites), imp.ReqPerMin)
+	if verbose {
+		for _, si := range imp.Sites {
+			rate := "traffic unknown"
+			if si.ReqPerMin >= 0 {
+				rate = fmt.Sprintf("%.1f req/min", si.ReqPerMin)
+			}
+			fmt.Printf("  %-30s  %-6s  +%d -%d lines  %s\n", si.Domain, si.Action, si.Added, si.Removed, rate)
+		}
+	}
+	for _, l := range imp.Listeners {
+		fmt.Println("  listener:", l)
 	}
-	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
-		return fmt.Errorf("mkdir cert dir: %w", err)
+	for _, z := range imp.Zones {
+		fmt.Println("  zone:", z)
 	}
-	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
-		return fmt.Errorf("mkdir key dir: %w", err)
+	if imp.Restart {
+		fmt.Println("RESTART NEEDED: a reload does not apply these changes; restart nginx:")
+		for _, r := range imp.Reasons {
+			fmt.Println("  -", r)
+		}
+	}
+}
+
+// printReach prints the per-family reachability of each site.
+func printReach(reps []app.ReachReport) {
+	for _, rep := range reps {
+		for _, f := range rep.Families {
+			st := "OK"
+			if !f.OK {
+				st = "FAIL"
+			}
+			line := fmt.Sprintf("%-4s  %s  %s %s", st, rep.Domain, f.Family, f.Address)
+			if f.StatusCode > 0 {
+				line += fmt.Sprintf("  HTTP %d %dms", f.StatusCode, f.LatencyMS)
+			}
+			if f.Cert != "" {
+				line += "  cert " + f.Cert
+			}
+			if f.Error != "" {
+				line += "  " + f.Error
+			}
+			fmt.Println(line)
+		}
 	}
+}
 
-	// openssl req -x509 -nodes -newkey rsa:2048 -days 7 -subj "/CN=domain" ...
-	cmd := exec.Command(
-		"openssl", "req",
-		"-x509",
-		"-nodes",
-		"-newkey", "rsa:2048",
-		"-days", "7",
-		"-subj", "/CN="+domain,
-		"-keyout", keyPath,
-		"-out", certPath,
+// cmdApplyHistory prints a site's lines of the newest apply runs.
+func cmdApplyHistory(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	fs := flag.NewFlagSet("apply history", flag.ContinueOnError)
+	var (
+		domain = fs.String("domain", "", "Site domain (required)")
+		n      = fs.Int("n", 20, "Number of runs to show")
 	)
-	out, err := cmd.CombinedOutput()
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*domain) == "" {
+		return usagef("required: --domain")
+	}
+	core, err := app.New(cfg, paths, st, runner)
 	if err != nil {
-		return fmt.Errorf("generate self-signed cert failed: %w (output: %s)", err, strings.TrimSpace(string(out)))
+		return err
 	}
-
-	// nginx master is typically root, so 0600 key is OK; cert can be world-readable.
-	_ = os.Chmod(certPath, 0644)
-	_ = os.Chmod(keyPath, 0600)
+	if _, err := st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(*domain))); err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	runs, err := core.SiteApplyHistory(*domain, *n)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		fmt.Println("no applies recorded for", *domain)
+		return nil
+	}
+	fmt.Printf("%-6s  %-19s  %-7s  %-8s  %-12s  %s\n", "RUN", "TIME", "ACTION", "STATUS", "HASH", "ERROR")
+	for _, r := range runs {
+		fmt.Printf("%-6d  %-19s  %-7s  %-8s  %-12s  %s\n", r.RunID, r.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			r.Action, r.Status, trimLen(r.RenderHash, 12), r.Message)
+	}
+	fmt.Println("details: ngm apply --show <run>")
 	return nil
 }
 
 func cmdApply(st store.SiteStore, cfg *config.Config, paths config.Paths, args []string) error {
+	if len(args) > 0 && args[0] == "status" {
+		core, err := app.New(cfg, paths, st, runner)
+		if err != nil {
+			return err
+		}
+		s := core.ApplyStatus()
+		if !s.Running {
+			fmt.Println("apply: idle")
+			return nil
+		}
+		fmt.Printf("apply: in progress\n  holder:  %s\n  process: %s (pid %d)\n  started: %s (%s ago)\n  step:    %s (since %s)\n",
+			s.Holder, s.Process, s.PID, s.StartedAt.Local().Format("2006-01-02 15:04:05"), s.Elapsed(),
+			s.Step, s.StepAt.Local().Format("15:04:05"))
+		return nil
+	}
+	if len(args) > 0 && args[0] == "history" {
+		return cmdApplyHistory(st, cfg, paths, args[1:])
+	}
 	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
 	var (
 		domain = fs.String("domain", "", "Apply only this domain (optional)")
 		all    = fs.Bool("all", false, "Apply all enabled sites (not only pending)")
 		dry    = fs.Bool("dry-run", false, "Show what would be applied, do nothing")
 		limit  = fs.Int("limit", 0, "Max number of sites to apply (0 = unlimited)")
+		show   = fs.Int64("show", 0, "Print the stored result of apply run N instead of applying")
 	)
-	if err := fs.Parse(args); err != nil {
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
 
 
 
-	core, err := app.New(cfg, paths, st)
+	core, err := app.New(cfg, paths, st, runner)
 	if err != nil {
 		return err
 	}
 
+	if *show > 0 {
+		run, err := core.ApplyRunGet(*show)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Run #%d  %s  (%s, %s)\n", run.ID, run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			run.Request, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+		if run.Actor != "" {
+			fmt.Println("by:", run.Actor)
+		}
+		fmt.Printf("reloaded: %v\n", run.Reloaded)
+		if run.Error != "" {
+			fmt.Println("error:", run.Error)
+		}
+		fmt.Printf("%-30s  %-7s  %-8s  %-7s  %-12s  %s\n", "DOMAIN", "ACTION", "STATUS", "CHANGED", "HASH", "ERROR")
+		for _, d := range run.Decoded.Domains {
+			fmt.Printf("%-30s  %-7s  %-8s  %-7v  %-12s  %s\n", d.Domain, d.Action, d.Status, d.Changed, trimLen(d.RenderHash, 12), d.Error)
+		}
+		printApplyImpact(run.Decoded.Impact)
+		printReach(run.Decoded.Reach)
+		if run.Decoded.Diagnostics != "" {
+			fmt.Println(run.Decoded.Diagnostics)
+		}
+		return nil
+	}
+
 	res, applyErr := core.Apply(context.Background(), app.ApplyRequest{
 		Domain: *domain,
 		All:    *all,
 		DryRun: *dry,
 		Limit:  *limit,
+		Actor:  cliActor(),
+		Progress: func(p app.ApplyProgress) {
+			// a single batch says nothing the summary does not
+			if p.Batch > 1 || p.Done < p.Total {
+				fmt.Fprintf(os.Stderr, "batch %d: %d/%d sites\n", p.Batch, p.Done, p.Total)
+			}
+		},
 	})
 
+	if res.Warning != "" {
+		fmt.Println("WARNING:", res.Warning)
+	}
+
 	// CLI-friendly output (kept simple; API/UI will just use the returned structs)
 	if *dry {
 		for _, r := range res.Domains {
@@ -626,241 +3560,54 @@ func cmdApply(st store.SiteStore, cfg *config.Config, paths config.Paths, args [
 	}
 
 	// Show per-domain failures (if any) before returning error
+	failed := 0
 	for _, r := range res.Domains {
-		if r.Status == "fail" {
+		switch {
+		case r.Status == "fail":
+			failed++
 			fmt.Println("FAIL:", r.Domain, "-", r.Error)
+		case verbose:
+			fmt.Printf("%s: %s %s (changed=%v pool=%v)\n", strings.ToUpper(r.Status), r.Action, r.Domain, r.Changed, r.PoolChanged)
 		}
 	}
 
-	if applyErr != nil {
-		return applyErr
-	}
-
-	if len(res.Changed) == 0 {
-		fmt.Println("Nothing to apply (no pending changes).")
-		return nil
-	}
-
-	fmt.Printf("Applied OK (%d): %s\n", len(res.Changed), strings.Join(res.Changed, ", "))
-	return nil
-
-
-
-
-
-
-
-
-
-}
-
-func applySingle(
-	mgr *nginx.Manager,
-	st store.SiteStore,
-	cfg *config.Config,
-	sqlSt *storesqlite.Store,
-	buildTD func(store.Site, string) (nginx.SiteTemplateData, error),
-	domain string,
-	dry bool,
-) error {
-	d := strings.ToLower(strings.TrimSpace(domain))
-	s, err := st.GetSiteByDomain(d)
-	if err != nil {
-		return fmt.Errorf("get site: %w", err)
-	}
-
-	if dry {
-		if !s.Enabled {
-			fmt.Println("dry-run delete:", d)
-			return nil
-		}
-		fmt.Println("dry-run apply:", d)
-		return nil
-	}
-
-	if !s.Enabled {
-		ok, err := stageDeleteLiveConf(mgr, d, false)
-		if err != nil {
-			if sqlSt != nil {
-				_ = sqlSt.UpdateApplyResult(d, "fail", "delete live conf failed: "+err.Error(), "")
-			}
-			return err
-		}
-		if !ok {
-			fmt.Println("Nothing to delete for:", d)
-			return nil
-		}
-
-		if err := mgr.TestConfig(); err != nil {
-			rollbackFromBackup(mgr, []string{d})
-			_ = mgr.Reload()
-			if sqlSt != nil {
-				_ = sqlSt.UpdateApplyResult(d, "fail", "nginx -t failed (rolled back): "+err.Error(), "")
-			}
-			return fmt.Errorf("nginx -t failed (rolled back): %w", err)
-		}
-
-		if err := mgr.Reload(); err != nil {
-			rollbackFromBackup(mgr, []string{d})
-			_ = mgr.Reload()
-			if sqlSt != nil {
-				_ = sqlSt.UpdateApplyResult(d, "fail", "nginx reload failed (rolled back): "+err.Error(), "")
-			}
-			return fmt.Errorf("nginx reload failed (rolled back): %w", err)
-		}
-
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "ok", "", "")
-		}
-		fmt.Println("deleted OK:", d)
-		return nil
-	}
-
-	td, err := buildTD(s, d)
-	if err != nil {
-		return err
-	}
-
-	outPath, content, err := mgr.RenderSiteToStaging(td)
-	renderHash := ""
-	if content != nil {
-		renderHash = util.Sha256Hex(content)
-	}
-	if err != nil {
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "fail", err.Error(), renderHash)
-		}
-		return fmt.Errorf("render: %w", err)
-	}
-	fmt.Println("rendered:", outPath)
-
-	changedNow, err := mgr.Publish(d)
-	if err != nil {
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "fail", err.Error(), renderHash)
-		}
-		return fmt.Errorf("publish: %w", err)
-	}
-
-	if !changedNow {
-		// Nothing changed on disk; we can safely mark as applied without an nginx reload.
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "ok", "", renderHash)
-		}
-		fmt.Println("applied OK (no changes):", d)
-		return nil
-	}
-
-	// Single-domain apply must also validate and reload nginx (same as bulk apply).
-	if err := mgr.TestConfig(); err != nil {
-		rollbackFromBackup(mgr, []string{d})
-		_ = mgr.Reload()
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "fail", "nginx -t failed (rolled back): "+err.Error(), renderHash)
-		}
-		return fmt.Errorf("nginx -t failed (rolled back): %w", err)
-	}
-
-	if err := mgr.Reload(); err != nil {
-		rollbackFromBackup(mgr, []string{d})
-		_ = mgr.Reload()
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "fail", "nginx reload failed (rolled back): "+err.Error(), renderHash)
-		}
-		return fmt.Errorf("nginx reload failed (rolled back): %w", err)
-	}
-
-	if err := mgr.Reload(); err != nil {
-		rollbackFromBackup(mgr, []string{d})
-		_ = mgr.Reload()
-		if sqlSt != nil {
-			_ = sqlSt.UpdateApplyResult(d, "fail", "nginx reload failed (rolled back): "+err.Error(), renderHash)
-		}
-		return fmt.Errorf("nginx reload failed (rolled back): %w", err)
+	printApplyImpact(res.Impact)
+	printReach(res.Reach)
+	if res.Diagnostics != "" {
+		fmt.Println(res.Diagnostics)
 	}
 
-	if sqlSt != nil {
-		_ = sqlSt.UpdateApplyResult(d, "ok", "", renderHash)
-	}
-	fmt.Println("applied OK:", d)
-	return nil
-}
-
-func stageDeleteLiveConf(mgr *nginx.Manager, domain string, dry bool) (bool, error) {
-	live := filepath.Join(mgr.SitesDir, domain+".conf")
-	bak := filepath.Join(mgr.BackupDir, domain+".conf.bak")
-
-	if _, err := os.Stat(live); err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
+	if applyErr != nil {
+		if res.RunID > 0 {
+			return fmt.Errorf("%w (details: ngm apply --show %d)", applyErr, res.RunID)
 		}
-		return false, err
-	}
-
-	if dry {
-		return true, nil
+		return applyErr
 	}
 
-	data, err := os.ReadFile(live)
-	if err != nil {
-		return false, err
+	if len(res.PHPReloaded) > 0 {
+		fmt.Printf("Reloaded %s (php-fpm pool changes)\n", strings.Join(res.PHPReloaded, ", "))
 	}
-	if err := util.WriteFileAtomic(bak, data, 0644); err != nil {
-		return false, err
-	}
-	if err := os.Remove(live); err != nil {
-		return false, err
+	switch {
+	case len(res.Changed) > 0:
+		fmt.Printf("Applied OK (%d): %s\n", len(res.Changed), strings.Join(res.Changed, ", "))
+	case len(res.PHPReloaded) > 0:
+		fmt.Println("No vhost changed: nginx was not reloaded.")
+	default:
+		fmt.Println("Nothing to apply (no pending changes).")
 	}
-	return true, nil
-}
-
-func rollbackFromBackup(mgr *nginx.Manager, domains []string) {
-	for _, d := range domains {
-		dst := filepath.Join(mgr.SitesDir, d+".conf")
-		bak := filepath.Join(mgr.BackupDir, d+".conf.bak")
-
-		if data, err := os.ReadFile(bak); err == nil && len(data) > 0 {
-			_ = util.WriteFileAtomic(dst, data, 0644)
-			continue
-		}
-		_ = os.Remove(dst)
+	if res.Batches > 1 {
+		fmt.Printf("In %d batches (nginx.apply.batch_size=%d)\n", res.Batches, cfg.Nginx.Apply.BatchSize)
 	}
-}
-
-func reloadNginx(paths config.Paths) error {
-	mgr := nginx.NewManager(
-		paths.NginxRoot,
-		paths.NginxBin,
-		paths.NginxMainConf,
-		paths.NginxSitesDir,
-		paths.NginxStageDir,
-		paths.NginxBackupDir,
-	)
-	if err := mgr.EnsureLayout(); err != nil {
-		return fmt.Errorf("nginx layout: %w", err)
+	if res.Remaining > 0 {
+		fmt.Printf("WARNING: stopped at nginx.apply.time_budget (%s): %d site(s) not reached, left pending; apply again for the rest\n",
+			cfg.Nginx.Apply.TimeBudget, res.Remaining)
 	}
-	if err := mgr.TestConfig(); err != nil {
-		return fmt.Errorf("nginx -t failed: %w", err)
+	if res.RunID > 0 && (len(res.Changed) > 0 || len(res.PHPReloaded) > 0 || failed > 0) {
+		fmt.Printf("Run #%d (ngm apply --show %d)\n", res.RunID, res.RunID)
 	}
-	if err := mgr.Reload(); err != nil {
-		return fmt.Errorf("nginx reload failed: %w", err)
+	if failed > 0 {
+		// the rest was applied: a partial failure
+		return fmt.Errorf("%d site(s) failed to apply", failed)
 	}
 	return nil
 }
-
-func inferUserFromWebroot(homeRoot, webroot string) (string, bool) {
-	homeRoot = strings.TrimRight(homeRoot, "/")
-	if homeRoot == "" {
-		return "", false
-	}
-	prefix := homeRoot + "/"
-	if !strings.HasPrefix(webroot, prefix) {
-		return "", false
-	}
-	rest := strings.TrimPrefix(webroot, prefix)
-	parts := strings.Split(rest, "/")
-	if len(parts) < 1 || parts[0] == "" {
-		return "", false
-	}
-	return parts[0], true
-}
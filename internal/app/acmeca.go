@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mynginx/internal/certs"
+)
+
+// siteACMECA is the CA name certificates of domain are issued by: the site's own
+// choice, else certs.ca (also for domains without a site).
+func (a *App) siteACMECA(domain string) string {
+	if s, err := a.st.GetSiteByDomain(domain); err == nil && s.ACMECA != "" {
+		return s.ACMECA
+	}
+	return a.cfg.Certs.CA
+}
+
+// useACMECA points m at the ACME directory (and EAB account) of domain's CA.
+func (a *App) useACMECA(m *certs.CertbotManager, domain string) error {
+	name := a.siteACMECA(domain)
+	ca, ok := a.cfg.Certs.ACMECA(name)
+	if !ok {
+		return fmt.Errorf("ACME CA %q is not configured (certs.cas)", name)
+	}
+	if ca.Directory != certs.LetsEncryptDirectory {
+		m.Server = ca.Directory
+	}
+	m.EABKID, m.EABHMACKey = ca.EABKID, ca.EABHMACKey
+	return nil
+}
+
+// SiteACMECA sets the CA a site's certificates are issued by ("" = certs.ca). The
+// current certificate stays until the next issuance (`cert issue`, or a renewal
+// falling due), which moves the lineage to the new CA.
+func (a *App) SiteACMECA(ctx context.Context, domain, ca string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	ca = strings.ToLower(strings.TrimSpace(ca))
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if ca != "" {
+		if src := certSource(site); src != CertSourceLetsEncrypt {
+			return invalidf("%s uses the %s certificate source; ngm does not issue its certificates", domain, src)
+		}
+		c, ok := a.cfg.Certs.ACMECA(ca)
+		if !ok {
+			return invalidf("unknown ACME CA %q (use one of: %s)", ca, strings.Join(a.cfg.Certs.ACMECANames(), ", "))
+		}
+		if ca == "zerossl" && c.EABKID == "" {
+			return invalidf("zerossl needs EAB credentials: set certs.cas.zerossl.eab_kid and eab_hmac_key")
+		}
+	}
+	return a.st.SetSiteACMECA(domain, ca)
+}
+
+// ACMECAs lists the CA names a site can pick.
+func (a *App) ACMECAs() []string {
+	return a.cfg.Certs.ACMECANames()
+}
+
+// CertCA describes where the certificate of domain comes from: the configured CA
+// name and the ACME directory its current lineage was issued by ("" if none yet).
+func (a *App) CertCA(domain string) (name, issuedBy string) {
+	name = a.siteACMECA(domain)
+	m := a.certMgr()
+	if ci, err := m.GetCertInfo(domain); err == nil && ci.Exists {
+		issuedBy = m.LineageServer(domain)
+	}
+	return name, issuedBy
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/store"
+)
+
+// AcmeDNSStatus is a domain's acme-dns delegation: the CNAME that must exist
+// (Record -> Target) and whether DNS currently has it.
+type AcmeDNSStatus struct {
+	Domain     string
+	Server     string
+	Record     string
+	Target     string
+	New        bool // registered by this call: the CNAME still has to be created
+	Delegated  bool
+	CheckError string
+}
+
+func acmeDNSDomain(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*.")
+}
+
+func acmeDNSAccount(r store.AcmeDNS) certs.AcmeDNSAccount {
+	return certs.AcmeDNSAccount{Server: r.Server, Username: r.Username, Password: r.Password, Subdomain: r.Subdomain, FullDomain: r.FullDomain}
+}
+
+// AcmeDNSRegister delegates DNS-01 validation of domain to certs.acme_dns.server,
+// registering an account the first time (later calls return the stored one).
+// From then on CertIssue requests domain + *.domain over DNS-01.
+func (a *App) AcmeDNSRegister(ctx context.Context, domain string) (AcmeDNSStatus, error) {
+	domain = acmeDNSDomain(domain)
+	if domain == "" {
+		return AcmeDNSStatus{}, invalidf("domain is required")
+	}
+	if _, err := a.st.GetAcmeDNS(domain); err == nil {
+		return a.AcmeDNSStatus(ctx, domain)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return AcmeDNSStatus{}, err
+	}
+	server := a.cfg.Certs.AcmeDNS.Server
+	if server == "" {
+		return AcmeDNSStatus{}, fmt.Errorf("certs.acme_dns.server is not configured")
+	}
+
+	var allow []string
+	for _, v := range a.cfg.Certs.AcmeDNS.AllowFrom {
+		if ip := net.ParseIP(v); ip != nil { // acme-dns only takes CIDRs
+			if ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		allow = append(allow, v)
+	}
+	acc, err := certs.AcmeDNSRegister(ctx, server, allow)
+	if err != nil {
+		return AcmeDNSStatus{}, err
+	}
+	if err := a.st.SaveAcmeDNS(store.AcmeDNS{
+		Domain: domain, Server: acc.Server, Username: acc.Username, Password: acc.Password,
+		Subdomain: acc.Subdomain, FullDomain: acc.FullDomain,
+	}); err != nil {
+		return AcmeDNSStatus{}, err
+	}
+	a.event("info", "certs", "%s: DNS-01 delegated to acme-dns (%s CNAME %s)", domain, certs.ChallengeName(domain), acc.FullDomain)
+
+	st := AcmeDNSStatus{Domain: domain, Server: acc.Server, Record: certs.ChallengeName(domain), Target: acc.FullDomain, New: true}
+	if err := acc.CheckDelegation(ctx, domain); err != nil {
+		st.CheckError = err.Error()
+	} else {
+		st.Delegated = true
+	}
+	return st, nil
+}
+
+// AcmeDNSStatus returns the stored delegation of domain and checks its CNAME.
+func (a *App) AcmeDNSStatus(ctx context.Context, domain string) (AcmeDNSStatus, error) {
+	domain = acmeDNSDomain(domain)
+	r, err := a.st.GetAcmeDNS(domain)
+	if err != nil {
+		return AcmeDNSStatus{}, err
+	}
+	st := AcmeDNSStatus{Domain: domain, Server: r.Server, Record: certs.ChallengeName(domain), Target: r.FullDomain}
+	if err := acmeDNSAccount(r).CheckDelegation(ctx, domain); err != nil {
+		st.CheckError = err.Error()
+	} else {
+		st.Delegated = true
+	}
+	return st, nil
+}
+
+// AcmeDNSRemove forgets the delegation; new certificates use HTTP-01 again.
+// Lineages already issued over DNS-01 keep renewing through the hook until
+// re-issued, so the hook fails from now on for them.
+func (a *App) AcmeDNSRemove(ctx context.Context, domain string) error {
+	_ = ctx
+	domain = acmeDNSDomain(domain)
+	if _, err := a.st.GetAcmeDNS(domain); err != nil {
+		return err
+	}
+	if err := a.st.DeleteAcmeDNS(domain); err != nil {
+		return err
+	}
+	a.event("info", "certs", "%s: acme-dns delegation removed", domain)
+	return nil
+}
+
+// AcmeDNSHook is certbot's --manual-auth-hook for delegated domains: it publishes
+// the validation token (CERTBOT_VALIDATION) for domain (CERTBOT_DOMAIN).
+func (a *App) AcmeDNSHook(ctx context.Context, domain, validation string) error {
+	domain = acmeDNSDomain(domain)
+	if domain == "" || validation == "" {
+		return fmt.Errorf("CERTBOT_DOMAIN and CERTBOT_VALIDATION are required (run by certbot)")
+	}
+	r, err := a.st.GetAcmeDNS(domain)
+	if err != nil {
+		return fmt.Errorf("no acme-dns delegation for %s: %w", domain, err)
+	}
+	return acmeDNSAccount(r).Update(ctx, validation)
+}
+
+// certMgrFor is certMgr issuing from the domain's ACME CA, with DNS-01 issuance for
+// domains delegated to acme-dns or in a dns.zones entry with dns01.
+func (a *App) certMgrFor(domain string) (*certs.CertbotManager, error) {
+	m := a.certMgr()
+	if err := a.useACMECA(m, domain); err != nil {
+		return nil, err
+	}
+	if _, err := a.st.GetAcmeDNS(acmeDNSDomain(domain)); err == nil {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("acme-dns hook: %w", err)
+		}
+		m.DNSAuthHook = fmt.Sprintf("%s -c %s cert acme-dns-hook", shellQuote(exe), shellQuote(a.cfg.Path))
+	} else if err := a.dnsHooks(m, domain); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// shellQuote quotes s for /bin/sh (certbot runs hooks through the shell).
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '/' || r == '.' || r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
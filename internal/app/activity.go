@@ -0,0 +1,74 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ActivityEntry is one line of a hosting user's activity feed.
+type ActivityEntry struct {
+	Time    time.Time
+	Domain  string // "" for events about the user rather than one site
+	Source  string // event source, or "apply" for apply runs
+	Level   string // info|warning|error
+	Message string
+}
+
+// OwnerActivity is the activity feed of a hosting user: the newest events about
+// them or their sites (cert renewals, deploys, jail changes, logins of the panel
+// account with their name) merged with the apply history of their sites, newest
+// first.
+func (a *App) OwnerActivity(username string, limit int) ([]ActivityEntry, error) {
+	username = strings.TrimSpace(username)
+	u, err := a.st.GetUserByUsername(username)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	events, err := a.st.ListOwnerEvents(u.Username, limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ActivityEntry, 0, len(events))
+	for _, e := range events {
+		out = append(out, ActivityEntry{Time: e.CreatedAt, Domain: e.Domain, Source: e.Source, Level: e.Level, Message: e.Message})
+	}
+
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sites {
+		if s.UserID != u.ID {
+			continue
+		}
+		runs, err := a.st.ListSiteApplyRuns(s.Domain, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range runs {
+			if r.Status == "dry-run" || r.Status == "skipped" {
+				continue
+			}
+			e := ActivityEntry{Time: r.CreatedAt, Domain: r.Domain, Source: "apply", Level: "info", Message: r.Action + " " + r.Status}
+			if r.Status == "fail" {
+				e.Level = "error"
+			}
+			if r.Message != "" {
+				e.Message += ": " + r.Message
+			}
+			out = append(out, e)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
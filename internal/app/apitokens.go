@@ -0,0 +1,300 @@
+package app
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"mynginx/internal/auth"
+	"mynginx/internal/store"
+)
+
+// ErrTokenDenied is returned by APITokenAuth for a missing, unknown, revoked or expired
+// token, or one without the needed scope (callers answer 401/403 without details).
+var ErrTokenDenied = errors.New("api token denied")
+
+var tokenNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// APITokenLimit limits a reseller token to some sites: those under Domains (a
+// domain also covers its subdomains) and/or those of the hosting user User. The
+// zero value allows every site.
+type APITokenLimit struct {
+	Domains []string
+	User    string
+}
+
+// Restricted reports whether the token is limited to some sites (it then cannot
+// use panel-wide endpoints such as apply runs, users or /metrics).
+func (l APITokenLimit) Restricted() bool {
+	return len(l.Domains) > 0 || l.User != ""
+}
+
+// AllowsSite reports whether the limit lets a token act on domain, owned by the
+// hosting user owner.
+func (l APITokenLimit) AllowsSite(domain, owner string) bool {
+	if l.User != "" && l.User != owner {
+		return false
+	}
+	if len(l.Domains) == 0 {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, d := range l.Domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenAccess is an authenticated token: its name and the sites it may touch.
+type APITokenAccess struct {
+	Name string
+	APITokenLimit
+}
+
+// TokenAllowsSite reports whether lim lets a token act on domain, looking up its
+// owner. A domain without a site is only allowed to domain-limited tokens whose
+// domains cover it (a user-limited token has no claim to it).
+func (a *App) TokenAllowsSite(lim APITokenLimit, domain string) bool {
+	if !lim.Restricted() {
+		return true
+	}
+	owner, _ := a.SiteOwner(domain)
+	return lim.AllowsSite(domain, owner)
+}
+
+// APITokenCreate creates a named API token with scopes, valid for ttl (0 = no expiry)
+// and limited to the sites of lim. The token is returned once; only its hash is stored.
+func (a *App) APITokenCreate(name string, scopes []string, ttl time.Duration, lim APITokenLimit) (string, store.APIToken, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !tokenNameRe.MatchString(name) {
+		return "", store.APIToken{}, invalidf("invalid token name %q (a-z, 0-9, . _ -; up to 64)", name)
+	}
+	scopes, err := cleanScopes(scopes)
+	if err != nil {
+		return "", store.APIToken{}, err
+	}
+	if ttl < 0 {
+		return "", store.APIToken{}, invalidf("token lifetime must not be negative")
+	}
+	if lim, err = a.cleanTokenLimit(lim); err != nil {
+		return "", store.APIToken{}, err
+	}
+	if _, err := a.st.GetAPIToken(name); err == nil {
+		return "", store.APIToken{}, invalidf("a token named %q already exists (rotate or revoke it)", name)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", store.APIToken{}, err
+	}
+
+	tok, prefix, hash, err := auth.NewAPIToken()
+	if err != nil {
+		return "", store.APIToken{}, err
+	}
+	t := store.APIToken{Name: name, Prefix: prefix, Hash: hash, Scopes: scopes, Domains: lim.Domains, HostingUser: lim.User}
+	if ttl > 0 {
+		exp := time.Now().Add(ttl)
+		t.ExpiresAt = &exp
+	}
+	if t.ID, err = a.st.CreateAPIToken(t); err != nil {
+		return "", store.APIToken{}, err
+	}
+	a.event("info", "api", "token %s created (scopes %s, expires %s%s)", name, strings.Join(scopes, ","), tokenExpiry(t.ExpiresAt), tokenLimitNote(lim))
+	return tok, t, nil
+}
+
+// APITokenRotate gives a token a new secret with the same scopes and lifetime (a token
+// that expired still gets a fresh term). The old secret keeps working for grace, so
+// clients can be switched over without downtime (0 = it stops at once).
+func (a *App) APITokenRotate(name string, grace time.Duration) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	t, err := a.st.GetAPIToken(name)
+	if err != nil {
+		return "", fmt.Errorf("get token: %w", err)
+	}
+	if t.RevokedAt != nil {
+		return "", invalidf("token %q is revoked", name)
+	}
+	if grace < 0 {
+		return "", invalidf("grace period must not be negative")
+	}
+
+	tok, prefix, hash, err := auth.NewAPIToken()
+	if err != nil {
+		return "", err
+	}
+	var expires, prevUntil *time.Time
+	if t.ExpiresAt != nil {
+		exp := time.Now().Add(t.ExpiresAt.Sub(t.CreatedAt))
+		expires = &exp
+	}
+	if grace > 0 {
+		until := time.Now().Add(grace)
+		prevUntil = &until
+	}
+	if err := a.st.RotateAPIToken(name, prefix, hash, expires, prevUntil); err != nil {
+		return "", err
+	}
+	a.event("info", "api", "token %s rotated (old secret valid for %s)", name, grace)
+	return tok, nil
+}
+
+// APITokenRevoke stops a token at once, including its pre-rotation secret.
+func (a *App) APITokenRevoke(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := a.st.RevokeAPIToken(name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return invalidf("no active token named %q", name)
+		}
+		return err
+	}
+	a.event("warn", "api", "token %s revoked", name)
+	return nil
+}
+
+func (a *App) APITokens() ([]store.APIToken, error) {
+	return a.st.ListAPITokens()
+}
+
+// ImportConfigTokens moves the static api.tokens entries into the database (scope
+// admin, no expiry), where they are listed, tracked and revoked like any other token.
+// An entry already imported is left alone, so a revoked one stays revoked while it
+// is still in config.yaml. An entry shorter than auth.MinLegacyTokenLen is refused.
+func (a *App) ImportConfigTokens() error {
+	for i, tok := range a.cfg.API.Tokens {
+		if tok = strings.TrimSpace(tok); tok == "" {
+			continue
+		}
+		if len(tok) < auth.MinLegacyTokenLen {
+			return invalidf("api.tokens[%d] is shorter than %d characters: use `ngm token create` instead", i, auth.MinLegacyTokenLen)
+		}
+		prefix := auth.LegacyTokenID(tok)
+		if _, err := a.st.FindAPIToken(prefix); err == nil {
+			continue
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		name := "config-" + strings.TrimPrefix(prefix, "legacy-")[:6]
+		t := store.APIToken{Name: name, Prefix: prefix, Hash: auth.HashAPIToken(tok), Scopes: []string{auth.ScopeAdmin}}
+		if _, err := a.st.CreateAPIToken(t); err != nil {
+			return fmt.Errorf("import api.tokens entry as %s: %w", name, err)
+		}
+		a.event("warn", "api", "token %s imported from api.tokens (scope admin): remove the entry from config.yaml and revoke it once clients use a scoped token", name)
+	}
+	return nil
+}
+
+// APITokenAuth checks a bearer token for scope and records its use from ip. It
+// returns the token's name and site limit, or ErrTokenDenied. A static api.tokens
+// entry is found by LegacyTokenID once ImportConfigTokens has stored it.
+func (a *App) APITokenAuth(token, scope, ip string) (APITokenAccess, error) {
+	if token == "" {
+		return APITokenAccess{}, ErrTokenDenied
+	}
+	prefix, ok := auth.ParseAPIToken(token)
+	if !ok {
+		if len(token) < auth.MinLegacyTokenLen {
+			return APITokenAccess{}, ErrTokenDenied // imported before the length check
+		}
+		prefix = auth.LegacyTokenID(token)
+	}
+
+	t, err := a.st.FindAPIToken(prefix)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("api token: %v", err)
+		}
+		return APITokenAccess{}, ErrTokenDenied
+	}
+	now := time.Now()
+	hash := auth.HashAPIToken(token)
+	valid := prefix == t.Prefix && subtle.ConstantTimeCompare([]byte(hash), []byte(t.Hash)) == 1
+	if !valid && prefix == t.PrevPrefix && t.PrevUntil != nil && now.Before(*t.PrevUntil) {
+		valid = subtle.ConstantTimeCompare([]byte(hash), []byte(t.PrevHash)) == 1
+	}
+	if !valid || t.RevokedAt != nil || (t.ExpiresAt != nil && now.After(*t.ExpiresAt)) || !auth.ScopeAllows(t.Scopes, scope) {
+		return APITokenAccess{}, ErrTokenDenied
+	}
+	if err := a.st.TouchAPIToken(t.ID, ip); err != nil {
+		log.Printf("api token %s: %v", t.Name, err)
+	}
+	return APITokenAccess{Name: t.Name, APITokenLimit: APITokenLimit{Domains: t.Domains, User: t.HostingUser}}, nil
+}
+
+// cleanScopes validates and de-duplicates token scopes (at least one).
+func cleanScopes(in []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range in {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		known := false
+		for _, k := range auth.Scopes {
+			known = known || k == s
+		}
+		if !known {
+			return nil, invalidf("unknown scope %q (want %s)", s, strings.Join(auth.Scopes, ", "))
+		}
+		seen[s] = true
+		out = append(out, s)
+	}
+	if len(out) == 0 {
+		return nil, invalidf("a token needs at least one scope (%s)", strings.Join(auth.Scopes, ", "))
+	}
+	return out, nil
+}
+
+// cleanTokenLimit lower-cases and de-duplicates the domains of lim and checks that
+// its hosting user exists.
+func (a *App) cleanTokenLimit(lim APITokenLimit) (APITokenLimit, error) {
+	var out APITokenLimit
+	seen := map[string]bool{}
+	for _, d := range lim.Domains {
+		d = strings.ToLower(strings.Trim(strings.TrimSpace(d), "."))
+		if d == "" || seen[d] {
+			continue
+		}
+		if !strings.Contains(d, ".") || strings.ContainsAny(d, " ,/*:") {
+			return APITokenLimit{}, invalidf("invalid token domain %q (a domain name; it also covers its subdomains)", d)
+		}
+		seen[d] = true
+		out.Domains = append(out.Domains, d)
+	}
+	if out.User = strings.TrimSpace(lim.User); out.User != "" {
+		if _, err := a.st.GetUserByUsername(out.User); errors.Is(err, sql.ErrNoRows) {
+			return APITokenLimit{}, invalidf("no hosting user %q", out.User)
+		} else if err != nil {
+			return APITokenLimit{}, err
+		}
+	}
+	return out, nil
+}
+
+// tokenLimitNote is ", limited to ..." for the event of a restricted token.
+func tokenLimitNote(lim APITokenLimit) string {
+	var parts []string
+	if len(lim.Domains) > 0 {
+		parts = append(parts, strings.Join(lim.Domains, ","))
+	}
+	if lim.User != "" {
+		parts = append(parts, "user "+lim.User)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ", limited to " + strings.Join(parts, " and ")
+}
+
+func tokenExpiry(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Format("2006-01-02")
+}
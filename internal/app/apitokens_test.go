@@ -0,0 +1,21 @@
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"mynginx/internal/config"
+)
+
+// TestImportConfigTokensShort checks that a static api.tokens entry too short to
+// survive a search of its unsalted hash is refused, and never authenticates.
+func TestImportConfigTokensShort(t *testing.T) {
+	a := &App{cfg: &config.Config{API: config.APIConfig{Tokens: []string{"changeme"}}}}
+	var ve *ValidationError
+	if err := a.ImportConfigTokens(); !errors.As(err, &ve) {
+		t.Errorf("import of a short token: %v, want a ValidationError", err)
+	}
+	if _, err := a.APITokenAuth("changeme", "read", "127.0.0.1"); !errors.Is(err, ErrTokenDenied) {
+		t.Errorf("short legacy token: %v, want ErrTokenDenied", err)
+	}
+}
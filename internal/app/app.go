@@ -4,11 +4,19 @@ import (
 	"fmt"
 	"sync"
 
+	"mynginx/internal/cluster"
 	"mynginx/internal/config"
 	"mynginx/internal/nginx"
+	"mynginx/internal/notify"
 	"mynginx/internal/store"
+	"mynginx/internal/syslog"
+	"mynginx/internal/util"
 )
 
+// Version is the ngm version stamped on published vhosts; main sets it from its
+// build version.
+var Version = "dev"
+
 // App wires core business logic used by CLI/API/UI.
 // Keep it transport-agnostic (no net/http, no templates, no flag parsing).
 type App struct {
@@ -17,10 +25,42 @@ type App struct {
 	st    store.SiteStore
 	ng    *nginx.Manager
 
+	// run executes every external command (nginx, certbot, openssl, useradd, systemctl)
+	run util.Runner
+	// timeouts bounds those commands (config.timeouts)
+	timeouts config.Timeouts
+
+	// cluster replicates certificates to peers and serializes issuance (no-op when standalone)
+	cluster *cluster.Node
+
 	applyMu sync.Mutex
+	// lock is who holds applyMu and their current step (ApplyStatus)
+	lock applyLock
+
+	// sup tracks the nginx master for the supervisor banner/loop
+	sup supervisor
+
+	// sat keeps the saturation alert state between samples
+	sat saturationWatch
+
+	// siem receives audit events when security.syslog is enabled (nil otherwise)
+	siem *syslog.Writer
+
+	// mailer sends every notification mail through the persisted retry queue
+	mailer *notify.Mailer
+
+	// applyStats counts the Apply calls of this process for /metrics
+	applyStats applyMetrics
+
+	// auditMu serializes the appends to security.audit_log
+	auditMu sync.Mutex
+
+	// jobWake nudges RunJobs when a job is queued (buffered, never blocks)
+	jobWake chan struct{}
 }
 
-func New(cfg *config.Config, paths config.Paths, st store.SiteStore) (*App, error) {
+// New builds the App. run executes external commands; nil means util.ExecRunner.
+func New(cfg *config.Config, paths config.Paths, st store.SiteStore, run util.Runner) (*App, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("cfg is nil")
 	}
@@ -36,9 +76,38 @@ func New(cfg *config.Config, paths config.Paths, st store.SiteStore) (*App, erro
 		paths.NginxStageDir,
 		paths.NginxBackupDir,
 	)
+	if run == nil {
+		run = util.ExecRunner{}
+	}
+	tmo := cfg.Timeouts.Durations()
+	mgr.Runner = run
+	mgr.GlobalDir = paths.NginxGlobalDir
+	mgr.BackupKeep = cfg.Nginx.Apply.BackupKeep
+	mgr.TestTimeout = tmo.NginxTest
+	mgr.ReloadTimeout = tmo.NginxReload
 	if err := mgr.EnsureLayout(); err != nil {
 		return nil, fmt.Errorf("nginx layout: %w", err)
 	}
 
-	return &App{cfg: cfg, paths: paths, st: st, ng: mgr}, nil
+	var siem *syslog.Writer
+	if sl := cfg.Security.Syslog; sl.Enabled {
+		w, err := syslog.New(sl.Network, sl.Address, sl.Facility, sl.AppName)
+		if err != nil {
+			return nil, err
+		}
+		siem = w
+	}
+
+	return &App{cfg: cfg, paths: paths, st: st, ng: mgr, run: run, timeouts: tmo, cluster: cluster.NewNode(cfg.Cluster, st), siem: siem,
+		mailer: notify.NewQueuedMailer(cfg.Notify.SMTP, st), jobWake: make(chan struct{}, 1)}, nil
+}
+
+// Mailer is the shared queued mailer (one pooled SMTP connection per process).
+func (a *App) Mailer() *notify.Mailer {
+	return a.mailer
+}
+
+// Cluster exposes the node for the agent API handlers.
+func (a *App) Cluster() *cluster.Node {
+	return a.cluster
 }
@@ -4,9 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"mynginx/internal/nginx"
 	"mynginx/internal/store"
@@ -18,6 +18,21 @@ type ApplyRequest struct {
 	All    bool
 	DryRun bool
 	Limit  int
+	// NoWait fails with ErrApplyBusy instead of waiting for a running apply.
+	NoWait bool
+	// Actor is who asked (panel user, unix user); it goes into the stamp header of
+	// the published vhosts and the apply run. Empty means ngm itself.
+	Actor string
+	// Progress, when set, is told after each batch of a multi-site apply how far
+	// it got (see nginx.apply.batch_size).
+	Progress func(ApplyProgress)
+}
+
+// ApplyProgress is how far a multi-site apply got after one of its batches.
+type ApplyProgress struct {
+	Batch int
+	Done  int // sites gone through, of Total
+	Total int
 }
 
 type ApplyDomainResult struct {
@@ -27,12 +42,42 @@ type ApplyDomainResult struct {
 	RenderHash string
 	Status     string // ok|fail|skipped|dry-run
 	Error      string
+
+	// PoolChanged is set when the php-fpm pool was rewritten; with Changed false
+	// only php-fpm was reloaded.
+	PoolChanged bool `json:",omitempty"`
 }
 
 type ApplyResult struct {
 	Domains  []ApplyDomainResult
 	Changed  []string
 	Reloaded bool
+
+	// RunID identifies the persisted run (ApplyRunGet); 0 if it could not be stored.
+	RunID int64 `json:"-"`
+
+	// Warning is set when nginx does not load sites_dir (applies would have no effect).
+	Warning string
+
+	// Impact describes what the reload changed (nil when nothing was published).
+	Impact *ApplyImpact `json:",omitempty"`
+
+	// Diagnostics holds what nginx logged when the test/reload failed (error log
+	// tail, and the journal with reload_mode systemd).
+	Diagnostics string `json:",omitempty"`
+
+	// Reach is the IPv4/IPv6 check of the applied sites (nginx.apply.verify_reach).
+	Reach []ReachReport `json:",omitempty"`
+
+	// PHPReloaded lists the php-fpm services reloaded for changed pools. A change
+	// that only touches pools reloads these and leaves nginx alone.
+	PHPReloaded []string `json:",omitempty"`
+
+	// Batches is how many test/reload batches a multi-site apply went in, and
+	// Remaining how many sites it did not reach within nginx.apply.time_budget
+	// (they stay pending).
+	Batches   int `json:",omitempty"`
+	Remaining int `json:",omitempty"`
 }
 
 type applyResultUpdater interface {
@@ -43,17 +88,28 @@ type proxyTargetLister interface {
 	ListProxyTargetsBySiteID(siteID int64) ([]nginx.UpstreamTarget, error)
 }
 
-func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error) {
-	// touches files + reloads nginx; avoid concurrent applies
-	a.applyMu.Lock()
-	defer a.applyMu.Unlock()
-	_ = ctx // reserved for future cancellation/timeouts
-
+func (a *App) apply(ctx context.Context, req ApplyRequest, stamp nginx.Stamp) (ApplyResult, error) {
 	var res ApplyResult
+	if req.Limit < 0 {
+		return res, invalidf("limit must be >= 0")
+	}
 
 	domain := strings.ToLower(strings.TrimSpace(req.Domain))
 	if domain != "" {
-		dr, changed, err := a.applyOne(domain, req.DryRun)
+		// touches files + reloads nginx; avoid concurrent applies
+		release, err := a.lockApply("apply "+applyRequestString(req), req.NoWait)
+		if err != nil {
+			return res, err
+		}
+		defer release()
+
+		a.applyStep("checking nginx includes")
+		if err := a.ng.CheckSitesIncluded(); err != nil {
+			res.Warning = err.Error()
+		}
+		a.applyStep("applying %s", domain)
+		dr, changed, err := a.applyOne(ctx, domain, req.DryRun, stamp, &res)
+		a.applyDomainDone(dr)
 		res.Domains = []ApplyDomainResult{dr}
 		if changed {
 			res.Changed = []string{domain}
@@ -66,15 +122,113 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 		return res, err
 	}
 
+	// nginx.apply.batch_size sites per test/reload, each batch under the apply lock
+	// on its own; a dry run reloads nothing and goes in one
+	batch := a.cfg.Nginx.Apply.BatchSize
+	if batch <= 0 || req.DryRun {
+		batch = len(sites)
+	}
+	budget := a.cfg.Nginx.Apply.TimeBudgetDuration()
+	started := time.Now()
+	applied := 0
+	for next := 0; next < len(sites); {
+		if req.Limit > 0 && applied >= req.Limit {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		if budget > 0 && res.Batches > 0 && time.Since(started) >= budget {
+			res.Remaining = len(sites) - next
+			a.event("warning", "apply", "apply stopped at its time budget (%s) after %d batch(es): %d site(s) not reached, left pending",
+				budget, res.Batches, res.Remaining)
+			break
+		}
+		n := batch
+		if req.Limit > 0 && req.Limit-applied < n {
+			n = req.Limit - applied
+		}
+
+		release, err := a.lockApply("apply "+applyRequestString(req), req.NoWait && res.Batches == 0)
+		if err != nil {
+			return res, err
+		}
+		if res.Batches == 0 {
+			a.applyStep("checking nginx includes")
+			if err := a.ng.CheckSitesIncluded(); err != nil {
+				res.Warning = err.Error()
+			}
+		}
+		// the lock was let go since the list was read: pick up edits made meanwhile
+		fresh, err := a.st.ListSites()
+		if err != nil {
+			release()
+			return res, err
+		}
+		refreshSites(sites, fresh, next)
+		var did int
+		next, did, err = a.applyBatch(ctx, req, sites, next, n, stamp, &res)
+		release()
+		res.Batches++
+		applied += did
+		if req.Progress != nil {
+			req.Progress(ApplyProgress{Batch: res.Batches, Done: next, Total: len(sites)})
+		}
+		if err != nil {
+			sort.Slice(res.Domains, func(i, j int) bool { return res.Domains[i].Domain < res.Domains[j].Domain })
+			return res, err
+		}
+	}
+	sort.Slice(res.Domains, func(i, j int) bool { return res.Domains[i].Domain < res.Domains[j].Domain })
+	return res, nil
+}
+
+// refreshSites replaces sites[from:] with their rows in fresh. A site deleted or
+// disabled since sites was read is blanked (no domain, so the batch passes over it):
+// its own change already handled its vhost.
+func refreshSites(sites, fresh []store.Site, from int) {
+	byID := make(map[int64]store.Site, len(fresh))
+	for _, s := range fresh {
+		byID[s.ID] = s
+	}
+	for i := from; i < len(sites); i++ {
+		s, ok := byID[sites[i].ID]
+		if !ok || (sites[i].Enabled && !s.Enabled) {
+			s = store.Site{ID: sites[i].ID}
+		}
+		sites[i] = s
+	}
+}
+
+// applyBatch applies sites from sites[from] on until n of them were acted on
+// (applied, deleted or failed; skipped ones do not count), then tests and reloads
+// nginx once for what changed. It adds to res and returns the index of the first
+// site it did not reach and how many it acted on.
+func (a *App) applyBatch(ctx context.Context, req ApplyRequest, sites []store.Site, from, n int, stamp nginx.Stamp, res *ApplyResult) (int, int, error) {
 	updater, _ := a.st.(applyResultUpdater)
 	proxyLister, _ := a.st.(proxyTargetLister)
 
 	applied := 0
 	var changed []string
+	var changes []confChange
+	var pools []poolChange
 	changedHashes := map[string]string{}
 
-	for _, s := range sites {
-		if req.Limit > 0 && applied >= req.Limit {
+	// each domain's result goes to the apply watchers once the next one starts
+	reported := len(res.Domains)
+	report := func() {
+		for _, dr := range res.Domains[reported:] {
+			a.applyDomainDone(dr)
+		}
+		reported = len(res.Domains)
+	}
+
+	next := len(sites)
+	for i := from; i < len(sites); i++ {
+		s := sites[i]
+		report()
+		if applied >= n {
+			next = i
 			break
 		}
 
@@ -82,15 +236,17 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 		if d == "" {
 			continue
 		}
+		a.applyStep("rendering %s (%d/%d)", d, i+1, len(sites))
 
-		if !s.Enabled {
+		if !s.Enabled && !siteRetiring(s) {
 			if req.DryRun {
 				res.Domains = append(res.Domains, ApplyDomainResult{Domain: d, Action: "delete", Status: "dry-run"})
 				applied++
 				continue
 			}
 
-			ok, err := stageDeleteLiveConf(a.ng, d)
+			prev := a.liveConf(d)
+			ok, err := a.ng.RemoveLiveSite(d)
 			if err != nil {
 				if updater != nil {
 					_ = updater.UpdateApplyResult(d, "fail", "delete live conf failed: "+err.Error(), "")
@@ -101,6 +257,7 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 			}
 			if ok {
 				changed = append(changed, d)
+				changes = append(changes, confChange{site: s, action: "delete", before: prev})
 				changedHashes[d] = ""
 			}
 			if updater != nil {
@@ -133,7 +290,7 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 		}
 
 		_, content, err := a.ng.RenderSiteToStaging(td)
-        	renderHash := ""
+		renderHash := ""
 		if content != nil {
 			renderHash = util.Sha256Hex(content)
 		}
@@ -146,8 +303,22 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 			continue
 		}
 
-		changedNow, err := a.ng.Publish(d)
+		pool, err := a.writeSitePool(s, d)
+		if err != nil {
+			if updater != nil {
+				_ = updater.UpdateApplyResult(d, "fail", err.Error(), renderHash)
+			}
+			res.Domains = append(res.Domains, ApplyDomainResult{Domain: d, Action: "apply", Status: "fail", Error: err.Error(), RenderHash: renderHash})
+			applied++
+			continue
+		}
+
+		prev := a.liveConf(d)
+		changedNow, err := a.ng.Publish(d, stamp)
 		if err != nil {
+			if pool != nil {
+				restorePools([]poolChange{*pool})
+			}
 			if updater != nil {
 				_ = updater.UpdateApplyResult(d, "fail", err.Error(), renderHash)
 			}
@@ -159,52 +330,87 @@ func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error)
 		if updater != nil {
 			_ = updater.UpdateApplyResult(d, "ok", "", renderHash)
 		}
-		res.Domains = append(res.Domains, ApplyDomainResult{Domain: d, Action: "apply", Status: "ok", Changed: changedNow, RenderHash: renderHash})
+		res.Domains = append(res.Domains, ApplyDomainResult{Domain: d, Action: "apply", Status: "ok", Changed: changedNow, RenderHash: renderHash, PoolChanged: pool != nil})
 
+		if pool != nil {
+			pools = append(pools, *pool)
+			changedHashes[d] = renderHash
+		}
 		if changedNow {
 			changed = append(changed, d)
+			changes = append(changes, confChange{site: s, action: "apply", before: prev, after: content})
 			changedHashes[d] = renderHash
 		}
 		applied++
 	}
 
-	sort.Slice(res.Domains, func(i, j int) bool { return res.Domains[i].Domain < res.Domains[j].Domain })
+	report()
+
+	if req.DryRun || (len(changed) == 0 && len(pools) == 0) {
+		return next, applied, nil
+	}
 
-	if req.DryRun || len(changed) == 0 {
-		return res, nil
+	// php-fpm first: the vhosts published above may already point at the new pools
+	if len(pools) > 0 {
+		reloaded, failed, err := a.reloadPools(pools)
+		res.PHPReloaded = append(res.PHPReloaded, reloaded...)
+		if err != nil {
+			// nginx has not loaded the batch yet: put its vhosts back too
+			a.ng.RestoreFromBackup(changed...)
+			if updater != nil {
+				for _, d := range append(failed, changed...) {
+					_ = updater.UpdateApplyResult(d, "fail", err.Error(), changedHashes[d])
+				}
+			}
+			return next, applied, err
+		}
+	}
+	if len(changed) == 0 {
+		return next, applied, nil
+	}
+	if imp := a.applyImpact(changes); res.Impact == nil {
+		res.Impact = imp
+	} else {
+		res.Impact.add(imp)
 	}
 
 	// validate + reload once for the batch
+	since := time.Now()
 	if a.cfg.Nginx.Apply.TestBeforeReload {
-		if err := a.ng.TestConfig(); err != nil {
-			rollbackFromBackup(a.ng, changed)
+		a.applyStep("nginx -t (%d changed)", len(changed))
+		if err := a.applyStepDone(a.ng.TestConfig()); err != nil {
+			res.Diagnostics = a.reloadDiagnostics(ctx, since)
+			a.ng.RestoreFromBackup(changed...)
 			_ = a.ng.Reload()
 			if updater != nil {
 				for _, d := range changed {
 					_ = updater.UpdateApplyResult(d, "fail", "nginx -t failed (rolled back): "+err.Error(), changedHashes[d])
 				}
 			}
-			return res, fmt.Errorf("nginx -t failed (rolled back): %w", err)
+			return next, applied, fmt.Errorf("nginx -t failed (rolled back): %w", err)
 		}
 	}
 
-	if err := a.ng.Reload(); err != nil {
-		rollbackFromBackup(a.ng, changed)
+	a.applyStep("reloading nginx")
+	if err := a.applyStepDone(a.ng.Reload()); err != nil {
+		res.Diagnostics = a.reloadDiagnostics(ctx, since)
+		a.ng.RestoreFromBackup(changed...)
 		_ = a.ng.Reload()
 		if updater != nil {
 			for _, d := range changed {
 				_ = updater.UpdateApplyResult(d, "fail", "nginx reload failed (rolled back): "+err.Error(), changedHashes[d])
 			}
 		}
-		return res, fmt.Errorf("nginx reload failed (rolled back): %w", err)
+		return next, applied, fmt.Errorf("nginx reload failed (rolled back): %w", err)
 	}
 
-	res.Changed = append([]string{}, changed...)
+	res.Changed = append(res.Changed, changed...)
 	res.Reloaded = true
-	return res, nil
+	return next, applied, nil
 }
 
-func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error) {
+// applyOne applies a single site, recording the reload impact in res.
+func (a *App) applyOne(ctx context.Context, domain string, dry bool, stamp nginx.Stamp, res *ApplyResult) (ApplyDomainResult, bool, error) {
 	updater, _ := a.st.(applyResultUpdater)
 	proxyLister, _ := a.st.(proxyTargetLister)
 
@@ -214,14 +420,15 @@ func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error)
 	}
 
 	if dry {
-		if !s.Enabled {
+		if !s.Enabled && !siteRetiring(s) {
 			return ApplyDomainResult{Domain: domain, Action: "delete", Status: "dry-run"}, false, nil
 		}
 		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "dry-run"}, false, nil
 	}
 
-	if !s.Enabled {
-		ok, err := stageDeleteLiveConf(a.ng, domain)
+	if !s.Enabled && !siteRetiring(s) {
+		prev := a.liveConf(domain)
+		ok, err := a.ng.RemoveLiveSite(domain)
 		if err != nil {
 			if updater != nil {
 				_ = updater.UpdateApplyResult(domain, "fail", "delete live conf failed: "+err.Error(), "")
@@ -231,10 +438,14 @@ func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error)
 		if !ok {
 			return ApplyDomainResult{Domain: domain, Action: "delete", Status: "ok", Changed: false}, false, nil
 		}
+		res.Impact = a.applyImpact([]confChange{{site: s, action: "delete", before: prev}})
+		since := time.Now()
 
 		if a.cfg.Nginx.Apply.TestBeforeReload {
-			if err := a.ng.TestConfig(); err != nil {
-				rollbackFromBackup(a.ng, []string{domain})
+			a.applyStep("nginx -t")
+			if err := a.applyStepDone(a.ng.TestConfig()); err != nil {
+				res.Diagnostics = a.reloadDiagnostics(ctx, since)
+				a.ng.RestoreFromBackup(domain)
 				_ = a.ng.Reload()
 				if updater != nil {
 					_ = updater.UpdateApplyResult(domain, "fail", "nginx -t failed (rolled back): "+err.Error(), "")
@@ -242,8 +453,10 @@ func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error)
 				return ApplyDomainResult{Domain: domain, Action: "delete", Status: "fail", Error: err.Error()}, true, fmt.Errorf("nginx -t failed (rolled back): %w", err)
 			}
 		}
-		if err := a.ng.Reload(); err != nil {
-			rollbackFromBackup(a.ng, []string{domain})
+		a.applyStep("reloading nginx")
+		if err := a.applyStepDone(a.ng.Reload()); err != nil {
+			res.Diagnostics = a.reloadDiagnostics(ctx, since)
+			a.ng.RestoreFromBackup(domain)
 			_ = a.ng.Reload()
 			if updater != nil {
 				_ = updater.UpdateApplyResult(domain, "fail", "nginx reload failed (rolled back): "+err.Error(), "")
@@ -276,7 +489,7 @@ func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error)
 		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Error: err.Error(), RenderHash: renderHash}, false, err
 	}
 
-	changed, err := a.ng.Publish(domain)
+	pool, err := a.writeSitePool(s, domain)
 	if err != nil {
 		if updater != nil {
 			_ = updater.UpdateApplyResult(domain, "fail", err.Error(), renderHash)
@@ -284,67 +497,83 @@ func (a *App) applyOne(domain string, dry bool) (ApplyDomainResult, bool, error)
 		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Error: err.Error(), RenderHash: renderHash}, false, err
 	}
 
+	prev := a.liveConf(domain)
+	changed, err := a.ng.Publish(domain, stamp)
+	if err != nil {
+		if pool != nil {
+			restorePools([]poolChange{*pool})
+		}
+		if updater != nil {
+			_ = updater.UpdateApplyResult(domain, "fail", err.Error(), renderHash)
+		}
+		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Error: err.Error(), RenderHash: renderHash}, false, err
+	}
+
+	// a pool-only change (php tuning) reloads php-fpm and leaves nginx alone
+	if pool != nil {
+		reloaded, _, err := a.reloadPools([]poolChange{*pool})
+		res.PHPReloaded = reloaded
+		if err != nil {
+			if changed {
+				a.ng.RestoreFromBackup(domain)
+			}
+			if updater != nil {
+				_ = updater.UpdateApplyResult(domain, "fail", err.Error(), renderHash)
+			}
+			return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Error: err.Error(), RenderHash: renderHash, PoolChanged: true}, false, err
+		}
+	}
+
 	if !changed {
 		if updater != nil {
 			_ = updater.UpdateApplyResult(domain, "ok", "", renderHash)
 		}
-		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "ok", Changed: false, RenderHash: renderHash}, false, nil
+		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "ok", Changed: false, RenderHash: renderHash, PoolChanged: pool != nil}, false, nil
 	}
+	res.Impact = a.applyImpact([]confChange{{site: s, action: "apply", before: prev, after: content}})
+	since := time.Now()
 
 	if a.cfg.Nginx.Apply.TestBeforeReload {
-		if err := a.ng.TestConfig(); err != nil {
-			rollbackFromBackup(a.ng, []string{domain})
+		a.applyStep("nginx -t")
+		if err := a.applyStepDone(a.ng.TestConfig()); err != nil {
+			res.Diagnostics = a.reloadDiagnostics(ctx, since)
+			a.ng.RestoreFromBackup(domain)
 			_ = a.ng.Reload()
 			if updater != nil {
 				_ = updater.UpdateApplyResult(domain, "fail", "nginx -t failed (rolled back): "+err.Error(), renderHash)
 			}
-			return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Changed: true, Error: err.Error(), RenderHash: renderHash}, true, fmt.Errorf("nginx -t failed (rolled back): %w", err)
+			return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Changed: true, Error: err.Error(), RenderHash: renderHash, PoolChanged: pool != nil}, true, fmt.Errorf("nginx -t failed (rolled back): %w", err)
 		}
 	}
-	if err := a.ng.Reload(); err != nil {
-		rollbackFromBackup(a.ng, []string{domain})
+	a.applyStep("reloading nginx")
+	if err := a.applyStepDone(a.ng.Reload()); err != nil {
+		res.Diagnostics = a.reloadDiagnostics(ctx, since)
+		a.ng.RestoreFromBackup(domain)
 		_ = a.ng.Reload()
 		if updater != nil {
 			_ = updater.UpdateApplyResult(domain, "fail", "nginx reload failed (rolled back): "+err.Error(), renderHash)
 		}
-		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Changed: true, Error: err.Error(), RenderHash: renderHash}, true, fmt.Errorf("nginx reload failed (rolled back): %w", err)
+		return ApplyDomainResult{Domain: domain, Action: "apply", Status: "fail", Changed: true, Error: err.Error(), RenderHash: renderHash, PoolChanged: pool != nil}, true, fmt.Errorf("nginx reload failed (rolled back): %w", err)
 	}
 
 	if updater != nil {
 		_ = updater.UpdateApplyResult(domain, "ok", "", renderHash)
 	}
-	return ApplyDomainResult{Domain: domain, Action: "apply", Status: "ok", Changed: true, RenderHash: renderHash}, true, nil
-}
-
-func stageDeleteLiveConf(mgr *nginx.Manager, domain string) (bool, error) {
-	live := filepath.Join(mgr.SitesDir, domain+".conf")
-	if _, err := os.Stat(live); err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
-	}
-	if err := mgr.RemoveLiveSite(domain); err != nil {
-		return false, err
-	}
-	return true, nil
+	return ApplyDomainResult{Domain: domain, Action: "apply", Status: "ok", Changed: true, RenderHash: renderHash, PoolChanged: pool != nil}, true, nil
 }
 
-func rollbackFromBackup(mgr *nginx.Manager, domains []string) {
-	for _, d := range domains {
-		dst := filepath.Join(mgr.SitesDir, d+".conf")
-		bak := filepath.Join(mgr.BackupDir, d+".conf.bak")
-
-		if data, err := os.ReadFile(bak); err == nil && len(data) > 0 {
-			_ = util.WriteFileAtomic(dst, data, 0644)
-			continue
-		}
-		_ = os.Remove(dst)
+// liveConf is the live vhost of domain (nil if there is none).
+func (a *App) liveConf(domain string) []byte {
+	live, _ := a.ng.SiteConfPaths(domain)
+	data, err := os.ReadFile(live)
+	if err != nil {
+		return nil
 	}
+	return data
 }
 
 func siteNeedsApply(s store.Site) bool {
-	if !s.Enabled {
+	if !s.Enabled && !siteRetiring(s) {
 		return false
 	}
 	if s.LastAppliedAt == nil {
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+
+	"mynginx/internal/store"
+)
+
+// TestRefreshSites checks that a later batch of an apply renders the current rows:
+// an edit made between batches is kept, and a site deleted or disabled meanwhile
+// is passed over rather than published from its stale row.
+func TestRefreshSites(t *testing.T) {
+	sites := []store.Site{
+		{ID: 1, Domain: "done.example.com", Enabled: true, PHPVersion: "8.1"},
+		{ID: 2, Domain: "edited.example.com", Enabled: true, PHPVersion: "8.1"},
+		{ID: 3, Domain: "deleted.example.com", Enabled: true},
+		{ID: 4, Domain: "disabled.example.com", Enabled: true},
+		{ID: 5, Domain: "enabled.example.com"},
+	}
+	fresh := []store.Site{
+		{ID: 1, Domain: "done.example.com", Enabled: true, PHPVersion: "8.3"},
+		{ID: 2, Domain: "edited.example.com", Enabled: true, PHPVersion: "8.3"},
+		{ID: 4, Domain: "disabled.example.com"},
+		{ID: 5, Domain: "enabled.example.com", Enabled: true},
+	}
+	refreshSites(sites, fresh, 1)
+
+	if sites[0].PHPVersion != "8.1" {
+		t.Errorf("site before from was refreshed: %+v", sites[0])
+	}
+	if sites[1].PHPVersion != "8.3" {
+		t.Errorf("edited site: %+v, want the fresh row", sites[1])
+	}
+	for _, i := range []int{2, 3} {
+		if sites[i].Domain != "" {
+			t.Errorf("site %d: %+v, want it passed over", sites[i].ID, sites[i])
+		}
+	}
+	if !sites[4].Enabled {
+		t.Errorf("site enabled meanwhile: %+v, want the fresh row", sites[4])
+	}
+}
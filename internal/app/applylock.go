@@ -0,0 +1,254 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// ErrApplyBusy is returned by a NoWait apply while another one holds the apply lock.
+var ErrApplyBusy = errors.New("an apply is already in progress")
+
+// ApplyStatus describes who holds the apply lock and what it is doing. The lock
+// covers apply, global apply, nginx wire and orphan pruning; the status is mirrored
+// to a file under the staging dir, so `ngm serve` and the CLI see each other.
+type ApplyStatus struct {
+	Running   bool
+	Holder    string // "apply domain=x", "global apply", …
+	Process   string // "ngm serve", "ngm apply", …
+	PID       int
+	StartedAt time.Time
+	Step      string
+	StepAt    time.Time
+}
+
+// ApplyEvent is one line of progress of an apply in this process, as WatchApply
+// streams it: a step (with its outcome once known), the result of a domain, or
+// Done when the apply lock is released.
+type ApplyEvent struct {
+	At     time.Time `json:"at"`
+	Holder string    `json:"holder,omitempty"` // first event of an apply
+	Step   string    `json:"step,omitempty"`
+	Domain string    `json:"domain,omitempty"`
+	Action string    `json:"action,omitempty"`
+	Status string    `json:"status,omitempty"` // ok|fail|skipped|dry-run
+	Error  string    `json:"error,omitempty"`
+	Done   bool      `json:"done,omitempty"`
+}
+
+// applyLock tracks the current holder of applyMu.
+type applyLock struct {
+	mu       sync.Mutex
+	status   ApplyStatus
+	watchers map[chan ApplyEvent]struct{}
+}
+
+func (a *App) applyStatusFile() string {
+	return filepath.Join(a.paths.NginxStageDir, "apply-status.json")
+}
+
+// applyLockFile is flocked by the holder of the apply lock. The status file cannot
+// carry the lock itself: every write replaces it.
+func (a *App) applyLockFile() string {
+	return filepath.Join(a.paths.NginxStageDir, "apply.lock")
+}
+
+// lockApply takes the apply lock for holder and returns its release. With noWait
+// it fails with ErrApplyBusy instead of waiting for a holder in this or another
+// process.
+func (a *App) lockApply(holder string, noWait bool) (func(), error) {
+	if noWait {
+		if st := a.ApplyStatus(); st.Running {
+			return nil, fmt.Errorf("%w (%s, step: %s)", ErrApplyBusy, st.Holder, st.Step)
+		}
+		if !a.applyMu.TryLock() {
+			return nil, ErrApplyBusy
+		}
+	} else {
+		a.applyMu.Lock()
+	}
+	lf, err := a.flockApply(noWait)
+	if err != nil {
+		a.applyMu.Unlock()
+		if errors.Is(err, ErrApplyBusy) {
+			if st := a.ApplyStatus(); st.Running {
+				return nil, fmt.Errorf("%w (%s, step: %s)", ErrApplyBusy, st.Holder, st.Step)
+			}
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	process := filepath.Base(os.Args[0])
+	if len(os.Args) > 1 {
+		process += " " + os.Args[1]
+	}
+	a.lock.mu.Lock()
+	a.lock.status = ApplyStatus{Running: true, Holder: holder, Process: process, PID: os.Getpid(), StartedAt: now, Step: "starting", StepAt: now}
+	a.writeApplyStatus()
+	a.notifyApply(ApplyEvent{Holder: holder, Step: "starting"})
+	a.lock.mu.Unlock()
+
+	return func() {
+		a.lock.mu.Lock()
+		a.notifyApply(ApplyEvent{Done: true})
+		a.lock.status = ApplyStatus{}
+		// still under the flock, so this is our status file and not the next holder's
+		_ = os.Remove(a.applyStatusFile())
+		a.lock.mu.Unlock()
+		_ = lf.Close() // drops the flock
+		a.applyMu.Unlock()
+	}, nil
+}
+
+// flockApply takes the flock of applyLockFile, the part of the apply lock that
+// other processes (`ngm apply` next to `ngm serve`) see. The lock goes with the
+// returned file.
+func (a *App) flockApply(noWait bool) (*os.File, error) {
+	path := a.applyLockFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", filepath.Dir(path), err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	how := syscall.LOCK_EX
+	if noWait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		if err = syscall.Flock(int(f.Fd()), how); err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrApplyBusy
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// applyStep records the current step of the running apply.
+func (a *App) applyStep(format string, args ...any) {
+	a.lock.mu.Lock()
+	defer a.lock.mu.Unlock()
+	if !a.lock.status.Running {
+		return
+	}
+	a.lock.status.Step = fmt.Sprintf(format, args...)
+	a.lock.status.StepAt = time.Now()
+	a.writeApplyStatus()
+	a.notifyApply(ApplyEvent{Step: a.lock.status.Step})
+}
+
+// applyStepDone reports how the current step (nginx -t, reload) ended, with the
+// error output when it failed, and returns err.
+func (a *App) applyStepDone(err error) error {
+	a.lock.mu.Lock()
+	defer a.lock.mu.Unlock()
+	ev := ApplyEvent{Step: a.lock.status.Step, Status: "ok"}
+	if err != nil {
+		ev.Status, ev.Error = "fail", err.Error()
+	}
+	a.notifyApply(ev)
+	return err
+}
+
+// applyDomainDone reports the result of one domain of the running apply.
+func (a *App) applyDomainDone(dr ApplyDomainResult) {
+	a.lock.mu.Lock()
+	defer a.lock.mu.Unlock()
+	a.notifyApply(ApplyEvent{Domain: dr.Domain, Action: dr.Action, Status: dr.Status, Error: dr.Error})
+}
+
+// WatchApply streams the progress of the applies run by this process (not those
+// of another `ngm apply`) until stop is called. A watcher that falls behind
+// misses events rather than holding up the apply.
+func (a *App) WatchApply() (events <-chan ApplyEvent, stop func()) {
+	ch := make(chan ApplyEvent, 256)
+	a.lock.mu.Lock()
+	if a.lock.watchers == nil {
+		a.lock.watchers = map[chan ApplyEvent]struct{}{}
+	}
+	a.lock.watchers[ch] = struct{}{}
+	a.lock.mu.Unlock()
+	return ch, func() {
+		a.lock.mu.Lock()
+		delete(a.lock.watchers, ch)
+		a.lock.mu.Unlock()
+	}
+}
+
+// notifyApply hands ev to the watchers (a.lock.mu held).
+func (a *App) notifyApply(ev ApplyEvent) {
+	ev.At = time.Now()
+	for ch := range a.lock.watchers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// writeApplyStatus mirrors the status to disk (best effort; a.lock.mu held).
+func (a *App) writeApplyStatus() {
+	if data, err := json.Marshal(a.lock.status); err == nil {
+		_ = util.WriteFileAtomic(a.applyStatusFile(), data, 0644)
+	}
+}
+
+// ApplyStatus reports the apply lock holder of this process, or else of another
+// live process on this host (a status file left by a dead process is ignored).
+func (a *App) ApplyStatus() ApplyStatus {
+	a.lock.mu.Lock()
+	st := a.lock.status
+	a.lock.mu.Unlock()
+	if st.Running {
+		return st
+	}
+
+	data, err := os.ReadFile(a.applyStatusFile())
+	if err != nil {
+		return ApplyStatus{}
+	}
+	if err := json.Unmarshal(data, &st); err != nil || !st.Running || st.PID == os.Getpid() || !pidAlive(st.PID) {
+		return ApplyStatus{}
+	}
+	return st
+}
+
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Elapsed is how long the holder has had the lock.
+func (s ApplyStatus) Elapsed() time.Duration {
+	if !s.Running {
+		return 0
+	}
+	return time.Since(s.StartedAt).Round(time.Second)
+}
+
+// String is the one-line form used by the CLI and logs.
+func (s ApplyStatus) String() string {
+	if !s.Running {
+		return "idle"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s by %s (pid %d) for %s: %s", s.Holder, s.Process, s.PID, s.Elapsed(), s.Step))
+}
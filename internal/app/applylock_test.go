@@ -0,0 +1,38 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"mynginx/internal/config"
+)
+
+// TestLockApplyAcrossProcesses checks the flock half of the apply lock: two Apps
+// sharing a staging dir (as `ngm serve` and `ngm apply` do) exclude each other,
+// and the status file is removed by its holder only.
+func TestLockApplyAcrossProcesses(t *testing.T) {
+	paths := config.Paths{NginxStageDir: t.TempDir()}
+	serve, cli := &App{paths: paths}, &App{paths: paths}
+
+	release, err := serve.lockApply("global apply", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.lockApply("apply domain=a.example.com", true); !errors.Is(err, ErrApplyBusy) {
+		t.Fatalf("second lock: %v, want ErrApplyBusy", err)
+	}
+	if _, err := os.Stat(serve.applyStatusFile()); err != nil {
+		t.Fatalf("status file of the holder: %v", err)
+	}
+
+	release()
+	if _, err := os.Stat(serve.applyStatusFile()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("status file after release: %v", err)
+	}
+	release, err = cli.lockApply("apply domain=a.example.com", true)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	release()
+}
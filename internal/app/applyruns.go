@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+// ApplyRun is a stored apply call with its decoded result.
+type ApplyRun struct {
+	store.ApplyRun
+	Decoded ApplyResult
+}
+
+// Apply renders, publishes, tests and reloads the requested sites (see apply) and
+// persists the full result as an apply run; res.RunID links to it. Published
+// vhosts carry a stamp header whose render hash is indexed to the run.
+func (a *App) Apply(ctx context.Context, req ApplyRequest) (ApplyResult, error) {
+	started := time.Now()
+	if req.Actor = strings.TrimSpace(req.Actor); req.Actor == "" {
+		req.Actor = "ngm"
+	}
+	stamp := nginx.Stamp{Time: started, Actor: req.Actor, Version: Version}
+	res, err := a.apply(ctx, req, stamp)
+	a.applyStats.observe(err, req.DryRun, time.Since(started))
+	if errors.Is(err, ErrApplyBusy) {
+		return res, err // nothing ran, nothing to record
+	}
+	if err == nil && res.Reloaded && a.cfg.Nginx.Apply.VerifyReach {
+		var applied []string
+		for _, d := range res.Domains {
+			if d.Action == "apply" && d.Status == "ok" && d.Changed {
+				applied = append(applied, d.Domain)
+			}
+		}
+		res.Reach = a.verifyReach(ctx, applied)
+	}
+	res.RunID = a.saveApplyRun(req, res, err, started)
+	a.indexStamps(res, stamp)
+	return res, err
+}
+
+// indexStamps records the render hash of every vhost res published, so the stamp
+// header of a file on disk leads back to the run.
+func (a *App) indexStamps(res ApplyResult, stamp nginx.Stamp) {
+	var stamps []store.VhostStamp
+	for _, d := range res.Domains {
+		if d.Action != "apply" || d.Status != "ok" || !d.Changed || d.RenderHash == "" {
+			continue
+		}
+		stamps = append(stamps, store.VhostStamp{
+			Domain:     d.Domain,
+			RenderHash: d.RenderHash,
+			RunID:      res.RunID,
+			Actor:      stamp.Actor,
+			Version:    stamp.Version,
+			StampedAt:  stamp.Time,
+		})
+	}
+	if len(stamps) == 0 {
+		return
+	}
+	if err := a.st.AddVhostStamps(stamps); err != nil {
+		log.Printf("vhost stamps: %v", err)
+	}
+}
+
+func (a *App) saveApplyRun(req ApplyRequest, res ApplyResult, applyErr error, started time.Time) int64 {
+	body, err := json.Marshal(res)
+	if err != nil {
+		log.Printf("apply run: %v", err)
+		return 0
+	}
+	run := store.ApplyRun{
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		Request:    applyRequestString(req),
+		DryRun:     req.DryRun,
+		Reloaded:   res.Reloaded,
+		Result:     body,
+		Actor:      req.Actor,
+	}
+	if applyErr != nil {
+		run.Error = applyErr.Error()
+	}
+	var sites []store.ApplyRunSite
+	for _, d := range res.Domains {
+		if d.Status == "skipped" {
+			continue
+		}
+		sites = append(sites, store.ApplyRunSite{Domain: d.Domain, Action: d.Action, Status: d.Status, Message: d.Error,
+			RenderHash: d.RenderHash})
+	}
+	id, err := a.st.SaveApplyRun(run, sites)
+	if err != nil {
+		log.Printf("apply run: %v", err)
+		return 0
+	}
+	return id
+}
+
+func applyRequestString(req ApplyRequest) string {
+	var parts []string
+	switch d := strings.ToLower(strings.TrimSpace(req.Domain)); {
+	case d != "":
+		parts = append(parts, "domain="+d)
+	case req.All:
+		parts = append(parts, "all")
+	default:
+		parts = append(parts, "pending")
+	}
+	if req.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("limit=%d", req.Limit))
+	}
+	if req.DryRun {
+		parts = append(parts, "dry-run")
+	}
+	return strings.Join(parts, " ")
+}
+
+// ApplyRunGet loads a stored apply run.
+func (a *App) ApplyRunGet(id int64) (ApplyRun, error) {
+	run, err := a.st.GetApplyRun(id)
+	if err != nil {
+		return ApplyRun{}, err
+	}
+	out := ApplyRun{ApplyRun: run}
+	if err := json.Unmarshal(run.Result, &out.Decoded); err != nil {
+		return ApplyRun{}, fmt.Errorf("decode apply run %d: %w", id, err)
+	}
+	out.Decoded.RunID = run.ID
+	return out, nil
+}
+
+// ApplyRuns lists the newest apply runs (without results).
+func (a *App) ApplyRuns(limit int) ([]store.ApplyRun, error) {
+	return a.st.ListApplyRuns(limit)
+}
+
+// SiteApplyHistory lists a site's lines of the newest apply runs.
+func (a *App) SiteApplyHistory(domain string, limit int) ([]store.ApplyRunSite, error) {
+	return a.st.ListSiteApplyRuns(strings.ToLower(strings.TrimSpace(domain)), limit)
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// Kinds of change request (store.ChangeRequest.Kind).
+const (
+	ChangeSiteDelete = "site_delete" // Target: the domain
+	ChangeApplyAll   = "apply_all"   // Params: changeApplyParams
+)
+
+// changeApplyParams are the options of an apply_all request.
+type changeApplyParams struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// ApprovalsRequired reports whether sensitive panel and API operations wait for a
+// second admin (security.approvals.enabled).
+func (a *App) ApprovalsRequired() bool {
+	return a.cfg.Security.Approvals.Enabled
+}
+
+// RequestSiteDelete holds the deletion of domain for approval.
+func (a *App) RequestSiteDelete(domain, by string) (store.ChangeRequest, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return store.ChangeRequest{}, invalidf("domain is required")
+	}
+	if _, err := a.st.GetSiteByDomain(domain); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ChangeRequest{}, invalidf("no such site %q", domain)
+		}
+		return store.ChangeRequest{}, err
+	}
+	return a.requestChange(store.ChangeRequest{Kind: ChangeSiteDelete, Target: domain, RequestedBy: by})
+}
+
+// RequestApplyAll holds an apply of every site (at most limit, 0 = all) for approval.
+func (a *App) RequestApplyAll(limit int, by string) (store.ChangeRequest, error) {
+	if limit < 0 {
+		return store.ChangeRequest{}, invalidf("limit must be >= 0")
+	}
+	c := store.ChangeRequest{Kind: ChangeApplyAll, RequestedBy: by}
+	if limit > 0 {
+		params, err := json.Marshal(changeApplyParams{Limit: limit})
+		if err != nil {
+			return store.ChangeRequest{}, err
+		}
+		c.Params = string(params)
+	}
+	return a.requestChange(c)
+}
+
+func (a *App) requestChange(c store.ChangeRequest) (store.ChangeRequest, error) {
+	id, err := a.st.CreateChangeRequest(c)
+	if err != nil {
+		return store.ChangeRequest{}, err
+	}
+	c, err = a.st.GetChangeRequest(id)
+	if err != nil {
+		return store.ChangeRequest{}, err
+	}
+	a.event("info", "approvals", "%s: change #%d requested by %q, waiting for approval", changeSubject(c), c.ID, c.RequestedBy)
+	return c, nil
+}
+
+// ChangeRequests returns the newest change requests, first marking the pending ones
+// older than security.approvals.expire as expired.
+func (a *App) ChangeRequests(limit int) ([]store.ChangeRequest, error) {
+	list, err := a.st.ListChangeRequests(limit)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range list {
+		if a.changeLapsed(c) {
+			if err := a.st.UpdateChangeRequestStatus(c.ID, store.ChangePending, store.ChangeExpired, "", ""); err == nil {
+				list[i].Status = store.ChangeExpired
+				a.event("info", "approvals", "%s: change #%d expired undecided", changeSubject(c), c.ID)
+			}
+		}
+	}
+	return list, nil
+}
+
+// changeLapsed reports whether c is still pending past security.approvals.expire.
+func (a *App) changeLapsed(c store.ChangeRequest) bool {
+	ttl := a.cfg.Security.Approvals.ExpireAfter()
+	return c.Status == store.ChangePending && ttl > 0 && time.Since(c.CreatedAt) > ttl
+}
+
+// ApproveChange carries out a pending change on behalf of by, who must not be the
+// one who requested it. The request is claimed before it runs, so it runs once
+// even when two admins approve it at the same time; a failure is kept in its Note.
+func (a *App) ApproveChange(ctx context.Context, id int64, by string) (store.ChangeRequest, error) {
+	c, err := a.pendingChange(id)
+	if err != nil {
+		return c, err
+	}
+	if strings.EqualFold(c.RequestedBy, by) {
+		return c, invalidf("change #%d was requested by %s: another admin has to approve it", id, by)
+	}
+	if c.Kind == ChangeApplyAll && a.ApplyStatus().Running {
+		return c, invalidf("an apply is running: approve change #%d once it has finished", id)
+	}
+	if err := a.st.UpdateChangeRequestStatus(id, store.ChangePending, store.ChangeApproved, by, ""); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, invalidf("change #%d is no longer pending", id)
+		}
+		return c, err
+	}
+
+	status, note := store.ChangeDone, ""
+	if runErr := a.runChange(ctx, c, by); runErr != nil {
+		status, note = store.ChangeFailed, runErr.Error()
+	}
+	if err := a.st.UpdateChangeRequestStatus(id, store.ChangeApproved, status, "", note); err != nil {
+		return c, err
+	}
+	if status == store.ChangeFailed {
+		a.event("error", "approvals", "%s: change #%d requested by %q, approved by %q, failed: %s", changeSubject(c), id, c.RequestedBy, by, note)
+	} else {
+		a.event("info", "approvals", "%s: change #%d requested by %q, approved by %q, done", changeSubject(c), id, c.RequestedBy, by)
+	}
+	return a.st.GetChangeRequest(id)
+}
+
+// RejectChange turns a pending change down (the requester may withdraw their own).
+func (a *App) RejectChange(id int64, by, reason string) (store.ChangeRequest, error) {
+	c, err := a.pendingChange(id)
+	if err != nil {
+		return c, err
+	}
+	reason = strings.TrimSpace(reason)
+	if err := a.st.UpdateChangeRequestStatus(id, store.ChangePending, store.ChangeRejected, by, reason); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c, invalidf("change #%d is no longer pending", id)
+		}
+		return c, err
+	}
+	a.event("warning", "approvals", "%s: change #%d requested by %q, rejected by %q: %s", changeSubject(c), id, c.RequestedBy, by, reason)
+	return a.st.GetChangeRequest(id)
+}
+
+// pendingChange loads change id and checks it can still be decided.
+func (a *App) pendingChange(id int64) (store.ChangeRequest, error) {
+	c, err := a.st.GetChangeRequest(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c, invalidf("no such change request #%d", id)
+	}
+	if err != nil {
+		return c, err
+	}
+	if a.changeLapsed(c) {
+		if err := a.st.UpdateChangeRequestStatus(id, store.ChangePending, store.ChangeExpired, "", ""); err == nil {
+			c.Status = store.ChangeExpired
+		}
+	}
+	if c.Status != store.ChangePending {
+		return c, invalidf("change #%d is %s, not pending", id, c.Status)
+	}
+	return c, nil
+}
+
+// runChange carries out an approved change.
+func (a *App) runChange(ctx context.Context, c store.ChangeRequest, approver string) error {
+	switch c.Kind {
+	case ChangeSiteDelete:
+		return a.SiteDelete(ctx, c.Target)
+	case ChangeApplyAll:
+		var p changeApplyParams
+		if c.Params != "" {
+			if err := json.Unmarshal([]byte(c.Params), &p); err != nil {
+				return fmt.Errorf("bad params: %w", err)
+			}
+		}
+		_, err := a.Apply(ctx, ApplyRequest{
+			All:    true,
+			Limit:  p.Limit,
+			NoWait: true,
+			Actor:  fmt.Sprintf("%s (approved by %s)", c.RequestedBy, approver),
+		})
+		return err
+	default:
+		return fmt.Errorf("unknown change kind %q", c.Kind)
+	}
+}
+
+// changeSubject is what a change acts on, as event messages start with it.
+func changeSubject(c store.ChangeRequest) string {
+	if c.Target != "" {
+		return c.Target
+	}
+	return "all sites"
+}
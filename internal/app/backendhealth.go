@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// backendHealthPath is a backend health path: absolute, no query, no nginx syntax.
+var backendHealthPath = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+// SiteBackendHealth exposes the health endpoint of a proxy site's backend (path, e.g.
+// "/healthz"; "" = stop) at health.backend.location, to the addresses of
+// health.backend.allow only; the health checks then probe the backend there. An
+// enabled site is applied, and the previous setting restored if that fails.
+func (a *App) SiteBackendHealth(ctx context.Context, domain, path string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	path = strings.TrimSpace(path)
+	if path != "" && site.Mode != "proxy" {
+		return invalidf("%s is a %s site: a backend health endpoint applies to proxy sites", domain, site.Mode)
+	}
+	if path != "" && !backendHealthPath.MatchString(path) {
+		return invalidf("backend health path %q: use a plain path like /healthz", path)
+	}
+	if site.BackendHealth == path {
+		return nil
+	}
+
+	if err := a.st.SetSiteBackendHealth(domain, path); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteBackendHealth(domain, site.BackendHealth); rerr != nil {
+			return fmt.Errorf("backend health apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("backend health apply failed (previous setting kept): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/util"
+)
+
+// SiteBackup is a saved vhost of a site with how it relates to what is live.
+type SiteBackup struct {
+	nginx.SiteBackup
+	Live    bool // same content as the live vhost
+	Applied bool // same content as the last successful apply (the site's render hash)
+}
+
+// SiteBackups lists the vhost backups of domain, newest first; a rollback restores
+// the newest valid one that differs from the vhost being rolled back.
+func (a *App) SiteBackups(domain string) ([]SiteBackup, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	s, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	list, err := a.ng.ListSiteBackups(domain)
+	if err != nil {
+		return nil, err
+	}
+	live := ""
+	if data := a.liveConf(domain); data != nil {
+		live = util.Sha256Hex(data)
+	}
+	applied := ""
+	if s.LastApplyStatus == "ok" {
+		applied = s.LastRenderHash
+	}
+	out := make([]SiteBackup, 0, len(list))
+	for _, b := range list {
+		out = append(out, SiteBackup{
+			SiteBackup: b,
+			Live:       b.Hash == live,
+			Applied:    applied != "" && b.RenderHash == applied,
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mynginx/internal/notify"
+)
+
+// CertFallbackEvent is posted as JSON to every certs.fallback.webhooks URL.
+type CertFallbackEvent struct {
+	Type       string    `json:"event"` // "fallback" (issued by the fallback CA) | "fallback_failed"
+	Domain     string    `json:"domain"`
+	CA         string    `json:"ca"`
+	Failures   int       `json:"failures"` // consecutive failed renewals before the fallback
+	RenewError string    `json:"renew_error"`
+	Error      string    `json:"error,omitempty"`
+	NotAfter   time.Time `json:"not_after"` // of the certificate in use after the attempt
+}
+
+// certRenewed clears the failure streak of domain after a successful renewal.
+func (a *App) certRenewed(domain string) {
+	if a.cfg.Certs.Fallback.CA == "" {
+		return
+	}
+	if err := a.st.ResetCertRenewFailures(domain); err != nil {
+		log.Printf("cert fallback %s: %v", domain, err)
+	}
+}
+
+// certRenewFailed records a failed renewal of domain and, once certs.fallback allows
+// it, issues the certificate from the fallback CA. It reports whether that worked
+// (the caller then treats the renewal as done). The caller holds the cluster lock.
+func (a *App) certRenewFailed(ctx context.Context, domain string, renewErr error) bool {
+	fb := a.cfg.Certs.Fallback
+	if fb.CA == "" {
+		return false
+	}
+	n, err := a.st.RecordCertRenewFailure(domain, renewErr.Error())
+	if err != nil {
+		log.Printf("cert fallback %s: %v", domain, err)
+		return false
+	}
+	if n < fb.AfterFailures {
+		return false
+	}
+	ci, err := a.certMgr().GetCertInfo(domain)
+	if err != nil || !ci.Exists || ci.DaysLeft > fb.WithinDays {
+		return false
+	}
+	ca, ok := a.cfg.Certs.ACMECA(fb.CA)
+	if !ok {
+		return false
+	}
+	m, err := a.certMgrFor(domain)
+	if err != nil {
+		log.Printf("cert fallback %s: %v", domain, err)
+		return false
+	}
+	if m.LineageServer(domain) == ca.Directory {
+		// already issued by the fallback CA: nothing left to fall back to
+		return false
+	}
+	m.Server, m.EABKID, m.EABHMACKey = ca.Directory, ca.EABKID, ca.EABHMACKey
+
+	ev := CertFallbackEvent{Domain: domain, CA: fb.CA, Failures: n, RenewError: renewErr.Error(), NotAfter: ci.NotAfter}
+	err = m.IssueCert(ctx, domain)
+	if err == nil {
+		if s, serr := a.st.GetSiteByDomain(domain); serr == nil && s.DualCert {
+			if aerr := m.IssueAltCert(ctx, domain); aerr != nil {
+				log.Printf("cert fallback %s: alternate certificate: %v", domain, aerr)
+			}
+		}
+	}
+	if err != nil {
+		ev.Type, ev.Error = "fallback_failed", err.Error()
+		a.event("error", "certs", "%s: renewal failed %d times and issuing from fallback CA %s failed too: %v (expires %s)",
+			domain, n, fb.CA, err, ci.NotAfter.Format("2006-01-02"))
+		a.notifyCertFallback(ctx, ev)
+		return false
+	}
+
+	if now, err := a.certMgr().GetCertInfo(domain); err == nil && now.Exists {
+		ev.NotAfter = now.NotAfter
+	}
+	ev.Type = "fallback"
+	a.certRenewed(domain)
+	a.distributeCert(ctx, domain)
+	a.event("warning", "certs", "%s: renewal failed %d times; certificate issued by fallback CA %s instead", domain, n, fb.CA)
+	a.notifyCertFallback(ctx, ev)
+	return true
+}
+
+func (a *App) notifyCertFallback(ctx context.Context, ev CertFallbackEvent) {
+	fb := a.cfg.Certs.Fallback
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for _, url := range fb.Webhooks {
+		if err := notify.PostJSON(ctx, url, ev, nil); err != nil {
+			log.Printf("cert fallback: webhook: %v", err)
+		}
+	}
+	mailer := a.mailer
+	if !mailer.Enabled() {
+		return
+	}
+	subject, body := certFallbackMail(ev)
+	for _, rcpt := range fb.NotifyEmails {
+		if err := mailer.Send(rcpt, subject, body); err != nil {
+			log.Printf("cert fallback: mail %s: %v", rcpt, err)
+		}
+	}
+}
+
+func certFallbackMail(ev CertFallbackEvent) (string, string) {
+	if ev.Type == "fallback_failed" {
+		return fmt.Sprintf("[CERT] %s: renewal and fallback CA both failed", ev.Domain),
+			fmt.Sprintf("Renewing the certificate of %s failed %d times in a row:\n\n  %s\n\n"+
+				"Issuing it from the fallback CA %s failed as well:\n\n  %s\n\n"+
+				"The current certificate expires %s. Check `ngm cert info --domain %s`.\n",
+				ev.Domain, ev.Failures, ev.RenewError, ev.CA, ev.Error, ev.NotAfter.Format(time.RFC1123), ev.Domain)
+	}
+	return fmt.Sprintf("[CERT] %s now uses fallback CA %s", ev.Domain, ev.CA),
+		fmt.Sprintf("Renewing the certificate of %s failed %d times in a row:\n\n  %s\n\n"+
+			"It was issued by the fallback CA %s instead and is valid until %s.\n"+
+			"Renewals stay with %s; `ngm cert issue --domain %s` moves it back to\n"+
+			"the site's CA once that works again.\n",
+			ev.Domain, ev.Failures, ev.RenewError, ev.CA, ev.NotAfter.Format(time.RFC1123), ev.CA, ev.Domain)
+}
+
+// renewAllFallback settles the failure streaks after `certbot renew` (renewErr is its
+// error, if any). certbot does not say which lineage failed, so a Let's Encrypt site
+// whose certificate is still inside the 30-day renewal window counts as failed.
+func (a *App) renewAllFallback(ctx context.Context, renewErr error) error {
+	if a.cfg.Certs.Fallback.CA == "" {
+		return renewErr
+	}
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	m := a.certMgr()
+	var failed []string
+	recovered := 0
+	for _, s := range sites {
+		if certSource(s) != CertSourceLetsEncrypt {
+			continue
+		}
+		ci, err := m.GetCertInfo(s.Domain)
+		if err != nil || !ci.Exists {
+			continue
+		}
+		if renewErr == nil || ci.DaysLeft > 30 {
+			a.certRenewed(s.Domain)
+			continue
+		}
+		if a.certRenewFailed(ctx, s.Domain, renewErr) {
+			recovered++
+		} else {
+			failed = append(failed, s.Domain)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w (not renewed: %s)", renewErr, strings.Join(failed, ", "))
+	}
+	if renewErr != nil && recovered == 0 {
+		return renewErr
+	}
+	return nil
+}
@@ -1,52 +1,173 @@
 package app
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"mynginx/internal/certs"
+	"mynginx/internal/cluster"
+	"mynginx/internal/util"
 )
 
 func (a *App) certMgr() *certs.CertbotManager {
-	return certs.NewCertbotManager(
+	m := certs.NewCertbotManager(
 		a.paths.CertbotBin,
 		a.paths.ACMEWebroot,
 		a.paths.LetsEncryptLive,
 		a.cfg.Certs.Email,
 	)
+	m.Runner = a.run
+	m.IssueTimeout = a.timeouts.CertbotIssue
+	m.RenewTimeout = a.timeouts.CertbotRenew
+	return m
 }
 
+// CertList lists the live-dir certificates plus those of path/remote sites.
 func (a *App) CertList() ([]*certs.CertInfo, error) {
-	return a.certMgr().ListCerts()
+	list, err := a.certMgr().ListCerts()
+	if err != nil {
+		return nil, err
+	}
+	return a.withSiteCerts(list)
 }
 
 
+// CertInfo describes the certificate of domain, wherever its site keeps it.
 func (a *App) CertInfo(domain string) (*certs.CertInfo, error) {
+	if s, err := a.st.GetSiteByDomain(domain); err == nil {
+		return a.siteCertInfo(s)
+	}
 	return a.certMgr().GetCertInfo(domain)
 }
 
 
+// CertAltInfo returns the alternate-key certificate of a dual-cert site (nil if none).
+func (a *App) CertAltInfo(domain string) (*certs.CertInfo, error) {
+	return a.certMgr().GetAltCertInfo(domain)
+}
+
+
+// CertChallengeTest places a token in the ACME webroot and fetches it through the
+// public URL of a site, reporting what Let's Encrypt would get from each address.
+func (a *App) CertChallengeTest(ctx context.Context, domain string) (certs.ChallengeReport, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if _, err := a.st.GetSiteByDomain(domain); err != nil {
+		return certs.ChallengeReport{Domain: domain}, fmt.Errorf("get site: %w", err)
+	}
+	return certs.TestHTTP01(ctx, domain, a.paths.ACMEWebroot)
+}
+
 func (a *App) CertIssue(ctx context.Context, domain string, applyAfter bool) error {
-	m := a.certMgr()
+	release, err := a.cluster.Lock(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := a.requireLetsEncrypt(domain); err != nil {
+		return err
+	}
+	m, err := a.certMgrFor(domain)
+	if err != nil {
+		return err
+	}
+	if m.DNSAuthHook == "" && !a.cfg.Certs.SkipReachabilityCheck {
+		// a failing HTTP-01 run still counts against Let's Encrypt's failed-validation limit
+		if err := certs.CheckHTTP01(ctx, domain, a.paths.ACMEWebroot); err != nil {
+			a.event("warning", "certs", "%s: certificate issuance skipped: %v", domain, err)
+			return fmt.Errorf("issuance skipped, HTTP-01 validation would fail: %w (set certs.skip_reachability_check to issue anyway)", err)
+		}
+	}
 	if err := m.IssueCert(ctx, domain); err != nil {
 		return err
 	}
+	if s, err := a.st.GetSiteByDomain(domain); err == nil && s.DualCert {
+		if err := m.IssueAltCert(ctx, domain); err != nil {
+			return fmt.Errorf("issue alternate certificate: %w", err)
+		}
+	}
+	a.distributeCert(ctx, domain)
 	if applyAfter {
-		_, err := a.Apply(context.Background(), ApplyRequest{Domain: domain})
+		return a.applyLineage(context.Background(), domain)
+	}
+	return nil
+}
+
+// CertRevoke revokes the certificate of domain at its CA (reason: one of
+// certs.RevokeReasons, "" = unspecified). The files stay in place until CertIssue
+// replaces them, so nginx keeps starting; browsers checking revocation will reject it.
+func (a *App) CertRevoke(ctx context.Context, domain, reason string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return invalidf("domain is required")
+	}
+	if reason != "" && !slices.Contains(certs.RevokeReasons, reason) {
+		return invalidf("reason must be one of %s", strings.Join(certs.RevokeReasons, ", "))
+	}
+	release, err := a.cluster.Lock(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if err := a.requireLetsEncrypt(domain); err != nil {
+		return err
+	}
+	if err := a.certMgr().RevokeCert(ctx, domain, reason); err != nil {
 		return err
 	}
+	a.event("warning", "certs", "%s: certificate revoked (%s); issue a new one to replace it", domain, cmp.Or(reason, "unspecified"))
 	return nil
 }
 
 func (a *App) CertRenew(ctx context.Context, domain string, all bool, applyAfter bool) error {
 	m := a.certMgr()
 	if all || domain == "" {
-		if err := m.RenewAll(ctx); err != nil {
+		release, err := a.cluster.Lock(ctx, renewAllLockKey)
+		if err != nil {
+			return err
+		}
+		defer release()
+		renewErr := m.RenewAll(ctx)
+		if renewErr != nil && a.cfg.Certs.Fallback.CA == "" {
+			return renewErr
+		}
+		if list, err := m.ListCerts(); err == nil {
+			for _, ci := range list {
+				a.distributeCert(ctx, ci.Domain)
+			}
+		}
+		if err := a.renewAllFallback(ctx, renewErr); err != nil {
 			return err
 		}
 	} else {
-		if err := m.RenewCert(ctx, domain); err != nil {
+		release, err := a.cluster.Lock(ctx, domain)
+		if err != nil {
 			return err
 		}
+		defer release()
+		if err := a.requireLetsEncrypt(domain); err != nil {
+			return err
+		}
+		if err := m.RenewCert(ctx, domain); err != nil {
+			if !a.certRenewFailed(ctx, domain, err) {
+				return err
+			}
+		} else {
+			a.certRenewed(domain)
+			a.distributeCert(ctx, domain)
+		}
+		if applyAfter {
+			return a.applyLineage(context.Background(), domain)
+		}
+		return nil
 	}
 	if applyAfter {
 		_, err := a.Apply(context.Background(), ApplyRequest{All: true})
@@ -56,6 +177,95 @@ func (a *App) CertRenew(ctx context.Context, domain string, all bool, applyAfter
 }
 
 
+// CertCheck returns the certificates of CertList expiring within days.
 func (a *App) CertCheck(days int) ([]*certs.CertInfo, error) {
-	return a.certMgr().CheckExpiringSoon(days)
+	list, err := a.CertList()
+	if err != nil {
+		return nil, err
+	}
+	var expiring []*certs.CertInfo
+	for _, ci := range list {
+		if ci.DaysLeft <= days {
+			expiring = append(expiring, ci)
+		}
+	}
+	return expiring, nil
+}
+
+// renewAllLockKey serializes "renew all" runs across the cluster (certbot renews every lineage).
+const renewAllLockKey = "*renew-all*"
+
+// distributeCert pushes the local certificate for domain to all cluster peers (best-effort).
+// Alternate-key certificates stay local; peers render them once they issue their own.
+// Certificates of path/remote sites are not this node's to distribute.
+func (a *App) distributeCert(ctx context.Context, domain string) {
+	if !a.cluster.Enabled() || a.requireLetsEncrypt(domain) != nil {
+		return
+	}
+	ci, err := a.certMgr().GetCertInfo(domain)
+	if err != nil || ci == nil || !ci.Exists {
+		return
+	}
+	full, err := os.ReadFile(ci.CertPath)
+	if err != nil {
+		log.Printf("cluster: read %s: %v", ci.CertPath, err)
+		return
+	}
+	key, err := os.ReadFile(ci.KeyPath)
+	if err != nil {
+		log.Printf("cluster: read %s: %v", ci.KeyPath, err)
+		return
+	}
+	for _, err := range a.cluster.PushCert(ctx, cluster.CertBundle{Domain: domain, Fullchain: full, PrivKey: key}) {
+		log.Printf("cluster: %v", err)
+	}
+}
+
+// CertInstall stores a certificate received from a peer under letsencrypt_live/<domain>/
+// (or the paths of a remote-source site) and reloads nginx if a site uses it.
+func (a *App) CertInstall(domain string, fullchain, privkey []byte) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" || strings.ContainsAny(domain, "/\\") || strings.HasPrefix(domain, ".") {
+		return invalidf("invalid domain %q", domain)
+	}
+	pair, err := tls.X509KeyPair(fullchain, privkey)
+	if err != nil {
+		return invalidf("invalid certificate/key pair: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse certificate: %w", err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return fmt.Errorf("certificate does not cover %s: %w", domain, err)
+	}
+
+	certPath := filepath.Join(a.paths.LetsEncryptLive, domain, "fullchain.pem")
+	keyPath := filepath.Join(a.paths.LetsEncryptLive, domain, "privkey.pem")
+	if s, err := a.st.GetSiteByDomain(domain); err == nil && certSource(s) == CertSourceRemote {
+		certPath, keyPath = a.siteCertPaths(s)
+	}
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err := util.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	if err := util.WriteFileAtomic(certPath, fullchain, 0o644); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(keyPath, privkey, 0o600); err != nil {
+		return err
+	}
+
+	// nginx only picks up new cert files on reload (sites sharing the lineage included)
+	sharing, _ := a.lineageSites(domain)
+	if s, err := a.st.GetSiteByDomain(domain); err == nil && s.Enabled || len(sharing) > 0 {
+		if err := a.ng.TestConfig(); err != nil {
+			return fmt.Errorf("nginx test after cert install: %w", err)
+		}
+		if err := a.ng.Reload(); err != nil {
+			return fmt.Errorf("nginx reload: %w", err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,302 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/store"
+)
+
+// Certificate sources of a site (store.Site.CertSource).
+const (
+	CertSourceLetsEncrypt = "letsencrypt" // issued and renewed here by certbot
+	CertSourcePath        = "path"        // files maintained outside ngm, at tls_cert_path/tls_key_path
+	CertSourceRemote      = "remote"      // synced from another node; never issued here
+	CertSourceShared      = "shared"      // another Let's Encrypt lineage (e.g. a wildcard), renewed with it
+)
+
+func certSource(s store.Site) string {
+	if s.CertSource == "" {
+		return CertSourceLetsEncrypt
+	}
+	return s.CertSource
+}
+
+// siteCertPaths is where the site's certificate and key are expected: the
+// Let's Encrypt live dir (of the shared lineage, for the shared source) unless
+// the source is path/remote with explicit paths.
+func (a *App) siteCertPaths(s store.Site) (cert, key string) {
+	src := certSource(s)
+	if src == CertSourceShared {
+		return a.lineagePaths(s.CertLineage)
+	}
+	if src != CertSourceLetsEncrypt && s.TLSCertPath != "" {
+		return s.TLSCertPath, s.TLSKeyPath
+	}
+	return a.lineagePaths(s.Domain)
+}
+
+// lineagePaths is where certbot keeps the certificate and key of a lineage.
+func (a *App) lineagePaths(lineage string) (cert, key string) {
+	return filepath.Join(a.paths.LetsEncryptLive, lineage, "fullchain.pem"),
+		filepath.Join(a.paths.LetsEncryptLive, lineage, "privkey.pem")
+}
+
+// siteCertInfo reads the certificate a site is served with (before any self-signed fallback).
+func (a *App) siteCertInfo(s store.Site) (*certs.CertInfo, error) {
+	src := certSource(s)
+	switch src {
+	case CertSourceLetsEncrypt:
+		return a.certMgr().GetCertInfo(s.Domain)
+	case CertSourceShared:
+		ci, err := a.certMgr().GetCertInfo(s.CertLineage)
+		if ci != nil {
+			ci.Source = src
+		}
+		return ci, err
+	}
+	cert, key := a.siteCertPaths(s)
+	ci, err := certs.CertInfoFromPath(s.Domain, cert, key)
+	if ci != nil {
+		ci.Source = src
+	}
+	return ci, err
+}
+
+// SiteCertSource sets where a site's certificate comes from:
+//
+//	letsencrypt  issued and renewed here by certbot (the default)
+//	path         cert/key files at the given paths, kept current by something else
+//	remote       pushed by a peer node (or synced) into letsencrypt_live/<domain>/,
+//	             or to the given paths; served self-signed until it arrives
+//	shared       the Let's Encrypt lineage named by lineage, which must cover the
+//	             domain (a wildcard or multi-domain certificate of another name)
+//
+// ngm never issues or renews path/remote certificates; a shared one is issued and
+// renewed as its lineage. Enabled sites are re-applied, and the previous source is
+// restored if that fails.
+func (a *App) SiteCertSource(ctx context.Context, domain, source, certPath, keyPath, lineage string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	source = strings.ToLower(strings.TrimSpace(source))
+	certPath = strings.TrimSpace(certPath)
+	keyPath = strings.TrimSpace(keyPath)
+	lineage = strings.ToLower(strings.TrimSpace(lineage))
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+
+	if source != CertSourceShared && lineage != "" {
+		return invalidf("a lineage only applies to the shared source")
+	}
+	switch source {
+	case CertSourceLetsEncrypt:
+		if certPath != "" || keyPath != "" {
+			return invalidf("cert and key paths only apply to the path and remote sources")
+		}
+	case CertSourceShared:
+		if certPath != "" || keyPath != "" {
+			return invalidf("cert and key paths only apply to the path and remote sources")
+		}
+		if err := a.checkSharedLineage(domain, lineage); err != nil {
+			return err
+		}
+		if site.DualCert {
+			return invalidf("%s has dual certificates; turn them off before using the %s source", domain, source)
+		}
+	case CertSourcePath, CertSourceRemote:
+		if (certPath == "") != (keyPath == "") {
+			return invalidf("cert and key paths must be given together")
+		}
+		if source == CertSourcePath && certPath == "" {
+			return invalidf("the path source needs --cert and --key")
+		}
+		for _, p := range []string{certPath, keyPath} {
+			if p != "" && !filepath.IsAbs(p) {
+				return invalidf("%s: path must be absolute", p)
+			}
+		}
+		// a remote certificate may not have arrived yet; one on disk must be usable
+		if source == CertSourcePath || certPath != "" && fileExists(certPath) {
+			if err := checkCertPair(domain, certPath, keyPath); err != nil {
+				return err
+			}
+		}
+		if site.DualCert {
+			return invalidf("%s has dual certificates; turn them off before using the %s source", domain, source)
+		}
+	default:
+		return invalidf("cert source must be letsencrypt, path, remote or shared")
+	}
+
+	if certSource(site) == source && site.TLSCertPath == certPath && site.TLSKeyPath == keyPath && site.CertLineage == lineage {
+		return nil
+	}
+	if source != CertSourceLetsEncrypt {
+		if sharers, err := a.certSharers(domain); err != nil {
+			return err
+		} else if len(sharers) > 0 {
+			return invalidf("%s shares its certificate with %s; move them to another source first", domain, strings.Join(sharers, ", "))
+		}
+	}
+	if err := a.st.SetSiteCertSource(domain, source, certPath, keyPath, lineage); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteCertSource(domain, site.CertSource, site.TLSCertPath, site.TLSKeyPath, site.CertLineage); rerr != nil {
+			return fmt.Errorf("cert source apply failed: %v (restoring previous source also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("cert source apply failed (previous source kept): %w", err)
+	}
+	return nil
+}
+
+// checkSharedLineage verifies that lineage is a Let's Encrypt lineage on this node
+// whose certificate covers domain (the wildcard *.example.com covers
+// shop.example.com, not example.com or a.b.example.com).
+func (a *App) checkSharedLineage(domain, lineage string) error {
+	if lineage == "" {
+		return invalidf("the shared source needs --lineage (the certificate name in the Let's Encrypt live dir)")
+	}
+	if lineage == domain {
+		return invalidf("%s cannot share its own lineage; use the letsencrypt source", domain)
+	}
+	if strings.ContainsAny(lineage, `/\`) || lineage == "." || lineage == ".." {
+		return invalidf("invalid lineage %q", lineage)
+	}
+	if s, err := a.st.GetSiteByDomain(lineage); err == nil && certSource(s) != CertSourceLetsEncrypt {
+		return invalidf("%s uses the %s certificate source; only Let's Encrypt lineages can be shared", lineage, certSource(s))
+	}
+	cert, key := a.lineagePaths(lineage)
+	if !fileExists(cert) || !fileExists(key) {
+		return invalidf("no certificate for lineage %s yet; issue it first (ngm cert issue --domain %s)", lineage, lineage)
+	}
+	return checkCertPair(domain, cert, key)
+}
+
+// lineageSites returns the enabled sites served from lineage: the site of that
+// name (if any) and every site sharing it.
+func (a *App) lineageSites(lineage string) ([]string, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, s := range sites {
+		if !s.Enabled {
+			continue
+		}
+		if s.Domain == lineage && certSource(s) == CertSourceLetsEncrypt ||
+			certSource(s) == CertSourceShared && s.CertLineage == lineage {
+			out = append(out, s.Domain)
+		}
+	}
+	return out, nil
+}
+
+// certSharers returns the sites (enabled or not) using lineage with the shared source.
+func (a *App) certSharers(lineage string) ([]string, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, s := range sites {
+		if certSource(s) == CertSourceShared && s.CertLineage == lineage {
+			out = append(out, s.Domain)
+		}
+	}
+	return out, nil
+}
+
+// applyLineage re-applies the sites served from lineage after it was issued or
+// renewed, so that sites still on the self-signed fallback pick it up.
+func (a *App) applyLineage(ctx context.Context, lineage string) error {
+	domains, err := a.lineageSites(lineage)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, d := range domains {
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: d}); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkCertPair verifies that cert/key load as a pair covering domain.
+func checkCertPair(domain, certPath, keyPath string) error {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return invalidf("invalid certificate/key pair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return invalidf("parse certificate: %v", err)
+	}
+	if err := leaf.VerifyHostname(domain); err != nil {
+		return invalidf("certificate does not cover %s: %v", domain, err)
+	}
+	return nil
+}
+
+// withSiteCerts merges the certificates of path/remote sites into a live-dir
+// listing, replacing any stale live-dir copy of theirs.
+func (a *App) withSiteCerts(list []*certs.CertInfo) ([]*certs.CertInfo, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	own := map[string]store.Site{}
+	for _, s := range sites {
+		// a shared certificate is already listed as its lineage
+		if src := certSource(s); src != CertSourceLetsEncrypt && src != CertSourceShared {
+			own[s.Domain] = s
+		}
+	}
+	if len(own) == 0 {
+		return list, nil
+	}
+
+	out := list[:0]
+	for _, ci := range list {
+		if _, ok := own[ci.Lineage]; !ok {
+			out = append(out, ci)
+		}
+	}
+	for _, s := range own {
+		if ci, err := a.siteCertInfo(s); err == nil && ci.Exists {
+			out = append(out, ci)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out, nil
+}
+
+// requireLetsEncrypt refuses certbot operations on sites whose certificate comes from elsewhere.
+func (a *App) requireLetsEncrypt(domain string) error {
+	s, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil // not a site: certbot-only lineage
+	}
+	switch src := certSource(s); src {
+	case CertSourceLetsEncrypt:
+	case CertSourceShared:
+		return invalidf("%s shares the certificate of %s; issue or renew that lineage instead", domain, s.CertLineage)
+	default:
+		return invalidf("%s uses the %s certificate source; ngm does not issue or renew it", domain, src)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/config"
+	"mynginx/internal/util"
+)
+
+// ConfigCheck is one line of a config validation report.
+type ConfigCheck struct {
+	Section string `json:"section"`
+	Item    string `json:"item"`
+	Level   string `json:"level"` // ok | warn | error
+	Message string `json:"message"`
+}
+
+// ConfigReport is the result of CheckConfig.
+type ConfigReport struct {
+	Path     string        `json:"path"`
+	Checks   []ConfigCheck `json:"checks"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+}
+
+func (r *ConfigReport) add(level, section, item, format string, args ...any) {
+	r.Checks = append(r.Checks, ConfigCheck{Section: section, Item: item, Level: level, Message: fmt.Sprintf(format, args...)})
+	switch level {
+	case "error":
+		r.Errors++
+	case "warn":
+		r.Warnings++
+	}
+}
+
+// Err is nil when the config passed; strict fails it on warnings too.
+func (r ConfigReport) Err(strict bool) error {
+	if r.Errors > 0 || strict && r.Warnings > 0 {
+		return invalidf("config validation failed: %d error(s), %d warning(s)", r.Errors, r.Warnings)
+	}
+	return nil
+}
+
+// CheckConfig validates cfg against the system it is meant to run on: the keys and
+// values (config.Problems), then the binaries ngm runs, the directories it writes
+// to and the PHP-FPM services of phpfpm.versions. Nothing is created or changed.
+func CheckConfig(ctx context.Context, cfg *config.Config, run util.Runner) ConfigReport {
+	r := ConfigReport{Path: cfg.Path}
+	paths := cfg.ResolvePaths()
+
+	problems := cfg.Problems()
+	for _, p := range problems {
+		r.add("error", "config", "", "%s", p)
+	}
+	if len(problems) == 0 {
+		r.add("ok", "config", "", "keys and values are valid")
+	}
+
+	// binaries
+	sandboxed := cfg.Sandbox != ""
+	for _, b := range []struct {
+		item, path, level string
+	}{
+		{"nginx.bin", paths.NginxBin, "error"},
+		{"certs.certbot_bin", paths.CertbotBin, "error"},
+		{"systemctl", "systemctl", "warn"},
+		{"useradd", "useradd", "warn"},
+	} {
+		switch p, err := exec.LookPath(b.path); {
+		case sandboxed:
+			r.add("ok", "binaries", b.item, "stubbed (sandbox)")
+		case err != nil:
+			r.add(b.level, "binaries", b.item, "%s: not found or not executable", b.path)
+		default:
+			r.add("ok", "binaries", b.item, "%s", p)
+		}
+	}
+
+	// nginx
+	if fi, err := os.Stat(paths.NginxMainConf); err != nil || fi.IsDir() {
+		r.add("error", "nginx", "nginx.main_conf", "%s: not a readable file", paths.NginxMainConf)
+	} else {
+		r.add("ok", "nginx", "nginx.main_conf", "%s", paths.NginxMainConf)
+	}
+	checkDir(&r, "nginx", "nginx.sites_dir", paths.NginxSitesDir, true)
+	checkDir(&r, "nginx", "nginx.apply.staging_dir", paths.NginxStageDir, true)
+	checkDir(&r, "nginx", "nginx.apply.backup_dir", paths.NginxBackupDir, true)
+	checkDir(&r, "nginx", "global.dir", paths.NginxGlobalDir, true)
+
+	// certs
+	checkDir(&r, "certs", "certs.webroot", paths.ACMEWebroot, false)
+	if _, err := os.Stat(paths.LetsEncryptLive); err != nil {
+		r.add("warn", "certs", "certs.letsencrypt_live", "%s: missing (no certificate issued yet?)", paths.LetsEncryptLive)
+	} else {
+		r.add("ok", "certs", "certs.letsencrypt_live", "%s", paths.LetsEncryptLive)
+	}
+
+	// storage / hosting
+	if cfg.Storage.SQLitePath != "" {
+		checkDir(&r, "storage", "storage.sqlite_path", filepath.Dir(cfg.Storage.SQLitePath), false)
+	}
+	if fi, err := os.Stat(cfg.Hosting.HomeRoot); err != nil || !fi.IsDir() {
+		r.add("warn", "hosting", "hosting.home_root", "%s: not a directory", cfg.Hosting.HomeRoot)
+	} else {
+		r.add("ok", "hosting", "hosting.home_root", "%s", cfg.Hosting.HomeRoot)
+	}
+
+	// php-fpm
+	versions := make([]string, 0, len(cfg.PHPFPM.Versions))
+	for v := range cfg.PHPFPM.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	_, noSystemctl := exec.LookPath("systemctl")
+	for _, ver := range versions {
+		v := cfg.PHPFPM.Versions[ver]
+		item := "phpfpm.versions[" + ver + "]"
+		checkDir(&r, "phpfpm", item+".pools_dir", v.PoolsDir, false)
+		if _, err := os.Stat(v.SockDir); err != nil {
+			r.add("warn", "phpfpm", item+".sock_dir", "%s: missing (created when %s starts)", v.SockDir, v.Service)
+		} else {
+			r.add("ok", "phpfpm", item+".sock_dir", "%s", v.SockDir)
+		}
+		switch {
+		case sandboxed:
+			r.add("ok", "phpfpm", item+".service", "%s: stubbed (sandbox)", v.Service)
+		case noSystemctl != nil:
+			r.add("warn", "phpfpm", item+".service", "%s: not checked (no systemctl)", v.Service)
+		default:
+			level, msg := checkService(ctx, cfg, run, v.Service)
+			r.add(level, "phpfpm", item+".service", "%s", msg)
+		}
+	}
+	return r
+}
+
+// checkDir reports whether ngm can write to dir. Directories ngm creates itself
+// (create) are only a warning while missing, if their parent is writable.
+func checkDir(r *ConfigReport, section, item, dir string, create bool) {
+	if dir == "" {
+		return
+	}
+	fi, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && create:
+		if werr := writable(nearestDir(dir)); werr != nil {
+			r.add("error", section, item, "%s: missing and cannot be created: %v", dir, werr)
+		} else {
+			r.add("warn", section, item, "%s: missing (created on first use)", dir)
+		}
+	case err != nil:
+		r.add("error", section, item, "%s: %v", dir, err)
+	case !fi.IsDir():
+		r.add("error", section, item, "%s: not a directory", dir)
+	default:
+		if werr := writable(dir); werr != nil {
+			r.add("error", section, item, "%s: not writable: %v", dir, werr)
+		} else {
+			r.add("ok", section, item, "%s", dir)
+		}
+	}
+}
+
+// writable creates and removes a probe file in dir.
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".ngm-check-*")
+	if err != nil {
+		return errors.Unwrap(err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func nearestDir(p string) string {
+	for {
+		parent := filepath.Dir(p)
+		if fi, err := os.Stat(parent); err == nil && fi.IsDir() || parent == p {
+			return parent
+		}
+		p = parent
+	}
+}
+
+// checkService reports whether a systemd unit is installed (error if not) and
+// running (warning if not).
+func checkService(ctx context.Context, cfg *config.Config, run util.Runner, service string) (level, msg string) {
+	timeout := cfg.Timeouts.Durations().Systemctl
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := run.Run(ctx, "systemctl", "show", "-p", "LoadState", "--value", service)
+	if err != nil {
+		return "warn", fmt.Sprintf("%s: systemctl show: %v", service, err)
+	}
+	if state := strings.TrimSpace(res.Stdout); state == "not-found" {
+		return "error", fmt.Sprintf("%s: service is not installed", service)
+	}
+	if _, err := run.Run(ctx, "systemctl", "is-active", "--quiet", service); err != nil {
+		return "warn", fmt.Sprintf("%s: installed but not running", service)
+	}
+	return "ok", fmt.Sprintf("%s: running", service)
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec is a parsed five-field cron expression (minute hour day-of-month month
+// day-of-week), each field a bit set of the values it matches.
+type cronSpec struct {
+	min, hour, dom, month, dow uint64
+	// domAny/dowAny: with both day fields restricted, either may match (as in cron)
+	domAny, dowAny bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// parseCron parses "*/15 * * * *", "0 3 * * 1-5", "@hourly" and the like. Fields
+// take *, N, A-B, lists and /STEP; day-of-week is 0-7 (0 and 7 are Sunday).
+func parseCron(expr string) (cronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return cronSpec{}, invalidf("cron expression %q: want 5 fields (minute hour day month weekday)", expr)
+	}
+	var c cronSpec
+	var err error
+	if c.min, err = cronField(f[0], 0, 59); err != nil {
+		return cronSpec{}, invalidf("cron minute %q: %v", f[0], err)
+	}
+	if c.hour, err = cronField(f[1], 0, 23); err != nil {
+		return cronSpec{}, invalidf("cron hour %q: %v", f[1], err)
+	}
+	if c.dom, err = cronField(f[2], 1, 31); err != nil {
+		return cronSpec{}, invalidf("cron day of month %q: %v", f[2], err)
+	}
+	if c.month, err = cronField(f[3], 1, 12); err != nil {
+		return cronSpec{}, invalidf("cron month %q: %v", f[3], err)
+	}
+	if c.dow, err = cronField(f[4], 0, 7); err != nil {
+		return cronSpec{}, invalidf("cron weekday %q: %v", f[4], err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = f[2] == "*", f[4] == "*"
+	return c, nil
+}
+
+func cronField(s string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, invalidf("bad step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, invalidf("bad value %q", a)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, invalidf("bad value %q", b)
+				}
+			} else if step > 1 {
+				to = hi // "5/10" = from 5 every 10
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, invalidf("%q is outside %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// match reports whether t (to the minute) is on the schedule.
+func (c cronSpec) match(t time.Time) bool {
+	if c.min&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
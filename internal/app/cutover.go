@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mynginx/internal/nginx"
+)
+
+var groupNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// validGroupName reports whether g can name a target group ("all" is reserved by the CLI).
+func validGroupName(g string) bool {
+	return g != "all" && groupNameRe.MatchString(g)
+}
+
+// activeGroupTargets keeps the enabled targets of group plus the ungrouped ones
+// (ungrouped targets are shared by every group).
+func activeGroupTargets(targets []nginx.UpstreamTarget, group string) []nginx.UpstreamTarget {
+	var out []nginx.UpstreamTarget
+	for _, t := range targets {
+		if !t.Enabled {
+			continue
+		}
+		if t.Group == "" || t.Group == group {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// SiteCutover switches a proxy site's upstream to the targets of group (blue/green).
+// Targets of the other groups stay in the database and keep running, so switching
+// back is just another cutover. An empty group renders every enabled target again.
+// If the site is enabled the change is applied right away; a failed apply restores
+// the previous group.
+func (a *App) SiteCutover(ctx context.Context, domain, group string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	group = strings.ToLower(strings.TrimSpace(group))
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "proxy" {
+		return fmt.Errorf("site is not in proxy mode")
+	}
+	if site.ActiveGroup == group {
+		return nil
+	}
+
+	if group != "" {
+		if !validGroupName(group) {
+			return invalidf("invalid target group %q", group)
+		}
+		targets, err := a.st.ListProxyTargetsBySiteID(site.ID)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, t := range targets {
+			if t.Enabled && t.Group == group {
+				n++
+			}
+		}
+		if n == 0 {
+			return fmt.Errorf("target group %q has no enabled targets on %s", group, domain)
+		}
+	}
+
+	prev := site.ActiveGroup
+	if err := a.st.SetSiteActiveGroup(domain, group); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteActiveGroup(domain, prev); rerr != nil {
+			return fmt.Errorf("cutover apply failed: %v (restoring group %q also failed: %v)", err, prev, rerr)
+		}
+		return fmt.Errorf("cutover apply failed (kept group %q): %w", prev, err)
+	}
+	return nil
+}
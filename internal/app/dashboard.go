@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+// dashboardFailures bounds the recent failures the dashboard lists.
+const dashboardFailures = 10
+
+// Dashboard is the one-glance overview of the panel: sites by state, certificates
+// running out, the last apply, nginx and what failed lately.
+type Dashboard struct {
+	Sites        SiteCounts
+	Expiring     []ExpiringCert // certificates of enabled sites ending within 30 days, soonest first
+	Expiring7    int            // of which within 7 days (or already expired)
+	LastApply    *store.ApplyRun
+	Nginx        NginxState
+	NginxVersion string
+	NginxStarted time.Time       // zero when unknown
+	FailedSites  []store.SiteRow // sites whose last apply failed
+	Failures     []store.Event   // error events of the last 24h, newest first
+}
+
+// SiteCounts is the number of sites in each state of the site list.
+type SiteCounts struct {
+	Total, OK, Pending, Error, Disabled int
+}
+
+// ExpiringCert is the certificate of a site with its days left (negative once
+// expired), from the certificate cache.
+type ExpiringCert struct {
+	Domain   string
+	NotAfter time.Time
+	DaysLeft int
+}
+
+// Dashboard gathers the overview. nginx problems (no binary, no pid file) leave
+// their fields empty rather than failing the page.
+func (a *App) Dashboard(ctx context.Context) (Dashboard, error) {
+	var d Dashboard
+	rows, err := a.st.ListSiteRows(store.SiteListOptions{})
+	if err != nil {
+		return d, err
+	}
+	now := time.Now()
+	for _, r := range rows {
+		d.Sites.Total++
+		switch r.State {
+		case "OK":
+			d.Sites.OK++
+		case "PENDING":
+			d.Sites.Pending++
+		case "ERROR":
+			d.Sites.Error++
+			d.FailedSites = append(d.FailedSites, r)
+		case "DISABLED":
+			d.Sites.Disabled++
+		}
+		if !r.Enabled || r.CertNotAfter == nil {
+			continue
+		}
+		left := int(r.CertNotAfter.Sub(now).Hours() / 24)
+		if left > 30 {
+			continue
+		}
+		d.Expiring = append(d.Expiring, ExpiringCert{Domain: r.Domain, NotAfter: *r.CertNotAfter, DaysLeft: left})
+		if left <= 7 {
+			d.Expiring7++
+		}
+	}
+	sort.Slice(d.Expiring, func(i, j int) bool { return d.Expiring[i].NotAfter.Before(d.Expiring[j].NotAfter) })
+
+	runs, err := a.st.ListApplyRuns(1)
+	if err != nil {
+		return d, err
+	}
+	if len(runs) > 0 {
+		d.LastApply = &runs[0]
+	}
+
+	if d.Nginx, err = a.NginxProbe(ctx); err != nil {
+		log.Printf("dashboard: nginx state: %v", err)
+	}
+	if pid, ok := nginx.MasterPID(a.paths.NginxPIDFile); ok {
+		d.NginxStarted, _ = nginx.ProcessStart(pid)
+	}
+	if d.NginxVersion, err = a.ng.Version(); err != nil {
+		log.Printf("dashboard: %v", err)
+	}
+
+	events, err := a.st.ListEvents("", 200)
+	if err != nil {
+		return d, err
+	}
+	for _, e := range events {
+		if e.Level == "error" && now.Sub(e.CreatedAt) < 24*time.Hour && len(d.Failures) < dashboardFailures {
+			d.Failures = append(d.Failures, e)
+		}
+	}
+	return d, nil
+}
+
+// NginxUptime is how long the nginx master has been running (0 when unknown).
+func (d Dashboard) NginxUptime() time.Duration {
+	if d.NginxStarted.IsZero() || !d.Nginx.Running {
+		return 0
+	}
+	return time.Since(d.NginxStarted).Round(time.Minute)
+}
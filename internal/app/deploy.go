@@ -0,0 +1,354 @@
+package app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/store"
+	"mynginx/internal/users"
+	"mynginx/internal/util"
+)
+
+// deployTimeout bounds one deploy (fetch, checkout, permissions).
+const deployTimeout = 10 * time.Minute
+
+// DeployHookPath is the webhook endpoint of a site (fmt pattern of the domain).
+const DeployHookPath = "/api/v1/sites/%s/deploy"
+
+// ErrDeployDenied is returned by DeployWebhook for an unknown site, a site without
+// a git deploy, or a delivery whose signature or token does not match.
+var ErrDeployDenied = errors.New("deploy webhook denied")
+
+var deployBranchRe = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,200}$`)
+
+// deployLocks serializes the deploys of each site (domain -> *sync.Mutex); a push
+// that arrives during a deploy is deployed after it.
+var deployLocks sync.Map
+
+// DeployHook is a webhook delivery as received: the raw body and the headers that
+// authenticate it.
+type DeployHook struct {
+	Event     string // X-GitHub-Event or X-Gitlab-Event
+	Signature string // X-Hub-Signature-256: "sha256=" + HMAC-SHA256 of Body (GitHub)
+	Token     string // X-Gitlab-Token: the secret itself (GitLab)
+	Body      []byte
+}
+
+// SiteDeploySet makes the webroot of domain a checkout of branch of repo. A new
+// setup gets a random webhook secret; an existing one keeps its secret.
+func (a *App) SiteDeploySet(domain, repo, branch string) (store.SiteDeploy, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	repo = strings.TrimSpace(repo)
+	branch = strings.TrimSpace(branch)
+	if branch == "" {
+		branch = "main"
+	}
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return store.SiteDeploy{}, fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode == "proxy" || site.Mode == "redirect" {
+		return store.SiteDeploy{}, invalidf("%s is a %s site; only php and static sites serve a webroot", domain, site.Mode)
+	}
+	if err := validDeployRepo(repo); err != nil {
+		return store.SiteDeploy{}, err
+	}
+	if !deployBranchRe.MatchString(branch) || strings.HasPrefix(branch, "-") || strings.Contains(branch, "..") {
+		return store.SiteDeploy{}, invalidf("invalid branch %q", branch)
+	}
+
+	d, err := a.st.GetSiteDeploy(domain)
+	if err != nil || d.Secret == "" {
+		if d.Secret, err = newDeploySecret(); err != nil {
+			return store.SiteDeploy{}, err
+		}
+	}
+	d.Domain, d.Repo, d.Branch = domain, repo, branch
+	if err := a.st.SaveSiteDeploy(d); err != nil {
+		return store.SiteDeploy{}, err
+	}
+	a.event("info", "deploy", "%s: git deploy of %s (%s)", domain, repo, branch)
+	return a.st.GetSiteDeploy(domain)
+}
+
+// SiteDeployRotate replaces the webhook secret of domain; deliveries signed with the
+// old one are refused from now on.
+func (a *App) SiteDeployRotate(domain string) (store.SiteDeploy, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	d, err := a.SiteDeploy(domain)
+	if err != nil {
+		return d, err
+	}
+	if d.Secret, err = newDeploySecret(); err != nil {
+		return d, err
+	}
+	if err := a.st.SaveSiteDeploy(d); err != nil {
+		return d, err
+	}
+	a.event("info", "deploy", "%s: webhook secret rotated", domain)
+	return d, nil
+}
+
+// SiteDeployOff removes the git deploy of domain; the checkout stays in the webroot.
+func (a *App) SiteDeployOff(domain string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if _, err := a.SiteDeploy(domain); err != nil {
+		return err
+	}
+	if err := a.st.DeleteSiteDeploy(domain); err != nil {
+		return err
+	}
+	a.event("info", "deploy", "%s: git deploy off", domain)
+	return nil
+}
+
+// SiteDeploy returns the git deploy setup of domain.
+func (a *App) SiteDeploy(domain string) (store.SiteDeploy, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	d, err := a.st.GetSiteDeploy(domain)
+	if err != nil {
+		return d, invalidf("%s has no git deploy (set one with `ngm site deploy --domain %s --repo <url>`)", domain, domain)
+	}
+	return d, nil
+}
+
+// DeployRuns is the deploy log of domain, newest first.
+func (a *App) DeployRuns(domain string, limit int) ([]store.DeployRun, error) {
+	return a.st.ListDeployRuns(strings.ToLower(strings.TrimSpace(domain)), limit)
+}
+
+// DeployWebhookURL is where GitHub/GitLab push events for domain go (a path when
+// api.public_url is not set).
+func (a *App) DeployWebhookURL(domain string) string {
+	return strings.TrimRight(a.cfg.API.PublicURL, "/") + fmt.Sprintf(DeployHookPath, url.PathEscape(domain))
+}
+
+// Deploy fetches the configured branch into the webroot of domain now and records
+// the run in the deploy log.
+func (a *App) Deploy(ctx context.Context, domain, trigger string) (store.DeployRun, error) {
+	d, err := a.SiteDeploy(domain)
+	if err != nil {
+		return store.DeployRun{}, err
+	}
+	run := a.deploy(ctx, d, trigger, "refs/heads/"+d.Branch)
+	if run.Status != "ok" {
+		return run, fmt.Errorf("deploy of %s failed (see the deploy log)", d.Domain)
+	}
+	return run, nil
+}
+
+// DeployWebhook checks a push delivery for domain and, when it is for the deployed
+// branch, starts the deploy in the background (webhook senders time out long before
+// a clone finishes). Deliveries for other refs are logged as skipped. It returns
+// whether a deploy was started and a message for the sender.
+func (a *App) DeployWebhook(domain string, hook DeployHook) (bool, string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	d, err := a.st.GetSiteDeploy(domain)
+	if err != nil || d.Secret == "" {
+		return false, "", ErrDeployDenied
+	}
+
+	var trigger string
+	switch {
+	case hook.Signature != "":
+		mac := hmac.New(sha256.New, []byte(d.Secret))
+		mac.Write(hook.Body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(hook.Signature), []byte(want)) {
+			return false, "", ErrDeployDenied
+		}
+		trigger = "github"
+	case hook.Token != "":
+		if subtle.ConstantTimeCompare([]byte(hook.Token), []byte(d.Secret)) != 1 {
+			return false, "", ErrDeployDenied
+		}
+		trigger = "gitlab"
+	default:
+		return false, "", ErrDeployDenied
+	}
+	if hook.Event == "ping" {
+		return false, "pong", nil
+	}
+
+	var push struct {
+		Ref     string `json:"ref"`
+		Deleted bool   `json:"deleted"`
+	}
+	body := hook.Body
+	// GitHub's "application/x-www-form-urlencoded" content type
+	if strings.HasPrefix(string(body), "payload=") {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return false, "", invalidf("push payload: %v", err)
+		}
+		body = []byte(form.Get("payload"))
+	}
+	if err := json.Unmarshal(body, &push); err != nil {
+		return false, "", invalidf("push payload: %v", err)
+	}
+
+	want := "refs/heads/" + d.Branch
+	why := ""
+	switch {
+	case push.Ref != want:
+		why = fmt.Sprintf("push to %q; only %s is deployed", push.Ref, want)
+	case push.Deleted:
+		why = "branch deleted"
+	}
+	if why != "" {
+		now := time.Now()
+		_, _ = a.st.AddDeployRun(store.DeployRun{
+			Domain: domain, StartedAt: now, FinishedAt: now,
+			Trigger: trigger, Ref: push.Ref, Status: "skipped", Output: why,
+		})
+		return false, "skipped: " + why, nil
+	}
+
+	go func() {
+		_ = a.deploy(context.Background(), d, trigger, push.Ref)
+	}()
+	return true, "deploy of " + want + " started", nil
+}
+
+// deploy runs one deploy of d, waiting for a running one of the same site.
+func (a *App) deploy(ctx context.Context, d store.SiteDeploy, trigger, ref string) store.DeployRun {
+	mu, _ := deployLocks.LoadOrStore(d.Domain, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, deployTimeout)
+	defer cancel()
+
+	run := store.DeployRun{Domain: d.Domain, StartedAt: time.Now(), Trigger: trigger, Ref: ref}
+	var out strings.Builder
+	commit, err := a.gitCheckout(ctx, d, &out)
+	run.Commit = commit
+	run.FinishedAt = time.Now()
+	run.Output = out.String()
+	if err != nil {
+		run.Status = "fail"
+		run.Output += "error: " + err.Error() + "\n"
+		a.event("error", "deploy", "%s: deploy of %s failed (%s): %v", d.Domain, d.Branch, trigger, err)
+	} else {
+		run.Status = "ok"
+		a.event("info", "deploy", "%s: deployed %s at %.12s (%s)", d.Domain, d.Branch, commit, trigger)
+	}
+	if id, err := a.st.AddDeployRun(run); err == nil {
+		run.ID = id
+	}
+	return run
+}
+
+// gitCheckout makes the webroot a checkout of the deployed branch: init on the first
+// deploy (files already there are kept until the branch tracks them), then fetch and
+// hard reset, so local edits in the webroot never block a deploy. The webroot is the
+// site user's, and so is any .git/config in it: git runs as that user (never as
+// root), without prompts, hooks or an fsmonitor command.
+func (a *App) gitCheckout(ctx context.Context, d store.SiteDeploy, out *strings.Builder) (string, error) {
+	site, err := a.st.GetSiteByDomain(d.Domain)
+	if err != nil {
+		return "", fmt.Errorf("get site: %w", err)
+	}
+	u, err := a.st.GetUserByID(site.UserID)
+	if err != nil {
+		return "", fmt.Errorf("get user: %w", err)
+	}
+	dir := site.Webroot
+	if err := util.MkdirAll(dir, 0750); err != nil {
+		return "", err
+	}
+	if a.cfg.Sandbox == "" {
+		// a checkout left by an older root deploy is handed to the user first
+		if _, err := users.FixSiteTree(u.Username, site.Webroot, a.cfg.Hosting.WebGroup, false); err != nil {
+			return "", fmt.Errorf("permissions: %w", err)
+		}
+	}
+	git := func(args ...string) (string, error) {
+		full := append([]string{"-u", u.Username, "--", "env", "HOME=" + u.HomeDir, "GIT_CONFIG_NOSYSTEM=1",
+			"git", "-C", dir, "-c", "core.fsmonitor=", "-c", "core.hooksPath=/dev/null", "-c", "core.askPass=true",
+			"-c", "core.sshCommand=ssh -o BatchMode=yes"}, args...)
+		res, err := a.run.Run(ctx, "runuser", full...)
+		fmt.Fprintf(out, "$ git %s\n%s", strings.Join(args, " "), res.Output())
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w", args[0], err)
+		}
+		return strings.TrimSpace(res.Stdout), nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := git("init", "-q"); err != nil {
+			return "", err
+		}
+		if _, err := git("remote", "add", "origin", d.Repo); err != nil {
+			return "", err
+		}
+	} else if _, err := git("remote", "set-url", "origin", d.Repo); err != nil {
+		return "", err
+	}
+	if _, err := git("fetch", "-q", "--depth", "1", "origin", "refs/heads/"+d.Branch); err != nil {
+		return "", err
+	}
+	if _, err := git("reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	if a.cfg.Sandbox == "" {
+		rep, err := users.FixSiteTree(u.Username, site.Webroot, a.cfg.Hosting.WebGroup, false)
+		if err != nil {
+			return commit, fmt.Errorf("permissions: %w", err)
+		}
+		fmt.Fprintf(out, "permissions: %d of %d path(s) fixed\n", len(rep.Changes), rep.Checked)
+	}
+	return commit, nil
+}
+
+// validDeployRepo accepts http(s), ssh and git URLs and scp-like git@host:path;
+// nothing git could read as an option or a local path.
+func validDeployRepo(repo string) error {
+	if repo == "" {
+		return invalidf("required: repository URL")
+	}
+	if strings.HasPrefix(repo, "-") || strings.ContainsAny(repo, " \t\r\n") {
+		return invalidf("invalid repository %q", repo)
+	}
+	if u, err := url.Parse(repo); err == nil && u.Scheme != "" {
+		switch u.Scheme {
+		case "https", "http", "ssh", "git":
+			if u.Host == "" {
+				return invalidf("invalid repository %q (no host)", repo)
+			}
+			return nil
+		}
+		return invalidf("unsupported repository scheme %q (use https, ssh or git@host:path)", u.Scheme)
+	}
+	if host, path, ok := strings.Cut(repo, ":"); ok && strings.Contains(host, "@") && path != "" && !strings.Contains(host, "/") {
+		return nil
+	}
+	return invalidf("invalid repository %q (use https://..., ssh://... or git@host:path)", repo)
+}
+
+func newDeploySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,346 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+// discoveryTimeout bounds one SRV or Consul lookup.
+const discoveryTimeout = 10 * time.Second
+
+var (
+	srvNameRe     = regexp.MustCompile(`^[a-z0-9_][a-z0-9_.-]*[a-z0-9]$`)
+	consulNameRe  = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	consulHostRe  = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+	discoveryHTTP = &http.Client{Timeout: discoveryTimeout}
+)
+
+// parseDiscovery splits "srv:<name>" / "consul:<service>" into its kind and name.
+func parseDiscovery(spec string) (kind, name string, err error) {
+	kind, name, ok := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	switch {
+	case !ok:
+	case kind == "srv" && srvNameRe.MatchString(name):
+		return kind, name, nil
+	case kind == "consul" && consulNameRe.MatchString(name):
+		return kind, name, nil
+	}
+	return "", "", invalidf("invalid discovery %q (want srv:_service._proto.name or consul:<service>)", spec)
+}
+
+// discover resolves spec to upstream targets, sorted by address. SRV records of the
+// lowest priority are the primaries and the rest backups; a Consul lookup returns
+// the instances passing their health checks.
+func (a *App) discover(ctx context.Context, spec string) ([]nginx.UpstreamTarget, error) {
+	kind, name, err := parseDiscovery(spec)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	var out []nginx.UpstreamTarget
+	switch kind {
+	case "srv":
+		out, err = discoverSRV(ctx, name)
+	case "consul":
+		out, err = a.discoverConsul(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out, nil
+}
+
+func discoverSRV(ctx context.Context, name string) ([]nginx.UpstreamTarget, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("SRV %s: %w", name, err)
+	}
+	best := -1
+	for _, s := range srvs {
+		if best < 0 || int(s.Priority) < best {
+			best = int(s.Priority)
+		}
+	}
+	seen := map[string]bool{}
+	var out []nginx.UpstreamTarget
+	for _, s := range srvs {
+		host := strings.TrimSuffix(s.Target, ".")
+		if host == "" {
+			continue // "." = service explicitly not available
+		}
+		ips, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("SRV %s: resolve %s: %w", name, host, err)
+		}
+		for _, ip := range ips {
+			addr := net.JoinHostPort(ip, strconv.Itoa(int(s.Port)))
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			out = append(out, nginx.UpstreamTarget{
+				Addr:       addr,
+				Weight:     max(int(s.Weight), 1),
+				Backup:     int(s.Priority) != best,
+				Enabled:    true,
+				Discovered: true,
+			})
+		}
+	}
+	return out, nil
+}
+
+// consulEntry is the part of /v1/health/service/<name> ngm reads.
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+func (a *App) discoverConsul(ctx context.Context, service string) ([]nginx.UpstreamTarget, error) {
+	c := a.cfg.Discovery.Consul
+	q := url.Values{"passing": {"true"}}
+	if c.Datacenter != "" {
+		q.Set("dc", c.Datacenter)
+	}
+	u := strings.TrimRight(c.Address, "/") + "/v1/health/service/" + url.PathEscape(service) + "?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	resp, err := discoveryHTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("consul %s: %s", service, resp.Status)
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("consul %s: %w", service, err)
+	}
+	return consulTargets(service, entries), nil
+}
+
+// consulTargets turns catalog entries into targets. The addresses end up in the
+// vhost, so anything but an IP or a plain host name is skipped.
+func consulTargets(service string, entries []consulEntry) []nginx.UpstreamTarget {
+	seen := map[string]bool{}
+	var out []nginx.UpstreamTarget
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		if host == "" || e.Service.Port <= 0 {
+			continue
+		}
+		if net.ParseIP(host) == nil && (len(host) > 253 || !consulHostRe.MatchString(host)) {
+			log.Printf("discovery consul:%s: skipping entry with address %q", service, host)
+			continue
+		}
+		if e.Service.Port > 65535 {
+			log.Printf("discovery consul:%s: skipping entry with port %d", service, e.Service.Port)
+			continue
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(e.Service.Port))
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		out = append(out, nginx.UpstreamTarget{Addr: addr, Weight: max(e.Service.Weights.Passing, 1), Enabled: true, Discovered: true})
+	}
+	return out
+}
+
+// SiteDiscovery sets where a proxy site's targets are discovered ("srv:<name>" or
+// "consul:<service>"; "" turns it off and drops the discovered targets). A new spec
+// is looked up at once, so a typo fails here rather than in `ngm serve`.
+func (a *App) SiteDiscovery(ctx context.Context, domain, spec string) ([]nginx.UpstreamTarget, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	if spec == "" {
+		if site.Discovery == "" {
+			return nil, nil
+		}
+		if err := a.st.SetSiteDiscovery(domain, ""); err != nil {
+			return nil, err
+		}
+		site.Discovery = ""
+		_, err := a.syncDiscovered(ctx, site, nil)
+		a.event("info", "discovery", "%s: discovery off", domain)
+		return nil, err
+	}
+	if site.Mode != "proxy" {
+		return nil, invalidf("discovery is for proxy sites (%s is %s)", domain, site.Mode)
+	}
+	kind, name, err := parseDiscovery(spec)
+	if err != nil {
+		return nil, err
+	}
+	spec = kind + ":" + name
+	targets, err := a.discover(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, invalidf("%s returned no targets", spec)
+	}
+	if err := a.st.SetSiteDiscovery(domain, spec); err != nil {
+		return nil, err
+	}
+	site.Discovery = spec
+	a.event("info", "discovery", "%s: targets from %s", domain, spec)
+	if _, err := a.syncDiscovered(ctx, site, targets); err != nil {
+		return targets, err
+	}
+	return targets, nil
+}
+
+// syncDiscovered stores targets as the site's discovered targets (without those
+// already added by hand, capped by the owner's plan) and applies an enabled site
+// when they differ from the stored ones.
+func (a *App) syncDiscovered(ctx context.Context, site store.Site, targets []nginx.UpstreamTarget) (bool, error) {
+	cur, err := a.st.ListProxyTargetsBySiteID(site.ID)
+	if err != nil {
+		return false, err
+	}
+	manual := 0
+	var old []string
+	isManual := map[string]bool{}
+	for _, t := range cur {
+		if t.Discovered {
+			old = append(old, t.Addr)
+			continue
+		}
+		isManual[t.Addr] = true
+		if t.Enabled {
+			manual++
+		}
+	}
+	var fresh []nginx.UpstreamTarget
+	for _, t := range targets {
+		if !isManual[t.Addr] {
+			fresh = append(fresh, t)
+		}
+	}
+	targets = fresh
+	capped := ""
+	if u, err := a.st.GetUserByID(site.UserID); err == nil {
+		if p, err := a.planForUser(u); err == nil && p != nil && p.MaxProxyTargets > 0 {
+			if room := max(p.MaxProxyTargets-manual, 0); len(targets) > room {
+				capped = fmt.Sprintf(" (%d discovered, plan %q leaves room for %d)", len(targets), p.Name, room)
+				targets = targets[:room]
+			}
+		}
+	}
+	var next []string
+	for _, t := range targets {
+		next = append(next, t.Addr)
+	}
+	sort.Strings(old)
+	if strings.Join(old, " ") == strings.Join(next, " ") {
+		return false, nil
+	}
+	if err := a.st.ReplaceDiscoveredTargets(site.ID, targets); err != nil {
+		return false, err
+	}
+	a.event("info", "discovery", "%s: targets %s -> %s%s", site.Domain, targetList(old), targetList(next), capped)
+	if !site.Enabled {
+		return true, nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: site.Domain}); err != nil {
+		return true, fmt.Errorf("apply after discovery: %w", err)
+	}
+	return true, nil
+}
+
+func targetList(addrs []string) string {
+	if len(addrs) == 0 {
+		return "(none)"
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// SweepDiscovery looks up the targets of every proxy site with discovery. A failed
+// or empty lookup keeps the current targets (a DNS or Consul outage must not empty
+// the upstream).
+func (a *App) SweepDiscovery(ctx context.Context) error {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	for _, s := range sites {
+		if s.Discovery == "" || s.Mode != "proxy" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		targets, err := a.discover(ctx, s.Discovery)
+		if err != nil {
+			log.Printf("discovery %s: %v", s.Domain, err)
+			continue
+		}
+		if len(targets) == 0 {
+			log.Printf("discovery %s: %s returned no targets (keeping the current ones)", s.Domain, s.Discovery)
+			continue
+		}
+		if _, err := a.syncDiscovered(ctx, s, targets); err != nil {
+			a.event("error", "discovery", "%s: %v", s.Domain, err)
+		}
+	}
+	return nil
+}
+
+// RunDiscovery sweeps discovery every discovery.interval until ctx is done.
+func (a *App) RunDiscovery(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.Discovery.Interval)
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := a.SweepDiscovery(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("discovery: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
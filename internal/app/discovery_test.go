@@ -0,0 +1,32 @@
+package app
+
+import "testing"
+
+// TestConsulTargets checks that catalog addresses which are not an IP or a host
+// name never reach the upstream block of the vhost.
+func TestConsulTargets(t *testing.T) {
+	entry := func(svc, node string, port int) consulEntry {
+		var e consulEntry
+		e.Service.Address, e.Node.Address, e.Service.Port = svc, node, port
+		return e
+	}
+	got := consulTargets("web", []consulEntry{
+		entry("10.0.0.5", "", 8080),
+		entry("", "app-1.node.dc1.consul", 8080),
+		entry("fd00::5", "", 8080),
+		entry("10.0.0.6;} server { listen 80", "", 8080),
+		entry("10.0.0.7 backup", "", 8080),
+		entry("-bad.example", "", 8080),
+		entry("10.0.0.8", "", 70000),
+		entry("10.0.0.5", "", 8080),
+	})
+	want := []string{"10.0.0.5:8080", "app-1.node.dc1.consul:8080", "[fd00::5]:8080"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d targets %v, want %v", len(got), got, want)
+	}
+	for i, w := range want {
+		if got[i].Addr != w {
+			t.Errorf("target %d: %q, want %q", i, got[i].Addr, w)
+		}
+	}
+}
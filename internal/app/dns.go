@@ -0,0 +1,238 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/config"
+	"mynginx/internal/dns"
+)
+
+// DNSZoneStatus is a configured zone and whether its provider accepts the
+// credentials (Error is empty when a test lookup worked).
+type DNSZoneStatus struct {
+	Zone     string
+	Provider string
+	DNS01    bool
+	Keys     []string // credential keys of the provider, optional ones in brackets
+	Error    string
+}
+
+// dnsZoneFor is the configured zone holding name (the longest match); nil if none.
+func (a *App) dnsZoneFor(name string) *config.DNSZoneConfig {
+	name = acmeDNSDomain(name)
+	var best *config.DNSZoneConfig
+	for i := range a.cfg.DNS.Zones {
+		z := &a.cfg.DNS.Zones[i]
+		if dns.InZone(name, z.Zone) && (best == nil || len(z.Zone) > len(best.Zone)) {
+			best = z
+		}
+	}
+	return best
+}
+
+// dnsProvider builds the provider of z, decrypting its enc: credentials with
+// dns.key_file.
+func (a *App) dnsProvider(z config.DNSZoneConfig) (dns.Provider, error) {
+	creds := map[string]string{}
+	var key []byte
+	for k, v := range z.Credentials {
+		if strings.HasPrefix(v, dns.EncPrefix) && key == nil {
+			var err error
+			if key, err = dns.LoadKey(a.cfg.DNS.KeyFile, false); err != nil {
+				return nil, fmt.Errorf("zone %s: %w", z.Zone, err)
+			}
+		}
+		plain, err := dns.Decrypt(key, v)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: credentials.%s: %w", z.Zone, k, err)
+		}
+		creds[k] = plain
+	}
+	return dns.New(dns.Zone{Name: z.Zone, Provider: z.Provider, Credentials: creds}, a.run)
+}
+
+// DNSEncrypt seals a provider secret for dns.zones[].credentials, creating
+// dns.key_file the first time.
+func (a *App) DNSEncrypt(plain string) (string, error) {
+	plain = strings.TrimSpace(plain)
+	if plain == "" {
+		return "", invalidf("nothing to encrypt")
+	}
+	key, err := dns.LoadKey(a.cfg.DNS.KeyFile, true)
+	if err != nil {
+		return "", err
+	}
+	return dns.Encrypt(key, plain)
+}
+
+// DNSZones lists the configured zones, checking each provider with a lookup of the
+// zone apex.
+func (a *App) DNSZones(ctx context.Context) []DNSZoneStatus {
+	var out []DNSZoneStatus
+	for _, z := range a.cfg.DNS.Zones {
+		st := DNSZoneStatus{Zone: z.Zone, Provider: z.Provider, DNS01: z.DNS01, Keys: dns.CredentialKeys(z.Provider)}
+		p, err := a.dnsProvider(z)
+		if err == nil {
+			cctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			_, err = p.Records(cctx, z.Zone, "TXT")
+			cancel()
+		}
+		if err != nil {
+			st.Error = err.Error()
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// SiteDNSRecords points the A/AAAA records of domain at dns.addresses through the
+// provider of its zone, replacing what was there. It returns the addresses set.
+func (a *App) SiteDNSRecords(ctx context.Context, domain string) ([]string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	z := a.dnsZoneFor(domain)
+	if z == nil {
+		return nil, invalidf("%s is in none of dns.zones", domain)
+	}
+	var v4, v6 []string
+	for _, s := range a.cfg.DNS.Addresses {
+		if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+			v4 = append(v4, ip.String())
+		} else if ip != nil {
+			v6 = append(v6, ip.String())
+		}
+	}
+	if len(v4)+len(v6) == 0 {
+		return nil, invalidf("dns.addresses is empty: no address to point %s at", domain)
+	}
+	p, err := a.dnsProvider(*z)
+	if err != nil {
+		return nil, err
+	}
+	if err := dns.SetRecords(ctx, p, domain, "A", v4, z.TTL); err != nil {
+		return nil, err
+	}
+	if err := dns.SetRecords(ctx, p, domain, "AAAA", v6, z.TTL); err != nil {
+		return nil, err
+	}
+	a.event("info", "dns", "%s: A/AAAA -> %s (%s)", domain, strings.Join(append(v4, v6...), ", "), z.Provider)
+	return append(v4, v6...), nil
+}
+
+// DNSChallengeHook is certbot's --manual-auth-hook for zones with dns01: it adds
+// the validation TXT record and waits until the zone's name servers serve it.
+func (a *App) DNSChallengeHook(ctx context.Context, domain, validation string) error {
+	z, p, name, err := a.dnsChallenge(domain, validation)
+	if err != nil {
+		return err
+	}
+	if err := p.AddRecord(ctx, dns.Record{Name: name, Type: "TXT", Value: validation, TTL: z.TTL}); err != nil {
+		return fmt.Errorf("add %s TXT: %w", name, err)
+	}
+	wait, _ := time.ParseDuration(z.Propagation)
+	if err := waitTXT(ctx, z.Zone, name, validation, wait); err != nil {
+		a.event("warning", "dns", "%s: %v; letting the CA try anyway", name, err)
+	}
+	return nil
+}
+
+// DNSCleanupHook is certbot's --manual-cleanup-hook: it removes the validation TXT
+// record again.
+func (a *App) DNSCleanupHook(ctx context.Context, domain, validation string) error {
+	_, p, name, err := a.dnsChallenge(domain, validation)
+	if err != nil {
+		return err
+	}
+	return dns.RemoveRecord(ctx, p, name, "TXT", validation)
+}
+
+func (a *App) dnsChallenge(domain, validation string) (config.DNSZoneConfig, dns.Provider, string, error) {
+	domain = acmeDNSDomain(domain)
+	if domain == "" || validation == "" {
+		return config.DNSZoneConfig{}, nil, "", fmt.Errorf("CERTBOT_DOMAIN and CERTBOT_VALIDATION are required (run by certbot)")
+	}
+	z := a.dnsZoneFor(domain)
+	if z == nil {
+		return config.DNSZoneConfig{}, nil, "", fmt.Errorf("%s is in none of dns.zones", domain)
+	}
+	p, err := a.dnsProvider(*z)
+	if err != nil {
+		return config.DNSZoneConfig{}, nil, "", err
+	}
+	return *z, p, certs.ChallengeName(domain), nil
+}
+
+// dnsHooks sets certbot's DNS-01 hooks to the provider of the domain's zone when
+// that zone has dns01 on.
+func (a *App) dnsHooks(m *certs.CertbotManager, domain string) error {
+	z := a.dnsZoneFor(domain)
+	if z == nil || !z.DNS01 {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("dns hook: %w", err)
+	}
+	base := fmt.Sprintf("%s -c %s cert ", shellQuote(exe), shellQuote(a.cfg.Path))
+	m.DNSAuthHook = base + "dns-hook"
+	m.DNSCleanupHook = base + "dns-cleanup"
+	return nil
+}
+
+// waitTXT polls the name servers of zone until each serves value at name, or
+// timeout passes.
+func waitTXT(ctx context.Context, zone, name, value string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	nss, err := net.DefaultResolver.LookupNS(ctx, zone)
+	if err != nil || len(nss) == 0 {
+		// no NS answer: give the record the full time instead
+		<-ctx.Done()
+		return nil
+	}
+	for {
+		missing := ""
+		for _, ns := range nss {
+			if !nsHasTXT(ctx, strings.TrimSuffix(ns.Host, "."), name, value) {
+				missing = ns.Host
+				break
+			}
+		}
+		if missing == "" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT record not on %s after %s", strings.TrimSuffix(missing, "."), timeout)
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func nsHasTXT(ctx context.Context, ns, name, value string) bool {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, net.JoinHostPort(ns, "53"))
+		},
+	}
+	txt, err := r.LookupTXT(ctx, name)
+	if err != nil {
+		return false
+	}
+	for _, t := range txt {
+		if t == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// OrphanConf is a .conf file in sites_dir without an enabled or retiring site behind
+// it: a manual leftover, the vhost of a renamed domain, or a site that is gone or disabled.
+type OrphanConf struct {
+	File    string
+	Domain  string // file name without .conf
+	Site    string // "none" (no such site) | "disabled"
+	Size    int64
+	ModTime time.Time
+}
+
+// DriftReport is where the live vhost dir and the database disagree.
+type DriftReport struct {
+	Orphans []OrphanConf
+	Missing []string // enabled, applied sites whose live vhost is gone
+}
+
+// Empty reports whether the live dir matches the database.
+func (r DriftReport) Empty() bool { return len(r.Orphans) == 0 && len(r.Missing) == 0 }
+
+// Drift compares sites_dir with the sites in the database.
+func (a *App) Drift() (DriftReport, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return DriftReport{}, err
+	}
+	return driftReport(sites, a.paths.NginxSitesDir)
+}
+
+// driftReport compares the vhosts in dir with sites. A retiring site still expects
+// its vhost: it serves the retired page until SweepRetired removes it.
+func driftReport(sites []store.Site, dir string) (DriftReport, error) {
+	var rep DriftReport
+	expected := map[string]bool{}
+	known := map[string]bool{}
+	for _, s := range sites {
+		d := strings.ToLower(strings.TrimSpace(s.Domain))
+		known[d] = true
+		if siteRetiring(s) {
+			expected[d] = true
+		}
+		if !s.Enabled {
+			continue
+		}
+		expected[d] = true
+		if s.LastApplyStatus == "ok" && !fileExists(filepath.Join(dir, d+".conf")) {
+			rep.Missing = append(rep.Missing, d)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return rep, err
+	}
+	for _, f := range files {
+		d := strings.TrimSuffix(filepath.Base(f), ".conf")
+		if expected[d] {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		o := OrphanConf{File: f, Domain: d, Site: "none", Size: fi.Size(), ModTime: fi.ModTime()}
+		if known[d] {
+			o.Site = "disabled"
+		}
+		rep.Orphans = append(rep.Orphans, o)
+	}
+	sort.Strings(rep.Missing)
+	return rep, nil
+}
+
+// PruneOrphans moves the orphaned vhosts of Drift into a timestamped directory
+// under backup_dir, then tests and reloads nginx. A failed test puts the files
+// back. It returns the pruned files and the backup directory.
+func (a *App) PruneOrphans(ctx context.Context) ([]OrphanConf, string, error) {
+	// touches the live dir + reloads nginx, like apply
+	release, err := a.lockApply("prune orphans", false)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+
+	rep, err := a.Drift()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(rep.Orphans) == 0 {
+		return nil, "", nil
+	}
+
+	bakDir := filepath.Join(a.paths.NginxBackupDir, "orphans", time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(bakDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("mkdir %s: %w", bakDir, err)
+	}
+	var moved []OrphanConf
+	restore := func() {
+		for _, o := range moved {
+			if data, err := os.ReadFile(filepath.Join(bakDir, filepath.Base(o.File))); err == nil {
+				_ = util.WriteFileAtomic(o.File, data, 0644)
+			}
+		}
+	}
+	for _, o := range rep.Orphans {
+		data, err := os.ReadFile(o.File)
+		if err != nil {
+			restore()
+			return nil, bakDir, fmt.Errorf("read %s: %w", o.File, err)
+		}
+		if err := util.WriteFileAtomic(filepath.Join(bakDir, filepath.Base(o.File)), data, 0644); err != nil {
+			restore()
+			return nil, bakDir, fmt.Errorf("backup %s: %w", o.File, err)
+		}
+		if err := os.Remove(o.File); err != nil {
+			restore()
+			return nil, bakDir, fmt.Errorf("remove %s: %w", o.File, err)
+		}
+		moved = append(moved, o)
+	}
+
+	since := time.Now()
+	if err := a.ng.TestConfig(); err != nil {
+		restore()
+		if diag := a.reloadDiagnostics(ctx, since); diag != "" {
+			err = fmt.Errorf("%w\n%s", err, diag)
+		}
+		return nil, bakDir, fmt.Errorf("nginx -t failed without the orphaned vhosts (restored): %w", err)
+	}
+	if err := a.ng.Reload(); err != nil {
+		restore()
+		_ = a.ng.Reload()
+		return nil, bakDir, fmt.Errorf("nginx reload failed (restored): %w", err)
+	}
+
+	names := make([]string, 0, len(moved))
+	for _, o := range moved {
+		names = append(names, filepath.Base(o.File))
+	}
+	a.event("warning", "nginx", "pruned %d orphaned vhost(s): %s (backup: %s)", len(moved), strings.Join(names, ", "), bakDir)
+	return moved, bakDir, nil
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// TestDriftRetiring checks that the live vhost of a site in its retire grace period
+// is not reported as an orphan (and so not pruned), while an expired one is.
+func TestDriftRetiring(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"live.example.com", "retiring.example.com", "expired.example.com", "stray.example.com"} {
+		if err := os.WriteFile(filepath.Join(dir, d+".conf"), []byte("server {}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	later, earlier := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	sites := []store.Site{
+		{Domain: "live.example.com", Enabled: true, LastApplyStatus: "ok"},
+		{Domain: "retiring.example.com", RetireUntil: &later},
+		{Domain: "expired.example.com", RetireUntil: &earlier},
+	}
+
+	rep, err := driftReport(sites, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, o := range rep.Orphans {
+		got[o.Domain] = o.Site
+	}
+	want := map[string]string{"expired.example.com": "disabled", "stray.example.com": "none"}
+	if len(got) != len(want) {
+		t.Errorf("orphans %v, want %v", got, want)
+	}
+	for d, site := range want {
+		if got[d] != site {
+			t.Errorf("orphan %s: site %q, want %q", d, got[d], site)
+		}
+	}
+	if len(rep.Missing) != 0 {
+		t.Errorf("missing %v, want none", rep.Missing)
+	}
+}
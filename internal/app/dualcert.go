@@ -0,0 +1,60 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SiteDualCert turns dual certificates (RSA + ECDSA) for a site on or off. Turning
+// it on issues the alternate-key certificate when the primary one already exists
+// (otherwise CertIssue issues both); turning it off deletes the alternate lineage.
+// Enabled sites are re-applied.
+func (a *App) SiteDualCert(ctx context.Context, domain string, on bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.DualCert == on {
+		return nil
+	}
+	if src := certSource(site); on && src != CertSourceLetsEncrypt {
+		return invalidf("%s uses the %s certificate source; dual certificates need letsencrypt", domain, src)
+	}
+	if err := a.st.SetSiteDualCert(domain, on); err != nil {
+		return err
+	}
+
+	m, err := a.certMgrFor(domain)
+	if err != nil {
+		return err
+	}
+	if on {
+		if ci, err := m.GetCertInfo(domain); err == nil && ci.Exists {
+			release, err := a.cluster.Lock(ctx, domain)
+			if err != nil {
+				return err
+			}
+			err = m.IssueAltCert(ctx, domain)
+			release()
+			if err != nil {
+				_ = a.st.SetSiteDualCert(domain, false)
+				return fmt.Errorf("issue alternate certificate: %w", err)
+			}
+		}
+	}
+	if site.Enabled {
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+			return err
+		}
+	}
+	if !on {
+		// nginx no longer references it
+		if err := m.DeleteAltCert(ctx, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"mynginx/internal/store"
+	"mynginx/internal/syslog"
+)
+
+// event records an entry in the panel event log and forwards it to the SIEM when
+// security.syslog is enabled (best-effort: failures are only logged).
+func (a *App) event(level, source, format string, args ...any) {
+	a.addEvent("", level, source, fmt.Sprintf(format, args...))
+}
+
+// addEvent records msg, tied to the site and hosting user it is about: owner when
+// given, otherwise the "<domain>: " or "<user>: " prefix most messages start with.
+func (a *App) addEvent(owner, level, source, msg string) {
+	e := store.Event{Level: level, Source: source, Message: msg}
+	subject := owner
+	if subject == "" {
+		if i := strings.Index(msg, ": "); i > 0 && !strings.ContainsAny(msg[:i], " \t") {
+			subject = msg[:i]
+		}
+	}
+	if subject != "" {
+		if site, err := a.st.GetSiteByDomain(strings.ToLower(subject)); err == nil {
+			e.Domain = site.Domain
+			if u, err := a.st.GetUserByID(site.UserID); err == nil {
+				e.Owner = u.Username
+			}
+		} else if u, err := a.st.GetUserByUsername(subject); err == nil {
+			e.Owner = u.Username
+		}
+	}
+	if err := a.st.AddEvent(e); err != nil {
+		log.Printf("event log: %v (%s: %s)", err, source, msg)
+	}
+	if a.siem != nil {
+		if err := a.siem.Send(syslog.Severity(level), source, msg); err != nil {
+			log.Printf("event log: %v", err)
+		}
+	}
+}
+
+// Audit records a security-relevant event (e.g. panel logins) from outside the app package.
+func (a *App) Audit(level, source, format string, args ...any) {
+	a.event(level, source, format, args...)
+}
+
+// AuditOwner is Audit for an event about a hosting user (e.g. the login of a panel
+// account named like them), which also lands in their activity feed.
+func (a *App) AuditOwner(owner, level, source, format string, args ...any) {
+	a.addEvent(owner, level, source, fmt.Sprintf(format, args...))
+}
+
+// Events returns the newest event log entries (empty source = all sources).
+func (a *App) Events(source string, limit int) ([]store.Event, error) {
+	return a.st.ListEvents(source, limit)
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"mynginx/internal/notify"
+	"mynginx/internal/store"
+)
+
+// ExpiryEvent is posted as JSON to every expiry.webhooks URL.
+type ExpiryEvent struct {
+	Type      string    `json:"event"` // "expiring" | "expired"
+	Domain    string    `json:"domain"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Contact   string    `json:"contact,omitempty"`
+}
+
+// expiryLayouts are the accepted ParseExpiry inputs (local time; the second is
+// what an HTML datetime-local input submits).
+var expiryLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+// ParseExpiry reads an expiry time: a date (the site expires at its start), a
+// local date and time, or RFC 3339.
+func ParseExpiry(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range expiryLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, invalidf("invalid expiry %q (want YYYY-MM-DD or YYYY-MM-DDTHH:MM)", s)
+}
+
+// SiteExpiry sets the time a site is disabled at (at=nil removes the expiry) and
+// the owner contact warned beforehand ("" = only expiry.notify_emails). It does not
+// re-enable a site that already expired; SiteEnable does that.
+func (a *App) SiteExpiry(ctx context.Context, domain string, at *time.Time, contact string) error {
+	_ = ctx
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	contact = strings.TrimSpace(contact)
+
+	if _, err := a.st.GetSiteByDomain(domain); err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if contact != "" {
+		addr, err := mail.ParseAddress(contact)
+		if err != nil {
+			return invalidf("invalid contact email %q", contact)
+		}
+		contact = addr.Address
+	}
+	if at != nil && !at.After(time.Now()) {
+		return invalidf("expiry %s is not in the future", at.Format("2006-01-02 15:04"))
+	}
+	if err := a.st.SetSiteExpiry(domain, at, contact); err != nil {
+		return err
+	}
+	if at == nil {
+		a.event("info", "expiry", "%s: expiry removed", domain)
+	} else {
+		a.event("info", "expiry", "%s: expires %s", domain, at.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// clearPassedExpiry drops an expiry that already passed, so a re-enabled site is not
+// disabled again by the next sweep (a new expiry can be set with SiteExpiry).
+func (a *App) clearPassedExpiry(s store.Site) error {
+	if s.ExpiresAt == nil || s.ExpiresAt.After(time.Now()) {
+		return nil
+	}
+	return a.st.SetSiteExpiry(s.Domain, nil, s.ExpiryNotify)
+}
+
+// SweepSiteExpiry warns about enabled sites expiring within expiry.notify_before
+// and disables (de-publishing the vhost) the ones whose expiry has passed.
+func (a *App) SweepSiteExpiry(ctx context.Context, mailer *notify.Mailer) error {
+	before, err := time.ParseDuration(a.cfg.Expiry.NotifyBefore)
+	if err != nil {
+		before = 72 * time.Hour
+	}
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, s := range sites {
+		if !s.Enabled || s.ExpiresAt == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch {
+		case !s.ExpiresAt.After(now):
+			if err := a.st.DisableSiteByDomain(s.Domain); err != nil {
+				log.Printf("expiry %s: %v", s.Domain, err)
+				continue
+			}
+			if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+				a.event("error", "expiry", "%s expired and was disabled, but removing the vhost failed: %v", s.Domain, err)
+			} else {
+				a.event("warning", "expiry", "%s expired (%s) and was disabled", s.Domain, s.ExpiresAt.Format(time.RFC3339))
+			}
+			a.notifyExpiry(ctx, mailer, "expired", s)
+		case s.ExpiryWarnedAt == nil && s.ExpiresAt.Sub(now) <= before:
+			a.notifyExpiry(ctx, mailer, "expiring", s)
+			if err := a.st.MarkSiteExpiryWarned(s.Domain); err != nil {
+				log.Printf("expiry %s: %v", s.Domain, err)
+			}
+			a.event("info", "expiry", "%s expires %s, owner notified", s.Domain, s.ExpiresAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// RunSiteExpiry sweeps site expiries every expiry.interval until ctx is done.
+func (a *App) RunSiteExpiry(ctx context.Context, mailer *notify.Mailer) {
+	interval, err := time.ParseDuration(a.cfg.Expiry.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := a.SweepSiteExpiry(ctx, mailer); err != nil && ctx.Err() == nil {
+			log.Printf("expiry: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (a *App) notifyExpiry(ctx context.Context, mailer *notify.Mailer, typ string, s store.Site) {
+	ev := ExpiryEvent{Type: typ, Domain: s.Domain, ExpiresAt: *s.ExpiresAt, Contact: s.ExpiryNotify}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for _, url := range a.cfg.Expiry.Webhooks {
+		if err := notify.PostJSON(ctx, url, ev, nil); err != nil {
+			log.Printf("expiry: webhook: %v", err)
+		}
+	}
+	if mailer == nil || !mailer.Enabled() {
+		return
+	}
+	to := append([]string{}, a.cfg.Expiry.NotifyEmails...)
+	if s.ExpiryNotify != "" {
+		to = append(to, s.ExpiryNotify)
+	}
+	subject, body := expiryMail(ev)
+	for _, rcpt := range to {
+		if err := mailer.Send(rcpt, subject, body); err != nil {
+			log.Printf("expiry: mail %s: %v", rcpt, err)
+		}
+	}
+}
+
+func expiryMail(ev ExpiryEvent) (string, string) {
+	if ev.Type == "expired" {
+		return fmt.Sprintf("[EXPIRED] %s has been disabled", ev.Domain),
+			fmt.Sprintf("%s reached its expiry date (%s) and is no longer served.\n\nContact the administrator to re-enable it.\n",
+				ev.Domain, ev.ExpiresAt.Format(time.RFC1123))
+	}
+	return fmt.Sprintf("[EXPIRING] %s will be disabled on %s", ev.Domain, ev.ExpiresAt.Format("2006-01-02")),
+		fmt.Sprintf("%s is set to expire on %s.\n\nAfter that it will no longer be served. Contact the administrator\nto extend it.\n",
+			ev.Domain, ev.ExpiresAt.Format(time.RFC1123))
+}
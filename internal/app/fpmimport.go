@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/fpm"
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// FPMPool is a php-fpm pool ngm does not manage, with the site it most likely
+// serves (Domain "" = none found).
+type FPMPool struct {
+	Version string // phpfpm.versions key whose pools_dir holds it
+	fpm.ForeignPool
+	Domain string
+	Match  string // why it maps to Domain: "name" | "chdir" | "open_basedir"
+}
+
+// FPMPools scans the pools_dir of every configured PHP version for pool files ngm
+// did not write and maps each pool to a php site: by pool / file name, then by a
+// chdir or open_basedir inside the site's webroot.
+func (a *App) FPMPools() ([]FPMPool, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]string, 0, len(a.cfg.PHPFPM.Versions))
+	for v := range a.cfg.PHPFPM.Versions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	var out []FPMPool
+	for _, v := range versions {
+		pools, err := fpm.ScanPools(a.cfg.PHPFPM.Versions[v].PoolsDir)
+		if err != nil {
+			return nil, fmt.Errorf("scan %s pools: %w", v, err)
+		}
+		for _, p := range pools {
+			fp := FPMPool{Version: v, ForeignPool: p}
+			fp.Domain, fp.Match = matchPoolSite(p, sites)
+			out = append(out, fp)
+		}
+	}
+	return out, nil
+}
+
+func matchPoolSite(p fpm.ForeignPool, sites []store.Site) (string, string) {
+	file := strings.TrimSuffix(filepath.Base(p.File), ".conf")
+	for _, s := range sites {
+		if s.Mode != "" && s.Mode != "php" {
+			continue
+		}
+		key := nameKey(s.Domain)
+		if nameKey(p.Name) == key || nameKey(file) == key {
+			return s.Domain, "name"
+		}
+	}
+	for _, s := range sites {
+		if s.Mode != "" && s.Mode != "php" {
+			continue
+		}
+		root := filepath.Dir(s.Webroot) // the site dir: webroot, logs, tmp
+		if d := p.Get("chdir"); d != "" && within(d, root) {
+			return s.Domain, "chdir"
+		}
+		for _, d := range filepath.SplitList(p.Get("php_admin_value[open_basedir]")) {
+			if within(d, s.Webroot) {
+				return s.Domain, "open_basedir"
+			}
+		}
+	}
+	return "", ""
+}
+
+func nameKey(s string) string {
+	return strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// FPMAdopt brings the foreign pool in file under ngm as the pool of domain (the
+// mapped site when domain is ""): its php values and pm limits become the site's
+// pool overrides, the file moves to backup_dir/fpm/<time>/, and the site is applied
+// so ngm renders its own ngm-<site>.conf; php-fpm is then reloaded to drop the old
+// pool. A failed apply puts the file and the previous overrides back.
+func (a *App) FPMAdopt(ctx context.Context, file, domain string) (FPMPool, string, error) {
+	file = filepath.Clean(strings.TrimSpace(file))
+	pools, err := a.FPMPools()
+	if err != nil {
+		return FPMPool{}, "", err
+	}
+	var p *FPMPool
+	for i := range pools {
+		if pools[i].File == file {
+			p = &pools[i]
+			break
+		}
+	}
+	if p == nil {
+		return FPMPool{}, "", invalidf("%s is not a foreign pool file in any configured pools_dir", file)
+	}
+	if p.Pools > 1 {
+		return *p, "", invalidf("%s holds %d pools; split it into one file per pool first", file, p.Pools)
+	}
+	if domain = strings.ToLower(strings.TrimSpace(domain)); domain == "" {
+		domain = p.Domain
+	}
+	if domain == "" {
+		return *p, "", invalidf("pool %s matches no site; pass the domain to adopt it for", p.Name)
+	}
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return *p, "", fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "" && site.Mode != "php" {
+		return *p, "", invalidf("%s is a %s site; only php sites have a pool", domain, site.Mode)
+	}
+	if site.PHPVersion != p.Version {
+		return *p, "", invalidf("pool %s runs PHP %s but %s uses %s; switch the site first", p.Name, p.Version, domain, site.PHPVersion)
+	}
+	p.Domain = domain
+
+	prevOverrides, err := a.st.ListSiteFPMSettings(site.ID)
+	if err != nil {
+		return *p, "", err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return *p, "", err
+	}
+	bakDir := filepath.Join(a.paths.NginxBackupDir, "fpm", time.Now().Format("20060102-150405"))
+	bak := filepath.Join(bakDir, filepath.Base(file))
+	if err := util.MkdirAll(bakDir, 0755); err != nil {
+		return *p, "", err
+	}
+	if err := util.WriteFileAtomic(bak, data, 0644); err != nil {
+		return *p, "", fmt.Errorf("backup %s: %w", file, err)
+	}
+
+	if err := a.st.SetSiteFPMSettings(domain, p.Overrides()); err != nil {
+		return *p, bak, err
+	}
+	if err := os.Remove(file); err != nil {
+		_ = a.st.SetSiteFPMSettings(domain, prevOverrides)
+		return *p, bak, err
+	}
+	service := a.cfg.PHPFPM.Versions[p.Version].Service
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		_ = util.WriteFileAtomic(file, data, 0644)
+		_ = a.st.SetSiteFPMSettings(domain, prevOverrides)
+		_ = fpm.ReloadService(a.run, a.timeouts.Systemctl, service)
+		return *p, bak, fmt.Errorf("apply %s failed (pool %s restored): %w", domain, file, err)
+	}
+	if err := fpm.ReloadService(a.run, a.timeouts.Systemctl, service); err != nil {
+		return *p, bak, err
+	}
+	a.event("info", "fpm", "adopted php-fpm pool %s (%s) for %s, %d setting(s) kept (backup: %s)",
+		p.Name, file, domain, len(p.Overrides()), bak)
+	return *p, bak, nil
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynginx/internal/config"
+	"mynginx/internal/fpm"
+	"mynginx/internal/store"
+)
+
+// poolChange is a php-fpm pool file an apply rewrote; php-fpm has not reloaded it yet.
+type poolChange struct {
+	domain   string
+	service  string
+	poolsDir string
+	prev     []byte // the file it replaced (nil = new pool)
+}
+
+// sitePoolData is the pool of a php site: defaults, its overrides and hardening.
+func (a *App) sitePoolData(s store.Site, domain string) (fpm.PoolData, config.PHPFPMVersion, error) {
+	cfg := a.cfg
+	ver, ok := cfg.PHPFPM.Versions[s.PHPVersion]
+	if !ok {
+		return fpm.PoolData{}, ver, fmt.Errorf("unknown php version %q (not in config.phpfpm.versions)", s.PHPVersion)
+	}
+
+	runUser, ok := inferUserFromWebroot(cfg.Hosting.HomeRoot, s.Webroot)
+	if !ok {
+		return fpm.PoolData{}, ver, fmt.Errorf("cannot infer site user from webroot %q (expected under %q)", s.Webroot, cfg.Hosting.HomeRoot)
+	}
+	runGroup := runUser
+	webGroup := cfg.Hosting.WebGroup
+	if webGroup == "" {
+		webGroup = "www-data"
+	}
+	logsDir := filepath.Join(filepath.Dir(s.Webroot), "logs")
+
+	td := fpm.PoolData{
+		PoolName:                "ngm_" + strings.ReplaceAll(domain, ".", "_"),
+		RunUser:                 runUser,
+		RunGroup:                runGroup,
+		Socket:                  fpm.SocketPath(ver.SockDir, domain, s.PHPVersion),
+		ListenOwner:             runUser,
+		ListenGroup:             webGroup,
+		MaxChildren:             10,
+		IdleTimeout:             "10s",
+		MaxRequests:             500,
+		RequestTerminateTimeout: "60s",
+		SlowlogTimeout:          "5s",
+		SlowlogPath:             filepath.Join(logsDir, "php-fpm.slow.log"),
+		ErrorLog:                filepath.Join(logsDir, "php-fpm.error.log"),
+		PHPAdminValues:          map[string]string{},
+		PHPValues:               map[string]string{},
+	}
+
+	overrides, err := a.st.ListSiteFPMSettings(s.ID)
+	if err != nil {
+		return fpm.PoolData{}, ver, fmt.Errorf("load fpm settings: %w", err)
+	}
+	td.Override(overrides)
+	if s.Hardened {
+		// outbound URL access from PHP (SSRF, remote includes); curl is not covered
+		for k, v := range hardenedPHPValues {
+			td.PHPAdminValues[k] = v
+		}
+	}
+	return td, ver, nil
+}
+
+// writeSitePool writes the pool of a php site; nil means it was already up to date
+// (or the site has no pool).
+func (a *App) writeSitePool(s store.Site, domain string) (*poolChange, error) {
+	if s.Mode != "" && s.Mode != "php" {
+		return nil, nil
+	}
+	td, ver, err := a.sitePoolData(s, domain)
+	if err != nil {
+		return nil, err
+	}
+	if ver.Service == "" {
+		return nil, fmt.Errorf("ensure fpm pool: no service for php %s", s.PHPVersion)
+	}
+	_, prev, changed, err := fpm.WritePool(ver.PoolsDir, ver.SockDir, domain, s.PHPVersion, td)
+	if err != nil {
+		return nil, fmt.Errorf("ensure fpm pool: %w", err)
+	}
+	if !changed {
+		return nil, nil
+	}
+	return &poolChange{domain: domain, service: ver.Service, poolsDir: ver.PoolsDir, prev: prev}, nil
+}
+
+// restorePools puts back the pool files of changes.
+func restorePools(changes []poolChange) {
+	for _, c := range changes {
+		_ = fpm.RestorePool(c.poolsDir, c.domain, c.prev)
+	}
+}
+
+// reloadPools reloads each php-fpm service once for its rewritten pools. When a
+// reload fails, that service's pools are restored and it is reloaded again; the
+// domains whose pools were rolled back are returned with the error.
+func (a *App) reloadPools(changes []poolChange) (reloaded, failed []string, err error) {
+	byService := map[string][]poolChange{}
+	for _, c := range changes {
+		byService[c.service] = append(byService[c.service], c)
+	}
+	services := make([]string, 0, len(byService))
+	for svc := range byService {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+
+	var errs []string
+	for _, svc := range services {
+		a.applyStep("reloading %s (%d pool(s) changed)", svc, len(byService[svc]))
+		if rerr := fpm.ReloadService(a.run, a.timeouts.Systemctl, svc); rerr != nil {
+			restorePools(byService[svc])
+			_ = fpm.ReloadService(a.run, a.timeouts.Systemctl, svc)
+			for _, c := range byService[svc] {
+				failed = append(failed, c.domain)
+			}
+			errs = append(errs, rerr.Error())
+			continue
+		}
+		reloaded = append(reloaded, svc)
+	}
+	if len(errs) > 0 {
+		return reloaded, failed, fmt.Errorf("php-fpm reload failed (pools rolled back): %s", strings.Join(errs, "; "))
+	}
+	return reloaded, nil, nil
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of GCItem.
+const (
+	GCStaging    = "staging"    // staging_dir/sites/<domain>.conf
+	GCBackup     = "backup"     // backup_dir/sites/<domain>/, backup_dir/<domain>.conf.bak
+	GCSelfSigned = "selfsigned" // conf/selfsigned/<name>/
+)
+
+// GCItem is a leftover of a name without a site: a file or a directory.
+type GCItem struct {
+	Kind    string
+	Name    string // the domain (or preview hostname) it belonged to
+	Path    string
+	Size    int64     // bytes, summed over a directory
+	ModTime time.Time // newest change in it
+	Kept    bool      // changed within the grace period: left for a later run
+}
+
+// GCReport is what a GC run found and removed.
+type GCReport struct {
+	Items   []GCItem
+	Removed int
+	Freed   int64 // bytes
+}
+
+// GC finds the staged renders, vhost backups and self-signed certificates of names
+// that no site has (as domain or preview hostname) and, unless dryRun, removes those
+// untouched for grace. Disabled sites keep theirs.
+func (a *App) GC(grace time.Duration, dryRun bool) (GCReport, error) {
+	var rep GCReport
+	if !dryRun {
+		// apply writes the staging dir and the backups
+		release, err := a.lockApply("gc", false)
+		if err != nil {
+			return rep, err
+		}
+		defer release()
+	}
+
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return rep, err
+	}
+	known := map[string]bool{}
+	for _, s := range sites {
+		known[strings.ToLower(strings.TrimSpace(s.Domain))] = true
+		if s.PreviewHost != "" {
+			known[s.PreviewHost] = true
+		}
+	}
+
+	var found []GCItem
+	add := func(kind, name, path string) {
+		if name == "" || known[name] || !strings.Contains(name, ".") {
+			return
+		}
+		size, mod, err := gcSize(path)
+		if err != nil {
+			log.Printf("gc: %v", err)
+			return
+		}
+		found = append(found, GCItem{Kind: kind, Name: name, Path: path, Size: size, ModTime: mod})
+	}
+	staged, _ := filepath.Glob(filepath.Join(a.paths.NginxStageDir, "sites", "*.conf"))
+	for _, f := range staged {
+		add(GCStaging, strings.TrimSuffix(filepath.Base(f), ".conf"), f)
+	}
+	for _, d := range gcSubdirs(filepath.Join(a.paths.NginxBackupDir, "sites")) {
+		add(GCBackup, filepath.Base(d), d)
+	}
+	legacy, _ := filepath.Glob(filepath.Join(a.paths.NginxBackupDir, "*.conf.bak"))
+	for _, f := range legacy {
+		add(GCBackup, strings.TrimSuffix(filepath.Base(f), ".conf.bak"), f)
+	}
+	for _, d := range gcSubdirs(filepath.Join(a.paths.NginxRoot, "conf", "selfsigned")) {
+		add(GCSelfSigned, filepath.Base(d), d)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Name != found[j].Name {
+			return found[i].Name < found[j].Name
+		}
+		return found[i].Path < found[j].Path
+	})
+
+	cutoff := time.Now().Add(-grace)
+	var removed []string
+	for _, it := range found {
+		it.Kept = it.ModTime.After(cutoff)
+		if !it.Kept && !dryRun {
+			if err := os.RemoveAll(it.Path); err != nil {
+				log.Printf("gc: remove %s: %v", it.Path, err)
+				it.Kept = true
+			} else {
+				rep.Removed++
+				rep.Freed += it.Size
+				removed = append(removed, it.Path)
+			}
+		}
+		rep.Items = append(rep.Items, it)
+	}
+	if len(removed) > 0 {
+		a.event("info", "gc", "removed %d leftover(s) of deleted sites (%d bytes): %s",
+			len(removed), rep.Freed, strings.Join(removed, ", "))
+	}
+	return rep, nil
+}
+
+// gcSubdirs lists the directories in dir (none when it does not exist).
+func gcSubdirs(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		if e.IsDir() {
+			out = append(out, filepath.Join(dir, e.Name()))
+		}
+	}
+	return out
+}
+
+// gcSize is the size of path (its regular files summed, for a directory) and its
+// newest modification time.
+func gcSize(path string) (int64, time.Time, error) {
+	var size int64
+	var mod time.Time
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		if fi.ModTime().After(mod) {
+			mod = fi.ModTime()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("read %s: %w", path, err)
+	}
+	return size, mod, nil
+}
+
+// RunGC runs GC with gc.grace every gc.interval until ctx is done.
+func (a *App) RunGC(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.GC.Interval)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := a.GC(a.cfg.GC.GraceDuration(), false); err != nil && ctx.Err() == nil {
+			log.Printf("gc: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
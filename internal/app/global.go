@@ -0,0 +1,141 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+)
+
+// GlobalFile is one managed snippet in the global include dir (conf/ngm.d).
+type GlobalFile struct {
+	Name    string
+	Content string
+	Changed bool // differs from the live file (or is new)
+	Removed bool // live file is no longer rendered
+}
+
+type GlobalResult struct {
+	Files    []GlobalFile
+	Changed  []string
+	Reloaded bool
+
+	// Warning is set when nginx does not load the global dir.
+	Warning string
+
+	// Diagnostics is what nginx logged when the test/reload failed.
+	Diagnostics string
+}
+
+// globalTemplateData maps cfg.Global onto the template input (maps are sorted
+// so re-renders are byte-identical).
+func (a *App) globalTemplateData() nginx.GlobalTemplateData {
+	g := a.cfg.Global
+	td := nginx.GlobalTemplateData{
+		CacheRoot:     strings.TrimRight(g.CacheRoot, "/"),
+		RealIP:        nginx.RealIPCfg{Header: g.RealIP.Header, From: g.RealIP.From, Recursive: g.RealIP.Recursive},
+		DefaultServer: g.DefaultServer,
+		ACMEWebroot:   a.paths.ACMEWebroot,
+	}
+	if a.cfg.Saturation.Enabled {
+		td.StatusListen = a.cfg.Saturation.StatusListen
+	}
+	for _, z := range g.RateLimits {
+		td.RateLimits = append(td.RateLimits, nginx.RateLimitZone{Name: z.Name, Key: z.Key, Size: z.Size, Rate: z.Rate})
+	}
+	for _, gm := range g.Geo {
+		m := nginx.GeoMap{Var: gm.Var, Default: gm.Default}
+		for cidr, v := range gm.Entries {
+			m.Entries = append(m.Entries, nginx.GeoEntry{CIDR: cidr, Value: v})
+		}
+		sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].CIDR < m.Entries[j].CIDR })
+		td.Geo = append(td.Geo, m)
+	}
+	for name, f := range g.LogFormats {
+		td.LogFormats = append(td.LogFormats, nginx.LogFormat{Name: name, Format: f})
+	}
+	sort.Slice(td.LogFormats, func(i, j int) bool { return td.LogFormats[i].Name < td.LogFormats[j].Name })
+	return td
+}
+
+// GlobalApply renders cfg.global into the managed include dir through the same
+// staging -> backup -> publish -> nginx -t -> reload pipeline as vhosts. A failed
+// test or reload restores the previous snippets. dry only renders and diffs.
+func (a *App) GlobalApply(ctx context.Context, dry bool) (GlobalResult, error) {
+	var res GlobalResult
+	release, err := a.lockApply("global apply", false)
+	if err != nil {
+		return res, err
+	}
+	defer release()
+
+	if err := a.ng.CheckGlobalIncluded(); err != nil {
+		res.Warning = err.Error()
+	}
+
+	a.applyStep("rendering global snippets")
+	staged, err := a.ng.RenderGlobalToStaging(a.globalTemplateData())
+	if err != nil {
+		return res, err
+	}
+	keep := map[string]bool{}
+	for _, name := range staged {
+		keep[name] = true
+		data, err := os.ReadFile(filepath.Join(a.paths.NginxStageDir, "ngm.d", name))
+		if err != nil {
+			return res, err
+		}
+		live, lerr := os.ReadFile(filepath.Join(a.paths.NginxGlobalDir, name))
+		res.Files = append(res.Files, GlobalFile{Name: name, Content: string(data), Changed: lerr != nil || !bytes.Equal(live, data)})
+	}
+	live, _ := filepath.Glob(filepath.Join(a.paths.NginxGlobalDir, "*.conf"))
+	for _, f := range live {
+		if name := filepath.Base(f); !keep[name] {
+			res.Files = append(res.Files, GlobalFile{Name: name, Removed: true})
+		}
+	}
+	if dry {
+		return res, nil
+	}
+
+	touched, err := a.ng.PublishGlobal(staged)
+	if err != nil {
+		a.ng.RestoreGlobalFromBackup(touched...)
+		return res, err
+	}
+	if len(touched) == 0 {
+		return res, nil
+	}
+
+	since := time.Now()
+	if a.cfg.Nginx.Apply.TestBeforeReload {
+		a.applyStep("nginx -t")
+		if err := a.ng.TestConfig(); err != nil {
+			res.Diagnostics = a.reloadDiagnostics(ctx, since)
+			a.ng.RestoreGlobalFromBackup(touched...)
+			a.event("error", "global", "global apply failed, nginx -t (rolled back): %v", err)
+			return res, fmt.Errorf("nginx -t failed (rolled back): %w", err)
+		}
+	}
+	if running, _, _ := a.nginxAlive(ctx); running {
+		a.applyStep("reloading nginx")
+		if err := a.ng.Reload(); err != nil {
+			res.Diagnostics = a.reloadDiagnostics(ctx, since)
+			a.ng.RestoreGlobalFromBackup(touched...)
+			_ = a.ng.Reload()
+			a.event("error", "global", "global apply failed, nginx reload (rolled back): %v", err)
+			return res, fmt.Errorf("nginx reload failed (rolled back): %w", err)
+		}
+		res.Reloaded = true
+	}
+
+	res.Changed = touched
+	a.event("info", "global", "global snippets applied: %s", strings.Join(touched, ", "))
+	return res, nil
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"mynginx/internal/fpm"
+)
+
+// hardenedPHPValues are the pool php_admin_values of the hardening preset.
+var hardenedPHPValues = map[string]string{
+	"allow_url_fopen":   "Off",
+	"allow_url_include": "Off",
+}
+
+// HardeningCheck is one line of a site's hardening checklist, read from the live
+// vhost and php-fpm pool (so it shows what is deployed, not what is configured).
+type HardeningCheck struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// SiteHarden turns the hardening preset of a php site on or off (see
+// store.Site.Hardened). An enabled site is re-applied; a failed apply restores the
+// previous setting.
+func (a *App) SiteHarden(ctx context.Context, domain string, on bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if on && site.Mode != "" && site.Mode != "php" {
+		return invalidf("the hardening preset is for php sites (%s is %s)", domain, site.Mode)
+	}
+	if site.Hardened == on {
+		return nil
+	}
+	if err := a.st.SetSiteHardened(domain, on); err != nil {
+		return err
+	}
+	if site.Enabled {
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+			if rerr := a.st.SetSiteHardened(domain, site.Hardened); rerr != nil {
+				return fmt.Errorf("hardening apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+			}
+			return fmt.Errorf("hardening apply failed (previous setting kept): %w", err)
+		}
+	}
+	state := "off"
+	if on {
+		state = "on"
+	}
+	a.event("info", "security", "%s: hardening preset %s", domain, state)
+	return nil
+}
+
+// SiteHardening is the hardening checklist of a php site.
+func (a *App) SiteHardening(ctx context.Context, domain string) ([]HardeningCheck, error) {
+	_ = ctx
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "" && site.Mode != "php" {
+		return nil, invalidf("the hardening checklist is for php sites (%s is %s)", domain, site.Mode)
+	}
+
+	conf := string(a.liveConf(domain))
+	vhost := func(name, detail string, needles ...string) HardeningCheck {
+		c := HardeningCheck{Name: name, OK: conf != "", Detail: detail}
+		for _, n := range needles {
+			c.OK = c.OK && strings.Contains(conf, n)
+		}
+		if conf == "" {
+			c.Detail = "no live vhost (apply the site)"
+		}
+		return c
+	}
+	out := []HardeningCheck{
+		vhost("server_tokens off", "nginx version hidden from headers and error pages", "server_tokens off;"),
+		vhost("httpoxy", "Proxy: request header not passed to PHP as HTTP_PROXY", "fastcgi_param HTTP_PROXY"),
+		vhost("no php.ini injection", "PHP_VALUE / PHP_ADMIN_VALUE params blanked", "fastcgi_param PHP_VALUE", "fastcgi_param PHP_ADMIN_VALUE"),
+		vhost("no PHP in uploads", "*.php under uploads/, files/, media/ denied", "wp-content/uploads|uploads|files|media"),
+		vhost("no PATH_INFO execution", "only existing .php files are passed to php-fpm", "try_files $uri =404;"),
+	}
+
+	var settings map[string]string
+	if ver, ok := a.cfg.PHPFPM.Versions[site.PHPVersion]; ok {
+		if data, err := os.ReadFile(fpm.PoolFilePath(ver.PoolsDir, domain)); err == nil {
+			if pools := fpm.ParsePools(data); len(pools) > 0 {
+				settings = pools[0].Settings
+			}
+		}
+	}
+	pool := func(name, detail string, ok func(map[string]string) bool) HardeningCheck {
+		if settings == nil {
+			return HardeningCheck{Name: name, Detail: "no ngm php-fpm pool (apply the site)"}
+		}
+		return HardeningCheck{Name: name, OK: ok(settings), Detail: detail}
+	}
+	out = append(out,
+		pool("allow_url_fopen off", "PHP cannot open http:// / ftp:// URLs as files (SSRF)", func(s map[string]string) bool { return iniOff(s, "allow_url_fopen") }),
+		pool("allow_url_include off", "no include/require of remote URLs", func(s map[string]string) bool { return iniOff(s, "allow_url_include") }),
+		pool("expose_php off", "no X-Powered-By: PHP header", func(s map[string]string) bool { return iniOff(s, "expose_php") }),
+		pool("disable_functions", "shell execution functions disabled", func(s map[string]string) bool {
+			return strings.Contains(s["php_admin_value[disable_functions]"], "exec")
+		}),
+	)
+	return out, nil
+}
+
+// iniOff reports whether a pool turns the php.ini setting name off (admin value or flag).
+func iniOff(settings map[string]string, name string) bool {
+	for _, k := range []string{"php_admin_value[" + name + "]", "php_admin_flag[" + name + "]"} {
+		switch strings.ToLower(strings.TrimSpace(settings[k])) {
+		case "off", "0", "false", "no":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+var headerName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// reservedHeaders cannot be added: nginx or the vhost template already sets them.
+var reservedHeaders = map[string]bool{
+	"server": true, "date": true, "connection": true, "content-length": true,
+	"transfer-encoding": true, "x-cache-status": true, "alt-svc": true,
+}
+
+// SiteHeaders lists a site's custom response headers (names in canonical form).
+func (a *App) SiteHeaders(ctx context.Context, domain string) ([]store.SiteHeader, error) {
+	_ = ctx
+	site, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	hs, err := a.st.ListSiteHeaders(site.ID)
+	for i := range hs {
+		hs[i].Name = http.CanonicalHeaderKey(hs[i].Name)
+	}
+	return hs, err
+}
+
+// SiteHeaderSet adds a response header to every response of the site, or with
+// hide strips it from FastCGI (php) / proxied responses (e.g. X-Powered-By).
+// Hiding "Server" turns server_tokens off (nginx only drops its version).
+// An existing header of that name is replaced.
+func (a *App) SiteHeaderSet(ctx context.Context, domain, name, value string, hide bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = strings.TrimSpace(value)
+
+	if !headerName.MatchString(name) || len(name) > 64 {
+		return invalidf("invalid header name %q", name)
+	}
+	if hide {
+		value = ""
+	} else {
+		if reservedHeaders[name] {
+			return invalidf("header %s is set by nginx/ngm and cannot be added", http.CanonicalHeaderKey(name))
+		}
+		if value == "" {
+			return invalidf("header value is required (or hide the header)")
+		}
+		if len(value) > 1024 || strings.IndexFunc(value, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+			return invalidf("invalid value for header %s", http.CanonicalHeaderKey(name))
+		}
+	}
+
+	prev, err := a.siteHeader(domain, name)
+	if err != nil {
+		return err
+	}
+	h := store.SiteHeader{Name: name, Value: value, Hide: hide}
+	if prev != nil && *prev == h {
+		return nil
+	}
+	if err := a.st.SetSiteHeader(domain, h); err != nil {
+		return err
+	}
+	return a.applyHeaders(ctx, domain, name, prev)
+}
+
+// SiteHeaderRemove drops a custom header from the site.
+func (a *App) SiteHeaderRemove(ctx context.Context, domain, name string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	prev, err := a.siteHeader(domain, name)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		return fmt.Errorf("%s has no header %s: %w", domain, http.CanonicalHeaderKey(name), sql.ErrNoRows)
+	}
+	if err := a.st.DeleteSiteHeader(domain, name); err != nil {
+		return err
+	}
+	return a.applyHeaders(ctx, domain, name, prev)
+}
+
+func (a *App) siteHeader(domain, name string) (*store.SiteHeader, error) {
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	hs, err := a.st.ListSiteHeaders(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range hs {
+		if h.Name == name {
+			return &h, nil
+		}
+	}
+	return nil, nil
+}
+
+// applyHeaders applies an enabled site after a header change and puts prev back
+// (nil = no such header before) if that fails.
+func (a *App) applyHeaders(ctx context.Context, domain, name string, prev *store.SiteHeader) error {
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		var rerr error
+		if prev != nil {
+			rerr = a.st.SetSiteHeader(domain, *prev)
+		} else if derr := a.st.DeleteSiteHeader(domain, name); derr != nil && !errors.Is(derr, sql.ErrNoRows) {
+			rerr = derr
+		}
+		if rerr != nil {
+			return fmt.Errorf("header apply failed: %v (restoring previous headers also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("header apply failed (previous headers kept): %w", err)
+	}
+	return nil
+}
+
+// headerTemplateData splits stored headers into vhost headers and server_tokens.
+func headerTemplateData(hs []store.SiteHeader) (out []nginx.HeaderCfg, serverTokensOff bool) {
+	for _, h := range hs {
+		if h.Hide && h.Name == "server" {
+			serverTokensOff = true
+			continue
+		}
+		out = append(out, nginx.HeaderCfg{Name: http.CanonicalHeaderKey(h.Name), Value: h.Value, Hide: h.Hide})
+	}
+	return out, serverTokensOff
+}
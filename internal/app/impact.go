@@ -0,0 +1,271 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/stats"
+	"mynginx/internal/store"
+)
+
+// ApplyImpact is what a reload is about to change: computed after the vhosts are
+// published and before nginx -t/reload, and stored with the apply run.
+type ApplyImpact struct {
+	Sites     []SiteImpact
+	Listeners []string // e.g. "+ 443/udp quic reuseport", "~ 443/tcp: backlog=511 -> backlog=4096"
+	Zones     []string // shared memory zones added, removed or resized
+	Restart   bool     // some change only takes effect after a full restart (see Reasons)
+	Reasons   []string
+	ReqPerMin float64 // recent traffic of the changed sites (those with an access log)
+}
+
+// SiteImpact is one changed vhost.
+type SiteImpact struct {
+	Domain    string
+	Action    string // apply|delete
+	Added     int    // config lines added / removed against the live file
+	Removed   int
+	ReqPerMin float64 // over the last trafficWindow of its access log; -1 = unknown
+}
+
+// trafficWindow is how far back the logs are read for traffic figures.
+const trafficWindow = 15 * time.Minute
+
+// confChange is a vhost before (nil = new) and after (nil = removed) publishing.
+type confChange struct {
+	site   store.Site
+	action string
+	before []byte
+	after  []byte
+}
+
+// Socket options nginx only sets when it creates a listening socket; changing them
+// on an existing listener needs a restart (a reload keeps the inherited socket).
+var restartListenOpts = map[string]bool{"reuseport": true, "ipv6only": true, "bind": true, "setfib": true}
+
+// Other socket-level listen options (applied to inherited sockets on reload).
+var reloadListenOpts = map[string]bool{
+	"backlog": true, "rcvbuf": true, "sndbuf": true, "deferred": true,
+	"fastopen": true, "so_keepalive": true, "accept_filter": true,
+}
+
+var (
+	listenLine = regexp.MustCompile(`(?m)^\s*listen\s+([^;]+);`)
+	zoneParam  = regexp.MustCompile(`(?:^|\s)(?:keys_)?zone=([^:\s;]+):([^\s;]+)`)
+	zoneLine   = regexp.MustCompile(`(?m)^\s*zone\s+(\S+)\s+([^\s;]+)\s*;`)
+)
+
+// applyImpact compares the live vhost set before and after changes (the live
+// dir already holds the after state).
+func (a *App) applyImpact(changes []confChange) *ApplyImpact {
+	if len(changes) == 0 {
+		return nil
+	}
+	after := map[string][]byte{}
+	files, _ := filepath.Glob(filepath.Join(a.paths.NginxSitesDir, "*.conf"))
+	for _, f := range files {
+		if data, err := os.ReadFile(f); err == nil {
+			after[strings.TrimSuffix(filepath.Base(f), ".conf")] = data
+		}
+	}
+	before := map[string][]byte{}
+	for d, data := range after {
+		before[d] = data
+	}
+
+	imp := &ApplyImpact{}
+	for _, c := range changes {
+		d := c.site.Domain
+		if c.before == nil {
+			delete(before, d)
+		} else {
+			before[d] = c.before
+		}
+		si := SiteImpact{Domain: d, Action: c.action, ReqPerMin: -1}
+		si.Added, si.Removed = lineDiff(c.before, c.after)
+		if rate, err := stats.RequestsPerMinute(siteAccessLog(c.site), trafficWindow, time.Now()); err == nil {
+			si.ReqPerMin = rate
+			imp.ReqPerMin += rate
+		}
+		imp.Sites = append(imp.Sites, si)
+	}
+	sort.Slice(imp.Sites, func(i, j int) bool { return imp.Sites[i].Domain < imp.Sites[j].Domain })
+
+	listenersBefore, listenersAfter := listeners(before), listeners(after)
+	for _, key := range unionKeys(listenersBefore, listenersAfter) {
+		was, inBefore := listenersBefore[key]
+		now, inAfter := listenersAfter[key]
+		switch {
+		case !inBefore:
+			imp.Listeners = append(imp.Listeners, strings.TrimSpace("+ "+key+" "+strings.Join(now, " ")))
+		case !inAfter:
+			imp.Listeners = append(imp.Listeners, "- "+key)
+		case strings.Join(was, " ") != strings.Join(now, " "):
+			imp.Listeners = append(imp.Listeners, fmt.Sprintf("~ %s: %s -> %s", key, optsString(was), optsString(now)))
+			if restartOpts(was) != restartOpts(now) {
+				imp.Restart = true
+				imp.Reasons = append(imp.Reasons, fmt.Sprintf("listener %s: %s -> %s (nginx keeps the existing socket on reload)",
+					key, optsString(restartOptList(was)), optsString(restartOptList(now))))
+			}
+		}
+	}
+
+	zonesBefore, zonesAfter := zones(before), zones(after)
+	for _, name := range unionKeys(zonesBefore, zonesAfter) {
+		was, inBefore := zonesBefore[name]
+		now, inAfter := zonesAfter[name]
+		switch {
+		case !inBefore:
+			imp.Zones = append(imp.Zones, "+ "+name+" "+now)
+		case !inAfter:
+			imp.Zones = append(imp.Zones, "- "+name)
+		case was != now:
+			imp.Zones = append(imp.Zones, fmt.Sprintf("~ %s %s -> %s (re-created on reload: its cache index / counters start empty)", name, was, now))
+		}
+	}
+	return imp
+}
+
+// add folds the impact of a later batch of the same apply into i.
+func (i *ApplyImpact) add(o *ApplyImpact) {
+	if o == nil {
+		return
+	}
+	i.Sites = append(i.Sites, o.Sites...)
+	sort.Slice(i.Sites, func(a, b int) bool { return i.Sites[a].Domain < i.Sites[b].Domain })
+	i.Listeners = append(i.Listeners, o.Listeners...)
+	i.Zones = append(i.Zones, o.Zones...)
+	i.Restart = i.Restart || o.Restart
+	i.Reasons = append(i.Reasons, o.Reasons...)
+	i.ReqPerMin += o.ReqPerMin
+}
+
+// listeners maps "addr/tcp|udp" to the sorted socket-level options declared for it
+// in any of the configs (nginx takes them from whichever server declares them).
+func listeners(confs map[string][]byte) map[string][]string {
+	out := map[string][]string{}
+	for _, data := range confs {
+		for _, m := range listenLine.FindAllSubmatch(data, -1) {
+			fields := strings.Fields(string(m[1]))
+			proto := "tcp"
+			var opts []string
+			for _, f := range fields[1:] {
+				name, _, _ := strings.Cut(f, "=")
+				switch {
+				case f == "quic":
+					proto = "udp"
+					opts = append(opts, f)
+				case restartListenOpts[name] || reloadListenOpts[name]:
+					opts = append(opts, f)
+				}
+			}
+			key := fields[0] + "/" + proto
+			out[key] = mergeOpts(out[key], opts)
+		}
+	}
+	return out
+}
+
+func mergeOpts(have, add []string) []string {
+	for _, o := range add {
+		found := false
+		for _, h := range have {
+			found = found || h == o
+		}
+		if !found {
+			have = append(have, o)
+		}
+	}
+	sort.Strings(have)
+	return have
+}
+
+func restartOptList(opts []string) []string {
+	var out []string
+	for _, o := range opts {
+		if name, _, _ := strings.Cut(o, "="); restartListenOpts[name] {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+func restartOpts(opts []string) string {
+	return strings.Join(restartOptList(opts), " ")
+}
+
+func optsString(opts []string) string {
+	if len(opts) == 0 {
+		return "(none)"
+	}
+	return strings.Join(opts, " ")
+}
+
+// zones maps shared memory zone names to their size (keys_zone=, zone= and the
+// upstream zone directive).
+func zones(confs map[string][]byte) map[string]string {
+	out := map[string]string{}
+	for _, data := range confs {
+		for _, m := range zoneParam.FindAllSubmatch(data, -1) {
+			out[string(m[1])] = string(m[2])
+		}
+		for _, m := range zoneLine.FindAllSubmatch(data, -1) {
+			out[string(m[1])] = string(m[2])
+		}
+	}
+	return out
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lineDiff counts lines only in after (added) and only in before (removed),
+// ignoring order and blank lines.
+func lineDiff(before, after []byte) (added, removed int) {
+	count := map[string]int{}
+	for _, l := range bytes.Split(before, []byte("\n")) {
+		if l := strings.TrimSpace(string(l)); l != "" {
+			count[l]++
+		}
+	}
+	for _, l := range bytes.Split(after, []byte("\n")) {
+		if l := strings.TrimSpace(string(l)); l != "" {
+			count[l]--
+		}
+	}
+	for _, n := range count {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return added, removed
+}
+
+// siteAccessLog is the access log the vhost template writes for s.
+func siteAccessLog(s store.Site) string {
+	return filepath.Join(filepath.Dir(s.Webroot), "logs", "access.log")
+}
+
+// siteUpstreamLog is the per-attempt upstream log of a proxy site (stats.UpstreamLogFormat).
+func siteUpstreamLog(s store.Site) string {
+	return filepath.Join(filepath.Dir(s.Webroot), "logs", "upstream.log")
+}
@@ -0,0 +1,18 @@
+package app
+
+import "fmt"
+
+// ValidationError is returned for rejected input (a bad domain, mode, address…),
+// so callers can tell user mistakes from failures with errors.As.
+type ValidationError struct {
+	err error
+}
+
+func (e *ValidationError) Error() string { return e.err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.err }
+
+// invalidf is fmt.Errorf for input validation errors.
+func invalidf(format string, args ...any) error {
+	return &ValidationError{err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// Kinds of background job (store.Job.Kind).
+const (
+	JobCertIssue = "cert_issue"
+	JobCertRenew = "cert_renew"
+	JobApply     = "apply"
+)
+
+// jobPollInterval is how often RunJobs looks for queued jobs without a nudge
+// (e.g. jobs queued by another process).
+const jobPollInterval = 30 * time.Second
+
+// jobParams are the options of a job beyond its target domain.
+type jobParams struct {
+	All   bool `json:"all,omitempty"`
+	Limit int  `json:"limit,omitempty"`
+}
+
+// JobView is a job with what it is doing right now (the step of the apply it
+// holds the lock for, while it runs).
+type JobView struct {
+	store.Job
+	Step string
+}
+
+// Finished reports whether the job is done or failed.
+func (j JobView) Finished() bool {
+	return j.Status == store.JobDone || j.Status == store.JobFailed
+}
+
+// EnqueueCertIssue queues the issuance of domain's certificate (then an apply of
+// the site), as CertIssue.
+func (a *App) EnqueueCertIssue(domain, actor string) (store.Job, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return store.Job{}, invalidf("domain is required")
+	}
+	return a.enqueueJob(store.Job{Kind: JobCertIssue, Target: domain, Actor: actor}, jobParams{})
+}
+
+// EnqueueCertRenew queues the renewal of domain's certificate, or of every
+// certificate with all, then an apply, as CertRenew.
+func (a *App) EnqueueCertRenew(domain string, all bool, actor string) (store.Job, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" && !all {
+		return store.Job{}, invalidf("domain is required (or all)")
+	}
+	if all {
+		domain = ""
+	}
+	return a.enqueueJob(store.Job{Kind: JobCertRenew, Target: domain, Actor: actor}, jobParams{All: all})
+}
+
+// EnqueueApply queues an apply of req.Domain or all sites. Dry runs are quick and
+// are not queued.
+func (a *App) EnqueueApply(req ApplyRequest) (store.Job, error) {
+	domain := strings.ToLower(strings.TrimSpace(req.Domain))
+	switch {
+	case req.DryRun:
+		return store.Job{}, invalidf("dry runs are not queued")
+	case domain == "" && !req.All:
+		return store.Job{}, invalidf("domain is required (or all)")
+	case req.Limit < 0:
+		return store.Job{}, invalidf("limit must be >= 0")
+	}
+	if req.All {
+		domain = ""
+	}
+	return a.enqueueJob(store.Job{Kind: JobApply, Target: domain, Actor: req.Actor}, jobParams{All: req.All, Limit: req.Limit})
+}
+
+func (a *App) enqueueJob(j store.Job, p jobParams) (store.Job, error) {
+	if p != (jobParams{}) {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return store.Job{}, err
+		}
+		j.Params = string(b)
+	}
+	id, err := a.st.CreateJob(j)
+	if err != nil {
+		return store.Job{}, err
+	}
+	select {
+	case a.jobWake <- struct{}{}:
+	default:
+	}
+	return a.st.GetJob(id)
+}
+
+// Job returns job id with the current step of a running one.
+func (a *App) Job(id int64) (JobView, error) {
+	j, err := a.st.GetJob(id)
+	if err != nil {
+		return JobView{}, err
+	}
+	v := JobView{Job: j}
+	if j.Status == store.JobRunning {
+		if st := a.ApplyStatus(); st.Running {
+			v.Step = st.Step
+		}
+	}
+	return v, nil
+}
+
+// Jobs returns the newest jobs.
+func (a *App) Jobs(limit int) ([]store.Job, error) {
+	return a.st.ListJobs(limit)
+}
+
+// RunJobs works off the job queue, one job at a time, until ctx is done. Jobs
+// left running by a previous `ngm serve` are failed first: whether they finished
+// is unknown, so they are not run twice.
+func (a *App) RunJobs(ctx context.Context) {
+	if n, err := a.st.FailRunningJobs("interrupted: ngm serve stopped while it ran"); err != nil {
+		log.Printf("jobs: %v", err)
+	} else if n > 0 {
+		a.event("warning", "jobs", "%d job(s) interrupted by a restart marked failed", n)
+	}
+	t := time.NewTicker(jobPollInterval)
+	defer t.Stop()
+	for {
+		for ctx.Err() == nil {
+			j, err := a.st.ClaimJob()
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				log.Printf("jobs: %v", err)
+				break
+			}
+			a.runJob(ctx, j)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.jobWake:
+		case <-t.C:
+		}
+	}
+}
+
+// runJob carries out a claimed job and records how it ended.
+func (a *App) runJob(ctx context.Context, j store.Job) {
+	var p jobParams
+	var runID int64
+	err := json.Unmarshal([]byte(paramsJSON(j.Params)), &p)
+	if err == nil {
+		switch j.Kind {
+		case JobCertIssue:
+			err = a.CertIssue(ctx, j.Target, true)
+		case JobCertRenew:
+			err = a.CertRenew(ctx, j.Target, p.All, true)
+		case JobApply:
+			var res ApplyResult
+			progress := func(pr ApplyProgress) {
+				msg := fmt.Sprintf("batch %d: %d/%d sites", pr.Batch, pr.Done, pr.Total)
+				if err := a.st.SetJobProgress(j.ID, msg); err != nil {
+					log.Printf("jobs: progress #%d: %v", j.ID, err)
+				}
+			}
+			res, err = a.Apply(ctx, ApplyRequest{Domain: j.Target, All: p.All, Limit: p.Limit, Actor: j.Actor, Progress: progress})
+			runID = res.RunID
+		default:
+			err = fmt.Errorf("unknown job kind %q", j.Kind)
+		}
+	}
+
+	status, msg := store.JobDone, ""
+	if err != nil {
+		status, msg = store.JobFailed, err.Error()
+		a.event("error", "jobs", "%s: job #%d (%s) failed: %v", jobSubject(j), j.ID, j.Kind, err)
+	}
+	if err := a.st.FinishJob(j.ID, status, msg, runID); err != nil {
+		log.Printf("jobs: finish #%d: %v", j.ID, err)
+	}
+}
+
+// paramsJSON is params, or an empty JSON object for a job without options.
+func paramsJSON(params string) string {
+	if params == "" {
+		return "{}"
+	}
+	return params
+}
+
+// jobSubject is what a job acts on, as event messages start with it.
+func jobSubject(j store.Job) string {
+	if j.Target != "" {
+		return j.Target
+	}
+	return "all sites"
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Limits of a followed site log (FollowSiteLog).
+const (
+	FollowPoll     = 500 * time.Millisecond // how often the log is checked
+	FollowMaxLines = 100                    // lines passed on per check; older ones are skipped
+	followMaxBytes = 256 << 10              // read per check; older appended bytes are skipped
+)
+
+// LogChunk is what a check of a followed log found.
+type LogChunk struct {
+	Lines        []LogLine
+	Skipped      int   // lines left out: more were appended than a check passes on
+	SkippedBytes int64 // appended bytes not read at all, for the same reason
+	Rotated      bool  // the log was rotated or truncated and is read from its start again
+}
+
+// LogFollow reads the lines appended to a site log from the moment it is followed,
+// across rotation and truncation, with the sandboxing of SiteLogTail on every open.
+type LogFollow struct {
+	Domain string
+	Log    string
+	Path   string
+
+	f       *os.File
+	fi      fs.FileInfo
+	off     int64
+	partial []byte // an unterminated last line, completed by the next write
+}
+
+// FollowSiteLog starts following the log name (see SiteLogs) of domain at its
+// current end. A log that does not exist yet is picked up once it appears.
+func (a *App) FollowSiteLog(domain, name string) (*LogFollow, error) {
+	l := &LogFollow{Log: name}
+	var err error
+	if l.Domain, l.Path, err = a.siteLogPath(domain, name); err != nil {
+		return nil, err
+	}
+	f, fi, err := openSiteLog(l.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.f, l.fi, l.off = f, fi, fi.Size()
+	return l, nil
+}
+
+// Next returns the lines appended since the last call (none is not an error).
+func (l *LogFollow) Next() (LogChunk, error) {
+	var c LogChunk
+	if l.f != nil {
+		if err := l.read(&c); err != nil {
+			return c, err
+		}
+	}
+	// rotated away (or not there yet): finish the old file above, then switch
+	fi, err := os.Lstat(l.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if l.fi != nil && os.SameFile(l.fi, fi) {
+		return c, nil
+	}
+	f, fi, err := openSiteLog(l.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if l.f != nil {
+		l.f.Close()
+		c.Rotated = true
+	}
+	l.f, l.fi, l.off, l.partial = f, fi, 0, nil
+	return c, l.read(&c)
+}
+
+// read adds what was appended to the open file to c.
+func (l *LogFollow) read(c *LogChunk) error {
+	fi, err := l.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if size < l.off {
+		// truncated in place (copytruncate): start over
+		l.off, l.partial, c.Rotated = 0, nil, true
+	}
+	if size == l.off {
+		return nil
+	}
+	from, cut := l.off, false
+	if size-from > followMaxBytes {
+		from, cut = size-followMaxBytes, true
+	}
+	buf := make([]byte, size-from)
+	n, err := l.f.ReadAt(buf, from)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	skipped := from - l.off
+	l.off = from + int64(n)
+	if cut {
+		// the older bytes and the partial line they end in are skipped
+		c.SkippedBytes += skipped
+		l.partial = nil
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			c.SkippedBytes += int64(i + 1)
+			buf, n = buf[i+1:], n-i-1
+		} else {
+			c.SkippedBytes += int64(n)
+			buf, n = nil, 0
+		}
+	}
+	buf = buf[:n]
+	data := append(l.partial, buf...)
+	l.partial = nil
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		l.partial = append([]byte(nil), data[i+1:]...)
+		data = data[:i+1]
+		if len(l.partial) > followMaxBytes {
+			// a line that long is passed on as it is
+			data, l.partial = append(data, append(l.partial, '\n')...), nil
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	if len(lines) > FollowMaxLines {
+		c.Skipped += len(lines) - FollowMaxLines
+		lines = lines[len(lines)-FollowMaxLines:]
+	}
+	for _, b := range lines {
+		c.Lines = append(c.Lines, LogLine{Text: string(b), Level: logLevel(l.Log, string(b))})
+	}
+	return nil
+}
+
+// Close closes the followed log.
+func (l *LogFollow) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
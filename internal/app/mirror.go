@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SiteMirror copies percent% of a proxy site's requests to a shadow target (nginx mirror).
+// Mirrored responses are discarded, so the shadow backend never affects clients.
+// An empty target turns mirroring off. Like SiteCutover, the change is applied right
+// away when the site is enabled and reverted if the apply fails.
+func (a *App) SiteMirror(ctx context.Context, domain, target string, percent int) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	target = strings.TrimSpace(target)
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "proxy" {
+		return fmt.Errorf("site is not in proxy mode")
+	}
+
+	if target == "" {
+		percent = 0
+	} else {
+		if strings.ContainsAny(target, " \t;{}\"'$") {
+			return invalidf("invalid mirror target %q", target)
+		}
+		if percent < 1 || percent > 100 {
+			return invalidf("mirror percent must be between 1 and 100")
+		}
+	}
+	if site.MirrorTarget == target && site.MirrorPercent == percent {
+		return nil
+	}
+
+	prevTarget, prevPercent := site.MirrorTarget, site.MirrorPercent
+	if err := a.st.SetSiteMirror(domain, target, percent); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteMirror(domain, prevTarget, prevPercent); rerr != nil {
+			return fmt.Errorf("mirror apply failed: %v (restoring previous mirror also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("mirror apply failed (previous setting kept): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// CertExpiry is the expiry of one certificate, as exported on /metrics.
+type CertExpiry struct {
+	Domain   string
+	Lineage  string
+	NotAfter time.Time
+}
+
+// SiteCheck is the latest availability check of an enabled site.
+type SiteCheck struct {
+	Domain    string
+	Location  string
+	OK        bool
+	Latency   time.Duration
+	CheckedAt time.Time
+}
+
+// SiteMetrics is the site-level state /metrics exports next to the store metrics.
+type SiteMetrics struct {
+	Sites        int
+	SitesEnabled int
+	Certs        []CertExpiry
+	Checks       []SiteCheck
+
+	// Finish time of the newest successful and failed apply runs (zero = none in
+	// the recent history); dry runs are not counted.
+	LastApplyOK   time.Time
+	LastApplyFail time.Time
+
+	// States counts sites by list state (OK, PENDING, ERROR, DISABLED).
+	States map[string]int
+
+	// Applies and the nginx reload counters are of this process (ngm serve) since
+	// it started.
+	Applies        ApplyStats
+	Reloads        int64
+	ReloadFailures int64
+}
+
+// ApplyBuckets are the upper bounds of the apply duration histogram.
+var ApplyBuckets = []time.Duration{
+	time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute,
+}
+
+// ApplyStats counts Apply calls by result ("ok", "failed", "dry_run", "busy") and
+// times the ones that ran. Buckets[i] counts the runs that took at most
+// ApplyBuckets[i].
+type ApplyStats struct {
+	Results map[string]int64
+	Count   int64
+	Total   time.Duration
+	Buckets []int64
+}
+
+// applyMetrics accumulates ApplyStats.
+type applyMetrics struct {
+	mu sync.Mutex
+	st ApplyStats
+}
+
+func (m *applyMetrics) observe(err error, dryRun bool, took time.Duration) {
+	result := "ok"
+	switch {
+	case errors.Is(err, ErrApplyBusy):
+		result = "busy"
+	case err != nil:
+		result = "failed"
+	case dryRun:
+		result = "dry_run"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.st.Results == nil {
+		m.st.Results = map[string]int64{}
+		m.st.Buckets = make([]int64, len(ApplyBuckets))
+	}
+	m.st.Results[result]++
+	if result == "busy" {
+		return
+	}
+	m.st.Count++
+	m.st.Total += took
+	for i, le := range ApplyBuckets {
+		if took <= le {
+			m.st.Buckets[i]++
+		}
+	}
+}
+
+func (m *applyMetrics) snapshot() ApplyStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := ApplyStats{Results: map[string]int64{}, Count: m.st.Count, Total: m.st.Total, Buckets: make([]int64, len(ApplyBuckets))}
+	for k, v := range m.st.Results {
+		out.Results[k] = v
+	}
+	copy(out.Buckets, m.st.Buckets)
+	return out
+}
+
+// applyMetricsRuns is how many recent apply runs SiteMetrics looks at.
+const applyMetricsRuns = 100
+
+// SiteMetrics collects certificate expiry, the latest uptime checks and the apply
+// outcome for the Prometheus endpoint.
+func (a *App) SiteMetrics() (SiteMetrics, error) {
+	var m SiteMetrics
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return m, err
+	}
+	latest, err := a.st.LatestHealthChecks()
+	if err != nil {
+		return m, err
+	}
+	m.Sites = len(sites)
+	rows, err := a.st.ListSiteRows(store.SiteListOptions{})
+	if err != nil {
+		return m, err
+	}
+	m.States = map[string]int{"OK": 0, "PENDING": 0, "ERROR": 0, "DISABLED": 0}
+	for _, r := range rows {
+		m.States[r.State]++
+	}
+	m.Applies = a.applyStats.snapshot()
+	m.Reloads, m.ReloadFailures = a.ng.ReloadCounts()
+	for _, s := range sites {
+		if !s.Enabled {
+			continue
+		}
+		m.SitesEnabled++
+		if c, ok := latest[s.ID]; ok {
+			m.Checks = append(m.Checks, SiteCheck{
+				Domain:    s.Domain,
+				Location:  c.Location,
+				OK:        c.OK,
+				Latency:   time.Duration(c.LatencyMS) * time.Millisecond,
+				CheckedAt: c.CheckedAt,
+			})
+		}
+	}
+
+	list, err := a.CertList()
+	if err != nil {
+		return m, err
+	}
+	for _, c := range list {
+		if c.Exists {
+			m.Certs = append(m.Certs, CertExpiry{Domain: c.Domain, Lineage: c.Lineage, NotAfter: c.NotAfter})
+		}
+	}
+
+	runs, err := a.st.ListApplyRuns(applyMetricsRuns)
+	if err != nil {
+		return m, err
+	}
+	for _, r := range runs {
+		if r.DryRun {
+			continue
+		}
+		if r.Error == "" && m.LastApplyOK.IsZero() {
+			m.LastApplyOK = r.FinishedAt
+		}
+		if r.Error != "" && m.LastApplyFail.IsZero() {
+			m.LastApplyFail = r.FinishedAt
+		}
+	}
+	return m, nil
+}
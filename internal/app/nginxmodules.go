@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mynginx/internal/nginx"
+)
+
+// modulesSettingKey holds the enabled dynamic modules (comma separated).
+const modulesSettingKey = "nginx_modules"
+
+// NginxModule is a dynamic module as this nginx has it, and whether the panel
+// loads it.
+type NginxModule struct {
+	nginx.ModuleCap
+	Enabled bool
+}
+
+// enabledModules returns the module names saved by NginxModuleSet.
+func (a *App) enabledModules() (map[string]bool, error) {
+	v, _, err := a.st.GetSetting(modulesSettingKey)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]bool{}
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			out[n] = true
+		}
+	}
+	return out, nil
+}
+
+// NginxModulesConf is the managed include holding the load_module lines.
+func (a *App) NginxModulesConf() string {
+	return a.ng.ModulesConf()
+}
+
+// NginxModules lists the known dynamic modules with their capability on this
+// nginx (installed, compiled in) and whether they are enabled.
+func (a *App) NginxModules() ([]NginxModule, error) {
+	caps, err := a.ng.ModuleCaps()
+	if err != nil {
+		return nil, err
+	}
+	on, err := a.enabledModules()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NginxModule, 0, len(caps))
+	for _, c := range caps {
+		out = append(out, NginxModule{ModuleCap: c, Enabled: on[c.Name]})
+	}
+	return out, nil
+}
+
+// NginxModuleSet enables or disables loading a dynamic module: the load_module
+// lines of every enabled module are rendered into the managed include at the top
+// of nginx.conf (wired in on first use), checked with nginx -t and reloaded. A
+// failed test or reload restores the previous include and nginx.conf.
+func (a *App) NginxModuleSet(ctx context.Context, name string, enable bool) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	mods, err := a.NginxModules()
+	if err != nil {
+		return err
+	}
+	var mod *NginxModule
+	for i := range mods {
+		if mods[i].Name == name {
+			mod = &mods[i]
+		}
+	}
+	switch {
+	case mod == nil:
+		var names []string
+		for _, m := range nginx.DynamicModules {
+			names = append(names, m.Name)
+		}
+		return invalidf("unknown module %q (want %s)", name, strings.Join(names, ", "))
+	case mod.Enabled == enable:
+		return nil
+	case enable && mod.BuiltIn:
+		return invalidf("%s is compiled into this nginx: there is nothing to load", name)
+	case enable && !mod.Installed:
+		return invalidf("%s is not installed: %s not found in %s", name, strings.Join(mod.Files, ", "), mod.Dir)
+	}
+
+	release, err := a.lockApply("nginx modules", false)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	mod.Enabled = enable
+	var load []nginx.ModuleCap
+	var names []string
+	for _, m := range mods {
+		if m.Enabled {
+			load = append(load, m.ModuleCap)
+			names = append(names, m.Name)
+		}
+	}
+	if err := a.ng.PublishModulesConf(load); err != nil {
+		a.ng.RestoreModulesConf()
+		return err
+	}
+	bak, err := a.ng.WireModules()
+	if err != nil {
+		a.ng.RestoreModulesConf()
+		return err
+	}
+	rollback := func() {
+		a.ng.RestoreModulesConf()
+		if bak != "" {
+			_ = a.ng.RestoreMainConf(bak)
+		}
+	}
+
+	if err := a.ng.TestConfig(); err != nil {
+		rollback()
+		a.event("error", "nginx", "module %s: nginx -t failed (rolled back): %v", name, err)
+		return fmt.Errorf("nginx -t failed (rolled back): %w", err)
+	}
+	if running, _, _ := a.nginxAlive(ctx); running {
+		if err := a.ng.Reload(); err != nil {
+			rollback()
+			_ = a.ng.Reload()
+			a.event("error", "nginx", "module %s: nginx reload failed (rolled back): %v", name, err)
+			return fmt.Errorf("nginx reload failed (rolled back): %w", err)
+		}
+	}
+	if err := a.st.SetSetting(modulesSettingKey, strings.Join(names, ",")); err != nil {
+		return err
+	}
+	verb, loaded := "disabled", strings.Join(names, ", ")
+	if enable {
+		verb = "enabled"
+	}
+	if loaded == "" {
+		loaded = "none"
+	}
+	a.event("info", "nginx", "module %s %s (loaded: %s)", name, verb, loaded)
+	return nil
+}
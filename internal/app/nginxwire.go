@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"fmt"
+)
+
+// NginxWire adds the sites_dir and global dir includes to the main nginx.conf (with a backup),
+// then tests and reloads nginx; a failed test restores the backup.
+func (a *App) NginxWire(ctx context.Context) (changed bool, err error) {
+	release, err := a.lockApply("nginx wire", false)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	bak, err := a.ng.WireSites()
+	if err != nil || bak == "" {
+		return false, err
+	}
+	if err := a.ng.TestConfig(); err != nil {
+		if rerr := a.ng.RestoreMainConf(bak); rerr != nil {
+			return false, fmt.Errorf("nginx -t failed: %v; restoring %s also failed: %w", err, bak, rerr)
+		}
+		return false, fmt.Errorf("nginx -t failed (nginx.conf restored): %w", err)
+	}
+	a.event("info", "nginx", "wired %s and %s into %s (backup: %s)", a.paths.NginxGlobalDir, a.paths.NginxSitesDir, a.paths.NginxMainConf, bak)
+	if running, _, _ := a.nginxAlive(ctx); running {
+		if err := a.ng.Reload(); err != nil {
+			return true, fmt.Errorf("include added but nginx reload failed: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// CheckSitesIncluded reports whether the main nginx.conf loads sites_dir.
+func (a *App) CheckSitesIncluded() error {
+	return a.ng.CheckSitesIncluded()
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// VhostOrigin traces a vhost file back to what published it.
+type VhostOrigin struct {
+	File    string
+	Stamped bool        // the file has a stamp header
+	Stamp   nginx.Stamp // the header (RenderHash falls back to the hash of the content)
+	// Edited is set when the config below the header no longer hashes to the stamp:
+	// someone changed the file after ngm published it.
+	Edited bool
+	// Publishes are the indexed publishes of the render hash, newest first.
+	Publishes []store.VhostStamp
+	// Run is the apply run that wrote this header (the newest publish for a file
+	// without one); nil when it is no longer kept.
+	Run *store.ApplyRun
+}
+
+// VhostOrigin reads the stamp header of file (or of the live vhost of domain when
+// file is empty) and looks its render hash up in the stamp index.
+func (a *App) VhostOrigin(file, domain string) (VhostOrigin, error) {
+	if strings.TrimSpace(file) == "" {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			return VhostOrigin{}, invalidf("file or domain is required")
+		}
+		file, _ = a.ng.SiteConfPaths(domain)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return VhostOrigin{}, fmt.Errorf("read %s: %w", file, err)
+	}
+
+	o := VhostOrigin{File: file}
+	body := nginx.StripStamp(data)
+	o.Stamp, o.Stamped = nginx.ParseStamp(data)
+	if !o.Stamped {
+		o.Stamp.RenderHash = util.Sha256Hex(body)
+	}
+	o.Edited = util.Sha256Hex(body) != o.Stamp.RenderHash
+
+	o.Publishes, err = a.st.FindVhostStamps(o.Stamp.RenderHash)
+	if err != nil {
+		return o, fmt.Errorf("find stamps: %w", err)
+	}
+	if len(o.Publishes) == 0 {
+		return o, nil
+	}
+	pub := o.Publishes[0]
+	for _, p := range o.Publishes {
+		if o.Stamped && p.StampedAt.Unix() == o.Stamp.Time.Unix() {
+			pub = p
+			break
+		}
+	}
+	if pub.RunID > 0 {
+		if run, err := a.st.GetApplyRun(pub.RunID); err == nil {
+			run.Result = nil
+			o.Run = &run
+		}
+	}
+	return o, nil
+}
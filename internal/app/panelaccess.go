@@ -0,0 +1,39 @@
+package app
+
+import (
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// PanelUserOwner is the hosting user whose sites a role=user panel account
+// manages: its hosting_user link, or the hosting user with the account's name.
+func PanelUserOwner(u store.PanelUser) string {
+	if h := strings.TrimSpace(u.HostingUser); h != "" {
+		return h
+	}
+	return u.Username
+}
+
+// SiteOwner returns the hosting user name of domain's site ("" when it has none)
+// and whether the site exists at all.
+func (a *App) SiteOwner(domain string) (string, bool) {
+	s, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return "", false
+	}
+	if s.UserID == 0 {
+		return "", true
+	}
+	u, err := a.st.GetUserByID(s.UserID)
+	if err != nil {
+		return "", true
+	}
+	return u.Username, true
+}
+
+// SiteOwnedBy reports whether domain is a site of the hosting user owner.
+func (a *App) SiteOwnedBy(domain, owner string) bool {
+	o, ok := a.SiteOwner(domain)
+	return ok && owner != "" && o == owner
+}
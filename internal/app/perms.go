@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mynginx/internal/users"
+)
+
+// SiteFixPerms resets the ownership and modes of a site tree to the provisioning
+// model (owner = the site's user, group = hosting.web_group, dirs 0750, files 0640),
+// the fix for files uploaded as root that php-fpm can no longer write. With dryRun
+// it only reports what would change.
+func (a *App) SiteFixPerms(ctx context.Context, domain string, dryRun bool) (users.PermReport, error) {
+	_ = ctx
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if a.cfg.Sandbox != "" {
+		return users.PermReport{}, invalidf("fix-perms needs real system users (not available in the sandbox)")
+	}
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return users.PermReport{}, fmt.Errorf("get site: %w", err)
+	}
+	u, err := a.st.GetUserByID(site.UserID)
+	if err != nil {
+		return users.PermReport{}, err
+	}
+	rep, err := users.FixSiteTree(u.Username, site.Webroot, a.cfg.Hosting.WebGroup, dryRun)
+	if err != nil {
+		return rep, fmt.Errorf("%s: %w", domain, err)
+	}
+	if !dryRun && len(rep.Changes) > 0 {
+		a.event("info", "site", "%s: fixed ownership/permissions of %d of %d path(s) under %s",
+			domain, len(rep.Changes), rep.Checked, rep.SiteRoot)
+	}
+	return rep, nil
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mynginx/internal/fpm"
+	"mynginx/internal/health"
+	"mynginx/internal/store"
+)
+
+// phpMigrateSettle is how long a batch is given after its applies (php-fpm reloads
+// gracefully) before its sites are health-checked.
+const phpMigrateSettle = 3 * time.Second
+
+// PHPMigrateRequest moves the php sites on From (optionally only those tagged Tag) to
+// To, Batch sites at a time.
+type PHPMigrateRequest struct {
+	From   string
+	To     string
+	Tag    string
+	Batch  int // sites per batch (0 = 5)
+	DryRun bool
+}
+
+// PHPMigrateSite is the outcome for one site.
+type PHPMigrateSite struct {
+	Domain string
+	Batch  int
+	Status string // migrated|would-migrate|skipped|failed|rolled-back|not-attempted
+	Detail string
+}
+
+// PHPMigrateReport is what PHPMigrate did, site by site.
+type PHPMigrateReport struct {
+	From, To string
+	Tag      string
+	DryRun   bool
+	Batches  int
+	Sites    []PHPMigrateSite
+	// Stopped is why the migration stopped before the last batch ("" = it did not).
+	Stopped string
+}
+
+// Count is the number of sites with status.
+func (r PHPMigrateReport) Count(status string) int {
+	n := 0
+	for _, s := range r.Sites {
+		if s.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// PHPMigrate switches the matching sites from one PHP version to another in batches.
+// Each site of a batch is switched and applied (which writes its pool for the new
+// version); the enabled ones that answered a health check before are checked again.
+// A failed apply or check rolls the whole batch back to the old version and stops;
+// a healthy batch gets its old pools removed before the next one starts. Sites whose
+// owner's plan does not allow the new version are skipped.
+func (a *App) PHPMigrate(ctx context.Context, req PHPMigrateRequest) (PHPMigrateReport, error) {
+	from, to := strings.TrimSpace(req.From), strings.TrimSpace(req.To)
+	tag := strings.ToLower(strings.TrimSpace(req.Tag))
+	rep := PHPMigrateReport{From: from, To: to, Tag: tag, DryRun: req.DryRun}
+	if from == "" || to == "" || from == to {
+		return rep, invalidf("need two different PHP versions (--from and --to)")
+	}
+	if _, ok := a.cfg.PHPFPM.Versions[to]; !ok {
+		return rep, invalidf("PHP %s is not in phpfpm.versions", to)
+	}
+	size := req.Batch
+	if size <= 0 {
+		size = 5
+	}
+
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return rep, err
+	}
+	var todo []store.Site
+	for _, s := range sites {
+		if (s.Mode != "" && s.Mode != "php") || s.PHPVersion != from || (tag != "" && !hasTag(s.Tags, tag)) {
+			continue
+		}
+		u, err := a.st.GetUserByID(s.UserID)
+		if err != nil {
+			return rep, err
+		}
+		if err := a.checkPHPAllowed(u, to); err != nil {
+			if !errors.Is(err, ErrPlanLimit) {
+				return rep, err
+			}
+			rep.Sites = append(rep.Sites, PHPMigrateSite{Domain: s.Domain, Status: "skipped", Detail: err.Error()})
+			continue
+		}
+		todo = append(todo, s)
+	}
+	rep.Batches = (len(todo) + size - 1) / size
+	if req.DryRun {
+		for i, s := range todo {
+			rep.Sites = append(rep.Sites, PHPMigrateSite{Domain: s.Domain, Batch: i/size + 1, Status: "would-migrate"})
+		}
+		return rep, nil
+	}
+	if len(todo) == 0 {
+		return rep, nil
+	}
+
+	a.event("info", "php", "migrating %d site(s) from PHP %s to %s in %d batch(es)", len(todo), from, to, rep.Batches)
+	checker := health.NewChecker(a.cfg.Health, a.st, nil)
+	for lo := 0; lo < len(todo); lo += size {
+		hi := min(lo+size, len(todo))
+		rest := lo
+		if ctx.Err() != nil {
+			rep.Stopped = ctx.Err().Error()
+		} else {
+			out, stop := a.phpMigrateBatch(ctx, checker, todo[lo:hi], lo/size+1, from, to)
+			rep.Sites = append(rep.Sites, out...)
+			if stop != "" {
+				rep.Stopped = fmt.Sprintf("batch %d: %s", lo/size+1, stop)
+			}
+			rest = hi
+		}
+		if rep.Stopped != "" {
+			for i, s := range todo[rest:] {
+				rep.Sites = append(rep.Sites, PHPMigrateSite{Domain: s.Domain, Batch: (rest+i)/size + 1, Status: "not-attempted"})
+			}
+			a.event("error", "php", "PHP %s -> %s migration stopped (%s); %d site(s) migrated", from, to, rep.Stopped, rep.Count("migrated"))
+			return rep, nil
+		}
+	}
+	a.event("info", "php", "PHP %s -> %s migration done: %d site(s) migrated", from, to, rep.Count("migrated"))
+	return rep, nil
+}
+
+// phpMigrateBatch switches, applies and checks one batch. It returns the outcome of
+// each site and, when the batch was rolled back, why.
+func (a *App) phpMigrateBatch(ctx context.Context, checker *health.Checker, batch []store.Site, n int, from, to string) ([]PHPMigrateSite, string) {
+	out := make([]PHPMigrateSite, len(batch))
+	upBefore := make([]bool, len(batch))
+	for i, s := range batch {
+		out[i] = PHPMigrateSite{Domain: s.Domain, Batch: n}
+		if s.Enabled {
+			upBefore[i] = checker.Check(ctx, s).OK
+		}
+	}
+
+	stop := ""
+	switched := 0
+	for i, s := range batch {
+		if err := a.setSitePHP(s.Domain, to); err != nil {
+			out[i].Status, out[i].Detail = "failed", err.Error()
+			stop = fmt.Sprintf("%s: %v", s.Domain, err)
+			break
+		}
+		switched = i + 1
+		if !s.Enabled {
+			continue
+		}
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+			out[i].Status, out[i].Detail = "failed", err.Error()
+			stop = fmt.Sprintf("%s: apply: %v", s.Domain, err)
+			break
+		}
+	}
+
+	if stop == "" {
+		select {
+		case <-ctx.Done():
+		case <-time.After(phpMigrateSettle):
+		}
+		for i, s := range batch {
+			if !upBefore[i] {
+				if s.Enabled {
+					out[i].Detail = "not checked (was down before)"
+				}
+				continue
+			}
+			if res := checker.Check(ctx, s); !res.OK {
+				out[i].Status, out[i].Detail = "failed", "health check: "+res.Error
+				if stop == "" {
+					stop = fmt.Sprintf("%s: health check: %s", s.Domain, res.Error)
+				}
+			}
+		}
+	}
+
+	if stop != "" {
+		for i, s := range batch[:switched] {
+			if err := a.rollbackSitePHP(ctx, s, from, to); err != nil {
+				out[i].Detail = strings.TrimPrefix(out[i].Detail+"; ", "; ") + "rollback failed: " + err.Error()
+				a.event("error", "php", "%s: rollback to PHP %s failed: %v", s.Domain, from, err)
+				continue
+			}
+			if out[i].Status == "" {
+				out[i].Status = "rolled-back"
+			}
+		}
+		for i := range out[switched:] {
+			if out[switched+i].Status == "" {
+				out[switched+i].Status = "not-attempted"
+			}
+		}
+		return out, stop
+	}
+
+	var domains []string
+	for i, s := range batch {
+		out[i].Status = "migrated"
+		domains = append(domains, s.Domain)
+	}
+	a.removeOldPools(domains, from, to)
+	a.event("info", "php", "batch %d on PHP %s: %s", n, to, strings.Join(domains, ", "))
+	return out, ""
+}
+
+// setSitePHP changes the PHP version of a site (marking it pending).
+func (a *App) setSitePHP(domain, phpv string) error {
+	cur, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	cur.PHPVersion = phpv
+	_, err = a.st.UpsertSite(cur)
+	return err
+}
+
+// rollbackSitePHP puts a site back on from and removes the pool written for to.
+func (a *App) rollbackSitePHP(ctx context.Context, s store.Site, from, to string) error {
+	if err := a.setSitePHP(s.Domain, from); err != nil {
+		return err
+	}
+	if s.Enabled {
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+			return fmt.Errorf("apply: %w", err)
+		}
+	}
+	a.removeOldPools([]string{s.Domain}, to, from)
+	return nil
+}
+
+// removeOldPools deletes the pools of domains for version old after they moved to
+// version cur, then reloads old's php-fpm once. Nothing is removed when both versions
+// share a pools directory (the pool file was rewritten in place).
+func (a *App) removeOldPools(domains []string, old, cur string) {
+	ov, ok := a.cfg.PHPFPM.Versions[old]
+	if !ok || ov.PoolsDir == a.cfg.PHPFPM.Versions[cur].PoolsDir {
+		return
+	}
+	removed := 0
+	for _, d := range domains {
+		err := os.Remove(fpm.PoolFilePath(ov.PoolsDir, d))
+		switch {
+		case err == nil:
+			removed++
+		case !os.IsNotExist(err):
+			a.event("warning", "php", "%s: remove PHP %s pool: %v", d, old, err)
+		}
+	}
+	if removed == 0 {
+		return
+	}
+	if err := fpm.ReloadService(a.run, a.timeouts.Systemctl, ov.Service); err != nil {
+		a.event("warning", "php", "reload %s after removing %d pool(s): %v", ov.Service, removed, err)
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// placeholderMode reports whether a site mode serves a webroot, and so can show the
+// placeholder page until it has content.
+func placeholderMode(mode string) bool {
+	return mode == "" || mode == "php" || mode == "static"
+}
+
+// SitePlaceholder turns the "coming soon" page of a php/static site on or off. It is
+// only served while the webroot is empty, and `ngm serve` turns it off once content
+// is deployed (see SweepPlaceholders). An enabled site is re-applied.
+func (a *App) SitePlaceholder(ctx context.Context, domain string, on bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if on && !placeholderMode(site.Mode) {
+		return invalidf("a placeholder needs a php or static site (%s is %s)", domain, site.Mode)
+	}
+	if site.Placeholder == on {
+		return nil
+	}
+	if err := a.st.SetSitePlaceholder(domain, on); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSitePlaceholder(domain, site.Placeholder); rerr != nil {
+			return fmt.Errorf("placeholder apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("placeholder apply failed (previous setting kept): %w", err)
+	}
+	return nil
+}
+
+// placeholderFor renders the placeholder page of s when it should be served (flag
+// on, a webroot mode, nothing deployed yet) and returns its directory; "" otherwise.
+func (a *App) placeholderFor(s store.Site, domain string) (string, error) {
+	if !s.Placeholder || !placeholderMode(s.Mode) || !webrootEmpty(s.Webroot) {
+		return "", nil
+	}
+	page, err := nginx.RenderPlaceholder(a.cfg.Hosting.Placeholder.Template, nginx.PlaceholderData{Domain: domain})
+	if err != nil {
+		return "", err
+	}
+	dir := a.placeholderDir(domain)
+	if err := util.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(dir, "index.html"), page, 0644); err != nil {
+		return "", fmt.Errorf("write placeholder page: %w", err)
+	}
+	return dir, nil
+}
+
+func (a *App) placeholderDir(domain string) string {
+	return filepath.Join(a.paths.NginxRoot, "conf", "placeholder", domain)
+}
+
+// webrootEmpty reports whether dir has nothing deployed: missing, or only dotfiles
+// (.well-known, .htaccess leftovers and the like do not count as content).
+func webrootEmpty(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// SweepPlaceholders retires the placeholder of every site whose webroot now has
+// content, or which moved to a mode without a webroot: the flag is cleared and an
+// enabled site re-applied, so the real vhost goes live.
+func (a *App) SweepPlaceholders(ctx context.Context) error {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	for _, s := range sites {
+		if !s.Placeholder {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		why := ""
+		switch {
+		case !placeholderMode(s.Mode):
+			why = "site is now " + s.Mode
+		case !webrootEmpty(s.Webroot):
+			why = "content deployed"
+		default:
+			continue
+		}
+		if err := a.st.SetSitePlaceholder(s.Domain, false); err != nil {
+			log.Printf("placeholder %s: %v", s.Domain, err)
+			continue
+		}
+		if s.Enabled {
+			if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+				a.event("error", "placeholder", "%s: placeholder retired (%s), but applying the site failed: %v", s.Domain, why, err)
+				continue
+			}
+		}
+		_ = os.RemoveAll(a.placeholderDir(s.Domain))
+		a.event("info", "placeholder", "%s: placeholder retired (%s)", s.Domain, why)
+	}
+	return nil
+}
+
+// RunPlaceholders sweeps placeholders every hosting.placeholder.interval until ctx is done.
+func (a *App) RunPlaceholders(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.Hosting.Placeholder.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := a.SweepPlaceholders(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("placeholder: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// ErrPlanLimit is wrapped by every quota violation so callers can detect it with errors.Is.
+var ErrPlanLimit = errors.New("plan limit")
+
+// UserUsage is a hosting user with their plan (if any) and current usage, for listings.
+type UserUsage struct {
+	User  store.User
+	Plan  *store.Plan
+	Sites int
+}
+
+// planForUser returns the user's plan, or nil when no plan is assigned.
+func (a *App) planForUser(u store.User) (*store.Plan, error) {
+	if u.PlanID == 0 {
+		return nil, nil
+	}
+	p, err := a.st.GetPlanByID(u.PlanID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// checkSiteQuota fails when adding one more site would exceed the user's plan.
+func (a *App) checkSiteQuota(u store.User) error {
+	p, err := a.planForUser(u)
+	if err != nil || p == nil || p.MaxSites == 0 {
+		return err
+	}
+	n, err := a.st.CountSitesByUserID(u.ID)
+	if err != nil {
+		return err
+	}
+	if n >= p.MaxSites {
+		return fmt.Errorf("%w: user %q has %d of %d sites allowed by plan %q", ErrPlanLimit, u.Username, n, p.MaxSites, p.Name)
+	}
+	return nil
+}
+
+// checkPHPAllowed fails when the plan restricts PHP versions and phpv is not among them.
+func (a *App) checkPHPAllowed(u store.User, phpv string) error {
+	p, err := a.planForUser(u)
+	if err != nil || p == nil || len(p.PHPVersions) == 0 {
+		return err
+	}
+	for _, v := range p.PHPVersions {
+		if v == phpv {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: PHP %s is not allowed by plan %q (allowed: %s)", ErrPlanLimit, phpv, p.Name, strings.Join(p.PHPVersions, ", "))
+}
+
+// checkTargetQuota fails when the site already has as many enabled targets as the plan allows.
+func (a *App) checkTargetQuota(u store.User, siteID int64, target string) error {
+	p, err := a.planForUser(u)
+	if err != nil || p == nil || p.MaxProxyTargets == 0 {
+		return err
+	}
+	ts, err := a.st.ListProxyTargetsBySiteID(siteID)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, t := range ts {
+		if t.Addr == target {
+			return nil // updating an existing target never raises usage
+		}
+		if t.Enabled {
+			n++
+		}
+	}
+	if n >= p.MaxProxyTargets {
+		return fmt.Errorf("%w: site already has %d of %d proxy targets allowed by plan %q", ErrPlanLimit, n, p.MaxProxyTargets, p.Name)
+	}
+	return nil
+}
+
+// ProxyTargetUpsert adds or updates an upstream target of a proxy site, enforcing the owner's plan.
+// group places the target in a blue/green group ("" = shared by all groups).
+func (a *App) ProxyTargetUpsert(ctx context.Context, domain, target string, weight int, backup, enabled bool, group string) error {
+	_ = ctx
+	site, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return err
+	}
+	if site.Mode != "proxy" {
+		return fmt.Errorf("site is not in proxy mode")
+	}
+	if enabled {
+		u, err := a.st.GetUserByID(site.UserID)
+		if err != nil {
+			return err
+		}
+		if err := a.checkTargetQuota(u, site.ID, target); err != nil {
+			return err
+		}
+	}
+	group = strings.ToLower(strings.TrimSpace(group))
+	if group != "" && !validGroupName(group) {
+		return invalidf("invalid target group %q (letters, digits, - and _ only)", group)
+	}
+	return a.st.UpsertProxyTarget(site.ID, target, weight, backup, enabled, group)
+}
+
+// ---------------- plan management ----------------
+
+func (a *App) PlanList() ([]store.Plan, error) {
+	return a.st.ListPlans()
+}
+
+// PlanSave validates and creates/updates a plan by name.
+func (a *App) PlanSave(p store.Plan) (store.Plan, error) {
+	for _, v := range p.PHPVersions {
+		if _, ok := a.cfg.PHPFPM.Versions[v]; !ok && len(a.cfg.PHPFPM.Versions) > 0 {
+			return store.Plan{}, fmt.Errorf("unknown PHP version %q (not in phpfpm.versions)", v)
+		}
+	}
+	return a.st.UpsertPlan(p)
+}
+
+func (a *App) PlanDelete(name string) error {
+	return a.st.DeletePlan(name)
+}
+
+// UserSetPlan assigns planName to a hosting user; an empty name removes the plan.
+// Existing sites are kept even if they exceed the new plan (limits are enforced on change).
+func (a *App) UserSetPlan(username, planName string) error {
+	u, err := a.st.GetUserByUsername(strings.TrimSpace(username))
+	if err != nil {
+		return fmt.Errorf("user %q: %w", username, err)
+	}
+	var planID int64
+	if strings.TrimSpace(planName) != "" {
+		p, err := a.st.GetPlanByName(planName)
+		if err != nil {
+			return fmt.Errorf("plan %q: %w", planName, err)
+		}
+		planID = p.ID
+	}
+	return a.st.SetUserPlan(u.ID, planID)
+}
+
+// UserUsageList returns all hosting users with plan and site counts.
+func (a *App) UserUsageList() ([]UserUsage, error) {
+	users, err := a.st.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	plans, err := a.st.ListPlans()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int64]*store.Plan{}
+	for i := range plans {
+		byID[plans[i].ID] = &plans[i]
+	}
+	out := make([]UserUsage, 0, len(users))
+	for _, u := range users {
+		n, err := a.st.CountSitesByUserID(u.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, UserUsage{User: u, Plan: byID[u.PlanID], Sites: n})
+	}
+	return out, nil
+}
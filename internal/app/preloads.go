@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// maxPreloads caps a site's preloads: each one costs header bytes on every page.
+const maxPreloads = 16
+
+// preloadAs are the Link "as" destinations accepted for a preload.
+var preloadAs = map[string]bool{"style": true, "script": true, "font": true, "image": true, "fetch": true}
+
+// SitePreloads lists the resources a site announces with Link: rel=preload.
+func (a *App) SitePreloads(ctx context.Context, domain string) ([]store.SitePreload, error) {
+	_ = ctx
+	site, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	return a.st.ListSitePreloads(site.ID)
+}
+
+// SitePreloadSet announces rawURL (a path or https:// URL) as a preload of kind as on
+// the site's page responses: PHP responses, or everything the proxy location serves
+// except the static assets. Browsers start fetching it before the HTML arrives, and a
+// CDN in front sends it ahead as a 103 Early Hints response. Fonts are always
+// fetched in CORS mode, so they get crossorigin. An existing entry for the URL is
+// replaced.
+func (a *App) SitePreloadSet(ctx context.Context, domain, rawURL, as string, crossorigin bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	rawURL = strings.TrimSpace(rawURL)
+	as = strings.ToLower(strings.TrimSpace(as))
+
+	if err := validPreloadURL(rawURL); err != nil {
+		return err
+	}
+	if !preloadAs[as] {
+		return invalidf("invalid preload type %q (want style, script, font, image or fetch)", as)
+	}
+	if as == "font" {
+		crossorigin = true
+	}
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode == "static" || site.Mode == "redirect" {
+		return invalidf("preloads need a php or proxy site (%s is %s)", domain, site.Mode)
+	}
+	ps, err := a.st.ListSitePreloads(site.ID)
+	if err != nil {
+		return err
+	}
+	prev := findPreload(ps, rawURL)
+	if prev == nil && len(ps) >= maxPreloads {
+		return invalidf("%s already has %d preloads", domain, maxPreloads)
+	}
+	p := store.SitePreload{URL: rawURL, As: as, Crossorigin: crossorigin}
+	if prev != nil && *prev == p {
+		return nil
+	}
+	if err := a.st.SetSitePreload(domain, p); err != nil {
+		return err
+	}
+	return a.applyPreloads(ctx, site, rawURL, prev)
+}
+
+// SitePreloadRemove drops a preload from the site.
+func (a *App) SitePreloadRemove(ctx context.Context, domain, rawURL string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	rawURL = strings.TrimSpace(rawURL)
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	ps, err := a.st.ListSitePreloads(site.ID)
+	if err != nil {
+		return err
+	}
+	prev := findPreload(ps, rawURL)
+	if prev == nil {
+		return fmt.Errorf("%s has no preload %s: %w", domain, rawURL, sql.ErrNoRows)
+	}
+	if err := a.st.DeleteSitePreload(domain, rawURL); err != nil {
+		return err
+	}
+	return a.applyPreloads(ctx, site, rawURL, prev)
+}
+
+// validPreloadURL accepts an absolute path or https:// URL that can go into the Link
+// header and an nginx string as is.
+func validPreloadURL(raw string) error {
+	if raw == "" || len(raw) > 512 {
+		return invalidf("preload URL is required (at most 512 characters)")
+	}
+	if strings.ContainsAny(raw, " \t\"'\\<>,;$") || strings.IndexFunc(raw, func(r rune) bool { return r < 0x20 || r >= 0x7f }) >= 0 {
+		return invalidf("invalid preload URL %q (percent-encode spaces, quotes, commas, semicolons and $)", raw)
+	}
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return invalidf("invalid preload URL %q (want /path or https://host/path)", raw)
+	}
+	return nil
+}
+
+func findPreload(ps []store.SitePreload, rawURL string) *store.SitePreload {
+	for i := range ps {
+		if ps[i].URL == rawURL {
+			return &ps[i]
+		}
+	}
+	return nil
+}
+
+// applyPreloads applies an enabled site after a preload change and puts prev back
+// (nil = no such preload before) if that fails.
+func (a *App) applyPreloads(ctx context.Context, site store.Site, rawURL string, prev *store.SitePreload) error {
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: site.Domain}); err != nil {
+		var rerr error
+		if prev != nil {
+			rerr = a.st.SetSitePreload(site.Domain, *prev)
+		} else if derr := a.st.DeleteSitePreload(site.Domain, rawURL); derr != nil && !errors.Is(derr, sql.ErrNoRows) {
+			rerr = derr
+		}
+		if rerr != nil {
+			return fmt.Errorf("preload apply failed: %v (restoring previous preloads also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("preload apply failed (previous preloads kept): %w", err)
+	}
+	return nil
+}
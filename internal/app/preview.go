@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/nginx"
+)
+
+// PreviewInfo tells a site owner how to test the site here before switching DNS.
+type PreviewInfo struct {
+	Domain string
+	Host   string // preview hostname ("" = hosting.preview.domain not set)
+	URL    string
+	Cert   string // "letsencrypt" | "self-signed" (browsers warn until it is issued)
+	// CertError is why the preview certificate could not be issued (self-signed meanwhile).
+	CertError string
+	// HostsLines point the real domain at this server from /etc/hosts (hosting.preview.addresses).
+	HostsLines []string
+}
+
+// previewHost is the preview hostname of domain: one label under base, so a single
+// wildcard DNS record covers every site (shop.example.com -> shop-example-com.<base>).
+func previewHost(domain, base string) (string, error) {
+	label := strings.ReplaceAll(domain, ".", "-")
+	if len(label) > 63 {
+		return "", invalidf("%s is too long for a preview hostname (label over 63 characters)", domain)
+	}
+	return label + "." + strings.Trim(strings.ToLower(base), "."), nil
+}
+
+// SitePreview serves an enabled site on its preview hostname as well, for testing
+// before DNS points here. The vhost goes live with a self-signed certificate first,
+// then a Let's Encrypt one is issued for the preview hostname (HTTP-01 over the
+// wildcard DNS record) and the site re-applied; a failed issuance keeps the
+// self-signed one and is reported in CertError. Without hosting.preview.domain only
+// the hosts-file lines are returned.
+func (a *App) SitePreview(ctx context.Context, domain string) (PreviewInfo, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return PreviewInfo{}, fmt.Errorf("get site: %w", err)
+	}
+	out := PreviewInfo{Domain: domain, HostsLines: a.previewHostsLines(domain)}
+	base := a.cfg.Hosting.Preview.Domain
+	if base == "" {
+		return out, nil
+	}
+	if !site.Enabled {
+		return out, invalidf("%s is disabled; enable it to preview it", domain)
+	}
+	host, err := previewHost(domain, base)
+	if err != nil {
+		return out, err
+	}
+	out.Host, out.URL = host, "https://"+host+"/"
+
+	if site.PreviewHost != host {
+		if err := a.st.SetSitePreview(domain, host); err != nil {
+			return out, err
+		}
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+			if rerr := a.st.SetSitePreview(domain, site.PreviewHost); rerr != nil {
+				return out, fmt.Errorf("preview apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+			}
+			return out, fmt.Errorf("preview apply failed (previous setting kept): %w", err)
+		}
+		a.event("info", "preview", "%s: preview on %s", domain, host)
+	}
+
+	out.Cert = "self-signed"
+	if ci, err := a.certMgr().GetCertInfo(host); err == nil && ci.Exists {
+		out.Cert = "letsencrypt"
+		return out, nil
+	}
+	if err := a.issuePreviewCert(ctx, host); err != nil {
+		out.CertError = err.Error()
+		a.event("warning", "preview", "%s: preview certificate for %s not issued: %v", domain, host, err)
+		return out, nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		return out, fmt.Errorf("apply with the preview certificate: %w", err)
+	}
+	out.Cert = "letsencrypt"
+	return out, nil
+}
+
+func (a *App) issuePreviewCert(ctx context.Context, host string) error {
+	release, err := a.cluster.Lock(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if !a.cfg.Certs.SkipReachabilityCheck {
+		if err := certs.CheckHTTP01(ctx, host, a.paths.ACMEWebroot); err != nil {
+			return fmt.Errorf("HTTP-01 validation would fail (is *.%s pointed here?): %w", a.cfg.Hosting.Preview.Domain, err)
+		}
+	}
+	return a.certMgr().IssueCert(ctx, host)
+}
+
+// SitePreviewOff stops serving a site on its preview hostname and deletes the
+// preview certificate.
+func (a *App) SitePreviewOff(ctx context.Context, domain string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.PreviewHost == "" {
+		return nil
+	}
+	if err := a.st.SetSitePreview(domain, ""); err != nil {
+		return err
+	}
+	if site.Enabled {
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+			if rerr := a.st.SetSitePreview(domain, site.PreviewHost); rerr != nil {
+				return fmt.Errorf("preview apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+			}
+			return fmt.Errorf("preview apply failed (previous setting kept): %w", err)
+		}
+	}
+	if err := a.certMgr().DeleteCert(ctx, site.PreviewHost); err != nil {
+		a.event("warning", "preview", "%s: delete preview certificate %s: %v", domain, site.PreviewHost, err)
+	}
+	_ = os.RemoveAll(filepath.Join(a.paths.NginxRoot, "conf", "selfsigned", site.PreviewHost))
+	a.event("info", "preview", "%s: preview on %s removed", domain, site.PreviewHost)
+	return nil
+}
+
+// previewFor is the preview vhost config of host: its Let's Encrypt certificate once
+// issued, a self-signed one until then.
+func (a *App) previewFor(host string) (nginx.PreviewCfg, error) {
+	p := nginx.PreviewCfg{Host: host}
+	if ci, err := a.certMgr().GetCertInfo(host); err == nil && ci.Exists {
+		p.TLSCert, p.TLSKey = ci.CertPath, ci.KeyPath
+		return p, nil
+	}
+	cert, key, err := a.selfSignedCert(host)
+	if err != nil {
+		return nginx.PreviewCfg{}, err
+	}
+	p.TLSCert, p.TLSKey = cert, key
+	return p, nil
+}
+
+// previewHostsLines are the /etc/hosts lines that send domain here.
+func (a *App) previewHostsLines(domain string) []string {
+	var out []string
+	for _, ip := range a.cfg.Hosting.Preview.Addresses {
+		out = append(out, ip+" "+domain)
+	}
+	return out
+}
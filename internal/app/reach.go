@@ -0,0 +1,256 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// reachTimeout bounds each per-family probe (DNS, TCP, TLS and the HTTP answer).
+const reachTimeout = 10 * time.Second
+
+// FamilyReach is the outcome of reaching a site over one address family.
+type FamilyReach struct {
+	Family     string `json:"family"`  // "ipv4" | "ipv6"
+	Address    string `json:"address"` // first A/AAAA record ("" = none published)
+	OK         bool   `json:"ok"`
+	StatusCode int    `json:"status_code,omitempty"`
+	LatencyMS  int64  `json:"latency_ms,omitempty"`
+	Cert       string `json:"cert,omitempty"` // "match" | "mismatch" | "unknown" (no local cert to compare)
+	Error      string `json:"error,omitempty"`
+}
+
+// ReachReport is the post-apply reachability of a site over IPv4 and IPv6. A served
+// certificate that differs from the local one means the family routes to another box.
+type ReachReport struct {
+	Domain    string        `json:"domain"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Families  []FamilyReach `json:"families"`
+}
+
+// Mismatch reports whether the families disagree: one reachable and another not, or
+// one of them served a certificate that is not ours.
+func (r ReachReport) Mismatch() bool {
+	ok := 0
+	for _, f := range r.Families {
+		if f.Cert == "mismatch" {
+			return true
+		}
+		if f.OK {
+			ok++
+		}
+	}
+	return ok > 0 && ok < len(r.Families)
+}
+
+// SiteReachCheck resolves domain's A and AAAA records and fetches https://domain/ from
+// the first address of each family, then stores the report. A family without records
+// is left out; a domain with neither is an error.
+func (a *App) SiteReachCheck(ctx context.Context, domain string) (ReachReport, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	rep := ReachReport{Domain: domain, CheckedAt: time.Now()}
+
+	s, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return rep, fmt.Errorf("get site: %w", err)
+	}
+	local := a.localCertsDER(s)
+
+	for _, fam := range []struct{ name, network string }{{"ipv4", "ip4"}, {"ipv6", "ip6"}} {
+		lctx, cancel := context.WithTimeout(ctx, reachTimeout)
+		ips, _ := net.DefaultResolver.LookupIP(lctx, fam.network, domain)
+		cancel()
+		if len(ips) == 0 {
+			continue
+		}
+		rep.Families = append(rep.Families, probeFamily(ctx, domain, fam.name, ips[0], local))
+	}
+	if len(rep.Families) == 0 {
+		return rep, fmt.Errorf("%s has no A or AAAA records", domain)
+	}
+
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return rep, err
+	}
+	if err := a.st.SaveSiteReach(store.SiteReach{Domain: domain, CheckedAt: rep.CheckedAt, Report: body}); err != nil {
+		return rep, err
+	}
+	if rep.Mismatch() {
+		a.event("warning", "reach", "%s: IPv4 and IPv6 disagree (%s)", domain, reachSummary(rep))
+	}
+	return rep, nil
+}
+
+// SiteReach returns the stored reachability report of a domain.
+func (a *App) SiteReach(domain string) (ReachReport, error) {
+	r, err := a.st.GetSiteReach(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return ReachReport{}, err
+	}
+	var rep ReachReport
+	err = json.Unmarshal(r.Report, &rep)
+	return rep, err
+}
+
+// verifyReach checks the applied domains after a reload (nginx.apply.verify_reach).
+// Failures are recorded, never turned into apply errors: the config is valid, the
+// network in front of it may not be.
+func (a *App) verifyReach(ctx context.Context, domains []string) []ReachReport {
+	var (
+		mu  sync.Mutex
+		out []ReachReport
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, 8)
+	)
+	for _, d := range domains {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rep, err := a.SiteReachCheck(ctx, d)
+			if err != nil {
+				log.Printf("reach %s: %v", d, err)
+				return
+			}
+			mu.Lock()
+			out = append(out, rep)
+			mu.Unlock()
+		}(d)
+	}
+	wg.Wait()
+	return out
+}
+
+// localCertsDER is the leaf certificate (DER) the site should serve, plus the
+// alternate-key one of a dual-cert site.
+func (a *App) localCertsDER(s store.Site) [][]byte {
+	var paths []string
+	if ci, err := a.siteCertInfo(s); err == nil && ci != nil && ci.Exists {
+		paths = append(paths, ci.CertPath)
+	}
+	if s.DualCert {
+		if ci, err := a.CertAltInfo(s.Domain); err == nil && ci != nil && ci.Exists {
+			paths = append(paths, ci.CertPath)
+		}
+	}
+	var out [][]byte
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		if b, _ := pem.Decode(data); b != nil && b.Type == "CERTIFICATE" {
+			out = append(out, b.Bytes)
+		}
+	}
+	return out
+}
+
+// probeFamily fetches https://domain/ from ip with SNI and Host set to domain. Any
+// HTTP answer below 500 counts as reachable, as in the health checks.
+func probeFamily(ctx context.Context, domain, family string, ip net.IP, local [][]byte) FamilyReach {
+	fr := FamilyReach{Family: family, Address: ip.String()}
+	addr := net.JoinHostPort(ip.String(), "443")
+
+	var served []byte
+	dialer := &net.Dialer{Timeout: reachTimeout}
+	tr := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		// the certificate is compared with ours below; a self-signed fallback is still "reachable"
+		TLSClientConfig: &tls.Config{
+			ServerName:         domain,
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) > 0 {
+					served = cs.PeerCertificates[0].Raw
+				}
+				return nil
+			},
+		},
+		DisableKeepAlives: true,
+	}
+	defer tr.CloseIdleConnections()
+	client := &http.Client{
+		Transport:     tr,
+		Timeout:       reachTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+"/", nil)
+	if err != nil {
+		fr.Error = err.Error()
+		return fr
+	}
+	req.Header.Set("User-Agent", "ngm-reach/1")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	fr.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		fr.Error = reachErr(err)
+		return fr
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	fr.StatusCode = resp.StatusCode
+	fr.OK = resp.StatusCode < 500
+	if !fr.OK {
+		fr.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+
+	switch {
+	case served == nil || len(local) == 0:
+		fr.Cert = "unknown"
+	default:
+		fr.Cert = "mismatch"
+		for _, der := range local {
+			if bytes.Equal(der, served) {
+				fr.Cert = "match"
+				break
+			}
+		}
+	}
+	return fr
+}
+
+// reachErr drops the request URL prefix net/http adds, which only repeats the domain.
+func reachErr(err error) string {
+	msg := err.Error()
+	if i := strings.LastIndex(msg, "\": "); i >= 0 {
+		return msg[i+3:]
+	}
+	return msg
+}
+
+func reachSummary(rep ReachReport) string {
+	var parts []string
+	for _, f := range rep.Families {
+		st := "ok"
+		if !f.OK {
+			st = "unreachable"
+		}
+		if f.Cert == "mismatch" {
+			st += ", other certificate"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s: %s", f.Family, f.Address, st))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// SiteReapply sets the schedule of a site's re-render ("" = off). On each matching
+// minute `ngm serve` renders the vhost again and applies it only when the output
+// differs from the last applied one, so templates with time-based content (now,
+// readLines feeds) stay fresh without manual applies.
+func (a *App) SiteReapply(domain, expr string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	expr = strings.Join(strings.Fields(expr), " ")
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if expr != "" {
+		if _, err := parseCron(expr); err != nil {
+			return err
+		}
+	}
+	if site.ReapplyCron == expr {
+		return nil
+	}
+	if err := a.st.SetSiteReapply(domain, expr); err != nil {
+		return err
+	}
+	if expr == "" {
+		a.event("info", "reapply", "%s: scheduled re-render off", domain)
+	} else {
+		a.event("info", "reapply", "%s: scheduled re-render %q", domain, expr)
+	}
+	return nil
+}
+
+// SweepReapply re-renders the enabled sites whose schedule matches now and applies
+// those whose output changed. An unparsable schedule or a failed render is logged
+// and the site skipped.
+func (a *App) SweepReapply(ctx context.Context, now time.Time) error {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	proxyLister, _ := a.st.(proxyTargetLister)
+	for _, s := range sites {
+		if s.ReapplyCron == "" || !s.Enabled {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		spec, err := parseCron(s.ReapplyCron)
+		if err != nil {
+			log.Printf("reapply %s: %v", s.Domain, err)
+			continue
+		}
+		if !spec.match(now) {
+			continue
+		}
+		td, err := a.buildTemplateData(s, s.Domain, proxyLister)
+		if err != nil {
+			a.event("error", "reapply", "%s: scheduled re-render failed: %v", s.Domain, err)
+			continue
+		}
+		content, err := a.ng.RenderSite(td)
+		if err != nil {
+			a.event("error", "reapply", "%s: scheduled re-render failed: %v", s.Domain, err)
+			continue
+		}
+		if util.Sha256Hex(content) == s.LastRenderHash {
+			continue
+		}
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+			a.event("error", "reapply", "%s: rendered config changed, but the apply failed: %v", s.Domain, err)
+			continue
+		}
+		a.event("info", "reapply", "%s: rendered config changed, applied (schedule %q)", s.Domain, s.ReapplyCron)
+	}
+	return nil
+}
+
+// RunReapply runs SweepReapply at the start of every minute until ctx is done.
+func (a *App) RunReapply(ctx context.Context) {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if err := a.SweepReapply(ctx, next); err != nil && ctx.Err() == nil {
+			log.Printf("reapply: %v", err)
+		}
+	}
+}
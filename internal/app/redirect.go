@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// redirectCodes are the statuses a redirect site may answer with.
+var redirectCodes = map[int]bool{301: true, 302: true, 307: true, 308: true}
+
+// SiteRedirect sets where a redirect site sends its requests: target is an absolute
+// http(s) URL, code 301/302/307/308 (0 = 301), and keepPath appends the request URI
+// (old.example/a?b -> new.example/a?b) instead of landing everything on target.
+// The HTTP server redirects straight to target too; it keeps answering ACME
+// challenges, so the site still gets a certificate for the HTTPS redirect.
+// A redirect site is re-applied; a failed apply restores the previous target.
+func (a *App) SiteRedirect(ctx context.Context, domain, target string, code int, keepPath bool) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	target = strings.TrimSpace(target)
+	if code == 0 {
+		code = 301
+	}
+	if err := validRedirect(domain, target, code, keepPath); err != nil {
+		return err
+	}
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.RedirectURL == target && site.RedirectCode == code && site.RedirectKeepPath == keepPath {
+		return nil
+	}
+
+	if err := a.st.SetSiteRedirect(domain, target, code, keepPath); err != nil {
+		return err
+	}
+	if !site.Enabled || site.Mode != "redirect" {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteRedirect(domain, site.RedirectURL, site.RedirectCode, site.RedirectKeepPath); rerr != nil {
+			return fmt.Errorf("redirect apply failed: %v (restoring previous target also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("redirect apply failed (previous target kept): %w", err)
+	}
+	return nil
+}
+
+// validRedirect checks a redirect target: it is rendered unquoted into
+// `return <code> <target>`, so it must not contain anything nginx would parse.
+func validRedirect(domain, target string, code int, keepPath bool) error {
+	if !redirectCodes[code] {
+		return invalidf("invalid redirect status %d (want 301, 302, 307 or 308)", code)
+	}
+	if target == "" {
+		return invalidf("redirect mode requires a target URL")
+	}
+	if strings.ContainsAny(target, " \t\r\n;{}\"'$\\`") {
+		return invalidf("invalid redirect target %q", target)
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return invalidf("invalid redirect target %q (want an absolute http:// or https:// URL)", target)
+	}
+	if keepPath && (u.RawQuery != "" || u.Fragment != "") {
+		return invalidf("redirect target %q has a query; it cannot keep the request path", target)
+	}
+	if strings.EqualFold(u.Hostname(), domain) {
+		return invalidf("redirect target %q points back at %s", target, domain)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// errorLogTail is how much of the end of the error log is searched.
+	errorLogTail = 64 << 10
+	// diagLines caps the lines kept from each source.
+	diagLines = 40
+)
+
+// reloadDiagnostics collects what nginx logged about a failed test/reload that began
+// at since: the main error log lines written from then on and, with reload_mode
+// systemd, the unit's journal. `-s reload` only reports that the signal was sent, so
+// a reload that fails in the master is otherwise invisible.
+func (a *App) reloadDiagnostics(ctx context.Context, since time.Time) string {
+	var b strings.Builder
+	if lines := errorLogSince(a.paths.NginxErrorLog, since); len(lines) > 0 {
+		fmt.Fprintf(&b, "== %s ==\n%s\n", a.paths.NginxErrorLog, strings.Join(lines, "\n"))
+	}
+	if a.cfg.Nginx.Apply.ReloadMode == "systemd" {
+		ctx, cancel := context.WithTimeout(ctx, a.timeouts.Systemctl)
+		defer cancel()
+		res, err := a.run.Run(ctx, "journalctl", "-u", a.cfg.Supervisor.Service,
+			"--since", fmt.Sprintf("@%d", since.Add(-time.Second).Unix()),
+			"--no-pager", "-q", "-o", "short-iso", "-n", fmt.Sprint(diagLines))
+		if out := strings.TrimSpace(res.Stdout); err == nil && out != "" {
+			fmt.Fprintf(&b, "== journalctl -u %s ==\n%s\n", a.cfg.Supervisor.Service, out)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// errorLogSince returns the last lines of an nginx error log stamped at or after
+// since ("2006/01/02 15:04:05 [level] ..."; continuation lines follow their entry).
+func errorLogSince(path string, since time.Time) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if st, err := f.Stat(); err == nil && st.Size() > errorLogTail {
+		_, _ = f.Seek(-errorLogTail, io.SeekEnd)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+
+	cutoff := since.Add(-time.Second).Truncate(time.Second)
+	var out []string
+	keep := false
+	for _, l := range bytes.Split(data, []byte("\n")) {
+		line := string(l)
+		if len(line) >= 19 {
+			if t, err := time.ParseInLocation("2006/01/02 15:04:05", line[:19], time.Local); err == nil {
+				keep = !t.Before(cutoff)
+			}
+		}
+		if keep && strings.TrimSpace(line) != "" {
+			out = append(out, line)
+		}
+	}
+	if len(out) > diagLines {
+		out = out[len(out)-diagLines:]
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// siteRetiring reports whether s is disabled but still in its grace period, so its
+// vhost serves the retired page instead of being removed.
+func siteRetiring(s store.Site) bool {
+	return !s.Enabled && s.RetireUntil != nil && s.RetireUntil.After(time.Now())
+}
+
+// SiteRetire disables a site gracefully: for grace it answers every request with
+// status (410 gone or 503 unavailable) and the retired page, then `ngm serve`
+// removes the vhost (see SweepRetired). The site is applied right away; the end of
+// the grace period is returned.
+func (a *App) SiteRetire(ctx context.Context, domain string, grace time.Duration, status int) (time.Time, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return time.Time{}, invalidf("domain is required")
+	}
+	if status != 410 && status != 503 {
+		return time.Time{}, invalidf("retired status must be 410 or 503, not %d", status)
+	}
+	if grace <= 0 {
+		return time.Time{}, invalidf("grace period must be positive")
+	}
+	if _, err := a.st.GetSiteByDomain(domain); err != nil {
+		return time.Time{}, fmt.Errorf("get site: %w", err)
+	}
+
+	until := time.Now().Add(grace).Truncate(time.Second)
+	if err := a.st.DisableSiteByDomain(domain); err != nil {
+		return time.Time{}, err
+	}
+	if err := a.st.SetSiteRetire(domain, &until, status); err != nil {
+		return time.Time{}, err
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		return until, fmt.Errorf("site disabled, but publishing the retired page failed: %w", err)
+	}
+	a.event("info", "retire", "%s: disabled, serving %d until %s", domain, status, until.Format(time.RFC3339))
+	return until, nil
+}
+
+// retiredFor renders the retired page of s while it is in its grace period and
+// returns what the vhost needs to serve it; the zero RetiredCfg otherwise.
+func (a *App) retiredFor(s store.Site, domain string) (nginx.RetiredCfg, error) {
+	if !siteRetiring(s) {
+		return nginx.RetiredCfg{}, nil
+	}
+	until := s.RetireUntil.UTC()
+	page, err := nginx.RenderRetired(a.cfg.Hosting.Retired.Template, nginx.RetiredData{Domain: domain, Status: s.RetireStatus, Until: until})
+	if err != nil {
+		return nginx.RetiredCfg{}, err
+	}
+	dir := a.retiredDir(domain)
+	if err := util.MkdirAll(dir, 0755); err != nil {
+		return nginx.RetiredCfg{}, err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(dir, "retired.html"), page, 0644); err != nil {
+		return nginx.RetiredCfg{}, fmt.Errorf("write retired page: %w", err)
+	}
+	return nginx.RetiredCfg{Status: s.RetireStatus, Root: dir, Until: until.Format(time.RFC3339)}, nil
+}
+
+func (a *App) retiredDir(domain string) string {
+	return filepath.Join(a.paths.NginxRoot, "conf", "retired", domain)
+}
+
+// SweepRetired ends the grace period of every retired site whose time is up: the
+// vhost is removed by an apply and the retire fields are cleared.
+func (a *App) SweepRetired(ctx context.Context) error {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, s := range sites {
+		if s.Enabled || s.RetireUntil == nil || s.RetireUntil.After(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := a.Apply(ctx, ApplyRequest{Domain: s.Domain}); err != nil {
+			a.event("error", "retire", "%s: grace period over, but removing the vhost failed: %v", s.Domain, err)
+			continue
+		}
+		if err := a.st.SetSiteRetire(s.Domain, nil, 0); err != nil {
+			log.Printf("retire %s: %v", s.Domain, err)
+			continue
+		}
+		_ = os.RemoveAll(a.retiredDir(s.Domain))
+		a.event("info", "retire", "%s: grace period over, vhost removed", s.Domain)
+	}
+	return nil
+}
+
+// RunRetired sweeps ended grace periods every hosting.retired.interval until ctx is done.
+func (a *App) RunRetired(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.Hosting.Retired.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := a.SweepRetired(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("retire: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
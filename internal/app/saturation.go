@@ -0,0 +1,375 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/notify"
+)
+
+// Saturation is one sample of nginx connection and worker CPU usage.
+type Saturation struct {
+	CheckedAt         time.Time
+	Workers           int // worker_processes (auto = CPUs)
+	WorkerConnections int // per worker
+	MaxConnections    int // Workers * WorkerConnections
+	Active            int // stub_status "Active connections"
+	Reading           int
+	Writing           int
+	Waiting           int // idle keep-alive connections
+	ConnPercent       float64
+	CPUPercent        float64 // average over the running workers, of one core each
+	RunningWorkers    int
+	CPUs              int
+}
+
+// SaturationEvent is posted as JSON to every saturation.webhooks URL.
+type SaturationEvent struct {
+	Type        string    `json:"event"`    // "saturated" | "recovered"
+	Resource    string    `json:"resource"` // "connections" | "cpu"
+	Percent     float64   `json:"percent"`
+	Threshold   int       `json:"threshold"`
+	Since       time.Time `json:"since"`
+	Active      int       `json:"active_connections"`
+	MaxConns    int       `json:"max_connections"`
+	Workers     int       `json:"worker_processes"`
+	WorkerConns int       `json:"worker_connections"`
+	CPUs        int       `json:"cpus"`
+	Suggestions []string  `json:"suggestions,omitempty"`
+}
+
+// nginx defaults when nginx.conf does not set them.
+const (
+	defaultWorkerProcesses   = 1
+	defaultWorkerConnections = 512
+	clockTicks               = 100 // USER_HZ: /proc/<pid>/stat CPU times are in these
+)
+
+// saturationWatch remembers the previous CPU sample and how long each threshold has
+// been exceeded between RunSaturation ticks.
+type saturationWatch struct {
+	mu      sync.Mutex
+	ticks   map[int]uint64 // worker pid -> utime+stime
+	ticksAt time.Time
+	over    map[string]time.Time // resource -> first sample above its threshold
+	alerted map[string]bool
+}
+
+var (
+	workerProcessesLine   = regexp.MustCompile(`(?m)(?:^|[;{])\s*worker_processes\s+([^\s;]+)\s*;`)
+	workerConnectionsLine = regexp.MustCompile(`(?m)(?:^|[;{])\s*worker_connections\s+(\d+)\s*;`)
+)
+
+// workerLimits reads worker_processes and worker_connections from the managed nginx.conf.
+func (a *App) workerLimits() (processes, connections int, err error) {
+	data, err := os.ReadFile(a.paths.NginxMainConf)
+	if err != nil {
+		return 0, 0, err
+	}
+	var lines []string
+	for _, l := range strings.Split(string(data), "\n") {
+		l, _, _ = strings.Cut(l, "#")
+		lines = append(lines, l)
+	}
+	conf := strings.Join(lines, "\n")
+
+	processes, connections = defaultWorkerProcesses, defaultWorkerConnections
+	if m := workerProcessesLine.FindStringSubmatch(conf); m != nil {
+		if m[1] == "auto" {
+			processes = runtime.NumCPU()
+		} else if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			processes = n
+		}
+	}
+	if m := workerConnectionsLine.FindStringSubmatch(conf); m != nil {
+		if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+			connections = n
+		}
+	}
+	return processes, connections, nil
+}
+
+// stubStatus fetches the counters of the stub_status vhost rendered on
+// saturation.status_listen (`ngm global apply`).
+func (a *App) stubStatus(ctx context.Context, s *Saturation) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+a.cfg.Saturation.StatusListen+"/nginx_status", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stub_status: %w (run `ngm global apply` with saturation.enabled)", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("stub_status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return err
+	}
+	// Active connections: 3
+	// server accepts handled requests
+	//  10 10 20
+	// Reading: 0 Writing: 1 Waiting: 2
+	sc := bufio.NewScanner(strings.NewReader(string(body)))
+	found := false
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		switch {
+		case len(f) == 3 && f[0] == "Active" && f[1] == "connections:":
+			s.Active, _ = strconv.Atoi(f[2])
+			found = true
+		case len(f) == 6 && f[0] == "Reading:":
+			s.Reading, _ = strconv.Atoi(f[1])
+			s.Writing, _ = strconv.Atoi(f[3])
+			s.Waiting, _ = strconv.Atoi(f[5])
+		}
+	}
+	if !found {
+		return fmt.Errorf("stub_status: unexpected response")
+	}
+	return nil
+}
+
+// workerTicks returns the CPU time (utime+stime, in clock ticks) of every child of
+// the nginx master, i.e. its workers (and cache manager).
+func workerTicks(master int) map[int]uint64 {
+	out := map[int]uint64{}
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, p := range stats {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid ... utime stime: comm may contain spaces
+		i := strings.LastIndexByte(string(data), ')')
+		if i < 0 {
+			continue
+		}
+		f := strings.Fields(string(data[i+1:]))
+		if len(f) < 13 {
+			continue
+		}
+		if ppid, _ := strconv.Atoi(f[1]); ppid != master {
+			continue
+		}
+		pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(p)))
+		utime, _ := strconv.ParseUint(f[11], 10, 64)
+		stime, _ := strconv.ParseUint(f[12], 10, 64)
+		out[pid] = utime + stime
+	}
+	return out
+}
+
+// SaturationSample measures connection usage and worker CPU now. Worker CPU is the
+// usage since the previous sample; the first one waits a second to have a baseline.
+func (a *App) SaturationSample(ctx context.Context) (Saturation, error) {
+	s := Saturation{CheckedAt: time.Now(), CPUs: runtime.NumCPU()}
+	var err error
+	if s.Workers, s.WorkerConnections, err = a.workerLimits(); err != nil {
+		return s, err
+	}
+	s.MaxConnections = s.Workers * s.WorkerConnections
+	if err := a.stubStatus(ctx, &s); err != nil {
+		return s, err
+	}
+	s.ConnPercent = 100 * float64(s.Active) / float64(s.MaxConnections)
+
+	master, ok := nginx.MasterPID(a.paths.NginxPIDFile)
+	if !ok {
+		return s, fmt.Errorf("nginx master pid not found (%s)", a.paths.NginxPIDFile)
+	}
+	w := &a.sat
+	w.mu.Lock()
+	prev, prevAt := w.ticks, w.ticksAt
+	w.mu.Unlock()
+	if prev == nil {
+		prev, prevAt = workerTicks(master), time.Now()
+		select {
+		case <-ctx.Done():
+			return s, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+	now, nowAt := workerTicks(master), time.Now()
+	w.mu.Lock()
+	w.ticks, w.ticksAt = now, nowAt
+	w.mu.Unlock()
+
+	var used uint64
+	for pid, t := range now {
+		// workers started since the last sample (reload) count from zero
+		if p, ok := prev[pid]; ok && t >= p {
+			used += t - p
+		} else if !ok {
+			used += t
+		}
+	}
+	s.RunningWorkers = len(now)
+	if elapsed := nowAt.Sub(prevAt).Seconds(); elapsed > 0 && len(now) > 0 {
+		s.CPUPercent = 100 * float64(used) / clockTicks / elapsed / float64(len(now))
+	}
+	return s, nil
+}
+
+// saturationSuggestions are the tuning hints sent with an alert for resource.
+func saturationSuggestions(resource string, s Saturation) []string {
+	var out []string
+	if s.Workers < s.CPUs {
+		out = append(out, fmt.Sprintf("set worker_processes auto (%d workers on %d CPUs)", s.Workers, s.CPUs))
+	}
+	switch resource {
+	case "connections":
+		out = append(out, fmt.Sprintf("raise worker_connections (now %d) and worker_rlimit_nofile to at least twice that", s.WorkerConnections))
+		if s.Active > 0 && s.Waiting*2 > s.Active {
+			out = append(out, fmt.Sprintf("lower keepalive_timeout / keepalive_requests: %d of %d connections are idle keep-alives", s.Waiting, s.Active))
+		}
+		out = append(out, "rate-limit abusive clients (global rate_limits) or spread the load over more servers")
+	case "cpu":
+		out = append(out, "cache hot proxy/PHP responses so fewer requests reach the upstream")
+		out = append(out, "keep ssl_session_cache shared and prefer ECDSA certificates to cut TLS handshake cost")
+		out = append(out, "lower gzip_comp_level or serve pre-compressed static files")
+		out = append(out, "add CPU capacity or spread the load over more servers")
+	}
+	return out
+}
+
+// SaturationCheck samples usage and raises (or clears) an alert once a threshold
+// has been exceeded for saturation.sustain.
+func (a *App) SaturationCheck(ctx context.Context, mailer *notify.Mailer) (Saturation, error) {
+	s, err := a.SaturationSample(ctx)
+	if err != nil {
+		return s, err
+	}
+	sustain, err := time.ParseDuration(a.cfg.Saturation.Sustain)
+	if err != nil {
+		sustain = 5 * time.Minute
+	}
+	checks := []struct {
+		resource  string
+		percent   float64
+		threshold int
+	}{
+		{"connections", s.ConnPercent, a.cfg.Saturation.ConnPercent},
+		{"cpu", s.CPUPercent, a.cfg.Saturation.CPUPercent},
+	}
+
+	w := &a.sat
+	for _, c := range checks {
+		w.mu.Lock()
+		if w.over == nil {
+			w.over, w.alerted = map[string]time.Time{}, map[string]bool{}
+		}
+		since, above := w.over[c.resource]
+		alerted := w.alerted[c.resource]
+		var typ string
+		switch {
+		case c.percent >= float64(c.threshold):
+			if !above {
+				since = s.CheckedAt
+				w.over[c.resource] = since
+			}
+			if !alerted && s.CheckedAt.Sub(since) >= sustain {
+				w.alerted[c.resource] = true
+				typ = "saturated"
+			}
+		case above:
+			delete(w.over, c.resource)
+			delete(w.alerted, c.resource)
+			if alerted {
+				typ = "recovered"
+			}
+		}
+		w.mu.Unlock()
+		if typ == "" {
+			continue
+		}
+
+		ev := SaturationEvent{
+			Type: typ, Resource: c.resource, Percent: c.percent, Threshold: c.threshold, Since: since,
+			Active: s.Active, MaxConns: s.MaxConnections, Workers: s.Workers, WorkerConns: s.WorkerConnections, CPUs: s.CPUs,
+		}
+		if typ == "saturated" {
+			ev.Suggestions = saturationSuggestions(c.resource, s)
+			a.event("warning", "saturation", "nginx %s at %.0f%% (threshold %d%%) since %s", c.resource, c.percent, c.threshold, since.Format(time.RFC3339))
+		} else {
+			a.event("info", "saturation", "nginx %s back to %.0f%% (threshold %d%%)", c.resource, c.percent, c.threshold)
+		}
+		a.notifySaturation(ctx, mailer, ev)
+	}
+	return s, nil
+}
+
+// RunSaturation samples every saturation.interval until ctx is done.
+func (a *App) RunSaturation(ctx context.Context, mailer *notify.Mailer) {
+	interval, err := time.ParseDuration(a.cfg.Saturation.Interval)
+	if err != nil || interval <= 0 {
+		interval = 30 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := a.SaturationCheck(ctx, mailer); err != nil && ctx.Err() == nil {
+			log.Printf("saturation: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (a *App) notifySaturation(ctx context.Context, mailer *notify.Mailer, ev SaturationEvent) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for _, url := range a.cfg.Saturation.Webhooks {
+		if err := notify.PostJSON(ctx, url, ev, nil); err != nil {
+			log.Printf("saturation: webhook: %v", err)
+		}
+	}
+	if mailer == nil || !mailer.Enabled() {
+		return
+	}
+	subject, body := saturationMail(ev)
+	for _, rcpt := range a.cfg.Saturation.NotifyEmails {
+		if err := mailer.Send(rcpt, subject, body); err != nil {
+			log.Printf("saturation: mail %s: %v", rcpt, err)
+		}
+	}
+}
+
+func saturationMail(ev SaturationEvent) (string, string) {
+	if ev.Type == "recovered" {
+		return fmt.Sprintf("[RECOVERED] nginx %s usage back to %.0f%%", ev.Resource, ev.Percent),
+			fmt.Sprintf("nginx %s usage is back under %d%% (%.0f%% now).\n", ev.Resource, ev.Threshold, ev.Percent)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "nginx %s usage has been at or above %d%% since %s (%.0f%% now).\n\n",
+		ev.Resource, ev.Threshold, ev.Since.Format(time.RFC1123), ev.Percent)
+	fmt.Fprintf(&b, "Connections: %d active of %d (%d workers x %d worker_connections), %d CPUs.\n",
+		ev.Active, ev.MaxConns, ev.Workers, ev.WorkerConns, ev.CPUs)
+	if len(ev.Suggestions) > 0 {
+		b.WriteString("\nSuggested tuning:\n")
+		for _, s := range ev.Suggestions {
+			b.WriteString("  - " + s + "\n")
+		}
+	}
+	return fmt.Sprintf("[SATURATED] nginx %s at %.0f%%", ev.Resource, ev.Percent), b.String()
+}
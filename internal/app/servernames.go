@@ -0,0 +1,298 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// nameCheckInterval is how often RunNameCheck looks for server_name conflicts.
+const nameCheckInterval = 15 * time.Minute
+
+// Kinds of NameConflict.
+const (
+	// NameDuplicate: several server blocks list the same name. nginx warns
+	// "conflicting server name" on reload and answers with the first one it loaded.
+	NameDuplicate = "duplicate"
+	// NameWildcard: a wildcard (*.example.com, .example.com, www.example.*) of one
+	// vhost covers the exact name of another. The exact name always wins, so the
+	// wildcard's vhost never sees that hostname.
+	NameWildcard = "wildcard"
+)
+
+// NameClaim is a server_name claimed by an enabled site (its domain or preview
+// hostname) or by a vhost file ngm does not manage.
+type NameClaim struct {
+	Name    string
+	Site    string // domain of the claiming site ("" for a foreign file)
+	Preview bool   // Name is the site's preview hostname
+	File    string // the foreign file ("" for a site)
+	Orphan  bool   // File is in sites_dir without an enabled site (see Drift)
+}
+
+// String names the claimant, as conflict reports list it.
+func (c NameClaim) String() string {
+	switch {
+	case c.File != "":
+		return "file " + c.File
+	case c.Preview:
+		return "preview of site " + c.Site
+	default:
+		return "site " + c.Site
+	}
+}
+
+func (c NameClaim) claimant() string {
+	return fmt.Sprintf("%s|%t|%s", c.Site, c.Preview, c.File)
+}
+
+// NameConflict is a hostname more than one vhost claims.
+type NameConflict struct {
+	Name   string
+	Kind   string      // NameDuplicate | NameWildcard
+	Claims []NameClaim // the exact claims first, then (wildcard) the covering ones
+	Hint   string      // how to resolve it
+}
+
+// Sites lists the domains of the sites involved.
+func (c NameConflict) Sites() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, cl := range c.Claims {
+		if cl.Site != "" && !seen[cl.Site] {
+			seen[cl.Site] = true
+			out = append(out, cl.Site)
+		}
+	}
+	return out
+}
+
+// ServerNameConflicts checks that no two vhosts claim the same hostname: the
+// domains and preview hostnames of the enabled sites, and the server_name values
+// of every other file nginx loads (foreign vhosts, orphans left in sites_dir).
+func (a *App) ServerNameConflicts() ([]NameConflict, error) {
+	claims, err := a.nameClaims()
+	if err != nil {
+		return nil, err
+	}
+	return nameConflicts(claims), nil
+}
+
+// checkServerName is the server_name check of a site about to be added or
+// enabled: a name another vhost already lists is refused (nginx would silently
+// serve only one of them); a wildcard overlap is returned as a warning.
+func (a *App) checkServerName(domain string) (warnings []string, err error) {
+	claims, err := a.nameClaims()
+	if err != nil {
+		// the main nginx.conf may not exist yet (fresh install): sites only
+		log.Printf("server names: %v", err)
+	}
+	own := NameClaim{Name: domain, Site: domain}
+	mine := []NameClaim{own}
+	ownFile := filepath.Join(a.paths.NginxSitesDir, domain+".conf") // left by a disabled site
+	for _, c := range claims {
+		if c.Site != domain && c.File != ownFile {
+			mine = append(mine, c)
+		}
+	}
+	for _, c := range nameConflicts(mine) {
+		involved := false
+		for _, cl := range c.Claims {
+			involved = involved || cl == own
+		}
+		switch {
+		case !involved:
+		case c.Kind == NameDuplicate:
+			return nil, invalidf("%s is already a server_name of %s: %s", domain, otherClaims(c, own), c.Hint)
+		default:
+			warnings = append(warnings, fmt.Sprintf("server_name %s overlaps %s: %s", c.Name, otherClaims(c, own), c.Hint))
+		}
+	}
+	return warnings, nil
+}
+
+// otherClaims joins the claimants of c other than own.
+func otherClaims(c NameConflict, own NameClaim) string {
+	var out []string
+	for _, cl := range c.Claims {
+		if cl != own {
+			out = append(out, cl.String())
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// nameClaims collects the hostnames claimed by the enabled sites and by the
+// files nginx loads besides their vhosts. The sites are returned along with an
+// error reading the nginx config.
+func (a *App) nameClaims() ([]NameClaim, error) {
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var out []NameClaim
+	managed := map[string]bool{}
+	for _, s := range sites {
+		if !s.Enabled {
+			continue
+		}
+		d := strings.ToLower(strings.TrimSpace(s.Domain))
+		managed[filepath.Join(a.paths.NginxSitesDir, d+".conf")] = true
+		out = append(out, NameClaim{Name: d, Site: d})
+		if s.PreviewHost != "" {
+			out = append(out, NameClaim{Name: s.PreviewHost, Site: d, Preview: true})
+		}
+	}
+	names, err := a.ng.ServerNames()
+	for _, n := range names {
+		if !managed[n.File] {
+			orphan := filepath.Dir(n.File) == filepath.Clean(a.paths.NginxSitesDir)
+			out = append(out, NameClaim{Name: n.Name, File: n.File, Orphan: orphan})
+		}
+	}
+	return out, err
+}
+
+// nameConflicts finds the names claimed by more than one claimant, and the exact
+// names covered by another claimant's wildcard, sorted by name.
+func nameConflicts(claims []NameClaim) []NameConflict {
+	byName := map[string][]NameClaim{}
+	seen := map[string]bool{}
+	for _, c := range claims {
+		k := c.Name + "|" + c.claimant()
+		if seen[k] { // a file lists a name in its :80 and :443 blocks
+			continue
+		}
+		seen[k] = true
+		byName[c.Name] = append(byName[c.Name], c)
+	}
+	names := make([]string, 0, len(byName))
+	for n := range byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var out []NameConflict
+	for _, n := range names {
+		if cs := byName[n]; len(cs) > 1 {
+			out = append(out, NameConflict{Name: n, Kind: NameDuplicate, Claims: cs, Hint: duplicateHint(cs)})
+		}
+	}
+	for _, n := range names {
+		if isWildcardName(n) {
+			continue
+		}
+		var covering []NameClaim
+		for _, w := range names {
+			if isWildcardName(w) && wildcardCovers(w, n) {
+				for _, c := range byName[w] {
+					if !sameClaimant(byName[n], c) {
+						covering = append(covering, c)
+					}
+				}
+			}
+		}
+		if len(covering) > 0 {
+			out = append(out, NameConflict{
+				Name:   n,
+				Kind:   NameWildcard,
+				Claims: append(append([]NameClaim(nil), byName[n]...), covering...),
+				Hint: fmt.Sprintf("requests for %s go to %s, never to %s; remove one of them if that is not intended",
+					n, byName[n][0], covering[0]),
+			})
+		}
+	}
+	return out
+}
+
+// duplicateHint says how to clear a duplicate name, by who claims it.
+func duplicateHint(cs []NameClaim) string {
+	for _, c := range cs {
+		switch {
+		case c.Orphan:
+			return fmt.Sprintf("%s is an orphaned vhost: remove it with `ngm prune --orphans --yes`", c.File)
+		case c.File != "":
+			return fmt.Sprintf("remove %s from %s (not managed by ngm), then reload nginx", c.Name, c.File)
+		}
+	}
+	for _, c := range cs {
+		if c.Preview {
+			return fmt.Sprintf("turn off the preview of %s (`ngm preview --domain %s --off`)", c.Site, c.Site)
+		}
+	}
+	return "keep the name in one vhost only"
+}
+
+func sameClaimant(cs []NameClaim, c NameClaim) bool {
+	for _, x := range cs {
+		if x.claimant() == c.claimant() {
+			return true
+		}
+	}
+	return false
+}
+
+// isWildcardName reports whether n is a *.example.com, .example.com or
+// www.example.* server name.
+func isWildcardName(n string) bool {
+	return strings.HasPrefix(n, "*.") || strings.HasPrefix(n, ".") || strings.HasSuffix(n, ".*")
+}
+
+// wildcardCovers reports whether nginx matches name against wildcard w.
+func wildcardCovers(w, name string) bool {
+	switch {
+	case strings.HasPrefix(w, "*."):
+		return strings.HasSuffix(name, w[1:]) && len(name) > len(w)-1
+	case strings.HasPrefix(w, "."):
+		return name == w[1:] || strings.HasSuffix(name, w)
+	case strings.HasSuffix(w, ".*"):
+		return strings.HasPrefix(name, w[:len(w)-1]) && len(name) > len(w)-1
+	}
+	return false
+}
+
+// RunNameCheck checks for server_name conflicts every nameCheckInterval until ctx
+// is done, with a warning event when one appears.
+func (a *App) RunNameCheck(ctx context.Context) {
+	t := time.NewTicker(nameCheckInterval)
+	defer t.Stop()
+	known := map[string]bool{}
+	for {
+		conflicts, err := a.ServerNameConflicts()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("server names: %v", err)
+		}
+		if err == nil {
+			now := map[string]bool{}
+			for _, c := range conflicts {
+				k := c.Kind + "|" + c.Name
+				for _, cl := range c.Claims {
+					k += "|" + cl.claimant()
+				}
+				now[k] = true
+				if known[k] {
+					continue
+				}
+				subject := "server_name " + c.Name
+				if sites := c.Sites(); len(sites) > 0 {
+					subject = sites[0] + ": " + subject
+				}
+				var who []string
+				for _, cl := range c.Claims {
+					who = append(who, cl.String())
+				}
+				a.event("warning", "nginx", "%s claimed by %s (%s): %s", subject, strings.Join(who, ", "), c.Kind, c.Hint)
+			}
+			known = now
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"mynginx/internal/config"
+)
+
+// setupSections are the parts of CheckConfig the first-run setup shows: what
+// serving sites and issuing certificates depend on.
+var setupSections = map[string]bool{"config": true, "binaries": true, "nginx": true, "certs": true}
+
+// NeedsSetup reports whether no panel user exists yet, so only the first-run setup
+// can get anyone into the panel.
+func (a *App) NeedsSetup() (bool, error) {
+	n, err := a.st.CountPanelUsers()
+	if err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+// SetupReport checks the nginx and certbot paths of the config for the first-run
+// setup (the relevant lines of CheckConfig).
+func (a *App) SetupReport(ctx context.Context) ConfigReport {
+	full := CheckConfig(ctx, a.cfg, a.run)
+	r := ConfigReport{Path: full.Path}
+	for _, c := range full.Checks {
+		if setupSections[c.Section] {
+			r.add(c.Level, c.Section, c.Item, "%s", c.Message)
+		}
+	}
+	return r
+}
+
+// SetACMEEmail sets certs.email, the Let's Encrypt registration address, in the
+// config file and in the running config.
+func (a *App) SetACMEEmail(email string) error {
+	email = strings.TrimSpace(email)
+	if email == a.cfg.Certs.Email {
+		return nil
+	}
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return invalidf("invalid ACME email %q", email)
+	}
+	if a.cfg.Path == "" {
+		return fmt.Errorf("set certs.email: the config was not loaded from a file")
+	}
+	if err := config.SetValue(a.cfg.Path, "certs.email", email); err != nil {
+		return fmt.Errorf("set certs.email in %s: %w", a.cfg.Path, err)
+	}
+	a.cfg.Certs.Email = email
+	a.event("info", "config", "certs.email set to %s in %s", email, a.cfg.Path)
+	return nil
+}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynginx/internal/store"
+	"mynginx/internal/users"
+	"mynginx/internal/util"
+)
+
+// SFTPJailInfo is the jail of a hosting user as `ngm user sftp` reports it.
+type SFTPJailInfo struct {
+	Username string
+	Jailed   bool
+	Dir      string   // chroot (hosting.sftp.jail_root/<user>)
+	Sites    []string // domains bound into the jail
+}
+
+// UserSFTPJail confines a hosting user to SFTP in a chroot that holds bind mounts
+// of their sites only (on), or lifts it (off). The sshd drop-in is written and
+// checked with `sshd -t` and the jail checked for root ownership before the user
+// joins hosting.sftp.group, so a failure leaves the user as they were.
+func (a *App) UserSFTPJail(ctx context.Context, username string, on bool) (SFTPJailInfo, error) {
+	username = strings.TrimSpace(username)
+	u, err := a.st.GetUserByUsername(username)
+	if err != nil {
+		return SFTPJailInfo{}, fmt.Errorf("get user: %w", err)
+	}
+	sc := a.cfg.Hosting.SFTP
+	info := SFTPJailInfo{Username: u.Username, Jailed: on, Dir: users.JailDir(sc.JailRoot, u.Username)}
+
+	if !on {
+		if err := users.SetGroupMember(a.run, u.Username, sc.Group, false); err != nil {
+			return info, err
+		}
+		entries, err := users.JailEntries(info.Dir)
+		if err != nil {
+			return info, err
+		}
+		for _, d := range entries {
+			if err := users.UnbindSite(a.run, info.Dir, d); err != nil {
+				return info, err
+			}
+		}
+		_ = os.Remove(info.Dir)
+		if err := a.st.SetUserSFTPJail(u.ID, false); err != nil {
+			return info, err
+		}
+		if u.SFTPJail {
+			a.event("info", "sftp", "%s: sftp jail removed", u.Username)
+		}
+		return info, nil
+	}
+
+	if err := users.EnsureGroup(a.run, sc.Group); err != nil {
+		return info, err
+	}
+	if err := a.ensureSFTPConfig(ctx); err != nil {
+		return info, err
+	}
+	if _, err := users.EnsureJail(sc.JailRoot, u.Username); err != nil {
+		return info, err
+	}
+	if a.cfg.Sandbox == "" {
+		if err := users.CheckJail(info.Dir); err != nil {
+			return info, err
+		}
+	}
+	if info.Sites, err = a.syncJail(u); err != nil {
+		return info, err
+	}
+	if err := users.SetGroupMember(a.run, u.Username, sc.Group, true); err != nil {
+		return info, err
+	}
+	if err := a.st.SetUserSFTPJail(u.ID, true); err != nil {
+		return info, err
+	}
+	if !u.SFTPJail {
+		a.event("info", "sftp", "%s: sftp-only jail in %s (%d site(s))", u.Username, info.Dir, len(info.Sites))
+	}
+	return info, nil
+}
+
+// SFTPJails lists the jailed users and the sites bound into their jails.
+func (a *App) SFTPJails() ([]SFTPJailInfo, error) {
+	us, err := a.st.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	var out []SFTPJailInfo
+	for _, u := range us {
+		if !u.SFTPJail {
+			continue
+		}
+		dir := users.JailDir(a.cfg.Hosting.SFTP.JailRoot, u.Username)
+		entries, err := users.JailEntries(dir)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, SFTPJailInfo{Username: u.Username, Jailed: true, Dir: dir, Sites: entries})
+	}
+	return out, nil
+}
+
+// SyncSFTPJails re-binds the sites of every jailed user (bind mounts do not survive
+// a reboot) and drops mounts of sites that are gone. `ngm serve` runs it at start.
+func (a *App) SyncSFTPJails() error {
+	us, err := a.st.ListUsers()
+	if err != nil {
+		return err
+	}
+	for _, u := range us {
+		if !u.SFTPJail {
+			continue
+		}
+		if _, err := a.syncJail(u); err != nil {
+			a.event("error", "sftp", "%s: %v", u.Username, err)
+		}
+	}
+	return nil
+}
+
+// syncJail makes the jail of u hold exactly a bind mount of each of u's sites and
+// returns their domains.
+func (a *App) syncJail(u store.User) ([]string, error) {
+	dir := users.JailDir(a.cfg.Hosting.SFTP.JailRoot, u.Username)
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	want := map[string]bool{}
+	var out []string
+	for _, s := range sites {
+		if s.UserID != u.ID {
+			continue
+		}
+		if err := users.BindSite(a.run, dir, s.Domain, filepath.Dir(s.Webroot)); err != nil {
+			return out, err
+		}
+		want[s.Domain] = true
+		out = append(out, s.Domain)
+	}
+	entries, err := users.JailEntries(dir)
+	if err != nil {
+		return out, err
+	}
+	for _, d := range entries {
+		if !want[d] {
+			if err := users.UnbindSite(a.run, dir, d); err != nil {
+				return out, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// sftpBindSite adds a new site of a jailed owner to the jail.
+func (a *App) sftpBindSite(s store.Site) error {
+	u, err := a.st.GetUserByID(s.UserID)
+	if err != nil || !u.SFTPJail {
+		return err
+	}
+	return users.BindSite(a.run, users.JailDir(a.cfg.Hosting.SFTP.JailRoot, u.Username), s.Domain, filepath.Dir(s.Webroot))
+}
+
+// sftpUnbindSite removes a deleted site from its owner's jail.
+func (a *App) sftpUnbindSite(s store.Site) {
+	u, err := a.st.GetUserByID(s.UserID)
+	if err != nil || !u.SFTPJail {
+		return
+	}
+	if err := users.UnbindSite(a.run, users.JailDir(a.cfg.Hosting.SFTP.JailRoot, u.Username), s.Domain); err != nil {
+		log.Printf("sftp: unbind %s: %v", s.Domain, err)
+	}
+}
+
+// ensureSFTPConfig writes the sshd drop-in of the jail when it changed, validates
+// the whole sshd config with `sshd -t` (restoring the previous drop-in on failure)
+// and reloads sshd.
+func (a *App) ensureSFTPConfig(ctx context.Context) error {
+	sc := a.cfg.Hosting.SFTP
+	want := users.SFTPConfig(sc.Group, sc.JailRoot)
+	old, err := os.ReadFile(sc.SSHDConfig)
+	if err == nil && bytes.Equal(old, want) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := util.MkdirAll(filepath.Dir(sc.SSHDConfig), 0755); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(sc.SSHDConfig, want, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", sc.SSHDConfig, err)
+	}
+	restore := func() {
+		if old == nil {
+			_ = os.Remove(sc.SSHDConfig)
+		} else {
+			_ = util.WriteFileAtomic(sc.SSHDConfig, old, 0644)
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, a.timeouts.Systemctl)
+	defer cancel()
+	if res, err := a.run.Run(tctx, "sshd", "-t"); err != nil {
+		restore()
+		return fmt.Errorf("sshd -t rejected %s (previous version kept): %w (%s)", sc.SSHDConfig, err, strings.TrimSpace(res.Output()))
+	}
+	rctx, rcancel := context.WithTimeout(ctx, a.timeouts.Systemctl)
+	defer rcancel()
+	if res, err := a.run.Run(rctx, "systemctl", "reload", sc.SSHDService); err != nil {
+		return fmt.Errorf("systemctl reload %s failed: %w (%s)", sc.SSHDService, err, strings.TrimSpace(res.Output()))
+	}
+	a.event("info", "sftp", "sshd jail config written to %s", sc.SSHDConfig)
+	return nil
+}
@@ -3,11 +3,12 @@ package app
 import (
 	"context"
 	"fmt"
+	"log"
 	"path/filepath"
+	"slices"
 	"strings"
-	"time"
 	"strconv"
-	"os"
+	"time"
 
 	"mynginx/internal/store"
 	"mynginx/internal/users"
@@ -16,7 +17,7 @@ import (
 type SiteAddRequest struct {
 	User      string
 	Domain    string
-	Mode      string // php|proxy|static
+	Mode      string // php|proxy|static|redirect
 	PHP       string
 	Webroot   string // optional
 	HTTP3     bool
@@ -27,6 +28,21 @@ type SiteAddRequest struct {
 	// For proxy mode: one per line, e.g. "127.0.0.1:8080" or "10.0.0.2:8080 50"
 	ProxyTargets []string
 
+	// For redirect mode: the target URL, the status (0 = 301) and whether the
+	// request path is kept (see SiteRedirect).
+	RedirectTo       string
+	RedirectCode     int
+	RedirectKeepPath bool
+
+	// Placeholder serves a "coming soon" page (php/static) until files are deployed.
+	Placeholder bool
+
+	// Hardened turns on the php hardening preset (see SiteHarden).
+	Hardened bool
+
+	// DNSRecords points the domain at dns.addresses through its zone's provider
+	// (see SiteDNSRecords) before the vhost and certificate.
+	DNSRecords bool
 }
 
 type SiteAddResult struct {
@@ -47,12 +63,19 @@ type SiteEditRequest struct {
 	Enabled *bool
 
 	ApplyNow bool
+
+	// ExpectedRevision (optional) rejects the edit with store.ErrRevisionConflict
+	// if the site changed since the caller loaded it.
+	ExpectedRevision int64
 }
 
 type SiteListItem struct {
-	Site  store.Site
-	State string // OK|PENDING|ERROR|DISABLED
-	Last  string // formatted last applied (or "-")
+	Site     store.Site
+	State    string     // OK|PENDING|ERROR|DISABLED
+	Last     string     // formatted last applied (or "-")
+	Owner    string     // owner username ("" = unowned)
+	Cert     *time.Time // certificate expiry (nil = no certificate)
+	CertDays int        // whole days until Cert
 }
 
 func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, error) {
@@ -63,17 +86,38 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 	user := strings.TrimSpace(req.User)
 	domain := strings.ToLower(strings.TrimSpace(req.Domain))
 	if user == "" || domain == "" {
-		return out, fmt.Errorf("required: user and domain")
+		return out, invalidf("required: user and domain")
 	}
 
 	mode := strings.TrimSpace(req.Mode)
 	if mode == "" {
 		mode = "php"
 	}
-	if mode != "php" && mode != "proxy" && mode != "static" {
-		return out, fmt.Errorf("invalid mode %q", mode)
+	if !validSiteMode(mode) {
+		return out, invalidf("invalid mode %q", mode)
+	}
+	if req.Placeholder && !placeholderMode(mode) {
+		return out, invalidf("a placeholder needs a php or static site, not %s", mode)
+	}
+	if req.Hardened && mode != "php" {
+		return out, invalidf("the hardening preset is for php sites, not %s", mode)
+	}
+	redirectCode := req.RedirectCode
+	if mode == "redirect" {
+		if redirectCode == 0 {
+			redirectCode = 301
+		}
+		if err := validRedirect(domain, strings.TrimSpace(req.RedirectTo), redirectCode, req.RedirectKeepPath); err != nil {
+			return out, err
+		}
 	}
 
+	nameWarnings, err := a.checkServerName(domain)
+	if err != nil {
+		return out, err
+	}
+	out.Warnings = append(out.Warnings, nameWarnings...)
+
 	phpv := strings.TrimSpace(req.PHP)
 	if phpv == "" {
 		phpv = a.cfg.PHPFPM.DefaultVersion
@@ -86,14 +130,30 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 		return out, err
 	}
 
+	// Plan limits (re-adding a domain the user already owns is an update, not a new site)
+	if existing, err := a.st.GetSiteByDomain(domain); err != nil || existing.UserID != u.ID {
+		if err := a.checkSiteQuota(u); err != nil {
+			return out, err
+		}
+	}
+	if mode == "php" {
+		if err := a.checkPHPAllowed(u, phpv); err != nil {
+			return out, err
+		}
+	}
+
 	wr := strings.TrimSpace(req.Webroot)
 	if wr == "" {
 		wr = filepath.Join(home, a.cfg.Hosting.SitesRootName, domain, "public")
 	}
 
-	// Provision OS user + filesystem layout
-	if req.Provision {
-		if err := users.EnsureSystemUser(user, home); err != nil {
+	// Provision OS user + filesystem layout (sandbox: layout only, no system users)
+	if req.Provision && a.cfg.Sandbox != "" {
+		if _, err := users.EnsureSiteLayout(wr); err != nil {
+			return out, err
+		}
+	} else if req.Provision {
+		if err := users.EnsureSystemUser(a.run, user, home); err != nil {
 			return out, err
 		}
 		webGroup := a.cfg.Hosting.WebGroup
@@ -119,6 +179,34 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 	}
 	out.Site = s
 
+	if req.Provision && a.cfg.Sandbox == "" {
+		if err := a.sftpBindSite(s); err != nil {
+			out.Warnings = append(out.Warnings, "sftp jail: "+err.Error())
+		}
+	}
+
+	if mode == "redirect" {
+		if err := a.st.SetSiteRedirect(domain, strings.TrimSpace(req.RedirectTo), redirectCode, req.RedirectKeepPath); err != nil {
+			return out, err
+		}
+		if out.Site, err = a.st.GetSiteByDomain(domain); err != nil {
+			return out, err
+		}
+	}
+
+	if req.Placeholder && !s.Placeholder {
+		if err := a.st.SetSitePlaceholder(domain, true); err != nil {
+			return out, err
+		}
+		out.Site.Placeholder = true
+	}
+	if req.Hardened && !s.Hardened {
+		if err := a.st.SetSiteHardened(domain, true); err != nil {
+			return out, err
+		}
+		out.Site.Hardened = true
+	}
+
 	// If proxy targets were provided on create, persist them before apply.
 	if mode == "proxy" && len(req.ProxyTargets) > 0 {
 		for _, line := range req.ProxyTargets {
@@ -137,7 +225,11 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 					}
 				}
 			}
-			if err := a.st.UpsertProxyTarget(s.ID, addr, weight, false, true); err != nil {
+			if err := a.checkTargetQuota(u, s.ID, addr); err != nil {
+				out.Warnings = append(out.Warnings, "proxy target "+addr+" skipped: "+err.Error())
+				continue
+			}
+			if err := a.st.UpsertProxyTarget(s.ID, addr, weight, false, true, ""); err != nil {
 				out.Warnings = append(out.Warnings, "proxy target add failed: "+err.Error())
 			}
 		}
@@ -152,7 +244,11 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 		}
 	}
 
-
+	if req.DNSRecords {
+		if _, err := a.SiteDNSRecords(context.Background(), domain); err != nil {
+			out.Warnings = append(out.Warnings, "dns records: "+err.Error())
+		}
+	}
 
 	// Bootstrap vhost immediately so HTTP-01 can work (unless disabled).
 	if req.ApplyNow {
@@ -163,9 +259,7 @@ func (a *App) SiteAdd(ctx context.Context, req SiteAddRequest) (SiteAddResult, e
 
 	// Issue certificate automatically (unless skipped).
 	if !req.SkipCert {
-		ctx2, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer cancel()
-		if err := a.CertIssue(ctx2, domain, true /* apply */); err != nil {
+		if err := a.CertIssue(context.Background(), domain, true /* apply */); err != nil {
 			out.Warnings = append(out.Warnings, "certificate issuance failed: "+err.Error())
 		}
 	}
@@ -177,7 +271,7 @@ func (a *App) SiteDisable(ctx context.Context, domain string) error {
 	_ = ctx
 	d := strings.ToLower(strings.TrimSpace(domain))
 	if d == "" {
-		return fmt.Errorf("domain is required")
+		return invalidf("domain is required")
 	}
 	return a.st.DisableSiteByDomain(d)
 }
@@ -186,11 +280,21 @@ func (a *App) SiteDisable(ctx context.Context, domain string) error {
 func (a *App) SiteEnable(ctx context.Context, domain string) (store.Site, error) {
     domain = strings.TrimSpace(domain)
     if domain == "" {
-        return store.Site{}, fmt.Errorf("domain is required")
+        return store.Site{}, invalidf("domain is required")
+    }
+    if cur, err := a.st.GetSiteByDomain(domain); err == nil && !cur.Enabled {
+        if _, err := a.checkServerName(strings.ToLower(domain)); err != nil {
+            return store.Site{}, err
+        }
     }
     if err := a.st.EnableSiteByDomain(domain); err != nil {
         return store.Site{}, err
     }
+    if cur, err := a.st.GetSiteByDomain(domain); err == nil {
+        if err := a.clearPassedExpiry(cur); err != nil {
+            return store.Site{}, err
+        }
+    }
     return a.st.GetSiteByDomain(domain)
 }
 
@@ -199,14 +303,12 @@ func (a *App) SiteEnable(ctx context.Context, domain string) (store.Site, error)
 func (a *App) SiteDelete(ctx context.Context, domain string) error {
     domain = strings.TrimSpace(domain)
     if domain == "" {
-        return fmt.Errorf("domain is required")
+        return invalidf("domain is required")
     }
 
     // Best-effort remove live vhost (ignore missing file)
-    removed := false
-    if err := a.ng.RemoveLiveSite(domain); err == nil {
-        removed = true
-    } else if !os.IsNotExist(err) {
+    removed, err := a.ng.RemoveLiveSite(domain)
+    if err != nil {
         return fmt.Errorf("remove live vhost: %w", err)
     }
 
@@ -216,6 +318,10 @@ func (a *App) SiteDelete(ctx context.Context, domain string) error {
         }
     }
 
+    if s, err := a.st.GetSiteByDomain(domain); err == nil {
+        a.sftpUnbindSite(s)
+    }
+
     // Hard delete from DB (handles proxy_targets/apply_runs too)
     return a.st.DeleteSiteByDomain(domain)
 }
@@ -228,16 +334,20 @@ func (a *App) SiteEdit(ctx context.Context, req SiteEditRequest) (store.Site, er
 
 	d := strings.ToLower(strings.TrimSpace(req.Domain))
 	if d == "" {
-		return store.Site{}, fmt.Errorf("domain is required")
+		return store.Site{}, invalidf("domain is required")
 	}
 
 	cur, err := a.st.GetSiteByDomain(d)
 	if err != nil {
 		return store.Site{}, err
 	}
+	if req.ExpectedRevision > 0 && req.ExpectedRevision != cur.Revision {
+		return store.Site{}, store.ErrRevisionConflict
+	}
 
 	// Update user (optional)
 	userID := cur.UserID
+	var owner store.User
 	if strings.TrimSpace(req.User) != "" {
 		user := strings.TrimSpace(req.User)
 		home := filepath.Join(a.cfg.Hosting.HomeRoot, user)
@@ -246,15 +356,26 @@ func (a *App) SiteEdit(ctx context.Context, req SiteEditRequest) (store.Site, er
 			return store.Site{}, err
 		}
 		userID = u.ID
+		owner = u
+	} else if owner, err = a.st.GetUserByID(cur.UserID); err != nil {
+		return store.Site{}, err
+	}
+	if userID != cur.UserID {
+		if err := a.checkSiteQuota(owner); err != nil {
+			return store.Site{}, err
+		}
 	}
 
 	mode := cur.Mode
 	if strings.TrimSpace(req.Mode) != "" {
 		mode = strings.TrimSpace(req.Mode)
-		if mode != "php" && mode != "proxy" && mode != "static" {
-			return store.Site{}, fmt.Errorf("invalid mode %q", mode)
+		if !validSiteMode(mode) {
+			return store.Site{}, invalidf("invalid mode %q", mode)
 		}
 	}
+	if mode == "redirect" && cur.RedirectURL == "" {
+		return store.Site{}, invalidf("set the redirect target first (site redirect), then switch %s to redirect mode", d)
+	}
 
 	phpv := cur.PHPVersion
 	if strings.TrimSpace(req.PHP) != "" {
@@ -276,6 +397,18 @@ func (a *App) SiteEdit(ctx context.Context, req SiteEditRequest) (store.Site, er
 		enabled = *req.Enabled
 	}
 
+	if enabled && !cur.Enabled {
+		if _, err := a.checkServerName(d); err != nil {
+			return store.Site{}, err
+		}
+	}
+
+	if mode == "php" && (phpv != cur.PHPVersion || cur.Mode != "php" || userID != cur.UserID) {
+		if err := a.checkPHPAllowed(owner, phpv); err != nil {
+			return store.Site{}, err
+		}
+	}
+
 	updated, err := a.st.UpsertSite(store.Site{
 		UserID:      userID,
 		Domain:      d,
@@ -284,10 +417,16 @@ func (a *App) SiteEdit(ctx context.Context, req SiteEditRequest) (store.Site, er
 		PHPVersion:  phpv,
 		EnableHTTP3: http3,
 		Enabled:     enabled,
+		Revision:    cur.Revision, // guards against a concurrent edit between read and write
 	})
 	if err != nil {
 		return store.Site{}, err
 	}
+	if enabled && !cur.Enabled {
+		if err := a.clearPassedExpiry(cur); err != nil {
+			return store.Site{}, err
+		}
+	}
 
 	if req.ApplyNow {
 		_, _ = a.Apply(context.Background(), ApplyRequest{Domain: d})
@@ -297,48 +436,115 @@ func (a *App) SiteEdit(ctx context.Context, req SiteEditRequest) (store.Site, er
 }
 
 func (a *App) SiteList(ctx context.Context) ([]SiteListItem, error) {
-	_ = ctx
-	sites, err := a.st.ListSites()
+	return a.SiteListQuery(ctx, store.SiteListOptions{})
+}
+
+// certCacheTTL is how long a cert_cache row is trusted before the site list
+// re-reads the certificate from disk.
+const certCacheTTL = 10 * time.Minute
+
+// SiteListQuery is the site list in the given order. Owner, state and certificate
+// expiry come from one store query; certificates are only read from disk for sites
+// whose cached expiry is missing, older than certCacheTTL or older than the last
+// apply (which is when a newly issued certificate goes live).
+func (a *App) SiteListQuery(ctx context.Context, opts store.SiteListOptions) ([]SiteListItem, error) {
+	if err := checkSiteListOptions(opts); err != nil {
+		return nil, err
+	}
+	rows, err := a.st.ListSiteRows(opts)
 	if err != nil {
 		return nil, err
 	}
-	out := make([]SiteListItem, 0, len(sites))
-	for _, s := range sites {
-		state, last := computeSiteState(s)
-		out = append(out, SiteListItem{Site: s, State: state, Last: last})
+	now := time.Now()
+	out := make([]SiteListItem, 0, len(rows))
+	for _, r := range rows {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		notAfter := r.CertNotAfter
+		if certCacheStale(r, now) {
+			notAfter = a.refreshCertCache(r.Site)
+		}
+		it := SiteListItem{Site: r.Site, State: r.State, Last: "-", Owner: r.Owner, Cert: notAfter}
+		if r.LastAppliedAt != nil {
+			it.Last = r.LastAppliedAt.Format("2006-01-02 15:04")
+		}
+		if notAfter != nil {
+			it.CertDays = int(notAfter.Sub(now).Hours() / 24)
+		}
+		out = append(out, it)
 	}
 	return out, nil
 }
 
+// SiteListCount is how many sites match the filters of opts, for paging SiteListQuery.
+func (a *App) SiteListCount(opts store.SiteListOptions) (int, error) {
+	if err := checkSiteListOptions(opts); err != nil {
+		return 0, err
+	}
+	return a.st.CountSiteRows(opts)
+}
+
+func checkSiteListOptions(opts store.SiteListOptions) error {
+	if opts.Sort != "" && !validSiteSort(opts.Sort) {
+		return invalidf("invalid sort column %q (want %s)", opts.Sort, strings.Join(store.SiteSortColumns, ", "))
+	}
+	switch opts.Mode {
+	case "", "php", "proxy", "static", "redirect":
+	default:
+		return invalidf("invalid mode %q (want php, proxy, static or redirect)", opts.Mode)
+	}
+	if opts.State != "" && !slices.Contains(store.SiteStates, opts.State) {
+		return invalidf("invalid state %q (want %s)", opts.State, strings.Join(store.SiteStates, ", "))
+	}
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return invalidf("limit and offset cannot be negative")
+	}
+	return nil
+}
+
+func validSiteSort(col string) bool {
+	for _, c := range store.SiteSortColumns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+func certCacheStale(r store.SiteRow, now time.Time) bool {
+	if r.CertCheckedAt == nil || now.Sub(*r.CertCheckedAt) > certCacheTTL {
+		return true
+	}
+	return r.LastAppliedAt != nil && r.LastAppliedAt.After(*r.CertCheckedAt)
+}
+
+// refreshCertCache reads the site's certificate and records its expiry; nil when
+// there is none. A failed cache write only costs a re-read next time.
+func (a *App) refreshCertCache(s store.Site) *time.Time {
+	var notAfter *time.Time
+	if ci, err := a.siteCertInfo(s); err == nil && ci != nil && ci.Exists {
+		t := ci.NotAfter
+		notAfter = &t
+	}
+	if err := a.st.SetCertCache(s.Domain, notAfter); err != nil {
+		log.Printf("cert cache %s: %v", s.Domain, err)
+	}
+	return notAfter
+}
 
 func (a *App) SiteGet(ctx context.Context, domain string) (store.Site, error) {
 	_ = ctx
 	d := strings.ToLower(strings.TrimSpace(domain))
 	if d == "" {
-		return store.Site{}, fmt.Errorf("domain is required")
+		return store.Site{}, invalidf("domain is required")
 	}
 	return a.st.GetSiteByDomain(d)
 }
 
 
 
-func computeSiteState(s store.Site) (state string, last string) {
-	last = "-"
-	if s.LastAppliedAt != nil {
-		last = s.LastAppliedAt.Format("2006-01-02 15:04")
-	}
-
-	if !s.Enabled {
-		return "DISABLED", last
-	}
-	if s.LastApplyStatus == "fail" {
-		return "ERROR", last
-	}
-	if siteNeedsApply(s) {
-		return "PENDING", last
-	}
-	if s.LastApplyStatus == "ok" {
-		return "OK", last
-	}
-	return "PENDING", last
+// validSiteMode reports whether mode is one of the site modes.
+func validSiteMode(mode string) bool {
+	return mode == "php" || mode == "proxy" || mode == "static" || mode == "redirect"
 }
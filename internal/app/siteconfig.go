@@ -0,0 +1,100 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/util"
+)
+
+// SiteConfig is the vhost ngm generated for a site: the live file nginx loads and
+// the last staged render, which differs from it after a failed apply.
+type SiteConfig struct {
+	Domain     string
+	LivePath   string
+	Live       []byte // nil = not published (never applied, or disabled)
+	StagedPath string
+	Staged     []byte // nil = never rendered
+}
+
+// StagedDiffers reports whether the staged render is not what nginx serves (the
+// stamp header of the live file aside).
+func (c SiteConfig) StagedDiffers() bool {
+	return c.Staged != nil && !bytes.Equal(nginx.StripStamp(c.Live), c.Staged)
+}
+
+// SiteConfig reads the generated vhost files of an existing site.
+func (a *App) SiteConfig(ctx context.Context, domain string) (SiteConfig, error) {
+	_ = ctx
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return SiteConfig{}, fmt.Errorf("get site: %w", err)
+	}
+	c := SiteConfig{Domain: site.Domain}
+	c.LivePath, c.StagedPath = a.ng.SiteConfPaths(site.Domain)
+	if c.Live, err = readOptional(c.LivePath); err != nil {
+		return SiteConfig{}, err
+	}
+	if c.Staged, err = readOptional(c.StagedPath); err != nil {
+		return SiteConfig{}, err
+	}
+	return c, nil
+}
+
+// SiteRender is the vhost the next apply of a site would publish, rendered from
+// the current settings.
+type SiteRender struct {
+	Domain  string
+	Enabled bool   // a disabled site's vhost is removed by an apply, not published
+	Conf    []byte // without the stamp header Publish adds
+	Hash    string // sha256 of Conf, as apply history records it
+	Live    []byte // nil = not published
+	Diff    string // unified diff of the live vhost to Conf ("" = the same)
+	Added   int
+	Removed int
+}
+
+// SiteRender renders the vhost of domain as an apply would, without writing the
+// staging dir or publishing anything, and compares it with the live file.
+func (a *App) SiteRender(ctx context.Context, domain string) (SiteRender, error) {
+	_ = ctx
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return SiteRender{}, fmt.Errorf("get site: %w", err)
+	}
+	proxyLister, _ := a.st.(proxyTargetLister)
+	td, err := a.buildTemplateData(site, site.Domain, proxyLister)
+	if err != nil {
+		return SiteRender{}, err
+	}
+	conf, err := a.ng.RenderSite(td)
+	if err != nil {
+		return SiteRender{}, err
+	}
+	r := SiteRender{Domain: site.Domain, Enabled: site.Enabled, Conf: conf, Hash: util.Sha256Hex(conf)}
+	livePath, _ := a.ng.SiteConfPaths(site.Domain)
+	if r.Live, err = readOptional(livePath); err != nil {
+		return SiteRender{}, err
+	}
+	if live := nginx.StripStamp(r.Live); !bytes.Equal(live, conf) {
+		r.Diff, r.Added, r.Removed = unifiedDiff(site.Domain+".conf", live, conf)
+	}
+	return r, nil
+}
+
+// readOptional is os.ReadFile with a missing file returning nil.
+func readOptional(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mynginx/internal/nginx"
+	"mynginx/internal/store"
+)
+
+// Limits of the per-site upstream keepalive settings.
+const (
+	maxKeepaliveConns    = 1024
+	maxKeepaliveRequests = 1000000
+	maxKeepaliveTimeout  = time.Hour
+)
+
+// siteKeepalive is the upstream keepalive pool of a proxy site: its own settings,
+// each falling back to hosting.upstream_keepalive.
+func (a *App) siteKeepalive(s store.Site) nginx.KeepaliveCfg {
+	def := a.cfg.Hosting.UpstreamKeepalive
+	k := nginx.KeepaliveCfg{Connections: def.Connections, Requests: def.Requests, Timeout: nginxSeconds(def.Timeout)}
+	if s.KeepaliveConns > 0 {
+		k.Connections = s.KeepaliveConns
+	}
+	if s.KeepaliveRequests > 0 {
+		k.Requests = s.KeepaliveRequests
+	}
+	if s.KeepaliveTimeout != "" {
+		k.Timeout = nginxSeconds(s.KeepaliveTimeout)
+	}
+	return k
+}
+
+// nginxSeconds turns a Go duration into whole nginx seconds ("1m30s" -> "90s").
+func nginxSeconds(d string) string {
+	dur, _ := time.ParseDuration(d)
+	return fmt.Sprintf("%ds", int(dur.Seconds()))
+}
+
+// SiteKeepalive sets the upstream keepalive pool of a proxy site: idle connections
+// per worker, requests per connection and idle timeout (0 / "" = the default of
+// hosting.upstream_keepalive). An enabled site is applied, and the previous
+// settings restored if that fails.
+func (a *App) SiteKeepalive(ctx context.Context, domain string, conns, requests int, timeout string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "proxy" {
+		return invalidf("%s is a %s site: upstream keepalive applies to proxy sites", domain, site.Mode)
+	}
+	timeout = strings.TrimSpace(timeout)
+	switch {
+	case conns < 0 || conns > maxKeepaliveConns:
+		return invalidf("keepalive connections must be 0 (default) to %d", maxKeepaliveConns)
+	case requests < 0 || requests > maxKeepaliveRequests:
+		return invalidf("keepalive requests must be 0 (default) to %d", maxKeepaliveRequests)
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < time.Second || d > maxKeepaliveTimeout {
+			return invalidf("keepalive timeout %q: use a duration from 1s to %s, or empty for the default", timeout, maxKeepaliveTimeout)
+		}
+	}
+	if site.KeepaliveConns == conns && site.KeepaliveRequests == requests && site.KeepaliveTimeout == timeout {
+		return nil
+	}
+
+	if err := a.st.SetSiteKeepalive(domain, conns, requests, timeout); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteKeepalive(domain, site.KeepaliveConns, site.KeepaliveRequests, site.KeepaliveTimeout); rerr != nil {
+			return fmt.Errorf("keepalive apply failed: %v (restoring previous settings also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("keepalive apply failed (previous settings kept): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"mynginx/internal/stats"
+)
+
+// SiteLogs are the logs of a site shown by SiteLogTail, by name: files in the
+// site's logs directory.
+var SiteLogs = map[string]string{
+	"access": "access.log",
+	"error":  "error.log",
+}
+
+// Line counts of SiteLogTail.
+const (
+	DefaultLogLines = 200
+	MaxLogLines     = 2000
+)
+
+var (
+	// nginx error log: "2025/01/02 03:04:05 [error] 12#12: ..."
+	nginxLevel = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} \[([a-z]+)\]`)
+	// access log (combined): the status after the quoted request line
+	accessStatus = regexp.MustCompile(`" ([1-5])\d\d `)
+)
+
+// LogLine is a line of a site log with its severity: "error", "warn" or "" (the
+// rest).
+type LogLine struct {
+	Text  string
+	Level string
+}
+
+// SiteLog is the tail of one log of a site.
+type SiteLog struct {
+	Domain  string
+	Log     string // key of SiteLogs
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Missing bool // nothing logged yet
+	Lines   []LogLine
+}
+
+// SiteLogTail returns the last n lines of the log name (see SiteLogs) of domain.
+func (a *App) SiteLogTail(domain, name string, n int) (SiteLog, error) {
+	out := SiteLog{Log: name}
+	switch {
+	case n <= 0:
+		n = DefaultLogLines
+	case n > MaxLogLines:
+		n = MaxLogLines
+	}
+	var err error
+	if out.Domain, out.Path, err = a.siteLogPath(domain, name); err != nil {
+		return out, err
+	}
+	f, fi, err := openSiteLog(out.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		out.Missing = true
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+	defer f.Close()
+	out.Size, out.ModTime = fi.Size(), fi.ModTime()
+
+	lines, err := stats.TailLines(f, n)
+	if err != nil {
+		return out, err
+	}
+	for _, l := range lines {
+		out.Lines = append(out.Lines, LogLine{Text: l, Level: logLevel(name, l)})
+	}
+	return out, nil
+}
+
+// siteLogPath is the normalized domain and the path of its log name.
+func (a *App) siteLogPath(domain, name string) (string, string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	file, ok := SiteLogs[name]
+	if !ok {
+		return domain, "", invalidf("unknown log %q (want access or error)", name)
+	}
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return domain, "", fmt.Errorf("get site: %w", err)
+	}
+	return domain, filepath.Join(filepath.Dir(site.Webroot), "logs", file), nil
+}
+
+// openSiteLog opens the site log at path. Only a regular file directly in the
+// site's logs directory is read: the site user owns that directory, so a symlink
+// planted there is refused rather than followed.
+func openSiteLog(path string) (*os.File, fs.FileInfo, error) {
+	if fi, err := os.Lstat(filepath.Dir(path)); err == nil && !fi.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", filepath.Dir(path))
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the file opened must be the one checked (not swapped for a link since)
+	if of, err := f.Stat(); err != nil || !os.SameFile(fi, of) {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s changed while it was opened", path)
+	}
+	return f, fi, nil
+}
+
+// logLevel is the severity of a line of the log name.
+// An access log line is rated by its status (5xx error, 4xx warn), an error log
+// line by its nginx level.
+func logLevel(name, line string) string {
+	if name == "access" {
+		if m := accessStatus.FindStringSubmatch(line); m != nil {
+			switch m[1] {
+			case "5":
+				return "error"
+			case "4":
+				return "warn"
+			}
+		}
+		return ""
+	}
+	if m := nginxLevel.FindStringSubmatch(line); m != nil {
+		switch m[1] {
+		case "emerg", "alert", "crit", "error":
+			return "error"
+		case "warn":
+			return "warn"
+		}
+	}
+	return ""
+}
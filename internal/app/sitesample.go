@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/nginx"
+)
+
+// maxSampleRate is the largest N of a "1/N" access log sample (0.01% in nginx).
+const maxSampleRate = 10000
+
+// parseAccessSample normalizes a site's access log sampling: "" or "all" = every
+// request, "errors" = 4xx/5xx only, "1/N" or "N" = the errors plus one in N of the
+// other requests.
+func parseAccessSample(v string) (string, nginx.AccessSampleCfg, error) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "", "all", "off":
+		return "", nginx.AccessSampleCfg{}, nil
+	case "errors":
+		return v, nginx.AccessSampleCfg{ErrorsOnly: true}, nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(v, "1/"))
+	if err != nil || n < 2 || n > maxSampleRate {
+		return "", nginx.AccessSampleCfg{}, invalidf("access log sample %q: use errors or 1/N with N from 2 to %d", v, maxSampleRate)
+	}
+	return fmt.Sprintf("1/%d", n), nginx.AccessSampleCfg{Percent: fmt.Sprintf("%.2f%%", 100/float64(n))}, nil
+}
+
+// SiteAccessLogSample sets the access log sampling of a busy site (see
+// parseAccessSample) to save disk IO; the upstream stats log is not sampled.
+// An enabled site is applied, and the previous setting restored if that fails.
+func (a *App) SiteAccessLogSample(ctx context.Context, domain, sample string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	sample, _, err = parseAccessSample(sample)
+	if err != nil {
+		return err
+	}
+	if site.AccessLogSample == sample {
+		return nil
+	}
+
+	prev := site.AccessLogSample
+	if err := a.st.SetSiteAccessLogSample(domain, sample); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteAccessLogSample(domain, prev); rerr != nil {
+			return fmt.Errorf("log sampling apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("log sampling apply failed (previous setting kept): %w", err)
+	}
+	return nil
+}
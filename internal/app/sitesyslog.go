@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"mynginx/internal/nginx"
+)
+
+// SiteAccessSyslog ships a site's access log to a syslog collector in addition to
+// the local file (nginx `access_log syslog:server=`; UDP only). server is
+// "host:port", "host" (port 514) or "unix:/path"; "" turns it off.
+func (a *App) SiteAccessSyslog(ctx context.Context, domain, server string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	server = strings.TrimSpace(server)
+
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if err := validSyslogServer(server); err != nil {
+		return err
+	}
+	if site.AccessSyslog == server {
+		return nil
+	}
+
+	prev := site.AccessSyslog
+	if err := a.st.SetSiteAccessSyslog(domain, server); err != nil {
+		return err
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		if rerr := a.st.SetSiteAccessSyslog(domain, prev); rerr != nil {
+			return fmt.Errorf("syslog apply failed: %v (restoring previous setting also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("syslog apply failed (previous setting kept): %w", err)
+	}
+	return nil
+}
+
+func validSyslogServer(server string) error {
+	switch {
+	case server == "":
+		return nil
+	case strings.HasPrefix(server, "unix:"):
+		if !strings.HasPrefix(server, "unix:/") || strings.ContainsAny(server, " \t;{},") {
+			return invalidf("invalid syslog socket %q", server)
+		}
+		return nil
+	case strings.ContainsAny(server, " \t;{},\"'$"):
+		return invalidf("invalid syslog server %q", server)
+	}
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return nil
+	}
+	if strings.Contains(server, ":") {
+		return invalidf("invalid syslog server %q (use host:port or [ipv6]:port)", server)
+	}
+	return nil
+}
+
+// syslogTag is the nginx syslog tag for a site (alphanumerics/underscore, max 32).
+func syslogTag(domain string) string {
+	tag := "ngm_" + nginx.MakeUpstreamKey(domain)
+	if len(tag) > 32 {
+		tag = tag[:32]
+	}
+	return tag
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var tagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// SiteTags replaces the tags of a site (nil clears them) and returns them sorted and
+// de-duplicated. Tags select sites for bulk operations such as `ngm php migrate --tag`.
+func (a *App) SiteTags(domain string, tags []string) ([]string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if !tagRe.MatchString(t) {
+			return nil, invalidf("invalid tag %q (a-z, 0-9, _ -; up to 32)", t)
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	if strings.Join(out, ",") == strings.Join(site.Tags, ",") {
+		return out, nil
+	}
+	if err := a.st.SetSiteTags(domain, out); err != nil {
+		return nil, err
+	}
+	a.event("info", "site", "%s: tags %s", domain, targetList(out))
+	return out, nil
+}
+
+// hasTag reports whether tags contains tag.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
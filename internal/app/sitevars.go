@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// varName is a template variable name: usable as {{ .Vars.name }}.
+var varName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Limits of the template variables of a site.
+const (
+	maxSiteVars     = 64
+	maxSiteVarValue = 4096
+)
+
+// SiteVars lists a site's template variables, sorted by name.
+func (a *App) SiteVars(ctx context.Context, domain string) ([]store.SiteVar, error) {
+	_ = ctx
+	site, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	return a.st.ListSiteVars(site.ID)
+}
+
+// SiteVarSet sets a template variable of the site (an existing one of that name is
+// replaced); templates read it as .Vars.<name>. An enabled site is applied, and the
+// previous value restored if that fails.
+func (a *App) SiteVarSet(ctx context.Context, domain, name, value string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	name = strings.TrimSpace(name)
+	if !varName.MatchString(name) || len(name) > 64 {
+		return invalidf("invalid variable name %q: use letters, digits and _ (not first)", name)
+	}
+	if len(value) > maxSiteVarValue || strings.IndexFunc(value, func(r rune) bool { return (r < 0x20 && r != '\t') || r == 0x7f }) >= 0 {
+		return invalidf("invalid value for variable %s: one line of at most %d bytes", name, maxSiteVarValue)
+	}
+
+	vars, err := a.SiteVars(ctx, domain)
+	if err != nil {
+		return err
+	}
+	var prev *store.SiteVar
+	for _, v := range vars {
+		if v.Name == name {
+			prev = &v
+			break
+		}
+	}
+	if prev == nil && len(vars) >= maxSiteVars {
+		return invalidf("%s already has %d template variables", domain, maxSiteVars)
+	}
+	if prev != nil && prev.Value == value {
+		return nil
+	}
+	if err := a.st.SetSiteVar(domain, store.SiteVar{Name: name, Value: value}); err != nil {
+		return err
+	}
+	return a.applyVars(ctx, domain, name, prev)
+}
+
+// SiteVarRemove drops a template variable from the site.
+func (a *App) SiteVarRemove(ctx context.Context, domain, name string) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	name = strings.TrimSpace(name)
+
+	vars, err := a.SiteVars(ctx, domain)
+	if err != nil {
+		return err
+	}
+	var prev *store.SiteVar
+	for _, v := range vars {
+		if v.Name == name {
+			prev = &v
+			break
+		}
+	}
+	if prev == nil {
+		return fmt.Errorf("%s has no template variable %s: %w", domain, name, sql.ErrNoRows)
+	}
+	if err := a.st.DeleteSiteVar(domain, name); err != nil {
+		return err
+	}
+	return a.applyVars(ctx, domain, name, prev)
+}
+
+// applyVars applies an enabled site after a variable change and puts prev back
+// (nil = no such variable before) if that fails.
+func (a *App) applyVars(ctx context.Context, domain, name string, prev *store.SiteVar) error {
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return fmt.Errorf("get site: %w", err)
+	}
+	if !site.Enabled {
+		return nil
+	}
+	if _, err := a.Apply(ctx, ApplyRequest{Domain: domain}); err != nil {
+		var rerr error
+		if prev != nil {
+			rerr = a.st.SetSiteVar(domain, *prev)
+		} else if derr := a.st.DeleteSiteVar(domain, name); derr != nil && !errors.Is(derr, sql.ErrNoRows) {
+			rerr = derr
+		}
+		if rerr != nil {
+			return fmt.Errorf("template variable apply failed: %v (restoring previous variables also failed: %v)", err, rerr)
+		}
+		return fmt.Errorf("template variable apply failed (previous variables kept): %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,528 @@
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/notify"
+	"mynginx/internal/util"
+)
+
+// Snapshots are named ngm-config-<UTC time>.tar.gz under snapshots.dir.
+const (
+	snapshotPrefix = "ngm-config-"
+	snapshotSuffix = ".tar.gz"
+	snapshotLayout = "20060102T150405Z"
+
+	// snapshotDiffMax caps the diff that goes into a mail or webhook.
+	snapshotDiffMax = 256 << 10
+	// diffMaxCells bounds the line-by-line comparison of one file (lines before x after).
+	diffMaxCells = 4 << 20
+)
+
+// ConfigSnapshot is an archive of the managed nginx tree.
+type ConfigSnapshot struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+}
+
+// SnapshotChange is a file that differs between two snapshots.
+type SnapshotChange struct {
+	Path    string `json:"path"`
+	Change  string `json:"change"` // added | removed | modified
+	Added   int    `json:"lines_added"`
+	Removed int    `json:"lines_removed"`
+}
+
+// SnapshotReport compares a snapshot with the one before it; it is posted as JSON
+// to snapshots.webhooks.
+type SnapshotReport struct {
+	Event    string           `json:"event"` // "config_changed"
+	Host     string           `json:"host"`
+	Snapshot string           `json:"snapshot"`
+	Previous string           `json:"previous,omitempty"`
+	Since    *time.Time       `json:"since,omitempty"` // when Previous was taken
+	Changes  []SnapshotChange `json:"changes"`
+	Diff     string           `json:"diff,omitempty"` // unified diff, cut at snapshotDiffMax
+}
+
+// Changed reports whether the snapshots differ.
+func (r SnapshotReport) Changed() bool { return len(r.Changes) > 0 }
+
+// ConfigSnapshots lists the archives under snapshots.dir, newest first.
+func (a *App) ConfigSnapshots() ([]ConfigSnapshot, error) {
+	entries, err := os.ReadDir(a.cfg.Snapshots.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []ConfigSnapshot
+	for _, e := range entries {
+		at, ok := snapshotTime(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		sn := ConfigSnapshot{Name: e.Name(), CreatedAt: at}
+		if fi, err := e.Info(); err == nil {
+			sn.Size = fi.Size()
+		}
+		out = append(out, sn)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func snapshotTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+	return t, err == nil
+}
+
+// SnapshotTake archives the managed nginx tree and compares it with the newest
+// archive (the first one lists every file as added, without Previous). An
+// unchanged tree adds no archive: the report then names the newest one and has no
+// changes. Archives beyond snapshots.keep are removed.
+func (a *App) SnapshotTake() (SnapshotReport, error) {
+	files, err := a.snapshotFiles()
+	if err != nil {
+		return SnapshotReport{}, err
+	}
+	list, err := a.ConfigSnapshots()
+	if err != nil {
+		return SnapshotReport{}, err
+	}
+
+	rep := SnapshotReport{Event: "config_changed", Host: hostname()}
+	var before map[string][]byte
+	if len(list) > 0 {
+		prev := list[0]
+		if before, err = readSnapshot(filepath.Join(a.cfg.Snapshots.Dir, prev.Name)); err != nil {
+			return rep, fmt.Errorf("read %s: %w", prev.Name, err)
+		}
+		rep.Previous, rep.Since = prev.Name, &prev.CreatedAt
+		rep.Changes, rep.Diff = compareSnapshots(before, files)
+		if !rep.Changed() {
+			rep.Snapshot, rep.Previous, rep.Since = prev.Name, "", nil
+			return rep, nil
+		}
+	} else {
+		// the first snapshot: every file is new, without a diff
+		for _, name := range unionKeys(files, nil) {
+			rep.Changes = append(rep.Changes, SnapshotChange{Path: name, Change: "added", Added: len(diffLines(files[name]))})
+		}
+	}
+
+	now := time.Now().UTC()
+	rep.Snapshot = snapshotPrefix + now.Format(snapshotLayout) + snapshotSuffix
+	if err := util.MkdirAll(a.cfg.Snapshots.Dir, 0o700); err != nil {
+		return rep, err
+	}
+	if err := writeSnapshot(filepath.Join(a.cfg.Snapshots.Dir, rep.Snapshot), files, now); err != nil {
+		return rep, err
+	}
+	if before == nil {
+		a.event("info", "snapshots", "configuration snapshot %s taken (%d files, the first one)", rep.Snapshot, len(files))
+	} else {
+		a.event("info", "snapshots", "configuration snapshot %s: %d file(s) changed since %s", rep.Snapshot, len(rep.Changes), rep.Previous)
+	}
+
+	keep := a.cfg.Snapshots.Keep
+	for i := keep - 1; keep > 0 && i < len(list); i++ {
+		if err := os.Remove(filepath.Join(a.cfg.Snapshots.Dir, list[i].Name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("snapshots: %v", err)
+		}
+	}
+	return rep, nil
+}
+
+// SnapshotDiff compares two archives by name; empty names compare the newest with
+// the one before it.
+func (a *App) SnapshotDiff(from, to string) (SnapshotReport, error) {
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" || to == "" {
+		list, err := a.ConfigSnapshots()
+		if err != nil {
+			return SnapshotReport{}, err
+		}
+		if to == "" {
+			if len(list) == 0 {
+				return SnapshotReport{}, invalidf("no snapshots under %s yet", a.cfg.Snapshots.Dir)
+			}
+			to = list[0].Name
+		}
+		if from == "" {
+			for _, sn := range list {
+				if sn.Name < to {
+					from = sn.Name
+					break
+				}
+			}
+			if from == "" {
+				return SnapshotReport{}, invalidf("no snapshot before %s to compare with", to)
+			}
+		}
+	}
+	rep := SnapshotReport{Event: "config_changed", Host: hostname(), Snapshot: to, Previous: from}
+	var files [2]map[string][]byte
+	for i, name := range []string{from, to} {
+		at, ok := snapshotTime(name)
+		if !ok || name != filepath.Base(name) {
+			return rep, invalidf("%q is not a snapshot name (%s<time>%s)", name, snapshotPrefix, snapshotSuffix)
+		}
+		if i == 0 {
+			rep.Since = &at
+		}
+		m, err := readSnapshot(filepath.Join(a.cfg.Snapshots.Dir, name))
+		if err != nil {
+			return rep, err
+		}
+		files[i] = m
+	}
+	rep.Changes, rep.Diff = compareSnapshots(files[0], files[1])
+	return rep, nil
+}
+
+// snapshotFiles reads the managed nginx tree: nginx.conf, the vhosts and the global snippets.
+func (a *App) snapshotFiles() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	if data, err := os.ReadFile(a.paths.NginxMainConf); err == nil {
+		files["nginx.conf"] = data
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, d := range []struct{ prefix, dir string }{
+		{"sites", a.paths.NginxSitesDir},
+		{"global", a.paths.NginxGlobalDir},
+	} {
+		if d.dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(d.dir, func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == d.dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !e.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(d.dir, p)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			files[d.prefix+"/"+filepath.ToSlash(rel)] = data
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func writeSnapshot(path string, files map[string][]byte, at time.Time) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		data := files[name]
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: at, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, buf.Bytes(), 0o600)
+}
+
+func readSnapshot(path string) (map[string][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+}
+
+// compareSnapshots lists the files that differ between before and after, with
+// their unified diff (cut at snapshotDiffMax).
+func compareSnapshots(before, after map[string][]byte) ([]SnapshotChange, string) {
+	var changes []SnapshotChange
+	var diff strings.Builder
+	for _, name := range unionKeys(before, after) {
+		old, inOld := before[name]
+		cur, inCur := after[name]
+		c := SnapshotChange{Path: name, Change: "modified"}
+		switch {
+		case !inOld:
+			c.Change = "added"
+		case !inCur:
+			c.Change = "removed"
+		case bytes.Equal(old, cur):
+			continue
+		}
+		text, added, removed := unifiedDiff(name, old, cur)
+		c.Added, c.Removed = added, removed
+		changes = append(changes, c)
+		diff.WriteString(text)
+	}
+	out := diff.String()
+	if len(out) > snapshotDiffMax {
+		out = out[:snapshotDiffMax] + "\n[diff cut at 256 KiB]\n"
+	}
+	return changes, out
+}
+
+// unifiedDiff is the unified diff (3 lines of context) of one file, with the
+// number of lines added and removed. Files too large to compare line by line get
+// a one-line note and the counts of lineDiff.
+func unifiedDiff(name string, before, after []byte) (string, int, int) {
+	a, b := diffLines(before), diffLines(after)
+	head := fmt.Sprintf("--- a/%s\n+++ b/%s\n", name, name)
+	if len(a)*len(b) > diffMaxCells {
+		added, removed := lineDiff(before, after)
+		return head + fmt.Sprintf("@@ too large to diff: %d -> %d lines @@\n", len(a), len(b)), added, removed
+	}
+
+	// lcs[i][j]: length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type op struct {
+		kind   byte // ' ', '-', '+'
+		text   string
+		ai, bi int // lines of a and b before this one
+	}
+	var ops []op
+	added, removed := 0, 0
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+			removed++
+		default:
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+			added++
+		}
+	}
+	if added == 0 && removed == 0 {
+		return "", 0, 0
+	}
+
+	const contextLines = 3
+	var out strings.Builder
+	out.WriteString(head)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		start, end := max(k-contextLines, 0), k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*contextLines {
+				end = min(end+contextLines, len(ops))
+				break
+			}
+			end = run
+		}
+		aEnd, bEnd := len(a), len(b)
+		if end < len(ops) {
+			aEnd, bEnd = ops[end].ai, ops[end].bi
+		}
+		aStart, bStart := ops[start].ai, ops[start].bi
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aEnd-aStart), hunkRange(bStart, bEnd-bStart))
+		for _, o := range ops[start:end] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+	return out.String(), added, removed
+}
+
+// hunkRange is the start,count of a hunk header (1-based; an empty range names
+// the line before it).
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func diffLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "ngm"
+	}
+	return h
+}
+
+// NotifySnapshot sends a report with changes to snapshots.webhooks and
+// snapshots.notify_emails.
+func (a *App) NotifySnapshot(ctx context.Context, mailer *notify.Mailer, rep SnapshotReport) {
+	if !rep.Changed() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for _, url := range a.cfg.Snapshots.Webhooks {
+		if err := notify.PostJSON(ctx, url, rep, nil); err != nil {
+			log.Printf("snapshots: webhook: %v", err)
+		}
+	}
+	if mailer == nil || !mailer.Enabled() {
+		return
+	}
+	subject, body := snapshotMail(rep)
+	for _, rcpt := range a.cfg.Snapshots.NotifyEmails {
+		if err := mailer.Send(rcpt, subject, body); err != nil {
+			log.Printf("snapshots: mail %s: %v", rcpt, err)
+		}
+	}
+}
+
+func snapshotMail(rep SnapshotReport) (string, string) {
+	var b strings.Builder
+	if rep.Since != nil {
+		fmt.Fprintf(&b, "The nginx configuration of %s changed since %s (%s -> %s):\n\n",
+			rep.Host, rep.Since.Local().Format(time.RFC1123), rep.Previous, rep.Snapshot)
+	} else {
+		fmt.Fprintf(&b, "The nginx configuration of %s changed (%s):\n\n", rep.Host, rep.Snapshot)
+	}
+	for _, c := range rep.Changes {
+		fmt.Fprintf(&b, "  %-8s  %s  (+%d -%d)\n", c.Change, c.Path, c.Added, c.Removed)
+	}
+	if rep.Diff != "" {
+		b.WriteString("\n" + rep.Diff)
+	}
+	return fmt.Sprintf("[ngm] %s: nginx configuration changed (%d files)", rep.Host, len(rep.Changes)), b.String()
+}
+
+// RunSnapshots takes a snapshot whenever snapshots.schedule matches, until ctx is
+// done, and reports the changes. The first snapshot has nothing to compare with
+// and is not reported.
+func (a *App) RunSnapshots(ctx context.Context, mailer *notify.Mailer) {
+	spec, err := parseCron(a.cfg.Snapshots.Schedule)
+	if err != nil {
+		a.event("error", "snapshots", "snapshots.schedule: %v", err)
+		return
+	}
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if !spec.match(next) {
+			continue
+		}
+		rep, err := a.SnapshotTake()
+		if err != nil {
+			a.event("error", "snapshots", "configuration snapshot failed: %v", err)
+			continue
+		}
+		if rep.Previous != "" {
+			a.NotifySnapshot(ctx, mailer, rep)
+		}
+	}
+}
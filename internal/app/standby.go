@@ -0,0 +1,267 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"mynginx/internal/cluster"
+	"mynginx/internal/config"
+	"mynginx/internal/util"
+)
+
+// StandbyState is what a standby knows about its last pull (standby.dir/standby.json).
+type StandbyState struct {
+	Primary   string     `json:"primary"`
+	PulledAt  time.Time  `json:"pulled_at,omitempty"` // last successful pull
+	Snapshot  time.Time  `json:"snapshot,omitempty"`  // when the primary took it
+	DBBytes   int64      `json:"db_bytes"`
+	Files     int        `json:"files"`
+	LastError string     `json:"last_error,omitempty"`
+	Promoted  *time.Time `json:"promoted,omitempty"` // set by promote; pulls stop
+}
+
+// storeSnapshotter is implemented by stores that can copy themselves while in use.
+type storeSnapshotter interface {
+	Snapshot(path string) error
+}
+
+// snapshot file layout: the database and the generated configs under conf/
+const (
+	standbyDB    = "ngm.db"
+	standbyConf  = "conf"
+	standbyState = "standby.json"
+)
+
+// StandbySnapshot is the primary's side of a pull: a consistent database copy plus
+// the generated site and global configs.
+func (a *App) StandbySnapshot() (cluster.Snapshot, error) {
+	sn, ok := a.st.(storeSnapshotter)
+	if !ok {
+		return cluster.Snapshot{}, fmt.Errorf("store cannot take snapshots")
+	}
+	tmp, err := os.MkdirTemp("", "ngm-snapshot-")
+	if err != nil {
+		return cluster.Snapshot{}, err
+	}
+	defer os.RemoveAll(tmp)
+	dbPath := filepath.Join(tmp, standbyDB)
+	if err := sn.Snapshot(dbPath); err != nil {
+		return cluster.Snapshot{}, err
+	}
+	out := cluster.Snapshot{CreatedAt: time.Now()}
+	if out.DB, err = os.ReadFile(dbPath); err != nil {
+		return out, err
+	}
+	for _, d := range []struct{ prefix, dir string }{
+		{"sites", a.paths.NginxSitesDir},
+		{"global", a.paths.NginxGlobalDir},
+	} {
+		if d.dir == "" {
+			continue
+		}
+		err := filepath.WalkDir(d.dir, func(p string, e fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && p == d.dir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !e.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(d.dir, p)
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			out.Files = append(out.Files, cluster.SnapshotFile{Path: d.prefix + "/" + filepath.ToSlash(rel), Data: data})
+			return nil
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// StandbyPull fetches the primary's snapshot once and replaces the local copy.
+func (a *App) StandbyPull(ctx context.Context) (StandbyState, error) {
+	sb := a.cfg.Cluster.Standby
+	if sb.Primary == "" {
+		return StandbyState{}, invalidf("not a standby (cluster.standby.primary is empty)")
+	}
+	st, _ := ReadStandbyState(a.cfg)
+	if st.Promoted != nil {
+		return st, invalidf("this node was promoted at %s; remove cluster.standby.primary", st.Promoted.Format(time.RFC3339))
+	}
+	st.Primary = sb.Primary
+
+	err := a.standbyPull(ctx, &st)
+	if err != nil {
+		st.LastError = err.Error()
+	} else {
+		st.LastError = ""
+	}
+	if werr := writeStandbyState(sb.Dir, st); werr != nil && err == nil {
+		err = werr
+	}
+	return st, err
+}
+
+func (a *App) standbyPull(ctx context.Context, st *StandbyState) error {
+	sb := a.cfg.Cluster.Standby
+	snap, err := a.cluster.PullSnapshot(ctx, sb.Primary)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(snap.DB, []byte("SQLite format 3\x00")) {
+		return fmt.Errorf("snapshot from %s: not an sqlite database", sb.Primary)
+	}
+	if err := util.MkdirAll(sb.Dir, 0700); err != nil {
+		return err
+	}
+
+	// configs go to conf.new, which then replaces conf as a whole
+	next := filepath.Join(sb.Dir, standbyConf+".new")
+	_ = os.RemoveAll(next)
+	for _, f := range snap.Files {
+		rel := filepath.FromSlash(f.Path)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("snapshot from %s: bad path %q", sb.Primary, f.Path)
+		}
+		p := filepath.Join(next, rel)
+		if err := util.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := util.WriteFileAtomic(p, f.Data, 0644); err != nil {
+			return err
+		}
+	}
+	if err := util.WriteFileAtomic(filepath.Join(sb.Dir, standbyDB), snap.DB, 0600); err != nil {
+		return err
+	}
+	cur := filepath.Join(sb.Dir, standbyConf)
+	_ = os.RemoveAll(cur)
+	if err := os.Rename(next, cur); err != nil {
+		return err
+	}
+
+	st.PulledAt = time.Now()
+	st.Snapshot = snap.CreatedAt
+	st.DBBytes = int64(len(snap.DB))
+	st.Files = len(snap.Files)
+	return nil
+}
+
+// RunStandby pulls the primary's snapshot every cluster.standby.interval until ctx
+// is done; a failing pull is recorded as an event once, until a pull succeeds again.
+func (a *App) RunStandby(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.Cluster.Standby.Interval)
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	failing := false
+	for {
+		st, err := a.StandbyPull(ctx)
+		switch {
+		case st.Promoted != nil:
+			log.Printf("standby: promoted, no longer pulling from %s", a.cfg.Cluster.Standby.Primary)
+			return
+		case err != nil && ctx.Err() == nil:
+			if !failing {
+				a.event("error", "standby", "pull from %s failed: %v", st.Primary, err)
+			}
+			failing = true
+		case err == nil && failing:
+			a.event("info", "standby", "pull from %s works again", st.Primary)
+			failing = false
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// ReadStandbyState reads the state of the last pull (zero state when never pulled).
+func ReadStandbyState(cfg *config.Config) (StandbyState, error) {
+	var st StandbyState
+	data, err := os.ReadFile(filepath.Join(cfg.Cluster.Standby.Dir, standbyState))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return st, nil
+		}
+		return st, err
+	}
+	return st, json.Unmarshal(data, &st)
+}
+
+func writeStandbyState(dir string, st StandbyState) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(dir, standbyState), data, 0600)
+}
+
+// PromoteStandby makes the last pulled snapshot this node's database: the current
+// database is kept as <sqlite_path>.pre-promote and pulls stop. The store must be
+// closed (`ngm serve` stopped); the caller re-opens it and applies every site,
+// which renders the configs from the promoted database.
+func PromoteStandby(cfg *config.Config) (StandbyState, error) {
+	st, err := ReadStandbyState(cfg)
+	if err != nil {
+		return st, err
+	}
+	if st.Promoted != nil {
+		return st, fmt.Errorf("already promoted at %s", st.Promoted.Format(time.RFC3339))
+	}
+	if st.PulledAt.IsZero() {
+		return st, fmt.Errorf("no snapshot pulled yet in %s", cfg.Cluster.Standby.Dir)
+	}
+	snap, err := os.ReadFile(filepath.Join(cfg.Cluster.Standby.Dir, standbyDB))
+	if err != nil {
+		return st, err
+	}
+	dbPath := cfg.Storage.SQLitePath
+	if old, err := os.ReadFile(dbPath); err == nil {
+		if err := util.WriteFileAtomic(dbPath+".pre-promote", old, 0600); err != nil {
+			return st, err
+		}
+	} else if !os.IsNotExist(err) {
+		return st, err
+	}
+	// a WAL left by the old database would be replayed onto the promoted one
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return st, err
+		}
+	}
+	if err := util.WriteFileAtomic(dbPath, snap, 0600); err != nil {
+		return st, err
+	}
+	now := time.Now()
+	st.Promoted = &now
+	return st, writeStandbyState(cfg.Cluster.Standby.Dir, st)
+}
+
+// StandbyConfDir is where the pulled configs are kept (for comparison after promote).
+func StandbyConfDir(cfg *config.Config) string {
+	return filepath.Join(cfg.Cluster.Standby.Dir, standbyConf)
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// StatusDay is one day of a site's check history.
+type StatusDay struct {
+	Day   time.Time
+	OK    int
+	Total int
+}
+
+// Uptime is the share of successful checks in percent (100 when nothing was checked).
+func (d StatusDay) Uptime() float64 {
+	if d.Total == 0 {
+		return 100
+	}
+	return float64(d.OK) * 100 / float64(d.Total)
+}
+
+// Level classifies the day for display: "none" (no data), "up", "degraded" or "down".
+func (d StatusDay) Level() string {
+	switch {
+	case d.Total == 0:
+		return "none"
+	case d.OK == d.Total:
+		return "up"
+	case d.Uptime() >= 95:
+		return "degraded"
+	default:
+		return "down"
+	}
+}
+
+// SiteStatus is a site's current state and recent history for the status page.
+type SiteStatus struct {
+	Domain      string
+	State       string // "up" | "down" | "unknown"
+	LastChecked *time.Time
+	LastError   string
+	Days        []StatusDay
+	Uptime      float64 // over all Days with data
+}
+
+// StatusReport is everything the public status page shows.
+type StatusReport struct {
+	Title       string
+	Sites       []SiteStatus
+	AllUp       bool
+	Down        int
+	GeneratedAt time.Time
+}
+
+// StatusReport builds the status page from the stored health checks.
+// Sites are limited to status_page.sites when that list is set.
+func (a *App) StatusReport(ctx context.Context) (StatusReport, error) {
+	_ = ctx
+	rep := StatusReport{Title: a.cfg.Status.Title, AllUp: true, GeneratedAt: time.Now()}
+
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return rep, err
+	}
+	latest, err := a.st.LatestHealthChecks()
+	if err != nil {
+		return rep, err
+	}
+
+	days := a.cfg.Status.HistoryDays
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+	daily, err := a.st.HealthDaily(since)
+	if err != nil {
+		return rep, err
+	}
+	bySite := map[int64]map[string][2]int{}
+	for _, d := range daily {
+		if bySite[d.SiteID] == nil {
+			bySite[d.SiteID] = map[string][2]int{}
+		}
+		bySite[d.SiteID][d.Day] = [2]int{d.OK, d.Total}
+	}
+
+	only := map[string]bool{}
+	for _, d := range a.cfg.Status.Sites {
+		only[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+
+	for _, s := range sites {
+		if !s.Enabled || (len(only) > 0 && !only[s.Domain]) {
+			continue
+		}
+		ss := SiteStatus{Domain: s.Domain, State: "unknown"}
+		if c, ok := latest[s.ID]; ok {
+			t := c.CheckedAt
+			ss.LastChecked = &t
+			if c.OK {
+				ss.State = "up"
+			} else {
+				ss.State = "down"
+				ss.LastError = c.Error
+			}
+		}
+		var okSum, totalSum int
+		for i := 0; i < days; i++ {
+			day := since.AddDate(0, 0, i)
+			v := bySite[s.ID][day.Format("2006-01-02")]
+			ss.Days = append(ss.Days, StatusDay{Day: day, OK: v[0], Total: v[1]})
+			okSum += v[0]
+			totalSum += v[1]
+		}
+		ss.Uptime = StatusDay{OK: okSum, Total: totalSum}.Uptime()
+		if ss.State == "down" {
+			rep.AllUp = false
+			rep.Down++
+		}
+		rep.Sites = append(rep.Sites, ss)
+	}
+	return rep, nil
+}
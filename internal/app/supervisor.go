@@ -0,0 +1,186 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mynginx/internal/nginx"
+)
+
+// NginxState is the last observed state of the nginx master.
+type NginxState struct {
+	Running   bool
+	PID       int // reload_mode "signal" only
+	CheckedAt time.Time
+	DownSince time.Time // zero while running
+	LastError string    // last failed start/restart
+	NextRetry time.Time // pending auto-restart attempt (zero = none)
+}
+
+// Down reports a confirmed outage (false until the first check).
+func (st NginxState) Down() bool {
+	return !st.CheckedAt.IsZero() && !st.Running
+}
+
+type supervisor struct {
+	mu    sync.Mutex
+	state NginxState
+	fails int // consecutive failed auto-restarts (drives the backoff)
+}
+
+// nginxAlive asks systemd or the master pid file whether nginx is up.
+func (a *App) nginxAlive(ctx context.Context) (bool, int, error) {
+	if a.cfg.Nginx.Apply.ReloadMode == "systemd" {
+		ctx, cancel := context.WithTimeout(ctx, a.timeouts.Systemctl)
+		defer cancel()
+		res, err := a.run.Run(ctx, "systemctl", "is-active", "--quiet", a.cfg.Supervisor.Service)
+		if err != nil && res.ExitCode <= 0 {
+			return false, 0, err
+		}
+		return err == nil, 0, nil
+	}
+	pid, ok := nginx.MasterPID(a.paths.NginxPIDFile)
+	return ok, pid, nil
+}
+
+// NginxCheck probes nginx now, records up/down transitions in the event log and
+// returns the new state.
+func (a *App) NginxCheck(ctx context.Context) (NginxState, error) {
+	running, pid, err := a.nginxAlive(ctx)
+	if err != nil {
+		return a.NginxState(), err
+	}
+	now := time.Now()
+
+	a.sup.mu.Lock()
+	defer a.sup.mu.Unlock()
+	prev := a.sup.state
+	st := &a.sup.state
+	st.Running, st.PID, st.CheckedAt = running, pid, now
+
+	switch {
+	case !running && (prev.Running || prev.CheckedAt.IsZero()):
+		st.DownSince = now
+		a.event("error", "nginx", "nginx master is not running")
+	case running && prev.Down():
+		a.event("info", "nginx", "nginx is running again (down for %s)", now.Sub(prev.DownSince).Round(time.Second))
+		st.DownSince, st.LastError, st.NextRetry = time.Time{}, "", time.Time{}
+		a.sup.fails = 0
+	}
+	return *st, nil
+}
+
+// NginxProbe checks nginx now without touching the supervisor state or the event log.
+func (a *App) NginxProbe(ctx context.Context) (NginxState, error) {
+	running, pid, err := a.nginxAlive(ctx)
+	return NginxState{Running: running, PID: pid, CheckedAt: time.Now()}, err
+}
+
+// NginxState returns the last observed state without probing.
+func (a *App) NginxState() NginxState {
+	a.sup.mu.Lock()
+	defer a.sup.mu.Unlock()
+	return a.sup.state
+}
+
+// NginxStart starts nginx (systemctl start, or the nginx binary) unless it is already running.
+func (a *App) NginxStart(ctx context.Context) error {
+	return a.nginxControl(ctx, "start", "panel")
+}
+
+// NginxRestart stops and starts nginx (a full restart, not a reload).
+func (a *App) NginxRestart(ctx context.Context) error {
+	return a.nginxControl(ctx, "restart", "panel")
+}
+
+func (a *App) nginxControl(ctx context.Context, action, by string) error {
+	var err error
+	if a.cfg.Nginx.Apply.ReloadMode == "systemd" {
+		cctx, cancel := context.WithTimeout(ctx, a.timeouts.Systemctl)
+		res, rerr := a.run.Run(cctx, "systemctl", action, a.cfg.Supervisor.Service)
+		cancel()
+		if rerr != nil {
+			err = fmt.Errorf("systemctl %s %s: %w (%s)", action, a.cfg.Supervisor.Service, rerr, res.Output())
+		}
+	} else {
+		running, _, _ := a.nginxAlive(ctx)
+		if action == "start" && running {
+			_, _ = a.NginxCheck(ctx)
+			return nil
+		}
+		if action == "restart" && running {
+			if err = a.ng.Stop(); err == nil {
+				a.waitNginxExit(ctx)
+			}
+		}
+		if err == nil {
+			err = a.ng.Start()
+		}
+	}
+
+	if err != nil {
+		a.sup.mu.Lock()
+		a.sup.state.LastError = err.Error()
+		a.sup.mu.Unlock()
+		a.event("error", "nginx", "nginx %s (%s) failed: %v", action, by, err)
+		return err
+	}
+	a.event("info", "nginx", "nginx %sed (%s)", action, by)
+	_, _ = a.NginxCheck(ctx)
+	return nil
+}
+
+// waitNginxExit gives a stopping master a few seconds to remove its pid file.
+func (a *App) waitNginxExit(ctx context.Context) {
+	deadline := time.Now().Add(a.timeouts.NginxReload)
+	for time.Now().Before(deadline) {
+		if _, ok := nginx.MasterPID(a.paths.NginxPIDFile); !ok {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// RunSupervisor checks nginx every supervisor.interval until ctx is done and, with
+// auto_restart, starts it again with exponential backoff between failed attempts.
+func (a *App) RunSupervisor(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.Supervisor.Interval)
+	if err != nil || interval <= 0 {
+		interval = 15 * time.Second
+	}
+	backoffMax, err := time.ParseDuration(a.cfg.Supervisor.BackoffMax)
+	if err != nil || backoffMax < interval {
+		backoffMax = interval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		st, err := a.NginxCheck(ctx)
+		if err != nil {
+			log.Printf("supervisor: %v", err)
+		} else if st.Down() && a.cfg.Supervisor.AutoRestart && !time.Now().Before(st.NextRetry) {
+			if err := a.nginxControl(ctx, "start", "auto-restart"); err != nil {
+				a.sup.mu.Lock()
+				a.sup.fails++
+				wait := interval << min(a.sup.fails, 16)
+				if wait > backoffMax || wait <= 0 {
+					wait = backoffMax
+				}
+				a.sup.state.NextRetry = time.Now().Add(wait)
+				a.sup.mu.Unlock()
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
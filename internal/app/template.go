@@ -3,12 +3,14 @@ package app
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"mynginx/internal/certs"
 	"mynginx/internal/fpm"
 	"mynginx/internal/nginx"
+	"mynginx/internal/stats"
 	"mynginx/internal/store"
 )
 
@@ -21,65 +23,39 @@ func (a *App) buildTemplateData(s store.Site, domain string, proxyLister proxyTa
 
 	phpPass := ""
 	if s.Mode == "" || s.Mode == "php" {
-		ver, ok := cfg.PHPFPM.Versions[s.PHPVersion]
-		if !ok {
-			return nginx.SiteTemplateData{}, fmt.Errorf("unknown php version %q (not in config.phpfpm.versions)", s.PHPVersion)
-		}
-
-		runUser, ok := inferUserFromWebroot(cfg.Hosting.HomeRoot, s.Webroot)
-		if !ok {
-			return nginx.SiteTemplateData{}, fmt.Errorf("cannot infer site user from webroot %q (expected under %q)", s.Webroot, cfg.Hosting.HomeRoot)
-		}
-		runGroup := runUser
-		webGroup := cfg.Hosting.WebGroup
-		if webGroup == "" {
-			webGroup = "www-data"
-		}
-
-		phpSock := fpm.SocketPath(ver.SockDir, domain, s.PHPVersion)
-
-		poolTD := fpm.PoolData{
-			PoolName:                "ngm_" + strings.ReplaceAll(domain, ".", "_"),
-			RunUser:                 runUser,
-			RunGroup:                runGroup,
-			Socket:                  phpSock,
-			ListenOwner:             runUser,
-			ListenGroup:             webGroup,
-			MaxChildren:             10,
-			IdleTimeout:             "10s",
-			MaxRequests:             500,
-			RequestTerminateTimeout: "60s",
-			SlowlogTimeout:          "5s",
-			SlowlogPath:             filepath.Join(logsDir, "php-fpm.slow.log"),
-			ErrorLog:                filepath.Join(logsDir, "php-fpm.error.log"),
-			PHPAdminValues:          map[string]string{},
-			PHPValues:               map[string]string{},
-		}
-
-		if _, _, err := fpm.EnsurePool(ver.PoolsDir, ver.Service, ver.SockDir, domain, s.PHPVersion, poolTD); err != nil {
-			return nginx.SiteTemplateData{}, fmt.Errorf("ensure fpm pool: %w", err)
+		// the pool itself is written by the apply (writeSitePool), which knows
+		// whether php-fpm needs a reload
+		if _, _, err := a.sitePoolData(s, domain); err != nil {
+			return nginx.SiteTemplateData{}, err
 		}
-
-		phpPass = "unix:" + phpSock
+		phpPass = "unix:" + fpm.SocketPath(cfg.PHPFPM.Versions[s.PHPVersion].SockDir, domain, s.PHPVersion)
 	}
 
-	leCert := filepath.Join(paths.LetsEncryptLive, domain, "fullchain.pem")
-	leKey := filepath.Join(paths.LetsEncryptLive, domain, "privkey.pem")
+	leCert, leKey := a.siteCertPaths(s)
+	if certSource(s) == CertSourcePath && (!fileExists(leCert) || !fileExists(leKey)) {
+		return nginx.SiteTemplateData{}, fmt.Errorf("certificate files missing: %s, %s (cert source path)", leCert, leKey)
+	}
 
 	tlsCert := leCert
 	tlsKey := leKey
+	var tlsCertAlt, tlsKeyAlt string
 
 	if !fileExists(leCert) || !fileExists(leKey) {
-		selfSignedRoot := filepath.Join(paths.NginxRoot, "conf", "selfsigned")
-		fbCert := filepath.Join(selfSignedRoot, domain, "fullchain.pem")
-		fbKey := filepath.Join(selfSignedRoot, domain, "privkey.pem")
-		if err := ensureSelfSignedCert(domain, fbCert, fbKey); err != nil {
+		fbCert, fbKey, err := a.selfSignedCert(domain)
+		if err != nil {
 			return nginx.SiteTemplateData{}, err
 		}
 		tlsCert = fbCert
 		tlsKey = fbKey
 	}
 
+	// dual certs: only once the alternate lineage exists on this node
+	if s.DualCert && certSource(s) == CertSourceLetsEncrypt && tlsCert == leCert {
+		if alt, err := a.certMgr().GetAltCertInfo(domain); err == nil && alt != nil {
+			tlsCertAlt, tlsKeyAlt = alt.CertPath, alt.KeyPath
+		}
+	}
+
 	td := nginx.SiteTemplateData{
 		Domain:          domain,
 		Mode:            s.Mode,
@@ -88,10 +64,46 @@ func (a *App) buildTemplateData(s store.Site, domain string, proxyLister proxyTa
 		EnableHTTP3:     s.EnableHTTP3,
 		TLSCert:         tlsCert,
 		TLSKey:          tlsKey,
+		TLSCertAlt:      tlsCertAlt,
+		TLSKeyAlt:       tlsKeyAlt,
 		FrontController: true,
 		AccessLog:       filepath.Join(logsDir, "access.log"),
 		ErrorLog:        filepath.Join(logsDir, "error.log"),
 	}
+	if s.AccessSyslog != "" {
+		td.AccessSyslog = s.AccessSyslog
+		td.AccessSyslogFacility = cfg.Security.Syslog.AccessFacility
+		td.AccessSyslogTag = syslogTag(domain)
+	}
+	if _, sample, err := parseAccessSample(s.AccessLogSample); err == nil {
+		td.AccessSample = sample
+	}
+	headers, err := a.st.ListSiteHeaders(s.ID)
+	if err != nil {
+		return nginx.SiteTemplateData{}, fmt.Errorf("load headers: %w", err)
+	}
+	td.Headers, td.ServerTokensOff = headerTemplateData(headers)
+	vars, err := a.st.ListSiteVars(s.ID)
+	if err != nil {
+		return nginx.SiteTemplateData{}, fmt.Errorf("load template vars: %w", err)
+	}
+	td.Vars = map[string]string{}
+	for _, v := range vars {
+		td.Vars[v.Name] = v.Value
+	}
+	if s.Hardened && (s.Mode == "" || s.Mode == "php") {
+		td.Hardened = true
+		td.ServerTokensOff = true
+	}
+	if s.Mode != "static" && s.Mode != "redirect" {
+		preloads, err := a.st.ListSitePreloads(s.ID)
+		if err != nil {
+			return nginx.SiteTemplateData{}, fmt.Errorf("load preloads: %w", err)
+		}
+		for _, p := range preloads {
+			td.Preloads = append(td.Preloads, nginx.PreloadCfg{URL: p.URL, As: p.As, Crossorigin: p.Crossorigin})
+		}
+	}
 
 	if s.Mode == "" || s.Mode == "php" {
 		td.PHP = nginx.FastCGICfg{
@@ -104,7 +116,29 @@ func (a *App) buildTemplateData(s store.Site, domain string, proxyLister proxyTa
 		}
 	}
 
+	if td.Placeholder, err = a.placeholderFor(s, domain); err != nil {
+		return nginx.SiteTemplateData{}, fmt.Errorf("placeholder: %w", err)
+	}
+	if td.Retired, err = a.retiredFor(s, domain); err != nil {
+		return nginx.SiteTemplateData{}, fmt.Errorf("retired page: %w", err)
+	}
+
+	if s.PreviewHost != "" {
+		if td.Preview, err = a.previewFor(s.PreviewHost); err != nil {
+			return nginx.SiteTemplateData{}, fmt.Errorf("preview: %w", err)
+		}
+	}
+
+	if s.Mode == "redirect" {
+		if s.RedirectURL == "" {
+			return nginx.SiteTemplateData{}, fmt.Errorf("redirect mode requires a redirect target for %s", domain)
+		}
+		td.Redirect = nginx.RedirectCfg{Code: s.RedirectCode, Target: s.RedirectURL, KeepPath: s.RedirectKeepPath}
+	}
+
 	if s.Mode == "proxy" {
+		td.UpstreamLog = siteUpstreamLog(s)
+		td.UpstreamLogFormat = stats.UpstreamLogFormat
 		td.Proxy = nginx.ProxyCfg{
 			LB:          "least_conn",
 			PassHost:    true,
@@ -122,6 +156,7 @@ func (a *App) buildTemplateData(s store.Site, domain string, proxyLister proxyTa
 				Zone:    "proxy_static",
 				TTL200:  "30d",
 			},
+			Keepalive: a.siteKeepalive(s),
 		}
 
 		if proxyLister == nil {
@@ -134,48 +169,41 @@ func (a *App) buildTemplateData(s store.Site, domain string, proxyLister proxyTa
 		if len(targets) == 0 {
 			return nginx.SiteTemplateData{}, fmt.Errorf("proxy mode requires at least 1 proxy target for %s", domain)
 		}
+		if s.ActiveGroup != "" {
+			targets = activeGroupTargets(targets, s.ActiveGroup)
+			if len(targets) == 0 {
+				return nginx.SiteTemplateData{}, fmt.Errorf("active target group %q of %s has no enabled targets", s.ActiveGroup, domain)
+			}
+		}
 		td.Proxy.Targets = targets
+		if s.MirrorTarget != "" && s.MirrorPercent > 0 {
+			td.Proxy.Mirror = nginx.MirrorCfg{Target: s.MirrorTarget, Percent: s.MirrorPercent}
+		}
+		if s.BackendHealth != "" {
+			b := a.cfg.Health.Backend
+			td.Proxy.Health = nginx.HealthCfg{Location: b.Location, Path: s.BackendHealth, Allow: b.Allow}
+		}
 	}
 
 	return td, nil
 }
 
+// selfSignedCert makes sure name has a self-signed certificate to serve until a real
+// one exists, and returns its paths.
+func (a *App) selfSignedCert(name string) (cert, key string, err error) {
+	dir := filepath.Join(a.paths.NginxRoot, "conf", "selfsigned", name)
+	cert, key = filepath.Join(dir, "fullchain.pem"), filepath.Join(dir, "privkey.pem")
+	if err := certs.EnsureSelfSigned(name, cert, key, time.Duration(a.cfg.Certs.SelfSignedDays)*24*time.Hour); err != nil {
+		return "", "", err
+	}
+	return cert, key, nil
+}
+
 func fileExists(p string) bool {
 	_, err := os.Stat(p)
 	return err == nil
 }
 
-func ensureSelfSignedCert(domain, certPath, keyPath string) error {
-	if fileExists(certPath) && fileExists(keyPath) {
-		return nil
-	}
-	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
-		return fmt.Errorf("mkdir cert dir: %w", err)
-	}
-	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
-		return fmt.Errorf("mkdir key dir: %w", err)
-	}
-
-	cmd := exec.Command(
-		"openssl", "req",
-		"-x509",
-		"-nodes",
-		"-newkey", "rsa:2048",
-		"-days", "7",
-		"-subj", "/CN="+domain,
-		"-keyout", keyPath,
-		"-out", certPath,
-	)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("generate self-signed cert failed: %w (output: %s)", err, strings.TrimSpace(string(out)))
-	}
-
-	_ = os.Chmod(certPath, 0644)
-	_ = os.Chmod(keyPath, 0600)
-	return nil
-}
-
 func inferUserFromWebroot(homeRoot, webroot string) (string, bool) {
 	homeRoot = strings.TrimRight(homeRoot, "/")
 	if homeRoot == "" {
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/nginx"
+	"mynginx/internal/stats"
+	"mynginx/internal/util"
+)
+
+// DefaultGoldenDir holds the golden renders of `ngm template lint`, next to the
+// templates (relative to the working directory, like the templates themselves).
+var DefaultGoldenDir = filepath.Join("internal", "nginx", "templates", "golden")
+
+// lintRoot is the fixture root of the golden renders; the nginx -t pass renders
+// the same fixtures under a temp dir instead, so the files it names exist.
+const lintRoot = "/srv/ngm-lint"
+
+const lintDomain = "lint.example.test"
+
+type TemplateLintOptions struct {
+	GoldenDir string // "" = DefaultGoldenDir
+	Update    bool   // rewrite the golden files instead of comparing with them
+	NginxTest bool   // also run nginx -t on each render in a sandbox conf
+}
+
+// TemplateLintCase is the outcome of one fixture permutation.
+type TemplateLintCase struct {
+	Name      string
+	Golden    string // "ok", "changed", "missing" or "updated"
+	Diff      string // first differing line when changed
+	NginxTest string // nginx -t output when it failed ("" = passed or not run)
+}
+
+func (c TemplateLintCase) Failed() bool {
+	return c.Golden == "changed" || c.Golden == "missing" || c.NginxTest != ""
+}
+
+// templateLintCase is one site mode permutation of the fixture site.
+type templateLintCase struct {
+	name  string
+	mode  string
+	http3 bool
+	cache bool
+}
+
+// templateLintCases are php/proxy/static with http3 on/off and cache on/off
+// (static has no cache).
+func templateLintCases() []templateLintCase {
+	var out []templateLintCase
+	for _, mode := range []string{"php", "proxy", "static"} {
+		for _, h3 := range []bool{false, true} {
+			for _, cache := range []bool{false, true} {
+				if cache && mode == "static" {
+					continue
+				}
+				name := mode
+				if h3 {
+					name += "-h3"
+				}
+				if cache {
+					name += "-cache"
+				}
+				out = append(out, templateLintCase{name: name, mode: mode, http3: h3, cache: cache})
+			}
+		}
+	}
+	return out
+}
+
+// site is the fixture of c with every path under root, with the defaults
+// buildTemplateData uses.
+func (c templateLintCase) site(root string) nginx.SiteTemplateData {
+	td := nginx.SiteTemplateData{
+		Domain:          lintDomain,
+		Mode:            c.mode,
+		Webroot:         filepath.Join(root, "public"),
+		ACMEWebroot:     filepath.Join(root, "acme"),
+		EnableHTTP3:     c.http3,
+		TLSCert:         filepath.Join(root, "certs", "fullchain.pem"),
+		TLSKey:          filepath.Join(root, "certs", "privkey.pem"),
+		FrontController: true,
+		AccessLog:       filepath.Join(root, "logs", "access.log"),
+		ErrorLog:        filepath.Join(root, "logs", "error.log"),
+	}
+	switch c.mode {
+	case "php":
+		td.PHP = nginx.FastCGICfg{
+			Pass:  "unix:" + filepath.Join(root, "php-fpm.sock"),
+			Cache: nginx.CacheCfg{Enabled: c.cache, Zone: "php_cache", TTL200: "15s"},
+		}
+	case "proxy":
+		td.UpstreamLog = filepath.Join(root, "logs", "upstream.log")
+		td.UpstreamLogFormat = stats.UpstreamLogFormat
+		td.Proxy = nginx.ProxyCfg{
+			LB:          "least_conn",
+			PassHost:    true,
+			TimeConnect: "3s",
+			TimeRead:    "60s",
+			TimeSend:    "60s",
+			Microcache:  nginx.CacheCfg{Enabled: c.cache, Zone: "proxy_micro", TTL200: "15s"},
+			StaticCache: nginx.CacheCfg{Enabled: c.cache, Zone: "proxy_static", TTL200: "30d"},
+			Targets: []nginx.UpstreamTarget{
+				{Addr: "127.0.0.1:8080", Weight: 100, Enabled: true},
+				{Addr: "127.0.0.1:8081", Weight: 100, Enabled: true, Backup: true},
+			},
+			Keepalive: nginx.KeepaliveCfg{Connections: 32, Requests: 1000, Timeout: "60s"},
+		}
+	}
+	return td
+}
+
+// TemplateLint renders every site mode permutation against fixture data and
+// compares each render with its golden file (or rewrites them with Update). With
+// NginxTest each render is also checked by nginx -t in a throwaway conf.
+func (a *App) TemplateLint(opt TemplateLintOptions) ([]TemplateLintCase, error) {
+	dir := opt.GoldenDir
+	if dir == "" {
+		dir = DefaultGoldenDir
+	}
+	if opt.Update {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+		}
+	}
+
+	var out []TemplateLintCase
+	for _, c := range templateLintCases() {
+		got, err := a.ng.RenderSite(c.site(lintRoot))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		res := TemplateLintCase{Name: c.name}
+		path := filepath.Join(dir, c.name+".conf")
+		want, err := os.ReadFile(path)
+		switch {
+		case opt.Update:
+			res.Golden = "updated"
+			if err == nil && bytes.Equal(want, got) {
+				res.Golden = "ok"
+			} else if err := util.WriteFileAtomic(path, got, 0644); err != nil {
+				return nil, err
+			}
+		case errors.Is(err, os.ErrNotExist):
+			res.Golden = "missing"
+		case err != nil:
+			return nil, err
+		case bytes.Equal(want, got):
+			res.Golden = "ok"
+		default:
+			res.Golden = "changed"
+			res.Diff = firstLineDiff(want, got)
+		}
+		out = append(out, res)
+	}
+
+	if opt.NginxTest {
+		if err := a.lintNginxTest(out); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// lintNginxTest renders each permutation again under its own temp dir, with a
+// self-signed certificate at the fixture paths, and runs nginx -t on it.
+func (a *App) lintNginxTest(out []TemplateLintCase) error {
+	tmp, err := os.MkdirTemp("", "ngm-lint-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	for i, c := range templateLintCases() {
+		root := filepath.Join(tmp, c.name)
+		site := c.site(root)
+		if err := os.MkdirAll(filepath.Join(root, "logs"), 0755); err != nil {
+			return err
+		}
+		if err := certs.EnsureSelfSigned(site.Domain, site.TLSCert, site.TLSKey, 0); err != nil {
+			return err
+		}
+		body, err := a.ng.RenderSite(site)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		conf := filepath.Join(root, "site.conf")
+		if err := util.WriteFileAtomic(conf, body, 0644); err != nil {
+			return err
+		}
+		main, err := a.ng.WriteLintConf(root, conf)
+		if err != nil {
+			return err
+		}
+		if err := a.ng.TestConfigAt(main); err != nil {
+			out[i].NginxTest = err.Error()
+		}
+	}
+	return nil
+}
+
+// firstLineDiff names the first line where golden and rendered differ.
+func firstLineDiff(golden, rendered []byte) string {
+	g := strings.Split(string(golden), "\n")
+	r := strings.Split(string(rendered), "\n")
+	for i := 0; i < len(g) || i < len(r); i++ {
+		var gl, rl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(r) {
+			rl = r[i]
+		}
+		if gl != rl {
+			return fmt.Sprintf("line %d: golden %q, rendered %q", i+1, gl, rl)
+		}
+	}
+	return ""
+}
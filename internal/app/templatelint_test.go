@@ -0,0 +1,41 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mynginx/internal/nginx"
+)
+
+// TestTemplateGolden renders every site mode permutation and compares it with the
+// golden files (`ngm template lint --update` rewrites them after a template change).
+func TestTemplateGolden(t *testing.T) {
+	t.Chdir(filepath.Join("..", "..")) // templates and golden files are repo-relative
+	a := &App{ng: nginx.NewManager("", "", "", "", "", "")}
+	cases, err := a.TemplateLint(TemplateLintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		if c.Failed() {
+			t.Errorf("%s: golden %s %s", c.Name, c.Golden, c.Diff)
+		}
+	}
+}
+
+// TestTemplateDeniesGit checks that no site exposes the .git directory of a deploy
+// checkout in its webroot.
+func TestTemplateDeniesGit(t *testing.T) {
+	t.Chdir(filepath.Join("..", ".."))
+	for _, c := range templateLintCases() {
+		conf, err := os.ReadFile(filepath.Join(DefaultGoldenDir, c.name+".conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(conf), "location ~ /\\.git {\n        deny all;") {
+			t.Errorf("%s: no deny of /.git", c.name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+	"mynginx/internal/tlsscan"
+)
+
+func (a *App) tlsScanner(connect string) *tlsscan.Scanner {
+	return &tlsscan.Scanner{Addr: connect, Timeout: 10 * time.Second}
+}
+
+// TLSScan grades one domain and stores the result. connect overrides tls_scan.connect
+// ("" = use the configured address).
+func (a *App) TLSScan(ctx context.Context, domain, connect string) (tlsscan.Report, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if connect == "" {
+		connect = a.cfg.TLSScan.Connect
+	}
+	rep := a.tlsScanner(connect).Scan(ctx, domain)
+	body, err := json.Marshal(rep)
+	if err != nil {
+		return rep, err
+	}
+	err = a.st.SaveTLSScan(store.TLSScan{Domain: domain, Grade: rep.Grade, ScannedAt: rep.ScannedAt, Report: body})
+	return rep, err
+}
+
+// TLSReport returns the stored report of a domain.
+func (a *App) TLSReport(domain string) (tlsscan.Report, error) {
+	sc, err := a.st.GetTLSScan(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return tlsscan.Report{}, err
+	}
+	var rep tlsscan.Report
+	err = json.Unmarshal(sc.Report, &rep)
+	return rep, err
+}
+
+// TLSGrades maps domain -> latest grade.
+func (a *App) TLSGrades() (map[string]store.TLSScan, error) {
+	list, err := a.st.ListTLSScans()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]store.TLSScan, len(list))
+	for _, sc := range list {
+		out[sc.Domain] = sc
+	}
+	return out, nil
+}
+
+// RunTLSScans grades every enabled site each tls_scan.interval until ctx is done.
+func (a *App) RunTLSScans(ctx context.Context) {
+	interval, err := time.ParseDuration(a.cfg.TLSScan.Interval)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		sites, err := a.st.ListSites()
+		if err != nil {
+			log.Printf("tls scan: %v", err)
+		}
+		for _, s := range sites {
+			if !s.Enabled {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := a.TLSScan(ctx, s.Domain, ""); err != nil {
+				log.Printf("tls scan %s: %v", s.Domain, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
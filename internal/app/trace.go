@@ -0,0 +1,108 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"mynginx/internal/stats"
+)
+
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// TraceLine is a log line related to a traced request.
+type TraceLine struct {
+	File string // base name in the site's logs directory
+	Line string
+}
+
+// RequestTrace is what the site logs hold about one request id: its access log
+// line(s), and the nginx / php-fpm / PHP error and slow log lines written while it
+// ran or mentioning the id (apps can log $_SERVER['HTTP_X_REQUEST_ID']).
+type RequestTrace struct {
+	Domain   string
+	ID       string
+	Requests []stats.Request
+	Related  []TraceLine
+}
+
+// traceLogs are the error and slow logs searched next to access.log.
+var traceLogs = []string{"error.log", "php-fpm.error.log", "php-fpm.slow.log"}
+
+// SiteTrace looks up a request id (the X-Request-ID response header) in the logs of
+// a site.
+func (a *App) SiteTrace(domain, id string) (RequestTrace, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	id = strings.TrimSpace(id)
+	out := RequestTrace{Domain: domain, ID: id}
+	if !requestIDRe.MatchString(id) {
+		return out, invalidf("invalid request id %q", id)
+	}
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return out, fmt.Errorf("get site: %w", err)
+	}
+	// the logs dir is the site user's: open through openSiteLog, never via a link
+	logs := filepath.Join(filepath.Dir(site.Webroot), "logs")
+	if f, _, err := openSiteLog(filepath.Join(logs, "access.log")); err == nil {
+		out.Requests, err = stats.FindRequests(f, id)
+		f.Close()
+		if err != nil {
+			return out, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return out, err
+	}
+
+	// a request's errors are logged between its start and its access log line
+	var from, to time.Time
+	for _, r := range out.Requests {
+		start := r.Time.Add(-r.Duration - time.Second)
+		if from.IsZero() || start.Before(from) {
+			from = start
+		}
+		if end := r.Time.Add(time.Second); end.After(to) {
+			to = end
+		}
+	}
+	for _, name := range traceLogs {
+		f, _, err := openSiteLog(filepath.Join(logs, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return out, err
+		}
+		lines, err := stats.RelatedLines(f, id, from, to)
+		f.Close()
+		if err != nil {
+			return out, err
+		}
+		for _, l := range lines {
+			out.Related = append(out.Related, TraceLine{File: name, Line: l})
+		}
+	}
+	return out, nil
+}
+
+// SiteSlowRequests lists the slowest recent requests of a site that took at least min.
+func (a *App) SiteSlowRequests(domain string, min time.Duration, n int) ([]stats.Request, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	site, err := a.st.GetSiteByDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	f, _, err := openSiteLog(siteAccessLog(site))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return stats.SlowRequests(f, min, n)
+}
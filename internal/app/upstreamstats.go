@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mynginx/internal/stats"
+)
+
+// ProxyTargetStats returns per-target request counts, 5xx rate and latency of a
+// proxy site over the last trafficWindow of its upstream log (empty until the
+// site has been applied with upstream logging and served traffic).
+func (a *App) ProxyTargetStats(ctx context.Context, domain string) (map[string]stats.Target, error) {
+	_ = ctx
+	site, err := a.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil {
+		return nil, fmt.Errorf("get site: %w", err)
+	}
+	if site.Mode != "proxy" {
+		return nil, invalidf("%s is not a proxy site", site.Domain)
+	}
+	out, err := stats.UpstreamStats(siteUpstreamLog(site), trafficWindow, time.Now())
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]stats.Target{}, nil
+	}
+	return out, err
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// UptimeWindow is a site's uptime over one period; HasData is false when nothing was checked.
+type UptimeWindow struct {
+	Percent    float64
+	HasData    bool
+	AvgLatency int64 // ms
+}
+
+func uptimeWindow(h store.HealthSummary, ok bool) UptimeWindow {
+	if !ok || h.Total == 0 {
+		return UptimeWindow{}
+	}
+	return UptimeWindow{
+		Percent:    float64(h.OK) * 100 / float64(h.Total),
+		HasData:    true,
+		AvgLatency: h.AvgLatency,
+	}
+}
+
+// SiteUptime is one row of the uptime page.
+type SiteUptime struct {
+	Domain string
+	Last   *store.HealthCheck
+	Open   *store.Incident
+	Day    UptimeWindow
+	Month  UptimeWindow // 30 days
+	Season UptimeWindow // 90 days
+}
+
+// UptimeList returns uptime over 24h/30d/90d for every enabled site, plus recent incidents.
+func (a *App) UptimeList(ctx context.Context) ([]SiteUptime, []store.Incident, error) {
+	_ = ctx
+	sites, err := a.st.ListSites()
+	if err != nil {
+		return nil, nil, err
+	}
+	latest, err := a.st.LatestHealthChecks()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	day, err := a.st.HealthSummaries(now.Add(-24 * time.Hour))
+	if err != nil {
+		return nil, nil, err
+	}
+	month, err := a.st.HealthSummaries(now.AddDate(0, 0, -30))
+	if err != nil {
+		return nil, nil, err
+	}
+	season, err := a.st.HealthSummaries(now.AddDate(0, 0, -90))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var out []SiteUptime
+	for _, s := range sites {
+		if !s.Enabled {
+			continue
+		}
+		u := SiteUptime{Domain: s.Domain}
+		if c, ok := latest[s.ID]; ok {
+			u.Last = &c
+		}
+		if u.Open, err = a.st.GetOpenIncident(s.ID); err != nil {
+			return nil, nil, err
+		}
+		d, ok := day[s.ID]
+		u.Day = uptimeWindow(d, ok)
+		m, ok := month[s.ID]
+		u.Month = uptimeWindow(m, ok)
+		se, ok := season[s.ID]
+		u.Season = uptimeWindow(se, ok)
+		out = append(out, u)
+	}
+
+	incidents, err := a.st.ListIncidents(now.AddDate(0, 0, -90), 100)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, incidents, nil
+}
+
+// OwnedSiteStatus is what a customer may see of one of their sites: its state,
+// certificate and uptime, none of its settings.
+type OwnedSiteStatus struct {
+	Domain   string
+	State    string     // OK|PENDING|ERROR|DISABLED
+	Cert     *time.Time // certificate expiry (nil = no certificate)
+	CertDays int
+	Last     *store.HealthCheck // latest uptime check (nil = never checked)
+	Open     *store.Incident    // ongoing outage
+	Day      UptimeWindow
+	Month    UptimeWindow // 30 days
+}
+
+// SiteStatuses returns the status of the sites lim allows, for a token limited to
+// a hosting user or to some domains (see APITokenLimit).
+func (a *App) SiteStatuses(ctx context.Context, lim APITokenLimit) ([]OwnedSiteStatus, error) {
+	items, err := a.SiteListQuery(ctx, store.SiteListOptions{Owner: lim.User})
+	if err != nil {
+		return nil, err
+	}
+	latest, err := a.st.LatestHealthChecks()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	day, err := a.st.HealthSummaries(now.Add(-24 * time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	month, err := a.st.HealthSummaries(now.AddDate(0, 0, -30))
+	if err != nil {
+		return nil, err
+	}
+
+	out := []OwnedSiteStatus{}
+	for _, it := range items {
+		if !lim.AllowsSite(it.Site.Domain, it.Owner) {
+			continue
+		}
+		st := OwnedSiteStatus{Domain: it.Site.Domain, State: it.State, Cert: it.Cert, CertDays: it.CertDays}
+		if c, ok := latest[it.Site.ID]; ok {
+			st.Last = &c
+		}
+		if st.Open, err = a.st.GetOpenIncident(it.Site.ID); err != nil {
+			return nil, err
+		}
+		d, ok := day[it.Site.ID]
+		st.Day = uptimeWindow(d, ok)
+		m, ok := month[it.Site.ID]
+		st.Month = uptimeWindow(m, ok)
+		out = append(out, st)
+	}
+	return out, nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"mynginx/internal/config"
+)
+
+// ValidatePassword checks a new password against the configured complexity policy.
+func ValidatePassword(p config.PasswordPolicy, pass string) error {
+	var errs []string
+	if len([]rune(pass)) < p.MinLength {
+		errs = append(errs, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range pass {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		errs = append(errs, "an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		errs = append(errs, "a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		errs = append(errs, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		errs = append(errs, "a symbol")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("password must contain %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ---------------- signed tokens ----------------
+
+// Token purposes (part of the signed payload, so a verify token can't be used as a reset token).
+const (
+	PurposeReset       = "reset"
+	PurposeVerifyEmail = "verify"
+)
+
+// SettingStore is the subset of store.SiteStore needed to persist the signing secret.
+type SettingStore interface {
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+}
+
+const secretSettingKey = "token_secret"
+
+// TokenSecret returns the panel's token signing secret, creating it on first use.
+func TokenSecret(st SettingStore) (string, error) {
+	v, ok, err := st.GetSetting(secretSettingKey)
+	if err != nil {
+		return "", err
+	}
+	if ok && v != "" {
+		return v, nil
+	}
+	v, err = NewSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := st.SetSetting(secretSettingKey, v); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+// NewSecret returns a random hex secret for signing tokens.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Stamp derives a short fingerprint of mutable state (password hash, email) that is embedded
+// in a token; once that state changes, the token stops verifying (single-use semantics).
+func Stamp(v string) string {
+	h := sha256.Sum256([]byte(v))
+	return hex.EncodeToString(h[:8])
+}
+
+// SignToken creates "<payload>.<mac>" where payload = purpose|userID|expiryUnix|stamp.
+func SignToken(secret, purpose string, userID int64, stamp string, ttl time.Duration) string {
+	payload := strings.Join([]string{
+		purpose,
+		strconv.FormatInt(userID, 10),
+		strconv.FormatInt(time.Now().Add(ttl).Unix(), 10),
+		stamp,
+	}, "|")
+	enc := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return enc + "." + mac(secret, enc)
+}
+
+// VerifyToken checks signature, purpose and expiry and returns the user ID and stamp.
+// Callers must compare the stamp with the current state of the user.
+func VerifyToken(secret, purpose, token string) (int64, string, error) {
+	enc, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || enc == "" || sig == "" {
+		return 0, "", fmt.Errorf("malformed token")
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, enc))) {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed token")
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 || parts[0] != purpose {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+	uid, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed token")
+	}
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("malformed token")
+	}
+	if time.Now().Unix() > exp {
+		return 0, "", fmt.Errorf("token expired")
+	}
+	return uid, parts[3], nil
+}
+
+func mac(secret, msg string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(msg))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// ---------------- panel roles ----------------
+
+// Panel user roles: an admin sees and manages everything, a user only the sites of
+// its hosting user.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Roles are the valid panel user roles.
+var Roles = []string{RoleAdmin, RoleUser}
+
+// ValidRole reports whether role is one of Roles.
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------------- API tokens ----------------
+
+// API token scopes. A token carries one or more; admin covers every scope, write
+// covers sites, certs and apply, and each of those covers read.
+const (
+	ScopeMetrics = "metrics" // GET /metrics
+	ScopeRead    = "read"    // read-only API calls
+	ScopeSites   = "sites"   // add, edit, enable/disable, delete sites and their proxy targets
+	ScopeCerts   = "certs"   // issue and renew certificates
+	ScopeApply   = "apply"   // run applies
+	ScopeWrite   = "write"   // every mutating call but the admin ones
+	ScopeAdmin   = "admin"
+)
+
+// Scopes are the valid API token scopes.
+var Scopes = []string{ScopeMetrics, ScopeRead, ScopeSites, ScopeCerts, ScopeApply, ScopeWrite, ScopeAdmin}
+
+// scopeCovers lists what a scope grants besides itself.
+var scopeCovers = map[string][]string{
+	ScopeSites: {ScopeRead},
+	ScopeCerts: {ScopeRead},
+	ScopeApply: {ScopeRead},
+	ScopeWrite: {ScopeRead, ScopeSites, ScopeCerts, ScopeApply},
+}
+
+const apiTokenPrefix = "ngm_"
+
+// MinLegacyTokenLen is the shortest static api.tokens entry that is imported: its
+// hash must not be open to a brute-force search.
+const MinLegacyTokenLen = 32
+
+// NewAPIToken returns a new API token "ngm_<id>_<secret>", the id it is looked up by
+// and the hash stored in its place (the token itself is shown once and never kept).
+func NewAPIToken() (token, id, hash string, err error) {
+	b := make([]byte, 6+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	id = hex.EncodeToString(b[:6])
+	token = apiTokenPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(b[6:])
+	return token, id, HashAPIToken(token), nil
+}
+
+// ParseAPIToken returns the lookup id of an API token; ok is false for anything not
+// made by NewAPIToken (such as a static api.tokens entry, see LegacyTokenID).
+func ParseAPIToken(token string) (id string, ok bool) {
+	rest, ok := strings.CutPrefix(token, apiTokenPrefix)
+	if !ok {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(id) != 12 || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// LegacyTokenID is the lookup id of a static api.tokens entry imported into the
+// database: derived from its hash, as the token carries no id of its own.
+func LegacyTokenID(token string) string {
+	return "legacy-" + HashAPIToken(token)[:12]
+}
+
+// HashAPIToken is the stored form of an API token: a plain, unsalted SHA-256. That
+// is enough for the 256-bit random tokens of NewAPIToken only; a static api.tokens
+// entry is as strong as the string picked for it, hence MinLegacyTokenLen.
+func HashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// ScopeAllows reports whether a token with scopes may act with scope want.
+func ScopeAllows(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want || s == ScopeAdmin {
+			return true
+		}
+		for _, c := range scopeCovers[s] {
+			if c == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"mynginx/internal/notify"
+)
+
+// AcmeDNSAccount is a registration at an acme-dns server (github.com/joohoi/acme-dns).
+// The domain delegates validation with a one-time CNAME
+// _acme-challenge.<domain> -> FullDomain; DNS-01 challenges then only need
+// Update calls, no API access to the domain's own DNS provider.
+type AcmeDNSAccount struct {
+	Server     string
+	Username   string
+	Password   string
+	Subdomain  string
+	FullDomain string
+}
+
+var acmeDNSClient = &http.Client{Timeout: 15 * time.Second}
+
+// AcmeDNSRegister creates a new account at server. allowFrom (CIDRs) limits which
+// addresses may update its TXT records; empty allows any.
+func AcmeDNSRegister(ctx context.Context, server string, allowFrom []string) (AcmeDNSAccount, error) {
+	server = strings.TrimRight(server, "/")
+	body := []byte("{}")
+	if len(allowFrom) > 0 {
+		body, _ = json.Marshal(map[string][]string{"allowfrom": allowFrom})
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server+"/register", bytes.NewReader(body))
+	if err != nil {
+		return AcmeDNSAccount{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ngm/1")
+	res, err := acmeDNSClient.Do(req)
+	if err != nil {
+		return AcmeDNSAccount{}, fmt.Errorf("acme-dns register: %w", err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 16<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return AcmeDNSAccount{}, fmt.Errorf("acme-dns register: %s: %s", res.Status, bytes.TrimSpace(data))
+	}
+	var reg struct {
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		Subdomain  string `json:"subdomain"`
+		FullDomain string `json:"fulldomain"`
+	}
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return AcmeDNSAccount{}, fmt.Errorf("acme-dns register: bad response: %w", err)
+	}
+	if reg.Username == "" || reg.Password == "" || reg.Subdomain == "" || reg.FullDomain == "" {
+		return AcmeDNSAccount{}, fmt.Errorf("acme-dns register: incomplete response")
+	}
+	return AcmeDNSAccount{
+		Server:     server,
+		Username:   reg.Username,
+		Password:   reg.Password,
+		Subdomain:  reg.Subdomain,
+		FullDomain: strings.TrimSuffix(reg.FullDomain, "."),
+	}, nil
+}
+
+// Update publishes a DNS-01 validation token (acme-dns keeps the last two, so a
+// domain and its wildcard can be validated in one order).
+func (acc AcmeDNSAccount) Update(ctx context.Context, txt string) error {
+	return notify.PostJSON(ctx, acc.Server+"/update",
+		map[string]string{"subdomain": acc.Subdomain, "txt": txt},
+		map[string]string{"X-Api-User": acc.Username, "X-Api-Key": acc.Password})
+}
+
+// ChallengeName is the record the domain's DNS must CNAME to FullDomain.
+func ChallengeName(domain string) string {
+	return "_acme-challenge." + strings.TrimPrefix(domain, "*.")
+}
+
+// CheckDelegation reports whether the challenge CNAME of domain is in place.
+func (acc AcmeDNSAccount) CheckDelegation(ctx context.Context, domain string) error {
+	name := ChallengeName(domain)
+	target, err := net.DefaultResolver.LookupCNAME(ctx, name)
+	if err != nil {
+		return fmt.Errorf("lookup %s: %w", name, err)
+	}
+	if !strings.EqualFold(strings.TrimSuffix(target, "."), acc.FullDomain) {
+		return fmt.Errorf("%s points to %s, want %s", name, strings.TrimSuffix(target, "."), acc.FullDomain)
+	}
+	return nil
+}
@@ -6,11 +6,13 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 	"sort"
+
+	"mynginx/internal/util"
 )
 
 type CertbotManager struct {
@@ -18,8 +20,31 @@ type CertbotManager struct {
 	Webroot         string // /opt/nginx/html
 	LetsEncryptLive string // /etc/letsencrypt/live
 	Email           string // admin@example.com
+
+	// Runner executes certbot (util.ExecRunner by default).
+	Runner util.Runner
+
+	IssueTimeout time.Duration // certonly
+	RenewTimeout time.Duration // renew (one domain or all), delete, revoke
+
+	// DNSAuthHook switches issuance to DNS-01 (certbot --manual) with this
+	// --manual-auth-hook command, and adds the *.<domain> wildcard. certbot stores
+	// the hook in the lineage's renewal config, so renewals keep using it.
+	DNSAuthHook string
+	// DNSCleanupHook (optional) is the --manual-cleanup-hook removing the record again.
+	DNSCleanupHook string
+
+	// Server is the ACME directory to issue from ("" = certbot's default, Let's
+	// Encrypt); EABKID/EABHMACKey bind the account at CAs that require it (ZeroSSL).
+	// certbot records the server in the renewal config, so renewals stay on it.
+	Server     string
+	EABKID     string
+	EABHMACKey string
 }
 
+// LetsEncryptDirectory is certbot's default ACME server.
+const LetsEncryptDirectory = "https://acme-v02.api.letsencrypt.org/directory"
+
 // CertInfo holds certificate information
 type CertInfo struct {
 	Domain    string
@@ -29,6 +54,39 @@ type CertInfo struct {
 	NotAfter  time.Time
 	DaysLeft  int
 	Exists    bool
+
+	KeyType string // "ECDSA" | "RSA" (from the certificate public key)
+	Lineage string // certbot cert name: Domain, or Domain-rsa / Domain-ecdsa for the alternate cert
+	Source  string // site cert source when not issued here ("path" | "remote"); "" = certbot
+}
+
+// Key types for --key-type; a site with dual certificates has a second lineage
+// named <domain>-<keytype> holding the key type its primary cert does not have.
+const (
+	KeyTypeECDSA = "ecdsa"
+	KeyTypeRSA   = "rsa"
+)
+
+var lineageRenumber = regexp.MustCompile(`-[0-9]{4}$`)
+
+func keyTypeOf(cert *x509.Certificate) string {
+	switch cert.PublicKeyAlgorithm {
+	case x509.ECDSA:
+		return "ECDSA"
+	case x509.RSA:
+		return "RSA"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// AltLineage returns the domain an alternate-key lineage belongs to ("" if name is a primary).
+func AltLineage(name string) string {
+	for _, kt := range []string{KeyTypeRSA, KeyTypeECDSA} {
+		if d, ok := strings.CutSuffix(name, "-"+kt); ok {
+			return d
+		}
+	}
+	return ""
 }
 
 
@@ -71,6 +129,10 @@ func (m *CertbotManager) ensureLiveAlias(domain string) (string, error) {
 	var good []cand
 
 	for _, d := range cands {
+		// only certbot renumbered lineages (domain-0001), not domain-rsa
+		if !lineageRenumber.MatchString(d) {
+			continue
+		}
 		full := filepath.Join(d, "fullchain.pem")
 		key := filepath.Join(d, "privkey.pem")
 		if !fileExists(full) || !fileExists(key) {
@@ -79,7 +141,7 @@ func (m *CertbotManager) ensureLiveAlias(domain string) (string, error) {
 
 		// Try to parse cert expiry as a “quality” signal.
 		na := time.Time{}
-		if info, err := m.getCertInfoFromPath(domain, full, key); err == nil && info.Exists {
+		if info, err := CertInfoFromPath(domain, full, key); err == nil && info.Exists {
 			na = info.NotAfter
 		}
 
@@ -145,8 +207,9 @@ func (m *CertbotManager) ensureLiveAlias(domain string) (string, error) {
 
 
 
-// getCertInfoFromPath parses a cert/key pair at explicit paths (used for probing candidates).
-func (m *CertbotManager) getCertInfoFromPath(domain, certPath, keyPath string) (*CertInfo, error) {
+// CertInfoFromPath parses a cert/key pair at explicit paths (lineage candidates, or
+// certificates kept outside the live dir). Missing files give Exists=false.
+func CertInfoFromPath(domain, certPath, keyPath string) (*CertInfo, error) {
 	info := &CertInfo{
 		Domain:   domain,
 		CertPath: certPath,
@@ -178,10 +241,21 @@ func (m *CertbotManager) getCertInfoFromPath(domain, certPath, keyPath string) (
 	info.NotBefore = cert.NotBefore
 	info.NotAfter = cert.NotAfter
 	info.DaysLeft = int(time.Until(cert.NotAfter).Hours() / 24)
+	info.KeyType = keyTypeOf(cert)
 	return info, nil
 }
 
 
+// certbot runs certbot with args, bounded by timeout (on top of ctx).
+func (m *CertbotManager) certbot(ctx context.Context, timeout time.Duration, args ...string) (util.Result, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return m.Runner.Run(ctx, m.CertbotBin, args...)
+}
+
 // NewCertbotManager creates a new certbot manager
 func NewCertbotManager(certbotBin, webroot, letsEncryptLive, email string) *CertbotManager {
 	return &CertbotManager{
@@ -189,12 +263,55 @@ func NewCertbotManager(certbotBin, webroot, letsEncryptLive, email string) *Cert
 		Webroot:         webroot,
 		LetsEncryptLive: letsEncryptLive,
 		Email:           email,
+		Runner:          util.ExecRunner{},
+		IssueTimeout:    2 * time.Minute,
+		RenewTimeout:    5 * time.Minute,
 	}
 }
 
 // IssueCert issues a new certificate for the domain using HTTP-01 challenge
 // It ensures the webroot exists before attempting issuance
 func (m *CertbotManager) IssueCert(ctx context.Context, domain string) error {
+	return m.issue(ctx, domain, domain, "")
+}
+
+// IssueAltCert issues the second certificate of a dual-cert site: a lineage
+// <domain>-<keytype> with the key type the primary certificate does not use
+// (RSA next to an ECDSA primary, and vice versa). The primary must exist.
+func (m *CertbotManager) IssueAltCert(ctx context.Context, domain string) error {
+	primary, err := m.GetCertInfo(domain)
+	if err != nil {
+		return err
+	}
+	if !primary.Exists {
+		return fmt.Errorf("no certificate for %s yet; issue it before the alternate one", domain)
+	}
+	kt := KeyTypeRSA
+	if primary.KeyType == "RSA" {
+		kt = KeyTypeECDSA
+	}
+	if alt, err := m.GetCertInfo(domain + "-" + kt); err == nil && alt.Exists && alt.DaysLeft > 30 {
+		return nil
+	}
+	return m.issue(ctx, domain, domain+"-"+kt, kt)
+}
+
+// GetAltCertInfo returns the alternate-key certificate of domain (nil if there is none).
+func (m *CertbotManager) GetAltCertInfo(domain string) (*CertInfo, error) {
+	for _, kt := range []string{KeyTypeRSA, KeyTypeECDSA} {
+		info, err := m.GetCertInfo(domain + "-" + kt)
+		if err != nil {
+			return nil, err
+		}
+		if info.Exists {
+			return info, nil
+		}
+	}
+	return nil, nil
+}
+
+// issue runs certbot certonly for domain into lineage certName; keyType "" keeps certbot's default.
+func (m *CertbotManager) issue(ctx context.Context, domain, certName, keyType string) error {
 	if domain == "" {
 		return fmt.Errorf("domain is required")
 	}
@@ -205,8 +322,10 @@ func (m *CertbotManager) IssueCert(ctx context.Context, domain string) error {
 	}
 
 	// Check if cert already exists
-	info, err := m.GetCertInfo(domain)
-	if err == nil && info.Exists {
+	info, err := m.GetCertInfo(certName)
+	switching := m.DNSAuthHook != "" && !m.usesDNS(certName) // HTTP-01 lineage becoming DNS-01 + wildcard
+	moving := info != nil && info.Exists && m.lineageServer(certName) != m.server() // lineage moving to another CA
+	if err == nil && info.Exists && !switching && !moving {
 		// Cert exists - check if it's valid
 		if info.DaysLeft > 30 {
 			return fmt.Errorf("certificate already exists and is valid for %d more days", info.DaysLeft)
@@ -219,10 +338,41 @@ func (m *CertbotManager) IssueCert(ctx context.Context, domain string) error {
 		"--webroot",
 		"-w", m.Webroot,
 		"-d", domain,
-		"--cert-name", domain,
+	}
+	if m.DNSAuthHook != "" {
+		args = []string{
+			"certonly",
+			"--manual",
+			"--preferred-challenges", "dns",
+			"--manual-auth-hook", m.DNSAuthHook,
+			"-d", domain,
+			"-d", "*." + domain,
+		}
+		if m.DNSCleanupHook != "" {
+			args = append(args, "--manual-cleanup-hook", m.DNSCleanupHook)
+		}
+	}
+	args = append(args,
+		"--cert-name", certName,
 		"--non-interactive",
 		"--agree-tos",
-		"--keep-until-expiring", // Don't re-issue if cert is still valid
+	)
+	if moving {
+		args = append(args, "--force-renewal")
+	} else {
+		args = append(args, "--keep-until-expiring") // Don't re-issue if cert is still valid
+	}
+	if m.Server != "" {
+		args = append(args, "--server", m.Server)
+	}
+	if m.EABKID != "" {
+		args = append(args, "--eab-kid", m.EABKID, "--eab-hmac-key", m.EABHMACKey)
+	}
+	switch keyType {
+	case KeyTypeRSA:
+		args = append(args, "--key-type", KeyTypeRSA, "--rsa-key-size", "2048")
+	case KeyTypeECDSA:
+		args = append(args, "--key-type", KeyTypeECDSA, "--elliptic-curve", "secp256r1")
 	}
 
 	if m.Email != "" {
@@ -231,21 +381,21 @@ func (m *CertbotManager) IssueCert(ctx context.Context, domain string) error {
 		args = append(args, "--register-unsafely-without-email")
 	}
 
-	cmd := exec.CommandContext(ctx, m.CertbotBin, args...)
-	out, err := cmd.CombinedOutput()
-	
+	res, err := m.certbot(ctx, m.IssueTimeout, args...)
+	out := res.Output()
+
 	if err != nil {
-		return fmt.Errorf("certbot failed: %w\nOutput: %s", err, string(out))
+		return fmt.Errorf("certbot failed: %w\nOutput: %s", err, out)
 	}
 
 	// If certbot created a suffixed lineage (domain-0001), fix it by creating
 	// /live/<domain> alias so the rest of the system can always use /live/<domain>/...
-	if _, err := m.ensureLiveAlias(domain); err != nil {
+	if _, err := m.ensureLiveAlias(certName); err != nil {
 		return fmt.Errorf("cert issued but failed to ensure live alias: %w", err)
 	}
 
 	// Verify the cert was actually created
-	certPath := filepath.Join(m.LetsEncryptLive, domain, "fullchain.pem")
+	certPath := filepath.Join(m.LetsEncryptLive, certName, "fullchain.pem")
 	if _, err := os.Stat(certPath); err != nil {
 		return fmt.Errorf("cert file not found after issuance: %w", err)
 	}
@@ -253,11 +403,21 @@ func (m *CertbotManager) IssueCert(ctx context.Context, domain string) error {
 	return nil
 }
 
-// RenewCert attempts to renew a certificate
+// RenewCert attempts to renew a certificate (and the alternate-key one, if any)
 func (m *CertbotManager) RenewCert(ctx context.Context, domain string) error {
 	if domain == "" {
 		return fmt.Errorf("domain is required")
 	}
+	if err := m.renew(ctx, domain); err != nil {
+		return err
+	}
+	if alt, err := m.GetAltCertInfo(domain); err == nil && alt != nil {
+		return m.renew(ctx, alt.Lineage)
+	}
+	return nil
+}
+
+func (m *CertbotManager) renew(ctx context.Context, domain string) error {
 
 	args := []string{
 		"renew",
@@ -266,12 +426,16 @@ func (m *CertbotManager) RenewCert(ctx context.Context, domain string) error {
 		"-w", m.Webroot,
 		"--non-interactive",
 	}
+	if m.usesDNS(domain) {
+		// keep the lineage's manual DNS-01 hook instead of forcing webroot
+		args = []string{"renew", "--cert-name", domain, "--non-interactive"}
+	}
+
+	res, err := m.certbot(ctx, m.RenewTimeout, args...)
+	out := res.Output()
 
-	cmd := exec.CommandContext(ctx, m.CertbotBin, args...)
-	out, err := cmd.CombinedOutput()
-	
 	if err != nil {
-		return fmt.Errorf("certbot renew failed: %w\nOutput: %s", err, string(out))
+		return fmt.Errorf("certbot renew failed: %w\nOutput: %s", err, out)
 	}
 
 	return nil
@@ -285,17 +449,79 @@ func (m *CertbotManager) RenewAll(ctx context.Context) error {
 		"-w", m.Webroot,
 		"--non-interactive",
 	}
+	if m.anyUsesDNS() {
+		// a --webroot override would apply to DNS-01 lineages too; every lineage's
+		// renewal config already records its own authenticator
+		args = []string{"renew", "--non-interactive"}
+	}
+
+	res, err := m.certbot(ctx, m.RenewTimeout, args...)
+	out := res.Output()
 
-	cmd := exec.CommandContext(ctx, m.CertbotBin, args...)
-	out, err := cmd.CombinedOutput()
-	
 	if err != nil {
-		return fmt.Errorf("certbot renew all failed: %w\nOutput: %s", err, string(out))
+		return fmt.Errorf("certbot renew all failed: %w\nOutput: %s", err, out)
 	}
 
 	return nil
 }
 
+// renewalConf is certbot's renewal config of a lineage (next to the live dir).
+func (m *CertbotManager) renewalConf(lineage string) string {
+	return filepath.Join(filepath.Dir(m.LetsEncryptLive), "renewal", lineage+".conf")
+}
+
+// renewalParam reads key from a lineage's renewal config ("" if unset).
+func (m *CertbotManager) renewalParam(lineage, key string) string {
+	data, err := os.ReadFile(m.renewalConf(lineage))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// usesDNS reports whether a lineage was issued with the manual (DNS-01) authenticator.
+func (m *CertbotManager) usesDNS(lineage string) bool {
+	return m.renewalParam(lineage, "authenticator") == "manual"
+}
+
+// server is the ACME directory m issues from.
+func (m *CertbotManager) server() string {
+	if m.Server == "" {
+		return LetsEncryptDirectory
+	}
+	return m.Server
+}
+
+// lineageServer is the ACME directory a lineage was issued from (Let's Encrypt when
+// the renewal config does not say).
+func (m *CertbotManager) lineageServer(lineage string) string {
+	if v := m.renewalParam(lineage, "server"); v != "" {
+		return v
+	}
+	return LetsEncryptDirectory
+}
+
+// LineageServer is the ACME directory the certificate of domain was issued from.
+func (m *CertbotManager) LineageServer(domain string) string {
+	return m.lineageServer(domain)
+}
+
+func (m *CertbotManager) anyUsesDNS() bool {
+	confs, _ := filepath.Glob(filepath.Join(filepath.Dir(m.LetsEncryptLive), "renewal", "*.conf"))
+	for _, c := range confs {
+		if m.usesDNS(strings.TrimSuffix(filepath.Base(c), ".conf")) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCertInfo retrieves information about a certificate
 func (m *CertbotManager) GetCertInfo(domain string) (*CertInfo, error) {
 	// If certbot created domain-0001 etc, make sure /live/<domain> points to it.
@@ -309,6 +535,10 @@ func (m *CertbotManager) GetCertInfo(domain string) (*CertInfo, error) {
 		CertPath: certPath,
 		KeyPath:  keyPath,
 		Exists:   false,
+		Lineage:  domain,
+	}
+	if d := AltLineage(domain); d != "" {
+		info.Domain = d
 	}
 
 	// Check if cert files exist
@@ -340,6 +570,7 @@ func (m *CertbotManager) GetCertInfo(domain string) (*CertInfo, error) {
 	info.NotBefore = cert.NotBefore
 	info.NotAfter = cert.NotAfter
 	info.DaysLeft = int(time.Until(cert.NotAfter).Hours() / 24)
+	info.KeyType = keyTypeOf(cert)
 
 	return info, nil
 }
@@ -413,11 +644,30 @@ func (m *CertbotManager) EnsureCertExists(ctx context.Context, domain string) er
 	return m.IssueCert(ctx, domain)
 }
 
-// DeleteCert removes certificate files for a domain (e.g., when removing a site)
+// DeleteCert removes certificate files for a domain (e.g., when removing a site),
+// including its alternate-key certificate
 func (m *CertbotManager) DeleteCert(ctx context.Context, domain string) error {
 	if domain == "" {
 		return fmt.Errorf("domain is required")
 	}
+	if alt, err := m.GetAltCertInfo(domain); err == nil && alt != nil {
+		if err := m.deleteLineage(ctx, alt.Lineage); err != nil {
+			return err
+		}
+	}
+	return m.deleteLineage(ctx, domain)
+}
+
+// DeleteAltCert removes only the alternate-key certificate of domain (no-op if there is none).
+func (m *CertbotManager) DeleteAltCert(ctx context.Context, domain string) error {
+	alt, err := m.GetAltCertInfo(domain)
+	if err != nil || alt == nil {
+		return err
+	}
+	return m.deleteLineage(ctx, alt.Lineage)
+}
+
+func (m *CertbotManager) deleteLineage(ctx context.Context, domain string) error {
 
 	args := []string{
 		"delete",
@@ -425,39 +675,50 @@ func (m *CertbotManager) DeleteCert(ctx context.Context, domain string) error {
 		"--non-interactive",
 	}
 
-	cmd := exec.CommandContext(ctx, m.CertbotBin, args...)
-	out, err := cmd.CombinedOutput()
-	
+	res, err := m.certbot(ctx, m.RenewTimeout, args...)
+	out := res.Output()
+
 	if err != nil {
 		// Check if error is because cert doesn't exist (not a real error)
-		if strings.Contains(string(out), "No certificate found") {
+		if strings.Contains(out, "No certificate found") {
 			return nil
 		}
-		return fmt.Errorf("certbot delete failed: %w\nOutput: %s", err, string(out))
+		return fmt.Errorf("certbot delete failed: %w\nOutput: %s", err, out)
 	}
 
 	return nil
 }
 
-// RevokeCert revokes a certificate (useful before deleting domain)
-func (m *CertbotManager) RevokeCert(ctx context.Context, domain string) error {
+// RevokeReasons are the reasons certbot revoke accepts.
+var RevokeReasons = []string{"unspecified", "keycompromise", "affiliationchanged", "superseded", "cessationofoperation"}
+
+// RevokeCert revokes a certificate at the CA it was issued from (useful before
+// deleting domain). The files are kept so nginx still starts; issue a new one to
+// replace them. reason is one of RevokeReasons ("" = unspecified).
+func (m *CertbotManager) RevokeCert(ctx context.Context, domain, reason string) error {
 	if domain == "" {
 		return fmt.Errorf("domain is required")
 	}
+	if reason == "" {
+		reason = "unspecified"
+	}
 
 	certPath := filepath.Join(m.LetsEncryptLive, domain, "fullchain.pem")
 	
 	args := []string{
 		"revoke",
 		"--cert-path", certPath,
+		"--reason", reason,
+		"--server", m.lineageServer(domain),
+		"--no-delete-after-revoke",
 		"--non-interactive",
 	}
 
-	cmd := exec.CommandContext(ctx, m.CertbotBin, args...)
-	out, err := cmd.CombinedOutput()
-	
+	res, err := m.certbot(ctx, m.RenewTimeout, args...)
+	out := res.Output()
+
 	if err != nil {
-		return fmt.Errorf("certbot revoke failed: %w\nOutput: %s", err, string(out))
+		return fmt.Errorf("certbot revoke failed: %w\nOutput: %s", err, out)
 	}
 
 	return nil
@@ -0,0 +1,172 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxChallengeRedirects is how many redirects Let's Encrypt follows on HTTP-01.
+const maxChallengeRedirects = 10
+
+// ChallengeProbe is the HTTP-01 fetch of the test token through one address of the
+// domain, redirects followed the way Let's Encrypt follows them.
+type ChallengeProbe struct {
+	Addr    string   // ip:80 the first request went to
+	Hops    []string // "301 http://a/... -> https://b/..." per redirect
+	Status  string   // final response status ("" = no response)
+	Body    string   // start of the final response body
+	OK      bool
+	Problem string // what is wrong, in words (empty when OK)
+}
+
+// ChallengeReport is the result of TestHTTP01.
+type ChallengeReport struct {
+	Domain  string
+	URL     string // the token URL that was fetched
+	Problem string // set when no address could be tried (e.g. DNS)
+	Probes  []ChallengeProbe
+}
+
+// OK reports whether every address that answered served the token and at least
+// one did (unreachable addresses are tolerated, as in CheckHTTP01).
+func (r ChallengeReport) OK() bool {
+	ok := false
+	for _, p := range r.Probes {
+		if p.OK {
+			ok = true
+		} else if p.Status != "" {
+			return false
+		}
+	}
+	return ok
+}
+
+// TestHTTP01 places a token in the ACME webroot and fetches it through the public
+// URL from every A/AAAA address of domain, like CheckHTTP01, but keeps going to
+// report each answer: the redirects followed, the final status and a diagnosis
+// (404, redirect loop, another vhost answering, unreachable port 80).
+func TestHTTP01(ctx context.Context, domain, webroot string) (ChallengeReport, error) {
+	rep := ChallengeReport{Domain: domain}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil || len(ips) == 0 {
+		rep.Problem = fmt.Sprintf("%s does not resolve (%v): point its A/AAAA record at this server first", domain, err)
+		return rep, nil
+	}
+	name, token, path, err := placeChallengeToken(webroot)
+	if err != nil {
+		return rep, err
+	}
+	defer os.Remove(path)
+	rep.URL = "http://" + domain + "/.well-known/acme-challenge/" + name
+
+	for _, ip := range ips {
+		rep.Probes = append(rep.Probes, probeChallenge(ctx, domain, ip.IP.String(), rep.URL, token))
+	}
+	return rep, nil
+}
+
+// probeChallenge fetches u with requests for domain pinned to ip, following
+// redirects by hand so each hop can be reported.
+func probeChallenge(ctx context.Context, domain, ip, u, token string) ChallengeProbe {
+	p := ChallengeProbe{Addr: net.JoinHostPort(ip, "80")}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if host, port, err := net.SplitHostPort(addr); err == nil && strings.EqualFold(host, domain) {
+					addr = net.JoinHostPort(ip, port)
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			// Let's Encrypt does not validate certificates on redirects to https
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	seen := map[string]bool{}
+	for hop := 0; ; hop++ {
+		if seen[u] {
+			p.Problem = "redirect loop: " + u + " was already visited; the challenge path must not redirect back to itself (check http->https and www redirects)"
+			return p
+		}
+		if hop > maxChallengeRedirects {
+			p.Problem = fmt.Sprintf("more than %d redirects; Let's Encrypt gives up", maxChallengeRedirects)
+			return p
+		}
+		seen[u] = true
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			p.Problem = err.Error()
+			return p
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			if hop == 0 {
+				p.Problem = fmt.Sprintf("port 80 not reachable: %v (firewall, NAT, or nginx not listening)", err)
+			} else {
+				p.Problem = fmt.Sprintf("redirect target not reachable: %v", err)
+			}
+			return p
+		}
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		res.Body.Close()
+		p.Status = res.Status
+
+		if loc := res.Header.Get("Location"); res.StatusCode >= 300 && res.StatusCode < 400 && loc != "" {
+			next, err := req.URL.Parse(loc)
+			if err != nil {
+				p.Problem = fmt.Sprintf("bad redirect Location %q", loc)
+				return p
+			}
+			p.Hops = append(p.Hops, fmt.Sprintf("%d %s -> %s", res.StatusCode, u, next))
+			if next.Scheme != "http" && next.Scheme != "https" {
+				p.Problem = fmt.Sprintf("redirect to unsupported scheme %q", next.Scheme)
+				return p
+			}
+			if port := next.Port(); port != "" && port != "80" && port != "443" {
+				p.Problem = fmt.Sprintf("redirect to port %s; Let's Encrypt only follows redirects to ports 80 and 443", port)
+				return p
+			}
+			u = next.String()
+			continue
+		}
+
+		p.Body = strings.TrimSpace(string(body))
+		if len(p.Body) > 200 {
+			p.Body = p.Body[:200] + "…"
+		}
+		switch {
+		case res.StatusCode == http.StatusOK && p.Body == token:
+			p.OK = true
+		case res.StatusCode == http.StatusOK:
+			p.Problem = "answered 200 without the token: another server block (or another server) handles " + hostOf(u) + "; apply the site and check default_server"
+		case res.StatusCode == http.StatusNotFound:
+			p.Problem = "404: the token is not served from the ACME webroot; the vhost's /.well-known/acme-challenge/ location is missing or points elsewhere"
+		case res.StatusCode == http.StatusForbidden || res.StatusCode == http.StatusUnauthorized:
+			p.Problem = res.Status + ": access rules (auth, deny, WAF) block /.well-known/acme-challenge/"
+		default:
+			p.Problem = res.Status + " instead of the token"
+		}
+		return p
+	}
+}
+
+func hostOf(u string) string {
+	if pu, err := url.Parse(u); err == nil {
+		return pu.Host
+	}
+	return u
+}
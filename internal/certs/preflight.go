@@ -0,0 +1,86 @@
+package certs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CheckHTTP01 verifies that http://<domain>/.well-known/acme-challenge/ reaches
+// this nginx before certbot is run: it drops a token file into webroot and
+// fetches it from every A/AAAA address of domain on port 80. An address that
+// answers with anything but the token fails the check (Let's Encrypt would get
+// the same answer); unreachable addresses are tolerated while another one works,
+// as Let's Encrypt falls back between IPv6 and IPv4.
+func CheckHTTP01(ctx context.Context, domain, webroot string) error {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, domain)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("%s does not resolve (%v); point its A/AAAA record at this server first", domain, err)
+	}
+
+	name, token, path, err := placeChallengeToken(webroot)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var unreachable []string
+	ok := false
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.IP.String(), "80")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/.well-known/acme-challenge/"+name, nil)
+		if err != nil {
+			return err
+		}
+		req.Host = domain
+		res, err := client.Do(req)
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s: %v", addr, err))
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != token {
+			return fmt.Errorf("%s answers %s on %s without the challenge token: it is not this nginx, or the site's port 80 server is missing (apply the site first)", domain, res.Status, addr)
+		}
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("port 80 of %s is not reachable (%s): behind NAT or a firewall? forward/open tcp/80 to this server", domain, strings.Join(unreachable, "; "))
+	}
+	return nil
+}
+
+// placeChallengeToken writes a random token into the ACME challenge dir of webroot
+// and returns its file name, content and path (the caller removes it).
+func placeChallengeToken(webroot string) (name, token, path string, err error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	token = hex.EncodeToString(b)
+	name = "ngm-preflight-" + token
+	dir := filepath.Join(webroot, ".well-known", "acme-challenge")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", "", fmt.Errorf("create challenge dir: %w", err)
+	}
+	path = filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(token), 0644); err != nil {
+		return "", "", "", fmt.Errorf("write challenge token: %w", err)
+	}
+	return name, token, path, nil
+}
@@ -0,0 +1,96 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// DefaultSelfSignedValidity is used when EnsureSelfSigned gets a zero validity.
+const DefaultSelfSignedValidity = 7 * 24 * time.Hour
+
+// EnsureSelfSigned creates a per-domain self-signed cert used only as a bootstrap fallback
+// so nginx can start before Let's Encrypt files exist. Existing files are left alone.
+func EnsureSelfSigned(domain, certPath, keyPath string, validity time.Duration) error {
+	if fileExists(certPath) && fileExists(keyPath) {
+		return nil
+	}
+	certPEM, keyPEM, err := SelfSigned(domain, validity)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return fmt.Errorf("mkdir cert dir: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("mkdir key dir: %w", err)
+	}
+	// nginx master is typically root, so 0600 key is OK; cert can be world-readable.
+	if err := util.WriteFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(certPath, certPEM, 0644)
+}
+
+// SelfSigned generates a PEM cert/key pair for domain and its www alias
+// (or the bare domain when domain already starts with "www.").
+func SelfSigned(domain string, validity time.Duration) (certPEM, keyPEM []byte, err error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return nil, nil, fmt.Errorf("domain is required")
+	}
+	if validity <= 0 {
+		validity = DefaultSelfSignedValidity
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate serial: %w", err)
+	}
+
+	names := []string{domain}
+	if alias, ok := strings.CutPrefix(domain, "www."); ok {
+		names = append(names, alias)
+	} else {
+		names = append(names, "www."+domain)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: domain},
+		DNSNames:              names,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal key: %w", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
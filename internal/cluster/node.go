@@ -0,0 +1,256 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/config"
+)
+
+// Agent API paths (served by every node, see internal/web/agent.go).
+const (
+	PathLock     = "/agent/v1/lock"
+	PathCert     = "/agent/v1/cert"
+	PathSnapshot = "/agent/v1/snapshot"
+)
+
+// maxMessage bounds agent responses; snapshots (database plus configs) get more room.
+const (
+	maxMessage  = 1 << 20
+	maxSnapshot = 512 << 20
+)
+
+// LockRequest asks the coordinator to acquire or release a domain issuance lock.
+type LockRequest struct {
+	Op     string `json:"op"` // "acquire" | "release"
+	Domain string `json:"domain"`
+	Holder string `json:"holder"`
+}
+
+// LockResponse tells the requester whether it got the lock (and who holds it otherwise).
+type LockResponse struct {
+	OK     bool   `json:"ok"`
+	Holder string `json:"holder,omitempty"`
+}
+
+// CertBundle is a certificate pushed from the issuing node to its peers.
+type CertBundle struct {
+	Domain    string `json:"domain"`
+	Fullchain []byte `json:"fullchain"`
+	PrivKey   []byte `json:"privkey"`
+}
+
+// SnapshotRequest asks the primary for its current state (sent by a standby).
+type SnapshotRequest struct {
+	Node string `json:"node"`
+}
+
+// Snapshot is a primary's state as pulled by its standby: a consistent copy of the
+// database and the generated configs, relative to the nginx conf dir.
+type Snapshot struct {
+	CreatedAt time.Time      `json:"created_at"`
+	DB        []byte         `json:"db"`
+	Files     []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is one generated config file; Path is e.g. "sites/example.com.conf".
+type SnapshotFile struct {
+	Path string `json:"path"`
+	Data []byte `json:"data"`
+}
+
+// Node is this process's view of the cluster.
+type Node struct {
+	cfg    config.ClusterConfig
+	ttl    time.Duration
+	client *http.Client
+	bulk   *http.Client // snapshot pulls
+	locks  *LockTable
+}
+
+func NewNode(cfg config.ClusterConfig, locks LockStore) *Node {
+	ttl, err := time.ParseDuration(cfg.LockTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return &Node{
+		cfg:    cfg,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 20 * time.Second},
+		bulk:   &http.Client{Timeout: 10 * time.Minute},
+		locks:  NewLockTable(locks),
+	}
+}
+
+// Enabled reports whether any peers are configured.
+func (n *Node) Enabled() bool {
+	return n != nil && len(n.cfg.Peers) > 0
+}
+
+func (n *Node) Name() string       { return n.cfg.NodeName }
+func (n *Node) Secret() string     { return n.cfg.Secret }
+func (n *Node) TTL() time.Duration { return n.ttl }
+func (n *Node) Locks() *LockTable  { return n.locks }
+
+// Coordinator is the node that arbitrates issuance locks: the lowest node name.
+// Every node computes the same answer from the same config, so no election is needed.
+func (n *Node) Coordinator() string {
+	names := []string{n.cfg.NodeName}
+	for _, p := range n.cfg.Peers {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// IsPeer reports whether name is a configured peer (used to reject unknown senders).
+func (n *Node) IsPeer(name string) bool {
+	_, ok := n.peerURL(name)
+	return ok
+}
+
+func (n *Node) peerURL(name string) (string, bool) {
+	for _, p := range n.cfg.Peers {
+		if p.Name == name {
+			return strings.TrimRight(p.URL, "/"), true
+		}
+	}
+	return "", false
+}
+
+// Lock acquires the cluster-wide issuance lock for domain. On success the caller must
+// call the returned release func when issuance is done. Standalone nodes get a no-op lock.
+func (n *Node) Lock(ctx context.Context, domain string) (func(), error) {
+	if !n.Enabled() {
+		return func() {}, nil
+	}
+	coord := n.Coordinator()
+	if coord == n.cfg.NodeName {
+		ok, holder, err := n.locks.Acquire(domain, n.cfg.NodeName, n.ttl)
+		if err != nil {
+			return nil, fmt.Errorf("cluster lock: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("certificate issuance for %s is already running on node %s", domain, holder)
+		}
+		return func() { _ = n.locks.Release(domain, n.cfg.NodeName) }, nil
+	}
+
+	var resp LockResponse
+	if err := n.call(ctx, coord, PathLock, LockRequest{Op: "acquire", Domain: domain, Holder: n.cfg.NodeName}, &resp); err != nil {
+		return nil, fmt.Errorf("cluster lock via %s: %w", coord, err)
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("certificate issuance for %s is already running on node %s", domain, resp.Holder)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = n.call(ctx, coord, PathLock, LockRequest{Op: "release", Domain: domain, Holder: n.cfg.NodeName}, &LockResponse{})
+	}, nil
+}
+
+// PushCert sends a certificate to every peer; it returns one error per failed peer.
+func (n *Node) PushCert(ctx context.Context, b CertBundle) []error {
+	if !n.Enabled() {
+		return nil
+	}
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for _, p := range n.cfg.Peers {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := n.call(ctx, name, PathCert, b, &struct{}{}); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("push %s to %s: %w", b.Domain, name, err))
+				mu.Unlock()
+			}
+		}(p.Name)
+	}
+	wg.Wait()
+	return errs
+}
+
+// PullSnapshot fetches the database and generated configs of peer (the primary of
+// this standby).
+func (n *Node) PullSnapshot(ctx context.Context, peer string) (Snapshot, error) {
+	var snap Snapshot
+	if err := n.callWith(ctx, n.bulk, maxSnapshot, peer, PathSnapshot, SnapshotRequest{Node: n.cfg.NodeName}, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("snapshot from %s: %w", peer, err)
+	}
+	return snap, nil
+}
+
+// call POSTs a sealed request to a peer and opens the sealed response into out.
+func (n *Node) call(ctx context.Context, peer, path string, in, out any) error {
+	return n.callWith(ctx, n.client, maxMessage, peer, path, in, out)
+}
+
+func (n *Node) callWith(ctx context.Context, client *http.Client, limit int64, peer, path string, in, out any) error {
+	base, ok := n.peerURL(peer)
+	if !ok {
+		return fmt.Errorf("unknown peer %q", peer)
+	}
+	body, err := Seal(n.cfg.Secret, n.cfg.NodeName, in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, limit))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(data)))
+	}
+	_, err = Open(n.cfg.Secret, data, out)
+	return err
+}
+
+// ---------------- lock table (coordinator side) ----------------
+
+// LockStore persists issuance leases. It is backed by the node's database so the
+// serve process and CLI invocations on the coordinator share the same leases.
+type LockStore interface {
+	// AcquireLease grants name to holder until expires unless another holder has an
+	// unexpired lease; it returns the current holder either way.
+	AcquireLease(name, holder string, expires time.Time) (bool, string, error)
+	ReleaseLease(name, holder string) error
+}
+
+// LockTable grants per-domain issuance leases (re-entrant for the same holder).
+type LockTable struct {
+	st LockStore
+}
+
+func NewLockTable(st LockStore) *LockTable {
+	return &LockTable{st: st}
+}
+
+func (t *LockTable) Acquire(domain, holder string, ttl time.Duration) (bool, string, error) {
+	return t.st.AcquireLease("cert:"+domain, holder, time.Now().Add(ttl))
+}
+
+func (t *LockTable) Release(domain, holder string) error {
+	return t.st.ReleaseLease("cert:"+domain, holder)
+}
@@ -0,0 +1,79 @@
+package cluster
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maxClockSkew bounds how old (or early) a sealed message may be.
+const maxClockSkew = 2 * time.Minute
+
+// envelope is the plaintext inside every sealed agent message.
+type envelope struct {
+	From    string          `json:"from"`
+	Sent    int64           `json:"sent"` // unix seconds
+	Payload json.RawMessage `json:"payload"`
+}
+
+func aead(secret string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("ngm-cluster:" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts and authenticates v (AES-256-GCM with a key derived from the shared secret).
+// Output is nonce||ciphertext.
+func Seal(secret, from string, v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := json.Marshal(envelope{From: from, Sent: time.Now().Unix(), Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	g, err := aead(secret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, g.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return g.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Open decrypts a sealed message into v and returns the sending node name.
+// A message that decrypts proves the sender knows the cluster secret.
+func Open(secret string, data []byte, v any) (string, error) {
+	g, err := aead(secret)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < g.NonceSize() {
+		return "", fmt.Errorf("sealed message too short")
+	}
+	plain, err := g.Open(nil, data[:g.NonceSize()], data[g.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt message (wrong cluster secret?)")
+	}
+	var env envelope
+	if err := json.Unmarshal(plain, &env); err != nil {
+		return "", fmt.Errorf("bad envelope: %w", err)
+	}
+	if d := time.Since(time.Unix(env.Sent, 0)); d > maxClockSkew || d < -maxClockSkew {
+		return "", fmt.Errorf("message from %s outside allowed clock skew (%s)", env.From, d.Round(time.Second))
+	}
+	if err := json.Unmarshal(env.Payload, v); err != nil {
+		return "", fmt.Errorf("bad payload: %w", err)
+	}
+	return env.From, nil
+}
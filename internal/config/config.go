@@ -7,24 +7,114 @@ import (
 	"net"
 	"strings"
 	"path/filepath"
+	"net/url"
+	"regexp"
+	"sort"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"mynginx/internal/syslog"
 )
 
 type Config struct {
-	API      APIConfig      `yaml:"api"`
-	Nginx    NginxConfig    `yaml:"nginx"`
-	Certs    CertsConfig    `yaml:"certs"`
-	PHPFPM   PHPFPMConfig   `yaml:"phpfpm"`
-	Hosting  HostingConfig  `yaml:"hosting"`
-	Security SecurityConfig `yaml:"security"`
-	Storage  StorageConfig  `yaml:"storage"`
+	API        APIConfig        `yaml:"api"`
+	Nginx      NginxConfig      `yaml:"nginx"`
+	Certs      CertsConfig      `yaml:"certs"`
+	PHPFPM     PHPFPMConfig     `yaml:"phpfpm"`
+	Hosting    HostingConfig    `yaml:"hosting"`
+	Security   SecurityConfig   `yaml:"security"`
+	Storage    StorageConfig    `yaml:"storage"`
+	UI         UIConfig         `yaml:"ui"`
+	Notify     NotifyConfig     `yaml:"notify"`
+	Cluster    ClusterConfig    `yaml:"cluster"`
+	Health     HealthConfig     `yaml:"health"`
+	Status     StatusConfig     `yaml:"status_page"`
+	TLSScan    TLSScanConfig    `yaml:"tls_scan"`
+	Timeouts   TimeoutsConfig   `yaml:"timeouts"`
+	Supervisor SupervisorConfig `yaml:"supervisor"`
+	Global     GlobalConfig     `yaml:"global"`
+	Expiry     ExpiryConfig     `yaml:"expiry"`
+	Saturation SaturationConfig `yaml:"saturation"`
+	Discovery  DiscoveryConfig  `yaml:"discovery"`
+	DNS        DNSConfig        `yaml:"dns"`
+	Snapshots  SnapshotsConfig  `yaml:"snapshots"`
+	GC         GCConfig         `yaml:"gc"`
+	Watchdog   WatchdogConfig   `yaml:"watchdog"`
+
+	// Sandbox is the fake root set by `ngm -sandbox <dir>` ("" = real system).
+	Sandbox string `yaml:"-"`
+
+	// Path is the absolute path the config was loaded from (handed to certbot hooks).
+	Path string `yaml:"-"`
 }
 
 type APIConfig struct {
 	Listen   string   `yaml:"listen"`
-	Tokens   []string `yaml:"tokens"`
-	AllowIPs []string `yaml:"allow_ips"`
+	Tokens   []string `yaml:"tokens"` // static tokens, imported into the database (scope admin) at startup; prefer `ngm token create`
+	AllowIPs []string `yaml:"allow_ips"` // CIDRs that may reach the panel and API (empty = any)
+	// TrustedProxies are CIDRs of reverse proxies in front of the panel: their
+	// X-Forwarded-For / X-Real-IP is taken as the client address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// MetricsListen serves /metrics on its own address (e.g. a private interface for
+	// Prometheus) instead of api.listen; "" = on api.listen.
+	MetricsListen string `yaml:"metrics_listen"`
+	// PublicURL is the externally reachable base URL of the panel (used in emailed links).
+	PublicURL string `yaml:"public_url"`
+
+	Limits    LimitsConfig    `yaml:"limits"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig throttles the JSON API (/api/...) per bearer token and per source
+// IP, and the login / password-reset forms per source IP, with token buckets: a
+// client may burst up to *_burst requests, then gets rate per second (per minute
+// for logins) and a 429 with Retry-After beyond that.
+type RateLimitConfig struct {
+	Enabled        bool    `yaml:"enabled"`
+	PerIP          float64 `yaml:"per_ip"` // API requests/s per source IP
+	PerIPBurst     int     `yaml:"per_ip_burst"`
+	PerToken       float64 `yaml:"per_token"` // API requests/s per bearer token
+	PerTokenBurst  int     `yaml:"per_token_burst"`
+	LoginPerMinute float64 `yaml:"login_per_minute"` // login / reset POSTs per source IP
+	LoginBurst     int     `yaml:"login_burst"`
+}
+
+// LimitsConfig bounds request sizes and connection times of the panel listener
+// (slow-client protection). Upload routes get their own size cap and deadline.
+type LimitsConfig struct {
+	MaxBodyMB         int    `yaml:"max_body_mb"`   // every other request
+	MaxUploadMB       int    `yaml:"max_upload_mb"` // upload routes
+	MaxHeaderKB       int    `yaml:"max_header_kb"`
+	ReadHeaderTimeout string `yaml:"read_header_timeout"`
+	ReadTimeout       string `yaml:"read_timeout"`   // whole request, body included
+	WriteTimeout      string `yaml:"write_timeout"`  // must outlast the slowest action (certbot renew)
+	IdleTimeout       string `yaml:"idle_timeout"`   // keep-alive connections
+	UploadTimeout     string `yaml:"upload_timeout"` // read+write deadline of upload routes
+}
+
+// Limits is LimitsConfig with parsed durations; see LimitsConfig.Durations.
+type Limits struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+	Upload     time.Duration
+}
+
+// Durations parses the configured timeouts (validated in Validate).
+func (l LimitsConfig) Durations() Limits {
+	d := func(s string) time.Duration {
+		v, _ := time.ParseDuration(s)
+		return v
+	}
+	return Limits{
+		ReadHeader: d(l.ReadHeaderTimeout),
+		Read:       d(l.ReadTimeout),
+		Write:      d(l.WriteTimeout),
+		Idle:       d(l.IdleTimeout),
+		Upload:     d(l.UploadTimeout),
+	}
 }
 
 type NginxConfig struct {
@@ -32,14 +122,33 @@ type NginxConfig struct {
 	MainConf string          `yaml:"main_conf"`
 	SitesDir string          `yaml:"sites_dir"`
 	Bin      string          `yaml:"bin"`
+	ErrorLog string          `yaml:"error_log"` // main error log, tailed when a test/reload fails
 	Apply    NginxApplyConfig `yaml:"apply"`
 }
 
 type NginxApplyConfig struct {
 	StagingDir       string `yaml:"staging_dir"`
 	BackupDir        string `yaml:"backup_dir"`
+	BackupKeep       int    `yaml:"backup_keep"`  // vhost backups kept per domain
 	TestBeforeReload bool   `yaml:"test_before_reload"`
-	ReloadMode       string `yaml:"reload_mode"` // "signal" or "systemd"
+	ReloadMode       string `yaml:"reload_mode"`  // "signal" or "systemd"
+	VerifyReach      bool   `yaml:"verify_reach"` // fetch applied sites over IPv4 and IPv6 after the reload
+
+	// BatchSize is how many sites an apply publishes per nginx test/reload; a larger
+	// apply goes in batches and lets go of the apply lock between them.
+	BatchSize int `yaml:"batch_size"`
+	// TimeBudget bounds one apply run ("" = none): no batch starts after it, the
+	// sites not reached stay pending for the next apply.
+	TimeBudget string `yaml:"time_budget"`
+}
+
+// MaxApplyBatch is the largest nginx.apply.batch_size.
+const MaxApplyBatch = 10000
+
+// TimeBudgetDuration parses nginx.apply.time_budget (0 = none; validated in Problems).
+func (c NginxApplyConfig) TimeBudgetDuration() time.Duration {
+	d, _ := time.ParseDuration(c.TimeBudget)
+	return d
 }
 
 type CertsConfig struct {
@@ -48,6 +157,86 @@ type CertsConfig struct {
 	Webroot         string `yaml:"webroot"`
 	LetsEncryptLive string `yaml:"letsencrypt_live"`
 	CertbotBin      string `yaml:"certbot_bin"`
+
+	// SelfSignedDays is the validity of the bootstrap self-signed cert used until Let's Encrypt issues one.
+	SelfSignedDays int `yaml:"self_signed_days"`
+
+	// AcmeDNS is the acme-dns server domains can delegate DNS-01 validation to (wildcard certs).
+	AcmeDNS AcmeDNSConfig `yaml:"acme_dns"`
+
+	// SkipReachabilityCheck issues HTTP-01 certs without first checking that port 80
+	// of the domain reaches this nginx (e.g. NAT without hairpinning).
+	SkipReachabilityCheck bool `yaml:"skip_reachability_check"`
+
+	// CA is the ACME CA certificates are issued by unless a site picks another: a
+	// built-in name (letsencrypt, letsencrypt-staging, zerossl, buypass) or a key of CAs.
+	CA  string                  `yaml:"ca"`
+	CAs map[string]ACMECAConfig `yaml:"cas"`
+
+	// Fallback re-issues from another CA when renewals keep failing close to expiry.
+	Fallback CertFallbackConfig `yaml:"fallback"`
+}
+
+// CertFallbackConfig: after AfterFailures consecutive failed renewals of a certificate
+// expiring within WithinDays, `cert renew` issues it from CA instead.
+type CertFallbackConfig struct {
+	CA            string   `yaml:"ca"` // "" disables the fallback
+	AfterFailures int      `yaml:"after_failures"`
+	WithinDays    int      `yaml:"within_days"`
+	Webhooks      []string `yaml:"webhooks"` // URLs that receive a JSON POST
+	NotifyEmails  []string `yaml:"notify_emails"`
+}
+
+// ACMECAConfig is an ACME CA. For a built-in name Directory may be left empty;
+// ZeroSSL requires the EAB credentials from its dashboard.
+type ACMECAConfig struct {
+	Directory  string `yaml:"directory"`
+	EABKID     string `yaml:"eab_kid"`
+	EABHMACKey string `yaml:"eab_hmac_key"`
+}
+
+// Built-in ACME directories (certs.ca / a site's CA).
+var BuiltinACMECAs = map[string]string{
+	"letsencrypt":         "https://acme-v02.api.letsencrypt.org/directory",
+	"letsencrypt-staging": "https://acme-staging-v02.api.letsencrypt.org/directory",
+	"zerossl":             "https://acme.zerossl.com/v2/DV90",
+	"buypass":             "https://api.buypass.com/acme/directory",
+}
+
+// ACMECA resolves a CA name ("" = certs.ca) against certs.cas and the built-ins.
+func (c CertsConfig) ACMECA(name string) (ACMECAConfig, bool) {
+	if name == "" {
+		name = c.CA
+	}
+	ca, ok := c.CAs[name]
+	if ca.Directory == "" {
+		var builtin bool
+		ca.Directory, builtin = BuiltinACMECAs[name]
+		ok = ok || builtin
+	}
+	return ca, ok && ca.Directory != ""
+}
+
+// ACMECANames lists the usable CA names (built-ins and certs.cas), sorted.
+func (c CertsConfig) ACMECANames() []string {
+	seen := map[string]bool{}
+	var out []string
+	for name := range BuiltinACMECAs {
+		seen[name] = true
+		out = append(out, name)
+	}
+	for name := range c.CAs {
+		if !seen[name] {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+type AcmeDNSConfig struct {
+	Server    string   `yaml:"server"`     // e.g. https://auth.acme-dns.io; "" disables delegation
+	AllowFrom []string `yaml:"allow_from"` // CIDRs allowed to update the TXT records (this node / cluster)
 }
 
 type PHPFPMConfig struct {
@@ -65,17 +254,421 @@ type HostingConfig struct {
 	HomeRoot      string `yaml:"home_root"`
 	SitesRootName string `yaml:"sites_root_name"`
 	WebGroup      string `yaml:"web_group"`
+
+	Placeholder PlaceholderConfig `yaml:"placeholder"`
+	Retired     RetiredConfig     `yaml:"retired"`
+	Preview     PreviewConfig     `yaml:"preview"`
+	SFTP        SFTPConfig        `yaml:"sftp"`
+
+	UpstreamKeepalive KeepaliveConfig `yaml:"upstream_keepalive"`
+}
+
+// KeepaliveConfig is the default upstream keepalive pool of proxy sites (`ngm site
+// keepalive` overrides it per site): idle connections kept open per nginx worker,
+// requests sent over one connection, and how long an idle one is kept.
+type KeepaliveConfig struct {
+	Connections int    `yaml:"connections"`
+	Requests    int    `yaml:"requests"`
+	Timeout     string `yaml:"timeout"` // Go duration, e.g. "60s"
+}
+
+// SFTPConfig is the sftp-only jail of hosting users (`ngm user sftp`). A jailed user
+// is put in Group, which sshd_config (a Match Group block written to SSHDConfig)
+// chroots to JailRoot/<user> with internal-sftp; that directory holds one bind mount
+// per site of the user, so nothing else on the server is visible.
+type SFTPConfig struct {
+	JailRoot    string `yaml:"jail_root"`
+	Group       string `yaml:"group"`
+	SSHDConfig  string `yaml:"sshd_config"`  // drop-in file included by /etc/ssh/sshd_config
+	SSHDService string `yaml:"sshd_service"` // reloaded after SSHDConfig changes ("ssh" on Debian, "sshd" elsewhere)
+}
+
+// PlaceholderConfig is the "coming soon" page served by php/static sites added with a
+// placeholder until files appear in their webroot (checked by `ngm serve`).
+type PlaceholderConfig struct {
+	Template string `yaml:"template"` // HTML template ({{.Domain}}); "" = the built-in page
+	Interval string `yaml:"interval"` // time between webroot checks
+}
+
+// RetiredConfig is the page a site disabled with a grace period (`ngm site rm
+// --grace`) serves with a 410 or 503 until the grace period ends and `ngm serve`
+// removes its vhost.
+type RetiredConfig struct {
+	Template string `yaml:"template"` // HTML template ({{.Domain}}, {{.Status}}, {{.Until}}); "" = the built-in page
+	Interval string `yaml:"interval"` // time between checks for ended grace periods
+}
+
+// PreviewConfig serves sites on temporary hostnames (`ngm preview`) so owners can test
+// them here before switching DNS: <domain with dots as dashes>.<domain>, e.g.
+// shop-example-com.preview.panel.example. A wildcard DNS record for *.<domain> must
+// point at this server; each preview hostname gets its own certificate over HTTP-01.
+type PreviewConfig struct {
+	Domain    string   `yaml:"domain"`    // "" = no preview hostnames, only the hosts-file hint
+	Addresses []string `yaml:"addresses"` // public IPs of this server, for the hosts-file hint
 }
 
 type SecurityConfig struct {
-	AuditLog string `yaml:"audit_log"`
+	AuditLog       string          `yaml:"audit_log"`
+	PasswordPolicy PasswordPolicy  `yaml:"password_policy"`
+	ResetTokenTTL  string          `yaml:"reset_token_ttl"` // Go duration, e.g. "1h"
+	Syslog         SyslogConfig    `yaml:"syslog"`
+	Session        SessionConfig   `yaml:"session"`
+	Approvals      ApprovalsConfig `yaml:"approvals"`
+}
+
+// ApprovalsConfig turns on the two-person rule: deleting a site or applying all
+// sites from the panel or the API becomes a change request that a second admin
+// approves under /ui/approvals before it runs.
+type ApprovalsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Expire  string `yaml:"expire"` // an undecided request lapses after this long, e.g. "24h"
+}
+
+// ExpireAfter parses approvals.expire (validated in Problems).
+func (a ApprovalsConfig) ExpireAfter() time.Duration {
+	d, _ := time.ParseDuration(a.Expire)
+	return d
+}
+
+// SessionConfig bounds panel sessions: an absolute lifetime, an idle timeout, how
+// many sessions one panel user may hold at once, and how recently the password must
+// have been entered for destructive actions (site delete, cert revoke).
+type SessionConfig struct {
+	TTL         string `yaml:"ttl"`          // absolute lifetime, e.g. "12h"
+	IdleTimeout string `yaml:"idle_timeout"` // signed out after this long without a request ("0" = off)
+	MaxPerUser  int    `yaml:"max_per_user"` // 0 = unlimited; a new login signs out the oldest
+	Reauth      string `yaml:"reauth"`       // "0" = never ask again
+}
+
+// Durations parses the session settings (validated in Problems).
+func (s SessionConfig) Durations() (ttl, idle, reauth time.Duration) {
+	ttl, _ = time.ParseDuration(s.TTL)
+	idle, _ = time.ParseDuration(s.IdleTimeout)
+	reauth, _ = time.ParseDuration(s.Reauth)
+	return ttl, idle, reauth
+}
+
+// SyslogConfig forwards audit events (logins, event log entries) to a SIEM as
+// RFC 5424 messages; per-site access logs are opted in with `ngm site syslog`.
+type SyslogConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Network  string `yaml:"network"`  // udp | tcp
+	Address  string `yaml:"address"`  // host:port of the collector
+	Facility string `yaml:"facility"` // e.g. auth, local0
+	AppName  string `yaml:"app_name"`
+
+	// AccessFacility is used by nginx for per-site access logs (nginx only speaks UDP).
+	AccessFacility string `yaml:"access_facility"`
+}
+
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
 }
 
 type StorageConfig struct {
 	SQLitePath string `yaml:"sqlite_path"`
+	// SlowQuery logs store statements taking at least this long ("0" = off).
+	SlowQuery string `yaml:"slow_query"`
+}
+
+// SlowQueryThreshold parses storage.slow_query (validated in Problems).
+func (s StorageConfig) SlowQueryThreshold() time.Duration {
+	d, _ := time.ParseDuration(s.SlowQuery)
+	return d
+}
+
+type UIConfig struct {
+	DefaultLanguage string `yaml:"default_language"` // locale code, e.g. "en", "el"
+}
+
+type NotifyConfig struct {
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+// ClusterConfig enables certificate replication between NGM nodes (empty peers = standalone).
+type ClusterConfig struct {
+	NodeName string        `yaml:"node_name"`
+	Secret   string        `yaml:"secret"` // shared by all nodes; encrypts agent traffic
+	Peers    []ClusterPeer `yaml:"peers"`
+	LockTTL  string        `yaml:"lock_ttl"` // max time a node may hold a domain issuance lock
+
+	// Standby makes this node a warm standby of a peer (see StandbyConfig).
+	Standby StandbyConfig `yaml:"standby"`
+}
+
+// StandbyConfig: a standby node periodically pulls the primary's database snapshot
+// and generated configs over the agent API, ready for `ngm standby promote`.
+type StandbyConfig struct {
+	Primary  string `yaml:"primary"`  // peer name to follow ("" = not a standby)
+	Interval string `yaml:"interval"` // time between pulls
+	Dir      string `yaml:"dir"`      // where the latest snapshot is kept
+}
+
+// HealthConfig controls the periodic site checks run by `ngm serve`.
+type HealthConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Interval      string `yaml:"interval"`       // time between check rounds
+	Timeout       string `yaml:"timeout"`        // per-request timeout
+	Path          string `yaml:"path"`           // request path checked on every site
+	Connect       string `yaml:"connect"`        // address checks connect to (SNI/Host = site domain)
+	RetentionDays int    `yaml:"retention_days"` // check history kept in the database
+	Location      string `yaml:"location"`       // name recorded for checks made by this node
+	FailThreshold int    `yaml:"fail_threshold"` // consecutive failures that open an incident
+
+	// State-change notifications (incident opened/resolved).
+	Webhooks     []string `yaml:"webhooks"`      // URLs that receive a JSON POST
+	NotifyEmails []string `yaml:"notify_emails"` // recipients (needs notify.smtp)
+
+	// ReportSecret lets external check locations submit results
+	// (Authorization: Bearer <secret>); empty disables the report endpoint.
+	ReportSecret string `yaml:"report_secret"`
+
+	// Backend is where proxy sites expose the health endpoint of their backend.
+	Backend BackendHealthConfig `yaml:"backend"`
+}
+
+// BackendHealthConfig is the internal location a proxy site with a backend health
+// path (`ngm site health`) answers it on: Location is proxied to that path on the
+// backend, for the Allow addresses only (the checks of this node connect from
+// health.connect; add external monitoring here).
+type BackendHealthConfig struct {
+	Location string   `yaml:"location"`
+	Allow    []string `yaml:"allow"` // IPs / CIDRs
+}
+
+// StatusConfig is the public status page (served at /status, or at / on Domain).
+type StatusConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Title       string   `yaml:"title"`
+	Domain      string   `yaml:"domain"`       // optional dedicated status host name
+	Sites       []string `yaml:"sites"`        // domains to list; empty = all enabled sites
+	HistoryDays int      `yaml:"history_days"` // days of history bars on the page
+}
+
+// TLSScanConfig controls the periodic TLS grade scan of every enabled site.
+type TLSScanConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval string `yaml:"interval"`
+	Connect  string `yaml:"connect"` // address scanned (SNI = site domain); empty = the domain itself
+}
+
+// SupervisorConfig watches the nginx master from `ngm serve` (control follows nginx.apply.reload_mode).
+type SupervisorConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Interval    string `yaml:"interval"`     // time between liveness checks
+	Service     string `yaml:"service"`      // systemd unit (reload_mode: systemd)
+	PIDFile     string `yaml:"pid_file"`     // master pid file (reload_mode: signal); relative to nginx.root
+	AutoRestart bool   `yaml:"auto_restart"` // start nginx again when it is found down
+	BackoffMax  string `yaml:"backoff_max"`  // longest wait between failed restart attempts
+}
+
+// ExpiryConfig controls the site expiry sweep run by `ngm serve`: sites past their
+// expiry date are disabled, after a warning notify_before ahead.
+type ExpiryConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Interval     string   `yaml:"interval"`      // time between sweeps
+	NotifyBefore string   `yaml:"notify_before"` // how long before expiry the warning goes out
+	Webhooks     []string `yaml:"webhooks"`      // URLs that receive a JSON POST
+	NotifyEmails []string `yaml:"notify_emails"` // admin recipients, besides each site's own contact
+}
+
+// SaturationConfig controls the connection/worker saturation alerts of `ngm serve`:
+// utilization is sampled from stub_status and the workers' CPU time, and an alert goes
+// out when it stays above a threshold for sustain.
+type SaturationConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Interval     string   `yaml:"interval"`      // time between samples
+	StatusListen string   `yaml:"status_listen"` // loopback listener of the stub_status vhost (global snippet)
+	ConnPercent  int      `yaml:"conn_percent"`  // of worker_processes * worker_connections
+	CPUPercent   int      `yaml:"cpu_percent"`   // average worker CPU, of one core each
+	Sustain      string   `yaml:"sustain"`       // how long a threshold must be exceeded before alerting
+	Webhooks     []string `yaml:"webhooks"`      // URLs that receive a JSON POST
+	NotifyEmails []string `yaml:"notify_emails"`
+}
+
+// SnapshotsConfig drives the configuration snapshots of `ngm serve`: on schedule the
+// managed nginx tree (nginx.conf, vhosts, global snippets) is archived under dir and
+// compared with the previous archive; what changed is mailed and posted as JSON.
+type SnapshotsConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Schedule     string   `yaml:"schedule"`      // cron expression (minute hour day month weekday)
+	Dir          string   `yaml:"dir"`           // where the .tar.gz archives go
+	Keep         int      `yaml:"keep"`          // archives kept, oldest removed first
+	Webhooks     []string `yaml:"webhooks"`      // URLs that receive a JSON POST
+	NotifyEmails []string `yaml:"notify_emails"` // recipients of the change summary
+}
+
+// GCConfig drives the garbage collection of `ngm serve` (`ngm gc` by hand): the
+// staged renders, vhost backups and self-signed certificates of domains that no
+// longer have a site are removed once untouched for grace.
+type GCConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Interval string `yaml:"interval"` // time between runs
+	Grace    string `yaml:"grace"`    // how long a leftover is kept after its last change
+}
+
+// GraceDuration parses gc.grace (validated in Problems).
+func (g GCConfig) GraceDuration() time.Duration {
+	d, _ := time.ParseDuration(g.Grace)
+	return d
+}
+
+// WatchdogConfig is how `ngm serve` answers the systemd watchdog (WatchdogSec= in
+// its unit): it stops pinging, so that systemd restarts it, while an external
+// command has been running for longer than max_exec.
+type WatchdogConfig struct {
+	MaxExec string `yaml:"max_exec"`
+}
+
+// MaxExecDuration parses watchdog.max_exec (validated in Problems).
+func (w WatchdogConfig) MaxExecDuration() time.Duration {
+	d, _ := time.ParseDuration(w.MaxExec)
+	return d
+}
+
+// DiscoveryConfig drives proxy sites whose targets come from DNS SRV records or a
+// Consul service (`ngm site discover`): `ngm serve` resolves them every interval and
+// re-applies the site when the membership changes.
+type DiscoveryConfig struct {
+	Interval string       `yaml:"interval"` // time between lookups
+	Consul   ConsulConfig `yaml:"consul"`
+}
+
+// DNSConfig lists the zones whose records ngm manages through their DNS provider:
+// DNS-01 challenges of their domains and the A/AAAA records of new sites.
+type DNSConfig struct {
+	KeyFile   string          `yaml:"key_file"`  // key of the enc: credentials (`ngm dns encrypt`)
+	Addresses []string        `yaml:"addresses"` // public IPs of this server, for the A/AAAA records of new sites
+	Zones     []DNSZoneConfig `yaml:"zones"`
+}
+
+// DNSZoneConfig is one zone and its provider (cloudflare, digitalocean, route53 or
+// rfc2136). Credentials are the provider's keys (see `ngm dns zones`); secret values
+// should be enc: values from `ngm dns encrypt`.
+type DNSZoneConfig struct {
+	Zone        string            `yaml:"zone"`
+	Provider    string            `yaml:"provider"`
+	Credentials map[string]string `yaml:"credentials"`
+	// DNS01 issues the certificates of the zone's domains over DNS-01 through the
+	// provider, with the *.<domain> wildcard (acme-dns delegations take precedence).
+	DNS01       bool   `yaml:"dns01"`
+	TTL         int    `yaml:"ttl"`         // of records ngm creates
+	Propagation string `yaml:"propagation"` // how long the challenge hook waits for the TXT record to resolve
+}
+
+// ConsulConfig is the Consul agent asked for the healthy instances of a service.
+type ConsulConfig struct {
+	Address    string `yaml:"address"` // HTTP API base URL
+	Token      string `yaml:"token"`   // ACL token ("" = none)
+	Datacenter string `yaml:"datacenter"`
+}
+
+// GlobalConfig is rendered into the managed include dir (conf/ngm.d) by `ngm global apply`.
+type GlobalConfig struct {
+	Dir           string            `yaml:"dir"`        // relative to nginx.root
+	CacheRoot     string            `yaml:"cache_root"` // proxy/fastcgi cache zones live here; "" = defined in nginx.conf
+	RateLimits    []RateLimitZone   `yaml:"rate_limits"`
+	RealIP        RealIPConfig      `yaml:"real_ip"`
+	Geo           []GeoMap          `yaml:"geo"`
+	LogFormats    map[string]string `yaml:"log_formats"`    // name -> format string
+	DefaultServer bool              `yaml:"default_server"` // catch-all closing unknown hosts (444)
+}
+
+// RateLimitZone becomes `limit_req_zone <key> zone=<name>:<size> rate=<rate>;`.
+type RateLimitZone struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`  // default $binary_remote_addr
+	Size string `yaml:"size"` // shared memory, default 10m
+	Rate string `yaml:"rate"` // e.g. 10r/s, 60r/m
+}
+
+// RealIPConfig restores the client address behind trusted proxies/CDNs.
+type RealIPConfig struct {
+	Header    string   `yaml:"header"` // e.g. X-Forwarded-For, CF-Connecting-IP
+	From      []string `yaml:"from"`   // trusted proxy addresses / CIDRs
+	Recursive bool     `yaml:"recursive"`
+}
+
+// GeoMap becomes `geo <var> { default <default>; <cidr> <value>; ... }`.
+type GeoMap struct {
+	Var     string            `yaml:"var"` // e.g. $ngm_office
+	Default string            `yaml:"default"`
+	Entries map[string]string `yaml:"entries"` // CIDR -> value
+}
+
+// TimeoutsConfig bounds external commands (Go durations, e.g. "10s", "5m").
+type TimeoutsConfig struct {
+	NginxTest    string `yaml:"nginx_test"`
+	NginxReload  string `yaml:"nginx_reload"`
+	CertbotIssue string `yaml:"certbot_issue"`
+	CertbotRenew string `yaml:"certbot_renew"` // one domain or the whole renew-all run
+	Systemctl    string `yaml:"systemctl"`
+}
+
+// Timeouts is TimeoutsConfig parsed; see TimeoutsConfig.Durations.
+type Timeouts struct {
+	NginxTest    time.Duration
+	NginxReload  time.Duration
+	CertbotIssue time.Duration
+	CertbotRenew time.Duration
+	Systemctl    time.Duration
+}
+
+// Durations parses the configured timeouts (validated in Validate).
+func (t TimeoutsConfig) Durations() Timeouts {
+	d := func(s string) time.Duration {
+		v, _ := time.ParseDuration(s)
+		return v
+	}
+	return Timeouts{
+		NginxTest:    d(t.NginxTest),
+		NginxReload:  d(t.NginxReload),
+		CertbotIssue: d(t.CertbotIssue),
+		CertbotRenew: d(t.CertbotRenew),
+		Systemctl:    d(t.Systemctl),
+	}
+}
+
+type ClusterPeer struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"` // base URL of the peer's NGM listener, e.g. https://10.0.0.2:9601
+}
+
+func seenPeer(peers []ClusterPeer, name string) bool {
+	for _, p := range peers {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"` // empty = mail disabled
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	TLS      string `yaml:"tls"` // "starttls" (default), "tls" or "none"
 }
 
 func Load(path string) (*Config, error) {
+	cfg, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read parses config.yaml and applies defaults without validating it.
+func Read(path string) (*Config, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("read config %q: %w", path, err)
@@ -89,7 +682,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	cfg.applyDefaults()
-	if err := cfg.Validate(); err != nil {
+	if cfg.Path, err = filepath.Abs(path); err != nil {
 		return nil, err
 	}
 	return &cfg, nil
@@ -100,6 +693,50 @@ func (c *Config) applyDefaults() {
 	if c.API.Listen == "" {
 		c.API.Listen = "127.0.0.1:9601"
 	}
+	if c.API.Limits.MaxBodyMB == 0 {
+		c.API.Limits.MaxBodyMB = 1
+	}
+	if c.API.Limits.MaxUploadMB == 0 {
+		c.API.Limits.MaxUploadMB = 512
+	}
+	if c.API.Limits.MaxHeaderKB == 0 {
+		c.API.Limits.MaxHeaderKB = 64
+	}
+	if c.API.Limits.ReadHeaderTimeout == "" {
+		c.API.Limits.ReadHeaderTimeout = "10s"
+	}
+	if c.API.Limits.ReadTimeout == "" {
+		c.API.Limits.ReadTimeout = "60s"
+	}
+	if c.API.Limits.WriteTimeout == "" {
+		c.API.Limits.WriteTimeout = "10m"
+	}
+	if c.API.Limits.IdleTimeout == "" {
+		c.API.Limits.IdleTimeout = "120s"
+	}
+	if c.API.Limits.UploadTimeout == "" {
+		c.API.Limits.UploadTimeout = "30m"
+	}
+	if rl := &c.API.RateLimit; rl.Enabled {
+		if rl.PerIP == 0 {
+			rl.PerIP = 5
+		}
+		if rl.PerIPBurst == 0 {
+			rl.PerIPBurst = 20
+		}
+		if rl.PerToken == 0 {
+			rl.PerToken = 10
+		}
+		if rl.PerTokenBurst == 0 {
+			rl.PerTokenBurst = 40
+		}
+		if rl.LoginPerMinute == 0 {
+			rl.LoginPerMinute = 6
+		}
+		if rl.LoginBurst == 0 {
+			rl.LoginBurst = 5
+		}
+	}
 
 	// Nginx
 	if c.Nginx.MainConf == "" {
@@ -111,12 +748,18 @@ func (c *Config) applyDefaults() {
 	if c.Nginx.Bin == "" {
 		c.Nginx.Bin = "sbin/nginx"
 	}
+	if c.Nginx.ErrorLog == "" {
+		c.Nginx.ErrorLog = "logs/error.log"
+	}
 	if c.Nginx.Apply.StagingDir == "" {
 		c.Nginx.Apply.StagingDir = "conf/.staging"
 	}
 	if c.Nginx.Apply.BackupDir == "" {
 		c.Nginx.Apply.BackupDir = "conf/.backup"
 	}
+	if c.Nginx.Apply.BackupKeep <= 0 {
+		c.Nginx.Apply.BackupKeep = 10
+	}
 	// default true
 	if !c.Nginx.Apply.TestBeforeReload {
 		c.Nginx.Apply.TestBeforeReload = true
@@ -124,6 +767,9 @@ func (c *Config) applyDefaults() {
 	if c.Nginx.Apply.ReloadMode == "" {
 		c.Nginx.Apply.ReloadMode = "signal"
 	}
+	if c.Nginx.Apply.BatchSize == 0 {
+		c.Nginx.Apply.BatchSize = 500
+	}
 
 	// Certs
 	if c.Certs.Mode == "" {
@@ -132,6 +778,18 @@ func (c *Config) applyDefaults() {
 	if c.Certs.CertbotBin == "" {
 		c.Certs.CertbotBin = "certbot"
 	}
+	if c.Certs.CA == "" {
+		c.Certs.CA = "letsencrypt"
+	}
+	if c.Certs.Fallback.AfterFailures == 0 {
+		c.Certs.Fallback.AfterFailures = 3
+	}
+	if c.Certs.Fallback.WithinDays == 0 {
+		c.Certs.Fallback.WithinDays = 14
+	}
+	if c.Certs.SelfSignedDays == 0 {
+		c.Certs.SelfSignedDays = 7
+	}
 
 	// PHP-FPM
 	if c.PHPFPM.DefaultVersion == "" {
@@ -151,15 +809,258 @@ func (c *Config) applyDefaults() {
 	if c.Hosting.WebGroup == "" {
 		c.Hosting.WebGroup = "www-data"
 	}
+	if c.Hosting.Placeholder.Interval == "" {
+		c.Hosting.Placeholder.Interval = "1m"
+	}
+	if c.Hosting.Retired.Interval == "" {
+		c.Hosting.Retired.Interval = "1m"
+	}
+	if c.Hosting.SFTP.JailRoot == "" {
+		c.Hosting.SFTP.JailRoot = "/srv/sftp"
+	}
+	if c.Hosting.SFTP.Group == "" {
+		c.Hosting.SFTP.Group = "ngm-sftp"
+	}
+	if c.Hosting.SFTP.SSHDConfig == "" {
+		c.Hosting.SFTP.SSHDConfig = "/etc/ssh/sshd_config.d/ngm-sftp.conf"
+	}
+	if c.Hosting.SFTP.SSHDService == "" {
+		c.Hosting.SFTP.SSHDService = "ssh"
+	}
+	if c.Hosting.UpstreamKeepalive.Connections == 0 {
+		c.Hosting.UpstreamKeepalive.Connections = 32
+	}
+	if c.Hosting.UpstreamKeepalive.Requests == 0 {
+		c.Hosting.UpstreamKeepalive.Requests = 1000
+	}
+	if c.Hosting.UpstreamKeepalive.Timeout == "" {
+		c.Hosting.UpstreamKeepalive.Timeout = "60s"
+	}
 
 	// Storage
 	if c.Storage.SQLitePath == "" {
 		c.Storage.SQLitePath = "/var/lib/ngm/ngm.db"
 	}
+	if c.Storage.SlowQuery == "" {
+		c.Storage.SlowQuery = "250ms"
+	}
 	// Security
 	if c.Security.AuditLog == "" {
 		c.Security.AuditLog = "/var/log/ngm/audit.log"
 	}
+	if c.Security.PasswordPolicy.MinLength == 0 {
+		c.Security.PasswordPolicy.MinLength = 10
+	}
+	if c.Security.Syslog.Network == "" {
+		c.Security.Syslog.Network = "udp"
+	}
+	if c.Security.Syslog.Facility == "" {
+		c.Security.Syslog.Facility = "auth"
+	}
+	if c.Security.Syslog.AppName == "" {
+		c.Security.Syslog.AppName = "ngm"
+	}
+	if c.Security.Syslog.AccessFacility == "" {
+		c.Security.Syslog.AccessFacility = "local7"
+	}
+	if c.Security.ResetTokenTTL == "" {
+		c.Security.ResetTokenTTL = "1h"
+	}
+	if c.Security.Session.TTL == "" {
+		c.Security.Session.TTL = "12h"
+	}
+	if c.Security.Session.IdleTimeout == "" {
+		c.Security.Session.IdleTimeout = "1h"
+	}
+	if c.Security.Session.Reauth == "" {
+		c.Security.Session.Reauth = "10m"
+	}
+	if c.Security.Approvals.Expire == "" {
+		c.Security.Approvals.Expire = "24h"
+	}
+
+	// UI
+	if c.UI.DefaultLanguage == "" {
+		c.UI.DefaultLanguage = "en"
+	}
+
+	// Cluster
+	if c.Cluster.LockTTL == "" {
+		c.Cluster.LockTTL = "5m"
+	}
+	if c.Cluster.Standby.Interval == "" {
+		c.Cluster.Standby.Interval = "5m"
+	}
+	if c.Cluster.Standby.Dir == "" {
+		c.Cluster.Standby.Dir = "/var/lib/ngm/standby"
+	}
+
+	// Health / status page
+	if c.Health.Interval == "" {
+		c.Health.Interval = "60s"
+	}
+	if c.Health.Timeout == "" {
+		c.Health.Timeout = "10s"
+	}
+	if c.Health.Path == "" {
+		c.Health.Path = "/"
+	}
+	if c.Health.Connect == "" {
+		c.Health.Connect = "127.0.0.1:443"
+	}
+	if c.Health.RetentionDays == 0 {
+		c.Health.RetentionDays = 90
+	}
+	if c.Health.Location == "" {
+		c.Health.Location = "local"
+	}
+	if c.Health.FailThreshold == 0 {
+		c.Health.FailThreshold = 2
+	}
+	if c.Health.Backend.Location == "" {
+		c.Health.Backend.Location = "/.ngm/backend-health"
+	}
+	if len(c.Health.Backend.Allow) == 0 {
+		c.Health.Backend.Allow = []string{"127.0.0.1", "::1"}
+	}
+	if c.Status.Title == "" {
+		c.Status.Title = "Service status"
+	}
+	if c.Status.HistoryDays == 0 {
+		c.Status.HistoryDays = 30
+	}
+
+	// TLS scan
+	if c.TLSScan.Interval == "" {
+		c.TLSScan.Interval = "24h"
+	}
+	if c.TLSScan.Connect == "" {
+		c.TLSScan.Connect = "127.0.0.1:443"
+	}
+
+	// Supervisor
+	if c.Supervisor.Interval == "" {
+		c.Supervisor.Interval = "15s"
+	}
+	if c.Supervisor.Service == "" {
+		c.Supervisor.Service = "nginx"
+	}
+	if c.Supervisor.PIDFile == "" {
+		c.Supervisor.PIDFile = "logs/nginx.pid"
+	}
+	if c.Supervisor.BackoffMax == "" {
+		c.Supervisor.BackoffMax = "5m"
+	}
+
+	// Site expiry
+	if c.Expiry.Interval == "" {
+		c.Expiry.Interval = "1h"
+	}
+	if c.Expiry.NotifyBefore == "" {
+		c.Expiry.NotifyBefore = "72h"
+	}
+
+	// Saturation alerts
+	if c.Saturation.Interval == "" {
+		c.Saturation.Interval = "30s"
+	}
+	if c.Saturation.StatusListen == "" {
+		c.Saturation.StatusListen = "127.0.0.1:8089"
+	}
+	if c.Saturation.ConnPercent == 0 {
+		c.Saturation.ConnPercent = 80
+	}
+	if c.Saturation.CPUPercent == 0 {
+		c.Saturation.CPUPercent = 85
+	}
+	if c.Saturation.Sustain == "" {
+		c.Saturation.Sustain = "5m"
+	}
+
+	// Configuration snapshots
+	if c.Snapshots.Schedule == "" {
+		c.Snapshots.Schedule = "0 3 * * *"
+	}
+	if c.Snapshots.Dir == "" {
+		c.Snapshots.Dir = "/var/lib/ngm/snapshots"
+	}
+	if c.Snapshots.Keep == 0 {
+		c.Snapshots.Keep = 30
+	}
+
+	// Garbage collection
+	if c.GC.Interval == "" {
+		c.GC.Interval = "24h"
+	}
+	if c.GC.Grace == "" {
+		c.GC.Grace = "720h"
+	}
+
+	// systemd watchdog
+	if c.Watchdog.MaxExec == "" {
+		c.Watchdog.MaxExec = "15m"
+	}
+
+	// Upstream discovery
+	if c.Discovery.Interval == "" {
+		c.Discovery.Interval = "30s"
+	}
+	if c.Discovery.Consul.Address == "" {
+		c.Discovery.Consul.Address = "http://127.0.0.1:8500"
+	}
+
+	// DNS providers
+	if c.DNS.KeyFile == "" {
+		c.DNS.KeyFile = filepath.Join(filepath.Dir(c.Storage.SQLitePath), "dns.key")
+	}
+	for i := range c.DNS.Zones {
+		z := &c.DNS.Zones[i]
+		z.Zone = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(z.Zone)), ".")
+		if z.TTL == 0 {
+			z.TTL = 300
+		}
+		if z.Propagation == "" {
+			z.Propagation = "2m"
+		}
+	}
+
+	// Global include dir
+	if c.Global.Dir == "" {
+		c.Global.Dir = "conf/ngm.d"
+	}
+	for i := range c.Global.RateLimits {
+		if c.Global.RateLimits[i].Key == "" {
+			c.Global.RateLimits[i].Key = "$binary_remote_addr"
+		}
+		if c.Global.RateLimits[i].Size == "" {
+			c.Global.RateLimits[i].Size = "10m"
+		}
+	}
+
+	// Timeouts
+	if c.Timeouts.NginxTest == "" {
+		c.Timeouts.NginxTest = "10s"
+	}
+	if c.Timeouts.NginxReload == "" {
+		c.Timeouts.NginxReload = "10s"
+	}
+	if c.Timeouts.CertbotIssue == "" {
+		c.Timeouts.CertbotIssue = "2m"
+	}
+	if c.Timeouts.CertbotRenew == "" {
+		c.Timeouts.CertbotRenew = "5m"
+	}
+	if c.Timeouts.Systemctl == "" {
+		c.Timeouts.Systemctl = "15s"
+	}
+
+	// Notify
+	if c.Notify.SMTP.Port == 0 {
+		c.Notify.SMTP.Port = 587
+	}
+	if c.Notify.SMTP.TLS == "" {
+		c.Notify.SMTP.TLS = "starttls"
+	}
 }
 
 
@@ -168,8 +1069,17 @@ func (c *Config) applyDefaults() {
 
 
 
-//validate
+// Validate reports every problem found by Problems as one error.
 func (c *Config) Validate() error {
+        if errs := c.Problems(); len(errs) > 0 {
+                return fmt.Errorf("config validation failed:\n- %s", strings.Join(errs, "\n- "))
+        }
+        return nil
+}
+
+// Problems lists what is wrong with the config (missing keys, bad values); it
+// does not look at the system (see `ngm config validate` for that).
+func (c *Config) Problems() []string {
         var errs []string
 
         // Nginx basics
@@ -177,10 +1087,16 @@ func (c *Config) Validate() error {
                 errs = append(errs, "nginx.root is required (e.g. /opt/nginx)")
         }
 
-        // API auth basics
-        if len(c.API.Tokens) == 0 {
-                errs = append(errs, "api.tokens must contain at least one token")
+        if b := c.Nginx.Apply.BatchSize; b < 1 || b > MaxApplyBatch {
+                errs = append(errs, fmt.Sprintf("nginx.apply.batch_size=%d must be between 1 and %d", b, MaxApplyBatch))
+        }
+        if tb := c.Nginx.Apply.TimeBudget; tb != "" {
+                if d, err := time.ParseDuration(tb); err != nil || d < 0 {
+                        errs = append(errs, fmt.Sprintf("nginx.apply.time_budget=%q invalid duration", tb))
+                }
         }
+
+        // API auth basics (api.tokens is optional and only imported: tokens live in the database, see `ngm token`)
         for i, t := range c.API.Tokens {
                 if strings.TrimSpace(t) == "" {
                         errs = append(errs, fmt.Sprintf("api.tokens[%d] is empty", i))
@@ -197,6 +1113,18 @@ func (c *Config) Validate() error {
                         errs = append(errs, fmt.Sprintf("api.allow_ips[%d]=%q invalid CIDR: %v", i, cidr, err))
                 }
         }
+        for i, cidr := range c.API.TrustedProxies {
+                if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+                        errs = append(errs, fmt.Sprintf("api.trusted_proxies[%d]=%q invalid CIDR: %v", i, cidr, err))
+                }
+        }
+        if ml := strings.TrimSpace(c.API.MetricsListen); ml != "" {
+                if _, _, err := net.SplitHostPort(ml); err != nil {
+                        errs = append(errs, fmt.Sprintf("api.metrics_listen=%q must be host:port: %v", ml, err))
+                } else if ml == c.API.Listen {
+                        errs = append(errs, "api.metrics_listen must differ from api.listen (leave it empty to serve /metrics there)")
+                }
+        }
 
         // Certs
         if c.Certs.Mode != "" && c.Certs.Mode != "certbot" {
@@ -208,6 +1136,61 @@ func (c *Config) Validate() error {
         if strings.TrimSpace(c.Certs.LetsEncryptLive) == "" {
                 errs = append(errs, "certs.letsencrypt_live is required (e.g. /etc/letsencrypt/live)")
         }
+        if c.Certs.SelfSignedDays < 1 || c.Certs.SelfSignedDays > 825 {
+                errs = append(errs, fmt.Sprintf("certs.self_signed_days=%d must be between 1 and 825", c.Certs.SelfSignedDays))
+        }
+        if v := c.Certs.AcmeDNS.Server; v != "" {
+                if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                        errs = append(errs, fmt.Sprintf("certs.acme_dns.server=%q must be an absolute http(s) URL", v))
+                }
+        }
+        if _, ok := c.Certs.ACMECA(""); !ok {
+                errs = append(errs, fmt.Sprintf("certs.ca=%q is neither a built-in CA nor defined in certs.cas", c.Certs.CA))
+        }
+        for name, ca := range c.Certs.CAs {
+                if ca.Directory != "" {
+                        if u, err := url.Parse(ca.Directory); err != nil || u.Scheme != "https" || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("certs.cas.%s.directory=%q must be an absolute https URL", name, ca.Directory))
+                        }
+                } else if _, ok := BuiltinACMECAs[name]; !ok {
+                        errs = append(errs, fmt.Sprintf("certs.cas.%s.directory is required", name))
+                }
+                if (ca.EABKID == "") != (ca.EABHMACKey == "") {
+                        errs = append(errs, fmt.Sprintf("certs.cas.%s: eab_kid and eab_hmac_key go together", name))
+                }
+        }
+        if zs := c.Certs.CAs["zerossl"]; c.Certs.CA == "zerossl" && zs.EABKID == "" {
+                errs = append(errs, "certs.ca=zerossl needs certs.cas.zerossl.eab_kid/eab_hmac_key (ZeroSSL dashboard > Developer)")
+        }
+        if fb := c.Certs.Fallback; fb.CA != "" {
+                if _, ok := c.Certs.ACMECA(fb.CA); !ok {
+                        errs = append(errs, fmt.Sprintf("certs.fallback.ca=%q is neither a built-in CA nor defined in certs.cas", fb.CA))
+                } else if fb.CA == c.Certs.CA {
+                        errs = append(errs, fmt.Sprintf("certs.fallback.ca=%q must differ from certs.ca", fb.CA))
+                }
+                if fb.CA == "zerossl" && c.Certs.CAs["zerossl"].EABKID == "" {
+                        errs = append(errs, "certs.fallback.ca=zerossl needs certs.cas.zerossl.eab_kid/eab_hmac_key")
+                }
+                if fb.AfterFailures < 1 {
+                        errs = append(errs, fmt.Sprintf("certs.fallback.after_failures=%d must be at least 1", fb.AfterFailures))
+                }
+                if fb.WithinDays < 1 || fb.WithinDays > 30 {
+                        errs = append(errs, fmt.Sprintf("certs.fallback.within_days=%d must be 1..30 (certbot renews from 30 days before expiry)", fb.WithinDays))
+                }
+                for i, h := range fb.Webhooks {
+                        if u, err := url.Parse(h); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("certs.fallback.webhooks[%d]=%q must be an absolute http(s) URL", i, h))
+                        }
+                }
+                if len(fb.NotifyEmails) > 0 && strings.TrimSpace(c.Notify.SMTP.Host) == "" {
+                        errs = append(errs, "certs.fallback.notify_emails requires notify.smtp.host")
+                }
+        }
+        for _, v := range c.Certs.AcmeDNS.AllowFrom {
+                if !validCIDROrIP(v) {
+                        errs = append(errs, fmt.Sprintf("certs.acme_dns.allow_from: %q is not an IP or CIDR", v))
+                }
+        }
 
         // PHP versions map (optional, but if present must be consistent)
         if c.PHPFPM.DefaultVersion != "" {
@@ -227,10 +1210,444 @@ func (c *Config) Validate() error {
                 }
         }
 
-        if len(errs) > 0 {
-                return fmt.Errorf("config validation failed:\n- %s", strings.Join(errs, "\n- "))
+        // Security
+        if c.Security.PasswordPolicy.MinLength < 1 {
+                errs = append(errs, "security.password_policy.min_length must be >= 1")
         }
-        return nil
+        if sl := c.Security.Syslog; sl.Enabled {
+                if sl.Network != "udp" && sl.Network != "tcp" {
+                        errs = append(errs, fmt.Sprintf("security.syslog.network=%q must be udp or tcp", sl.Network))
+                }
+                if _, _, err := net.SplitHostPort(sl.Address); err != nil {
+                        errs = append(errs, fmt.Sprintf("security.syslog.address=%q must be host:port", sl.Address))
+                }
+                if !syslog.ValidFacility(sl.Facility) {
+                        errs = append(errs, fmt.Sprintf("security.syslog.facility=%q is not a syslog facility", sl.Facility))
+                }
+        }
+        if !syslog.ValidFacility(c.Security.Syslog.AccessFacility) {
+                errs = append(errs, fmt.Sprintf("security.syslog.access_facility=%q is not a syslog facility", c.Security.Syslog.AccessFacility))
+        }
+        if d, err := time.ParseDuration(c.Storage.SlowQuery); err != nil || d < 0 {
+                errs = append(errs, fmt.Sprintf("storage.slow_query=%q must be a duration (0 = off)", c.Storage.SlowQuery))
+        }
+        if d, err := time.ParseDuration(c.Security.ResetTokenTTL); err != nil || d <= 0 {
+                errs = append(errs, fmt.Sprintf("security.reset_token_ttl=%q invalid duration", c.Security.ResetTokenTTL))
+        }
+        sc := c.Security.Session
+        if d, err := time.ParseDuration(sc.TTL); err != nil || d <= 0 {
+                errs = append(errs, fmt.Sprintf("security.session.ttl=%q invalid duration", sc.TTL))
+        }
+        if d, err := time.ParseDuration(sc.IdleTimeout); err != nil || d < 0 {
+                errs = append(errs, fmt.Sprintf("security.session.idle_timeout=%q must be a duration (0 = off)", sc.IdleTimeout))
+        }
+        if d, err := time.ParseDuration(sc.Reauth); err != nil || d < 0 {
+                errs = append(errs, fmt.Sprintf("security.session.reauth=%q must be a duration (0 = off)", sc.Reauth))
+        }
+        if sc.MaxPerUser < 0 {
+                errs = append(errs, fmt.Sprintf("security.session.max_per_user=%d must be >= 0 (0 = unlimited)", sc.MaxPerUser))
+        }
+        if d, err := time.ParseDuration(c.Security.Approvals.Expire); err != nil || d <= 0 {
+                errs = append(errs, fmt.Sprintf("security.approvals.expire=%q invalid duration", c.Security.Approvals.Expire))
+        }
+        lim := c.API.Limits
+        if lim.MaxBodyMB < 1 || lim.MaxUploadMB < lim.MaxBodyMB {
+                errs = append(errs, fmt.Sprintf("api.limits: max_body_mb=%d must be >= 1 and max_upload_mb=%d >= max_body_mb", lim.MaxBodyMB, lim.MaxUploadMB))
+        }
+        if rl := c.API.RateLimit; rl.Enabled {
+                if rl.PerIP <= 0 || rl.PerToken <= 0 || rl.LoginPerMinute <= 0 {
+                        errs = append(errs, "api.rate_limit: per_ip, per_token and login_per_minute must be > 0")
+                }
+                if rl.PerIPBurst < 1 || rl.PerTokenBurst < 1 || rl.LoginBurst < 1 {
+                        errs = append(errs, "api.rate_limit: per_ip_burst, per_token_burst and login_burst must be >= 1")
+                }
+        }
+        if lim.MaxHeaderKB < 4 {
+                errs = append(errs, fmt.Sprintf("api.limits.max_header_kb=%d must be >= 4", lim.MaxHeaderKB))
+        }
+        for _, t := range []struct{ key, val string }{
+                {"read_header_timeout", lim.ReadHeaderTimeout},
+                {"read_timeout", lim.ReadTimeout},
+                {"write_timeout", lim.WriteTimeout},
+                {"idle_timeout", lim.IdleTimeout},
+                {"upload_timeout", lim.UploadTimeout},
+        } {
+                if d, err := time.ParseDuration(t.val); err != nil || d <= 0 {
+                        errs = append(errs, fmt.Sprintf("api.limits.%s=%q must be a positive duration (e.g. 30s)", t.key, t.val))
+                }
+        }
+        if c.API.PublicURL != "" {
+                if u, err := url.Parse(c.API.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                        errs = append(errs, fmt.Sprintf("api.public_url=%q must be an absolute http(s) URL", c.API.PublicURL))
+                }
+        }
+
+        // Notify (SMTP is optional; when enabled it needs a sender)
+        if strings.TrimSpace(c.Notify.SMTP.Host) != "" {
+                if strings.TrimSpace(c.Notify.SMTP.From) == "" {
+                        errs = append(errs, "notify.smtp.from is required when notify.smtp.host is set")
+                }
+                switch c.Notify.SMTP.TLS {
+                case "starttls", "tls", "none":
+                default:
+                        errs = append(errs, fmt.Sprintf("notify.smtp.tls=%q must be starttls, tls or none", c.Notify.SMTP.TLS))
+                }
+        }
+
+        // Cluster (only validated when peers are configured)
+        if len(c.Cluster.Peers) > 0 {
+                if strings.TrimSpace(c.Cluster.NodeName) == "" {
+                        errs = append(errs, "cluster.node_name is required when cluster.peers is set")
+                }
+                if len(c.Cluster.Secret) < 32 {
+                        errs = append(errs, "cluster.secret must be at least 32 characters")
+                }
+                if d, err := time.ParseDuration(c.Cluster.LockTTL); err != nil || d <= 0 {
+                        errs = append(errs, fmt.Sprintf("cluster.lock_ttl=%q invalid duration", c.Cluster.LockTTL))
+                }
+                seen := map[string]bool{c.Cluster.NodeName: true}
+                for i, p := range c.Cluster.Peers {
+                        if strings.TrimSpace(p.Name) == "" || seen[p.Name] {
+                                errs = append(errs, fmt.Sprintf("cluster.peers[%d].name must be set and unique", i))
+                        }
+                        seen[p.Name] = true
+                        if u, err := url.Parse(p.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("cluster.peers[%d].url=%q must be an absolute http(s) URL", i, p.URL))
+                        }
+                }
+        }
+        if sb := c.Cluster.Standby; sb.Primary != "" {
+                if !seenPeer(c.Cluster.Peers, sb.Primary) {
+                        errs = append(errs, fmt.Sprintf("cluster.standby.primary=%q must name one of cluster.peers", sb.Primary))
+                }
+                if d, err := time.ParseDuration(sb.Interval); err != nil || d < time.Minute {
+                        errs = append(errs, fmt.Sprintf("cluster.standby.interval=%q must be a duration of at least 1m", sb.Interval))
+                }
+                if !filepath.IsAbs(sb.Dir) {
+                        errs = append(errs, fmt.Sprintf("cluster.standby.dir=%q must be an absolute path", sb.Dir))
+                }
+        }
+
+        // Health / status page
+        if c.Health.Enabled {
+                if d, err := time.ParseDuration(c.Health.Interval); err != nil || d <= 0 {
+                        errs = append(errs, fmt.Sprintf("health.interval=%q invalid duration", c.Health.Interval))
+                }
+                if d, err := time.ParseDuration(c.Health.Timeout); err != nil || d <= 0 {
+                        errs = append(errs, fmt.Sprintf("health.timeout=%q invalid duration", c.Health.Timeout))
+                }
+                if !strings.HasPrefix(c.Health.Path, "/") {
+                        errs = append(errs, fmt.Sprintf("health.path=%q must start with /", c.Health.Path))
+                }
+                if _, _, err := net.SplitHostPort(c.Health.Connect); err != nil {
+                        errs = append(errs, fmt.Sprintf("health.connect=%q must be host:port", c.Health.Connect))
+                }
+        }
+        if c.Health.RetentionDays < 1 {
+                errs = append(errs, "health.retention_days must be >= 1")
+        }
+        if c.Health.FailThreshold < 1 {
+                errs = append(errs, "health.fail_threshold must be >= 1")
+        }
+        for i, h := range c.Health.Webhooks {
+                if u, err := url.Parse(h); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                        errs = append(errs, fmt.Sprintf("health.webhooks[%d]=%q must be an absolute http(s) URL", i, h))
+                }
+        }
+        if len(c.Health.NotifyEmails) > 0 && strings.TrimSpace(c.Notify.SMTP.Host) == "" {
+                errs = append(errs, "health.notify_emails requires notify.smtp.host")
+        }
+        if c.Health.ReportSecret != "" && len(c.Health.ReportSecret) < 16 {
+                errs = append(errs, "health.report_secret must be at least 16 characters")
+        }
+        if !nginxLocation.MatchString(c.Health.Backend.Location) {
+                errs = append(errs, fmt.Sprintf("health.backend.location=%q must be a plain path like /.ngm/backend-health", c.Health.Backend.Location))
+        }
+        for i, ip := range c.Health.Backend.Allow {
+                if !validCIDROrIP(strings.TrimSpace(ip)) {
+                        errs = append(errs, fmt.Sprintf("health.backend.allow[%d]=%q must be an IP or CIDR", i, ip))
+                }
+        }
+        if c.Status.Enabled {
+                if !c.Health.Enabled {
+                        errs = append(errs, "status_page.enabled requires health.enabled")
+                }
+                if c.Status.HistoryDays < 1 || c.Status.HistoryDays > c.Health.RetentionDays {
+                        errs = append(errs, fmt.Sprintf("status_page.history_days must be between 1 and health.retention_days (%d)", c.Health.RetentionDays))
+                }
+        }
+
+        // TLS scan
+        if c.TLSScan.Enabled {
+                if d, err := time.ParseDuration(c.TLSScan.Interval); err != nil || d < time.Hour {
+                        errs = append(errs, fmt.Sprintf("tls_scan.interval=%q must be a duration of at least 1h", c.TLSScan.Interval))
+                }
+                if _, _, err := net.SplitHostPort(c.TLSScan.Connect); err != nil {
+                        errs = append(errs, fmt.Sprintf("tls_scan.connect=%q must be host:port", c.TLSScan.Connect))
+                }
+        }
+
+        // Supervisor
+        if c.Supervisor.Enabled {
+                interval, err := time.ParseDuration(c.Supervisor.Interval)
+                if err != nil || interval < time.Second {
+                        errs = append(errs, fmt.Sprintf("supervisor.interval=%q must be a duration of at least 1s", c.Supervisor.Interval))
+                }
+                if d, err := time.ParseDuration(c.Supervisor.BackoffMax); err != nil || d < interval {
+                        errs = append(errs, fmt.Sprintf("supervisor.backoff_max=%q must be a duration no shorter than supervisor.interval", c.Supervisor.BackoffMax))
+                }
+        }
+
+        // Placeholder pages
+        if d, err := time.ParseDuration(c.Hosting.Placeholder.Interval); err != nil || d < 10*time.Second {
+                errs = append(errs, fmt.Sprintf("hosting.placeholder.interval=%q must be a duration of at least 10s", c.Hosting.Placeholder.Interval))
+        }
+        if t := c.Hosting.Placeholder.Template; t != "" {
+                if _, err := os.Stat(t); err != nil {
+                        errs = append(errs, fmt.Sprintf("hosting.placeholder.template=%q: %v", t, err))
+                }
+        }
+
+        // Retired pages (graceful disable)
+        if d, err := time.ParseDuration(c.Hosting.Retired.Interval); err != nil || d < 10*time.Second {
+                errs = append(errs, fmt.Sprintf("hosting.retired.interval=%q must be a duration of at least 10s", c.Hosting.Retired.Interval))
+        }
+        if t := c.Hosting.Retired.Template; t != "" {
+                if _, err := os.Stat(t); err != nil {
+                        errs = append(errs, fmt.Sprintf("hosting.retired.template=%q: %v", t, err))
+                }
+        }
+
+        // Preview hostnames
+        if d := c.Hosting.Preview.Domain; d != "" && (strings.ContainsAny(d, " /:*") || !strings.Contains(d, ".")) {
+                errs = append(errs, fmt.Sprintf("hosting.preview.domain=%q must be a domain name (e.g. preview.panel.example)", d))
+        }
+        for _, ip := range c.Hosting.Preview.Addresses {
+                if net.ParseIP(ip) == nil {
+                        errs = append(errs, fmt.Sprintf("hosting.preview.addresses: %q is not an IP address", ip))
+                }
+        }
+
+        // Upstream keepalive
+        if k := c.Hosting.UpstreamKeepalive; k.Connections < 1 || k.Requests < 1 {
+                errs = append(errs, fmt.Sprintf("hosting.upstream_keepalive: connections (%d) and requests (%d) must be at least 1", k.Connections, k.Requests))
+        }
+        if d, err := time.ParseDuration(c.Hosting.UpstreamKeepalive.Timeout); err != nil || d < time.Second {
+                errs = append(errs, fmt.Sprintf("hosting.upstream_keepalive.timeout=%q must be a duration of at least 1s", c.Hosting.UpstreamKeepalive.Timeout))
+        }
+
+        // SFTP jail
+        if j := c.Hosting.SFTP.JailRoot; !filepath.IsAbs(j) || filepath.Clean(j) == "/" {
+                errs = append(errs, fmt.Sprintf("hosting.sftp.jail_root=%q must be an absolute directory other than /", j))
+        }
+        if g := c.Hosting.SFTP.Group; !sftpGroupRe.MatchString(g) {
+                errs = append(errs, fmt.Sprintf("hosting.sftp.group=%q is not a valid group name", g))
+        }
+        if !filepath.IsAbs(c.Hosting.SFTP.SSHDConfig) {
+                errs = append(errs, fmt.Sprintf("hosting.sftp.sshd_config=%q must be an absolute path", c.Hosting.SFTP.SSHDConfig))
+        }
+
+        // Site expiry
+        if c.Expiry.Enabled {
+                if d, err := time.ParseDuration(c.Expiry.Interval); err != nil || d < time.Minute {
+                        errs = append(errs, fmt.Sprintf("expiry.interval=%q must be a duration of at least 1m", c.Expiry.Interval))
+                }
+                if d, err := time.ParseDuration(c.Expiry.NotifyBefore); err != nil || d < 0 {
+                        errs = append(errs, fmt.Sprintf("expiry.notify_before=%q must be a non-negative duration", c.Expiry.NotifyBefore))
+                }
+                for i, h := range c.Expiry.Webhooks {
+                        if u, err := url.Parse(h); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("expiry.webhooks[%d]=%q must be an absolute http(s) URL", i, h))
+                        }
+                }
+                if len(c.Expiry.NotifyEmails) > 0 && strings.TrimSpace(c.Notify.SMTP.Host) == "" {
+                        errs = append(errs, "expiry.notify_emails requires notify.smtp.host")
+                }
+        }
+
+        // Saturation alerts
+        if c.Saturation.Enabled {
+                interval, err := time.ParseDuration(c.Saturation.Interval)
+                if err != nil || interval < 5*time.Second {
+                        errs = append(errs, fmt.Sprintf("saturation.interval=%q must be a duration of at least 5s", c.Saturation.Interval))
+                }
+                if d, err := time.ParseDuration(c.Saturation.Sustain); err != nil || d < interval {
+                        errs = append(errs, fmt.Sprintf("saturation.sustain=%q must be a duration no shorter than saturation.interval", c.Saturation.Sustain))
+                }
+                if host, port, err := net.SplitHostPort(c.Saturation.StatusListen); err != nil || port == "" {
+                        errs = append(errs, fmt.Sprintf("saturation.status_listen=%q must be host:port", c.Saturation.StatusListen))
+                } else if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+                        errs = append(errs, fmt.Sprintf("saturation.status_listen=%q must be a loopback address", c.Saturation.StatusListen))
+                }
+                if c.Saturation.ConnPercent < 1 || c.Saturation.ConnPercent > 100 {
+                        errs = append(errs, fmt.Sprintf("saturation.conn_percent=%d must be 1..100", c.Saturation.ConnPercent))
+                }
+                if c.Saturation.CPUPercent < 1 || c.Saturation.CPUPercent > 100 {
+                        errs = append(errs, fmt.Sprintf("saturation.cpu_percent=%d must be 1..100", c.Saturation.CPUPercent))
+                }
+                for i, h := range c.Saturation.Webhooks {
+                        if u, err := url.Parse(h); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("saturation.webhooks[%d]=%q must be an absolute http(s) URL", i, h))
+                        }
+                }
+                if len(c.Saturation.NotifyEmails) > 0 && strings.TrimSpace(c.Notify.SMTP.Host) == "" {
+                        errs = append(errs, "saturation.notify_emails requires notify.smtp.host")
+                }
+        }
+
+        // Configuration snapshots (the schedule itself is parsed by `ngm serve`)
+        if c.Snapshots.Enabled {
+                if f := strings.Fields(c.Snapshots.Schedule); len(f) != 5 && !(len(f) == 1 && strings.HasPrefix(f[0], "@")) {
+                        errs = append(errs, fmt.Sprintf("snapshots.schedule=%q must be a cron expression (minute hour day month weekday, or @daily)", c.Snapshots.Schedule))
+                }
+                if c.Snapshots.Keep < 2 {
+                        errs = append(errs, fmt.Sprintf("snapshots.keep=%d must be at least 2 (the newest archive is compared with the one before)", c.Snapshots.Keep))
+                }
+                for i, h := range c.Snapshots.Webhooks {
+                        if u, err := url.Parse(h); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                                errs = append(errs, fmt.Sprintf("snapshots.webhooks[%d]=%q must be an absolute http(s) URL", i, h))
+                        }
+                }
+                if len(c.Snapshots.NotifyEmails) > 0 && strings.TrimSpace(c.Notify.SMTP.Host) == "" {
+                        errs = append(errs, "snapshots.notify_emails requires notify.smtp.host")
+                }
+        }
+
+        // Garbage collection (grace also bounds `ngm gc`)
+        if d, err := time.ParseDuration(c.GC.Grace); err != nil || d < 0 {
+                errs = append(errs, fmt.Sprintf("gc.grace=%q invalid duration", c.GC.Grace))
+        }
+        if c.GC.Enabled {
+                if d, err := time.ParseDuration(c.GC.Interval); err != nil || d < time.Minute {
+                        errs = append(errs, fmt.Sprintf("gc.interval=%q must be a duration of at least 1m", c.GC.Interval))
+                }
+        }
+
+        // systemd watchdog
+        if d, err := time.ParseDuration(c.Watchdog.MaxExec); err != nil || d < time.Minute {
+                errs = append(errs, fmt.Sprintf("watchdog.max_exec=%q must be a duration of at least 1m", c.Watchdog.MaxExec))
+        }
+
+        // Upstream discovery
+        if d, err := time.ParseDuration(c.Discovery.Interval); err != nil || d < 5*time.Second {
+                errs = append(errs, fmt.Sprintf("discovery.interval=%q must be a duration of at least 5s", c.Discovery.Interval))
+        }
+        if u, err := url.Parse(c.Discovery.Consul.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+                errs = append(errs, fmt.Sprintf("discovery.consul.address=%q must be an absolute http(s) URL", c.Discovery.Consul.Address))
+        }
+
+        // DNS providers
+        seenDNS := map[string]bool{}
+        for i, z := range c.DNS.Zones {
+                switch {
+                case z.Zone == "" || !strings.Contains(z.Zone, "."):
+                        errs = append(errs, fmt.Sprintf("dns.zones[%d].zone=%q must be a domain name", i, z.Zone))
+                case seenDNS[z.Zone]:
+                        errs = append(errs, fmt.Sprintf("dns.zones[%d]: zone %s is listed twice", i, z.Zone))
+                }
+                seenDNS[z.Zone] = true
+                switch z.Provider {
+                case "cloudflare", "digitalocean", "route53", "rfc2136":
+                default:
+                        errs = append(errs, fmt.Sprintf("dns.zones[%s].provider=%q unsupported (cloudflare, digitalocean, route53, rfc2136)", z.Zone, z.Provider))
+                }
+                if z.TTL < 30 {
+                        errs = append(errs, fmt.Sprintf("dns.zones[%s].ttl=%d must be at least 30", z.Zone, z.TTL))
+                }
+                if d, err := time.ParseDuration(z.Propagation); err != nil || d < 0 || d > 30*time.Minute {
+                        errs = append(errs, fmt.Sprintf("dns.zones[%s].propagation=%q must be a duration up to 30m", z.Zone, z.Propagation))
+                }
+        }
+        for _, ip := range c.DNS.Addresses {
+                if net.ParseIP(ip) == nil {
+                        errs = append(errs, fmt.Sprintf("dns.addresses: %q is not an IP address", ip))
+                }
+        }
+
+        // Global include dir
+        seenZone := map[string]bool{}
+        for _, z := range c.Global.RateLimits {
+                if !nginxName.MatchString(z.Name) || seenZone[z.Name] {
+                        errs = append(errs, fmt.Sprintf("global.rate_limits: name %q must be a unique identifier", z.Name))
+                }
+                seenZone[z.Name] = true
+                if !nginxRate.MatchString(z.Rate) {
+                        errs = append(errs, fmt.Sprintf("global.rate_limits[%s].rate=%q must look like 10r/s or 60r/m", z.Name, z.Rate))
+                }
+                if !nginxSize.MatchString(z.Size) {
+                        errs = append(errs, fmt.Sprintf("global.rate_limits[%s].size=%q must look like 10m", z.Name, z.Size))
+                }
+                if !strings.HasPrefix(z.Key, "$") || strings.ContainsAny(z.Key, " ;{}") {
+                        errs = append(errs, fmt.Sprintf("global.rate_limits[%s].key=%q must be an nginx variable", z.Name, z.Key))
+                }
+        }
+        if len(c.Global.RealIP.From) > 0 && c.Global.RealIP.Header == "" {
+                errs = append(errs, "global.real_ip.header is required when real_ip.from is set")
+        }
+        if strings.ContainsAny(c.Global.RealIP.Header, " ;{}") {
+                errs = append(errs, fmt.Sprintf("global.real_ip.header=%q is not a valid header name", c.Global.RealIP.Header))
+        }
+        for _, v := range c.Global.RealIP.From {
+                if !validCIDROrIP(v) && v != "unix:" {
+                        errs = append(errs, fmt.Sprintf("global.real_ip.from: %q is not an IP or CIDR", v))
+                }
+        }
+        for _, g := range c.Global.Geo {
+                if !strings.HasPrefix(g.Var, "$") || !nginxName.MatchString(g.Var[1:]) {
+                        errs = append(errs, fmt.Sprintf("global.geo: var %q must look like $name", g.Var))
+                }
+                for k, v := range g.Entries {
+                        if !validCIDROrIP(k) {
+                                errs = append(errs, fmt.Sprintf("global.geo[%s]: %q is not an IP or CIDR", g.Var, k))
+                        }
+                        if strings.ContainsAny(v, " ;{}\"") {
+                                errs = append(errs, fmt.Sprintf("global.geo[%s]: value %q must be a single word", g.Var, v))
+                        }
+                }
+                if strings.ContainsAny(g.Default, " ;{}\"") {
+                        errs = append(errs, fmt.Sprintf("global.geo[%s]: default %q must be a single word", g.Var, g.Default))
+                }
+        }
+        for name, f := range c.Global.LogFormats {
+                if !nginxName.MatchString(name) || name == "combined" {
+                        errs = append(errs, fmt.Sprintf("global.log_formats: name %q must be an identifier other than combined", name))
+                }
+                if strings.Contains(f, "'") || strings.TrimSpace(f) == "" {
+                        errs = append(errs, fmt.Sprintf("global.log_formats[%s] must be non-empty and not contain single quotes", name))
+                }
+        }
+
+        // Timeouts
+        for _, t := range []struct{ key, val string }{
+                {"nginx_test", c.Timeouts.NginxTest},
+                {"nginx_reload", c.Timeouts.NginxReload},
+                {"certbot_issue", c.Timeouts.CertbotIssue},
+                {"certbot_renew", c.Timeouts.CertbotRenew},
+                {"systemctl", c.Timeouts.Systemctl},
+        } {
+                if d, err := time.ParseDuration(t.val); err != nil || d <= 0 {
+                        errs = append(errs, fmt.Sprintf("timeouts.%s=%q must be a positive duration (e.g. 30s)", t.key, t.val))
+                }
+        }
+
+        return errs
+}
+
+var (
+	nginxName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	nginxRate = regexp.MustCompile(`^[0-9]+r/[sm]$`)
+	nginxSize = regexp.MustCompile(`^[0-9]+[kKmM]?$`)
+	// nginxLocation is a path safe to put in a location / proxy_pass unquoted
+	nginxLocation = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+	sftpGroupRe = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+)
+
+func validCIDROrIP(v string) bool {
+	if _, _, err := net.ParseCIDR(v); err == nil {
+		return true
+	}
+	return net.ParseIP(v) != nil
 }
 
 //validate end
@@ -244,6 +1661,9 @@ type Paths struct {
         NginxSitesDir string
         NginxStageDir string
         NginxBackupDir string
+        NginxPIDFile   string
+        NginxGlobalDir string
+        NginxErrorLog  string
 
         // Certs
         CertbotBin      string
@@ -261,6 +1681,9 @@ func (c *Config) ResolvePaths() Paths {
                 NginxSitesDir:  absOrJoin(root, c.Nginx.SitesDir),
                 NginxStageDir:  absOrJoin(root, c.Nginx.Apply.StagingDir),
                 NginxBackupDir: absOrJoin(root, c.Nginx.Apply.BackupDir),
+                NginxPIDFile:   absOrJoin(root, c.Supervisor.PIDFile),
+                NginxGlobalDir: absOrJoin(root, c.Global.Dir),
+                NginxErrorLog:  absOrJoin(root, c.Nginx.ErrorLog),
 
                 CertbotBin:      c.Certs.CertbotBin, // can be PATH lookup
                 ACMEWebroot:     c.Certs.Webroot,
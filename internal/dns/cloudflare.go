@@ -0,0 +1,134 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflare uses the v4 API with a scoped API token (Zone.DNS edit). The zone id is
+// looked up by name unless configured.
+type cloudflare struct {
+	zone   string
+	token  string
+	mu     sync.Mutex
+	zoneID string
+}
+
+func (c *cloudflare) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+
+	var env struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("cloudflare: %s: %s", res.Status, bytes.TrimSpace(data))
+	}
+	if !env.Success {
+		var msgs []string
+		for _, e := range env.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare: %s: %s", res.Status, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(env.Result, out)
+	}
+	return nil
+}
+
+func (c *cloudflare) id(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.zoneID != "" {
+		return c.zoneID, nil
+	}
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(c.zone), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("cloudflare: zone %s not found for this token", c.zone)
+	}
+	c.zoneID = zones[0].ID
+	return c.zoneID, nil
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+func (c *cloudflare) Records(ctx context.Context, name, typ string) ([]Record, error) {
+	id, err := c.id(ctx)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{"type": {typ}, "name": {name}, "per_page": {"100"}}
+	var list []cloudflareRecord
+	if err := c.do(ctx, http.MethodGet, "/zones/"+id+"/dns_records?"+q.Encode(), nil, &list); err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(list))
+	for _, r := range list {
+		out = append(out, Record{ID: r.ID, Name: r.Name, Type: r.Type, Value: strings.Trim(r.Content, `"`), TTL: r.TTL})
+	}
+	return out, nil
+}
+
+func (c *cloudflare) AddRecord(ctx context.Context, r Record) error {
+	id, err := c.id(ctx)
+	if err != nil {
+		return err
+	}
+	ttl := r.TTL
+	if ttl < 60 {
+		ttl = 1 // automatic
+	}
+	return c.do(ctx, http.MethodPost, "/zones/"+id+"/dns_records", cloudflareRecord{Type: r.Type, Name: r.Name, Content: r.Value, TTL: ttl}, nil)
+}
+
+func (c *cloudflare) DeleteRecord(ctx context.Context, r Record) error {
+	id, err := c.id(ctx)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodDelete, "/zones/"+id+"/dns_records/"+url.PathEscape(r.ID), nil, nil)
+}
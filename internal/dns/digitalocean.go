@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const digitalOceanAPI = "https://api.digitalocean.com/v2"
+
+// digitalOcean uses the v2 domains API with a personal access token (write scope).
+type digitalOcean struct {
+	zone  string
+	token string
+}
+
+func (d *digitalOcean) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, digitalOceanAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("digitalocean: %w", err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Message != "" {
+			return fmt.Errorf("digitalocean: %s: %s", res.Status, e.Message)
+		}
+		return fmt.Errorf("digitalocean: %s", res.Status)
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+type digitalOceanRecord struct {
+	ID   int64  `json:"id,omitempty"`
+	Type string `json:"type"`
+	Name string `json:"name"` // relative to the zone, "@" = apex
+	Data string `json:"data"`
+	TTL  int    `json:"ttl"`
+}
+
+func (d *digitalOcean) Records(ctx context.Context, name, typ string) ([]Record, error) {
+	q := url.Values{"type": {typ}, "name": {name}, "per_page": {"200"}}
+	var page struct {
+		Records []digitalOceanRecord `json:"domain_records"`
+	}
+	if err := d.do(ctx, http.MethodGet, "/domains/"+url.PathEscape(d.zone)+"/records?"+q.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(page.Records))
+	for _, r := range page.Records {
+		out = append(out, Record{ID: strconv.FormatInt(r.ID, 10), Name: name, Type: r.Type, Value: r.Data, TTL: r.TTL})
+	}
+	return out, nil
+}
+
+func (d *digitalOcean) AddRecord(ctx context.Context, r Record) error {
+	ttl := r.TTL
+	if ttl < 30 {
+		ttl = 30
+	}
+	rec := digitalOceanRecord{Type: r.Type, Name: relative(r.Name, d.zone), Data: r.Value, TTL: ttl}
+	return d.do(ctx, http.MethodPost, "/domains/"+url.PathEscape(d.zone)+"/records", rec, nil)
+}
+
+func (d *digitalOcean) DeleteRecord(ctx context.Context, r Record) error {
+	return d.do(ctx, http.MethodDelete, "/domains/"+url.PathEscape(d.zone)+"/records/"+url.PathEscape(r.ID), nil, nil)
+}
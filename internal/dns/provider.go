@@ -0,0 +1,156 @@
+// Package dns talks to the DNS providers of the zones ngm manages records in: TXT
+// records for DNS-01 challenges and the A/AAAA records of new sites.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// Record is one resource record. Name is the fully qualified name without the
+// trailing dot; TXT values are unquoted. ID is the provider's handle (if it has one).
+type Record struct {
+	ID    string
+	Name  string
+	Type  string // "A" | "AAAA" | "TXT"
+	Value string
+	TTL   int
+}
+
+// Provider manages the records of one zone.
+type Provider interface {
+	// Records lists the records of type typ at name.
+	Records(ctx context.Context, name, typ string) ([]Record, error)
+	// AddRecord adds r next to the existing records of its name and type.
+	AddRecord(ctx context.Context, r Record) error
+	// DeleteRecord removes r (as returned by Records).
+	DeleteRecord(ctx context.Context, r Record) error
+}
+
+// Zone is a configured zone: its provider and that provider's credentials (already
+// decrypted), keyed as documented per provider.
+type Zone struct {
+	Name        string
+	Provider    string
+	Credentials map[string]string
+}
+
+// Providers are the supported provider names.
+var Providers = []string{"cloudflare", "digitalocean", "rfc2136", "route53"}
+
+// providerKeys are the credentials each provider needs (optional ones in brackets).
+var providerKeys = map[string][]string{
+	"cloudflare":   {"api_token", "[zone_id]"},
+	"digitalocean": {"token"},
+	"route53":      {"access_key_id", "secret_access_key", "hosted_zone_id"},
+	"rfc2136":      {"server", "key_name", "key_secret", "[key_algorithm]"},
+}
+
+// CredentialKeys returns the credential keys of provider, optional ones in brackets.
+func CredentialKeys(provider string) []string {
+	return providerKeys[provider]
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// New returns the provider of z. run executes nsupdate for rfc2136 zones.
+func New(z Zone, run util.Runner) (Provider, error) {
+	keys, ok := providerKeys[z.Provider]
+	if !ok {
+		return nil, fmt.Errorf("zone %s: unknown provider %q (want %s)", z.Name, z.Provider, strings.Join(Providers, ", "))
+	}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "[") && strings.TrimSpace(z.Credentials[k]) == "" {
+			return nil, fmt.Errorf("zone %s: %s credentials need %s", z.Name, z.Provider, k)
+		}
+	}
+	c := z.Credentials
+	zone := strings.TrimSuffix(strings.ToLower(z.Name), ".")
+	switch z.Provider {
+	case "cloudflare":
+		return &cloudflare{zone: zone, token: c["api_token"], zoneID: c["zone_id"]}, nil
+	case "digitalocean":
+		return &digitalOcean{zone: zone, token: c["token"]}, nil
+	case "route53":
+		return &route53{zone: zone, keyID: c["access_key_id"], secret: c["secret_access_key"], zoneID: strings.TrimPrefix(c["hosted_zone_id"], "/hostedzone/")}, nil
+	default:
+		alg := c["key_algorithm"]
+		if alg == "" {
+			alg = "hmac-sha256"
+		}
+		return &rfc2136{zone: zone, server: c["server"], keyName: c["key_name"], secret: c["key_secret"], alg: alg, run: run}, nil
+	}
+}
+
+// SetRecords makes values the only records of type typ at name, touching just the
+// ones that differ.
+func SetRecords(ctx context.Context, p Provider, name, typ string, values []string, ttl int) error {
+	cur, err := p.Records(ctx, name, typ)
+	if err != nil {
+		return err
+	}
+	want := map[string]bool{}
+	for _, v := range values {
+		want[v] = true
+	}
+	have := map[string]bool{}
+	for _, r := range cur {
+		if want[r.Value] && !have[r.Value] {
+			have[r.Value] = true
+			continue
+		}
+		if err := p.DeleteRecord(ctx, r); err != nil {
+			return fmt.Errorf("delete %s %s %s: %w", name, typ, r.Value, err)
+		}
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	for _, v := range sorted {
+		if have[v] {
+			continue
+		}
+		if err := p.AddRecord(ctx, Record{Name: name, Type: typ, Value: v, TTL: ttl}); err != nil {
+			return fmt.Errorf("add %s %s %s: %w", name, typ, v, err)
+		}
+		have[v] = true
+	}
+	return nil
+}
+
+// RemoveRecord deletes the records of type typ at name that hold value.
+func RemoveRecord(ctx context.Context, p Provider, name, typ, value string) error {
+	cur, err := p.Records(ctx, name, typ)
+	if err != nil {
+		return err
+	}
+	for _, r := range cur {
+		if r.Value != value {
+			continue
+		}
+		if err := p.DeleteRecord(ctx, r); err != nil {
+			return fmt.Errorf("delete %s %s: %w", name, typ, err)
+		}
+	}
+	return nil
+}
+
+// InZone reports whether name is zone or below it.
+func InZone(name, zone string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// relative is name relative to zone ("@" for the apex), as some APIs want it.
+func relative(name, zone string) string {
+	if name == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+zone)
+}
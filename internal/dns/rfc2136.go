@@ -0,0 +1,128 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// rfc2136 sends dynamic updates (RFC 2136) signed with a TSIG key through nsupdate
+// (bind9-dnsutils), and reads records back from the same server. server is
+// host[:port].
+type rfc2136 struct {
+	zone    string
+	server  string
+	keyName string
+	secret  string // base64
+	alg     string // hmac-sha256 | hmac-sha512 | ...
+	run     util.Runner
+}
+
+func (u *rfc2136) addr() string {
+	if _, _, err := net.SplitHostPort(u.server); err == nil {
+		return u.server
+	}
+	return net.JoinHostPort(u.server, "53")
+}
+
+// resolver asks the update server itself, so changes are visible right away.
+func (u *rfc2136) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, u.addr())
+		},
+	}
+}
+
+func (u *rfc2136) Records(ctx context.Context, name, typ string) ([]Record, error) {
+	var values []string
+	switch typ {
+	case "TXT":
+		txt, err := u.resolver().LookupTXT(ctx, name)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("rfc2136: lookup %s TXT: %w", name, err)
+		}
+		values = txt
+	case "A", "AAAA":
+		ips, err := u.resolver().LookupIPAddr(ctx, name)
+		if err != nil && !isNotFound(err) {
+			return nil, fmt.Errorf("rfc2136: lookup %s: %w", name, err)
+		}
+		for _, ip := range ips {
+			if (ip.IP.To4() != nil) == (typ == "A") {
+				values = append(values, ip.IP.String())
+			}
+		}
+	default:
+		return nil, fmt.Errorf("rfc2136: unsupported record type %s", typ)
+	}
+	out := make([]Record, 0, len(values))
+	for _, v := range values {
+		out = append(out, Record{Name: name, Type: typ, Value: v})
+	}
+	return out, nil
+}
+
+func isNotFound(err error) bool {
+	de, ok := err.(*net.DNSError)
+	return ok && de.IsNotFound
+}
+
+func (u *rfc2136) AddRecord(ctx context.Context, r Record) error {
+	ttl := r.TTL
+	if ttl <= 0 {
+		ttl = 300
+	}
+	return u.update(ctx, fmt.Sprintf("update add %s. %d %s %s", r.Name, ttl, r.Type, rdata(r)))
+}
+
+func (u *rfc2136) DeleteRecord(ctx context.Context, r Record) error {
+	return u.update(ctx, fmt.Sprintf("update delete %s. %s %s", r.Name, r.Type, rdata(r)))
+}
+
+func rdata(r Record) string {
+	if r.Type == "TXT" {
+		return strconv.Quote(r.Value)
+	}
+	return r.Value
+}
+
+// update runs one nsupdate transaction. The TSIG key goes through a 0600 key file,
+// not the command line, so it does not show up in the process list.
+func (u *rfc2136) update(ctx context.Context, line string) error {
+	dir, err := os.MkdirTemp("", "ngm-nsupdate-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	host, port, err := net.SplitHostPort(u.addr())
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("key %q {\n\talgorithm %s;\n\tsecret %q;\n};\n", u.keyName, u.alg, u.secret)
+	script := fmt.Sprintf("server %s %s\nzone %s.\n%s\nsend\n", host, port, u.zone, line)
+	keyFile, scriptFile := filepath.Join(dir, "key"), filepath.Join(dir, "update")
+	if err := os.WriteFile(keyFile, []byte(key), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(scriptFile, []byte(script), 0600); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	res, err := u.run.Run(ctx, "nsupdate", "-k", keyFile, scriptFile)
+	if err != nil {
+		return fmt.Errorf("nsupdate: %w: %s", err, strings.TrimSpace(res.Output()))
+	}
+	return nil
+}
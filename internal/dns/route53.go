@@ -0,0 +1,225 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	route53Host = "route53.amazonaws.com"
+	route53NS   = "https://route53.amazonaws.com/doc/2013-04-01/"
+)
+
+// route53 uses the Route 53 REST API, signed with AWS Signature Version 4 (an IAM
+// key allowed route53:ListResourceRecordSets and route53:ChangeResourceRecordSets on
+// the hosted zone). Route 53 keeps all values of a name and type in one record set,
+// so adding or deleting a value rewrites the set.
+type route53 struct {
+	zone   string
+	keyID  string
+	secret string
+	zoneID string
+}
+
+type r53Set struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int      `xml:"TTL"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type r53Change struct {
+	Action string `xml:"Action"`
+	Set    r53Set `xml:"ResourceRecordSet"`
+}
+
+type r53ChangeRequest struct {
+	XMLName xml.Name    `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Changes []r53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+func (r *route53) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body []byte
+	if in != nil {
+		b, err := xml.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = append([]byte(xml.Header), b...)
+	}
+	u := "https://" + route53Host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "text/xml")
+	}
+	r.sign(req, path, query, body, time.Now().UTC())
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("route53: %w", err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &e) == nil && e.Message != "" {
+			return fmt.Errorf("route53: %s: %s: %s", res.Status, e.Code, e.Message)
+		}
+		return fmt.Errorf("route53: %s", res.Status)
+	}
+	if out != nil {
+		return xml.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// sign adds the SigV4 headers (Route 53 is a global service signed for us-east-1).
+func (r *route53) sign(req *http.Request, path string, query url.Values, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payload := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		query.Encode(), // keys sorted; names need no escaping beyond url's
+		"host:" + route53Host + "\nx-amz-content-sha256:" + payload + "\nx-amz-date:" + amzDate + "\n",
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/us-east-1/route53/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+r.secret), day)
+	for _, part := range []string{"us-east-1", "route53", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.keyID, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *route53) rrsetPath() string {
+	return "/2013-04-01/hostedzone/" + r.zoneID + "/rrset"
+}
+
+// set returns the record set of name and typ (nil if there is none).
+func (r *route53) set(ctx context.Context, name, typ string) (*r53Set, error) {
+	q := url.Values{"name": {name + "."}, "type": {typ}, "maxitems": {"1"}}
+	var out struct {
+		Sets []r53Set `xml:"ResourceRecordSets>ResourceRecordSet"`
+	}
+	if err := r.do(ctx, http.MethodGet, r.rrsetPath(), q, nil, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Sets) == 0 {
+		return nil, nil
+	}
+	s := out.Sets[0]
+	got := strings.ReplaceAll(strings.TrimSuffix(strings.ToLower(s.Name), "."), `\052`, "*")
+	if got != name || s.Type != typ {
+		return nil, nil // listing starts at name; the next set belongs to another name
+	}
+	return &s, nil
+}
+
+func (r *route53) change(ctx context.Context, action string, s r53Set) error {
+	req := r53ChangeRequest{Xmlns: route53NS, Changes: []r53Change{{Action: action, Set: s}}}
+	return r.do(ctx, http.MethodPost, r.rrsetPath(), nil, req, nil)
+}
+
+func r53Value(typ, v string) string {
+	if typ == "TXT" {
+		return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+	}
+	return v
+}
+
+func r53Unquote(typ, v string) string {
+	if typ == "TXT" {
+		return strings.ReplaceAll(strings.Trim(v, `"`), `\"`, `"`)
+	}
+	return v
+}
+
+func (r *route53) Records(ctx context.Context, name, typ string) ([]Record, error) {
+	s, err := r.set(ctx, name, typ)
+	if err != nil || s == nil {
+		return nil, err
+	}
+	out := make([]Record, 0, len(s.Records))
+	for _, v := range s.Records {
+		out = append(out, Record{Name: name, Type: typ, Value: r53Unquote(typ, v), TTL: s.TTL})
+	}
+	return out, nil
+}
+
+func (r *route53) AddRecord(ctx context.Context, rec Record) error {
+	s, err := r.set(ctx, rec.Name, rec.Type)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		ttl := rec.TTL
+		if ttl <= 0 {
+			ttl = 300
+		}
+		s = &r53Set{Name: rec.Name + ".", Type: rec.Type, TTL: ttl}
+	}
+	s.Records = append(s.Records, r53Value(rec.Type, rec.Value))
+	return r.change(ctx, "UPSERT", *s)
+}
+
+func (r *route53) DeleteRecord(ctx context.Context, rec Record) error {
+	s, err := r.set(ctx, rec.Name, rec.Type)
+	if err != nil || s == nil {
+		return err
+	}
+	full := *s
+	var keep []string
+	for _, v := range s.Records {
+		if r53Unquote(rec.Type, v) != rec.Value {
+			keep = append(keep, v)
+		}
+	}
+	if len(keep) == len(s.Records) {
+		return nil
+	}
+	if len(keep) == 0 {
+		return r.change(ctx, "DELETE", full) // must match the set exactly
+	}
+	s.Records = keep
+	return r.change(ctx, "UPSERT", *s)
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
         "mynginx/internal/util"
 )
@@ -38,48 +39,73 @@ func PoolFilePath(poolsDir, domain string) string {
 
 // EnsurePool renders a pool file and reloads the php-fpm service only if the content changes.
 // Returns (socketPath, changed, err).
-func EnsurePool(poolsDir, service, sockDir, domain, phpVersion string, td PoolData) (string, bool, error) {
+func EnsurePool(run util.Runner, reloadTimeout time.Duration, poolsDir, service, sockDir, domain, phpVersion string, td PoolData) (string, bool, error) {
+	if service == "" {
+		return "", false, fmt.Errorf("poolsDir/service/sockDir/phpVersion required")
+	}
+	sock, _, changed, err := WritePool(poolsDir, sockDir, domain, phpVersion, td)
+	if err != nil || !changed {
+		return sock, false, err
+	}
+
+	// Reload php-fpm so it picks up pool changes
+	if err := ReloadService(run, reloadTimeout, service); err != nil {
+		return "", true, err
+	}
+	return sock, true, nil
+}
+
+// WritePool renders a pool file and writes it if the content changes, without
+// reloading php-fpm. prev is the file it replaced (nil if there was none), for
+// RestorePool. Returns (socketPath, prev, changed, err).
+func WritePool(poolsDir, sockDir, domain, phpVersion string, td PoolData) (string, []byte, bool, error) {
 	if domain == "" {
-		return "", false, fmt.Errorf("domain required")
+		return "", nil, false, fmt.Errorf("domain required")
 	}
-        if poolsDir == "" || service == "" || sockDir == "" || phpVersion == "" {
-                return "", false, fmt.Errorf("poolsDir/service/sockDir/phpVersion required")
+	if poolsDir == "" || sockDir == "" || phpVersion == "" {
+		return "", nil, false, fmt.Errorf("poolsDir/sockDir/phpVersion required")
 	}
 
-        // Always use deterministic per-domain socket
-        td.Socket = SocketPath(sockDir, domain, phpVersion)
+	// Always use deterministic per-domain socket
+	td.Socket = SocketPath(sockDir, domain, phpVersion)
 
 	// Ensure dirs exist for logs/slowlogs (php-fpm will create files, but directory must exist)
 	if td.ErrorLog != "" {
-                _ = util.MkdirAll(filepath.Dir(td.ErrorLog), 0755)
+		_ = util.MkdirAll(filepath.Dir(td.ErrorLog), 0755)
 	}
 	if td.SlowlogPath != "" {
-                _ = util.MkdirAll(filepath.Dir(td.SlowlogPath), 0755)
+		_ = util.MkdirAll(filepath.Dir(td.SlowlogPath), 0755)
 	}
 
 	pm := &PoolManager{} // uses default internal/fpm/templates/pool.tmpl
 	rendered, err := pm.Render(td)
 	if err != nil {
-		return "", false, err
+		return "", nil, false, err
 	}
 
 	outPath := PoolFilePath(poolsDir, domain)
-        _ = util.MkdirAll(filepath.Dir(outPath), 0755)
+	_ = util.MkdirAll(filepath.Dir(outPath), 0755)
 
-	if old, err := os.ReadFile(outPath); err == nil {
-		if bytes.Equal(old, rendered) {
-			return td.Socket, false, nil
-		}
+	old, err := os.ReadFile(outPath)
+	if err == nil && bytes.Equal(old, rendered) {
+		return td.Socket, old, false, nil
 	}
 
 	// Write new pool conf
-	if err := writePoolFileAtomic(outPath, rendered); err != nil {
-		return "", false, fmt.Errorf("write pool %s: %w", outPath, err)
+	if err := util.WriteFileAtomic(outPath, rendered, 0644); err != nil {
+		return "", nil, false, fmt.Errorf("write pool %s: %w", outPath, err)
 	}
+	return td.Socket, old, true, nil
+}
 
-	// Reload php-fpm so it picks up pool changes
-	if err := ReloadService(service); err != nil {
-		return "", true, err
+// RestorePool puts back the pool file WritePool replaced (prev nil removes it).
+func RestorePool(poolsDir, domain string, prev []byte) error {
+	p := PoolFilePath(poolsDir, domain)
+	if prev == nil {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
 	}
-	return td.Socket, true, nil
+	return util.WriteFileAtomic(p, prev, 0644)
 }
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"strconv"
 	"text/template"
 
 	"mynginx/internal/util"
 )
 
+// PoolData feeds templates/pool.tmpl. Its fields are a stable contract for custom
+// templates: add, never rename or remove.
 type PoolData struct {
 	PoolName    string
 	RunUser     string
@@ -31,6 +34,30 @@ type PoolData struct {
 	PHPValues      map[string]string
 }
 
+// Override applies per-site settings (see ForeignPool.Overrides) on top of the
+// defaults; unknown or malformed entries are ignored.
+func (td *PoolData) Override(settings map[string]string) {
+	for k, v := range settings {
+		dir, name, isArray := iniArrayKey(k)
+		switch {
+		case isArray && dir == "php_admin_value":
+			td.PHPAdminValues[name] = v
+		case isArray && dir == "php_value":
+			td.PHPValues[name] = v
+		case k == "pm.max_children":
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				td.MaxChildren = n
+			}
+		case k == "pm.max_requests":
+			if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+				td.MaxRequests = n
+			}
+		case k == "request_terminate_timeout":
+			td.RequestTerminateTimeout = v
+		}
+	}
+}
+
 type PoolManager struct {
 	TemplatePath string // internal/fpm/templates/pool.tmpl (resolved at build/deploy time)
 }
@@ -40,7 +67,7 @@ func (m *PoolManager) Render(td PoolData) ([]byte, error) {
 	if tplPath == "" {
 		tplPath = filepath.Join("internal", "fpm", "templates", "pool.tmpl")
 	}
-	tpl, err := template.ParseFiles(tplPath)
+	tpl, err := template.New(filepath.Base(tplPath)).Funcs(util.TemplateFuncs()).ParseFiles(tplPath)
 	if err != nil {
 		return nil, fmt.Errorf("parse pool template %s: %w", tplPath, err)
 	}
@@ -50,13 +77,3 @@ func (m *PoolManager) Render(td PoolData) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
-
-
-func writePoolFileAtomic(path string, data []byte) error {
-	// util.WriteFileAtomic requires parent dir to exist.
-	dir := filepath.Dir(path)
-	if err := util.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	return util.WriteFileAtomic(path, data, 0644)
-}
@@ -0,0 +1,113 @@
+package fpm
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ForeignPool is a pool section of a pool file ngm did not write (no "ngm-" prefix):
+// what a migrated server brings along.
+type ForeignPool struct {
+	File     string
+	Name     string            // section name, e.g. "example.com" or "www"
+	Settings map[string]string // directive -> value, as written (last one wins)
+	Pools    int               // pool sections in File (adoption moves the whole file)
+}
+
+// Get returns a directive of the pool ("" if unset).
+func (p ForeignPool) Get(key string) string { return p.Settings[key] }
+
+// Overrides are the settings an adopted pool keeps under ngm: the php_value /
+// php_admin_value entries (flags folded into values) and the pm.max_children,
+// pm.max_requests and request_terminate_timeout limits. error_log and log_errors
+// stay ngm's.
+func (p ForeignPool) Overrides() map[string]string {
+	out := map[string]string{}
+	for k, v := range p.Settings {
+		dir, name, ok := iniArrayKey(k)
+		switch {
+		case ok && (name == "error_log" || name == "log_errors"):
+		case ok && (dir == "php_value" || dir == "php_flag"):
+			out["php_value["+name+"]"] = v
+		case ok && (dir == "php_admin_value" || dir == "php_admin_flag"):
+			out["php_admin_value["+name+"]"] = v
+		case k == "pm.max_children" || k == "pm.max_requests" || k == "request_terminate_timeout":
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// iniArrayKey splits "php_admin_value[memory_limit]" into its directive and name.
+func iniArrayKey(k string) (dir, name string, ok bool) {
+	i := strings.IndexByte(k, '[')
+	if i <= 0 || !strings.HasSuffix(k, "]") {
+		return "", "", false
+	}
+	return k[:i], strings.TrimSpace(k[i+1 : len(k)-1]), true
+}
+
+// ScanPools returns the pools of every *.conf in poolsDir not managed by ngm.
+func ScanPools(poolsDir string) ([]ForeignPool, error) {
+	files, err := filepath.Glob(filepath.Join(poolsDir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	var out []ForeignPool
+	for _, f := range files {
+		if strings.HasPrefix(filepath.Base(f), "ngm-") {
+			continue
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		pools := ParsePools(data)
+		for i := range pools {
+			pools[i].File = f
+			pools[i].Pools = len(pools)
+		}
+		out = append(out, pools...)
+	}
+	return out, nil
+}
+
+// ParsePools reads the pool sections of a php-fpm ini file ([global] is skipped).
+func ParsePools(data []byte) []ForeignPool {
+	var (
+		out []ForeignPool
+		cur *ForeignPool
+	)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "global" {
+				cur = nil
+				continue
+			}
+			out = append(out, ForeignPool{Name: name, Settings: map[string]string{}})
+			cur = &out[len(out)-1]
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || cur == nil {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		}
+		cur.Settings[strings.TrimSpace(k)] = v
+	}
+	return out
+}
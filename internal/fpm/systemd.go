@@ -3,19 +3,19 @@ package fpm
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
+
+	"mynginx/internal/util"
 )
 
-func ReloadService(service string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+func ReloadService(run util.Runner, timeout time.Duration, service string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "systemctl", "reload", service)
-	out, err := cmd.CombinedOutput()
+	res, err := run.Run(ctx, "systemctl", "reload", service)
 	if err != nil {
-		return fmt.Errorf("systemctl reload %s failed: %w (out=%s)", service, err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("systemctl reload %s failed: %w (out=%s)", service, err, strings.TrimSpace(res.Output()))
 	}
 	return nil
 }
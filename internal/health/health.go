@@ -0,0 +1,259 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/config"
+	"mynginx/internal/notify"
+	"mynginx/internal/store"
+)
+
+// maxParallel bounds concurrent checks within one round.
+const maxParallel = 8
+
+// Store is the subset of store.SiteStore the checker needs.
+type Store interface {
+	ListSites() ([]store.Site, error)
+	GetSiteByDomain(domain string) (store.Site, error)
+	InsertHealthCheck(c store.HealthCheck) error
+	PurgeHealthChecks(olderThan time.Time) error
+	RecentHealthChecks(siteID int64, n int) ([]store.HealthCheck, error)
+	GetOpenIncident(siteID int64) (*store.Incident, error)
+	CreateIncident(siteID int64, startedAt time.Time, cause string) (store.Incident, error)
+	CloseIncident(id int64, endedAt time.Time) error
+}
+
+// Checker probes every enabled site through the local nginx (SNI and Host set to the
+// site domain), records the outcome and turns consecutive failures into incidents.
+type Checker struct {
+	cfg      config.HealthConfig
+	st       Store
+	mailer   *notify.Mailer
+	interval time.Duration
+	client   *http.Client
+
+	trackMu sync.Mutex     // serializes incident open/close per process
+	pending sync.WaitGroup // notifications in flight
+}
+
+// Wait blocks until queued notifications are sent (one-shot CLI runs call it before exiting).
+func (c *Checker) Wait() {
+	c.pending.Wait()
+}
+
+// NewChecker builds a checker. With an empty cfg.Connect sites are reached through
+// DNS like any visitor would (used by external check locations).
+func NewChecker(cfg config.HealthConfig, st Store, mailer *notify.Mailer) *Checker {
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	tr := &http.Transport{
+		DialContext: dialer.DialContext,
+		// availability only: self-signed fallback certs must not count as an outage
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	if cfg.Connect != "" {
+		// every request goes to the configured address, whatever the URL host says
+		tr.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, cfg.Connect)
+		}
+	}
+	return &Checker{
+		cfg:      cfg,
+		st:       st,
+		mailer:   mailer,
+		interval: interval,
+		client: &http.Client{
+			Transport: tr,
+			Timeout:   timeout,
+			// a redirect is an answer; do not follow it
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// Run checks all sites every interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		if _, err := c.CheckAll(ctx); err != nil {
+			log.Printf("health: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// CheckAll checks every enabled site once, records the results and purges old history.
+func (c *Checker) CheckAll(ctx context.Context) ([]Result, error) {
+	sites, err := c.st.ListSites()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu  sync.Mutex
+		out []Result
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxParallel)
+	)
+	for _, s := range sites {
+		if !s.Enabled {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(s store.Site) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := c.Check(ctx, s)
+			if err := c.Record(ctx, s, res.HealthCheck); err != nil {
+				log.Printf("health: record %s: %v", s.Domain, err)
+			}
+			mu.Lock()
+			out = append(out, res)
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	if err := c.st.PurgeHealthChecks(time.Now().AddDate(0, 0, -c.cfg.RetentionDays)); err != nil {
+		log.Printf("health: purge: %v", err)
+	}
+	return out, nil
+}
+
+// Result is a check outcome with the domain it belongs to.
+type Result struct {
+	Domain string
+	store.HealthCheck
+}
+
+// Check probes one site without recording it. Any HTTP response below 500 counts as
+// up; a proxy site exposing its backend health endpoint is probed there instead,
+// where only 2xx/3xx does.
+func (c *Checker) Check(ctx context.Context, s store.Site) Result {
+	res := Result{Domain: s.Domain, HealthCheck: store.HealthCheck{
+		SiteID:    s.ID,
+		CheckedAt: time.Now(),
+		Location:  c.cfg.Location,
+	}}
+
+	path, upBelow := c.cfg.Path, 500
+	if s.Mode == "proxy" && s.BackendHealth != "" {
+		path, upBelow = c.cfg.Backend.Location, 400
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+s.Domain+path, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", "ngm-health/1")
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Error = shortErr(err)
+		return res
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	res.StatusCode = resp.StatusCode
+	res.OK = resp.StatusCode < upBelow
+	if !res.OK {
+		res.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return res
+}
+
+// Record stores a check (local or reported by an external location) and updates incidents.
+func (c *Checker) Record(ctx context.Context, s store.Site, hc store.HealthCheck) error {
+	hc.SiteID = s.ID
+	if err := c.st.InsertHealthCheck(hc); err != nil {
+		return err
+	}
+	return c.track(ctx, s, hc)
+}
+
+// track opens an incident after FailThreshold consecutive failures and closes it on
+// the first success, notifying on both transitions.
+func (c *Checker) track(ctx context.Context, s store.Site, hc store.HealthCheck) error {
+	c.trackMu.Lock()
+	defer c.trackMu.Unlock()
+
+	open, err := c.st.GetOpenIncident(s.ID)
+	if err != nil {
+		return err
+	}
+	if hc.OK {
+		if open == nil {
+			return nil
+		}
+		if err := c.st.CloseIncident(open.ID, hc.CheckedAt); err != nil {
+			return err
+		}
+		ended := hc.CheckedAt
+		open.EndedAt = &ended
+		open.Domain = s.Domain
+		c.notify(ctx, Event{Type: "resolved", Incident: *open, Location: hc.Location})
+		return nil
+	}
+	if open != nil {
+		return nil
+	}
+
+	n := c.cfg.FailThreshold
+	if n < 1 {
+		n = 1
+	}
+	recent, err := c.st.RecentHealthChecks(s.ID, n)
+	if err != nil {
+		return err
+	}
+	if len(recent) < n {
+		return nil
+	}
+	for _, r := range recent {
+		if r.OK {
+			return nil
+		}
+	}
+	// the outage started with the oldest failure of the streak
+	in, err := c.st.CreateIncident(s.ID, recent[len(recent)-1].CheckedAt, hc.Error)
+	if err != nil {
+		return err
+	}
+	in.Domain = s.Domain
+	c.notify(ctx, Event{Type: "down", Incident: in, Location: hc.Location})
+	return nil
+}
+
+// shortErr drops the request URL prefix net/http adds, which only repeats the domain.
+func shortErr(err error) string {
+	msg := err.Error()
+	if i := strings.LastIndex(msg, "\": "); i >= 0 {
+		return msg[i+3:]
+	}
+	return msg
+}
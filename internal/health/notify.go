@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"mynginx/internal/notify"
+	"mynginx/internal/store"
+)
+
+// Event is a site state change, posted as JSON to every configured webhook.
+type Event struct {
+	Type     string         `json:"event"` // "down" | "resolved"
+	Incident store.Incident `json:"-"`
+	Location string         `json:"location"`
+
+	Domain    string     `json:"domain"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Duration  int64      `json:"duration_seconds,omitempty"`
+	Cause     string     `json:"cause,omitempty"`
+}
+
+// notify sends the event to webhooks and email recipients in the background,
+// so a slow receiver never delays the next check round.
+func (c *Checker) notify(ctx context.Context, ev Event) {
+	in := ev.Incident
+	ev.Domain = in.Domain
+	ev.StartedAt = in.StartedAt
+	ev.EndedAt = in.EndedAt
+	ev.Cause = in.Cause
+	if in.EndedAt != nil {
+		ev.Duration = int64(in.EndedAt.Sub(in.StartedAt).Seconds())
+	}
+	log.Printf("health: %s %s (%s)", ev.Domain, ev.Type, ev.Cause)
+
+	if len(c.cfg.Webhooks) == 0 && len(c.cfg.NotifyEmails) == 0 {
+		return
+	}
+	c.pending.Add(1)
+	go func() {
+		defer c.pending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		for _, url := range c.cfg.Webhooks {
+			if err := notify.PostJSON(ctx, url, ev, nil); err != nil {
+				log.Printf("health: webhook: %v", err)
+			}
+		}
+		if !c.mailer.Enabled() {
+			return
+		}
+		subject, body := eventMail(ev)
+		for _, to := range c.cfg.NotifyEmails {
+			if err := c.mailer.Send(to, subject, body); err != nil {
+				log.Printf("health: mail %s: %v", to, err)
+			}
+		}
+	}()
+}
+
+func eventMail(ev Event) (string, string) {
+	if ev.Type == "resolved" {
+		return fmt.Sprintf("[RESOLVED] %s is back up", ev.Domain),
+			fmt.Sprintf("%s is responding again.\n\nDown since: %s\nRecovered:  %s\nDuration:   %s\nCause:      %s\n",
+				ev.Domain, ev.StartedAt.Format(time.RFC1123), ev.EndedAt.Format(time.RFC1123),
+				(time.Duration(ev.Duration) * time.Second).String(), ev.Cause)
+	}
+	return fmt.Sprintf("[DOWN] %s is not responding", ev.Domain),
+		fmt.Sprintf("%s failed its health checks.\n\nDown since: %s\nCause:      %s\nLocation:   %s\n",
+			ev.Domain, ev.StartedAt.Format(time.RFC1123), ev.Cause, ev.Location)
+}
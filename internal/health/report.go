@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"mynginx/internal/notify"
+	"mynginx/internal/store"
+)
+
+// Report is a check result submitted by an external check location.
+type Report struct {
+	Location   string    `json:"location"`
+	Domain     string    `json:"domain"`
+	OK         bool      `json:"ok"`
+	StatusCode int       `json:"status_code"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// ReportPath is where external locations POST their results (a JSON array of Report).
+const ReportPath = "/api/v1/health/report"
+
+// maxReportAge rejects stale or future-dated reports.
+const maxReportAge = 10 * time.Minute
+
+// Accept records a report from an external location.
+func (c *Checker) Accept(ctx context.Context, r Report) error {
+	loc := strings.TrimSpace(r.Location)
+	if loc == "" || loc == c.cfg.Location || len(loc) > 64 {
+		return fmt.Errorf("invalid location %q", r.Location)
+	}
+	if r.CheckedAt.IsZero() {
+		r.CheckedAt = time.Now()
+	}
+	if d := time.Since(r.CheckedAt); d > maxReportAge || d < -maxReportAge {
+		return fmt.Errorf("report for %s is too old or in the future", r.Domain)
+	}
+	s, err := c.st.GetSiteByDomain(strings.ToLower(strings.TrimSpace(r.Domain)))
+	if err != nil || !s.Enabled {
+		return fmt.Errorf("unknown site %q", r.Domain)
+	}
+	if len(r.Error) > 500 {
+		r.Error = r.Error[:500]
+	}
+	return c.Record(ctx, s, store.HealthCheck{
+		CheckedAt:  r.CheckedAt,
+		OK:         r.OK,
+		StatusCode: r.StatusCode,
+		LatencyMS:  r.LatencyMS,
+		Error:      r.Error,
+		Location:   loc,
+	})
+}
+
+// SendReports posts results to a panel's report endpoint (used by `ngm health check --report-to`).
+func SendReports(ctx context.Context, url, secret string, results []Result) error {
+	out := make([]Report, 0, len(results))
+	for _, r := range results {
+		out = append(out, Report{
+			Location:   r.Location,
+			Domain:     r.Domain,
+			OK:         r.OK,
+			StatusCode: r.StatusCode,
+			LatencyMS:  r.LatencyMS,
+			Error:      r.Error,
+			CheckedAt:  r.CheckedAt,
+		})
+	}
+	return notify.PostJSON(ctx, url, out, map[string]string{"Authorization": "Bearer " + secret})
+}
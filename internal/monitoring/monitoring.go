@@ -0,0 +1,234 @@
+// Package monitoring names the metrics ngm exports on /metrics and generates a
+// starter pack for them: Prometheus alerting rules and a Grafana dashboard.
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metric names of /metrics. They are part of the rules and dashboard below, so they
+// are added, never renamed.
+const (
+	MetricCertExpiry     = "ngm_cert_expiry_timestamp_seconds"        // gauge{domain,lineage}
+	MetricSiteUp         = "ngm_site_up"                              // gauge{domain,location}: latest uptime check passed
+	MetricSiteLatency    = "ngm_site_check_latency_seconds"           // gauge{domain,location}
+	MetricSiteChecked    = "ngm_site_check_timestamp_seconds"         // gauge{domain,location}
+	MetricSites          = "ngm_sites"                                // gauge{state="enabled"|"disabled"}
+	MetricApplySuccess   = "ngm_apply_last_success_timestamp_seconds" // gauge
+	MetricApplyFailure   = "ngm_apply_last_failure_timestamp_seconds" // gauge
+	MetricStoreErrors    = "ngm_store_errors_total"                   // counter{op}
+	MetricCertDaysLeft   = "ngm_cert_days_left"                       // gauge{domain,lineage}
+	MetricSiteStates     = "ngm_sites_by_state"                       // gauge{state="OK"|"PENDING"|"ERROR"|"DISABLED"}
+	MetricApplyRuns      = "ngm_apply_runs_total"                     // counter{result="ok"|"failed"|"dry_run"|"busy"} of ngm serve
+	MetricApplyDuration  = "ngm_apply_duration_seconds"               // histogram of ngm serve
+	MetricReloads        = "ngm_nginx_reloads_total"                  // counter of ngm serve
+	MetricReloadFailures = "ngm_nginx_reload_failures_total"          // counter of ngm serve
+	MetricHTTPRequests   = "ngm_http_requests_total"                  // counter{route,method,code}
+	MetricHTTPDuration   = "ngm_http_request_duration_seconds"        // histogram{route}
+)
+
+// Options tune the generated rules.
+type Options struct {
+	Job          string // Prometheus job label of the ngm scrape ("" = any)
+	CertDays     int    // warn when a certificate expires within this many days
+	CheckMaxAge  int    // minutes without a fresh uptime check before alerting
+	DownFor      string // how long a site must fail its check (Prometheus duration)
+	DatasourceID string // Grafana datasource uid ("" = ${DS_PROMETHEUS} input)
+}
+
+// DefaultOptions are the thresholds `ngm monitoring export-rules` starts from.
+func DefaultOptions() Options {
+	return Options{Job: "ngm", CertDays: 14, CheckMaxAge: 30, DownFor: "5m"}
+}
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// sel is the label selector of the ngm job, e.g. `{job="ngm"}`.
+func (o Options) sel() string {
+	if o.Job == "" {
+		return ""
+	}
+	return fmt.Sprintf(`{job=%q}`, o.Job)
+}
+
+// Rules returns a Prometheus rule file (YAML) alerting on certificate expiry, failed
+// applies, sites that are down and stale uptime checks.
+func Rules(o Options) ([]byte, error) {
+	s := o.sel()
+	f := ruleFile{Groups: []ruleGroup{{
+		Name: "ngm",
+		Rules: []rule{
+			{
+				Alert:  "NgmCertExpiringSoon",
+				Expr:   fmt.Sprintf("(%s%s - time()) / 86400 < %d", MetricCertExpiry, s, o.CertDays),
+				For:    "1h",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "Certificate of {{ $labels.domain }} expires in {{ $value | humanize }} days",
+					"description": "Renewal has not replaced it yet; check `ngm cert check` and the certs events.",
+				},
+			},
+			{
+				Alert:  "NgmCertExpired",
+				Expr:   fmt.Sprintf("%s%s - time() < 0", MetricCertExpiry, s),
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary": "Certificate of {{ $labels.domain }} has expired",
+				},
+			},
+			{
+				Alert:  "NgmApplyFailing",
+				Expr:   fmt.Sprintf("%s%s > %s%s", MetricApplyFailure, s, MetricApplySuccess, s),
+				For:    "10m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "The last ngm apply failed",
+					"description": "No apply has succeeded since; see `ngm apply --show <run>` or /ui/apply/runs.",
+				},
+			},
+			{
+				Alert:  "NgmSiteDown",
+				Expr:   fmt.Sprintf("%s%s == 0", MetricSiteUp, s),
+				For:    o.DownFor,
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary": "{{ $labels.domain }} fails its uptime check ({{ $labels.location }})",
+				},
+			},
+			{
+				Alert:  "NgmUptimeChecksStale",
+				Expr:   fmt.Sprintf("time() - %s%s > %d", MetricSiteChecked, s, o.CheckMaxAge*60),
+				For:    "10m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("No uptime check of {{ $labels.domain }} for over %d minutes", o.CheckMaxAge),
+				},
+			},
+			{
+				Alert:  "NgmNginxReloadFailing",
+				Expr:   fmt.Sprintf("increase(%s%s[15m]) > 0", MetricReloadFailures, s),
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "nginx reloads are failing",
+					"description": "nginx keeps serving the old configuration; check `ngm nginx status` and the nginx events.",
+				},
+			},
+			{
+				Alert:  "NgmStoreErrors",
+				Expr:   fmt.Sprintf("increase(%s%s[15m]) > 0", MetricStoreErrors, s),
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary": "ngm store operation {{ $labels.op }} is failing",
+				},
+			},
+		},
+	}}}
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), enc.Close()
+}
+
+type panel struct {
+	ID          int               `json:"id"`
+	Title       string            `json:"title"`
+	Type        string            `json:"type"`
+	GridPos     map[string]int    `json:"gridPos"`
+	Datasource  map[string]string `json:"datasource"`
+	Targets     []map[string]any  `json:"targets"`
+	FieldConfig map[string]any    `json:"fieldConfig,omitempty"`
+}
+
+// Dashboard returns a Grafana dashboard (JSON model) for the metrics above: sites up,
+// days until each certificate expires, check latency and apply outcome.
+func Dashboard(o Options) ([]byte, error) {
+	s := o.sel()
+	ds := map[string]string{"type": "prometheus", "uid": "${DS_PROMETHEUS}"}
+	if o.DatasourceID != "" {
+		ds["uid"] = o.DatasourceID
+	}
+	target := func(expr, legend string) []map[string]any {
+		return []map[string]any{{"refId": "A", "expr": expr, "legendFormat": legend, "datasource": ds}}
+	}
+	unit := func(u string) map[string]any {
+		return map[string]any{"defaults": map[string]any{"unit": u}}
+	}
+	panels := []panel{
+		{Title: "Sites down", Type: "stat", Targets: target(fmt.Sprintf("count(%s%s == 0) or vector(0)", MetricSiteUp, s), "down")},
+		{Title: "Enabled sites", Type: "stat", Targets: target(fmt.Sprintf(`%s{state="enabled"%s}`, MetricSites, jobLabel(o)), "enabled")},
+		{Title: "Last apply failed", Type: "stat", Targets: target(fmt.Sprintf("%s%s > bool %s%s", MetricApplyFailure, s, MetricApplySuccess, s), "failed")},
+		{Title: "Certificates expiring first (days)", Type: "bargauge", FieldConfig: unit("d"),
+			Targets: target(fmt.Sprintf("bottomk(15, (%s%s - time()) / 86400)", MetricCertExpiry, s), "{{domain}} {{lineage}}")},
+		{Title: "Uptime check status", Type: "state-timeline",
+			Targets: target(fmt.Sprintf("%s%s", MetricSiteUp, s), "{{domain}} ({{location}})")},
+		{Title: "Uptime check latency", Type: "timeseries", FieldConfig: unit("s"),
+			Targets: target(fmt.Sprintf("%s%s", MetricSiteLatency, s), "{{domain}} ({{location}})")},
+		{Title: "Store errors", Type: "timeseries",
+			Targets: target(fmt.Sprintf("rate(%s%s[5m])", MetricStoreErrors, s), "{{op}}")},
+		{Title: "Applies and failed reloads", Type: "timeseries",
+			Targets: []map[string]any{
+				{"refId": "A", "expr": fmt.Sprintf("increase(%s%s[1h])", MetricApplyRuns, s), "legendFormat": "apply {{result}}", "datasource": ds},
+				{"refId": "B", "expr": fmt.Sprintf("increase(%s%s[1h])", MetricReloadFailures, s), "legendFormat": "reload failed", "datasource": ds},
+			}},
+		{Title: "Panel/API requests (5xx)", Type: "timeseries",
+			Targets: target(fmt.Sprintf(`sum by (route) (rate(%s{code=~"5.."%s}[5m]))`, MetricHTTPRequests, jobLabel(o)), "{{route}}")},
+	}
+	// three stats on top, then full-width rows
+	for i := range panels {
+		p := &panels[i]
+		p.ID = i + 1
+		p.Datasource = ds
+		if i < 3 {
+			p.GridPos = map[string]int{"x": i * 8, "y": 0, "w": 8, "h": 4}
+		} else {
+			p.GridPos = map[string]int{"x": 0, "y": 4 + (i-3)*8, "w": 24, "h": 8}
+		}
+	}
+	dash := map[string]any{
+		"title":         "ngm",
+		"uid":           "ngm-overview",
+		"tags":          []string{"ngm", "nginx"},
+		"timezone":      "browser",
+		"schemaVersion": 39,
+		"refresh":       "1m",
+		"time":          map[string]string{"from": "now-24h", "to": "now"},
+		"panels":        panels,
+	}
+	if o.DatasourceID == "" {
+		dash["__inputs"] = []map[string]string{{
+			"name": "DS_PROMETHEUS", "label": "Prometheus", "type": "datasource",
+			"pluginId": "prometheus", "pluginName": "Prometheus",
+		}}
+	}
+	return json.MarshalIndent(dash, "", "  ")
+}
+
+// jobLabel is the job matcher to append inside an existing selector.
+func jobLabel(o Options) string {
+	if o.Job == "" {
+		return ""
+	}
+	return fmt.Sprintf(`,job=%q`, o.Job)
+}
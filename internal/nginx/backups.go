@@ -0,0 +1,131 @@
+package nginx
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// DefaultBackupKeep is how many vhost backups per domain are kept when BackupKeep is 0.
+const DefaultBackupKeep = 10
+
+// backupStamp sorts lexically in time order.
+const backupStamp = "20060102-150405.000000000"
+
+// SiteBackup is one saved generation of a domain's live vhost, stored as
+// BackupDir/sites/<domain>/<time>-<sha256>.conf. An empty backup records that
+// there was no live vhost (a restore removes it).
+type SiteBackup struct {
+	Path  string
+	Time  time.Time
+	Hash  string // sha256 of the content, from the file name
+	Size  int64
+	Valid bool // the content still hashes to Hash
+
+	// RenderHash is the sha256 of the content without its stamp header, comparable
+	// with a site's render hash.
+	RenderHash string
+}
+
+func (m *Manager) siteBackupDir(domain string) string {
+	return filepath.Join(m.BackupDir, "sites", domain)
+}
+
+// backupSite saves data as the newest backup of domain (nil: there was no live
+// vhost) and prunes the oldest beyond BackupKeep. The same content as the newest
+// backup is not saved twice, so repeated failed applies cannot push the last good
+// vhost out.
+func (m *Manager) backupSite(domain string, data []byte) error {
+	hash := util.Sha256Hex(data)
+	list, _ := m.ListSiteBackups(domain)
+	if len(list) > 0 && list[0].Hash == hash && list[0].Valid {
+		return nil
+	}
+	dir := m.siteBackupDir(domain)
+	if err := util.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format(backupStamp) + "-" + hash + ".conf"
+	if err := util.WriteFileAtomic(filepath.Join(dir, name), data, 0644); err != nil {
+		return err
+	}
+
+	keep := m.BackupKeep
+	if keep <= 0 {
+		keep = DefaultBackupKeep
+	}
+	// the new one is not in list yet
+	for i := keep - 1; i < len(list); i++ {
+		_ = os.Remove(list[i].Path)
+	}
+	return nil
+}
+
+// ListSiteBackups returns the backups of domain, newest first.
+func (m *Manager) ListSiteBackups(domain string) ([]SiteBackup, error) {
+	paths, err := filepath.Glob(filepath.Join(m.siteBackupDir(domain), "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	var out []SiteBackup
+	for _, p := range paths {
+		base := strings.TrimSuffix(filepath.Base(p), ".conf")
+		i := strings.LastIndex(base, "-")
+		if i < 0 {
+			continue
+		}
+		stamp, hash := base[:i], base[i+1:]
+		t, err := time.Parse(backupStamp, stamp)
+		if err != nil {
+			continue
+		}
+		b := SiteBackup{Path: p, Time: t, Hash: hash}
+		if data, err := os.ReadFile(p); err == nil {
+			b.Size = int64(len(data))
+			b.Valid = util.Sha256Hex(data) == hash
+			b.RenderHash = util.Sha256Hex(StripStamp(data))
+		}
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+// restoreSite puts back the newest intact backup of domain that differs from the
+// live vhost being rolled back; a vhost from before the history existed
+// (<domain>.conf.bak) is the last resort. With nothing to restore, the live vhost
+// is removed.
+func (m *Manager) restoreSite(domain string) {
+	dst := filepath.Join(m.SitesDir, domain+".conf")
+	bad := ""
+	if live, err := os.ReadFile(dst); err == nil {
+		bad = util.Sha256Hex(live)
+	}
+
+	list, _ := m.ListSiteBackups(domain)
+	for _, b := range list {
+		if !b.Valid || b.Hash == bad {
+			continue
+		}
+		if b.Size == 0 {
+			_ = os.Remove(dst)
+			return
+		}
+		if data, err := os.ReadFile(b.Path); err == nil && util.Sha256Hex(data) == b.Hash {
+			_ = util.WriteFileAtomic(dst, data, 0644)
+			return
+		}
+	}
+
+	if len(list) == 0 {
+		if data, err := os.ReadFile(filepath.Join(m.BackupDir, domain+".conf.bak")); err == nil && len(data) > 0 {
+			_ = util.WriteFileAtomic(dst, data, 0644)
+			return
+		}
+	}
+	_ = os.Remove(dst)
+}
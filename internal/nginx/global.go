@@ -0,0 +1,135 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"mynginx/internal/util"
+)
+
+// globalFiles are the snippets rendered into GlobalDir, in include order.
+// Each name is a {{define}} in templates/global.tmpl.
+var globalFiles = []string{
+	"00-maps.conf",
+	"10-log-formats.conf",
+	"20-zones.conf",
+	"30-status.conf",
+	"90-default-server.conf",
+}
+
+const globalHeader = "# Managed by NGM (ngm global apply) - manual edits will be overwritten\n"
+
+// RenderGlobalToStaging renders the global snippets into StageDir/ngm.d and returns
+// the staged file names. Snippets that render empty are not staged.
+func (m *Manager) RenderGlobalToStaging(data GlobalTemplateData) ([]string, error) {
+	if m.GlobalDir == "" {
+		return nil, fmt.Errorf("global dir is not configured")
+	}
+	tpl, err := parseGlobalTemplate()
+	if err != nil {
+		return nil, err
+	}
+
+	outDir := filepath.Join(m.StageDir, "ngm.d")
+	if err := os.RemoveAll(outDir); err != nil {
+		return nil, fmt.Errorf("clean %s: %w", outDir, err)
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", outDir, err)
+	}
+
+	var staged []string
+	for _, name := range globalFiles {
+		var buf bytes.Buffer
+		if err := tpl.ExecuteTemplate(&buf, name, data); err != nil {
+			return nil, fmt.Errorf("execute template %s: %w", name, err)
+		}
+		body := strings.TrimSpace(buf.String())
+		if body == "" {
+			continue
+		}
+		out := []byte(globalHeader + "\n" + body + "\n")
+		if err := util.WriteFileAtomic(filepath.Join(outDir, name), out, 0644); err != nil {
+			return nil, err
+		}
+		staged = append(staged, name)
+	}
+	return staged, nil
+}
+
+func parseGlobalTemplate() (*template.Template, error) {
+	tplPath := filepath.Join("internal", "nginx", "templates", "global.tmpl")
+	tpl, err := template.New(filepath.Base(tplPath)).Funcs(util.TemplateFuncs()).ParseFiles(tplPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse template %s: %w", tplPath, err)
+	}
+	return tpl, nil
+}
+
+// PublishGlobal makes GlobalDir match the staged snippets: changed files are
+// replaced and files no longer rendered are removed, each keeping a backup in
+// BackupDir/ngm.d. It returns the names it touched (for RestoreGlobalFromBackup).
+func (m *Manager) PublishGlobal(staged []string) ([]string, error) {
+	stageDir := filepath.Join(m.StageDir, "ngm.d")
+	bakDir := filepath.Join(m.BackupDir, "ngm.d")
+	if err := util.MkdirAll(m.GlobalDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var touched []string
+	keep := map[string]bool{}
+	for _, name := range staged {
+		keep[name] = true
+		dst := filepath.Join(m.GlobalDir, name)
+		bak := filepath.Join(bakDir, name+".bak")
+		// a new file must not be "restored" from an older generation
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			_ = os.Remove(bak)
+		}
+		changed, err := publishFile(filepath.Join(stageDir, name), dst, bak)
+		if err != nil {
+			return touched, err
+		}
+		if changed {
+			touched = append(touched, name)
+		}
+	}
+
+	live, _ := filepath.Glob(filepath.Join(m.GlobalDir, "*.conf"))
+	for _, dst := range live {
+		name := filepath.Base(dst)
+		if keep[name] {
+			continue
+		}
+		old, err := os.ReadFile(dst)
+		if err != nil {
+			return touched, fmt.Errorf("read live %s: %w", dst, err)
+		}
+		if err := util.WriteFileAtomic(filepath.Join(bakDir, name+".bak"), old, 0644); err != nil {
+			return touched, fmt.Errorf("write backup %s: %w", name, err)
+		}
+		if err := os.Remove(dst); err != nil {
+			return touched, fmt.Errorf("remove live %s: %w", dst, err)
+		}
+		touched = append(touched, name)
+	}
+	return touched, nil
+}
+
+// RestoreGlobalFromBackup rolls back the named snippets after a failed nginx test.
+func (m *Manager) RestoreGlobalFromBackup(names ...string) {
+	for _, name := range names {
+		dst := filepath.Join(m.GlobalDir, name)
+		bak := filepath.Join(m.BackupDir, "ngm.d", name+".bak")
+
+		if data, err := os.ReadFile(bak); err == nil && len(data) > 0 {
+			_ = util.WriteFileAtomic(dst, data, 0644)
+			continue
+		}
+		_ = os.Remove(dst)
+	}
+}
@@ -0,0 +1,248 @@
+package nginx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// ErrSitesNotIncluded means nginx never loads the generated vhosts: applies write
+// files into SitesDir but nothing changes on the live server.
+var ErrSitesNotIncluded = errors.New("sites_dir is not included by the main nginx.conf")
+
+// ErrGlobalNotIncluded means the managed global snippets (zones, maps) are not loaded.
+var ErrGlobalNotIncluded = errors.New("global dir is not included by the main nginx.conf")
+
+// confToken is one nginx config token; Off is its byte offset in the file.
+type confToken struct {
+	Text string
+	Off  int
+}
+
+// tokenizeConf splits an nginx config into words, "{", "}" and ";" (comments dropped).
+func tokenizeConf(b []byte) []confToken {
+	var out []confToken
+	i := 0
+	for i < len(b) {
+		c := b[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}' || c == ';':
+			out = append(out, confToken{Text: string(c), Off: i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(b) && b[i] != c {
+				if b[i] == '\\' && i+1 < len(b) {
+					i++
+				}
+				sb.WriteByte(b[i])
+				i++
+			}
+			i++ // closing quote
+			out = append(out, confToken{Text: sb.String(), Off: start})
+		default:
+			start := i
+			for i < len(b) && !strings.ContainsRune(" \t\r\n{};#\"'", rune(b[i])) {
+				i++
+			}
+			out = append(out, confToken{Text: string(b[start:i]), Off: start})
+		}
+	}
+	return out
+}
+
+// httpIncludes returns the include patterns that take effect inside the http block
+// of file, following included files (max depth 5). inHTTP is true when file itself
+// is included from within http.
+func (m *Manager) httpIncludes(file string, inHTTP bool, depth int, seen map[string]bool) ([]string, error) {
+	if depth > 5 || seen[file] {
+		return nil, nil
+	}
+	seen[file] = true
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	var stack []string // enclosing block names
+	var stmt []string  // words of the current directive
+	for _, tok := range tokenizeConf(b) {
+		switch tok.Text {
+		case "{":
+			name := ""
+			if len(stmt) > 0 {
+				name = stmt[0]
+			}
+			stack = append(stack, name)
+			stmt = nil
+		case "}":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			stmt = nil
+		case ";":
+			if len(stmt) == 2 && stmt[0] == "include" {
+				http := (inHTTP && len(stack) == 0) || (len(stack) > 0 && stack[len(stack)-1] == "http")
+				pattern := stmt[1]
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(m.MainConf), pattern)
+				}
+				if http {
+					out = append(out, pattern)
+				}
+				// top-level or http-level includes may themselves hold the sites include
+				if http || len(stack) == 0 {
+					matches, _ := filepath.Glob(pattern)
+					for _, f := range matches {
+						more, _ := m.httpIncludes(f, http, depth+1, seen)
+						out = append(out, more...)
+					}
+				}
+			}
+			stmt = nil
+		default:
+			stmt = append(stmt, tok.Text)
+		}
+	}
+	return out, nil
+}
+
+// CheckSitesIncluded verifies that MainConf (or a file it includes) has an
+// `include` inside the http block that matches SitesDir/*.conf.
+func (m *Manager) CheckSitesIncluded() error {
+	ok, err := m.included(m.SitesDir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w (%s): add `include %s/*.conf;` inside http { } or run `ngm nginx wire`",
+			ErrSitesNotIncluded, m.MainConf, m.SitesDir)
+	}
+	return nil
+}
+
+// CheckGlobalIncluded is CheckSitesIncluded for GlobalDir.
+func (m *Manager) CheckGlobalIncluded() error {
+	ok, err := m.included(m.GlobalDir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w (%s): add `include %s/*.conf;` at the top of http { } or run `ngm nginx wire`",
+			ErrGlobalNotIncluded, m.MainConf, m.GlobalDir)
+	}
+	return nil
+}
+
+// included reports whether an http-level include of MainConf matches dir/*.conf.
+func (m *Manager) included(dir string) (bool, error) {
+	patterns, err := m.httpIncludes(m.MainConf, false, 0, map[string]bool{})
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", m.MainConf, err)
+	}
+	probe := filepath.Join(dir, "ngm-probe.example.com.conf")
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(filepath.Clean(p), probe); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WireSites inserts `include <SitesDir>/*.conf;` at the end of the http block of
+// MainConf and, when GlobalDir is set, `include <GlobalDir>/*.conf;` at its start
+// (zones and maps must be defined before the vhosts use them). A timestamped
+// backup is kept in BackupDir. It returns the backup path ("" when both includes
+// were already present). The caller tests/reloads nginx.
+func (m *Manager) WireSites() (string, error) {
+	needSites := m.CheckSitesIncluded() != nil
+	needGlobal := m.GlobalDir != "" && m.CheckGlobalIncluded() != nil
+	if !needSites && !needGlobal {
+		return "", nil
+	}
+	fi, err := os.Stat(m.MainConf)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(m.MainConf)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", m.MainConf, err)
+	}
+
+	// find the braces of the top-level http block
+	start, end := -1, -1
+	depth, httpDepth := 0, -1
+	var stmt []string
+	for _, tok := range tokenizeConf(b) {
+		switch tok.Text {
+		case "{":
+			if len(stmt) == 1 && stmt[0] == "http" && depth == 0 && start < 0 {
+				httpDepth = depth + 1
+				start = tok.Off + 1
+			}
+			depth++
+			stmt = nil
+		case "}":
+			if depth == httpDepth && end < 0 {
+				end = tok.Off
+			}
+			depth--
+			stmt = nil
+		case ";":
+			stmt = nil
+		default:
+			stmt = append(stmt, tok.Text)
+		}
+	}
+	if start < 0 || end < 0 {
+		return "", fmt.Errorf("no http { } block found in %s", m.MainConf)
+	}
+
+	bak := filepath.Join(m.BackupDir, filepath.Base(m.MainConf)+"."+time.Now().Format("20060102-150405")+".bak")
+	if err := util.WriteFileAtomic(bak, b, 0644); err != nil {
+		return "", fmt.Errorf("write backup %s: %w", bak, err)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(b[:start])
+	if needGlobal {
+		fmt.Fprintf(&buf, "\n    # Global zones, maps and log formats (managed by NGM)\n    include %s/*.conf;", m.GlobalDir)
+	}
+	body := b[start:end]
+	if needSites {
+		buf.Write(bytes.TrimRight(body, " \t\r\n"))
+		fmt.Fprintf(&buf, "\n\n    # Generated vhosts (managed by NGM)\n    include %s/*.conf;\n", m.SitesDir)
+	} else {
+		buf.Write(body)
+	}
+	buf.Write(b[end:])
+
+	if err := util.WriteFileAtomic(m.MainConf, buf.Bytes(), fi.Mode().Perm()); err != nil {
+		return bak, fmt.Errorf("write %s: %w", m.MainConf, err)
+	}
+	return bak, nil
+}
+
+// RestoreMainConf puts back a backup written by WireSites.
+func (m *Manager) RestoreMainConf(bak string) error {
+	b, err := os.ReadFile(bak)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(m.MainConf, b, 0644)
+}
@@ -0,0 +1,66 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mynginx/internal/util"
+)
+
+// WriteLintConf writes dir/nginx.conf: a minimal main config that loads the cache
+// zones of the global template (kept under dir/cache) and the vhost file site, so
+// `nginx -t` can check one render without touching the live config. fastcgi_params
+// is copied from the live conf dir (empty when there is none). It returns the
+// path of the written nginx.conf.
+func (m *Manager) WriteLintConf(dir, site string) (string, error) {
+	tpl, err := parseGlobalTemplate()
+	if err != nil {
+		return "", err
+	}
+	var zones bytes.Buffer
+	if err := tpl.ExecuteTemplate(&zones, "20-zones.conf", GlobalTemplateData{CacheRoot: filepath.Join(dir, "cache")}); err != nil {
+		return "", fmt.Errorf("execute template 20-zones.conf: %w", err)
+	}
+
+	params, err := os.ReadFile(filepath.Join(filepath.Dir(m.MainConf), "fastcgi_params"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := util.WriteFileAtomic(filepath.Join(dir, "fastcgi_params"), params, 0644); err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# ngm template lint sandbox\n")
+	fmt.Fprintf(&b, "pid %s;\n", filepath.Join(dir, "nginx.pid"))
+	fmt.Fprintf(&b, "error_log %s;\n\n", filepath.Join(dir, "error.log"))
+	fmt.Fprintf(&b, "events {}\n\nhttp {\n")
+	b.Write(bytes.TrimSpace(zones.Bytes()))
+	fmt.Fprintf(&b, "\n\ninclude %s;\n}\n", site)
+
+	conf := filepath.Join(dir, "nginx.conf")
+	if err := util.WriteFileAtomic(conf, b.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	return conf, nil
+}
+
+// TestConfigAt runs nginx -t on a sandbox config from WriteLintConf, with the
+// sandbox as prefix so temp paths are created there.
+func (m *Manager) TestConfigAt(conf string) error {
+	prefix := filepath.Dir(conf) + "/"
+	res, err := m.run(m.TestTimeout, "-t", "-p", prefix, "-c", conf)
+	if err != nil {
+		return &CmdOutputError{
+			Cmd:    m.Bin + " -t -p " + prefix + " -c " + conf,
+			Stdout: res.Stdout,
+			Stderr: res.Stderr,
+			Err:    err,
+
+			configTest: true,
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package nginx
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 	"bytes"
         "mynginx/internal/util"
 	"strings"
+	"sync/atomic"
 
 )
 
@@ -19,6 +22,20 @@ type Manager struct {
 	SitesDir  string
 	StageDir  string
 	BackupDir string
+	GlobalDir string // managed global snippets (conf/ngm.d); "" = disabled
+
+	// BackupKeep is how many vhost backups are kept per domain (0 = DefaultBackupKeep).
+	BackupKeep int
+
+	// Runner executes nginx -t / -s reload (util.ExecRunner by default).
+	Runner util.Runner
+
+	TestTimeout   time.Duration
+	ReloadTimeout time.Duration
+
+	// reloads / reloadFails count Reload calls of this process (/metrics)
+	reloads     atomic.Int64
+	reloadFails atomic.Int64
 }
 
 func NewManager(root, bin, mainConf, sitesDir, stageDir, backupDir string) *Manager {
@@ -29,9 +46,19 @@ func NewManager(root, bin, mainConf, sitesDir, stageDir, backupDir string) *Mana
 		SitesDir:  sitesDir,
 		StageDir:  stageDir,
 		BackupDir: backupDir,
+		Runner:    util.ExecRunner{},
+
+		TestTimeout:   10 * time.Second,
+		ReloadTimeout: 10 * time.Second,
 	}
 }
 
+func (m *Manager) run(timeout time.Duration, args ...string) (util.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.Runner.Run(ctx, m.Bin, args...)
+}
+
 // EnsureLayout creates the required directories for generated configs.
 // It does NOT write configs yet.
 func (m *Manager) EnsureLayout() error {
@@ -39,6 +66,7 @@ func (m *Manager) EnsureLayout() error {
 		m.SitesDir,
 		m.StageDir,
 		m.BackupDir,
+		m.GlobalDir,
 	}
 
 	for _, d := range dirs {
@@ -60,11 +88,22 @@ func (m *Manager) EnsureLayout() error {
 }
 
 
+// ErrConfigTest matches (errors.Is) the error of a failed TestConfig.
+var ErrConfigTest = errors.New("nginx configuration test failed")
+
 type CmdOutputError struct {
     Cmd    string
     Stdout string
     Stderr string
     Err    error
+
+    configTest bool
+}
+
+func (e *CmdOutputError) Unwrap() error { return e.Err }
+
+func (e *CmdOutputError) Is(target error) bool {
+    return target == ErrConfigTest && e.configTest
 }
 
 func (e *CmdOutputError) Error() string {
@@ -85,7 +124,7 @@ func (e *CmdOutputError) Error() string {
 //apply test config
 func (m *Manager) TestConfig() error {
         // Use -c explicitly to avoid relying on cwd/defaults.
-        res, err := util.Run(10*time.Second, m.Bin, "-t", "-c", m.MainConf)
+        res, err := m.run(m.TestTimeout, "-t", "-c", m.MainConf)
 
     if err != nil {
         return &CmdOutputError{
@@ -93,6 +132,8 @@ func (m *Manager) TestConfig() error {
             Stdout: res.Stdout,
             Stderr: res.Stderr,
             Err:    err,
+
+            configTest: true,
         }
     }
     return nil
@@ -101,64 +142,82 @@ func (m *Manager) TestConfig() error {
 
 // RemoveLiveSite removes the live vhost file and keeps a backup in BackupDir.
 // It does NOT reload. Batch apply will Test+Reload once at the end.
-func (m *Manager) RemoveLiveSite(domain string) error {
+// removed is false when there was no live file.
+func (m *Manager) RemoveLiveSite(domain string) (removed bool, err error) {
         dst := filepath.Join(m.SitesDir, domain+".conf")
-        bak := filepath.Join(m.BackupDir, domain+".conf.bak")
 
         // nothing to remove
         if _, err := os.Stat(dst); err != nil {
                 if os.IsNotExist(err) {
-                        return nil
+                        return false, nil
                 }
-                return fmt.Errorf("stat live %s: %w", dst, err)
+                return false, fmt.Errorf("stat live %s: %w", dst, err)
         }
 
         // backup existing
         old, err := os.ReadFile(dst)
         if err != nil {
-                return fmt.Errorf("read live %s: %w", dst, err)
+                return false, fmt.Errorf("read live %s: %w", dst, err)
         }
-        if err := util.WriteFileAtomic(bak, old, 0644); err != nil {
-                return fmt.Errorf("write backup %s: %w", bak, err)
+        if err := m.backupSite(domain, old); err != nil {
+                return false, fmt.Errorf("write backup of %s: %w", domain, err)
         }
 
         // remove live
         if err := os.Remove(dst); err != nil {
-                return fmt.Errorf("remove live %s: %w", dst, err)
+                return false, fmt.Errorf("remove live %s: %w", dst, err)
         }
-        return nil
+        return true, nil
 }
 
+// RestoreFromBackup puts back the newest good backup of each domain's live vhost
+// (or removes the live file when there is no backup). Used to roll back a failed apply.
+func (m *Manager) RestoreFromBackup(domains ...string) {
+        for _, d := range domains {
+                m.restoreSite(d)
+        }
+}
 
 
-func (m *Manager) RenderSiteToStaging(site SiteTemplateData) (string, []byte, error) {
+
+// RenderSite renders the vhost of site without staging it (scheduled re-renders
+// compare it with the last applied hash).
+func (m *Manager) RenderSite(site SiteTemplateData) ([]byte, error) {
         if site.Domain == "" {
-                return "", nil, fmt.Errorf("site.Domain is required")
+                return nil, fmt.Errorf("site.Domain is required")
         }
         if site.Mode == "" {
                 site.Mode = "php"
         }
         if site.ACMEWebroot == "" {
-                return "", nil, fmt.Errorf("site.ACMEWebroot is required")
+                return nil, fmt.Errorf("site.ACMEWebroot is required")
         }
         if site.Webroot == "" {
-                return "", nil, fmt.Errorf("site.Webroot is required")
+                return nil, fmt.Errorf("site.Webroot is required")
         }
         if site.TLSCert == "" || site.TLSKey == "" {
-                return "", nil, fmt.Errorf("site TLSCert/TLSKey are required")
+                return nil, fmt.Errorf("site TLSCert/TLSKey are required")
         }
 
         site.UpstreamKey = MakeUpstreamKey(site.Domain)
 
         tplPath := filepath.Join("internal", "nginx", "templates", "site.tmpl")
-        tpl, err := template.ParseFiles(tplPath)
+        tpl, err := template.New(filepath.Base(tplPath)).Funcs(util.TemplateFuncs()).ParseFiles(tplPath)
         if err != nil {
-                return "", nil, fmt.Errorf("parse template %s: %w", tplPath, err)
+                return nil, fmt.Errorf("parse template %s: %w", tplPath, err)
         }
 
         var buf bytes.Buffer
         if err := tpl.Execute(&buf, site); err != nil {
-                return "", nil, fmt.Errorf("execute template: %w", err)
+                return nil, fmt.Errorf("execute template: %w", err)
+        }
+        return buf.Bytes(), nil
+}
+
+func (m *Manager) RenderSiteToStaging(site SiteTemplateData) (string, []byte, error) {
+        content, err := m.RenderSite(site)
+        if err != nil {
+                return "", nil, err
         }
 
         outDir := filepath.Join(m.StageDir, "sites")
@@ -167,27 +226,60 @@ func (m *Manager) RenderSiteToStaging(site SiteTemplateData) (string, []byte, er
         }
 
         outPath := filepath.Join(outDir, site.Domain+".conf")
-        if err := util.WriteFileAtomic(outPath, buf.Bytes(), 0644); err != nil {
+        if err := util.WriteFileAtomic(outPath, content, 0644); err != nil {
                 return "", nil, err
         }
-        return outPath, buf.Bytes(), nil
+        return outPath, content, nil
 }
 
 
 
 
-// Publish copies a staged site config into the live sites directory.
-// It creates/updates a backup file when the live file exists.
-// It returns changed=false if the live file already matches the staged content.
-func (m *Manager) Publish(domain string) (bool, error) {
+// SiteConfPaths returns the live vhost file of domain and its last staged render.
+func (m *Manager) SiteConfPaths(domain string) (live, staged string) {
+        return filepath.Join(m.SitesDir, domain+".conf"), filepath.Join(m.StageDir, "sites", domain+".conf")
+}
+
+// Publish copies a staged site config into the live sites directory, under the
+// header of st (none when st.Time is zero). The live file becomes the newest backup.
+// It returns changed=false if the live file already has the staged content; the
+// stamp alone is not a change, so the header keeps naming the run that wrote it.
+func (m *Manager) Publish(domain string, st Stamp) (bool, error) {
         if domain == "" {
                 return false, fmt.Errorf("domain is required")
         }
 
         src := filepath.Join(m.StageDir, "sites", domain+".conf")
         dst := filepath.Join(m.SitesDir, domain+".conf")
-        bak := filepath.Join(m.BackupDir, domain+".conf.bak")
+        data, err := os.ReadFile(src)
+        if err != nil {
+                return false, fmt.Errorf("read staging %s: %w", src, err)
+        }
+
+        // the live vhost (nil when there is none) becomes the newest backup
+        live, err := os.ReadFile(dst)
+        if err == nil && bytes.Equal(StripStamp(live), data) {
+                return false, nil
+        }
+        if err != nil && !os.IsNotExist(err) {
+                return false, fmt.Errorf("read live %s: %w", dst, err)
+        }
+        if err := m.backupSite(domain, live); err != nil {
+                return false, fmt.Errorf("write backup of %s: %w", domain, err)
+        }
 
+        if !st.Time.IsZero() {
+                data = append(st.header(data, dst), data...)
+        }
+        if err := util.WriteFileAtomic(dst, data, 0644); err != nil {
+                return false, fmt.Errorf("publish %s: %w", dst, err)
+        }
+        return true, nil
+}
+
+// publishFile atomically replaces dst with src, keeping the previous dst in bak.
+// It returns changed=false if dst already matches src.
+func publishFile(src, dst, bak string) (bool, error) {
         data, err := os.ReadFile(src)
         if err != nil {
                 return false, fmt.Errorf("read staging %s: %w", src, err)
@@ -224,7 +316,11 @@ func (m *Manager) Publish(domain string) (bool, error) {
 
 func (m *Manager) Reload() error {
         // MVP: only "signal" for now; we can add systemd mode later using cfg.Nginx.Apply.ReloadMode
-        res, err := util.Run(10*time.Second, m.Bin, "-s", "reload")
+        res, err := m.run(m.ReloadTimeout, "-s", "reload")
+        m.reloads.Add(1)
+        if err != nil {
+                m.reloadFails.Add(1)
+        }
         if res.Stdout != "" {
                 fmt.Print(res.Stdout)
         }
@@ -234,3 +330,8 @@ func (m *Manager) Reload() error {
         return err
 }
 
+// ReloadCounts returns how many reloads this process ran and how many failed.
+func (m *Manager) ReloadCounts() (total, failed int64) {
+	return m.reloads.Load(), m.reloadFails.Load()
+}
+
@@ -0,0 +1,182 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// DynamicModule is a dynamic nginx module the panel can load.
+type DynamicModule struct {
+	Name  string
+	Files []string // shared objects in the modules dir, loaded in this order
+	Build string   // part of an nginx -V --add-module path when compiled in
+}
+
+// DynamicModules are the modules `ngm nginx modules` knows about.
+var DynamicModules = []DynamicModule{
+	{Name: "brotli", Files: []string{"ngx_http_brotli_filter_module.so", "ngx_http_brotli_static_module.so"}, Build: "brotli"},
+	{Name: "geoip2", Files: []string{"ngx_http_geoip2_module.so"}, Build: "geoip2"},
+	{Name: "modsecurity", Files: []string{"ngx_http_modsecurity_module.so"}, Build: "modsecurity"},
+}
+
+// ModuleCap is what this nginx offers for a module.
+type ModuleCap struct {
+	DynamicModule
+	Dir       string // modules dir the files are looked up in
+	Installed bool   // every file of the module is in Dir
+	BuiltIn   bool   // compiled into the binary: there is nothing to load
+}
+
+const modulesHeader = "# Managed by NGM (ngm nginx modules) - manual edits will be overwritten\n"
+
+// ModulesConf is the managed include of load_module lines, next to MainConf. It is
+// included at the top of MainConf (main context, before events and http).
+func (m *Manager) ModulesConf() string {
+	return filepath.Join(filepath.Dir(m.MainConf), "ngm-modules.conf")
+}
+
+// ModuleCaps runs nginx -V and reports, for each of DynamicModules, whether it is
+// compiled in or its shared objects are installed in the modules dir
+// (--modules-path, else <prefix>/modules).
+func (m *Manager) ModuleCaps() ([]ModuleCap, error) {
+	res, err := m.run(m.TestTimeout, "-V")
+	if err != nil {
+		return nil, &CmdOutputError{Cmd: m.Bin + " -V", Stdout: res.Stdout, Stderr: res.Stderr, Err: err}
+	}
+	// nginx -V prints to stderr
+	build := res.Stderr + "\n" + res.Stdout
+	dir := configureArg(build, "--modules-path")
+	if dir == "" {
+		prefix := configureArg(build, "--prefix")
+		if prefix == "" {
+			prefix = m.Root
+		}
+		dir = filepath.Join(prefix, "modules")
+	}
+
+	var out []ModuleCap
+	for _, mod := range DynamicModules {
+		c := ModuleCap{DynamicModule: mod, Dir: dir, Installed: true}
+		for _, f := range mod.Files {
+			if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+				c.Installed = false
+			}
+		}
+		for _, f := range strings.Fields(build) {
+			if strings.HasPrefix(f, "--add-module=") && strings.Contains(f, mod.Build) {
+				c.BuiltIn = true
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// configureArg returns the value of --name=value in nginx -V output ("" if absent).
+func configureArg(build, name string) string {
+	for _, f := range strings.Fields(build) {
+		if v, ok := strings.CutPrefix(f, name+"="); ok {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
+
+// PublishModulesConf writes the load_module lines of caps into ModulesConf,
+// keeping the previous file in BackupDir for RestoreModulesConf.
+func (m *Manager) PublishModulesConf(caps []ModuleCap) error {
+	var b bytes.Buffer
+	b.WriteString(modulesHeader)
+	for _, c := range caps {
+		fmt.Fprintf(&b, "\n# %s\n", c.Name)
+		for _, f := range c.Files {
+			fmt.Fprintf(&b, "load_module %s;\n", filepath.Join(c.Dir, f))
+		}
+	}
+	dst := m.ModulesConf()
+	bak := filepath.Join(m.BackupDir, filepath.Base(dst)+".bak")
+	old, err := os.ReadFile(dst)
+	switch {
+	case err == nil:
+		if err := util.WriteFileAtomic(bak, old, 0644); err != nil {
+			return fmt.Errorf("write backup %s: %w", bak, err)
+		}
+	case os.IsNotExist(err):
+		_ = os.Remove(bak)
+	default:
+		return fmt.Errorf("read %s: %w", dst, err)
+	}
+	return util.WriteFileAtomic(dst, b.Bytes(), 0644)
+}
+
+// RestoreModulesConf puts back the file PublishModulesConf replaced (or removes
+// ModulesConf when there was none), after a failed nginx test or reload.
+func (m *Manager) RestoreModulesConf() {
+	dst := m.ModulesConf()
+	bak := filepath.Join(m.BackupDir, filepath.Base(dst)+".bak")
+	if data, err := os.ReadFile(bak); err == nil {
+		_ = util.WriteFileAtomic(dst, data, 0644)
+		return
+	}
+	_ = os.Remove(dst)
+}
+
+// WireModules inserts `include <ModulesConf>;` at the top of MainConf unless a
+// top-level include already matches it. A timestamped backup is kept in BackupDir;
+// it returns its path ("" when the include was already there). The caller
+// tests/reloads nginx.
+func (m *Manager) WireModules() (string, error) {
+	fi, err := os.Stat(m.MainConf)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(m.MainConf)
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", m.MainConf, err)
+	}
+
+	conf := m.ModulesConf()
+	depth := 0
+	var stmt []string
+	for _, tok := range tokenizeConf(b) {
+		switch tok.Text {
+		case "{":
+			depth++
+			stmt = nil
+		case "}":
+			depth--
+			stmt = nil
+		case ";":
+			if depth == 0 && len(stmt) == 2 && stmt[0] == "include" {
+				pattern := stmt[1]
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(m.MainConf), pattern)
+				}
+				if ok, _ := filepath.Match(filepath.Clean(pattern), conf); ok {
+					return "", nil
+				}
+			}
+			stmt = nil
+		default:
+			stmt = append(stmt, tok.Text)
+		}
+	}
+
+	bak := filepath.Join(m.BackupDir, filepath.Base(m.MainConf)+"."+time.Now().Format("20060102-150405")+".bak")
+	if err := util.WriteFileAtomic(bak, b, 0644); err != nil {
+		return "", fmt.Errorf("write backup %s: %w", bak, err)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Dynamic modules (managed by NGM)\ninclude %s;\n\n", conf)
+	buf.Write(b)
+	if err := util.WriteFileAtomic(m.MainConf, buf.Bytes(), fi.Mode().Perm()); err != nil {
+		return bak, fmt.Errorf("write %s: %w", m.MainConf, err)
+	}
+	return bak, nil
+}
@@ -0,0 +1,33 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+
+	"mynginx/internal/util"
+)
+
+// PlaceholderData feeds the placeholder page template (templates/placeholder.html
+// or hosting.placeholder.template).
+type PlaceholderData struct {
+	Domain string
+}
+
+// RenderPlaceholder renders the "coming soon" page of a site. tplPath "" is the
+// built-in template.
+func RenderPlaceholder(tplPath string, data PlaceholderData) ([]byte, error) {
+	if tplPath == "" {
+		tplPath = filepath.Join("internal", "nginx", "templates", "placeholder.html")
+	}
+	tpl, err := template.New(filepath.Base(tplPath)).Funcs(template.FuncMap(util.TemplateFuncs())).ParseFiles(tplPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse placeholder template %s: %w", tplPath, err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("execute placeholder template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,109 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MasterPID returns the pid recorded in pidFile when that process is alive.
+func MasterPID(pidFile string) (int, bool) {
+	b, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	// signal 0 only checks existence; EPERM still means the process is there
+	if err := syscall.Kill(pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// clockTicks is USER_HZ, the unit of the start time in /proc/<pid>/stat (100 on
+// every Linux architecture nginx runs on).
+const clockTicks = 100
+
+// ProcessStart returns when process pid started, from /proc (false where there is
+// no /proc or the process is gone).
+func ProcessStart(pid int) (time.Time, bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return time.Time{}, false
+	}
+	// the fields after "(comm)": state is field 3, starttime field 22
+	i := strings.LastIndexByte(string(stat), ')')
+	if i < 0 {
+		return time.Time{}, false
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return time.Time{}, false
+	}
+	ticks, err := strconv.ParseInt(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	boot, ok := bootTime()
+	if !ok {
+		return time.Time{}, false
+	}
+	return boot.Add(time.Duration(ticks) * time.Second / clockTicks), true
+}
+
+// bootTime reads the btime line of /proc/stat.
+func bootTime() (time.Time, bool) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return time.Time{}, false
+			}
+			return time.Unix(sec, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Version runs nginx -v and returns the version it prints ("nginx/1.26.2").
+func (m *Manager) Version() (string, error) {
+	res, err := m.run(m.TestTimeout, "-v")
+	if err != nil {
+		return "", &CmdOutputError{Cmd: m.Bin + " -v", Stdout: res.Stdout, Stderr: res.Stderr, Err: err}
+	}
+	// "nginx version: nginx/1.26.2", on stderr
+	out := strings.TrimSpace(res.Stderr + "\n" + res.Stdout)
+	if _, v, ok := strings.Cut(out, "version:"); ok {
+		out = v
+	}
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(out), "\n", 2)[0]), nil
+}
+
+// Start launches the nginx master with the managed main config.
+func (m *Manager) Start() error {
+	res, err := m.run(m.ReloadTimeout, "-c", m.MainConf)
+	if err != nil {
+		return &CmdOutputError{Cmd: m.Bin + " -c " + m.MainConf, Stdout: res.Stdout, Stderr: res.Stderr, Err: err}
+	}
+	return nil
+}
+
+// Stop asks the nginx master to shut down (fast stop).
+func (m *Manager) Stop() error {
+	res, err := m.run(m.ReloadTimeout, "-s", "stop")
+	if err != nil {
+		return &CmdOutputError{Cmd: m.Bin + " -s stop", Stdout: res.Stdout, Stderr: res.Stderr, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// RetiredData feeds the retired page template (templates/retired.html or
+// hosting.retired.template).
+type RetiredData struct {
+	Domain string
+	Status int // 410 (gone) or 503 (unavailable)
+	Until  time.Time
+}
+
+// RenderRetired renders the page a gracefully disabled site serves during its grace
+// period. tplPath "" is the built-in template.
+func RenderRetired(tplPath string, data RetiredData) ([]byte, error) {
+	if tplPath == "" {
+		tplPath = filepath.Join("internal", "nginx", "templates", "retired.html")
+	}
+	tpl, err := template.New(filepath.Base(tplPath)).Funcs(template.FuncMap(util.TemplateFuncs())).ParseFiles(tplPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse retired template %s: %w", tplPath, err)
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("execute retired template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
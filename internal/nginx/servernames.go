@@ -0,0 +1,84 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ServerName is a name a server block of the loaded configuration answers to.
+type ServerName struct {
+	Name string // lower-cased, without a trailing dot
+	File string
+}
+
+// ServerNames returns the server_name values of the server blocks nginx loads:
+// those of MainConf and of every file it includes (max depth 5), in load order.
+// Catch-all ("_", ""), regex ("~...") and single-label names (localhost) are left
+// out: they are never a site's name.
+func (m *Manager) ServerNames() ([]ServerName, error) {
+	var out []ServerName
+	if err := m.serverNames(m.MainConf, false, 0, map[string]bool{}, &out); err != nil {
+		return nil, fmt.Errorf("read %s: %w", m.MainConf, err)
+	}
+	return out, nil
+}
+
+// serverNames appends the server_name values of file to out, following its
+// includes. inServer is true when file is included from within a server block.
+func (m *Manager) serverNames(file string, inServer bool, depth int, seen map[string]bool, out *[]ServerName) error {
+	if depth > 5 || seen[file] {
+		return nil
+	}
+	seen[file] = true
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var stack []string // enclosing block names
+	var stmt []string  // words of the current directive
+	for _, tok := range tokenizeConf(b) {
+		switch tok.Text {
+		case "{":
+			name := ""
+			if len(stmt) > 0 {
+				name = stmt[0]
+			}
+			stack = append(stack, name)
+			stmt = nil
+		case "}":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			stmt = nil
+		case ";":
+			server := (inServer && len(stack) == 0) || (len(stack) > 0 && stack[len(stack)-1] == "server")
+			switch {
+			case len(stmt) > 1 && stmt[0] == "server_name" && server:
+				for _, n := range stmt[1:] {
+					n = strings.TrimSuffix(strings.ToLower(n), ".")
+					if strings.HasPrefix(n, "~") || !strings.Contains(strings.Trim(n, "."), ".") {
+						continue
+					}
+					*out = append(*out, ServerName{Name: n, File: file})
+				}
+			case len(stmt) == 2 && stmt[0] == "include":
+				pattern := stmt[1]
+				if !filepath.IsAbs(pattern) {
+					pattern = filepath.Join(filepath.Dir(m.MainConf), pattern)
+				}
+				matches, _ := filepath.Glob(pattern)
+				for _, f := range matches {
+					// an unreadable include is nginx -t's to report, not ours
+					_ = m.serverNames(f, server, depth+1, seen, out)
+				}
+			}
+			stmt = nil
+		default:
+			stmt = append(stmt, tok.Text)
+		}
+	}
+	return nil
+}
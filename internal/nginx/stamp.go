@@ -0,0 +1,75 @@
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// stampPrefix starts every header line Publish puts on a vhost.
+const stampPrefix = "# ngm-stamp "
+
+// Stamp says who published a vhost and when. Publish writes it as a comment header
+// above the rendered config, so a file found on disk can be traced back to the
+// apply run that wrote it (the render hash is the reverse-index key).
+type Stamp struct {
+	RenderHash string // sha256 of the rendered config below the header
+	Time       time.Time
+	Actor      string // panel user, unix user or "ngm" for background applies
+	Version    string // ngm version
+}
+
+// header renders the stamp of body as comment lines; dst is the file it goes into.
+func (st Stamp) header(body []byte, dst string) []byte {
+	actor := strings.Join(strings.Fields(st.Actor), "_")
+	if actor == "" {
+		actor = "-"
+	}
+	version := strings.Join(strings.Fields(st.Version), "_")
+	if version == "" {
+		version = "dev"
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%srender=%s applied=%s actor=%s ngm=%s\n",
+		stampPrefix, util.Sha256Hex(body), st.Time.UTC().Format(time.RFC3339), actor, version)
+	fmt.Fprintf(&b, "%strace: ngm site origin --file %s\n", stampPrefix, dst)
+	return b.Bytes()
+}
+
+// StripStamp returns data without its stamp header: the config as it was rendered.
+func StripStamp(data []byte) []byte {
+	for bytes.HasPrefix(data, []byte(stampPrefix)) {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		data = data[i+1:]
+	}
+	return data
+}
+
+// ParseStamp reads the stamp header of a published vhost; ok is false for a file
+// without one (published before stamping, or not written by ngm).
+func ParseStamp(data []byte) (st Stamp, ok bool) {
+	if !bytes.HasPrefix(data, []byte(stampPrefix)) {
+		return Stamp{}, false
+	}
+	line, _, _ := bytes.Cut(data[len(stampPrefix):], []byte("\n"))
+	for _, f := range strings.Fields(string(line)) {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "render":
+			st.RenderHash = v
+		case "applied":
+			st.Time, _ = time.Parse(time.RFC3339, v)
+		case "actor":
+			st.Actor = v
+		case "ngm":
+			st.Version = v
+		}
+	}
+	return st, st.RenderHash != ""
+}
@@ -21,6 +21,16 @@ type UpstreamTarget struct {
 	Weight int
 	Backup  bool
 	Enabled bool
+	Group   string // blue/green group name; "" = always rendered
+	// Discovered targets come from the site's DNS SRV / Consul lookup and are
+	// replaced on every change of membership.
+	Discovered bool
+}
+
+// MirrorCfg copies a share of requests to a shadow upstream; its responses are discarded.
+type MirrorCfg struct {
+	Target  string // "10.0.0.20:8080" or "unix:/run/shadow.sock"; "" = off
+	Percent int    // 1..100
 }
 
 type ProxyCfg struct {
@@ -35,28 +45,178 @@ type ProxyCfg struct {
 
 	Microcache CacheCfg
         StaticCache CacheCfg
+
+	Mirror MirrorCfg
+
+	// Keepalive is the idle connection pool to the targets (Connections 0 = a new
+	// connection per request).
+	Keepalive KeepaliveCfg
+
+	// Health exposes the backend's health endpoint to monitors (Location "" = not exposed).
+	Health HealthCfg
+}
+
+// HealthCfg is the internal-only location that passes to the backend's health
+// endpoint: Location on the vhost, Path on the targets, reachable from Allow only.
+type HealthCfg struct {
+	Location string
+	Path     string
+	Allow    []string
 }
 
+// KeepaliveCfg is the upstream keepalive pool: idle connections kept per worker,
+// requests per connection, and the idle timeout (nginx time, e.g. "60s").
+type KeepaliveCfg struct {
+	Connections int
+	Requests    int
+	Timeout     string
+}
+
+// HeaderCfg is a per-site response header: added with add_header, or (Hide) stripped
+// from FastCGI/proxied responses.
+type HeaderCfg struct {
+	Name  string
+	Value string // may use nginx variables ($host, ...)
+	Hide  bool
+}
+
+// QuotedValue is Value as an nginx double-quoted string.
+func (h HeaderCfg) QuotedValue() string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(h.Value) + `"`
+}
+
+// RetiredCfg is the grace period of a disabled site: Status (410 or 503) with the
+// retired.html page in Root until Until (RFC 3339, shown in the X-Site-Retired header).
+type RetiredCfg struct {
+	Status int
+	Root   string
+	Until  string
+}
+
+// RedirectCfg sends every request of a redirect site to Target (validated to need no
+// quoting); KeepPath appends the request URI.
+type RedirectCfg struct {
+	Code     int
+	Target   string
+	KeepPath bool
+}
+
+// Location is the redirect target of a request, for `return <code> <location>`.
+func (r RedirectCfg) Location() string {
+	if r.KeepPath {
+		return strings.TrimRight(r.Target, "/") + "$request_uri"
+	}
+	return r.Target
+}
+
+// PreloadCfg is a resource announced with Link: rel=preload on page responses.
+type PreloadCfg struct {
+	URL         string
+	As          string
+	Crossorigin bool
+}
+
+// SiteTemplateData feeds templates/site.tmpl. Its fields are a stable contract for
+// custom templates: add, never rename or remove.
 type SiteTemplateData struct {
 	Domain         string
-	Mode           string // "php" | "proxy" | "static"
+	Mode           string // "php" | "proxy" | "static" | "redirect"
 	Webroot        string
 	ACMEWebroot    string
 	EnableHTTP3    bool
 	TLSCert        string
 	TLSKey         string
+	TLSCertAlt     string // second cert of the other key type (dual RSA+ECDSA); "" = single cert
+	TLSKeyAlt      string
 	FrontController bool
 
 	// Per-site logs (recommended)
 	AccessLog string
 	ErrorLog  string
 
-	PHP   FastCGICfg
-	Proxy ProxyCfg
+	// UpstreamLog (proxy mode) gets one line per request with the upstream
+	// attempts in stats.UpstreamLogFormat ("" = not written)
+	UpstreamLog       string
+	UpstreamLogFormat string
+
+	// AccessSyslog also ships the access log to syslog:server= ("" = file only)
+	AccessSyslog         string
+	AccessSyslogFacility string
+	AccessSyslogTag      string
+
+	// AccessSample thins the access log (file and syslog) of a busy site; the zero
+	// value logs every request. The upstream log is never sampled.
+	AccessSample AccessSampleCfg
+
+	// Headers are added to / hidden from every response; ServerTokensOff drops
+	// the nginx version from the Server header and error pages.
+	Headers         []HeaderCfg
+	ServerTokensOff bool
+
+	// Preloads are announced on the page (php / proxied) responses only; CDNs in
+	// front turn the Link header into a 103 Early Hints response.
+	Preloads []PreloadCfg
+
+	// Vars are the site's own template variables (`ngm site var`), for custom
+	// templates and snippets: {{ .Vars.name }}, {{ index .Vars "name" | default "x" }}.
+	// Values are raw text: pipe them through quote where nginx wants one argument.
+	Vars map[string]string
+
+	// Placeholder is the directory of the "coming soon" index.html served instead of
+	// the webroot while it is empty ("" = serve the site normally).
+	Placeholder string
+
+	// Retired answers every request with the retired page of a gracefully disabled
+	// site (Status 0 = serve the site normally).
+	Retired RetiredCfg
+
+	// Hardened (php) denies PHP in upload directories and PATH_INFO execution, and
+	// blanks the HTTP_PROXY (httpoxy), PHP_VALUE and PHP_ADMIN_VALUE params.
+	Hardened bool
+
+	// Preview also serves the site on a temporary hostname (Host "" = none).
+	Preview PreviewCfg
+
+	PHP      FastCGICfg
+	Proxy    ProxyCfg
+	Redirect RedirectCfg
 
 	UpstreamKey string
 }
 
+// PreviewCfg is the preview hostname of a site (`ngm preview`) and the certificate
+// served for it: its own Let's Encrypt lineage, self-signed until that is issued.
+type PreviewCfg struct {
+	Host    string
+	TLSCert string
+	TLSKey  string
+}
+
+// PreviewSite is the site as served on its preview hostname: the same vhost body
+// under Preview.Host, with the preview certificate (single, never dual).
+func (d SiteTemplateData) PreviewSite() SiteTemplateData {
+	p := d
+	p.Domain = d.Preview.Host
+	p.TLSCert, p.TLSKey = d.Preview.TLSCert, d.Preview.TLSKey
+	p.TLSCertAlt, p.TLSKeyAlt = "", ""
+	p.Preview = PreviewCfg{}
+	return p
+}
+
+// PreloadLink is the Link header value announcing every preload, as an nginx
+// double-quoted string (URLs are validated to need no escaping).
+func (d SiteTemplateData) PreloadLink() string {
+	parts := make([]string, 0, len(d.Preloads))
+	for _, p := range d.Preloads {
+		v := "<" + p.URL + ">; rel=preload; as=" + p.As
+		if p.Crossorigin {
+			v += "; crossorigin"
+		}
+		parts = append(parts, v)
+	}
+	return `"` + strings.Join(parts, ", ") + `"`
+}
+
 var nonIdent = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
 
 func MakeUpstreamKey(domain string) string {
@@ -70,3 +230,55 @@ func MakeUpstreamKey(domain string) string {
 	}
 	return s
 }
+
+// AccessSampleCfg logs only 4xx/5xx responses (ErrorsOnly), or those plus Percent
+// of the rest (split_clients on the request id, e.g. "1.00%"). Neither set = all.
+type AccessSampleCfg struct {
+	ErrorsOnly bool
+	Percent    string
+}
+
+// On reports whether the access log is sampled.
+func (c AccessSampleCfg) On() bool { return c.ErrorsOnly || c.Percent != "" }
+
+// GlobalTemplateData feeds templates/global.tmpl (the managed conf/ngm.d snippets);
+// a stable contract like SiteTemplateData.
+type GlobalTemplateData struct {
+	CacheRoot     string // "" = cache zones are defined elsewhere
+	RateLimits    []RateLimitZone
+	RealIP        RealIPCfg
+	Geo           []GeoMap
+	LogFormats    []LogFormat // sorted by name
+	DefaultServer bool
+	ACMEWebroot   string
+	StatusListen  string // loopback stub_status listener ("" = none)
+}
+
+type RateLimitZone struct {
+	Name string
+	Key  string
+	Size string
+	Rate string
+}
+
+type RealIPCfg struct {
+	Header    string
+	From      []string
+	Recursive bool
+}
+
+type GeoMap struct {
+	Var     string
+	Default string
+	Entries []GeoEntry // sorted by CIDR
+}
+
+type GeoEntry struct {
+	CIDR  string
+	Value string
+}
+
+type LogFormat struct {
+	Name   string
+	Format string
+}
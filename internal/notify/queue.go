@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/config"
+	"mynginx/internal/store"
+)
+
+// MailStore persists the mail queue (the sqlite store).
+type MailStore interface {
+	EnqueueMail(to, subject, body string, next time.Time) (int64, error)
+	GetMail(id int64) (store.MailMessage, error)
+	DueMail(now time.Time, limit int) ([]store.MailMessage, error)
+	SetMailResult(id int64, status, lastErr string, next *time.Time) error
+	PruneMail(before time.Time) (int64, error)
+}
+
+// mailRetries are the waits before each retry of a failed delivery; a message that
+// fails once more after the last is marked failed.
+var mailRetries = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 4 * time.Hour, 12 * time.Hour}
+
+const (
+	mailQueueInterval = 15 * time.Second
+	mailClaim         = 2 * time.Minute     // a new message is first tried by the sender; the queue waits this long
+	mailKeep          = 30 * 24 * time.Hour // sent/failed messages older than this are pruned
+)
+
+// flushMu keeps queue runs of one process from overlapping.
+var flushMu sync.Mutex
+
+// NewQueuedMailer is a Mailer that stores every message in q before sending it.
+func NewQueuedMailer(cfg config.SMTPConfig, q MailStore) *Mailer {
+	return &Mailer{cfg: cfg, queue: q}
+}
+
+// enqueue stores a message and tries it right away; if that fails, RunQueue (in
+// `ngm serve`) retries it. The first attempt is claimed for mailClaim so a queue
+// run elsewhere does not send it twice.
+func (m *Mailer) enqueue(to, subject, body string) (store.MailMessage, error) {
+	id, err := m.queue.EnqueueMail(to, subject, body, time.Now().Add(mailClaim))
+	if err != nil {
+		return store.MailMessage{}, fmt.Errorf("queue mail: %w", err)
+	}
+	msg, err := m.queue.GetMail(id)
+	if err != nil {
+		return store.MailMessage{}, fmt.Errorf("queue mail: %w", err)
+	}
+	return m.attempt(msg, true), nil
+}
+
+// attempt delivers a queued message and records the outcome: sent, retried after
+// the next mailRetries wait, or failed (retry false: failed at once).
+func (m *Mailer) attempt(msg store.MailMessage, retry bool) store.MailMessage {
+	err := m.deliver(msg.To, msg.Subject, msg.Body)
+	msg.Attempts++
+	msg.Status, msg.LastError, msg.NextAttemptAt = store.MailSent, "", nil
+	if err != nil {
+		msg.Status, msg.LastError = store.MailFailed, err.Error()
+		if retry && msg.Attempts <= len(mailRetries) {
+			next := time.Now().Add(mailRetries[msg.Attempts-1])
+			msg.Status, msg.NextAttemptAt = store.MailQueued, &next
+		} else {
+			log.Printf("mail to %s (%q) failed after %d attempt(s): %v", msg.To, msg.Subject, msg.Attempts, err)
+		}
+	}
+	if err := m.queue.SetMailResult(msg.ID, msg.Status, msg.LastError, msg.NextAttemptAt); err != nil {
+		log.Printf("mail queue %d: %v", msg.ID, err)
+	}
+	return msg
+}
+
+// Test sends a test message to to now, without retries, and returns how it went
+// (recorded in the queue when there is one).
+func (m *Mailer) Test(to string) (store.MailMessage, error) {
+	if !m.Enabled() {
+		return store.MailMessage{}, fmt.Errorf("smtp is not configured (notify.smtp.host)")
+	}
+	to = strings.TrimSpace(to)
+	if err := validRecipient(to); err != nil {
+		return store.MailMessage{}, err
+	}
+	subject := "ngm test message"
+	body := "This is a test message from ngm, sent through " + m.cfg.Host + ".\n"
+	if m.queue == nil {
+		msg := store.MailMessage{To: to, Subject: subject, Body: body, Status: store.MailSent, Attempts: 1}
+		if err := m.deliver(to, subject, body); err != nil {
+			msg.Status, msg.LastError = store.MailFailed, err.Error()
+		}
+		return msg, nil
+	}
+	id, err := m.queue.EnqueueMail(to, subject, body, time.Now().Add(mailClaim))
+	if err != nil {
+		return store.MailMessage{}, fmt.Errorf("queue mail: %w", err)
+	}
+	msg, err := m.queue.GetMail(id)
+	if err != nil {
+		return store.MailMessage{}, err
+	}
+	return m.attempt(msg, false), nil
+}
+
+// Flush tries every queued message that is due.
+func (m *Mailer) Flush(ctx context.Context) error {
+	if m.queue == nil || !m.Enabled() {
+		return nil
+	}
+	flushMu.Lock()
+	defer flushMu.Unlock()
+	due, err := m.queue.DueMail(time.Now(), 50)
+	if err != nil {
+		return err
+	}
+	for _, msg := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		m.attempt(msg, true)
+	}
+	return nil
+}
+
+// RunQueue delivers due messages every mailQueueInterval until ctx is done, drops
+// the pooled connection once idle and prunes old sent/failed messages.
+func (m *Mailer) RunQueue(ctx context.Context) {
+	if m.queue == nil {
+		return
+	}
+	t := time.NewTicker(mailQueueInterval)
+	defer t.Stop()
+	defer m.Close()
+	var pruned time.Time
+	for {
+		if err := m.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("mail queue: %v", err)
+		}
+		m.closeIdle()
+		if time.Since(pruned) > time.Hour {
+			if _, err := m.queue.PruneMail(time.Now().Add(-mailKeep)); err != nil {
+				log.Printf("mail queue: prune: %v", err)
+			}
+			pruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (m *Mailer) closeIdle() {
+	m.mu.Lock()
+	idle := m.client != nil && time.Since(m.lastUsed) > smtpIdle
+	m.mu.Unlock()
+	if idle {
+		m.Close()
+	}
+}
@@ -0,0 +1,181 @@
+package notify
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/config"
+)
+
+// Mailer sends plain-text mail through the configured SMTP relay. One SMTP
+// connection is kept open between messages (smtpIdle) and reused with RSET.
+// A Mailer with a queue (NewQueuedMailer) persists every message and retries
+// failed deliveries with backoff; see queue.go.
+type Mailer struct {
+	cfg   config.SMTPConfig
+	queue MailStore
+
+	mu       sync.Mutex // one SMTP transaction at a time on the pooled connection
+	client   *smtp.Client
+	conn     net.Conn // under client, for per-message deadlines
+	lastUsed time.Time
+}
+
+// smtpIdle is how long an idle pooled SMTP connection is kept for the next message.
+const smtpIdle = 30 * time.Second
+
+func NewMailer(cfg config.SMTPConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Enabled reports whether an SMTP host is configured.
+func (m *Mailer) Enabled() bool {
+	return m != nil && strings.TrimSpace(m.cfg.Host) != ""
+}
+
+// Send delivers a single message. With a queue it is stored first and a failed
+// delivery retried later, so only a failure to queue it is returned.
+func (m *Mailer) Send(to, subject, body string) error {
+	if !m.Enabled() {
+		return fmt.Errorf("smtp is not configured (notify.smtp.host)")
+	}
+	to = strings.TrimSpace(to)
+	if err := validRecipient(to); err != nil {
+		return err
+	}
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+	if m.queue != nil {
+		_, err := m.enqueue(to, subject, body)
+		return err
+	}
+	return m.deliver(to, subject, body)
+}
+
+func validRecipient(to string) error {
+	if to == "" || strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+	return nil
+}
+
+// deliver runs one SMTP transaction. TLS mode: "starttls" (default), "tls"
+// (implicit) or "none".
+func (m *Mailer) deliver(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, conn := m.client, m.conn
+	m.client, m.conn = nil, nil
+	if c != nil {
+		_ = conn.SetDeadline(time.Now().Add(60 * time.Second))
+		if time.Since(m.lastUsed) > smtpIdle || c.Reset() != nil {
+			c.Close()
+			c = nil
+		}
+	}
+	if c == nil {
+		var err error
+		if c, conn, err = m.dial(); err != nil {
+			return err
+		}
+	}
+	if err := m.transaction(c, to, subject, body); err != nil {
+		c.Close()
+		return err
+	}
+	m.client, m.conn, m.lastUsed = c, conn, time.Now()
+	return nil
+}
+
+func (m *Mailer) dial() (*smtp.Client, net.Conn, error) {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	if m.cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: m.cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("smtp dial %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(60 * time.Second))
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("smtp client: %w", err)
+	}
+
+	if m.cfg.TLS == "" || m.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: m.cfg.Host}); err != nil {
+				c.Close()
+				return nil, nil, fmt.Errorf("smtp starttls: %w", err)
+			}
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			c.Close()
+			return nil, nil, fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	return c, conn, nil
+}
+
+func (m *Mailer) transaction(c *smtp.Client, to, subject, body string) error {
+	if err := c.Mail(m.cfg.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp RCPT TO: %w", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := wc.Write(buildMessage(m.cfg.From, to, subject, body)); err != nil {
+		wc.Close()
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("smtp DATA close: %w", err)
+	}
+	return nil
+}
+
+// Close ends the pooled SMTP connection, if any.
+func (m *Mailer) Close() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client != nil {
+		_ = m.client.Quit()
+		m.client, m.conn = nil, nil
+	}
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + to + "\r\n")
+	b.WriteString("Subject: " + subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var webhookClient = &http.Client{Timeout: 15 * time.Second}
+
+// PostJSON sends v as a JSON POST to url; extra headers (e.g. Authorization) are optional.
+// Any non-2xx answer is an error.
+func PostJSON(ctx context.Context, url string, v any, headers map[string]string) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ngm/1")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s: %s: %s", url, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"mynginx/internal/certs"
+	"mynginx/internal/util"
+)
+
+// Runner stubs external commands for a sandbox. Every command succeeds; the
+// ones whose side effects ngm relies on are emulated:
+//
+//	certbot certonly   writes a self-signed cert into LetsEncryptLive/<cert-name>
+//	certbot delete     removes LetsEncryptLive/<cert-name>
+//	nginx -c <conf>    "starts" nginx: PIDFile gets this process' pid
+//	nginx -s stop      removes PIDFile
+type Runner struct {
+	LetsEncryptLive string
+	PIDFile         string
+	Out             io.Writer // command log; nil = silent
+}
+
+func (r Runner) Run(ctx context.Context, name string, args ...string) (util.Result, error) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, "sandbox exec: %s\n", util.CommandLine(name, args...))
+	}
+	var err error
+	switch filepath.Base(name) {
+	case "certbot":
+		err = r.certbot(args)
+	case "nginx", "openresty":
+		err = r.nginx(args)
+	}
+	if err != nil {
+		return util.Result{Stderr: err.Error(), ExitCode: 1}, err
+	}
+	return util.Result{}, nil
+}
+
+func (r Runner) certbot(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	domain, certName := flagValue(args, "-d"), flagValue(args, "--cert-name")
+	if certName == "" {
+		certName = domain
+	}
+	dir := filepath.Join(r.LetsEncryptLive, certName)
+	switch args[0] {
+	case "certonly":
+		certPEM, keyPEM, err := certs.SelfSigned(domain, 90*24*time.Hour)
+		if err != nil {
+			return err
+		}
+		if err := util.WriteFileAtomic(filepath.Join(dir, "privkey.pem"), keyPEM, 0o600); err != nil {
+			return err
+		}
+		return util.WriteFileAtomic(filepath.Join(dir, "fullchain.pem"), certPEM, 0o644)
+	case "delete":
+		return os.RemoveAll(dir)
+	}
+	return nil
+}
+
+func (r Runner) nginx(args []string) error {
+	if r.PIDFile == "" {
+		return nil
+	}
+	switch {
+	case len(args) == 2 && args[0] == "-c":
+		return util.WriteFileAtomic(r.PIDFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644)
+	case len(args) == 2 && args[0] == "-s" && args[1] == "stop":
+		if err := os.Remove(r.PIDFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func flagValue(args []string, name string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == name {
+			return args[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+// Package sandbox runs ngm against a fake root: every absolute path in the config
+// is re-rooted under one directory and external commands (nginx, certbot,
+// systemctl, useradd) are stubbed, so the add -> render -> publish flow works on
+// a laptop or in CI without root or nginx installed.
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynginx/internal/config"
+	"mynginx/internal/util"
+)
+
+// Reroot moves every absolute filesystem path of cfg under dir, marks cfg as a
+// sandbox and seeds a minimal nginx.conf that includes the managed dirs.
+func Reroot(cfg *config.Config, dir string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := util.MkdirAll(root, 0o755); err != nil {
+		return err
+	}
+	cfg.Sandbox = root
+	// nginx never really serves the sandbox, so port 80 can't be probed
+	cfg.Certs.SkipReachabilityCheck = true
+
+	under := func(p *string) {
+		if filepath.IsAbs(*p) && !within(root, *p) {
+			*p = filepath.Join(root, *p)
+		}
+	}
+	for _, p := range []*string{
+		&cfg.Nginx.Root, &cfg.Nginx.Bin, &cfg.Nginx.MainConf, &cfg.Nginx.SitesDir, &cfg.Nginx.ErrorLog,
+		&cfg.Nginx.Apply.StagingDir, &cfg.Nginx.Apply.BackupDir,
+		&cfg.Certs.Webroot, &cfg.Certs.LetsEncryptLive,
+		&cfg.Hosting.HomeRoot, &cfg.Hosting.SFTP.JailRoot, &cfg.Hosting.SFTP.SSHDConfig,
+		&cfg.Security.AuditLog,
+		&cfg.Storage.SQLitePath,
+		&cfg.Supervisor.PIDFile,
+		&cfg.Global.Dir, &cfg.Global.CacheRoot,
+		&cfg.Cluster.Standby.Dir,
+		&cfg.Snapshots.Dir,
+	} {
+		under(p)
+	}
+	for name, v := range cfg.PHPFPM.Versions {
+		under(&v.PoolsDir)
+		under(&v.SockDir)
+		cfg.PHPFPM.Versions[name] = v
+	}
+
+	paths := cfg.ResolvePaths()
+	for _, d := range []string{
+		filepath.Dir(paths.NginxMainConf), paths.NginxSitesDir, paths.NginxGlobalDir,
+		paths.ACMEWebroot, paths.LetsEncryptLive, cfg.Hosting.HomeRoot,
+		filepath.Dir(cfg.Storage.SQLitePath),
+	} {
+		if err := util.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(paths.NginxMainConf); os.IsNotExist(err) {
+		conf := fmt.Sprintf("# ngm sandbox\nevents {}\nhttp {\n    include %s/*.conf;\n\n    include %s/*.conf;\n}\n",
+			paths.NginxGlobalDir, paths.NginxSitesDir)
+		if err := util.WriteFileAtomic(paths.NginxMainConf, []byte(conf), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// within reports whether p is already under root (so Reroot is idempotent).
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,44 @@
+// Package sdnotify speaks the systemd notify protocol (sd_notify(3)): the state
+// lines a Type=notify service sends on $NOTIFY_SOCKET, and the watchdog interval
+// systemd hands it in $WATCHDOG_USEC.
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends state ("READY=1", "WATCHDOG=1", "STATUS=…", several separated by
+// newlines) to systemd. It reports false, and does nothing, when the process was
+// not started by systemd with a notify socket.
+func Notify(state string) (bool, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+	// a leading "@" is an abstract socket, which net handles as such
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval is the WatchdogSec= of the unit, when it is meant for this
+// process (0 = no watchdog). Pings are due well within it: every half is usual.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
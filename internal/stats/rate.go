@@ -0,0 +1,30 @@
+package stats
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+)
+
+var logTime = regexp.MustCompile(`\[(\d{2}/[A-Za-z]{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`)
+
+// RequestsPerMinute estimates requests per minute over the last window of an
+// access log in nginx's default time format ([02/Jan/2006:15:04:05 -0700]).
+func RequestsPerMinute(path string, window time.Duration, now time.Time) (float64, error) {
+	data, err := readTail(path)
+	if err != nil {
+		return 0, err
+	}
+	since := now.Add(-window)
+	n := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		m := logTime.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if t, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m[1])); err == nil && !t.Before(since) {
+			n++
+		}
+	}
+	return float64(n) / window.Minutes(), nil
+}
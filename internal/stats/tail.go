@@ -0,0 +1,59 @@
+// Package stats derives traffic figures from the tail of the per-site nginx logs.
+package stats
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// tailBytes bounds how much of a log is read; older lines fall out of the figures.
+const tailBytes = 4 << 20
+
+// readTail returns the last tailBytes of path, from the first full line on.
+func readTail(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readTailFile(f)
+}
+
+// readTailFile is readTail of the open file f.
+func readTailFile(f *os.File) ([]byte, error) {
+	cut := false
+	if fi, err := f.Stat(); err == nil && fi.Size() > tailBytes {
+		if _, err := f.Seek(-tailBytes, io.SeekEnd); err != nil {
+			return nil, err
+		}
+		cut = true
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if cut {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+	return data, nil
+}
+
+// TailLines returns the last n lines of the open log f (within its last tailBytes).
+func TailLines(f *os.File, n int) ([]string, error) {
+	data, err := readTailFile(f)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
@@ -0,0 +1,130 @@
+package stats
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Access log lines of site vhosts are nginx's combined format followed by
+// `rid=<request id> rt=<request time> urt=<upstream response time>` (see site.tmpl).
+var traceFields = regexp.MustCompile(` rid=(\S+) rt=([0-9.]+)`)
+
+// Request is one access log line of a site vhost.
+type Request struct {
+	Time     time.Time
+	ID       string
+	Duration time.Duration
+	Line     string
+}
+
+// ParseRequest reads the time, request id and duration of an access log line; lines
+// written before request ids were logged have none and are not requests here.
+func ParseRequest(line []byte) (Request, bool) {
+	m := traceFields.FindSubmatch(line)
+	t := logTime.FindSubmatch(line)
+	if m == nil || t == nil {
+		return Request{}, false
+	}
+	at, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(t[1]))
+	if err != nil {
+		return Request{}, false
+	}
+	secs, _ := strconv.ParseFloat(string(m[2]), 64)
+	return Request{Time: at, ID: string(m[1]), Duration: time.Duration(secs * float64(time.Second)), Line: string(line)}, true
+}
+
+// FindRequests returns the requests with id in the tail of the open access log f
+// (one, or more when a client re-sent its own X-Request-ID).
+func FindRequests(f *os.File, id string) ([]Request, error) {
+	data, err := readTailFile(f)
+	if err != nil {
+		return nil, err
+	}
+	needle := []byte(" rid=" + id + " ")
+	var out []Request
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if !bytes.Contains(line, needle) {
+			continue
+		}
+		if r, ok := ParseRequest(line); ok && r.ID == id {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// SlowRequests returns up to n requests from the tail of the open access log f that
+// took at least min, slowest first.
+func SlowRequests(f *os.File, min time.Duration, n int) ([]Request, error) {
+	data, err := readTailFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var out []Request
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if r, ok := ParseRequest(line); ok && r.Duration >= min {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+var (
+	// nginx error log: 2006/01/02 15:04:05 [error] ...
+	nginxStamp = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) `)
+	// php-fpm and PHP error logs: [02-Jan-2006 15:04:05] or [02-Jan-2006 15:04:05 UTC]
+	phpStamp = regexp.MustCompile(`^\[(\d{2}-[A-Za-z]{3}-\d{4} \d{2}:\d{2}:\d{2})( [A-Za-z_/+-]+)?\]`)
+)
+
+// logStamp is the time a nginx or PHP log line was written (local time unless the
+// line names a zone).
+func logStamp(line []byte) (time.Time, bool) {
+	if m := nginxStamp.FindSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("2006/01/02 15:04:05", string(m[1]), time.Local)
+		return t, err == nil
+	}
+	if m := phpStamp.FindSubmatch(line); m != nil {
+		loc := time.Local
+		if len(m[2]) > 0 {
+			if l, err := time.LoadLocation(string(bytes.TrimSpace(m[2]))); err == nil {
+				loc = l
+			}
+		}
+		t, err := time.ParseInLocation("02-Jan-2006 15:04:05", string(m[1]), loc)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// RelatedLines returns the lines of the open error or slow log f (nginx, php-fpm,
+// PHP) that mention id or were written between from and to. Lines without a
+// timestamp (stack traces of the PHP slow log) go with the stamped line above them.
+func RelatedLines(f *os.File, id string, from, to time.Time) ([]string, error) {
+	data, err := readTailFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	keep := false
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			keep = false
+			continue
+		}
+		if t, ok := logStamp(line); ok {
+			keep = !t.Before(from) && !t.After(to)
+		}
+		if keep || (id != "" && bytes.Contains(line, []byte(id))) {
+			out = append(out, string(line))
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,118 @@
+package stats
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpstreamLogFormat is the log_format body of the per-site upstream.log written by
+// proxy vhosts (see site.tmpl); ParseUpstream reads it back.
+const UpstreamLogFormat = `$msec|$status|$upstream_addr|$upstream_status|$upstream_response_time`
+
+// Target is the traffic one upstream server received over a window.
+type Target struct {
+	Addr     string
+	Requests int // attempts sent to it (retries on another server count there)
+	Errors   int // 5xx answers, including 502/504 for failed connects and timeouts
+	AvgMS    float64
+	P95MS    float64
+
+	// Degraded flags a target that stands out from its siblings: at least 5% 5xx,
+	// or a p95 over twice (and 50ms above) the best one. Needs minRequests to judge.
+	Degraded bool
+}
+
+// ErrorRate is the share of 5xx answers in percent.
+func (t Target) ErrorRate() float64 {
+	if t.Requests == 0 {
+		return 0
+	}
+	return float64(t.Errors) * 100 / float64(t.Requests)
+}
+
+const minRequests = 10
+
+// UpstreamStats aggregates the last window of an upstream log per upstream server.
+func UpstreamStats(path string, window time.Duration, now time.Time) (map[string]Target, error) {
+	data, err := readTail(path)
+	if err != nil {
+		return nil, err
+	}
+	since := float64(now.Add(-window).UnixMilli()) / 1000
+
+	type acc struct {
+		Target
+		times []float64
+	}
+	byAddr := map[string]*acc{}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		f := strings.Split(string(line), "|")
+		if len(f) != 5 {
+			continue
+		}
+		if ts, err := strconv.ParseFloat(f[0], 64); err != nil || ts < since {
+			continue
+		}
+		// one entry per attempt: "a, b" for retries, "a, b : c" after internal redirects
+		addrs, statuses, times := attempts(f[2]), attempts(f[3]), attempts(f[4])
+		for i, addr := range addrs {
+			if addr == "" || addr == "-" {
+				continue
+			}
+			a := byAddr[addr]
+			if a == nil {
+				a = &acc{Target: Target{Addr: addr}}
+				byAddr[addr] = a
+			}
+			a.Requests++
+			if i < len(statuses) && strings.HasPrefix(statuses[i], "5") {
+				a.Errors++
+			}
+			if i < len(times) {
+				if sec, err := strconv.ParseFloat(times[i], 64); err == nil {
+					a.times = append(a.times, sec*1000)
+				}
+			}
+		}
+	}
+
+	out := make(map[string]Target, len(byAddr))
+	best := math.Inf(1)
+	for addr, a := range byAddr {
+		if n := len(a.times); n > 0 {
+			sort.Float64s(a.times)
+			sum := 0.0
+			for _, ms := range a.times {
+				sum += ms
+			}
+			a.AvgMS = sum / float64(n)
+			a.P95MS = a.times[int(math.Ceil(0.95*float64(n)))-1]
+		}
+		if a.Requests >= minRequests && len(a.times) > 0 && a.P95MS < best {
+			best = a.P95MS
+		}
+		out[addr] = a.Target
+	}
+	for addr, t := range out {
+		if t.Requests < minRequests {
+			continue
+		}
+		t.Degraded = t.ErrorRate() >= 5 || len(out) > 1 && t.P95MS > 2*best && t.P95MS-best >= 50
+		out[addr] = t
+	}
+	return out, nil
+}
+
+func attempts(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, " : ") {
+		for _, v := range strings.Split(part, ",") {
+			out = append(out, strings.TrimSpace(v))
+		}
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) SaveAcmeDNS(a store.AcmeDNS) error {
+	_, err := s.db.Exec(`
+		INSERT INTO acme_dns(domain, server, username, password, subdomain, fulldomain)
+		VALUES(?,?,?,?,?,?)
+		ON CONFLICT(domain) DO UPDATE SET
+			server=excluded.server,
+			username=excluded.username,
+			password=excluded.password,
+			subdomain=excluded.subdomain,
+			fulldomain=excluded.fulldomain
+	`, a.Domain, a.Server, a.Username, a.Password, a.Subdomain, a.FullDomain)
+	return err
+}
+
+func (s *Store) GetAcmeDNS(domain string) (store.AcmeDNS, error) {
+	var a store.AcmeDNS
+	var created string
+	err := s.db.QueryRow(`
+		SELECT domain, server, username, password, subdomain, fulldomain, created_at
+		FROM acme_dns WHERE domain=?
+	`, domain).Scan(&a.Domain, &a.Server, &a.Username, &a.Password, &a.Subdomain, &a.FullDomain, &created)
+	if err != nil {
+		return store.AcmeDNS{}, err
+	}
+	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		a.CreatedAt = t
+	}
+	return a, nil
+}
+
+func (s *Store) DeleteAcmeDNS(domain string) error {
+	_, err := s.db.Exec(`DELETE FROM acme_dns WHERE domain=?`, domain)
+	return err
+}
@@ -0,0 +1,129 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+const apiTokenColumns = `id, name, prefix, hash, scopes, created_at, expires_at, revoked_at,
+	prev_prefix, prev_hash, prev_until, last_used_at, last_used_ip, uses, domains, hosting_user`
+
+func (s *Store) CreateAPIToken(t store.APIToken) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO api_tokens(name, prefix, hash, scopes, created_at, expires_at, domains, hosting_user)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.Name, t.Prefix, t.Hash, strings.Join(t.Scopes, ","),
+		time.Now().UTC().Format(time.RFC3339Nano), nullTime(t.ExpiresAt), strings.Join(t.Domains, ","), t.HostingUser)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetAPIToken(name string) (store.APIToken, error) {
+	return s.oneAPIToken(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE name=?`, name)
+}
+
+// FindAPIToken returns the token whose current or pre-rotation prefix is prefix.
+func (s *Store) FindAPIToken(prefix string) (store.APIToken, error) {
+	return s.oneAPIToken(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE prefix=? OR (prev_prefix<>'' AND prev_prefix=?)`, prefix, prefix)
+}
+
+func (s *Store) ListAPITokens() ([]store.APIToken, error) {
+	rows, err := s.db.Query(`SELECT ` + apiTokenColumns + ` FROM api_tokens ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPITokens(rows)
+}
+
+// RotateAPIToken replaces the token of name; the old one stays valid until prevUntil
+// (nil = not at all).
+func (s *Store) RotateAPIToken(name, prefix, hash string, expiresAt, prevUntil *time.Time) error {
+	prevPrefix, prevHash := "prefix", "hash"
+	if prevUntil == nil {
+		prevPrefix, prevHash = "''", "''"
+	}
+	res, err := s.db.Exec(`
+		UPDATE api_tokens
+		   SET prev_prefix = `+prevPrefix+`, prev_hash = `+prevHash+`, prev_until = ?,
+		       prefix = ?, hash = ?, expires_at = ?
+		 WHERE name = ? AND revoked_at IS NULL
+	`, nullTime(prevUntil), prefix, hash, nullTime(expiresAt), name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) RevokeAPIToken(name string) error {
+	res, err := s.db.Exec(`
+		UPDATE api_tokens SET revoked_at = ?, prev_prefix = '', prev_hash = '', prev_until = NULL
+		 WHERE name = ? AND revoked_at IS NULL
+	`, time.Now().UTC().Format(time.RFC3339Nano), name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIToken records a use of the token.
+func (s *Store) TouchAPIToken(id int64, ip string) error {
+	_, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ?, uses = uses + 1 WHERE id = ?`,
+		time.Now().UTC().Format(time.RFC3339Nano), ip, id)
+	return err
+}
+
+func (s *Store) oneAPIToken(query string, args ...any) (store.APIToken, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return store.APIToken{}, err
+	}
+	list, err := scanAPITokens(rows)
+	if err != nil {
+		return store.APIToken{}, err
+	}
+	if len(list) == 0 {
+		return store.APIToken{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+func scanAPITokens(rows *sql.Rows) ([]store.APIToken, error) {
+	defer rows.Close()
+	var out []store.APIToken
+	for rows.Next() {
+		var t store.APIToken
+		var scopes, created, domains string
+		var expires, revoked, prevUntil, lastUsed sql.NullString
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &t.Hash, &scopes, &created, &expires, &revoked,
+			&t.PrevPrefix, &t.PrevHash, &prevUntil, &lastUsed, &t.LastUsedIP, &t.Uses,
+			&domains, &t.HostingUser); err != nil {
+			return nil, err
+		}
+		if scopes != "" {
+			t.Scopes = strings.Split(scopes, ",")
+		}
+		if domains != "" {
+			t.Domains = strings.Split(domains, ",")
+		}
+		if ts, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			t.CreatedAt = ts
+		}
+		t.ExpiresAt = parseNullTime(expires)
+		t.RevokedAt = parseNullTime(revoked)
+		t.PrevUntil = parseNullTime(prevUntil)
+		t.LastUsedAt = parseNullTime(lastUsed)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// applyRunsKept bounds the apply history; older runs are dropped on save.
+const applyRunsKept = 1000
+
+// SaveApplyRun stores a run and its per-site lines and returns the run ID.
+func (s *Store) SaveApplyRun(run store.ApplyRun, sites []store.ApplyRunSite) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO apply_results(started_at, finished_at, request, dry_run, reloaded, error, result, actor)
+		VALUES(?,?,?,?,?,?,?,?)
+	`, run.StartedAt.UTC().Format(time.RFC3339Nano), run.FinishedAt.UTC().Format(time.RFC3339Nano),
+		run.Request, boolInt(run.DryRun), boolInt(run.Reloaded), run.Error, string(run.Result), run.Actor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, st := range sites {
+		if _, err := tx.Exec(`
+			INSERT INTO apply_runs(site_id, action, status, message, render_hash, run_id)
+			VALUES((SELECT id FROM sites WHERE domain=?),?,?,?,?,?)
+		`, st.Domain, st.Action, st.Status, st.Message, st.RenderHash, id); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM apply_runs WHERE run_id IS NOT NULL AND run_id <= ?`, id-applyRunsKept); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM apply_results WHERE id <= ?`, id-applyRunsKept); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (s *Store) GetApplyRun(id int64) (store.ApplyRun, error) {
+	row := s.db.QueryRow(`
+		SELECT id, started_at, finished_at, request, dry_run, reloaded, error, actor, result
+		FROM apply_results WHERE id=?
+	`, id)
+	run, err := scanApplyRun(row.Scan, true)
+	if err != nil {
+		return store.ApplyRun{}, err
+	}
+	return run, nil
+}
+
+// ListApplyRuns returns the newest runs without their result bodies.
+func (s *Store) ListApplyRuns(limit int) ([]store.ApplyRun, error) {
+	rows, err := s.db.Query(`
+		SELECT id, started_at, finished_at, request, dry_run, reloaded, error, actor
+		FROM apply_results ORDER BY id DESC LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []store.ApplyRun
+	for rows.Next() {
+		run, err := scanApplyRun(rows.Scan, false)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func scanApplyRun(scan func(...any) error, withResult bool) (store.ApplyRun, error) {
+	var run store.ApplyRun
+	var started, finished, result string
+	var dry, reloaded int
+	dest := []any{&run.ID, &started, &finished, &run.Request, &dry, &reloaded, &run.Error, &run.Actor}
+	if withResult {
+		dest = append(dest, &result)
+	}
+	if err := scan(dest...); err != nil {
+		return store.ApplyRun{}, err
+	}
+	run.DryRun, run.Reloaded = dry == 1, reloaded == 1
+	run.Result = []byte(result)
+	if t, err := time.Parse(time.RFC3339Nano, started); err == nil {
+		run.StartedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, finished); err == nil {
+		run.FinishedAt = t
+	}
+	return run, nil
+}
+
+// ListSiteApplyRuns returns the newest apply run lines of a site.
+func (s *Store) ListSiteApplyRuns(domain string, limit int) ([]store.ApplyRunSite, error) {
+	rows, err := s.db.Query(`
+		SELECT r.run_id, s.domain, r.action, r.status, r.message, r.render_hash, r.created_at
+		FROM apply_runs r JOIN sites s ON s.id = r.site_id
+		WHERE s.domain=? AND r.run_id IS NOT NULL
+		ORDER BY r.id DESC LIMIT ?
+	`, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []store.ApplyRunSite
+	for rows.Next() {
+		var st store.ApplyRunSite
+		var created string
+		var runID sql.NullInt64
+		if err := rows.Scan(&runID, &st.Domain, &st.Action, &st.Status, &st.Message, &st.RenderHash, &created); err != nil {
+			return nil, err
+		}
+		st.RunID = runID.Int64
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			st.CreatedAt = t
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
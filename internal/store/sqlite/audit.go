@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) AddAudit(e store.AuditEntry) error {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	if e.Status == "" {
+		e.Status = "ok"
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log(at, via, actor, remote, action, target, params, old_values, new_values, status, error)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.At.UTC().Format(time.RFC3339Nano), e.Via, e.Actor, e.Remote, e.Action, e.Target, e.Params, e.Old, e.New, e.Status, e.Error)
+	return err
+}
+
+func (s *Store) ListAudit(q store.AuditQuery) ([]store.AuditEntry, error) {
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	rows, err := s.db.Query(`
+		SELECT id, at, via, actor, remote, action, target, params, old_values, new_values, status, error
+		  FROM audit_log
+		 WHERE (? = '' OR actor = ?) AND (? = '' OR target = ?) AND (? = '' OR via = ?)
+		 ORDER BY id DESC
+		 LIMIT ?
+	`, q.Actor, q.Actor, q.Target, q.Target, q.Via, q.Via, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAudit(rows)
+}
+
+func scanAudit(rows *sql.Rows) ([]store.AuditEntry, error) {
+	defer rows.Close()
+	var out []store.AuditEntry
+	for rows.Next() {
+		var e store.AuditEntry
+		var at string
+		if err := rows.Scan(&e.ID, &at, &e.Via, &e.Actor, &e.Remote, &e.Action, &e.Target, &e.Params,
+			&e.Old, &e.New, &e.Status, &e.Error); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, at); err == nil {
+			e.At = t
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"time"
+)
+
+// RecordCertRenewFailure counts a failed renewal of domain and returns how many
+// failed in a row.
+func (s *Store) RecordCertRenewFailure(domain, errMsg string) (int, error) {
+	var n int
+	err := s.db.QueryRow(`
+		INSERT INTO cert_renew_failures(domain, failures, last_error, last_failed_at)
+		VALUES(?, 1, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET
+			failures=failures + 1,
+			last_error=excluded.last_error,
+			last_failed_at=excluded.last_failed_at
+		RETURNING failures
+	`, domain, errMsg, time.Now().UTC().Format(time.RFC3339Nano)).Scan(&n)
+	return n, err
+}
+
+func (s *Store) ResetCertRenewFailures(domain string) error {
+	_, err := s.db.Exec(`DELETE FROM cert_renew_failures WHERE domain=?`, domain)
+	return err
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+const changeColumns = `id, kind, target, params, requested_by, created_at, status, decided_by, decided_at, note`
+
+func (s *Store) CreateChangeRequest(c store.ChangeRequest) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO change_requests(kind, target, params, requested_by, created_at, status)
+		VALUES(?, ?, ?, ?, ?, ?)
+	`, c.Kind, c.Target, c.Params, c.RequestedBy, time.Now().UTC().Format(time.RFC3339Nano), store.ChangePending)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetChangeRequest(id int64) (store.ChangeRequest, error) {
+	rows, err := s.db.Query(`SELECT `+changeColumns+` FROM change_requests WHERE id=?`, id)
+	if err != nil {
+		return store.ChangeRequest{}, err
+	}
+	out, err := scanChangeRequests(rows)
+	if err != nil {
+		return store.ChangeRequest{}, err
+	}
+	if len(out) == 0 {
+		return store.ChangeRequest{}, sql.ErrNoRows
+	}
+	return out[0], nil
+}
+
+func (s *Store) ListChangeRequests(limit int) ([]store.ChangeRequest, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`SELECT `+changeColumns+` FROM change_requests ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanChangeRequests(rows)
+}
+
+// UpdateChangeRequestStatus is a compare-and-set on the status, so two admins
+// deciding the same request at once cannot both carry it out.
+func (s *Store) UpdateChangeRequestStatus(id int64, from, to, by, note string) error {
+	var decidedAt any
+	if by != "" {
+		decidedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	res, err := s.db.Exec(`
+		UPDATE change_requests
+		   SET status = ?, note = ?,
+		       decided_by = CASE WHEN ? <> '' THEN ? ELSE decided_by END,
+		       decided_at = COALESCE(?, decided_at)
+		 WHERE id = ? AND status = ?
+	`, to, note, by, by, decidedAt, id, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanChangeRequests(rows *sql.Rows) ([]store.ChangeRequest, error) {
+	defer rows.Close()
+	var out []store.ChangeRequest
+	for rows.Next() {
+		var c store.ChangeRequest
+		var created string
+		var decided sql.NullString
+		if err := rows.Scan(&c.ID, &c.Kind, &c.Target, &c.Params, &c.RequestedBy, &created,
+			&c.Status, &c.DecidedBy, &decided, &c.Note); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			c.CreatedAt = t
+		}
+		c.DecidedAt = parseNullTime(decided)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
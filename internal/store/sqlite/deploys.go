@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// deployRunsKept bounds the deploy log of each site; older runs are dropped on add.
+const deployRunsKept = 200
+
+func (s *Store) SaveSiteDeploy(d store.SiteDeploy) error {
+	_, err := s.db.Exec(`
+		INSERT INTO site_deploys(domain, repo, branch, secret)
+		VALUES(?,?,?,?)
+		ON CONFLICT(domain) DO UPDATE SET
+			repo=excluded.repo,
+			branch=excluded.branch,
+			secret=excluded.secret
+	`, d.Domain, d.Repo, d.Branch, d.Secret)
+	return err
+}
+
+func (s *Store) GetSiteDeploy(domain string) (store.SiteDeploy, error) {
+	var d store.SiteDeploy
+	var created string
+	err := s.db.QueryRow(`
+		SELECT domain, repo, branch, secret, created_at
+		FROM site_deploys WHERE domain=?
+	`, domain).Scan(&d.Domain, &d.Repo, &d.Branch, &d.Secret, &created)
+	if err != nil {
+		return store.SiteDeploy{}, err
+	}
+	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		d.CreatedAt = t
+	}
+	return d, nil
+}
+
+func (s *Store) DeleteSiteDeploy(domain string) error {
+	_, err := s.db.Exec(`DELETE FROM site_deploys WHERE domain=?`, domain)
+	return err
+}
+
+// AddDeployRun appends a run to the deploy log of its site and returns its ID.
+func (s *Store) AddDeployRun(r store.DeployRun) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO deploy_runs(domain, started_at, finished_at, trigger, ref, commit_id, status, output)
+		VALUES(?,?,?,?,?,?,?,?)
+	`, r.Domain, r.StartedAt.UTC().Format(time.RFC3339Nano), r.FinishedAt.UTC().Format(time.RFC3339Nano),
+		r.Trigger, r.Ref, r.Commit, r.Status, r.Output)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.db.Exec(`
+		DELETE FROM deploy_runs WHERE domain=? AND id NOT IN (
+			SELECT id FROM deploy_runs WHERE domain=? ORDER BY id DESC LIMIT ?
+		)
+	`, r.Domain, r.Domain, deployRunsKept)
+	return id, err
+}
+
+func (s *Store) ListDeployRuns(domain string, limit int) ([]store.DeployRun, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.Query(`
+		SELECT id, domain, started_at, finished_at, trigger, ref, commit_id, status, output
+		FROM deploy_runs WHERE domain=? ORDER BY id DESC LIMIT ?
+	`, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.DeployRun
+	for rows.Next() {
+		var r store.DeployRun
+		var started, finished string
+		if err := rows.Scan(&r.ID, &r.Domain, &started, &finished, &r.Trigger, &r.Ref, &r.Commit, &r.Status, &r.Output); err != nil {
+			return nil, err
+		}
+		r.StartedAt, _ = time.Parse(time.RFC3339Nano, started)
+		r.FinishedAt, _ = time.Parse(time.RFC3339Nano, finished)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
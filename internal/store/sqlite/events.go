@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) AddEvent(e store.Event) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if e.Level == "" {
+		e.Level = "info"
+	}
+	_, err := s.db.Exec(`INSERT INTO events(created_at, level, source, message, domain, owner) VALUES(?,?,?,?,?,?)`,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano), e.Level, e.Source, e.Message, e.Domain, e.Owner)
+	return err
+}
+
+func (s *Store) ListEvents(source string, limit int) ([]store.Event, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`
+		SELECT id, created_at, level, source, message, domain, owner
+		  FROM events
+		 WHERE ? = '' OR source = ?
+		 ORDER BY id DESC
+		 LIMIT ?
+	`, source, source, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// ListOwnerEvents returns the newest events that concern a hosting user.
+func (s *Store) ListOwnerEvents(owner string, limit int) ([]store.Event, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`
+		SELECT id, created_at, level, source, message, domain, owner
+		  FROM events
+		 WHERE owner = ?
+		 ORDER BY id DESC
+		 LIMIT ?
+	`, owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func scanEvents(rows *sql.Rows) ([]store.Event, error) {
+	defer rows.Close()
+
+	var out []store.Event
+	for rows.Next() {
+		var e store.Event
+		var created string
+		if err := rows.Scan(&e.ID, &created, &e.Level, &e.Source, &e.Message, &e.Domain, &e.Owner); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			e.CreatedAt = t
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
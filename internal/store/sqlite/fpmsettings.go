@@ -0,0 +1,49 @@
+package sqlite
+
+import "strings"
+
+// ListSiteFPMSettings returns a site's php-fpm pool overrides (directive -> value).
+func (s *Store) ListSiteFPMSettings(siteID int64) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM site_fpm_settings WHERE site_id = ?`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		out[k] = v
+	}
+	return out, rows.Err()
+}
+
+// SetSiteFPMSettings replaces a site's php-fpm pool overrides and bumps its revision
+// so it shows as pending.
+func (s *Store) SetSiteFPMSettings(domain string, settings map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM site_fpm_settings WHERE site_id = ?`, siteID); err != nil {
+		return err
+	}
+	for k, v := range settings {
+		if _, err := tx.Exec(`INSERT INTO site_fpm_settings(site_id, key, value) VALUES(?,?,?)`, siteID, k, v); err != nil {
+			return err
+		}
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
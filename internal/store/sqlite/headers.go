@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// ListSiteHeaders returns a site's custom response headers in the order they were added.
+func (s *Store) ListSiteHeaders(siteID int64) ([]store.SiteHeader, error) {
+	rows, err := s.db.Query(`
+		SELECT name, value, hide
+		  FROM site_headers
+		 WHERE site_id = ?
+		 ORDER BY id ASC
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.SiteHeader
+	for rows.Next() {
+		var h store.SiteHeader
+		var hide int
+		if err := rows.Scan(&h.Name, &h.Value, &hide); err != nil {
+			return nil, err
+		}
+		h.Hide = hide == 1
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// SetSiteHeader adds or replaces (by name) a header of the site and bumps its
+// revision so it shows as pending.
+func (s *Store) SetSiteHeader(domain string, h store.SiteHeader) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO site_headers(site_id, name, value, hide)
+		VALUES(?,?,?,?)
+		ON CONFLICT(site_id, name) DO UPDATE SET
+			value=excluded.value,
+			hide=excluded.hide
+	`, siteID, strings.ToLower(strings.TrimSpace(h.Name)), h.Value, boolInt(h.Hide)); err != nil {
+		return err
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSiteHeader removes a header of the site (sql.ErrNoRows if it has none by that name).
+func (s *Store) DeleteSiteHeader(domain, name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM site_headers WHERE site_id = ? AND name = ?`, siteID, strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func touchSite(tx *sql.Tx, siteID int64) error {
+	_, err := tx.Exec(`
+		UPDATE sites
+		   SET revision   = revision + 1,
+		       updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id = ?
+	`, siteID)
+	return err
+}
@@ -0,0 +1,224 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) InsertHealthCheck(c store.HealthCheck) error {
+	if c.CheckedAt.IsZero() {
+		c.CheckedAt = time.Now()
+	}
+	if c.Location == "" {
+		c.Location = "local"
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO health_checks(site_id, checked_at, ok, status_code, latency_ms, error, location)
+		VALUES(?,?,?,?,?,?,?)
+	`, c.SiteID, c.CheckedAt.UTC().Format(time.RFC3339Nano), boolInt(c.OK), c.StatusCode, c.LatencyMS, c.Error, c.Location)
+	return err
+}
+
+// LatestHealthChecks returns the most recent check per site.
+func (s *Store) LatestHealthChecks() (map[int64]store.HealthCheck, error) {
+	rows, err := s.db.Query(`
+		SELECT h.id, h.site_id, h.checked_at, h.ok, h.status_code, h.latency_ms, h.error, h.location
+		  FROM health_checks h
+		  JOIN (SELECT site_id, MAX(id) AS id FROM health_checks GROUP BY site_id) last
+		    ON last.id = h.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]store.HealthCheck{}
+	for rows.Next() {
+		c, err := scanHealthCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[c.SiteID] = c
+	}
+	return out, rows.Err()
+}
+
+// RecentHealthChecks returns the last n checks of a site, newest first.
+func (s *Store) RecentHealthChecks(siteID int64, n int) ([]store.HealthCheck, error) {
+	rows, err := s.db.Query(`
+		SELECT id, site_id, checked_at, ok, status_code, latency_ms, error, location
+		  FROM health_checks
+		 WHERE site_id = ?
+		 ORDER BY id DESC
+		 LIMIT ?
+	`, siteID, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.HealthCheck
+	for rows.Next() {
+		c, err := scanHealthCheck(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func scanHealthCheck(rows *sql.Rows) (store.HealthCheck, error) {
+	var c store.HealthCheck
+	var checked string
+	var ok int
+	if err := rows.Scan(&c.ID, &c.SiteID, &checked, &ok, &c.StatusCode, &c.LatencyMS, &c.Error, &c.Location); err != nil {
+		return c, err
+	}
+	c.OK = ok == 1
+	if t, err := time.Parse(time.RFC3339Nano, checked); err == nil {
+		c.CheckedAt = t
+	}
+	return c, nil
+}
+
+// HealthSummaries aggregates checks per site since the given time.
+func (s *Store) HealthSummaries(since time.Time) (map[int64]store.HealthSummary, error) {
+	rows, err := s.db.Query(`
+		SELECT site_id, SUM(ok), COUNT(*),
+		       COALESCE(CAST(AVG(CASE WHEN ok = 1 THEN latency_ms END) AS INTEGER), 0)
+		  FROM health_checks
+		 WHERE checked_at >= ?
+		 GROUP BY site_id
+	`, since.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]store.HealthSummary{}
+	for rows.Next() {
+		var id int64
+		var h store.HealthSummary
+		if err := rows.Scan(&id, &h.OK, &h.Total, &h.AvgLatency); err != nil {
+			return nil, err
+		}
+		out[id] = h
+	}
+	return out, rows.Err()
+}
+
+// HealthDaily counts checks per site and UTC day since the given time.
+func (s *Store) HealthDaily(since time.Time) ([]store.HealthDay, error) {
+	rows, err := s.db.Query(`
+		SELECT site_id, substr(checked_at, 1, 10) AS day, SUM(ok), COUNT(*)
+		  FROM health_checks
+		 WHERE checked_at >= ?
+		 GROUP BY site_id, day
+		 ORDER BY site_id, day
+	`, since.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.HealthDay
+	for rows.Next() {
+		var d store.HealthDay
+		if err := rows.Scan(&d.SiteID, &d.Day, &d.OK, &d.Total); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) PurgeHealthChecks(olderThan time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM health_checks WHERE checked_at < ?`, olderThan.UTC().Format(time.RFC3339Nano))
+	return err
+}
+
+// ---------------- incidents ----------------
+
+const incidentCols = `i.id, i.site_id, COALESCE(s.domain, ''), i.started_at, i.ended_at, i.cause`
+
+func scanIncident(sc interface{ Scan(...any) error }) (store.Incident, error) {
+	var in store.Incident
+	var started string
+	var ended sql.NullString
+	if err := sc.Scan(&in.ID, &in.SiteID, &in.Domain, &started, &ended, &in.Cause); err != nil {
+		return in, err
+	}
+	if t, err := time.Parse(time.RFC3339Nano, started); err == nil {
+		in.StartedAt = t
+	}
+	if ended.Valid {
+		if t, err := time.Parse(time.RFC3339Nano, ended.String); err == nil {
+			in.EndedAt = &t
+		}
+	}
+	return in, nil
+}
+
+// GetOpenIncident returns the ongoing incident of a site, or nil.
+func (s *Store) GetOpenIncident(siteID int64) (*store.Incident, error) {
+	row := s.db.QueryRow(`
+		SELECT `+incidentCols+`
+		  FROM incidents i LEFT JOIN sites s ON s.id = i.site_id
+		 WHERE i.site_id = ? AND i.ended_at IS NULL
+		 ORDER BY i.id DESC LIMIT 1
+	`, siteID)
+	in, err := scanIncident(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+func (s *Store) CreateIncident(siteID int64, startedAt time.Time, cause string) (store.Incident, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO incidents(site_id, started_at, cause) VALUES(?,?,?)
+	`, siteID, startedAt.UTC().Format(time.RFC3339Nano), cause)
+	if err != nil {
+		return store.Incident{}, err
+	}
+	id, _ := res.LastInsertId()
+	return store.Incident{ID: id, SiteID: siteID, StartedAt: startedAt, Cause: cause}, nil
+}
+
+func (s *Store) CloseIncident(id int64, endedAt time.Time) error {
+	_, err := s.db.Exec(`UPDATE incidents SET ended_at = ? WHERE id = ? AND ended_at IS NULL`,
+		endedAt.UTC().Format(time.RFC3339Nano), id)
+	return err
+}
+
+// ListIncidents returns incidents that were ongoing at some point since the given time, newest first.
+func (s *Store) ListIncidents(since time.Time, limit int) ([]store.Incident, error) {
+	rows, err := s.db.Query(`
+		SELECT `+incidentCols+`
+		  FROM incidents i LEFT JOIN sites s ON s.id = i.site_id
+		 WHERE i.ended_at IS NULL OR i.ended_at >= ?
+		 ORDER BY i.started_at DESC
+		 LIMIT ?
+	`, since.UTC().Format(time.RFC3339Nano), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.Incident
+	for rows.Next() {
+		in, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, in)
+	}
+	return out, rows.Err()
+}
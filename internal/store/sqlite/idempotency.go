@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// BeginIdempotent reserves key for a new request. When the key already exists the stored
+// record is returned instead (Done=false means the first request is still in flight).
+func (s *Store) BeginIdempotent(key, fingerprint string) (*store.IdempotencyRecord, error) {
+	if key == "" {
+		return nil, fmt.Errorf("key is required")
+	}
+	res, err := s.db.Exec(`
+		INSERT INTO idempotency_keys(key, fingerprint) VALUES(?, ?)
+		ON CONFLICT(key) DO NOTHING
+	`, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, nil
+	}
+
+	var rec store.IdempotencyRecord
+	var done int
+	var created string
+	err = s.db.QueryRow(`
+		SELECT key, fingerprint, done, status, content_type, location, COALESCE(body, x''), created_at
+		  FROM idempotency_keys
+		 WHERE key=?
+	`, key).Scan(&rec.Key, &rec.Fingerprint, &done, &rec.Status, &rec.ContentType, &rec.Location, &rec.Body, &created)
+	if err != nil {
+		return nil, err
+	}
+	rec.Done = done == 1
+	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		rec.CreatedAt = t
+	}
+	return &rec, nil
+}
+
+func (s *Store) CompleteIdempotent(rec store.IdempotencyRecord) error {
+	_, err := s.db.Exec(`
+		UPDATE idempotency_keys
+		   SET done=1, status=?, content_type=?, location=?, body=?
+		 WHERE key=?
+	`, rec.Status, rec.ContentType, rec.Location, rec.Body, rec.Key)
+	return err
+}
+
+// ReleaseIdempotent drops a reservation (e.g. the handler failed before producing a response).
+func (s *Store) ReleaseIdempotent(key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE key=?`, key)
+	return err
+}
+
+func (s *Store) PurgeIdempotent(olderThan time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`,
+		olderThan.UTC().Format("2006-01-02T15:04:05.000Z"))
+	return err
+}
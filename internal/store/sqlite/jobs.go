@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+const jobColumns = `id, kind, target, params, actor, status, error, progress, run_id, created_at, started_at, finished_at`
+
+func (s *Store) CreateJob(j store.Job) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO jobs(kind, target, params, actor, status, created_at)
+		VALUES(?, ?, ?, ?, ?, ?)
+	`, j.Kind, j.Target, j.Params, j.Actor, store.JobQueued, time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetJob(id int64) (store.Job, error) {
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs WHERE id=?`, id)
+	if err != nil {
+		return store.Job{}, err
+	}
+	out, err := scanJobs(rows)
+	if err != nil {
+		return store.Job{}, err
+	}
+	if len(out) == 0 {
+		return store.Job{}, sql.ErrNoRows
+	}
+	return out[0], nil
+}
+
+func (s *Store) ListJobs(limit int) ([]store.Job, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`SELECT `+jobColumns+` FROM jobs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// ClaimJob takes the oldest queued job; the status check in the UPDATE keeps two
+// workers from taking the same one.
+func (s *Store) ClaimJob() (store.Job, error) {
+	for {
+		var id int64
+		err := s.db.QueryRow(`SELECT id FROM jobs WHERE status = ? ORDER BY id LIMIT 1`, store.JobQueued).Scan(&id)
+		if err != nil {
+			return store.Job{}, err
+		}
+		res, err := s.db.Exec(`UPDATE jobs SET status = ?, started_at = ? WHERE id = ? AND status = ?`,
+			store.JobRunning, time.Now().UTC().Format(time.RFC3339Nano), id, store.JobQueued)
+		if err != nil {
+			return store.Job{}, err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return s.GetJob(id)
+		}
+	}
+}
+
+func (s *Store) FinishJob(id int64, status, errMsg string, runID int64) error {
+	res, err := s.db.Exec(`
+		UPDATE jobs SET status = ?, error = ?, run_id = ?, finished_at = ?
+		 WHERE id = ? AND status = ?
+	`, status, errMsg, runID, time.Now().UTC().Format(time.RFC3339Nano), id, store.JobRunning)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) SetJobProgress(id int64, progress string) error {
+	_, err := s.db.Exec(`UPDATE jobs SET progress = ? WHERE id = ? AND status = ?`, progress, id, store.JobRunning)
+	return err
+}
+
+func (s *Store) FailRunningJobs(errMsg string) (int64, error) {
+	res, err := s.db.Exec(`UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		store.JobFailed, errMsg, time.Now().UTC().Format(time.RFC3339Nano), store.JobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanJobs(rows *sql.Rows) ([]store.Job, error) {
+	defer rows.Close()
+	var out []store.Job
+	for rows.Next() {
+		var j store.Job
+		var created string
+		var started, finished sql.NullString
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Target, &j.Params, &j.Actor, &j.Status, &j.Error,
+			&j.Progress, &j.RunID, &created, &started, &finished); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			j.CreatedAt = t
+		}
+		j.StartedAt = parseNullTime(started)
+		j.FinishedAt = parseNullTime(finished)
+		out = append(out, j)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+const mailColumns = `id, to_addr, subject, body, status, attempts, last_error, next_attempt_at, created_at, sent_at`
+
+// EnqueueMail queues a message whose first attempt is due at next.
+func (s *Store) EnqueueMail(to, subject, body string, next time.Time) (int64, error) {
+	res, err := s.db.Exec(`
+		INSERT INTO mail_queue(to_addr, subject, body, status, next_attempt_at, created_at)
+		VALUES(?, ?, ?, ?, ?, ?)
+	`, to, subject, body, store.MailQueued, next.UTC().Format(time.RFC3339Nano), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *Store) GetMail(id int64) (store.MailMessage, error) {
+	rows, err := s.db.Query(`SELECT `+mailColumns+` FROM mail_queue WHERE id=?`, id)
+	if err != nil {
+		return store.MailMessage{}, err
+	}
+	out, err := scanMail(rows)
+	if err != nil {
+		return store.MailMessage{}, err
+	}
+	if len(out) == 0 {
+		return store.MailMessage{}, sql.ErrNoRows
+	}
+	return out[0], nil
+}
+
+// DueMail returns the queued messages whose next attempt is due, oldest first.
+func (s *Store) DueMail(now time.Time, limit int) ([]store.MailMessage, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.Query(`
+		SELECT `+mailColumns+`
+		  FROM mail_queue
+		 WHERE status = ? AND next_attempt_at <= ?
+		 ORDER BY id
+		 LIMIT ?
+	`, store.MailQueued, now.UTC().Format(time.RFC3339Nano), limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMail(rows)
+}
+
+// SetMailResult records a delivery attempt: status sent/failed is final, queued
+// retries at next.
+func (s *Store) SetMailResult(id int64, status, lastErr string, next *time.Time) error {
+	var nextAt, sentAt any
+	if next != nil {
+		nextAt = next.UTC().Format(time.RFC3339Nano)
+	}
+	if status == store.MailSent {
+		sentAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	res, err := s.db.Exec(`
+		UPDATE mail_queue
+		   SET status = ?, attempts = attempts + 1, last_error = ?,
+		       next_attempt_at = ?, sent_at = COALESCE(?, sent_at)
+		 WHERE id = ?
+	`, status, lastErr, nextAt, sentAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) ListMail(limit int) ([]store.MailMessage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := s.db.Query(`SELECT `+mailColumns+` FROM mail_queue ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanMail(rows)
+}
+
+// PruneMail deletes sent and failed messages created before before.
+func (s *Store) PruneMail(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM mail_queue WHERE status != ? AND created_at < ?`,
+		store.MailQueued, before.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanMail(rows *sql.Rows) ([]store.MailMessage, error) {
+	defer rows.Close()
+	var out []store.MailMessage
+	for rows.Next() {
+		var m store.MailMessage
+		var created string
+		var next, sent sql.NullString
+		if err := rows.Scan(&m.ID, &m.To, &m.Subject, &m.Body, &m.Status, &m.Attempts, &m.LastError, &next, &created, &sent); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			m.CreatedAt = t
+		}
+		m.NextAttemptAt = parseNullTime(next)
+		m.SentAt = parseNullTime(sent)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
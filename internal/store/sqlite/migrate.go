@@ -43,7 +43,7 @@ func migrate(db *sql.DB) error {
                         deleted_at TEXT,
 
 			-- TLS / certificate source
-			-- tls_mode: 'letsencrypt' | 'custom' | 'off'
+			-- tls_mode (cert source): 'letsencrypt' | 'path' | 'remote'
 			tls_mode TEXT NOT NULL DEFAULT 'letsencrypt',
 			tls_cert_path TEXT NOT NULL DEFAULT '',
 			tls_key_path  TEXT NOT NULL DEFAULT '',
@@ -139,8 +139,622 @@ func migrate(db *sql.DB) error {
 		return err
 	}
 
+	// Columns added after the initial schema (existing DBs need ALTER TABLE).
+	if err := addColumnIfMissing(tx, "panel_users", "language", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "panel_users", "email", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "panel_users", "email_verified", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "panel_users", "must_change_password", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	// role=user accounts manage the sites of this hosting user ('' = the hosting user
+	// named like the account)
+	if err := addColumnIfMissing(tx, "panel_users", "hosting_user", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(tx, "sites", "revision", `INTEGER NOT NULL DEFAULT 1`); err != nil {
+		return err
+	}
+
+	// plans: per-user hosting limits (0 = unlimited)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS plans(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			max_sites INTEGER NOT NULL DEFAULT 0,
+			max_proxy_targets INTEGER NOT NULL DEFAULT 0,
+			php_versions TEXT NOT NULL DEFAULT '',
+			bandwidth_mb INTEGER NOT NULL DEFAULT 0,
+			disk_mb INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+		);
+	`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "users", "plan_id", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// idempotency_keys: stored responses for retried mutating requests
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys(
+			key TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			done INTEGER NOT NULL DEFAULT 0,
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			location TEXT NOT NULL DEFAULT '',
+			body BLOB,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+		);
+	`); err != nil {
+		return err
+	}
+
+	// leases: named, expiring locks (cluster-wide certificate issuance serialization)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS leases(
+			name TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+
+	// blue/green: targets belong to a named group; the site's active group is rendered ('' = all)
+	if err := addColumnIfMissing(tx, "proxy_targets", "target_group", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "active_group", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// request mirroring: copy a share of a proxy site's traffic to a shadow upstream
+	if err := addColumnIfMissing(tx, "sites", "mirror_target", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "mirror_percent", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// dual certificates: an alternate-key (RSA/ECDSA) lineage next to the primary cert
+	if err := addColumnIfMissing(tx, "sites", "dual_cert", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// per-site access log shipping to a syslog collector (SIEM)
+	if err := addColumnIfMissing(tx, "sites", "access_syslog", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// site expiry: serve disables the site once expires_at passes (after warning expiry_notify)
+	if err := addColumnIfMissing(tx, "sites", "expires_at", `TEXT`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "expiry_notify", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "expiry_warned_at", `TEXT`); err != nil {
+		return err
+	}
+
+	// per-site ACME CA (certs.cas name; '' = certs.ca)
+	if err := addColumnIfMissing(tx, "sites", "acme_ca", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// shared certificates: the Let's Encrypt lineage a site with cert source "shared" is served from
+	if err := addColumnIfMissing(tx, "sites", "cert_lineage", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// backend health endpoint of a proxy site, exposed to the allow-listed monitors
+	if err := addColumnIfMissing(tx, "sites", "backend_health", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// redirect-only sites (mode=redirect): target URL, status code, keep the request path
+	if err := addColumnIfMissing(tx, "sites", "redirect_url", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "redirect_code", `INTEGER NOT NULL DEFAULT 301`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "redirect_keep_path", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// placeholder ("coming soon") page until content is deployed to the webroot
+	if err := addColumnIfMissing(tx, "sites", "placeholder", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// hardening preset of php sites (fastcgi params, upload dirs, outbound URL access)
+	if err := addColumnIfMissing(tx, "sites", "hardened", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// preview hostname: the site served on a temporary name before the DNS switch
+	if err := addColumnIfMissing(tx, "sites", "preview_host", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// scheduled re-render (cron expression) for templates with time-based content
+	if err := addColumnIfMissing(tx, "sites", "reapply_cron", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// upstream discovery: "srv:<name>" / "consul:<service>" of a proxy site, and the
+	// targets it produced (replaced on each membership change, manual ones untouched)
+	if err := addColumnIfMissing(tx, "sites", "discovery", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "proxy_targets", "discovered", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// site tags (comma-separated) for bulk operations
+	if err := addColumnIfMissing(tx, "sites", "tags", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// graceful disable: a 410/503 page served until retire_until, then the vhost goes
+	if err := addColumnIfMissing(tx, "sites", "retire_until", `TEXT`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "retire_status", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// access log sampling of busy sites: "" = every request, "errors", or "1/N"
+	if err := addColumnIfMissing(tx, "sites", "access_log_sample", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// upstream keepalive pool of proxy sites (0 / '' = hosting.upstream_keepalive)
+	if err := addColumnIfMissing(tx, "sites", "keepalive_conns", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "keepalive_requests", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "sites", "keepalive_timeout", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// sftp-only chroot jail of a hosting user
+	if err := addColumnIfMissing(tx, "users", "sftp_jail", `INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+
+	// site_vars: render-time template variables of a site (.Vars in site.tmpl)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_vars(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			value TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			UNIQUE(site_id, name),
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+
+	// site_headers: custom response headers added to / hidden from a site's vhost
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_headers(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			name TEXT NOT NULL,                -- stored lower-case
+			value TEXT NOT NULL DEFAULT '',
+			hide INTEGER NOT NULL DEFAULT 0,   -- 1 = strip it instead of adding
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			UNIQUE(site_id, name),
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+
+	// site_preloads: resources announced with Link: rel=preload on a site's page responses
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_preloads(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			as_type TEXT NOT NULL,                 -- style | script | font | image | fetch
+			crossorigin INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			UNIQUE(site_id, url),
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+
+	// site_fpm_settings: php-fpm pool overrides of a site (carried over from an adopted pool)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_fpm_settings(
+			site_id INTEGER NOT NULL,
+			key TEXT NOT NULL,                 -- e.g. php_admin_value[memory_limit], pm.max_children
+			value TEXT NOT NULL,
+			PRIMARY KEY(site_id, key),
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+
+	// health_checks: periodic availability probes per site
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS health_checks(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			checked_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			ok INTEGER NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_health_checks_site_time ON health_checks(site_id, checked_at);`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "health_checks", "location", `TEXT NOT NULL DEFAULT 'local'`); err != nil {
+		return err
+	}
+
+	// incidents: confirmed downtime windows (ended_at NULL = ongoing)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS incidents(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			started_at TEXT NOT NULL,
+			ended_at TEXT,
+			cause TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_incidents_site ON incidents(site_id, started_at);`); err != nil {
+		return err
+	}
+
+	// tls_scans: latest TLS grade per domain (report is JSON)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS tls_scans(
+			domain TEXT PRIMARY KEY,
+			grade TEXT NOT NULL,
+			scanned_at TEXT NOT NULL,
+			report TEXT NOT NULL DEFAULT '{}'
+		);
+	`); err != nil {
+		return err
+	}
+
+	// site_reach: latest post-apply IPv4/IPv6 reachability per domain (report is JSON)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_reach(
+			domain TEXT PRIMARY KEY,
+			checked_at TEXT NOT NULL,
+			report TEXT NOT NULL DEFAULT '{}'
+		);
+	`); err != nil {
+		return err
+	}
+
+	// cert_renew_failures: consecutive failed renewals per certificate (CA fallback)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS cert_renew_failures(
+			domain TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			last_failed_at TEXT NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+
+	// cert_cache: certificate expiry per domain, so the site list does not parse PEM
+	// files per row (not_after NULL = no certificate when checked)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS cert_cache(
+			domain TEXT PRIMARY KEY,
+			not_after TEXT,
+			checked_at TEXT NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+
+	// apply_results: full result of every apply call; apply_runs rows point at it
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS apply_results(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			started_at TEXT NOT NULL,
+			finished_at TEXT NOT NULL,
+			request TEXT NOT NULL DEFAULT '',
+			dry_run INTEGER NOT NULL DEFAULT 0,
+			reloaded INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			result TEXT NOT NULL DEFAULT '{}'
+		);
+	`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "apply_runs", "run_id", `INTEGER`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "apply_results", "actor", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_apply_runs_site ON apply_runs(site_id, id)`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "apply_runs", "render_hash", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// acme_dns: acme-dns credentials per domain (delegated DNS-01 validation)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS acme_dns(
+			domain TEXT PRIMARY KEY,
+			server TEXT NOT NULL,
+			username TEXT NOT NULL,
+			password TEXT NOT NULL,
+			subdomain TEXT NOT NULL,
+			fulldomain TEXT NOT NULL,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+		);
+	`); err != nil {
+		return err
+	}
+
+	// site_deploys: git deploy setup per site; deploy_runs: the deploy log
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS site_deploys(
+			domain TEXT PRIMARY KEY,
+			repo TEXT NOT NULL,
+			branch TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS deploy_runs(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL,
+			started_at TEXT NOT NULL,
+			finished_at TEXT NOT NULL,
+			trigger TEXT NOT NULL DEFAULT '',
+			ref TEXT NOT NULL DEFAULT '',
+			commit_id TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			output TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_deploy_runs_domain ON deploy_runs(domain, id);`); err != nil {
+		return err
+	}
+
+	// vhost_stamps: reverse index of the stamp header on published vhosts
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS vhost_stamps(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			domain TEXT NOT NULL,
+			render_hash TEXT NOT NULL,
+			run_id INTEGER NOT NULL DEFAULT 0,
+			actor TEXT NOT NULL DEFAULT '',
+			version TEXT NOT NULL DEFAULT '',
+			stamped_at TEXT NOT NULL
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_vhost_stamps_hash ON vhost_stamps(render_hash, id);`); err != nil {
+		return err
+	}
+
+	// events: panel event log
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS events(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at TEXT NOT NULL,
+			level TEXT NOT NULL DEFAULT 'info',
+			source TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_events_source ON events(source, id);`); err != nil {
+		return err
+	}
+	// the site and hosting user an event concerns (owner activity feed)
+	if err := addColumnIfMissing(tx, "events", "domain", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "events", "owner", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_events_owner ON events(owner, id);`); err != nil {
+		return err
+	}
+
+	// api_tokens: hashed bearer tokens with scopes, expiry and usage
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL UNIQUE,
+			hash TEXT NOT NULL,
+			scopes TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			expires_at TEXT,
+			revoked_at TEXT,
+			prev_prefix TEXT NOT NULL DEFAULT '',
+			prev_hash TEXT NOT NULL DEFAULT '',
+			prev_until TEXT,
+			last_used_at TEXT,
+			last_used_ip TEXT NOT NULL DEFAULT '',
+			uses INTEGER NOT NULL DEFAULT 0
+		);
+	`); err != nil {
+		return err
+	}
+	// reseller tokens: the domains (and their subdomains) and hosting user a token is
+	// limited to ('' = any)
+	if err := addColumnIfMissing(tx, "api_tokens", "domains", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(tx, "api_tokens", "hosting_user", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// mail_queue: outgoing mail, retried with backoff until sent or given up
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS mail_queue(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			to_addr TEXT NOT NULL,
+			subject TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'queued',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TEXT,
+			created_at TEXT NOT NULL,
+			sent_at TEXT
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_mail_queue_due ON mail_queue(status, next_attempt_at);`); err != nil {
+		return err
+	}
+
+	// jobs: long-running operations queued for the background worker
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			params TEXT NOT NULL DEFAULT '',
+			actor TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'queued',
+			error TEXT NOT NULL DEFAULT '',
+			run_id INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL,
+			started_at TEXT,
+			finished_at TEXT
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status, id);`); err != nil {
+		return err
+	}
+	// progress: where a long job is (the batches of a large apply)
+	if err := addColumnIfMissing(tx, "jobs", "progress", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// change_requests: sensitive operations held for a second admin (security.approvals)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS change_requests(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			params TEXT NOT NULL DEFAULT '',
+			requested_by TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending',
+			decided_by TEXT NOT NULL DEFAULT '',
+			decided_at TEXT,
+			note TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		return err
+	}
+
+	// audit_log: every mutating action from the CLI, panel and API (security.audit_log)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at TEXT NOT NULL,
+			via TEXT NOT NULL,
+			actor TEXT NOT NULL DEFAULT '',
+			remote TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			target TEXT NOT NULL DEFAULT '',
+			params TEXT NOT NULL DEFAULT '',
+			old_values TEXT NOT NULL DEFAULT '',
+			new_values TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'ok',
+			error TEXT NOT NULL DEFAULT ''
+		);
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_audit_target ON audit_log(target, id);`); err != nil {
+		return err
+	}
+
+	// settings: small key/value store for panel-internal state (e.g. token signing secret)
+	if _, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS settings(
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+		);
+	`); err != nil {
+		return err
+	}
+
 
 
 
 	return tx.Commit()
 }
+
+// addColumnIfMissing runs ALTER TABLE ... ADD COLUMN unless the column already exists.
+func addColumnIfMissing(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
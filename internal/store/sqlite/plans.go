@@ -0,0 +1,165 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) ListUsers() ([]store.User, error) {
+	rows, err := s.db.Query(`
+		SELECT id, username, home_dir, plan_id, created_at, sftp_jail
+		  FROM users
+		 ORDER BY username ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.User
+	for rows.Next() {
+		var u store.User
+		var created string
+		var jail int
+		if err := rows.Scan(&u.ID, &u.Username, &u.HomeDir, &u.PlanID, &created, &jail); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			u.CreatedAt = t
+		}
+		u.SFTPJail = jail == 1
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CountSitesByUserID(userID int64) (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sites WHERE user_id=?`, userID).Scan(&n)
+	return n, err
+}
+
+const planCols = `id, name, max_sites, max_proxy_targets, php_versions, bandwidth_mb, disk_mb, created_at, updated_at`
+
+func scanPlan(sc interface{ Scan(...any) error }) (store.Plan, error) {
+	var p store.Plan
+	var php, created, updated string
+	if err := sc.Scan(&p.ID, &p.Name, &p.MaxSites, &p.MaxProxyTargets, &php,
+		&p.BandwidthMB, &p.DiskMB, &created, &updated); err != nil {
+		return store.Plan{}, err
+	}
+	for _, v := range strings.Split(php, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			p.PHPVersions = append(p.PHPVersions, v)
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		p.CreatedAt = t
+	}
+	if t, err := time.Parse(time.RFC3339Nano, updated); err == nil {
+		p.UpdatedAt = t
+	}
+	return p, nil
+}
+
+func (s *Store) ListPlans() ([]store.Plan, error) {
+	rows, err := s.db.Query(`SELECT ` + planCols + ` FROM plans ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.Plan
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetPlanByID(id int64) (store.Plan, error) {
+	return scanPlan(s.db.QueryRow(`SELECT `+planCols+` FROM plans WHERE id=?`, id))
+}
+
+func (s *Store) GetPlanByName(name string) (store.Plan, error) {
+	return scanPlan(s.db.QueryRow(`SELECT `+planCols+` FROM plans WHERE name=?`, strings.TrimSpace(name)))
+}
+
+// UpsertPlan creates or updates a plan by name.
+func (s *Store) UpsertPlan(p store.Plan) (store.Plan, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return store.Plan{}, fmt.Errorf("plan name is required")
+	}
+	if p.MaxSites < 0 || p.MaxProxyTargets < 0 || p.BandwidthMB < 0 || p.DiskMB < 0 {
+		return store.Plan{}, fmt.Errorf("plan limits must be >= 0 (0 = unlimited)")
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO plans(name, max_sites, max_proxy_targets, php_versions, bandwidth_mb, disk_mb)
+		VALUES(?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			max_sites=excluded.max_sites,
+			max_proxy_targets=excluded.max_proxy_targets,
+			php_versions=excluded.php_versions,
+			bandwidth_mb=excluded.bandwidth_mb,
+			disk_mb=excluded.disk_mb,
+			updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+	`, p.Name, p.MaxSites, p.MaxProxyTargets, strings.Join(p.PHPVersions, ","), p.BandwidthMB, p.DiskMB)
+	if err != nil {
+		return store.Plan{}, err
+	}
+	return s.GetPlanByName(p.Name)
+}
+
+// DeletePlan removes a plan; users on it fall back to "no plan".
+func (s *Store) DeletePlan(name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`SELECT id FROM plans WHERE name=?`, strings.TrimSpace(name)).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("plan %q not found", name)
+		}
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE users SET plan_id=0 WHERE plan_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM plans WHERE id=?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetUserPlan assigns a plan to a hosting user (planID 0 clears it).
+func (s *Store) SetUserPlan(userID, planID int64) error {
+	if userID == 0 {
+		return fmt.Errorf("user id is required")
+	}
+	_, err := s.db.Exec(`UPDATE users SET plan_id=? WHERE id=?`, planID, userID)
+	return err
+}
+
+// SetUserSFTPJail records whether a user is confined to the SFTP jail.
+func (s *Store) SetUserSFTPJail(userID int64, on bool) error {
+	if userID == 0 {
+		return fmt.Errorf("user id is required")
+	}
+	v := 0
+	if on {
+		v = 1
+	}
+	_, err := s.db.Exec(`UPDATE users SET sftp_jail=? WHERE id=?`, v, userID)
+	return err
+}
@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// ListSitePreloads returns a site's preload links in the order they were added.
+func (s *Store) ListSitePreloads(siteID int64) ([]store.SitePreload, error) {
+	rows, err := s.db.Query(`
+		SELECT url, as_type, crossorigin
+		  FROM site_preloads
+		 WHERE site_id = ?
+		 ORDER BY id ASC
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.SitePreload
+	for rows.Next() {
+		var p store.SitePreload
+		var co int
+		if err := rows.Scan(&p.URL, &p.As, &co); err != nil {
+			return nil, err
+		}
+		p.Crossorigin = co == 1
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// SetSitePreload adds or replaces (by URL) a preload link of the site and bumps its
+// revision so it shows as pending.
+func (s *Store) SetSitePreload(domain string, p store.SitePreload) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO site_preloads(site_id, url, as_type, crossorigin)
+		VALUES(?,?,?,?)
+		ON CONFLICT(site_id, url) DO UPDATE SET
+			as_type=excluded.as_type,
+			crossorigin=excluded.crossorigin
+	`, siteID, strings.TrimSpace(p.URL), p.As, boolInt(p.Crossorigin)); err != nil {
+		return err
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSitePreload removes a preload link of the site (sql.ErrNoRows if it has none for url).
+func (s *Store) DeleteSitePreload(domain, url string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM site_preloads WHERE site_id = ? AND url = ?`, siteID, strings.TrimSpace(url))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) SaveSiteReach(r store.SiteReach) error {
+	_, err := s.db.Exec(`
+		INSERT INTO site_reach(domain, checked_at, report)
+		VALUES(?,?,?)
+		ON CONFLICT(domain) DO UPDATE SET
+			checked_at=excluded.checked_at,
+			report=excluded.report
+	`, r.Domain, r.CheckedAt.UTC().Format(time.RFC3339Nano), string(r.Report))
+	return err
+}
+
+func (s *Store) GetSiteReach(domain string) (store.SiteReach, error) {
+	var r store.SiteReach
+	var checked, report string
+	err := s.db.QueryRow(`SELECT domain, checked_at, report FROM site_reach WHERE domain=?`, domain).
+		Scan(&r.Domain, &checked, &report)
+	if err != nil {
+		return store.SiteReach{}, err
+	}
+	r.Report = []byte(report)
+	if t, err := time.Parse(time.RFC3339Nano, checked); err == nil {
+		r.CheckedAt = t
+	}
+	return r, nil
+}
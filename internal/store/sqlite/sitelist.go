@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// siteSortSQL maps store.SiteSortColumns to ORDER BY expressions (never user input).
+var siteSortSQL = map[string]string{
+	"domain":       "s.domain",
+	"owner":        "owner",
+	"mode":         "s.mode",
+	"enabled":      "s.enabled",
+	"cert":         "c.not_after IS NULL, c.not_after",
+	"state":        "state",
+	"last_applied": "s.last_applied_at IS NULL, s.last_applied_at",
+	"php":          "s.php_version",
+}
+
+// siteStateSQL is the list state of a site row. It must agree with app.siteNeedsApply.
+const siteStateSQL = `CASE
+		         WHEN s.enabled=0 THEN 'DISABLED'
+		         WHEN s.last_apply_status='fail' THEN 'ERROR'
+		         WHEN s.last_applied_at IS NULL OR COALESCE(s.last_apply_status,'')!='ok'
+		              OR s.updated_at > s.last_applied_at THEN 'PENDING'
+		         ELSE 'OK'
+		       END`
+
+// siteListWhere is the WHERE clause of the filters of opts, with its arguments.
+func siteListWhere(opts store.SiteListOptions) (string, []any) {
+	conds := []string{"(?='' OR u.username=?)"}
+	args := []any{opts.Owner, opts.Owner}
+	if q := strings.ToLower(strings.TrimSpace(opts.Search)); q != "" {
+		conds = append(conds, `s.domain LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q)+"%")
+	}
+	if opts.Mode != "" {
+		conds = append(conds, "s.mode=?")
+		args = append(args, opts.Mode)
+	}
+	if opts.State != "" {
+		conds = append(conds, siteStateSQL+"=?")
+		args = append(args, opts.State)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// CountSiteRows returns how many sites match the filters of opts (its order and
+// paging aside).
+func (s *Store) CountSiteRows(opts store.SiteListOptions) (int, error) {
+	where, args := siteListWhere(opts)
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM sites s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+// ListSiteRows returns the sites matching opts with their owner, state and cached
+// certificate expiry in one query, one page of them when opts.Limit is set.
+func (s *Store) ListSiteRows(opts store.SiteListOptions) ([]store.SiteRow, error) {
+	order, ok := siteSortSQL[opts.Sort]
+	if !ok {
+		order = siteSortSQL["domain"]
+	}
+	dir := "ASC"
+	if opts.Desc {
+		dir = "DESC"
+	}
+	// the direction goes on the last term only, so "x IS NULL, x" keeps NULLs
+	// (no cert / never applied) last either way
+	order += " " + dir
+	where, args := siteListWhere(opts)
+	limit, offset := opts.Limit, opts.Offset
+	if limit <= 0 {
+		limit = -1 // SQLite: no limit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.db.Query(`
+		SELECT s.id, s.user_id, s.domain, s.mode, s.webroot, s.php_version,
+		       s.enable_http3, s.enabled,
+		       s.created_at, s.updated_at,
+		       COALESCE(s.last_render_hash,''), COALESCE(s.last_apply_status,''), COALESCE(s.last_apply_error,''),
+		       s.last_applied_at, s.revision, s.active_group, s.mirror_target, s.mirror_percent, s.dual_cert, s.access_syslog, s.access_log_sample,
+		       s.keepalive_conns, s.keepalive_requests, s.keepalive_timeout, s.backend_health,
+		       s.tls_mode, s.tls_cert_path, s.tls_key_path, s.cert_lineage,
+		       s.expires_at, s.expiry_notify, s.expiry_warned_at, s.acme_ca,
+		       s.redirect_url, s.redirect_code, s.redirect_keep_path, s.placeholder, s.hardened, s.preview_host, s.reapply_cron, s.discovery, s.tags,
+		       s.retire_until, s.retire_status,
+		       COALESCE(u.username,'') AS owner,
+		       `+siteStateSQL+` AS state,
+		       c.not_after, c.checked_at
+		FROM sites s
+		LEFT JOIN users u ON u.id = s.user_id
+		LEFT JOIN cert_cache c ON c.domain = s.domain
+		WHERE `+where+`
+		ORDER BY `+order+`, s.domain ASC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.SiteRow
+	for rows.Next() {
+		var r store.SiteRow
+		var created, updated string
+		var enableHTTP3, enabled, dualCert, keepPath, placeholder, hardened int
+		var tags string
+		var lastApplied, expiresAt, warnedAt, retireUntil, notAfter, checkedAt sql.NullString
+
+		if err := rows.Scan(
+			&r.ID, &r.UserID, &r.Domain, &r.Mode, &r.Webroot, &r.PHPVersion,
+			&enableHTTP3, &enabled,
+			&created, &updated,
+			&r.LastRenderHash, &r.LastApplyStatus, &r.LastApplyError,
+			&lastApplied, &r.Revision, &r.ActiveGroup, &r.MirrorTarget, &r.MirrorPercent, &dualCert, &r.AccessSyslog, &r.AccessLogSample,
+			&r.KeepaliveConns, &r.KeepaliveRequests, &r.KeepaliveTimeout, &r.BackendHealth,
+			&r.CertSource, &r.TLSCertPath, &r.TLSKeyPath, &r.CertLineage,
+			&expiresAt, &r.ExpiryNotify, &warnedAt, &r.ACMECA,
+			&r.RedirectURL, &r.RedirectCode, &keepPath, &placeholder, &hardened, &r.PreviewHost, &r.ReapplyCron, &r.Discovery, &tags,
+			&retireUntil, &r.RetireStatus,
+			&r.Owner, &r.State,
+			&notAfter, &checkedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		r.EnableHTTP3 = enableHTTP3 == 1
+		r.Enabled = enabled == 1
+		r.DualCert = dualCert == 1
+		r.RedirectKeepPath = keepPath == 1
+		r.Placeholder = placeholder == 1
+		r.Hardened = hardened == 1
+		r.Tags = splitTags(tags)
+
+		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+			r.CreatedAt = t
+		}
+		if t, err := time.Parse(time.RFC3339Nano, updated); err == nil {
+			r.UpdatedAt = t
+		}
+		r.LastAppliedAt = parseNullTime(lastApplied)
+		r.ExpiresAt = parseNullTime(expiresAt)
+		r.ExpiryWarnedAt = parseNullTime(warnedAt)
+		r.RetireUntil = parseNullTime(retireUntil)
+		r.CertNotAfter = parseNullTime(notAfter)
+		r.CertCheckedAt = parseNullTime(checkedAt)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SetCertCache records the certificate expiry of domain (nil = it has none).
+func (s *Store) SetCertCache(domain string, notAfter *time.Time) error {
+	var na any
+	if notAfter != nil {
+		na = notAfter.UTC().Format(time.RFC3339Nano)
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO cert_cache(domain, not_after, checked_at) VALUES(?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET
+			not_after=excluded.not_after,
+			checked_at=excluded.checked_at
+	`, domain, na, time.Now().UTC().Format(time.RFC3339Nano))
+	return err
+}
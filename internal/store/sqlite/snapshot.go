@@ -0,0 +1,18 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+)
+
+// Snapshot writes a consistent copy of the database to path (VACUUM INTO), safe to
+// take while the panel is serving. path must not exist yet.
+func (s *Store) Snapshot(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot %s: file exists", path)
+	}
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return nil
+}
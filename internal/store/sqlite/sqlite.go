@@ -16,13 +16,14 @@ import (
 )
 
 type Store struct {
-	db *sql.DB
+	db      *sql.DB
+	metrics *queryMetrics
 }
 
 // ListProxyTargetsBySiteID returns enabled proxy upstream targets for a site.
 func (s *Store) ListProxyTargetsBySiteID(siteID int64) ([]nginx.UpstreamTarget, error) {
     rows, err := s.db.Query(`
-	  SELECT target, weight, is_backup, enabled
+	  SELECT target, weight, is_backup, enabled, target_group, discovered
           FROM proxy_targets
          WHERE site_id = ?
          ORDER BY is_backup ASC, id ASC
@@ -35,12 +36,13 @@ func (s *Store) ListProxyTargetsBySiteID(siteID int64) ([]nginx.UpstreamTarget,
     var out []nginx.UpstreamTarget
     for rows.Next() {
         var t nginx.UpstreamTarget
-        var isBackup, enabled int
-        if err := rows.Scan(&t.Addr, &t.Weight, &isBackup, &enabled); err != nil {
+        var isBackup, enabled, discovered int
+        if err := rows.Scan(&t.Addr, &t.Weight, &isBackup, &enabled, &t.Group, &discovered); err != nil {
             return nil, err
         }
         t.Backup = isBackup == 1
         t.Enabled = enabled == 1
+        t.Discovered = discovered == 1
         out = append(out, t)
     }
     return out, rows.Err()
@@ -59,20 +61,40 @@ func Open(path string) (*Store, error) {
 	// busy_timeout helps when you add API later
 	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", path)
 
-	db, err := sql.Open("sqlite", dsn)
+	// open through timedConnector so every statement is counted (see Metrics)
+	raw, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
+	drv := raw.Driver()
+	_ = raw.Close()
+	m := newQueryMetrics()
+	db := sql.OpenDB(&timedConnector{drv: drv, dsn: dsn, m: m})
 
 	// conservative pool for single-file sqlite
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(0)
 
-	s := &Store{db: db}
+	s := &Store{db: db, metrics: m}
 	return s, nil
 }
 
+// SetSlowQuery logs statements taking at least d (0 = off).
+func (s *Store) SetSlowQuery(d time.Duration) {
+	s.metrics.slow.Store(int64(d))
+}
+
+// Metrics returns the query timings and pool statistics since Open.
+func (s *Store) Metrics() store.StoreMetrics {
+	out := s.metrics.snapshot()
+	st := s.db.Stats()
+	out.InUse = st.InUse
+	out.WaitCount = st.WaitCount
+	out.WaitTotal = st.WaitDuration
+	return out
+}
+
 func (s *Store) Close() error {
 	if s.db == nil {
 		return nil
@@ -105,18 +127,20 @@ func (s *Store) EnsureUser(username, homeDir string) (store.User, error) {
 func (s *Store) GetUserByUsername(username string) (store.User, error) {
 	var u store.User
 	var created string
+	var jail int
 
 	err := s.db.QueryRow(`
-		SELECT id, username, home_dir, created_at
+		SELECT id, username, home_dir, plan_id, created_at, sftp_jail
 		FROM users
 		WHERE username=?
-	`, username).Scan(&u.ID, &u.Username, &u.HomeDir, &created)
+	`, username).Scan(&u.ID, &u.Username, &u.HomeDir, &u.PlanID, &created, &jail)
 	if err != nil {
 		return store.User{}, err
 	}
 
 	t, _ := time.Parse(time.RFC3339Nano, created)
 	u.CreatedAt = t
+	u.SFTPJail = jail == 1
 	return u, nil
 }
 
@@ -133,7 +157,7 @@ func (s *Store) UpsertSite(site store.Site) (store.Site, error) {
 	if site.Webroot == "" {
 		return store.Site{}, fmt.Errorf("webroot is required")
 	}
-	if site.Mode != "php" && site.Mode != "proxy" && site.Mode != "static" {
+	if site.Mode != "php" && site.Mode != "proxy" && site.Mode != "static" && site.Mode != "redirect" {
 		return store.Site{}, fmt.Errorf("invalid mode %q", site.Mode)
 	}
 
@@ -146,7 +170,8 @@ func (s *Store) UpsertSite(site store.Site) (store.Site, error) {
 		enabled = 1
 	}
 
-	_, err := s.db.Exec(`
+	// site.Revision > 0 makes the update conditional (optimistic concurrency)
+	res, err := s.db.Exec(`
 		INSERT INTO sites(
 			user_id, domain, mode, webroot, php_version,
 			enable_http3, enabled
@@ -158,14 +183,20 @@ func (s *Store) UpsertSite(site store.Site) (store.Site, error) {
 			php_version=excluded.php_version,
 			enable_http3=excluded.enable_http3,
 			enabled=excluded.enabled,
+			revision=sites.revision+1,
 			updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		WHERE ?=0 OR sites.revision=?
 	`,
 		site.UserID, site.Domain, site.Mode, site.Webroot, site.PHPVersion,
 		enableHTTP3, enabled,
+		site.Revision, site.Revision,
 	)
 	if err != nil {
 		return store.Site{}, err
 	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return store.Site{}, store.ErrRevisionConflict
+	}
 
 	return s.GetSiteByDomain(site.Domain)
 }
@@ -173,22 +204,33 @@ func (s *Store) UpsertSite(site store.Site) (store.Site, error) {
 func (s *Store) GetSiteByDomain(domain string) (store.Site, error) {
 	var out store.Site
 	var created, updated string
-	var enableHTTP3, enabled int
-	var lastApplied sql.NullString
+	var enableHTTP3, enabled, dualCert, keepPath, placeholder, hardened int
+	var tags string
+	var lastApplied, expiresAt, warnedAt, retireUntil sql.NullString
 
 	err := s.db.QueryRow(`
 		SELECT id, user_id, domain, mode, webroot, php_version,
 		       enable_http3, enabled,
 		       created_at, updated_at,
 		       COALESCE(last_render_hash,''), COALESCE(last_apply_status,''), COALESCE(last_apply_error,''),
-		       last_applied_at
+		       last_applied_at, revision, active_group, mirror_target, mirror_percent, dual_cert, access_syslog, access_log_sample,
+		       keepalive_conns, keepalive_requests, keepalive_timeout, backend_health,
+		       tls_mode, tls_cert_path, tls_key_path, cert_lineage,
+		       expires_at, expiry_notify, expiry_warned_at, acme_ca,
+		       redirect_url, redirect_code, redirect_keep_path, placeholder, hardened, preview_host, reapply_cron, discovery, tags,
+		       retire_until, retire_status
 		FROM sites WHERE domain=?
 	`, domain).Scan(
 		&out.ID, &out.UserID, &out.Domain, &out.Mode, &out.Webroot, &out.PHPVersion,
 		&enableHTTP3, &enabled,
 		&created, &updated,
 		&out.LastRenderHash, &out.LastApplyStatus, &out.LastApplyError,
-		&lastApplied,
+		&lastApplied, &out.Revision, &out.ActiveGroup, &out.MirrorTarget, &out.MirrorPercent, &dualCert, &out.AccessSyslog, &out.AccessLogSample,
+		&out.KeepaliveConns, &out.KeepaliveRequests, &out.KeepaliveTimeout, &out.BackendHealth,
+		&out.CertSource, &out.TLSCertPath, &out.TLSKeyPath, &out.CertLineage,
+		&expiresAt, &out.ExpiryNotify, &warnedAt, &out.ACMECA,
+		&out.RedirectURL, &out.RedirectCode, &keepPath, &placeholder, &hardened, &out.PreviewHost, &out.ReapplyCron, &out.Discovery, &tags,
+		&retireUntil, &out.RetireStatus,
 	)
 	if err != nil {
 		return store.Site{}, err
@@ -196,6 +238,11 @@ func (s *Store) GetSiteByDomain(domain string) (store.Site, error) {
 
 	out.EnableHTTP3 = enableHTTP3 == 1
 	out.Enabled = enabled == 1
+	out.DualCert = dualCert == 1
+	out.RedirectKeepPath = keepPath == 1
+	out.Placeholder = placeholder == 1
+	out.Hardened = hardened == 1
+	out.Tags = splitTags(tags)
 
 	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
 		out.CreatedAt = t
@@ -208,6 +255,9 @@ func (s *Store) GetSiteByDomain(domain string) (store.Site, error) {
 			out.LastAppliedAt = &t
 		}
 	}
+	out.ExpiresAt = parseNullTime(expiresAt)
+	out.ExpiryWarnedAt = parseNullTime(warnedAt)
+	out.RetireUntil = parseNullTime(retireUntil)
 	return out, nil
 }
 
@@ -217,7 +267,12 @@ func (s *Store) ListSites() ([]store.Site, error) {
 		       enable_http3, enabled,
 		       created_at, updated_at,
 		       COALESCE(last_render_hash,''), COALESCE(last_apply_status,''), COALESCE(last_apply_error,''),
-		       last_applied_at
+		       last_applied_at, revision, active_group, mirror_target, mirror_percent, dual_cert, access_syslog, access_log_sample,
+		       keepalive_conns, keepalive_requests, keepalive_timeout, backend_health,
+		       tls_mode, tls_cert_path, tls_key_path, cert_lineage,
+		       expires_at, expiry_notify, expiry_warned_at, acme_ca,
+		       redirect_url, redirect_code, redirect_keep_path, placeholder, hardened, preview_host, reapply_cron, discovery, tags,
+		       retire_until, retire_status
 		FROM sites
 		ORDER BY domain ASC
 	`)
@@ -230,21 +285,32 @@ func (s *Store) ListSites() ([]store.Site, error) {
 	for rows.Next() {
 		var sitem store.Site
 		var created, updated string
-		var enableHTTP3, enabled int
-		var lastApplied sql.NullString
+		var enableHTTP3, enabled, dualCert, keepPath, placeholder, hardened int
+		var tags string
+		var lastApplied, expiresAt, warnedAt, retireUntil sql.NullString
 
 		if err := rows.Scan(
 			&sitem.ID, &sitem.UserID, &sitem.Domain, &sitem.Mode, &sitem.Webroot, &sitem.PHPVersion,
 			&enableHTTP3, &enabled,
 			&created, &updated,
 			&sitem.LastRenderHash, &sitem.LastApplyStatus, &sitem.LastApplyError,
-			&lastApplied,
+			&lastApplied, &sitem.Revision, &sitem.ActiveGroup, &sitem.MirrorTarget, &sitem.MirrorPercent, &dualCert, &sitem.AccessSyslog, &sitem.AccessLogSample,
+			&sitem.KeepaliveConns, &sitem.KeepaliveRequests, &sitem.KeepaliveTimeout, &sitem.BackendHealth,
+			&sitem.CertSource, &sitem.TLSCertPath, &sitem.TLSKeyPath, &sitem.CertLineage,
+			&expiresAt, &sitem.ExpiryNotify, &warnedAt, &sitem.ACMECA,
+			&sitem.RedirectURL, &sitem.RedirectCode, &keepPath, &placeholder, &hardened, &sitem.PreviewHost, &sitem.ReapplyCron, &sitem.Discovery, &tags,
+			&retireUntil, &sitem.RetireStatus,
 		); err != nil {
 			return nil, err
 		}
 
 		sitem.EnableHTTP3 = enableHTTP3 == 1
 		sitem.Enabled = enabled == 1
+		sitem.DualCert = dualCert == 1
+		sitem.RedirectKeepPath = keepPath == 1
+		sitem.Placeholder = placeholder == 1
+		sitem.Hardened = hardened == 1
+		sitem.Tags = splitTags(tags)
 
 		if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
 			sitem.CreatedAt = t
@@ -257,6 +323,9 @@ func (s *Store) ListSites() ([]store.Site, error) {
 				sitem.LastAppliedAt = &t
 			}
 		}
+		sitem.ExpiresAt = parseNullTime(expiresAt)
+		sitem.ExpiryWarnedAt = parseNullTime(warnedAt)
+		sitem.RetireUntil = parseNullTime(retireUntil)
 		out = append(out, sitem)
 	}
 
@@ -273,6 +342,9 @@ func (s *Store) EnableSiteByDomain(domain string) error {
         UPDATE sites
            SET enabled    = 1,
                deleted_at = NULL,
+               retire_until  = NULL,
+               retire_status = 0,
+               revision   = revision + 1,
                updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
          WHERE domain = ?
     `, domain)
@@ -330,6 +402,9 @@ func (s *Store) DisableSiteByDomain(domain string) error {
                 UPDATE sites
                    SET enabled = 0,
                        deleted_at = COALESCE(deleted_at, strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+                       retire_until = NULL,
+                       retire_status = 0,
+                       revision = revision + 1,
                        updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
                  WHERE domain = ?
         `, domain)
@@ -361,7 +436,10 @@ func (s *Store) ListPendingSites() ([]store.Site, error) {
                        enable_http3, enabled,
                        created_at, updated_at,
                        COALESCE(last_render_hash,''), COALESCE(last_apply_status,''), COALESCE(last_apply_error,''),
-                       last_applied_at
+                       last_applied_at, active_group, mirror_target, mirror_percent, dual_cert, access_syslog, access_log_sample,
+                       keepalive_conns, keepalive_requests, keepalive_timeout, backend_health,
+                       tls_mode, tls_cert_path, tls_key_path, cert_lineage, acme_ca,
+                       redirect_url, redirect_code, redirect_keep_path, placeholder, hardened, preview_host, reapply_cron, discovery, tags
                 FROM sites
                 WHERE enabled=1
                   AND (last_applied_at IS NULL
@@ -379,7 +457,8 @@ func (s *Store) ListPendingSites() ([]store.Site, error) {
         for rows.Next() {
                 var site store.Site
                 var created, updated string
-                var enableHTTP3, enabled int
+                var enableHTTP3, enabled, dualCert, keepPath, placeholder, hardened int
+                var tags string
                 var lastApplied *string // nullable
 
                 if err := rows.Scan(
@@ -387,13 +466,21 @@ func (s *Store) ListPendingSites() ([]store.Site, error) {
                         &enableHTTP3, &enabled,
                         &created, &updated,
                         &site.LastRenderHash, &site.LastApplyStatus, &site.LastApplyError,
-                        &lastApplied,
+                        &lastApplied, &site.ActiveGroup, &site.MirrorTarget, &site.MirrorPercent, &dualCert, &site.AccessSyslog, &site.AccessLogSample,
+                        &site.KeepaliveConns, &site.KeepaliveRequests, &site.KeepaliveTimeout, &site.BackendHealth,
+                        &site.CertSource, &site.TLSCertPath, &site.TLSKeyPath, &site.CertLineage, &site.ACMECA,
+                        &site.RedirectURL, &site.RedirectCode, &keepPath, &placeholder, &hardened, &site.PreviewHost, &site.ReapplyCron, &site.Discovery, &tags,
                 ); err != nil {
                         return nil, err
                 }
 
                 site.EnableHTTP3 = enableHTTP3 == 1
                 site.Enabled = enabled == 1
+                site.DualCert = dualCert == 1
+                site.RedirectKeepPath = keepPath == 1
+                site.Placeholder = placeholder == 1
+                site.Hardened = hardened == 1
+                site.Tags = splitTags(tags)
                 // timestamps parsed already in Get/List; not critical for apply
                 out = append(out, site)
         }
@@ -433,25 +520,79 @@ func (s *Store) CreatePanelUser(username, passwordHash, role string, enabled boo
 	return s.GetPanelUserByUsername(username)
 }
 
+// CountPanelUsers returns how many panel users exist (0 before the first-run setup).
+func (s *Store) CountPanelUsers() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM panel_users`).Scan(&n)
+	return n, err
+}
+
 func (s *Store) GetPanelUserByUsername(username string) (store.PanelUser, error) {
+	return s.getPanelUser(`username=?`, username)
+}
+
+func (s *Store) GetPanelUserByID(id int64) (store.PanelUser, error) {
+	return s.getPanelUser(`id=?`, id)
+}
+
+// GetPanelUserByEmail matches case-insensitively; empty email never matches.
+func (s *Store) GetPanelUserByEmail(email string) (store.PanelUser, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return store.PanelUser{}, sql.ErrNoRows
+	}
+	return s.getPanelUser(`email<>'' AND lower(email)=lower(?)`, email)
+}
+
+// panelUserCols are the columns scanPanelUser reads.
+const panelUserCols = `id, username, password_hash, role, hosting_user, enabled, language,
+		       email, email_verified, must_change_password,
+		       last_login_at, created_at, updated_at`
+
+func (s *Store) getPanelUser(where string, arg any) (store.PanelUser, error) {
+	return scanPanelUser(s.db.QueryRow(`
+		SELECT `+panelUserCols+`
+		  FROM panel_users
+		 WHERE `+where+`
+		 LIMIT 1
+	`, arg).Scan)
+}
+
+// ListPanelUsers returns every panel user, by username.
+func (s *Store) ListPanelUsers() ([]store.PanelUser, error) {
+	rows, err := s.db.Query(`SELECT ` + panelUserCols + ` FROM panel_users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []store.PanelUser
+	for rows.Next() {
+		u, err := scanPanelUser(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func scanPanelUser(scan func(...any) error) (store.PanelUser, error) {
 	var u store.PanelUser
-	var enabled int
+	var enabled, verified, mustChange int
 	var lastLogin sql.NullString
 	var created, updated string
 
-	err := s.db.QueryRow(`
-		SELECT id, username, password_hash, role, enabled,
-		       last_login_at, created_at, updated_at
-		  FROM panel_users
-		 WHERE username=?
-	`, username).Scan(
-		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &enabled,
+	err := scan(
+		&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.HostingUser, &enabled, &u.Language,
+		&u.Email, &verified, &mustChange,
 		&lastLogin, &created, &updated,
 	)
 	if err != nil {
 		return store.PanelUser{}, err
 	}
 	u.Enabled = enabled == 1
+	u.EmailVerified = verified == 1
+	u.MustChangePassword = mustChange == 1
 
 	if lastLogin.Valid && lastLogin.String != "" {
 		if t, err := time.Parse(time.RFC3339Nano, lastLogin.String); err == nil {
@@ -481,28 +622,219 @@ func (s *Store) UpdatePanelUserLastLogin(id int64) error {
 	return err
 }
 
+func (s *Store) UpdatePanelUserLanguage(id int64, lang string) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	_, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET language=?,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, strings.TrimSpace(lang), id)
+	return err
+}
+
+// UpdatePanelUserPassword stores a new hash and clears the forced-change flag.
+func (s *Store) UpdatePanelUserPassword(id int64, passwordHash string) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	if passwordHash == "" {
+		return fmt.Errorf("passwordHash is required")
+	}
+	_, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET password_hash=?,
+		       must_change_password=0,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, passwordHash, id)
+	return err
+}
+
+func (s *Store) SetPanelUserMustChangePassword(id int64, must bool) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	_, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET must_change_password=?,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, boolInt(must), id)
+	return err
+}
+
+// UpdatePanelUserEmail sets the address; changing it resets the verified flag.
+func (s *Store) UpdatePanelUserEmail(id int64, email string) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	_, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET email_verified=CASE WHEN lower(email)=lower(?) THEN email_verified ELSE 0 END,
+		       email=?,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, strings.TrimSpace(email), strings.TrimSpace(email), id)
+	return err
+}
+
+// UpdatePanelUser saves the role, hosting user link and enabled flag of u (by ID).
+func (s *Store) UpdatePanelUser(u store.PanelUser) error {
+	if u.ID == 0 {
+		return fmt.Errorf("id is required")
+	}
+	if u.Role == "" {
+		return fmt.Errorf("role is required")
+	}
+	res, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET role=?,
+		       hosting_user=?,
+		       enabled=?,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, u.Role, strings.TrimSpace(u.HostingUser), boolInt(u.Enabled), u.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeletePanelUser removes a panel user; sql.ErrNoRows when there is none.
+func (s *Store) DeletePanelUser(id int64) error {
+	res, err := s.db.Exec(`DELETE FROM panel_users WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetPanelUserHostingUser links a panel account to the hosting user whose sites it
+// manages ("" = the hosting user with the account's name).
+func (s *Store) SetPanelUserHostingUser(id int64, hostingUser string) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	res, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET hosting_user=?,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, strings.TrimSpace(hostingUser), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) MarkPanelUserEmailVerified(id int64) error {
+	if id == 0 {
+		return fmt.Errorf("id is required")
+	}
+	_, err := s.db.Exec(`
+		UPDATE panel_users
+		   SET email_verified=1,
+		       updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE id=?
+	`, id)
+	return err
+}
+
+// ---------------- leases ----------------
+
+// AcquireLease takes (or extends) a named lease atomically; expired leases are free.
+func (s *Store) AcquireLease(name, holder string, expires time.Time) (bool, string, error) {
+	now := time.Now().Unix()
+	_, err := s.db.Exec(`
+		INSERT INTO leases(name, holder, expires_at) VALUES(?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			holder=excluded.holder,
+			expires_at=excluded.expires_at
+		WHERE leases.holder=excluded.holder OR leases.expires_at<=?
+	`, name, holder, expires.Unix(), now)
+	if err != nil {
+		return false, "", err
+	}
+	var cur string
+	if err := s.db.QueryRow(`SELECT holder FROM leases WHERE name=?`, name).Scan(&cur); err != nil {
+		return false, "", err
+	}
+	return cur == holder, cur, nil
+}
+
+func (s *Store) ReleaseLease(name, holder string) error {
+	_, err := s.db.Exec(`DELETE FROM leases WHERE name=? AND holder=?`, name, holder)
+	return err
+}
+
+// ---------------- settings (key/value) ----------------
+
+// GetSetting returns ("", false, nil) when the key is not set.
+func (s *Store) GetSetting(key string) (string, bool, error) {
+	var v string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key=?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+func (s *Store) SetSetting(key, value string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO settings(key, value) VALUES(?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			value=excluded.value,
+			updated_at=strftime('%Y-%m-%dT%H:%M:%fZ','now')
+	`, key, value)
+	return err
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func (s *Store) GetUserByID(id int64) (store.User, error) {
         if id == 0 {
                 return store.User{}, fmt.Errorf("id is required")
         }
         var out store.User
         var created string
+        var jail int
         err := s.db.QueryRow(`
-                SELECT id, username, home_dir, created_at
+                SELECT id, username, home_dir, plan_id, created_at, sftp_jail
                   FROM users
                  WHERE id=?
-        `, id).Scan(&out.ID, &out.Username, &out.HomeDir, &created)
+        `, id).Scan(&out.ID, &out.Username, &out.HomeDir, &out.PlanID, &created, &jail)
         if err != nil {
                 return store.User{}, err
         }
         if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
                 out.CreatedAt = t
         }
+        out.SFTPJail = jail == 1
         return out, nil
 }
 
 
-func (s *Store) UpsertProxyTarget(siteID int64, target string, weight int, isBackup bool, enabled bool) error {
+func (s *Store) UpsertProxyTarget(siteID int64, target string, weight int, isBackup bool, enabled bool, group string) error {
 	if siteID == 0 {
 		return fmt.Errorf("siteID is required")
 	}
@@ -522,16 +854,442 @@ func (s *Store) UpsertProxyTarget(siteID int64, target string, weight int, isBac
 		en = 1
 	}
 	_, err := s.db.Exec(`
-		INSERT INTO proxy_targets(site_id, target, weight, is_backup, enabled)
-		VALUES(?,?,?,?,?)
+		INSERT INTO proxy_targets(site_id, target, weight, is_backup, enabled, target_group)
+		VALUES(?,?,?,?,?,?)
 		ON CONFLICT(site_id, target) DO UPDATE SET
 			weight=excluded.weight,
 			is_backup=excluded.is_backup,
-			enabled=excluded.enabled
-	`, siteID, target, weight, bk, en)
+			enabled=excluded.enabled,
+			target_group=excluded.target_group
+	`, siteID, target, weight, bk, en, strings.TrimSpace(group))
+	return err
+}
+
+// SetSiteActiveGroup selects which target group is rendered into the site's upstream
+// ('' renders every enabled target). It bumps the revision so the site shows as pending.
+func (s *Store) SetSiteActiveGroup(domain, group string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET active_group = ?,
+		       revision     = revision + 1,
+		       updated_at   = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(group), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteDualCert turns the alternate-key (RSA next to ECDSA) certificate of a site on or off.
+func (s *Store) SetSiteDualCert(domain string, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET dual_cert  = ?,
+		       revision   = revision + 1,
+		       updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, v, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteCertSource sets where the site's certificate comes from; the paths are
+// stored as given ("" = the source's default location), the lineage only matters
+// for the shared source.
+func (s *Store) SetSiteCertSource(domain, source, certPath, keyPath, lineage string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET tls_mode      = ?,
+		       tls_cert_path = ?,
+		       tls_key_path  = ?,
+		       cert_lineage  = ?,
+		       revision      = revision + 1,
+		       updated_at    = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, source, certPath, keyPath, lineage, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteACMECA sets the CA the site's certificates are issued by ("" = certs.ca).
+// updated_at is left alone: the CA does not change the rendered vhost.
+func (s *Store) SetSiteACMECA(domain, ca string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET acme_ca  = ?,
+		       revision = revision + 1
+		 WHERE domain = ?
+	`, strings.TrimSpace(ca), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteKeepalive sets the upstream keepalive pool of a site (0 / "" = the default).
+func (s *Store) SetSiteKeepalive(domain string, conns, requests int, timeout string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET keepalive_conns    = ?,
+		       keepalive_requests = ?,
+		       keepalive_timeout  = ?,
+		       revision           = revision + 1,
+		       updated_at         = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, conns, requests, strings.TrimSpace(timeout), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteBackendHealth sets the backend health endpoint a site exposes ("" = none).
+func (s *Store) SetSiteBackendHealth(domain, path string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET backend_health = ?,
+		       revision       = revision + 1,
+		       updated_at     = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(path), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteAccessLogSample sets the access log sampling of a site ("" = every request).
+func (s *Store) SetSiteAccessLogSample(domain, sample string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET access_log_sample = ?,
+		       revision          = revision + 1,
+		       updated_at        = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(sample), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteAccessSyslog sets the syslog server that also receives the site's access log ("" = off).
+func (s *Store) SetSiteAccessSyslog(domain, server string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET access_syslog = ?,
+		       revision      = revision + 1,
+		       updated_at    = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(server), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteExpiry sets (at=nil clears) the time the site is disabled at and the contact
+// warned beforehand. It resets the warning so a changed date is announced again.
+// updated_at is left alone: expiry does not change the rendered vhost.
+func (s *Store) SetSiteExpiry(domain string, at *time.Time, notify string) error {
+	var v any
+	if at != nil {
+		v = at.UTC().Format(time.RFC3339Nano)
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET expires_at       = ?,
+		       expiry_notify    = ?,
+		       expiry_warned_at = NULL,
+		       revision         = revision + 1
+		 WHERE domain = ?
+	`, v, strings.TrimSpace(notify), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteRetire sets (until=nil clears) the grace period of a disabled site, during
+// which its vhost serves the retired page with status.
+func (s *Store) SetSiteRetire(domain string, until *time.Time, status int) error {
+	var v any
+	if until != nil {
+		v = until.UTC().Format(time.RFC3339Nano)
+	} else {
+		status = 0
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET retire_until  = ?,
+		       retire_status = ?,
+		       revision      = revision + 1,
+		       updated_at    = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, v, status, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkSiteExpiryWarned records that the expiry warning for the site went out.
+func (s *Store) MarkSiteExpiryWarned(domain string) error {
+	_, err := s.db.Exec(`
+		UPDATE sites
+		   SET expiry_warned_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(domain))
 	return err
 }
 
+func parseNullTime(v sql.NullString) *time.Time {
+	if !v.Valid || v.String == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// nullTime is the column value of an optional timestamp (NULL for nil).
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// SetSiteMirror sets the shadow upstream that receives percent% of the site's requests
+// (an empty target turns mirroring off).
+func (s *Store) SetSiteMirror(domain, target string, percent int) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET mirror_target  = ?,
+		       mirror_percent = ?,
+		       revision       = revision + 1,
+		       updated_at     = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(target), percent, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteRedirect sets where a redirect site sends its requests, and how.
+func (s *Store) SetSiteRedirect(domain, target string, code int, keepPath bool) error {
+	keep := 0
+	if keepPath {
+		keep = 1
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET redirect_url       = ?,
+		       redirect_code      = ?,
+		       redirect_keep_path = ?,
+		       revision           = revision + 1,
+		       updated_at         = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(target), code, keep, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSitePlaceholder turns the "coming soon" page of a site on or off.
+func (s *Store) SetSitePlaceholder(domain string, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET placeholder = ?,
+		       revision    = revision + 1,
+		       updated_at  = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, v, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteHardened turns the PHP hardening preset of a site on or off.
+func (s *Store) SetSiteHardened(domain string, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET hardened   = ?,
+		       revision   = revision + 1,
+		       updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, v, strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Store) SetSitePreview(domain, host string) error {
+	res, err := s.db.Exec(`
+		UPDATE sites
+		   SET preview_host = ?,
+		       revision     = revision + 1,
+		       updated_at   = strftime('%Y-%m-%dT%H:%M:%fZ','now')
+		 WHERE domain = ?
+	`, strings.TrimSpace(host), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteReapply sets the cron schedule of a site's scheduled re-render ("" = off).
+// It does not change the rendered config, so the site is not marked pending.
+func (s *Store) SetSiteReapply(domain, expr string) error {
+	res, err := s.db.Exec(`UPDATE sites SET reapply_cron = ?, revision = revision + 1 WHERE domain = ?`,
+		strings.TrimSpace(expr), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteDiscovery sets where a proxy site's targets are discovered ("" = off).
+func (s *Store) SetSiteDiscovery(domain, spec string) error {
+	res, err := s.db.Exec(`UPDATE sites SET discovery = ?, revision = revision + 1 WHERE domain = ?`,
+		strings.TrimSpace(spec), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetSiteTags replaces the tags of a site (they do not change its config, so the
+// site is not marked pending).
+func (s *Store) SetSiteTags(domain string, tags []string) error {
+	res, err := s.db.Exec(`UPDATE sites SET tags = ?, revision = revision + 1 WHERE domain = ?`,
+		strings.Join(tags, ","), strings.TrimSpace(domain))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func splitTags(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// ReplaceDiscoveredTargets makes targets the discovered targets of a site: the
+// previous discovered rows are deleted and these inserted, in one transaction.
+// An address that is also a manual target keeps the manual row.
+func (s *Store) ReplaceDiscoveredTargets(siteID int64, targets []nginx.UpstreamTarget) error {
+	if siteID == 0 {
+		return fmt.Errorf("siteID is required")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM proxy_targets WHERE site_id=? AND discovered=1`, siteID); err != nil {
+		return err
+	}
+	for _, t := range targets {
+		weight := t.Weight
+		if weight <= 0 {
+			weight = 100
+		}
+		bk := 0
+		if t.Backup {
+			bk = 1
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO proxy_targets(site_id, target, weight, is_backup, enabled, target_group, discovered)
+			VALUES(?,?,?,?,1,'',1)
+			ON CONFLICT(site_id, target) DO NOTHING
+		`, siteID, strings.TrimSpace(t.Addr), weight, bk); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 func (s *Store) DisableProxyTarget(siteID int64, target string) error {
 	if siteID == 0 {
 		return fmt.Errorf("siteID is required")
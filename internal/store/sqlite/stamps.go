@@ -0,0 +1,63 @@
+package sqlite
+
+import (
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// vhostStampsKept bounds the stamp index of each domain; older rows are dropped on add.
+const vhostStampsKept = 100
+
+// AddVhostStamps records the stamps of the vhosts an apply run published.
+func (s *Store) AddVhostStamps(stamps []store.VhostStamp) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, st := range stamps {
+		if _, err := tx.Exec(`
+			INSERT INTO vhost_stamps(domain, render_hash, run_id, actor, version, stamped_at)
+			VALUES(?,?,?,?,?,?)
+		`, st.Domain, st.RenderHash, st.RunID, st.Actor, st.Version, st.StampedAt.UTC().Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM vhost_stamps WHERE domain=? AND id NOT IN (
+				SELECT id FROM vhost_stamps WHERE domain=? ORDER BY id DESC LIMIT ?
+			)
+		`, st.Domain, st.Domain, vhostStampsKept); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FindVhostStamps returns every publish of renderHash, newest first; the same
+// render can be published again after a rollback or on another domain.
+func (s *Store) FindVhostStamps(renderHash string) ([]store.VhostStamp, error) {
+	rows, err := s.db.Query(`
+		SELECT domain, render_hash, run_id, actor, version, stamped_at
+		FROM vhost_stamps WHERE render_hash=? ORDER BY id DESC
+	`, renderHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.VhostStamp
+	for rows.Next() {
+		var st store.VhostStamp
+		var stamped string
+		if err := rows.Scan(&st.Domain, &st.RenderHash, &st.RunID, &st.Actor, &st.Version, &stamped); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, stamped); err == nil {
+			st.StampedAt = t
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,206 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mynginx/internal/store"
+)
+
+// timedOps are the operations counted by queryMetrics, in report order.
+var timedOps = []string{"query", "exec", "begin", "commit", "rollback"}
+
+// queryMetrics times every statement that reaches the driver and logs the ones
+// slower than slow (0 = never).
+type queryMetrics struct {
+	slow atomic.Int64 // time.Duration
+
+	mu       sync.Mutex
+	ops      map[string]*store.OpMetrics
+	slowSeen int64
+}
+
+func newQueryMetrics() *queryMetrics {
+	m := &queryMetrics{ops: map[string]*store.OpMetrics{}}
+	for _, op := range timedOps {
+		m.ops[op] = &store.OpMetrics{Op: op, Buckets: make([]int64, len(store.QueryBuckets))}
+	}
+	return m
+}
+
+func (m *queryMetrics) observe(op, query string, start time.Time, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return // database/sql retries through Prepare
+	}
+	d := time.Since(start)
+	slow := time.Duration(m.slow.Load())
+
+	m.mu.Lock()
+	o := m.ops[op]
+	o.Count++
+	o.Total += d
+	if err != nil {
+		o.Errors++
+	}
+	for i, b := range store.QueryBuckets {
+		if d <= b {
+			o.Buckets[i]++
+		}
+	}
+	isSlow := slow > 0 && d >= slow
+	if isSlow {
+		m.slowSeen++
+	}
+	m.mu.Unlock()
+
+	if isSlow {
+		log.Printf("store: slow %s (%s): %s", op, d.Round(time.Millisecond), compactQuery(query))
+	}
+}
+
+func (m *queryMetrics) snapshot() store.StoreMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := store.StoreMetrics{Slow: m.slowSeen}
+	for _, op := range timedOps {
+		o := *m.ops[op]
+		o.Buckets = append([]int64(nil), o.Buckets...)
+		out.Ops = append(out.Ops, o)
+	}
+	return out
+}
+
+// compactQuery folds a statement onto one line for the log; arguments are never
+// logged (they may hold password hashes or tokens).
+func compactQuery(q string) string {
+	q = strings.Join(strings.Fields(q), " ")
+	if len(q) > 200 {
+		q = q[:200] + "..."
+	}
+	return q
+}
+
+// timedConnector opens driver connections wrapped in timedConn.
+type timedConnector struct {
+	drv driver.Driver
+	dsn string
+	m   *queryMetrics
+}
+
+func (c *timedConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.drv.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &timedConn{Conn: conn, m: c.m}, nil
+}
+
+func (c *timedConnector) Driver() driver.Driver { return c.drv }
+
+// timedConn times direct Exec/Query calls and transactions. The sqlite driver
+// implements the context interfaces, so database/sql never prepares separately for
+// one-off statements.
+type timedConn struct {
+	driver.Conn
+	m *queryMetrics
+}
+
+func (c *timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ex, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := ex.ExecContext(ctx, query, args)
+	c.m.observe("exec", query, start, err)
+	return res, err
+}
+
+func (c *timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qr, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := qr.QueryContext(ctx, query, args)
+	c.m.observe("query", query, start, err)
+	return rows, err
+}
+
+func (c *timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return pc.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *timedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	var (
+		tx  driver.Tx
+		err error
+	)
+	if bt, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bt.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	c.m.observe("begin", "BEGIN", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return &timedTx{Tx: tx, m: c.m}, nil
+}
+
+func (c *timedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *timedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *timedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type timedTx struct {
+	driver.Tx
+	m *queryMetrics
+}
+
+func (t *timedTx) Commit() error {
+	start := time.Now()
+	err := t.Tx.Commit()
+	t.m.observe("commit", "COMMIT", start, err)
+	return err
+}
+
+func (t *timedTx) Rollback() error {
+	start := time.Now()
+	err := t.Tx.Rollback()
+	t.m.observe("rollback", "ROLLBACK", start, err)
+	return err
+}
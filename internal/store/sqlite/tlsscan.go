@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"time"
+
+	"mynginx/internal/store"
+)
+
+func (s *Store) SaveTLSScan(sc store.TLSScan) error {
+	_, err := s.db.Exec(`
+		INSERT INTO tls_scans(domain, grade, scanned_at, report)
+		VALUES(?,?,?,?)
+		ON CONFLICT(domain) DO UPDATE SET
+			grade=excluded.grade,
+			scanned_at=excluded.scanned_at,
+			report=excluded.report
+	`, sc.Domain, sc.Grade, sc.ScannedAt.UTC().Format(time.RFC3339Nano), string(sc.Report))
+	return err
+}
+
+func (s *Store) GetTLSScan(domain string) (store.TLSScan, error) {
+	var sc store.TLSScan
+	var scanned, report string
+	err := s.db.QueryRow(`SELECT domain, grade, scanned_at, report FROM tls_scans WHERE domain=?`, domain).
+		Scan(&sc.Domain, &sc.Grade, &scanned, &report)
+	if err != nil {
+		return store.TLSScan{}, err
+	}
+	sc.Report = []byte(report)
+	if t, err := time.Parse(time.RFC3339Nano, scanned); err == nil {
+		sc.ScannedAt = t
+	}
+	return sc, nil
+}
+
+// ListTLSScans returns grades without the report bodies.
+func (s *Store) ListTLSScans() ([]store.TLSScan, error) {
+	rows, err := s.db.Query(`SELECT domain, grade, scanned_at FROM tls_scans ORDER BY domain`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.TLSScan
+	for rows.Next() {
+		var sc store.TLSScan
+		var scanned string
+		if err := rows.Scan(&sc.Domain, &sc.Grade, &scanned); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(time.RFC3339Nano, scanned); err == nil {
+			sc.ScannedAt = t
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
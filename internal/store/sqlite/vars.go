@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// ListSiteVars returns a site's template variables sorted by name.
+func (s *Store) ListSiteVars(siteID int64) ([]store.SiteVar, error) {
+	rows, err := s.db.Query(`
+		SELECT name, value
+		  FROM site_vars
+		 WHERE site_id = ?
+		 ORDER BY name ASC
+	`, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []store.SiteVar
+	for rows.Next() {
+		var v store.SiteVar
+		if err := rows.Scan(&v.Name, &v.Value); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// SetSiteVar adds or replaces (by name) a template variable of the site and bumps
+// its revision so it shows as pending.
+func (s *Store) SetSiteVar(domain string, v store.SiteVar) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO site_vars(site_id, name, value)
+		VALUES(?,?,?)
+		ON CONFLICT(site_id, name) DO UPDATE SET
+			value=excluded.value
+	`, siteID, strings.TrimSpace(v.Name), v.Value); err != nil {
+		return err
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSiteVar removes a template variable of the site (sql.ErrNoRows if it has
+// none by that name).
+func (s *Store) DeleteSiteVar(domain, name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var siteID int64
+	if err := tx.QueryRow(`SELECT id FROM sites WHERE domain = ?`, strings.TrimSpace(domain)).Scan(&siteID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM site_vars WHERE site_id = ? AND name = ?`, siteID, strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := touchSite(tx, siteID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
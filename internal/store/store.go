@@ -1,16 +1,25 @@
 package store
 
 import (
+	"errors"
 	"time"
 	"mynginx/internal/nginx"
 )
 
+// ErrRevisionConflict is returned when a conditional site update finds a newer revision.
+var ErrRevisionConflict = errors.New("site was modified by someone else (revision mismatch)")
+
 type PanelUser struct {
 	ID           int64
 	Username     string
 	PasswordHash string
 	Role         string
+	HostingUser  string // role=user: hosting user whose sites it manages ("" = same name)
 	Enabled      bool
+	Language     string // UI locale code ("" = panel default)
+	Email        string
+	EmailVerified      bool
+	MustChangePassword bool // forced password change on next login
 	LastLoginAt  *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
@@ -21,14 +30,32 @@ type User struct {
 	ID       int64
 	Username string
 	HomeDir  string
+	PlanID   int64 // 0 = no plan (unlimited)
 	CreatedAt time.Time
+
+	// SFTPJail restricts the user to SFTP, chrooted to a directory that holds
+	// bind mounts of their sites only (sftp.jail_root/<username>).
+	SFTPJail bool
+}
+
+// Plan holds per-user hosting limits. Zero values mean "unlimited".
+type Plan struct {
+	ID              int64
+	Name            string
+	MaxSites        int
+	MaxProxyTargets int      // per site
+	PHPVersions     []string // allowed versions; empty = all configured
+	BandwidthMB     int64    // monthly transfer quota
+	DiskMB          int64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 type Site struct {
 	ID          int64
 	UserID      int64
 	Domain      string
-	Mode        string // "php" | "proxy" | "static"
+	Mode        string // "php" | "proxy" | "static" | "redirect"
 	Webroot     string
 	PHPVersion  string
 	EnableHTTP3 bool
@@ -41,6 +68,450 @@ type Site struct {
 	LastAppliedAt   *time.Time
 	LastApplyStatus string
 	LastApplyError  string
+
+	// Revision increments on every change; set it on UpsertSite to require a match.
+	Revision int64
+
+	// ActiveGroup is the proxy target group (e.g. "blue"/"green") rendered into the upstream.
+	// Empty renders every enabled target.
+	ActiveGroup string
+
+	// MirrorTarget receives a copy of MirrorPercent% of requests (responses discarded).
+	MirrorTarget  string
+	MirrorPercent int
+
+	// DualCert serves an RSA and an ECDSA certificate side by side (clients pick one).
+	DualCert bool
+
+	// CertSource is where the site's certificate comes from: "letsencrypt" | "path" | "remote" | "shared";
+	// TLSCertPath/TLSKeyPath locate it for "path" and, optionally, "remote"; CertLineage
+	// names the Let's Encrypt lineage (e.g. a wildcard) a "shared" site is served from.
+	CertSource  string
+	TLSCertPath string
+	TLSKeyPath  string
+	CertLineage string
+
+	// ACMECA names the certs.cas entry certificates are issued by ("" = certs.ca).
+	ACMECA string
+
+	// AccessSyslog additionally ships the access log to this syslog server ("" = file only).
+	AccessSyslog string
+	// AccessLogSample thins the access log of a busy site: "" logs every request,
+	// "errors" only 4xx/5xx responses, "1/N" the errors plus one in N of the rest.
+	AccessLogSample string
+
+	// Upstream keepalive pool of a proxy site (0 / "" = hosting.upstream_keepalive).
+	KeepaliveConns    int
+	KeepaliveRequests int
+	KeepaliveTimeout  string
+
+	// BackendHealth is the health endpoint of a proxy site's backend ("/healthz"),
+	// exposed on health.backend.location to the allow-listed addresses ("" = not exposed).
+	BackendHealth string
+
+	// ExpiresAt disables the site once passed (nil = never). ExpiryNotify is the owner's
+	// contact for the advance warning; ExpiryWarnedAt records that it was sent.
+	ExpiresAt      *time.Time
+	ExpiryNotify   string
+	ExpiryWarnedAt *time.Time
+
+	// RedirectURL is where a "redirect" site sends every request, with RedirectCode
+	// (301/302/307/308); RedirectKeepPath appends the request URI to it.
+	RedirectURL      string
+	RedirectCode     int
+	RedirectKeepPath bool
+
+	// Placeholder serves the "coming soon" page of a php/static site while its webroot
+	// is empty; it is cleared once content is deployed.
+	Placeholder bool
+
+	// Hardened applies the PHP hardening preset: no httpoxy / PHP_VALUE pass-through,
+	// no PHP in upload directories, no PATH_INFO execution, server_tokens off, and a
+	// pool without allow_url_fopen / allow_url_include (outbound URL access).
+	Hardened bool
+
+	// PreviewHost is the temporary hostname the site is also served on for testing
+	// before DNS points here (`ngm preview`); "" = none.
+	PreviewHost string
+
+	// ReapplyCron re-renders the site on this cron schedule in `ngm serve` and applies
+	// it when the output changed (templates with time-based content); "" = off.
+	ReapplyCron string
+
+	// Discovery is where the targets of a proxy site are looked up: "srv:<name>" (DNS
+	// SRV) or "consul:<service>" (healthy instances); "" = manual targets only.
+	Discovery string
+
+	// Tags group sites for bulk operations (`ngm php migrate --tag`); lower case.
+	Tags []string
+
+	// RetireUntil is the end of the grace period of a gracefully disabled site: until
+	// then its vhost answers every request with RetireStatus (410/503) and the
+	// retired page instead of being removed. nil = disabled sites just go.
+	RetireUntil  *time.Time
+	RetireStatus int
+}
+
+// SiteRow is a site as the site list shows it; the owner, the derived state and the
+// cached certificate expiry come from the same query.
+type SiteRow struct {
+	Site
+	Owner         string
+	State         string     // OK | PENDING | ERROR | DISABLED
+	CertNotAfter  *time.Time // nil = no certificate
+	CertCheckedAt *time.Time // nil = not in the cert cache yet
+}
+
+// SiteListOptions orders, filters and pages ListSiteRows: Sort is one of
+// SiteSortColumns ("" = domain); empty filters match every site.
+type SiteListOptions struct {
+	Sort  string
+	Desc  bool
+	Owner string // only the sites of this hosting user ("" = all)
+
+	Search string // domain contains this (case-insensitive)
+	Mode   string // php | proxy | static | redirect
+	State  string // OK | PENDING | ERROR | DISABLED
+
+	Limit  int // at most this many rows (0 = all)
+	Offset int // rows skipped before the first one returned
+}
+
+// SiteStates are the states of the site list.
+var SiteStates = []string{"OK", "PENDING", "ERROR", "DISABLED"}
+
+// SiteSortColumns are the columns the site list can be sorted by.
+var SiteSortColumns = []string{"domain", "owner", "mode", "enabled", "cert", "state", "last_applied", "php"}
+
+// SiteHeader is a response header added to (Value) or hidden from (Hide) a site's
+// responses.
+type SiteHeader struct {
+	Name  string
+	Value string
+	Hide  bool
+}
+
+// SiteVar is a render-time variable of a site: a key/value pair custom templates read
+// as .Vars.<Name>.
+type SiteVar struct {
+	Name  string
+	Value string
+}
+
+// SitePreload is a resource announced to browsers (Link: rel=preload) on a site's page
+// responses, so they fetch it while the page is still being generated.
+type SitePreload struct {
+	URL         string // path ("/css/app.css") or absolute https:// URL
+	As          string // "style" | "script" | "font" | "image" | "fetch"
+	Crossorigin bool
+}
+
+// HealthCheck is one availability probe of a site.
+type HealthCheck struct {
+	ID         int64
+	SiteID     int64
+	CheckedAt  time.Time
+	OK         bool
+	StatusCode int
+	LatencyMS  int64
+	Error      string
+	Location   string // check location ("local" or an external probe name)
+}
+
+// HealthSummary aggregates a site's checks over a period.
+type HealthSummary struct {
+	OK         int
+	Total      int
+	AvgLatency int64 // ms, successful checks only
+}
+
+// Incident is a confirmed downtime of a site; EndedAt is nil while it is ongoing.
+type Incident struct {
+	ID        int64
+	SiteID    int64
+	Domain    string
+	StartedAt time.Time
+	EndedAt   *time.Time
+	Cause     string
+}
+
+// Duration is how long the incident lasted (so far, if ongoing), to the second.
+func (in Incident) Duration() time.Duration {
+	end := time.Now()
+	if in.EndedAt != nil {
+		end = *in.EndedAt
+	}
+	return end.Sub(in.StartedAt).Round(time.Second)
+}
+
+// HealthDay aggregates a site's checks for one UTC day (Day is "YYYY-MM-DD").
+type HealthDay struct {
+	SiteID int64
+	Day    string
+	OK     int
+	Total  int
+}
+
+// TLSScan is the latest TLS grade of a domain; Report is the scanner's JSON report.
+type TLSScan struct {
+	Domain    string
+	Grade     string
+	ScannedAt time.Time
+	Report    []byte
+}
+
+// SiteReach is the latest post-apply reachability check of a domain over IPv4 and
+// IPv6; Report is the JSON-encoded app.ReachReport.
+type SiteReach struct {
+	Domain    string
+	CheckedAt time.Time
+	Report    []byte
+}
+
+// ApplyRun is one persisted Apply call. Result is the JSON-encoded app.ApplyResult.
+type ApplyRun struct {
+	ID         int64
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Request    string // what was asked: "domain=x", "all", "pending"
+	DryRun     bool
+	Reloaded   bool
+	Error      string
+	Result     []byte
+	Actor      string // who asked: panel user, unix user, or "ngm" for background applies
+}
+
+// VhostStamp is the reverse index of the stamp header Publish puts on a vhost: which
+// apply run and actor published a render hash of a domain.
+type VhostStamp struct {
+	Domain     string
+	RenderHash string
+	RunID      int64
+	Actor      string
+	Version    string
+	StampedAt  time.Time
+}
+
+// ApplyRunSite is one site's line of an apply run (the per-site apply history).
+type ApplyRunSite struct {
+	RunID      int64
+	Domain     string
+	Action     string // apply|delete
+	Status     string // ok|fail|dry-run
+	Message    string
+	RenderHash string // of the vhost rendered ("" for a delete, or a run before it was recorded)
+	CreatedAt  time.Time
+}
+
+// AcmeDNS is the acme-dns account a domain delegates DNS-01 validation to
+// (_acme-challenge.<domain> CNAME FullDomain).
+type AcmeDNS struct {
+	Domain     string
+	Server     string
+	Username   string
+	Password   string
+	Subdomain  string
+	FullDomain string
+	CreatedAt  time.Time
+}
+
+// SiteDeploy is the git deploy setup of a site: its webroot is a checkout of Branch
+// of Repo, updated on demand or by a push webhook verified with Secret.
+type SiteDeploy struct {
+	Domain    string
+	Repo      string
+	Branch    string
+	Secret    string // webhook secret (GitHub HMAC key, GitLab token)
+	CreatedAt time.Time
+}
+
+// DeployRun is one deploy of a site, or a webhook delivery that was skipped.
+type DeployRun struct {
+	ID         int64
+	Domain     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Trigger    string // cli|ui|github|gitlab
+	Ref        string // pushed ref (webhooks) or the deployed branch
+	Commit     string // checked out commit (ok runs)
+	Status     string // ok|fail|skipped
+	Output     string // git output, or why the delivery was skipped
+}
+
+// Event is one entry of the panel event log (e.g. nginx went down / was restarted).
+type Event struct {
+	ID        int64
+	CreatedAt time.Time
+	Level     string // info|warn|error
+	Source    string // subsystem, e.g. "nginx"
+	Message   string
+
+	// Domain and Owner tie an event to a site and its hosting user (both "" for
+	// panel-wide events); they feed the owner's activity feed.
+	Domain string
+	Owner  string
+}
+
+// APIToken is a bearer token for the API and /metrics. Only a hash of the token is
+// stored; Prefix is the public id it is looked up by.
+type APIToken struct {
+	ID        int64
+	Name      string
+	Prefix    string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt *time.Time // nil = never
+	RevokedAt *time.Time
+
+	// The token before the last rotation stays valid until PrevUntil (grace period).
+	PrevPrefix string
+	PrevHash   string
+	PrevUntil  *time.Time
+
+	LastUsedAt *time.Time
+	LastUsedIP string
+	Uses       int64
+
+	// Domains and HostingUser limit a reseller token to those sites (a domain also
+	// covers its subdomains); empty = every site.
+	Domains     []string
+	HostingUser string
+}
+
+// Job statuses (Job.Status).
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed" // Error says why
+)
+
+// Job is a long-running operation (certificate issue/renew, apply) run by the
+// background worker of `ngm serve` instead of inside an HTTP request.
+type Job struct {
+	ID         int64
+	Kind       string // e.g. "cert_issue"
+	Target     string // domain ("" = all sites)
+	Params     string // JSON options of the operation
+	Actor      string
+	Status     string
+	Error      string
+	Progress   string // how far a running job got (e.g. the batches of an apply)
+	RunID      int64  // apply run of an apply job (0 = none)
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// Change request statuses (ChangeRequest.Status).
+const (
+	ChangePending  = "pending"  // waiting for a second admin
+	ChangeApproved = "approved" // approved, being carried out
+	ChangeDone     = "done"     // approved and carried out
+	ChangeFailed   = "failed"   // approved, but carrying it out failed (Note)
+	ChangeRejected = "rejected" // rejected by an admin or withdrawn by the requester
+	ChangeExpired  = "expired"  // nobody decided within security.approvals.expire
+)
+
+// ChangeRequest is a sensitive operation held for approval by a second admin
+// (security.approvals).
+type ChangeRequest struct {
+	ID          int64
+	Kind        string // what to do, e.g. "site_delete"
+	Target      string // domain it acts on ("" = all sites)
+	Params      string // JSON options of the operation
+	RequestedBy string
+	CreatedAt   time.Time
+	Status      string
+	DecidedBy   string
+	DecidedAt   *time.Time
+	Note        string // reject reason or the error of a failed change
+}
+
+// Mail delivery statuses (MailMessage.Status).
+const (
+	MailQueued = "queued" // waiting for its first or next attempt
+	MailSent   = "sent"
+	MailFailed = "failed" // gave up after the last retry
+)
+
+// MailMessage is an outgoing mail in the delivery queue.
+type MailMessage struct {
+	ID            int64
+	To            string
+	Subject       string
+	Body          string
+	Status        string // MailQueued | MailSent | MailFailed
+	Attempts      int
+	LastError     string
+	NextAttemptAt *time.Time // queued only
+	CreatedAt     time.Time
+	SentAt        *time.Time
+}
+
+// AuditEntry records one mutating action taken from the CLI, the panel or the API:
+// who, what, when and, for a site, the settings it changed.
+type AuditEntry struct {
+	ID     int64
+	At     time.Time
+	Via    string // "cli" | "ui" | "api"
+	Actor  string // OS user, panel user or "token:<name>"
+	Remote string // client address (ui/api)
+	Action string // e.g. "site edit" or "POST /ui/sites/edit"
+	Target string // domain ("" = panel-wide)
+	Params string // JSON of the request's arguments, secrets redacted
+	Old    string // JSON of the site settings that changed, before
+	New    string // ... and after
+	Status string // "ok" | "failed"
+	Error  string
+}
+
+// AuditQuery filters ListAudit; empty fields match everything.
+type AuditQuery struct {
+	Actor  string
+	Target string
+	Via    string
+	Limit  int
+}
+
+// IdempotencyRecord is a stored response for a replayed mutating request.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string // hash of method+path+body; reuse with another request is rejected
+	Done        bool   // false while the first request is still running
+	Status      int
+	ContentType string
+	Location    string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// QueryBuckets are the upper bounds of the store latency histogram.
+var QueryBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 25 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// OpMetrics counts one kind of store operation ("query", "exec", "begin", "commit",
+// "rollback") since the store was opened. Buckets[i] counts the calls that took at
+// most QueryBuckets[i].
+type OpMetrics struct {
+	Op      string
+	Count   int64
+	Errors  int64
+	Total   time.Duration
+	Buckets []int64
+}
+
+// StoreMetrics is a snapshot of the store's query timings and its connection pool
+// (a single connection: WaitCount/WaitTotal show callers queueing for it).
+type StoreMetrics struct {
+	Ops       []OpMetrics
+	Slow      int64 // calls over storage.slow_query
+	InUse     int
+	WaitCount int64
+	WaitTotal time.Duration
 }
 
 type SiteStore interface {
@@ -49,10 +520,24 @@ type SiteStore interface {
 	EnsureUser(username, homeDir string) (User, error)
 	GetUserByUsername(username string) (User, error)
 	GetUserByID(id int64) (User, error)
+	ListUsers() ([]User, error)
+	CountSitesByUserID(userID int64) (int, error)
+
+	// Plans (quotas) and assignment to hosting users
+	ListPlans() ([]Plan, error)
+	GetPlanByID(id int64) (Plan, error)
+	GetPlanByName(name string) (Plan, error)
+	UpsertPlan(p Plan) (Plan, error)
+	DeletePlan(name string) error
+	SetUserPlan(userID, planID int64) error
+	SetUserSFTPJail(userID int64, on bool) error
 
 	UpsertSite(s Site) (Site, error)
 	GetSiteByDomain(domain string) (Site, error)
 	ListSites() ([]Site, error)
+	ListSiteRows(opts SiteListOptions) ([]SiteRow, error)
+	CountSiteRows(opts SiteListOptions) (int, error)
+	SetCertCache(domain string, notAfter *time.Time) error
         DisableSiteByDomain(domain string) error
 	// re-enable a previously disabled site
 	EnableSiteByDomain(domain string) error
@@ -62,12 +547,163 @@ type SiteStore interface {
 
 	// Proxy upstream targets (mode=proxy)
 	ListProxyTargetsBySiteID(siteID int64) ([]nginx.UpstreamTarget, error)
-	UpsertProxyTarget(siteID int64, target string, weight int, isBackup bool, enabled bool) error
+	UpsertProxyTarget(siteID int64, target string, weight int, isBackup bool, enabled bool, group string) error
+	SetSiteActiveGroup(domain, group string) error
+	SetSiteMirror(domain, target string, percent int) error
+	SetSiteRedirect(domain, target string, code int, keepPath bool) error
+	SetSitePlaceholder(domain string, on bool) error
+	SetSiteHardened(domain string, on bool) error
+	SetSitePreview(domain, host string) error
+	SetSiteReapply(domain, expr string) error
+	SetSiteDiscovery(domain, spec string) error
+	SetSiteTags(domain string, tags []string) error
+	ReplaceDiscoveredTargets(siteID int64, targets []nginx.UpstreamTarget) error
+	SetSiteDualCert(domain string, on bool) error
+	SetSiteCertSource(domain, source, certPath, keyPath, lineage string) error
+	SetSiteACMECA(domain, ca string) error
+	SetSiteAccessSyslog(domain, server string) error
+	SetSiteAccessLogSample(domain, sample string) error
+	SetSiteKeepalive(domain string, conns, requests int, timeout string) error
+	SetSiteBackendHealth(domain, path string) error
+	SetSiteExpiry(domain string, at *time.Time, notify string) error
+	SetSiteRetire(domain string, until *time.Time, status int) error
+	MarkSiteExpiryWarned(domain string) error
+	ListSiteHeaders(siteID int64) ([]SiteHeader, error)
+	SetSiteHeader(domain string, h SiteHeader) error
+	DeleteSiteHeader(domain, name string) error
+	ListSiteVars(siteID int64) ([]SiteVar, error)
+	SetSiteVar(domain string, v SiteVar) error
+	DeleteSiteVar(domain, name string) error
+	ListSitePreloads(siteID int64) ([]SitePreload, error)
+	SetSitePreload(domain string, p SitePreload) error
+	DeleteSitePreload(domain, url string) error
+	ListSiteFPMSettings(siteID int64) (map[string]string, error)
+	SetSiteFPMSettings(domain string, settings map[string]string) error
 	DisableProxyTarget(siteID int64, target string) error
 
 	CreatePanelUser(username, passwordHash, role string, enabled bool) (PanelUser, error)
+	CountPanelUsers() (int, error)
+	ListPanelUsers() ([]PanelUser, error)
 	GetPanelUserByUsername(username string) (PanelUser, error)
 	UpdatePanelUserLastLogin(id int64) error
+	UpdatePanelUserLanguage(id int64, lang string) error
+	GetPanelUserByID(id int64) (PanelUser, error)
+	GetPanelUserByEmail(email string) (PanelUser, error)
+	UpdatePanelUserPassword(id int64, passwordHash string) error
+	SetPanelUserMustChangePassword(id int64, must bool) error
+	UpdatePanelUserEmail(id int64, email string) error
+	MarkPanelUserEmailVerified(id int64) error
+	SetPanelUserHostingUser(id int64, hostingUser string) error
+	UpdatePanelUser(u PanelUser) error
+	DeletePanelUser(id int64) error
+
+	// Idempotency keys for mutating requests.
+	// BeginIdempotent returns (nil, nil) when the key is new and now reserved.
+	BeginIdempotent(key, fingerprint string) (*IdempotencyRecord, error)
+	CompleteIdempotent(rec IdempotencyRecord) error
+	ReleaseIdempotent(key string) error
+	PurgeIdempotent(olderThan time.Time) error
+
+	// Leases (cluster issuance locks); see cluster.LockStore.
+	AcquireLease(name, holder string, expires time.Time) (bool, string, error)
+	ReleaseLease(name, holder string) error
+
+	// key/value settings
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+
+	// Health checks (status page / uptime history)
+	InsertHealthCheck(c HealthCheck) error
+	LatestHealthChecks() (map[int64]HealthCheck, error)
+	HealthDaily(since time.Time) ([]HealthDay, error)
+	PurgeHealthChecks(olderThan time.Time) error
+	RecentHealthChecks(siteID int64, n int) ([]HealthCheck, error)
+	HealthSummaries(since time.Time) (map[int64]HealthSummary, error)
+
+	// TLS scans (latest per domain)
+	SaveTLSScan(sc TLSScan) error
+	GetTLSScan(domain string) (TLSScan, error)
+	ListTLSScans() ([]TLSScan, error)
+
+	// Consecutive failed certificate renewals (CA fallback); a success resets them.
+	RecordCertRenewFailure(domain, errMsg string) (int, error)
+	ResetCertRenewFailures(domain string) error
+
+	// Post-apply reachability per address family (latest per domain)
+	SaveSiteReach(r SiteReach) error
+	GetSiteReach(domain string) (SiteReach, error)
+
+	// Apply run history (newest first)
+	SaveApplyRun(run ApplyRun, sites []ApplyRunSite) (int64, error)
+	GetApplyRun(id int64) (ApplyRun, error)
+	ListApplyRuns(limit int) ([]ApplyRun, error)
+	ListSiteApplyRuns(domain string, limit int) ([]ApplyRunSite, error)
+
+	// Vhost stamp reverse index (newest first)
+	AddVhostStamps(stamps []VhostStamp) error
+	FindVhostStamps(renderHash string) ([]VhostStamp, error)
+
+	// acme-dns delegation (DNS-01 / wildcard certificates)
+	SaveAcmeDNS(a AcmeDNS) error
+	GetAcmeDNS(domain string) (AcmeDNS, error)
+	DeleteAcmeDNS(domain string) error
+
+	// Git deploys: per-site setup and the deploy log (newest first)
+	SaveSiteDeploy(d SiteDeploy) error
+	GetSiteDeploy(domain string) (SiteDeploy, error)
+	DeleteSiteDeploy(domain string) error
+	AddDeployRun(r DeployRun) (int64, error)
+	ListDeployRuns(domain string, limit int) ([]DeployRun, error)
+
+	// Incidents (confirmed downtime)
+	GetOpenIncident(siteID int64) (*Incident, error)
+	CreateIncident(siteID int64, startedAt time.Time, cause string) (Incident, error)
+	CloseIncident(id int64, endedAt time.Time) error
+	ListIncidents(since time.Time, limit int) ([]Incident, error)
+
+	// Event log (newest first; empty source = all)
+	AddEvent(e Event) error
+	ListEvents(source string, limit int) ([]Event, error)
+	ListOwnerEvents(owner string, limit int) ([]Event, error)
+
+	// API tokens (FindAPIToken matches the current or the pre-rotation prefix)
+	CreateAPIToken(t APIToken) (int64, error)
+	GetAPIToken(name string) (APIToken, error)
+	FindAPIToken(prefix string) (APIToken, error)
+	ListAPITokens() ([]APIToken, error)
+	RotateAPIToken(name, prefix, hash string, expiresAt, prevUntil *time.Time) error
+	RevokeAPIToken(name string) error
+	TouchAPIToken(id int64, ip string) error
+
+	// Background jobs (newest first). ClaimJob marks the oldest queued job running
+	// (sql.ErrNoRows when none); FailRunningJobs fails those a stopped worker left.
+	CreateJob(j Job) (int64, error)
+	GetJob(id int64) (Job, error)
+	ListJobs(limit int) ([]Job, error)
+	ClaimJob() (Job, error)
+	SetJobProgress(id int64, progress string) error
+	FinishJob(id int64, status, errMsg string, runID int64) error
+	FailRunningJobs(errMsg string) (int64, error)
+
+	// Change requests (newest first). UpdateChangeRequestStatus moves a request from
+	// status from to to (sql.ErrNoRows when it is not in from); a non-empty by records
+	// who decided.
+	CreateChangeRequest(c ChangeRequest) (int64, error)
+	GetChangeRequest(id int64) (ChangeRequest, error)
+	ListChangeRequests(limit int) ([]ChangeRequest, error)
+	UpdateChangeRequestStatus(id int64, from, to, by, note string) error
+
+	// Mail queue (newest first; delivered by notify.Mailer)
+	EnqueueMail(to, subject, body string, next time.Time) (int64, error)
+	GetMail(id int64) (MailMessage, error)
+	DueMail(now time.Time, limit int) ([]MailMessage, error)
+	SetMailResult(id int64, status, lastErr string, next *time.Time) error
+	ListMail(limit int) ([]MailMessage, error)
+	PruneMail(before time.Time) (int64, error)
+
+	// Audit trail (newest first)
+	AddAudit(e AuditEntry) error
+	ListAudit(q AuditQuery) ([]AuditEntry, error)
 
 	Close() error
 }
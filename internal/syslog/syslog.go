@@ -0,0 +1,143 @@
+// Package syslog sends RFC 5424 messages to a remote collector (SIEM) over UDP or TCP.
+// TCP uses octet-counting framing (RFC 6587). The connection is opened lazily and
+// re-dialled once after a write error.
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities (RFC 5424 section 6.2.1).
+const (
+	SevError   = 3
+	SevWarning = 4
+	SevNotice  = 5
+	SevInfo    = 6
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"authpriv": 10, "local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ValidFacility reports whether name is a facility accepted by New (and by nginx).
+func ValidFacility(name string) bool {
+	_, ok := facilities[name]
+	return ok
+}
+
+// Severity maps an event level ("error", "warning", ...) to a syslog severity.
+func Severity(level string) int {
+	switch strings.ToLower(level) {
+	case "error":
+		return SevError
+	case "warning", "warn":
+		return SevWarning
+	case "notice":
+		return SevNotice
+	}
+	return SevInfo
+}
+
+type Writer struct {
+	network  string // "udp" | "tcp"
+	addr     string
+	facility int
+	app      string
+	host     string
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// New returns a writer for network ("udp"/"tcp") addr; nothing is dialled yet.
+func New(network, addr, facility, app string) (*Writer, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("syslog: network must be udp or tcp, got %q", network)
+	}
+	f, ok := facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("syslog: unknown facility %q", facility)
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	return &Writer{network: network, addr: addr, facility: f, app: app, host: host, pid: os.Getpid()}, nil
+}
+
+// Send writes one message. msgID is a short token such as the event source ("auth", "nginx").
+func (w *Writer) Send(severity int, msgID, msg string) error {
+	line := w.format(time.Now(), severity, msgID, msg)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if w.conn, err = net.DialTimeout(w.network, w.addr, 5*time.Second); err != nil {
+				w.conn = nil
+				return fmt.Errorf("syslog dial %s: %w", w.addr, err)
+			}
+		}
+		_ = w.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if w.network == "tcp" {
+			_, err = fmt.Fprintf(w.conn, "%d %s", len(line), line)
+		} else {
+			_, err = w.conn.Write([]byte(line))
+		}
+		if err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return fmt.Errorf("syslog write %s: %w", w.addr, err)
+}
+
+// format builds `<PRI>1 TIMESTAMP HOST APP PROCID MSGID - MSG`.
+func (w *Writer) format(t time.Time, severity int, msgID, msg string) string {
+	if msgID == "" {
+		msgID = "-"
+	}
+	msg = strings.ReplaceAll(msg, "\n", " ")
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		w.facility*8+severity, t.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		w.host, header(w.app), w.pid, header(msgID), msg)
+}
+
+// header makes s a valid RFC 5424 header field (printable ASCII, no spaces, max 48).
+func header(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c <= ' ' || c > '~' {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 48 {
+		b = b[:48]
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// Close drops the connection; the next Send re-dials.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,392 @@
+// Package tlsscan grades a live HTTPS endpoint, loosely following the SSL Labs rating
+// guide: supported protocols, cipher suites, certificate chain, HSTS and OCSP stapling.
+package tlsscan
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// hstsMinAge is the max-age SSL Labs requires for A+ (180 days).
+const hstsMinAge = 180 * 24 * 3600
+
+// Protocol is one TLS version and whether the endpoint accepts it.
+type Protocol struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Cipher is an accepted TLS 1.0–1.2 cipher suite.
+type Cipher struct {
+	Name     string `json:"name"`
+	Insecure bool   `json:"insecure"` // RC4, 3DES, NULL, export or anonymous: caps the grade
+	Weak     bool   `json:"weak"`     // discouraged (e.g. CBC with SHA-256) but not graded down
+	NoPFS    bool   `json:"no_pfs"`   // RSA key exchange (no forward secrecy)
+}
+
+// Report is the outcome of a scan.
+type Report struct {
+	Domain    string    `json:"domain"`
+	Address   string    `json:"address"`
+	ScannedAt time.Time `json:"scanned_at"`
+	Grade     string    `json:"grade"` // A+, A, A-, B, C, F, T (untrusted) or "-" (unreachable)
+	Error     string    `json:"error,omitempty"`
+
+	Protocols []Protocol `json:"protocols"`
+	Ciphers   []Cipher   `json:"ciphers"`
+	TLS13     []string   `json:"tls13_ciphers,omitempty"` // negotiated suites (TLS 1.3 suites are not selectable)
+
+	CertSubject   string    `json:"cert_subject"`
+	CertIssuer    string    `json:"cert_issuer"`
+	CertNotAfter  time.Time `json:"cert_not_after"`
+	ChainLength   int       `json:"chain_length"`
+	ChainComplete bool      `json:"chain_complete"`
+	Trusted       bool      `json:"trusted"`
+	HostnameOK    bool      `json:"hostname_ok"`
+
+	HSTS       bool  `json:"hsts"`
+	HSTSMaxAge int64 `json:"hsts_max_age"`
+
+	OCSP string `json:"ocsp"` // "good", "revoked", "unknown", "not stapled", "no responder"
+
+	Findings []string `json:"findings"`
+}
+
+var protocols = []struct {
+	name    string
+	version uint16
+}{
+	{"TLS 1.0", tls.VersionTLS10},
+	{"TLS 1.1", tls.VersionTLS11},
+	{"TLS 1.2", tls.VersionTLS12},
+	{"TLS 1.3", tls.VersionTLS13},
+}
+
+// Scanner connects to addr (host:port) for every domain; an empty addr uses the domain itself on :443.
+type Scanner struct {
+	Addr    string
+	Timeout time.Duration
+	Roots   *x509.CertPool // nil = system roots
+}
+
+func (sc *Scanner) addr(domain string) string {
+	if sc.Addr != "" {
+		return sc.Addr
+	}
+	return net.JoinHostPort(domain, "443")
+}
+
+func (sc *Scanner) timeout() time.Duration {
+	if sc.Timeout > 0 {
+		return sc.Timeout
+	}
+	return 10 * time.Second
+}
+
+// handshake performs one TLS handshake with the given constraints (no verification).
+func (sc *Scanner) handshake(ctx context.Context, domain string, cfg *tls.Config) (*tls.ConnectionState, error) {
+	cfg.ServerName = domain
+	cfg.InsecureSkipVerify = true
+	d := &tls.Dialer{NetDialer: &net.Dialer{Timeout: sc.timeout()}, Config: cfg}
+	ctx, cancel := context.WithTimeout(ctx, sc.timeout())
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", sc.addr(domain))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	st := conn.(*tls.Conn).ConnectionState()
+	return &st, nil
+}
+
+// Scan inspects the endpoint serving domain and grades it.
+func (sc *Scanner) Scan(ctx context.Context, domain string) Report {
+	rep := Report{Domain: domain, Address: sc.addr(domain), ScannedAt: time.Now(), Grade: "-"}
+
+	// baseline handshake (best the server offers) for certificate + stapled OCSP
+	st, err := sc.handshake(ctx, domain, &tls.Config{MinVersion: tls.VersionTLS10})
+	if err != nil {
+		rep.Error = err.Error()
+		return rep
+	}
+
+	for _, p := range protocols {
+		_, err := sc.handshake(ctx, domain, &tls.Config{MinVersion: p.version, MaxVersion: p.version})
+		rep.Protocols = append(rep.Protocols, Protocol{Name: p.name, Enabled: err == nil})
+	}
+	rep.Ciphers = sc.ciphers(ctx, domain)
+	if s13, err := sc.handshake(ctx, domain, &tls.Config{MinVersion: tls.VersionTLS13}); err == nil {
+		rep.TLS13 = []string{tls.CipherSuiteName(s13.CipherSuite)}
+	}
+
+	sc.checkChain(&rep, st)
+	rep.OCSP = sc.ocspStatus(ctx, st)
+	sc.checkHSTS(ctx, &rep)
+
+	grade(&rep)
+	return rep
+}
+
+// ciphers tries every TLS 1.0–1.2 suite Go knows, one at a time.
+func (sc *Scanner) ciphers(ctx context.Context, domain string) []Cipher {
+	var out []Cipher
+	try := func(cs *tls.CipherSuite, insecure bool) {
+		for _, v := range cs.SupportedVersions {
+			if v == tls.VersionTLS13 {
+				return // TLS 1.3 suites cannot be restricted by the client
+			}
+		}
+		_, err := sc.handshake(ctx, domain, &tls.Config{
+			MinVersion:   tls.VersionTLS10,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{cs.ID},
+		})
+		if err != nil {
+			return
+		}
+		broken := false
+		for _, w := range []string{"RC4", "3DES", "NULL", "EXPORT", "anon"} {
+			if strings.Contains(cs.Name, w) {
+				broken = true
+			}
+		}
+		out = append(out, Cipher{
+			Name:     cs.Name,
+			Insecure: broken,
+			Weak:     !broken && (insecure || cs.Insecure),
+			NoPFS:    strings.HasPrefix(cs.Name, "TLS_RSA_"),
+		})
+	}
+	for _, cs := range tls.CipherSuites() {
+		try(cs, false)
+	}
+	for _, cs := range tls.InsecureCipherSuites() {
+		try(cs, true)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// checkChain verifies the presented chain using only the certificates the server sent,
+// so a missing intermediate shows up as an incomplete chain.
+func (sc *Scanner) checkChain(rep *Report, st *tls.ConnectionState) {
+	certs := st.PeerCertificates
+	rep.ChainLength = len(certs)
+	if len(certs) == 0 {
+		return
+	}
+	leaf := certs[0]
+	rep.CertSubject = leaf.Subject.CommonName
+	rep.CertIssuer = leaf.Issuer.CommonName
+	rep.CertNotAfter = leaf.NotAfter
+	rep.HostnameOK = leaf.VerifyHostname(rep.Domain) == nil
+
+	inter := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		inter.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: sc.Roots, Intermediates: inter})
+	if err == nil {
+		rep.Trusted = true
+		rep.ChainComplete = true
+		return
+	}
+
+	// The server may have left out the intermediate: fetch it from the leaf's AIA URL
+	// and retry. If that verifies, the chain is trusted but incomplete.
+	var ua x509.UnknownAuthorityError
+	if errors.As(err, &ua) && len(leaf.IssuingCertificateURL) > 0 {
+		if ic, ferr := fetchIssuer(leaf.IssuingCertificateURL[0], sc.timeout()); ferr == nil {
+			inter.AddCert(ic)
+			if _, verr := leaf.Verify(x509.VerifyOptions{Roots: sc.Roots, Intermediates: inter}); verr == nil {
+				rep.Trusted = true
+				return
+			}
+		}
+	}
+	rep.Findings = append(rep.Findings, "certificate not trusted: "+err.Error())
+}
+
+// fetchIssuer downloads a DER (or PEM) issuer certificate from an AIA URL.
+func fetchIssuer(url string, timeout time.Duration) (*x509.Certificate, error) {
+	cl := &http.Client{Timeout: timeout}
+	res, err := cl.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	if b, _ := pem.Decode(data); b != nil {
+		data = b.Bytes
+	}
+	return x509.ParseCertificate(data)
+}
+
+// ocspStatus reports the stapled OCSP response, or asks the responder when nothing was stapled.
+func (sc *Scanner) ocspStatus(ctx context.Context, st *tls.ConnectionState) string {
+	certs := st.PeerCertificates
+	if len(certs) < 2 {
+		return "no responder"
+	}
+	leaf, issuer := certs[0], certs[1]
+	raw := st.OCSPResponse
+	stapled := len(raw) > 0
+	if !stapled {
+		if len(leaf.OCSPServer) == 0 {
+			return "no responder"
+		}
+		req, err := ocsp.CreateRequest(leaf, issuer, nil)
+		if err != nil {
+			return "unknown"
+		}
+		ctx, cancel := context.WithTimeout(ctx, sc.timeout())
+		defer cancel()
+		hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(req))
+		if err != nil {
+			return "unknown"
+		}
+		hreq.Header.Set("Content-Type", "application/ocsp-request")
+		res, err := http.DefaultClient.Do(hreq)
+		if err != nil {
+			return "unknown"
+		}
+		defer res.Body.Close()
+		raw, _ = io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return "unknown"
+	}
+	status := map[int]string{ocsp.Good: "good", ocsp.Revoked: "revoked"}[resp.Status]
+	if status == "" {
+		status = "unknown"
+	}
+	if !stapled && status == "good" {
+		return "good (not stapled)"
+	}
+	return status
+}
+
+func (sc *Scanner) checkHSTS(ctx context.Context, rep *Report) {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: rep.Domain},
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{Timeout: sc.timeout()}).DialContext(ctx, network, rep.Address)
+		},
+		DisableKeepAlives: true,
+	}
+	cl := &http.Client{
+		Transport:     tr,
+		Timeout:       sc.timeout(),
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+rep.Domain+"/", nil)
+	if err != nil {
+		return
+	}
+	res, err := cl.Do(req)
+	if err != nil {
+		rep.Findings = append(rep.Findings, "HSTS: request failed: "+err.Error())
+		return
+	}
+	res.Body.Close()
+	h := res.Header.Get("Strict-Transport-Security")
+	if h == "" {
+		return
+	}
+	for _, part := range strings.Split(h, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if strings.EqualFold(k, "max-age") {
+			n, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64)
+			if err == nil {
+				rep.HSTS = n > 0
+				rep.HSTSMaxAge = n
+			}
+		}
+	}
+}
+
+// grade applies caps in the spirit of the SSL Labs rating guide and records why.
+func grade(rep *Report) {
+	order := []string{"A+", "A", "A-", "B", "C", "F"}
+	g := 1 // start at A
+	capAt := func(limit string, why string) {
+		for i, o := range order {
+			if o == limit && i > g {
+				g = i
+			}
+		}
+		rep.Findings = append(rep.Findings, why)
+	}
+
+	enabled := map[string]bool{}
+	for _, p := range rep.Protocols {
+		enabled[p.Name] = p.Enabled
+	}
+	if !enabled["TLS 1.2"] && !enabled["TLS 1.3"] {
+		capAt("C", "TLS 1.2 and 1.3 are not supported")
+	}
+	if enabled["TLS 1.0"] || enabled["TLS 1.1"] {
+		capAt("B", "obsolete TLS 1.0/1.1 is enabled")
+	}
+	if !enabled["TLS 1.3"] {
+		capAt("A-", "TLS 1.3 is not supported")
+	}
+	var insecure, noPFS []string
+	for _, c := range rep.Ciphers {
+		if c.Insecure {
+			insecure = append(insecure, c.Name)
+		} else if c.NoPFS {
+			noPFS = append(noPFS, c.Name)
+		}
+	}
+	if len(insecure) > 0 {
+		capAt("C", "insecure cipher suites accepted: "+strings.Join(insecure, ", "))
+	}
+	if len(noPFS) > 0 {
+		capAt("A-", "cipher suites without forward secrecy accepted: "+strings.Join(noPFS, ", "))
+	}
+	if rep.ChainLength > 0 && rep.Trusted && !rep.ChainComplete {
+		capAt("B", "certificate chain is incomplete (intermediate not sent)")
+	}
+	if rep.OCSP == "revoked" {
+		capAt("F", "certificate is revoked (OCSP)")
+	}
+	if !rep.CertNotAfter.IsZero() && time.Now().After(rep.CertNotAfter) {
+		capAt("F", "certificate expired on "+rep.CertNotAfter.Format("2006-01-02"))
+	}
+	if !rep.HostnameOK {
+		capAt("F", "certificate does not match "+rep.Domain)
+	}
+
+	switch {
+	case !rep.Trusted && g < 5:
+		rep.Grade = "T" // SSL Labs: "would be <g> if trusted"
+		rep.Findings = append(rep.Findings, fmt.Sprintf("grade would be %s if the certificate were trusted", order[g]))
+		return
+	case g == 1 && rep.HSTS && rep.HSTSMaxAge >= hstsMinAge:
+		g = 0
+	case g <= 1 && !rep.HSTS:
+		rep.Findings = append(rep.Findings, "no HSTS header (needed for A+)")
+	case g <= 1 && rep.HSTSMaxAge < hstsMinAge:
+		rep.Findings = append(rep.Findings, "HSTS max-age below 180 days (needed for A+)")
+	}
+	rep.Grade = order[g]
+}
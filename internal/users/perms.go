@@ -0,0 +1,225 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// PermChange is one path whose owner or mode did not match the site model.
+type PermChange struct {
+	Path string
+	From string // e.g. "root:root 0644"
+	To   string
+}
+
+// PermReport is what FixSiteTree found (and changed, unless dry-run).
+type PermReport struct {
+	SiteRoot string
+	Checked  int
+	Changes  []PermChange
+	Skipped  []string // symlinks, special files and hard links to others' files, left alone
+}
+
+// FixSiteTree re-applies the ownership model of EnsureSiteDirs to an existing site
+// tree: owner username, group webGroup, dirs 0750, files 0640. Unlike the chown of
+// EnsureSiteDirs it never follows symlinks (a link planted in the webroot must not
+// redirect a root chown to /etc/shadow), and it reports each path it changes. With
+// dryRun nothing is changed. Root required.
+//
+// The site user can rename anything in the tree while this runs, so nothing is
+// looked up by path twice: each entry is opened with O_NOFOLLOW relative to its
+// directory's fd, and its owner and mode are changed through that fd.
+func FixSiteTree(username, webroot, webGroup string, dryRun bool) (PermReport, error) {
+	webroot = filepath.Clean(strings.TrimSpace(webroot))
+	if webroot == "" || webroot == "/" {
+		return PermReport{}, fmt.Errorf("invalid webroot %q", webroot)
+	}
+	rep := PermReport{SiteRoot: filepath.Dir(webroot)}
+	if os.Geteuid() != 0 {
+		return rep, fmt.Errorf("fixing ownership needs root")
+	}
+	uid, gid, ok := lookupUserUIDGID(username)
+	if !ok {
+		return rep, fmt.Errorf("cannot find user %q in /etc/passwd", username)
+	}
+	if g, ok := lookupGroupGID(webGroup); ok {
+		gid = g
+	}
+
+	names := map[[2]uint32]string{}
+	owner := func(u, g uint32) string {
+		k := [2]uint32{u, g}
+		if _, ok := names[k]; !ok {
+			names[k] = userName(u) + ":" + groupName(g)
+		}
+		return names[k]
+	}
+
+	// fix checks (and changes) the entry open as f; false for one left alone
+	fix := func(f *os.File, p string) (bool, error) {
+		info, err := f.Stat()
+		if err != nil {
+			return false, err
+		}
+		mode := info.Mode()
+		sys, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return false, fmt.Errorf("no stat_t for %s", p)
+		}
+		// a hard link to a file of someone else (root's /etc/shadow) is not the site's
+		if !mode.IsDir() && (!mode.IsRegular() || (sys.Nlink > 1 && sys.Uid != uid)) {
+			rep.Skipped = append(rep.Skipped, p)
+			return false, nil
+		}
+		rep.Checked++
+		want := os.FileMode(0640)
+		if mode.IsDir() {
+			want = 0750
+		}
+		if sys.Uid == uid && sys.Gid == gid && mode.Perm() == want {
+			return true, nil
+		}
+		rep.Changes = append(rep.Changes, PermChange{
+			Path: p,
+			From: fmt.Sprintf("%s %04o", owner(sys.Uid, sys.Gid), mode.Perm()),
+			To:   fmt.Sprintf("%s %04o", owner(uid, gid), want),
+		})
+		if dryRun {
+			return true, nil
+		}
+		if sys.Uid != uid || sys.Gid != gid {
+			if err := f.Chown(int(uid), int(gid)); err != nil {
+				return false, err
+			}
+		}
+		if mode.Perm() != want {
+			if err := f.Chmod(want); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	var walk func(dir *os.File, p string) error
+	walk = func(dir *os.File, p string) error {
+		if ok, err := fix(dir, p); err != nil || !ok {
+			return err
+		}
+		entries, err := dir.ReadDir(-1)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			child := filepath.Join(p, e.Name())
+			if t := e.Type(); t != 0 && !t.IsDir() {
+				rep.Skipped = append(rep.Skipped, child)
+				continue
+			}
+			// O_NONBLOCK: an entry swapped for a fifo since ReadDir must not hang the open
+			fd, err := syscall.Openat(int(dir.Fd()), e.Name(), syscall.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+			if errors.Is(err, syscall.ELOOP) {
+				rep.Skipped = append(rep.Skipped, child) // swapped for a symlink since ReadDir
+				continue
+			}
+			if errors.Is(err, syscall.ENOENT) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("open %s: %w", child, err)
+			}
+			f := os.NewFile(uintptr(fd), child)
+			if e.IsDir() {
+				err = walk(f, child)
+			} else {
+				_, err = fix(f, child)
+			}
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	root, err := openDirNoFollow(rep.SiteRoot)
+	if err != nil {
+		return rep, err
+	}
+	defer root.Close()
+	return rep, walk(root, rep.SiteRoot)
+}
+
+// openDirNoFollow opens the directory path one component at a time. A symlink on
+// the way is only followed when it sits in a directory only root can write to (a
+// /home that links to /data/home); one the site user could have planted is refused.
+func openDirNoFollow(path string) (*os.File, error) {
+	const flags = syscall.O_RDONLY | syscall.O_DIRECTORY | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+	fd, err := syscall.Open("/", flags, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open /: %w", err)
+	}
+	rest := strings.Split(strings.Trim(filepath.Clean(path), "/"), "/")
+	for hops := 0; len(rest) > 0; {
+		name := rest[0]
+		rest = rest[1:]
+		if name == "" || name == "." {
+			continue
+		}
+		next, err := syscall.Openat(fd, name, flags, 0)
+		// a symlink fails O_NOFOLLOW with ELOOP, or ENOTDIR with O_DIRECTORY
+		if errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.ENOTDIR) {
+			target, lerr := os.Readlink(fmt.Sprintf("/proc/self/fd/%d/%s", fd, name))
+			if lerr != nil {
+				syscall.Close(fd)
+				return nil, fmt.Errorf("open %s: %s: %w", path, name, err)
+			}
+			var st syscall.Stat_t
+			if err := syscall.Fstat(fd, &st); err != nil || st.Uid != 0 || st.Mode&0o022 != 0 || hops >= 40 {
+				syscall.Close(fd)
+				return nil, fmt.Errorf("open %s: symlink %q in a directory not only root can write to", path, name)
+			}
+			hops++
+			rest = append(strings.Split(target, "/"), rest...)
+			if filepath.IsAbs(target) {
+				syscall.Close(fd)
+				if fd, err = syscall.Open("/", flags, 0); err != nil {
+					return nil, fmt.Errorf("open /: %w", err)
+				}
+			}
+			continue
+		}
+		syscall.Close(fd)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %s: %w", path, name, err)
+		}
+		fd = next
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// userName is the /etc/passwd name of uid (the number when unknown).
+func userName(uid uint32) string {
+	return idName("/etc/passwd", uid)
+}
+
+// groupName is the /etc/group name of gid (the number when unknown).
+func groupName(gid uint32) string {
+	return idName("/etc/group", gid)
+}
+
+func idName(file string, id uint32) string {
+	data, err := os.ReadFile(file)
+	if err == nil {
+		want := fmt.Sprint(id)
+		for _, line := range strings.Split(string(data), "\n") {
+			if parts := strings.Split(line, ":"); len(parts) > 2 && parts[2] == want {
+				return parts[0]
+			}
+		}
+	}
+	return fmt.Sprint(id)
+}
@@ -0,0 +1,77 @@
+package users
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestFixSiteTreeLinks checks that FixSiteTree fixes the site's own files but
+// leaves the target of a symlink in the tree alone, also under a linked parent.
+func TestFixSiteTreeLinks(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("needs root")
+	}
+	base := t.TempDir()
+	site := filepath.Join(base, "site")
+	outside := filepath.Join(base, "shadow")
+	for _, d := range []string{filepath.Join(site, "public", "sub"), filepath.Join(base, "etc")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(site, "public", "index.html"), outside} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(site, "public", "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "etc"), filepath.Join(site, "public", "sub", "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := FixSiteTree("root", filepath.Join(site, "public"), "root", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(filepath.Join(site, "public", "index.html")); fi.Mode().Perm() != 0640 {
+		t.Errorf("index.html: %04o, want 0640", fi.Mode().Perm())
+	}
+	if fi, _ := os.Stat(outside); fi.Mode().Perm() != 0644 {
+		t.Errorf("link target: %04o, want 0644 (untouched)", fi.Mode().Perm())
+	}
+	if fi, _ := os.Stat(filepath.Join(base, "etc")); fi.Mode().Perm() != 0755 {
+		t.Errorf("dir link target: %04o, want 0755 (untouched)", fi.Mode().Perm())
+	}
+	for _, l := range []string{filepath.Join(site, "public", "link"), filepath.Join(site, "public", "sub", "dirlink")} {
+		if !slices.Contains(rep.Skipped, l) {
+			t.Errorf("%s not reported as skipped: %v", l, rep.Skipped)
+		}
+	}
+
+	// the site root itself swapped for a link the site user made
+	if err := os.Rename(site, site+".real"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(site+".real", site); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(base, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FixSiteTree("root", filepath.Join(site, "public"), "root", false); err == nil || !strings.Contains(err.Error(), "symlink") {
+		t.Errorf("site root behind a symlink in a world-writable dir: %v, want refused", err)
+	}
+
+	// a link in a directory only root writes to (a /home on another disk) is fine
+	if err := os.Chmod(base, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FixSiteTree("root", filepath.Join(site, "public"), "root", false); err != nil {
+		t.Errorf("site root behind a root-owned link: %v", err)
+	}
+}
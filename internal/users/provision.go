@@ -5,12 +5,13 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
+
+	"mynginx/internal/util"
 )
 
 type SiteDirs struct {
@@ -22,7 +23,7 @@ type SiteDirs struct {
 }
 
 // EnsureSystemUser ensures the Linux user exists. If missing, it will create it (root required).
-func EnsureSystemUser(username, homeDir string) error {
+func EnsureSystemUser(run util.Runner, username, homeDir string) error {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return fmt.Errorf("username is empty")
@@ -40,10 +41,9 @@ func EnsureSystemUser(username, homeDir string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, "useradd", "-m", "-d", homeDir, "-s", "/bin/bash", username)
-	out, err := cmd.CombinedOutput()
+	res, err := run.Run(ctx, "useradd", "-m", "-d", homeDir, "-s", "/bin/bash", username)
 	if err != nil {
-		return fmt.Errorf("useradd failed: %w (%s)", err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("useradd failed: %w (%s)", err, strings.TrimSpace(res.Output()))
 	}
 	return nil
 }
@@ -105,26 +105,11 @@ func EnsureSiteDirs(username, homeDir, webroot, webGroup string) (SiteDirs, erro
 	// Make sure /home/<user> is traversable for nginx group
 	_ = EnsureHomeTraversal(username, homeDir, webGroup)
 
-	siteRoot := filepath.Dir(webroot)
-	dirs := SiteDirs{
-		SiteRoot: siteRoot,
-		Public:   webroot,
-		Logs:     filepath.Join(siteRoot, "logs"),
-		Tmp:      filepath.Join(siteRoot, "tmp"),
-		PHP:      filepath.Join(siteRoot, "php"),
-	}
-
-	// Create dirs
-	for _, d := range []string{dirs.SiteRoot, dirs.Public, dirs.Logs, dirs.Tmp, dirs.PHP} {
-		if err := os.MkdirAll(d, 0750); err != nil {
-			return SiteDirs{}, fmt.Errorf("mkdir %s: %w", d, err)
-		}
+	dirs, err := EnsureSiteLayout(webroot)
+	if err != nil {
+		return SiteDirs{}, err
 	}
 
-	// Create log files (so nginx can open them immediately)
-	_ = touchFile(filepath.Join(dirs.Logs, "access.log"), 0640)
-	_ = touchFile(filepath.Join(dirs.Logs, "error.log"), 0640)
-
 	// Ownership
 	if os.Geteuid() == 0 {
 		uid, ugid, ok := lookupUserUIDGID(username)
@@ -151,6 +136,37 @@ func EnsureSiteDirs(username, homeDir, webroot, webGroup string) (SiteDirs, erro
 	return dirs, nil
 }
 
+// EnsureSiteLayout creates the directories and log files of EnsureSiteDirs without
+// touching ownership (used as-is by sandbox mode, where no system users exist).
+func EnsureSiteLayout(webroot string) (SiteDirs, error) {
+	webroot = filepath.Clean(strings.TrimSpace(webroot))
+	if webroot == "" || webroot == "/" {
+		return SiteDirs{}, fmt.Errorf("invalid webroot %q", webroot)
+	}
+
+	siteRoot := filepath.Dir(webroot)
+	dirs := SiteDirs{
+		SiteRoot: siteRoot,
+		Public:   webroot,
+		Logs:     filepath.Join(siteRoot, "logs"),
+		Tmp:      filepath.Join(siteRoot, "tmp"),
+		PHP:      filepath.Join(siteRoot, "php"),
+	}
+
+	// Create dirs
+	for _, d := range []string{dirs.SiteRoot, dirs.Public, dirs.Logs, dirs.Tmp, dirs.PHP} {
+		if err := os.MkdirAll(d, 0750); err != nil {
+			return SiteDirs{}, fmt.Errorf("mkdir %s: %w", d, err)
+		}
+	}
+
+	// Create log files (so nginx can open them immediately)
+	_ = touchFile(filepath.Join(dirs.Logs, "access.log"), 0640)
+	_ = touchFile(filepath.Join(dirs.Logs, "error.log"), 0640)
+
+	return dirs, nil
+}
+
 func userExists(username string) bool {
 	f, err := os.Open("/etc/passwd")
 	if err != nil {
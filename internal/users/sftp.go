@@ -0,0 +1,225 @@
+package users
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"mynginx/internal/util"
+)
+
+// EnsureGroup creates a system group unless it exists (root required).
+func EnsureGroup(run util.Runner, group string) error {
+	if _, ok := lookupGroupGID(group); ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := run.Run(ctx, "groupadd", "--system", group)
+	if err != nil {
+		return fmt.Errorf("groupadd %s failed: %w (%s)", group, err, strings.TrimSpace(res.Output()))
+	}
+	return nil
+}
+
+// SetGroupMember adds username to group (usermod -aG) or removes it (gpasswd -d).
+func SetGroupMember(run util.Runner, username, group string, member bool) error {
+	if inGroup(username, group) == member {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	args := []string{"usermod", "-aG", group, username}
+	if !member {
+		args = []string{"gpasswd", "-d", username, group}
+	}
+	res, err := run.Run(ctx, args[0], args[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w (%s)", args[0], err, strings.TrimSpace(res.Output()))
+	}
+	return nil
+}
+
+// inGroup reports whether username is a supplementary member of group in /etc/group.
+func inGroup(username, group string) bool {
+	f, err := os.Open("/etc/group")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		parts := strings.Split(sc.Text(), ":")
+		if len(parts) < 4 || parts[0] != group {
+			continue
+		}
+		for _, m := range strings.Split(parts[3], ",") {
+			if m == username {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// JailDir is the chroot of username under jailRoot.
+func JailDir(jailRoot, username string) string {
+	return filepath.Join(jailRoot, username)
+}
+
+// EnsureJail creates the chroot of username. sshd only chroots into a directory
+// whose every path component is owned by root and not writable by group or others,
+// so the jail itself is root:root 0755 and the user writes only inside the bind
+// mounts of their sites.
+func EnsureJail(jailRoot, username string) (string, error) {
+	dir := JailDir(jailRoot, username)
+	for _, d := range []string{jailRoot, dir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return "", fmt.Errorf("mkdir %s: %w", d, err)
+		}
+		if os.Geteuid() == 0 {
+			_ = os.Chown(d, 0, 0)
+			_ = os.Chmod(d, 0755)
+		}
+	}
+	return dir, nil
+}
+
+// CheckJail verifies sshd will accept dir as a ChrootDirectory: every component
+// from / down to dir must be a root-owned directory without group/other write.
+func CheckJail(dir string) error {
+	for p := filepath.Clean(dir); ; p = filepath.Dir(p) {
+		st, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		sys, ok := st.Sys().(*syscall.Stat_t)
+		switch {
+		case !st.IsDir():
+			return fmt.Errorf("%s is not a directory", p)
+		case !ok || sys.Uid != 0:
+			return fmt.Errorf("%s is not owned by root (sshd refuses the chroot)", p)
+		case st.Mode().Perm()&0022 != 0:
+			return fmt.Errorf("%s is writable by group or others (mode %04o; sshd refuses the chroot)", p, st.Mode().Perm())
+		}
+		if p == "/" {
+			return nil
+		}
+	}
+}
+
+// BindSite makes siteRoot visible in the jail as jailDir/<domain> (a bind mount,
+// since a chrooted user cannot follow symlinks out of the jail).
+func BindSite(run util.Runner, jailDir, domain, siteRoot string) error {
+	target := filepath.Join(jailDir, domain)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", target, err)
+	}
+	if mounted(target) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	res, err := run.Run(ctx, "mount", "--bind", siteRoot, target)
+	if err != nil {
+		return fmt.Errorf("mount --bind %s %s failed: %w (%s)", siteRoot, target, err, strings.TrimSpace(res.Output()))
+	}
+	return nil
+}
+
+// UnbindSite unmounts jailDir/<domain> and removes the (then empty) mount point.
+func UnbindSite(run util.Runner, jailDir, domain string) error {
+	target := filepath.Join(jailDir, domain)
+	if mounted(target) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		res, err := run.Run(ctx, "umount", target)
+		if err != nil {
+			return fmt.Errorf("umount %s failed: %w (%s)", target, err, strings.TrimSpace(res.Output()))
+		}
+	}
+	// os.Remove (not RemoveAll): never delete site files through a mount still in place
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// JailEntries lists the site mount points in jailDir.
+func JailEntries(jailDir string) ([]string, error) {
+	ents, err := os.ReadDir(jailDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []string
+	for _, e := range ents {
+		if e.IsDir() {
+			out = append(out, e.Name())
+		}
+	}
+	return out, nil
+}
+
+// mounted reports whether path is a mount point (/proc/self/mountinfo).
+func mounted(path string) bool {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	path = filepath.Clean(path)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		if fields := strings.Fields(sc.Text()); len(fields) > 4 && unescapeMount(fields[4]) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMount decodes the octal escapes (\040 for a space) of mountinfo paths.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			var c byte
+			if _, err := fmt.Sscanf(s[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// SFTPConfig is the sshd_config block that confines the members of group to
+// internal-sftp in <jailRoot>/<user>.
+func SFTPConfig(group, jailRoot string) []byte {
+	return []byte(fmt.Sprintf(`# Managed by ngm (hosting.sftp): sftp-only jail of hosting users. Do not edit.
+Match Group %s
+    ChrootDirectory %s/%%u
+    ForceCommand internal-sftp -d /
+    AllowTcpForwarding no
+    AllowAgentForwarding no
+    PermitTunnel no
+    X11Forwarding no
+    PermitTTY no
+`, group, filepath.Clean(jailRoot)))
+}
@@ -0,0 +1,18 @@
+package users
+
+import "testing"
+
+func TestUnescapeMount(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"/srv/jail/bob", "/srv/jail/bob"},
+		{`/srv/my\040site/bob`, "/srv/my site/bob"},
+		{`/srv/jail/bob\040`, "/srv/jail/bob "},
+		{`/srv/tab\011x`, "/srv/tab\tx"},
+		{`/srv/a\04`, `/srv/a\04`},
+		{`/srv/a\x`, `/srv/a\x`},
+	} {
+		if got := unescapeMount(c.in); got != c.want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
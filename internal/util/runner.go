@@ -0,0 +1,162 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runner executes external commands (nginx, certbot, openssl, useradd, systemctl).
+// Everything that shells out goes through a Runner so callers can swap in a
+// dry-run or tracing implementation, or a fake one when running without root.
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (Result, error)
+}
+
+// ExecRunner runs commands for real via os/exec.
+type ExecRunner struct{}
+
+func (ExecRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var outb, errb bytes.Buffer
+	cmd.Stdout = &outb
+	cmd.Stderr = &errb
+
+	err := cmd.Run()
+
+	res := Result{
+		Stdout: outb.String(),
+		Stderr: errb.String(),
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.ExitCode = -1
+		return res, fmt.Errorf("command timeout: %s %v", name, args)
+	}
+	if err == nil {
+		return res, nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		res.ExitCode = ee.ExitCode()
+		return res, fmt.Errorf("command failed (exit %d): %s %v", res.ExitCode, name, args)
+	}
+	res.ExitCode = -1
+	return res, fmt.Errorf("command error: %s %v: %w", name, args, err)
+}
+
+// DryRunner logs commands instead of running them and reports success.
+type DryRunner struct {
+	Out io.Writer
+}
+
+func (d DryRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	if d.Out != nil {
+		fmt.Fprintf(d.Out, "dry-run exec: %s\n", CommandLine(name, args...))
+	}
+	return Result{}, nil
+}
+
+// TraceRunner logs every command with its exit code and duration, then
+// delegates to Next (ExecRunner when nil).
+type TraceRunner struct {
+	Next Runner
+	Out  io.Writer
+
+	mu sync.Mutex
+}
+
+func (t *TraceRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	next := t.Next
+	if next == nil {
+		next = ExecRunner{}
+	}
+	start := time.Now()
+	res, err := next.Run(ctx, name, args...)
+	if t.Out != nil {
+		t.mu.Lock()
+		fmt.Fprintf(t.Out, "exec: %s (exit %d, %s)\n", CommandLine(name, args...), res.ExitCode, time.Since(start).Round(time.Millisecond))
+		if err != nil {
+			if s := strings.TrimSpace(res.Output()); s != "" {
+				fmt.Fprintf(t.Out, "exec:   %s\n", strings.ReplaceAll(s, "\n", "\nexec:   "))
+			}
+		}
+		t.mu.Unlock()
+	}
+	return res, err
+}
+
+// CommandLine renders a command for logs, quoting arguments that contain spaces.
+func CommandLine(name string, args ...string) string {
+	parts := make([]string, 0, len(args)+1)
+	for _, s := range append([]string{name}, args...) {
+		if s == "" || strings.ContainsAny(s, " \t\"'") {
+			s = fmt.Sprintf("%q", s)
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Output returns stdout followed by stderr, like exec.Cmd.CombinedOutput.
+func (r Result) Output() string {
+	return r.Stdout + r.Stderr
+}
+
+// RunningCommand is a command a TrackRunner has started and not seen return.
+type RunningCommand struct {
+	Line  string // CommandLine of it
+	Since time.Time
+}
+
+// TrackRunner delegates to Next (ExecRunner when nil) and keeps the commands in
+// flight, so that one that never returns can be told from a slow one.
+type TrackRunner struct {
+	Next Runner
+
+	mu      sync.Mutex
+	seq     uint64
+	running map[uint64]RunningCommand
+}
+
+func (t *TrackRunner) Run(ctx context.Context, name string, args ...string) (Result, error) {
+	next := t.Next
+	if next == nil {
+		next = ExecRunner{}
+	}
+	t.mu.Lock()
+	if t.running == nil {
+		t.running = map[uint64]RunningCommand{}
+	}
+	t.seq++
+	id := t.seq
+	t.running[id] = RunningCommand{Line: CommandLine(name, args...), Since: time.Now()}
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.running, id)
+		t.mu.Unlock()
+	}()
+	return next.Run(ctx, name, args...)
+}
+
+// Oldest is the command that has been running the longest (false when none is).
+func (t *TrackRunner) Oldest() (RunningCommand, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var old RunningCommand
+	found := false
+	for _, c := range t.running {
+		if !found || c.Since.Before(old.Since) {
+			old, found = c, true
+		}
+	}
+	return old, found
+}
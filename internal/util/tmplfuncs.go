@@ -0,0 +1,223 @@
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateFuncs is the function library of the site, global and php-fpm pool
+// templates. Argument order follows the usual pipeline convention (the piped value
+// comes last): {{ .Webroot | default "/var/www" }}, {{ .From | join " " }}.
+// The set is part of the template contract (see README, "Templates"): functions
+// may be added, never changed or removed.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"default":   tmplDefault,
+		"join":      tmplJoin,
+		"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+		"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"contains":  func(sub, s string) bool { return strings.Contains(s, sub) },
+		"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"sha1":      tmplSHA1,
+		"iterate":   tmplIterate,
+		"quote":     tmplQuote,
+
+		"ipFamily":     tmplIPFamily,
+		"ipAdd":        tmplIPAdd,
+		"cidrHost":     tmplCIDRHost,
+		"cidrContains": tmplCIDRContains,
+
+		"now":       func(layout string) string { return time.Now().Format(layout) },
+		"readLines": tmplReadLines,
+	}
+}
+
+// tmplDefault returns v, or def when v is empty (nil, "", 0, false, empty slice/map).
+func tmplDefault(def, v any) any {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		if rv.Len() == 0 {
+			return def
+		}
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return def
+		}
+	default:
+		if rv.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+// tmplJoin joins a slice of any element type with sep.
+func tmplJoin(sep string, list any) (string, error) {
+	if ss, ok := list.([]string); ok {
+		return strings.Join(ss, sep), nil
+	}
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: %T is not a list", list)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep), nil
+}
+
+// tmplSHA1 is the hex SHA-1 of s (stable names for zones, keys, cache paths).
+func tmplSHA1(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// tmplIterate returns 0..n-1 ({{ range iterate 4 }}) or from..to-1 (iterate 8 12).
+func tmplIterate(args ...int) ([]int, error) {
+	from, to := 0, 0
+	switch len(args) {
+	case 1:
+		to = args[0]
+	case 2:
+		from, to = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("iterate wants 1 or 2 arguments, got %d", len(args))
+	}
+	if to-from > 65536 {
+		return nil, fmt.Errorf("iterate: range of %d is too large", to-from)
+	}
+	var out []int
+	for i := from; i < to; i++ {
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// tmplQuote is s as an nginx double-quoted string.
+func tmplQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// tmplReadLines is the lines of a file, trimmed, without blanks and # comments
+// ({{ range readLines "/etc/ngm/allow.txt" }}allow {{ . }};{{ end }}). Feeds updated
+// by an external job are picked up by the scheduled re-render (site reapply).
+func tmplReadLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("readLines: %w", err)
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// tmplIPFamily is "ipv4" or "ipv6" for an address or prefix.
+func tmplIPFamily(s string) (string, error) {
+	addr, err := parseAddrOrPrefix(s)
+	if err != nil {
+		return "", err
+	}
+	if addr.Is4() {
+		return "ipv4", nil
+	}
+	return "ipv6", nil
+}
+
+// tmplIPAdd offsets an address by n (negative goes down): ipAdd 10 "192.0.2.1".
+func tmplIPAdd(n int, ip string) (string, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return "", fmt.Errorf("ipAdd: %w", err)
+	}
+	out, err := addrOffset(addr, n)
+	if err != nil {
+		return "", fmt.Errorf("ipAdd %s %+d: %w", ip, n, err)
+	}
+	return out.String(), nil
+}
+
+// tmplCIDRHost is the nth address of a prefix; negative n counts from the end
+// (-1 is the last address): cidrHost 1 "10.0.0.0/24" = 10.0.0.1.
+func tmplCIDRHost(n int, cidr string) (string, error) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return "", fmt.Errorf("cidrHost: %w", err)
+	}
+	p = p.Masked()
+	base := p.Addr()
+	if n < 0 {
+		size := new(big.Int).Lsh(big.NewInt(1), uint(base.BitLen()-p.Bits()))
+		idx := size.Add(size, big.NewInt(int64(n)))
+		if idx.Sign() < 0 {
+			return "", fmt.Errorf("cidrHost %d: outside %s", n, p)
+		}
+		out, err := addrOffsetBig(base, idx)
+		if err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+	out, err := addrOffset(base, n)
+	if err != nil || !p.Contains(out) {
+		return "", fmt.Errorf("cidrHost %d: outside %s", n, p)
+	}
+	return out.String(), nil
+}
+
+// tmplCIDRContains reports whether ip lies in cidr: cidrContains "10.0.0.0/8" .Addr.
+func tmplCIDRContains(cidr, ip string) (bool, error) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return false, fmt.Errorf("cidrContains: %w", err)
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false, fmt.Errorf("cidrContains: %w", err)
+	}
+	return p.Contains(addr.Unmap()), nil
+}
+
+func parseAddrOrPrefix(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Addr(), nil
+	}
+	return netip.ParseAddr(s)
+}
+
+func addrOffset(addr netip.Addr, n int) (netip.Addr, error) {
+	return addrOffsetBig(addr, big.NewInt(int64(n)))
+}
+
+func addrOffsetBig(addr netip.Addr, n *big.Int) (netip.Addr, error) {
+	b := addr.AsSlice()
+	v := new(big.Int).SetBytes(b)
+	v.Add(v, n)
+	if v.Sign() < 0 || v.BitLen() > len(b)*8 {
+		return netip.Addr{}, fmt.Errorf("address out of range")
+	}
+	out := v.FillBytes(make([]byte, len(b)))
+	res, _ := netip.AddrFromSlice(out)
+	return res, nil
+}
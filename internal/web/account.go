@@ -0,0 +1,451 @@
+package web
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"mynginx/internal/auth"
+	"mynginx/internal/store"
+)
+
+// allowedDuringForcedChange lists the paths a session flagged with MustChangePassword may use.
+func allowedDuringForcedChange(p string) bool {
+	switch p {
+	case "/ui/password/change", "/ui/profile/password", "/ui/logout", "/ui/lang":
+		return true
+	}
+	return false
+}
+
+// baseURL is used for links in emails. It is api.public_url only: the request Host
+// is client-controlled, so a forged one would send a reset link to another domain.
+func (s *Server) baseURL() string {
+	return strings.TrimRight(strings.TrimSpace(s.cfg.API.PublicURL), "/")
+}
+
+// mailLinks reports whether reset and verification links can be mailed: SMTP is
+// configured and so is api.public_url.
+func (s *Server) mailLinks() bool {
+	return s.mailer.Enabled() && s.baseURL() != ""
+}
+
+// remoteHost is the client address for audit entries (forwarding headers are not trusted).
+func remoteHost(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return h
+	}
+	return r.RemoteAddr
+}
+
+// mailLang picks the user's saved language for outgoing mail.
+func (s *Server) mailLang(r *http.Request, u store.PanelUser) string {
+	if s.i18n.Has(u.Language) {
+		return u.Language
+	}
+	return s.i18n.FromRequest(r)
+}
+
+// sendAsync sends mail in the background so response time doesn't leak whether an account exists.
+func (s *Server) sendAsync(to, subject, body string) {
+	go func() {
+		if err := s.mailer.Send(to, subject, body); err != nil {
+			log.Printf("mail to %s failed: %v", to, err)
+		}
+	}()
+}
+
+func (s *Server) sendVerifyEmail(r *http.Request, u store.PanelUser) {
+	lang := s.mailLang(r, u)
+	tok := auth.SignToken(s.tokenSecret, auth.PurposeVerifyEmail, u.ID, auth.Stamp(strings.ToLower(u.Email)), s.tokenTTL)
+	link := s.baseURL() + "/ui/email/verify?token=" + url.QueryEscape(tok)
+	s.sendAsync(u.Email,
+		s.i18n.T(lang, "mail.verify_subject"),
+		s.i18n.T(lang, "mail.verify_body", u.Username, s.tokenTTL.String(), link))
+}
+
+func (s *Server) hashPassword(pass string) (string, error) {
+	if err := auth.ValidatePassword(s.cfg.Security.PasswordPolicy, pass); err != nil {
+		return "", err
+	}
+	b, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// verifyResetToken resolves a reset token to its user; the stamp ties it to the current password hash.
+func (s *Server) verifyResetToken(tok string) (store.PanelUser, bool) {
+	uid, stamp, err := auth.VerifyToken(s.tokenSecret, auth.PurposeReset, tok)
+	if err != nil {
+		return store.PanelUser{}, false
+	}
+	u, err := s.st.GetPanelUserByID(uid)
+	if err != nil || !u.Enabled || stamp != auth.Stamp(u.PasswordHash) {
+		return store.PanelUser{}, false
+	}
+	return u, true
+}
+
+// ---------------- handlers ----------------
+
+func (s *Server) handlePasswordForgot(w http.ResponseWriter, r *http.Request) {
+	lang := s.i18n.FromRequest(r)
+	data := map[string]any{"Lang": lang, "Enabled": s.mailLinks()}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = s.tpl.ExecuteTemplate(w, "password_forgot", data)
+
+	case http.MethodPost:
+		_ = r.ParseForm()
+		ident := strings.TrimSpace(r.FormValue("ident"))
+
+		u, err := s.st.GetPanelUserByEmail(ident)
+		if err != nil {
+			u, err = s.st.GetPanelUserByUsername(ident)
+		}
+		// only verified addresses receive reset links
+		if err == nil && u.Enabled && u.Email != "" && u.EmailVerified && s.mailLinks() {
+			ml := s.mailLang(r, u)
+			tok := auth.SignToken(s.tokenSecret, auth.PurposeReset, u.ID, auth.Stamp(u.PasswordHash), s.tokenTTL)
+			link := s.baseURL() + "/ui/password/reset?token=" + url.QueryEscape(tok)
+			s.sendAsync(u.Email,
+				s.i18n.T(ml, "mail.reset_subject"),
+				s.i18n.T(ml, "mail.reset_body", u.Username, s.tokenTTL.String(), link))
+		}
+
+		// same answer whether or not the account exists
+		data["Sent"] = true
+		_ = s.tpl.ExecuteTemplate(w, "password_forgot", data)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	lang := s.i18n.FromRequest(r)
+	data := map[string]any{"Lang": lang, "Policy": s.cfg.Security.PasswordPolicy}
+
+	switch r.Method {
+	case http.MethodGet:
+		tok := r.URL.Query().Get("token")
+		if _, ok := s.verifyResetToken(tok); !ok {
+			data["Invalid"] = true
+		}
+		data["Token"] = tok
+		_ = s.tpl.ExecuteTemplate(w, "password_reset", data)
+
+	case http.MethodPost:
+		_ = r.ParseForm()
+		tok := r.FormValue("token")
+		data["Token"] = tok
+
+		u, ok := s.verifyResetToken(tok)
+		if !ok {
+			data["Invalid"] = true
+			_ = s.tpl.ExecuteTemplate(w, "password_reset", data)
+			return
+		}
+		pass := r.FormValue("password")
+		if pass != r.FormValue("confirm") {
+			data["Error"] = s.i18n.T(lang, "password.mismatch")
+			_ = s.tpl.ExecuteTemplate(w, "password_reset", data)
+			return
+		}
+		hash, err := s.hashPassword(pass)
+		if err != nil {
+			data["Error"] = err.Error()
+			_ = s.tpl.ExecuteTemplate(w, "password_reset", data)
+			return
+		}
+		if err := s.st.UpdatePanelUserPassword(u.ID, hash); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["Done"] = true
+		_ = s.tpl.ExecuteTemplate(w, "password_reset", data)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	sess, _ := s.sessionFromCtx(r)
+	lang := s.lang(r)
+	data := map[string]any{
+		"Forced": sess.MustChangePassword,
+		"Policy": s.cfg.Security.PasswordPolicy,
+		"Action": r.URL.Path,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.render(w, r, "Change Password", "password_change", data)
+
+	case http.MethodPost:
+		_ = r.ParseForm()
+		u, err := s.st.GetPanelUserByID(sess.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		cur := r.FormValue("current")
+		pass := r.FormValue("password")
+
+		switch {
+		case bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(cur)) != nil:
+			data["Error"] = s.i18n.T(lang, "password.wrong_current")
+		case pass != r.FormValue("confirm"):
+			data["Error"] = s.i18n.T(lang, "password.mismatch")
+		case pass == cur:
+			data["Error"] = s.i18n.T(lang, "password.same")
+		}
+		if data["Error"] != nil {
+			s.render(w, r, "Change Password", "password_change", data)
+			return
+		}
+
+		hash, err := s.hashPassword(pass)
+		if err != nil {
+			data["Error"] = err.Error()
+			s.render(w, r, "Change Password", "password_change", data)
+			return
+		}
+		if err := s.st.UpdatePanelUserPassword(u.ID, hash); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.sessions.SetMustChangePassword(sess.Token, false)
+		s.sessions.SetStamp(sess.Token, auth.Stamp(hash))
+		s.sessions.Reauthenticated(sess.Token)
+		if n := s.sessions.DeleteUser(u.ID, sess.Token); n > 0 {
+			s.core.AuditOwner(u.Username, "info", "auth", "password change of %q signed out %d other session(s)", u.Username, n)
+		}
+		http.Redirect(w, r, "/ui/profile?notice=password_changed", http.StatusFound)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	sess, _ := s.sessionFromCtx(r)
+	u, err := s.st.GetPanelUserByID(sess.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		notice := ""
+		switch r.URL.Query().Get("notice") {
+		case "email_saved", "verify_sent", "email_verified", "password_changed":
+			notice = "profile." + r.URL.Query().Get("notice")
+		}
+		s.render(w, r, "Profile", "profile", map[string]any{
+			"User":      u,
+			"Notice":    notice,
+			"MailReady": s.mailLinks(),
+		})
+
+	case http.MethodPost:
+		_ = r.ParseForm()
+		switch r.FormValue("action") {
+		case "email":
+			email := strings.TrimSpace(r.FormValue("email"))
+			if email != "" {
+				a, err := mail.ParseAddress(email)
+				if err != nil || a.Address != email {
+					s.render(w, r, "Profile", "profile", map[string]any{
+						"User":      u,
+						"Error":     s.i18n.T(s.lang(r), "profile.invalid_email"),
+						"MailReady": s.mailLinks(),
+					})
+					return
+				}
+			}
+			if err := s.st.UpdatePanelUserEmail(u.ID, email); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if u, err = s.st.GetPanelUserByID(u.ID); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if u.Email != "" && !u.EmailVerified && s.mailLinks() {
+				s.sendVerifyEmail(r, u)
+				http.Redirect(w, r, "/ui/profile?notice=verify_sent", http.StatusFound)
+				return
+			}
+			http.Redirect(w, r, "/ui/profile?notice=email_saved", http.StatusFound)
+
+		case "verify":
+			if u.Email == "" || u.EmailVerified || !s.mailLinks() {
+				http.Redirect(w, r, "/ui/profile", http.StatusFound)
+				return
+			}
+			s.sendVerifyEmail(r, u)
+			http.Redirect(w, r, "/ui/profile?notice=verify_sent", http.StatusFound)
+
+		default:
+			http.Error(w, "unknown action", http.StatusBadRequest)
+		}
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEmailVerify is public: the signed token proves ownership of the address.
+func (s *Server) handleEmailVerify(w http.ResponseWriter, r *http.Request) {
+	lang := s.i18n.FromRequest(r)
+	uid, stamp, err := auth.VerifyToken(s.tokenSecret, auth.PurposeVerifyEmail, r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, s.i18n.T(lang, "verify.invalid"), http.StatusBadRequest)
+		return
+	}
+	u, err := s.st.GetPanelUserByID(uid)
+	if err != nil || u.Email == "" || stamp != auth.Stamp(strings.ToLower(u.Email)) {
+		http.Error(w, s.i18n.T(lang, "verify.invalid"), http.StatusBadRequest)
+		return
+	}
+	if err := s.st.MarkPanelUserEmailVerified(u.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/ui/profile?notice=email_verified", http.StatusFound)
+}
+
+// ---------------- templates ----------------
+
+const passwordPolicyHTML = `<p style="opacity:.75; font-size:90%;">
+      {{t .Lang "password.policy_min" .Policy.MinLength}}
+      {{if .Policy.RequireUpper}} · {{t .Lang "password.policy_upper"}}{{end}}
+      {{if .Policy.RequireLower}} · {{t .Lang "password.policy_lower"}}{{end}}
+      {{if .Policy.RequireDigit}} · {{t .Lang "password.policy_digit"}}{{end}}
+      {{if .Policy.RequireSymbol}} · {{t .Lang "password.policy_symbol"}}{{end}}
+    </p>`
+
+const passwordForgotHTML = `<!doctype html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><title>{{t .Lang "forgot.title"}}</title></head>
+<body style="font-family:system-ui; max-width:520px; margin:40px auto;">
+  <h2>{{t .Lang "forgot.title"}}</h2>
+  {{if not .Enabled}}
+    <p style="color:#b00;">{{t .Lang "forgot.disabled"}}</p>
+  {{else if .Sent}}
+    <p>{{t .Lang "forgot.sent"}}</p>
+  {{else}}
+    <p style="opacity:.8;">{{t .Lang "forgot.hint"}}</p>
+    <form method="post" action="/ui/password/forgot">
+      <div style="margin:10px 0;">
+        <label>{{t .Lang "forgot.ident"}}</label><br/>
+        <input name="ident" style="width:100%; padding:8px;" />
+      </div>
+      <button style="padding:10px 14px;">{{t .Lang "forgot.submit"}}</button>
+    </form>
+  {{end}}
+  <p><a href="/ui/login">{{t .Lang "common.back_login"}}</a></p>
+</body></html>`
+
+const passwordResetHTML = `<!doctype html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><title>{{t .Lang "reset.title"}}</title></head>
+<body style="font-family:system-ui; max-width:520px; margin:40px auto;">
+  <h2>{{t .Lang "reset.title"}}</h2>
+  {{if .Done}}
+    <p>{{t .Lang "reset.done"}}</p>
+  {{else if .Invalid}}
+    <p style="color:#b00;">{{t .Lang "reset.invalid"}}</p>
+    <p><a href="/ui/password/forgot">{{t .Lang "reset.again"}}</a></p>
+  {{else}}
+    {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+    <form method="post" action="/ui/password/reset">
+      <input type="hidden" name="token" value="{{.Token}}">
+      <div style="margin:10px 0;">
+        <label>{{t .Lang "password.new"}}</label><br/>
+        <input type="password" name="password" autocomplete="new-password" style="width:100%; padding:8px;" />
+      </div>
+      <div style="margin:10px 0;">
+        <label>{{t .Lang "password.confirm"}}</label><br/>
+        <input type="password" name="confirm" autocomplete="new-password" style="width:100%; padding:8px;" />
+      </div>
+      ` + passwordPolicyHTML + `
+      <button style="padding:10px 14px;">{{t .Lang "reset.submit"}}</button>
+    </form>
+  {{end}}
+  <p><a href="/ui/login">{{t .Lang "common.back_login"}}</a></p>
+</body></html>`
+
+const passwordChangeHTML = `{{define "password_change"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "password.title"}}</h2>
+  {{if .Forced}}<p style="color:#b60;">{{t .Lang "password.forced"}}</p>{{end}}
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <form method="post" action="{{.Action}}" style="max-width:420px;">
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "password.current"}}</label><br/>
+      <input type="password" name="current" autocomplete="current-password" style="width:100%; padding:8px;" />
+    </div>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "password.new"}}</label><br/>
+      <input type="password" name="password" autocomplete="new-password" style="width:100%; padding:8px;" />
+    </div>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "password.confirm"}}</label><br/>
+      <input type="password" name="confirm" autocomplete="new-password" style="width:100%; padding:8px;" />
+    </div>
+    ` + passwordPolicyHTML + `
+    <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+  </form>
+{{end}}`
+
+const profileHTML = `{{define "profile"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "profile.title"}}</h2>
+  {{if .Notice}}<p style="color:#070;">{{t .Lang .Notice}}</p>{{end}}
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse;">
+    <tr><th align="left">{{t .Lang "profile.username"}}</th><td>{{.User.Username}}</td></tr>
+    <tr><th align="left">{{t .Lang "profile.role"}}</th><td>{{.User.Role}}</td></tr>
+    <tr><th align="left">{{t .Lang "profile.last_login"}}</th><td>{{fmtTime .Lang .User.LastLoginAt}}</td></tr>
+    <tr>
+      <th align="left">{{t .Lang "profile.email"}}</th>
+      <td>
+        {{if .User.Email}}
+          {{.User.Email}}
+          {{if .User.EmailVerified}}({{t .Lang "profile.verified"}}){{else}}<span style="color:#b60;">({{t .Lang "profile.not_verified"}})</span>{{end}}
+        {{else}}-{{end}}
+      </td>
+    </tr>
+  </table>
+
+  <h3>{{t .Lang "profile.email"}}</h3>
+  <form method="post" action="/ui/profile" style="display:flex; gap:8px; align-items:center;">
+    <input type="hidden" name="action" value="email">
+    <input name="email" value="{{.User.Email}}" style="padding:6px; width:280px;">
+    <button>{{t .Lang "action.save"}}</button>
+  </form>
+  {{if and .User.Email (not .User.EmailVerified)}}
+    {{if .MailReady}}
+      <form method="post" action="/ui/profile" style="margin-top:8px;">
+        <input type="hidden" name="action" value="verify">
+        <button>{{t .Lang "profile.send_verify"}}</button>
+      </form>
+    {{else}}
+      <p style="opacity:.75;">{{t .Lang "profile.smtp_disabled"}}</p>
+    {{end}}
+  {{end}}
+  <p style="opacity:.75;">{{t .Lang "profile.email_hint"}}</p>
+
+  <h3>{{t .Lang "password.title"}}</h3>
+  <p><a href="/ui/profile/password">{{t .Lang "profile.change_password"}}</a></p>
+{{end}}`
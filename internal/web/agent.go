@@ -0,0 +1,115 @@
+package web
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"mynginx/internal/cluster"
+)
+
+// Agent API: node-to-node calls. Requests and responses are sealed with the cluster
+// secret (see internal/cluster), so these routes sit outside the session auth.
+
+// readSealed opens a sealed request body from a known peer into v.
+func (s *Server) readSealed(w http.ResponseWriter, r *http.Request, v any) (string, bool) {
+	node := s.core.Cluster()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	from, err := cluster.Open(node.Secret(), data, v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return "", false
+	}
+	if !node.IsPeer(from) {
+		http.Error(w, "unknown node "+from, http.StatusForbidden)
+		return "", false
+	}
+	return from, true
+}
+
+func (s *Server) writeSealed(w http.ResponseWriter, v any) {
+	node := s.core.Cluster()
+	out, err := cluster.Seal(node.Secret(), node.Name(), v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(out)
+}
+
+// handleAgentLock serves issuance locks; only the coordinator answers.
+func (s *Server) handleAgentLock(w http.ResponseWriter, r *http.Request) {
+	var req cluster.LockRequest
+	from, ok := s.readSealed(w, r, &req)
+	if !ok {
+		return
+	}
+	node := s.core.Cluster()
+	if node.Coordinator() != node.Name() {
+		http.Error(w, "not the lock coordinator", http.StatusConflict)
+		return
+	}
+	if req.Holder != from || req.Domain == "" {
+		http.Error(w, "bad lock request", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Op {
+	case "acquire":
+		got, holder, err := node.Locks().Acquire(req.Domain, req.Holder, node.TTL())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeSealed(w, cluster.LockResponse{OK: got, Holder: holder})
+	case "release":
+		if err := node.Locks().Release(req.Domain, req.Holder); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writeSealed(w, cluster.LockResponse{OK: true})
+	default:
+		http.Error(w, "unknown op", http.StatusBadRequest)
+	}
+}
+
+// handleAgentCert installs a certificate pushed by the issuing node.
+func (s *Server) handleAgentCert(w http.ResponseWriter, r *http.Request) {
+	var b cluster.CertBundle
+	from, ok := s.readSealed(w, r, &b)
+	if !ok {
+		return
+	}
+	if err := s.core.CertInstall(b.Domain, b.Fullchain, b.PrivKey); err != nil {
+		log.Printf("cluster: cert %s from %s rejected: %v", b.Domain, from, err)
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	log.Printf("cluster: installed cert %s from %s", b.Domain, from)
+	s.writeSealed(w, struct{}{})
+}
+
+// handleAgentSnapshot hands a standby the database and generated configs of this node.
+func (s *Server) handleAgentSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req cluster.SnapshotRequest
+	from, ok := s.readSealed(w, r, &req)
+	if !ok {
+		return
+	}
+	snap, err := s.core.StandbySnapshot()
+	if err != nil {
+		log.Printf("cluster: snapshot for %s: %v", from, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeSealed(w, snap)
+}
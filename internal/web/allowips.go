@@ -0,0 +1,106 @@
+package web
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"mynginx/internal/health"
+)
+
+// parseCIDRs parses a validated CIDR list (config.Validate rejects bad entries;
+// anything left unparsable is skipped with a log line).
+func parseCIDRs(key string, list []string) []*net.IPNet {
+	var out []*net.IPNet
+	for _, c := range list {
+		_, n, err := net.ParseCIDR(strings.TrimSpace(c))
+		if err != nil {
+			log.Printf("%s: skipping %q: %v", key, c, err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+func cidrsContain(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIP rewrites r.RemoteAddr to the client address when the connection comes
+// from one of api.trusted_proxies: the right-most X-Forwarded-For hop that is not
+// itself a trusted proxy (X-Real-IP when there is no X-Forwarded-For). Everything
+// downstream (allow list, rate limits, audit lines) then sees the real client.
+func (s *Server) realIP(next http.Handler) http.Handler {
+	trusted := parseCIDRs("api.trusted_proxies", s.cfg.API.TrustedProxies)
+	if len(trusted) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := net.ParseIP(remoteHost(r))
+		if peer == nil || !cidrsContain(trusted, peer) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := ""
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			hops := strings.Split(xff, ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				client = ip.String()
+				if !cidrsContain(trusted, ip) {
+					break
+				}
+			}
+		} else if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			client = ip.String()
+		}
+		if client != "" {
+			r2 := r.Clone(r.Context())
+			r2.RemoteAddr = net.JoinHostPort(client, "0")
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowIPs rejects clients outside api.allow_ips (empty = everyone) with a 403, on
+// the panel and the API alike. The public status page stays reachable, as do callers
+// that authenticate themselves and usually come from elsewhere: git push webhooks
+// (signed), reports of external check locations (shared secret) and the sealed
+// cluster agent API.
+func (s *Server) allowIPs(next http.Handler) http.Handler {
+	allowed := parseCIDRs("api.allow_ips", s.cfg.API.AllowIPs)
+	if len(allowed) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowlistExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := net.ParseIP(remoteHost(r))
+		if ip == nil || !cidrsContain(allowed, ip) {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				apiError(w, http.StatusForbidden, "source address not in api.allow_ips")
+				return
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func allowlistExempt(path string) bool {
+	return path == "/status" || path == health.ReportPath || strings.HasPrefix(path, "/agent/") || isDeployHook(path)
+}
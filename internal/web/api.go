@@ -0,0 +1,990 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynginx/internal/app"
+	"mynginx/internal/auth"
+	"mynginx/internal/store"
+)
+
+// apiPrefix is the JSON API: bearer-token auth (see `ngm token`), api.allow_ips.
+const apiPrefix = "/api/v1/"
+
+// ctxAPIToken carries the token (app.APITokenAccess) a /api/v1 request authenticated with.
+const ctxAPIToken ctxKey = 2
+
+// apiHandler serves one API route; args are the path segments matched by "*".
+type apiHandler func(w http.ResponseWriter, r *http.Request, args []string)
+
+type apiRoute struct {
+	method string
+	path   string // segments after /api/v1/, "*" matches one
+	scope  string
+	h      apiHandler
+	// idem lets retries of a mutating call replay the first response (Idempotency-Key)
+	idem bool
+	// global routes are panel-wide: tokens limited to some sites cannot use them
+	global bool
+	// byID routes take an id, not a domain: the handler checks the site itself
+	byID bool
+}
+
+func (s *Server) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{method: http.MethodGet, path: "sites", scope: auth.ScopeRead, h: s.apiSites},
+		{method: http.MethodPost, path: "sites", scope: auth.ScopeSites, h: s.apiSiteAdd, idem: true},
+		{method: http.MethodGet, path: "sites/*", scope: auth.ScopeRead, h: s.apiSite},
+		{method: http.MethodPatch, path: "sites/*", scope: auth.ScopeSites, h: s.apiSiteEdit, idem: true},
+		{method: http.MethodDelete, path: "sites/*", scope: auth.ScopeSites, h: s.apiSiteDelete, idem: true},
+		{method: http.MethodPost, path: "sites/*/enable", scope: auth.ScopeSites, h: s.apiSiteEnable, idem: true},
+		{method: http.MethodPost, path: "sites/*/disable", scope: auth.ScopeSites, h: s.apiSiteDisable, idem: true},
+		{method: http.MethodGet, path: "sites/*/targets", scope: auth.ScopeRead, h: s.apiTargets},
+		{method: http.MethodGet, path: "my/sites", scope: auth.ScopeRead, h: s.apiMySites},
+		{method: http.MethodPost, path: "sites/*/targets", scope: auth.ScopeSites, h: s.apiTargetUpsert, idem: true},
+		{method: http.MethodDelete, path: "sites/*/targets", scope: auth.ScopeSites, h: s.apiTargetDisable, idem: true},
+		{method: http.MethodGet, path: "certs", scope: auth.ScopeRead, h: s.apiCerts},
+		{method: http.MethodPost, path: "certs/*/issue", scope: auth.ScopeCerts, h: s.apiCertIssue, idem: true},
+		{method: http.MethodPost, path: "certs/*/renew", scope: auth.ScopeCerts, h: s.apiCertRenew, idem: true},
+		{method: http.MethodPost, path: "apply", scope: auth.ScopeApply, h: s.apiApply, idem: true},
+		{method: http.MethodGet, path: "apply/runs", scope: auth.ScopeRead, h: s.apiApplyRuns, global: true},
+		{method: http.MethodGet, path: "apply/runs/*", scope: auth.ScopeRead, h: s.apiApplyRun, global: true},
+		{method: http.MethodGet, path: "jobs/*", scope: auth.ScopeRead, h: s.apiJob, byID: true},
+		{method: http.MethodGet, path: "users", scope: auth.ScopeAdmin, h: s.apiUsers, global: true},
+		{method: http.MethodPost, path: "users", scope: auth.ScopeAdmin, h: s.apiUserAdd, idem: true, global: true},
+	}
+}
+
+// handleAPI routes /api/v1/. Push webhooks of git deploys authenticate themselves;
+// everything else needs a bearer token with the route's scope (api.allow_ips is
+// enforced for the whole server, see allowIPs). A token limited to some sites gets
+// 404 for any other site, as if it did not exist.
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if isDeployHook(r.URL.Path) {
+		setAuditActor(r, "deploy-hook")
+		s.handleDeployHook(w, r)
+		return
+	}
+	parts := apiPath(r.URL.Path)
+
+	var allow []string
+	for _, rt := range s.apiRoutes() {
+		args, ok := matchAPIPath(rt.path, parts)
+		if !ok {
+			continue
+		}
+		if rt.method != r.Method {
+			allow = append(allow, rt.method)
+			continue
+		}
+		tok, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		acc, err := s.core.APITokenAuth(strings.TrimSpace(tok), rt.scope, remoteHost(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ngm"`)
+			apiError(w, http.StatusUnauthorized, "missing or invalid token, or token lacks the "+rt.scope+" scope")
+			return
+		}
+		if acc.Restricted() {
+			// every route with a "*" takes a domain, except the global ones
+			if rt.global {
+				apiError(w, http.StatusForbidden, "token is limited to some sites; this endpoint is panel-wide")
+				return
+			}
+			if len(args) > 0 && !rt.byID && !s.core.TokenAllowsSite(acc.APITokenLimit, args[0]) {
+				apiError(w, http.StatusNotFound, "no such site")
+				return
+			}
+		}
+		setAuditActor(r, "token:"+acc.Name)
+		r = r.WithContext(context.WithValue(r.Context(), ctxAPIToken, acc))
+		h := func(w http.ResponseWriter, r *http.Request) { rt.h(w, r, args) }
+		if rt.idem {
+			h = s.idempotent(h)
+		}
+		h(w, r)
+		return
+	}
+	if len(allow) > 0 {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		apiError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	apiError(w, http.StatusNotFound, "no such endpoint")
+}
+
+func matchAPIPath(pattern string, parts []string) ([]string, bool) {
+	segs := strings.Split(pattern, "/")
+	if len(segs) != len(parts) {
+		return nil, false
+	}
+	var args []string
+	for i, seg := range segs {
+		switch {
+		case seg == "*" && parts[i] != "":
+			args = append(args, parts[i])
+		case seg != parts[i]:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// apiPath splits an /api/v1/ path into its segments.
+func apiPath(path string) []string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(path, apiPrefix), "/"), "/")
+}
+
+// isDeployHook reports whether path is the push webhook of a git deploy.
+func isDeployHook(path string) bool {
+	parts := apiPath(path)
+	return strings.HasPrefix(path, apiPrefix) && len(parts) == 3 && parts[0] == "sites" && parts[2] == "deploy"
+}
+
+// apiTokenFromCtx is the token name of an authenticated API request.
+func apiTokenFromCtx(r *http.Request) (string, bool) {
+	acc, ok := apiAccessFromCtx(r)
+	return acc.Name, ok
+}
+
+// apiAccessFromCtx is the token of an authenticated API request with its site limit.
+func apiAccessFromCtx(r *http.Request) (app.APITokenAccess, bool) {
+	acc, ok := r.Context().Value(ctxAPIToken).(app.APITokenAccess)
+	return acc, ok
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// apiFail maps err to a status: bad input 400, missing 404, conflicts 409, plan
+// limits 403, anything else fallback.
+func apiFail(w http.ResponseWriter, err error, fallback int) {
+	var ve *app.ValidationError
+	status := fallback
+	switch {
+	case errors.As(err, &ve):
+		status = http.StatusBadRequest
+	case errors.Is(err, sql.ErrNoRows):
+		status = http.StatusNotFound
+	case errors.Is(err, store.ErrRevisionConflict), errors.Is(err, app.ErrApplyBusy):
+		status = http.StatusConflict
+	case errors.Is(err, app.ErrPlanLimit):
+		status = http.StatusForbidden
+	}
+	apiError(w, status, err.Error())
+}
+
+// readJSON decodes the request body into v; unknown fields are an error so typos
+// do not pass silently. An empty body leaves v as it is.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		apiError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// ---------------- sites ----------------
+
+type apiSite struct {
+	Domain          string     `json:"domain"`
+	Owner           string     `json:"owner,omitempty"`
+	Mode            string     `json:"mode"`
+	Webroot         string     `json:"webroot,omitempty"`
+	PHP             string     `json:"php,omitempty"`
+	HTTP3           bool       `json:"http3"`
+	Enabled         bool       `json:"enabled"`
+	State           string     `json:"state,omitempty"` // OK|PENDING|ERROR|DISABLED (list only)
+	Revision        int64      `json:"revision"`
+	RedirectTo      string     `json:"redirect_to,omitempty"`
+	LastAppliedAt   *time.Time `json:"last_applied_at,omitempty"`
+	LastApplyStatus string     `json:"last_apply_status,omitempty"`
+	LastApplyError  string     `json:"last_apply_error,omitempty"`
+	RenderHash      string     `json:"render_hash,omitempty"`
+	CertExpiresAt   *time.Time `json:"cert_expires_at,omitempty"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	RetireUntil     *time.Time `json:"retire_until,omitempty"`
+	RetireStatus    int        `json:"retire_status,omitempty"`
+}
+
+func toAPISite(st store.Site, owner string) apiSite {
+	return apiSite{
+		Domain:          st.Domain,
+		Owner:           owner,
+		Mode:            st.Mode,
+		Webroot:         st.Webroot,
+		PHP:             st.PHPVersion,
+		HTTP3:           st.EnableHTTP3,
+		Enabled:         st.Enabled,
+		Revision:        st.Revision,
+		RedirectTo:      st.RedirectURL,
+		LastAppliedAt:   st.LastAppliedAt,
+		LastApplyStatus: st.LastApplyStatus,
+		LastApplyError:  st.LastApplyError,
+		RenderHash:      st.LastRenderHash,
+		ExpiresAt:       st.ExpiresAt,
+		RetireUntil:     st.RetireUntil,
+		RetireStatus:    st.RetireStatus,
+	}
+}
+
+// siteOwner is the username of the hosting user of st ("" if unowned).
+func (s *Server) siteOwner(st store.Site) string {
+	if st.UserID == 0 {
+		return ""
+	}
+	if u, err := s.st.GetUserByID(st.UserID); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+func (s *Server) apiSites(w http.ResponseWriter, r *http.Request, _ []string) {
+	items, err := s.core.SiteList(r.Context())
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	acc, _ := apiAccessFromCtx(r)
+	out := make([]apiSite, 0, len(items))
+	for _, it := range items {
+		if !acc.AllowsSite(it.Site.Domain, it.Owner) {
+			continue
+		}
+		as := toAPISite(it.Site, it.Owner)
+		as.State = it.State
+		as.CertExpiresAt = it.Cert
+		out = append(out, as)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) apiSite(w http.ResponseWriter, r *http.Request, args []string) {
+	st, err := s.core.SiteGet(r.Context(), args[0])
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(st.Revision, 10)))
+	writeJSON(w, http.StatusOK, toAPISite(st, s.siteOwner(st)))
+}
+
+func (s *Server) apiSiteAdd(w http.ResponseWriter, r *http.Request, _ []string) {
+	body := struct {
+		User         string   `json:"user"`
+		Domain       string   `json:"domain"`
+		Mode         string   `json:"mode"`
+		PHP          string   `json:"php"`
+		Webroot      string   `json:"webroot"`
+		HTTP3        *bool    `json:"http3"`
+		Provision    *bool    `json:"provision"`
+		SkipCert     bool     `json:"skip_cert"`
+		ApplyNow     *bool    `json:"apply_now"`
+		ProxyTargets []string `json:"proxy_targets"`
+		RedirectTo   string   `json:"redirect_to"`
+		RedirectCode int      `json:"redirect_code"`
+		KeepPath     bool     `json:"redirect_keep_path"`
+		Placeholder  bool     `json:"placeholder"`
+		Hardened     bool     `json:"hardened"`
+		DNSRecords   bool     `json:"dns_records"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	// a user-limited token adds sites for its user
+	acc, _ := apiAccessFromCtx(r)
+	if body.User = strings.TrimSpace(body.User); body.User == "" {
+		body.User = acc.User
+	}
+	if !acc.AllowsSite(strings.TrimSpace(body.Domain), body.User) {
+		apiError(w, http.StatusForbidden, "token may not add this site (domain or user outside its limit)")
+		return
+	}
+	// as for role=user in the panel: the webroot follows from the user's home (the
+	// site dirs above it are chowned to the user)
+	if acc.Restricted() && strings.TrimSpace(body.Webroot) != "" {
+		apiError(w, http.StatusForbidden, "a user-limited token may not set the webroot")
+		return
+	}
+	// proxy targets reach anywhere on the network: admin tokens only (errProxyAdminOnly)
+	if acc.Restricted() && (strings.TrimSpace(body.Mode) == "proxy" || len(body.ProxyTargets) > 0) {
+		apiError(w, http.StatusForbidden, "a user-limited token may not set up proxy sites")
+		return
+	}
+	orTrue := func(b *bool) bool { return b == nil || *b }
+	res, err := s.core.SiteAdd(r.Context(), app.SiteAddRequest{
+		User:             body.User,
+		Domain:           strings.TrimSpace(body.Domain),
+		Mode:             strings.TrimSpace(body.Mode),
+		PHP:              strings.TrimSpace(body.PHP),
+		Webroot:          strings.TrimSpace(body.Webroot),
+		HTTP3:            orTrue(body.HTTP3),
+		Provision:        orTrue(body.Provision),
+		SkipCert:         body.SkipCert,
+		ApplyNow:         orTrue(body.ApplyNow),
+		ProxyTargets:     body.ProxyTargets,
+		RedirectTo:       strings.TrimSpace(body.RedirectTo),
+		RedirectCode:     body.RedirectCode,
+		RedirectKeepPath: body.KeepPath,
+		Placeholder:      body.Placeholder,
+		Hardened:         body.Hardened,
+		DNSRecords:       body.DNSRecords,
+	})
+	if err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"sites/"+res.Site.Domain)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"site":     toAPISite(res.Site, s.siteOwner(res.Site)),
+		"warnings": res.Warnings,
+	})
+}
+
+func (s *Server) apiSiteEdit(w http.ResponseWriter, r *http.Request, args []string) {
+	body := struct {
+		User     string `json:"user"`
+		Mode     string `json:"mode"`
+		PHP      string `json:"php"`
+		Webroot  string `json:"webroot"`
+		HTTP3    *bool  `json:"http3"`
+		Enabled  *bool  `json:"enabled"`
+		ApplyNow bool   `json:"apply_now"`
+		Revision int64  `json:"revision"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	acc, _ := apiAccessFromCtx(r)
+	if strings.TrimSpace(body.User) != "" && !acc.AllowsSite(args[0], strings.TrimSpace(body.User)) {
+		apiError(w, http.StatusForbidden, "token may not hand the site to a user outside its limit")
+		return
+	}
+	if acc.Restricted() && strings.TrimSpace(body.Webroot) != "" {
+		apiError(w, http.StatusForbidden, "a user-limited token may not set the webroot")
+		return
+	}
+	if acc.Restricted() {
+		if err := s.userSiteMode(args[0], body.Mode); err != nil {
+			apiError(w, http.StatusForbidden, "a user-limited token may not set up proxy sites")
+			return
+		}
+	}
+	req := app.SiteEditRequest{
+		Domain:           args[0],
+		User:             strings.TrimSpace(body.User),
+		Mode:             strings.TrimSpace(body.Mode),
+		PHP:              strings.TrimSpace(body.PHP),
+		Webroot:          strings.TrimSpace(body.Webroot),
+		HTTP3:            body.HTTP3,
+		Enabled:          body.Enabled,
+		ApplyNow:         body.ApplyNow,
+		ExpectedRevision: body.Revision,
+	}
+	if req.ExpectedRevision == 0 {
+		req.ExpectedRevision = expectedRevision(r)
+	}
+	updated, err := s.core.SiteEdit(r.Context(), req)
+	if err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(updated.Revision, 10)))
+	writeJSON(w, http.StatusOK, toAPISite(updated, s.siteOwner(updated)))
+}
+
+func (s *Server) apiSiteDelete(w http.ResponseWriter, r *http.Request, args []string) {
+	if s.core.ApprovalsRequired() {
+		acc, _ := apiAccessFromCtx(r)
+		c, err := s.core.RequestSiteDelete(args[0], "token:"+acc.Name)
+		if err != nil {
+			apiFail(w, err, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, toAPIChange(c))
+		return
+	}
+	if err := s.core.SiteDelete(r.Context(), args[0]); err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiSiteEnable(w http.ResponseWriter, r *http.Request, args []string) {
+	st, err := s.core.SiteEnable(r.Context(), args[0])
+	if err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPISite(st, s.siteOwner(st)))
+}
+
+// apiSiteDisable disables a site; with grace (a Go duration) it answers status
+// (410 by default, or 503) with the retired page until the grace period ends.
+func (s *Server) apiSiteDisable(w http.ResponseWriter, r *http.Request, args []string) {
+	body := struct {
+		Grace  string `json:"grace"`
+		Status int    `json:"status"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Grace == "" {
+		if err := s.core.SiteDisable(r.Context(), args[0]); err != nil {
+			apiFail(w, err, http.StatusBadRequest)
+			return
+		}
+		s.apiSite(w, r, args)
+		return
+	}
+	grace, err := time.ParseDuration(body.Grace)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid grace: "+err.Error())
+		return
+	}
+	if body.Status == 0 {
+		body.Status = http.StatusGone
+	}
+	if _, err := s.core.SiteRetire(r.Context(), args[0], grace, body.Status); err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	s.apiSite(w, r, args)
+}
+
+// ---------------- customer status ----------------
+
+// apiSiteStatus is a site as /my/sites shows it to its owner: state, certificate
+// and uptime only. The uptime fields are left out while there is no check.
+type apiSiteStatus struct {
+	Domain        string     `json:"domain"`
+	State         string     `json:"state"`
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"`
+	CertDays      *int       `json:"cert_days,omitempty"`
+	Up            *bool      `json:"up,omitempty"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+	LatencyMS     *int64     `json:"latency_ms,omitempty"`
+	DownSince     *time.Time `json:"down_since,omitempty"`
+	Uptime24h     *float64   `json:"uptime_24h,omitempty"` // percent
+	Uptime30d     *float64   `json:"uptime_30d,omitempty"`
+}
+
+func toAPISiteStatus(st app.OwnedSiteStatus) apiSiteStatus {
+	out := apiSiteStatus{Domain: st.Domain, State: st.State, CertExpiresAt: st.Cert}
+	if st.Cert != nil {
+		out.CertDays = &st.CertDays
+	}
+	if c := st.Last; c != nil {
+		out.Up, out.CheckedAt, out.LatencyMS = &c.OK, &c.CheckedAt, &c.LatencyMS
+	}
+	if st.Open != nil {
+		out.DownSince = &st.Open.StartedAt
+	}
+	if st.Day.HasData {
+		out.Uptime24h = &st.Day.Percent
+	}
+	if st.Month.HasData {
+		out.Uptime30d = &st.Month.Percent
+	}
+	return out
+}
+
+// apiMySites serves GET /my/sites: the status of the sites of a token limited to a
+// hosting user (or to domains), for customers to show on their own dashboards. An
+// unlimited token is refused: it belongs to no one.
+func (s *Server) apiMySites(w http.ResponseWriter, r *http.Request, _ []string) {
+	acc, _ := apiAccessFromCtx(r)
+	if !acc.Restricted() {
+		apiError(w, http.StatusForbidden, "token is not limited to a user or domains; use GET /sites")
+		return
+	}
+	list, err := s.core.SiteStatuses(r.Context(), acc.APITokenLimit)
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]apiSiteStatus, 0, len(list))
+	for _, st := range list {
+		out = append(out, toAPISiteStatus(st))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// ---------------- proxy targets ----------------
+
+type apiTarget struct {
+	Target     string `json:"target"`
+	Weight     int    `json:"weight"`
+	Backup     bool   `json:"backup"`
+	Enabled    bool   `json:"enabled"`
+	Group      string `json:"group,omitempty"`
+	Discovered bool   `json:"discovered,omitempty"`
+}
+
+func (s *Server) apiTargets(w http.ResponseWriter, r *http.Request, args []string) {
+	site, err := s.core.SiteGet(r.Context(), args[0])
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	list, err := s.st.ListProxyTargetsBySiteID(site.ID)
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]apiTarget, 0, len(list))
+	for _, t := range list {
+		out = append(out, apiTarget{Target: t.Addr, Weight: t.Weight, Backup: t.Backup, Enabled: t.Enabled, Group: t.Group, Discovered: t.Discovered})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) apiTargetUpsert(w http.ResponseWriter, r *http.Request, args []string) {
+	body := struct {
+		Target  string `json:"target"`
+		Weight  int    `json:"weight"`
+		Backup  bool   `json:"backup"`
+		Enabled *bool  `json:"enabled"`
+		Group   string `json:"group"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if acc, _ := apiAccessFromCtx(r); acc.Restricted() {
+		apiError(w, http.StatusForbidden, "a user-limited token may not set proxy targets")
+		return
+	}
+	if strings.TrimSpace(body.Target) == "" {
+		apiError(w, http.StatusBadRequest, "target is required")
+		return
+	}
+	enabled := body.Enabled == nil || *body.Enabled
+	if err := s.core.ProxyTargetUpsert(r.Context(), args[0], strings.TrimSpace(body.Target), body.Weight, body.Backup, enabled, body.Group); err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	s.apiTargets(w, r, args)
+}
+
+// apiTargetDisable disables ?target= of a site, as the panel's delete does.
+func (s *Server) apiTargetDisable(w http.ResponseWriter, r *http.Request, args []string) {
+	target := strings.TrimSpace(r.URL.Query().Get("target"))
+	if target == "" {
+		apiError(w, http.StatusBadRequest, "target query parameter is required")
+		return
+	}
+	site, err := s.core.SiteGet(r.Context(), args[0])
+	if err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	if err := s.st.DisableProxyTarget(site.ID, target); err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	s.apiTargets(w, r, args)
+}
+
+// ---------------- certificates ----------------
+
+type apiCert struct {
+	Domain    string    `json:"domain"`
+	Lineage   string    `json:"lineage,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	KeyType   string    `json:"key_type,omitempty"`
+	Exists    bool      `json:"exists"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"`
+}
+
+func (s *Server) apiCerts(w http.ResponseWriter, r *http.Request, _ []string) {
+	list, err := s.core.CertList()
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	acc, _ := apiAccessFromCtx(r)
+	out := make([]apiCert, 0, len(list))
+	for _, c := range list {
+		if !s.core.TokenAllowsSite(acc.APITokenLimit, c.Domain) {
+			continue
+		}
+		out = append(out, apiCert{Domain: c.Domain, Lineage: c.Lineage, Source: c.Source, KeyType: c.KeyType,
+			Exists: c.Exists, NotBefore: c.NotBefore, NotAfter: c.NotAfter, DaysLeft: c.DaysLeft})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) apiCertIssue(w http.ResponseWriter, r *http.Request, args []string) {
+	if apiAsync(r) {
+		acc, _ := apiAccessFromCtx(r)
+		j, err := s.core.EnqueueCertIssue(args[0], "token:"+acc.Name)
+		apiJobQueued(w, j, err)
+		return
+	}
+	if err := s.core.CertIssue(r.Context(), args[0], true); err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"domain": args[0], "issued": true})
+}
+
+func (s *Server) apiCertRenew(w http.ResponseWriter, r *http.Request, args []string) {
+	if apiAsync(r) {
+		acc, _ := apiAccessFromCtx(r)
+		j, err := s.core.EnqueueCertRenew(args[0], false, "token:"+acc.Name)
+		apiJobQueued(w, j, err)
+		return
+	}
+	if err := s.core.CertRenew(r.Context(), args[0], false, true); err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"domain": args[0], "renewed": true})
+}
+
+// ---------------- apply ----------------
+
+type apiApplyDomain struct {
+	Domain      string `json:"domain"`
+	Action      string `json:"action"`
+	Status      string `json:"status"`
+	Changed     bool   `json:"changed"`
+	PoolChanged bool   `json:"pool_changed,omitempty"`
+	RenderHash  string `json:"render_hash,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type apiApplyResult struct {
+	RunID       int64            `json:"run_id,omitempty"`
+	Reloaded    bool             `json:"reloaded"`
+	Changed     []string         `json:"changed"`
+	PHPReloaded []string         `json:"php_reloaded,omitempty"`
+	Warning     string           `json:"warning,omitempty"`
+	Domains     []apiApplyDomain `json:"domains"`
+	Error       string           `json:"error,omitempty"`
+}
+
+func toAPIApply(res app.ApplyResult, err error) apiApplyResult {
+	out := apiApplyResult{RunID: res.RunID, Reloaded: res.Reloaded, Changed: res.Changed, PHPReloaded: res.PHPReloaded, Warning: res.Warning}
+	if out.Changed == nil {
+		out.Changed = []string{}
+	}
+	out.Domains = make([]apiApplyDomain, 0, len(res.Domains))
+	for _, d := range res.Domains {
+		out.Domains = append(out.Domains, apiApplyDomain{Domain: d.Domain, Action: d.Action, Status: d.Status, Changed: d.Changed,
+			PoolChanged: d.PoolChanged, RenderHash: d.RenderHash, Error: d.Error})
+	}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return out
+}
+
+// apiApply runs an apply; a failed one answers 422 with its result. It needs a
+// domain or all (a dry run may leave both out); a token limited to some sites must
+// name one of them.
+func (s *Server) apiApply(w http.ResponseWriter, r *http.Request, _ []string) {
+	body := struct {
+		Domain string `json:"domain"`
+		All    bool   `json:"all"`
+		DryRun bool   `json:"dry_run"`
+		Limit  int    `json:"limit"`
+		NoWait bool   `json:"no_wait"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	acc, _ := apiAccessFromCtx(r)
+	if acc.Restricted() {
+		switch {
+		case body.All || strings.TrimSpace(body.Domain) == "":
+			apiError(w, http.StatusForbidden, "token is limited to some sites: apply needs one of them as domain")
+			return
+		case !s.core.TokenAllowsSite(acc.APITokenLimit, body.Domain):
+			apiError(w, http.StatusNotFound, "no such site")
+			return
+		}
+	}
+	if strings.TrimSpace(body.Domain) == "" && !body.All && !body.DryRun {
+		apiError(w, http.StatusBadRequest, "domain is required (or all)")
+		return
+	}
+	if body.All && !body.DryRun && s.core.ApprovalsRequired() {
+		c, err := s.core.RequestApplyAll(body.Limit, "token:"+acc.Name)
+		if err != nil {
+			apiFail(w, err, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, toAPIChange(c))
+		return
+	}
+	if apiAsync(r) && !body.DryRun {
+		j, err := s.core.EnqueueApply(app.ApplyRequest{Domain: body.Domain, All: body.All, Limit: body.Limit, Actor: "token:" + acc.Name})
+		apiJobQueued(w, j, err)
+		return
+	}
+	res, err := s.core.Apply(r.Context(), app.ApplyRequest{
+		Domain: body.Domain,
+		All:    body.All,
+		DryRun: body.DryRun,
+		Limit:  body.Limit,
+		NoWait: body.NoWait,
+		Actor:  "token:" + acc.Name,
+	})
+	switch {
+	case errors.Is(err, app.ErrApplyBusy):
+		apiError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeJSON(w, http.StatusUnprocessableEntity, toAPIApply(res, err))
+	default:
+		writeJSON(w, http.StatusOK, toAPIApply(res, nil))
+	}
+}
+
+// ---------------- jobs ----------------
+
+// apiJob is a background job: POST /certs/{d}/issue|renew and /apply take
+// ?async=true to answer 202 with one instead of waiting; GET /jobs/{id} polls it.
+type apiJob struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Target     string     `json:"target,omitempty"`
+	Status     string     `json:"status"`
+	Step       string     `json:"step,omitempty"`
+	Progress   string     `json:"progress,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	RunID      int64      `json:"run_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func toAPIJob(j app.JobView) apiJob {
+	return apiJob{ID: j.ID, Kind: j.Kind, Target: j.Target, Status: j.Status, Step: j.Step, Progress: j.Progress, Error: j.Error,
+		RunID: j.RunID, CreatedAt: j.CreatedAt, StartedAt: j.StartedAt, FinishedAt: j.FinishedAt}
+}
+
+// apiAsync reports whether the caller asked for a background job (?async=true).
+func apiAsync(r *http.Request) bool {
+	return parseBool(r.URL.Query().Get("async"), false)
+}
+
+func apiJobQueued(w http.ResponseWriter, j store.Job, err error) {
+	if err != nil {
+		apiFail(w, err, http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"jobs/"+strconv.FormatInt(j.ID, 10))
+	writeJSON(w, http.StatusAccepted, toAPIJob(app.JobView{Job: j}))
+}
+
+// apiJob is one job; a token limited to some sites only sees the jobs of those.
+func (s *Server) apiJob(w http.ResponseWriter, r *http.Request, args []string) {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, "invalid job id")
+		return
+	}
+	j, err := s.core.Job(id)
+	acc, _ := apiAccessFromCtx(r)
+	switch {
+	case errors.Is(err, sql.ErrNoRows), err == nil && acc.Restricted() && (j.Target == "" || !s.core.TokenAllowsSite(acc.APITokenLimit, j.Target)):
+		apiError(w, http.StatusNotFound, "no such job")
+	case err != nil:
+		apiFail(w, err, http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, toAPIJob(j))
+	}
+}
+
+// apiChange is a change request held for a second admin (security.approvals); the
+// API answers 202 with it instead of running the operation.
+type apiChange struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Target      string    `json:"target,omitempty"`
+	Status      string    `json:"status"`
+	RequestedBy string    `json:"requested_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func toAPIChange(c store.ChangeRequest) apiChange {
+	return apiChange{ID: c.ID, Kind: c.Kind, Target: c.Target, Status: c.Status,
+		RequestedBy: c.RequestedBy, CreatedAt: c.CreatedAt}
+}
+
+type apiApplyRun struct {
+	ID         int64           `json:"id"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt time.Time       `json:"finished_at"`
+	Request    string          `json:"request"`
+	Actor      string          `json:"actor,omitempty"`
+	DryRun     bool            `json:"dry_run"`
+	Reloaded   bool            `json:"reloaded"`
+	Error      string          `json:"error,omitempty"`
+	Result     *apiApplyResult `json:"result,omitempty"`
+}
+
+func toAPIApplyRun(run store.ApplyRun) apiApplyRun {
+	return apiApplyRun{ID: run.ID, StartedAt: run.StartedAt, FinishedAt: run.FinishedAt, Request: run.Request,
+		Actor: run.Actor, DryRun: run.DryRun, Reloaded: run.Reloaded, Error: run.Error}
+}
+
+func (s *Server) apiApplyRuns(w http.ResponseWriter, r *http.Request, _ []string) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	runs, err := s.core.ApplyRuns(limit)
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]apiApplyRun, 0, len(runs))
+	for _, run := range runs {
+		out = append(out, toAPIApplyRun(run))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) apiApplyRun(w http.ResponseWriter, r *http.Request, args []string) {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		apiError(w, http.StatusBadRequest, "invalid run id")
+		return
+	}
+	run, err := s.core.ApplyRunGet(id)
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := toAPIApplyRun(run.ApplyRun)
+	res := toAPIApply(run.Decoded, nil)
+	out.Result = &res
+	writeJSON(w, http.StatusOK, out)
+}
+
+// ---------------- panel users ----------------
+
+type apiUser struct {
+	ID                 int64      `json:"id"`
+	Username           string     `json:"username"`
+	Role               string     `json:"role"`
+	HostingUser        string     `json:"hosting_user,omitempty"`
+	Enabled            bool       `json:"enabled"`
+	Email              string     `json:"email,omitempty"`
+	EmailVerified      bool       `json:"email_verified"`
+	Language           string     `json:"language,omitempty"`
+	MustChangePassword bool       `json:"must_change_password"`
+	LastLoginAt        *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+func toAPIUser(u store.PanelUser) apiUser {
+	return apiUser{ID: u.ID, Username: u.Username, Role: u.Role, HostingUser: u.HostingUser, Enabled: u.Enabled, Email: u.Email,
+		EmailVerified: u.EmailVerified, Language: u.Language, MustChangePassword: u.MustChangePassword,
+		LastLoginAt: u.LastLoginAt, CreatedAt: u.CreatedAt}
+}
+
+func (s *Server) apiUsers(w http.ResponseWriter, r *http.Request, _ []string) {
+	list, err := s.st.ListPanelUsers()
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	out := make([]apiUser, 0, len(list))
+	for _, u := range list {
+		out = append(out, toAPIUser(u))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// apiUserAdd creates a panel user; an existing username is a conflict (the CLI's
+// panel-user add overwrites, the API does not).
+func (s *Server) apiUserAdd(w http.ResponseWriter, r *http.Request, _ []string) {
+	body := struct {
+		Username    string `json:"username"`
+		Password    string `json:"password"`
+		Role        string `json:"role"`
+		HostingUser string `json:"hosting_user"`
+		Email       string `json:"email"`
+		Language    string `json:"language"`
+		Enabled     *bool  `json:"enabled"`
+		MustChange  bool   `json:"must_change_password"`
+	}{}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	username := strings.TrimSpace(body.Username)
+	email := strings.TrimSpace(body.Email)
+	switch {
+	case username == "":
+		apiError(w, http.StatusBadRequest, "username is required")
+		return
+	case email != "" && !validEmail(email):
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid email %q", email))
+		return
+	}
+	if _, err := s.st.GetPanelUserByUsername(username); err == nil {
+		apiError(w, http.StatusConflict, fmt.Sprintf("panel user %q already exists", username))
+		return
+	}
+	hash, err := s.hashPassword(body.Password)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	role := strings.TrimSpace(body.Role)
+	if role == "" {
+		role = auth.RoleAdmin
+	}
+	if !auth.ValidRole(role) {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid role %q (want %s)", role, strings.Join(auth.Roles, ", ")))
+		return
+	}
+	u, err := s.st.CreatePanelUser(username, hash, role, body.Enabled == nil || *body.Enabled)
+	if err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	if email != "" {
+		_ = s.st.UpdatePanelUserEmail(u.ID, email)
+	}
+	if lang := strings.TrimSpace(body.Language); lang != "" {
+		_ = s.st.UpdatePanelUserLanguage(u.ID, lang)
+	}
+	if body.MustChange {
+		_ = s.st.SetPanelUserMustChangePassword(u.ID, true)
+	}
+	if h := strings.TrimSpace(body.HostingUser); h != "" {
+		_ = s.st.SetPanelUserHostingUser(u.ID, h)
+	}
+	name, _ := apiTokenFromCtx(r)
+	s.core.AuditOwner(u.Username, "info", "auth", "panel user %q (%s) created with api token %q", u.Username, role, name)
+	if u, err = s.st.GetPanelUserByID(u.ID); err != nil {
+		apiFail(w, err, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", apiPrefix+"users")
+	writeJSON(w, http.StatusCreated, toAPIUser(u))
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mynginx/internal/app"
+)
+
+// restrictedCall runs an API handler for a token limited to the user acme.
+func restrictedCall(h func(http.ResponseWriter, *http.Request, []string), body string, args ...string) int {
+	acc := app.APITokenAccess{Name: "reseller", APITokenLimit: app.APITokenLimit{User: "acme"}}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/sites", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), ctxAPIToken, acc))
+	w := httptest.NewRecorder()
+	h(w, r, args)
+	return w.Code
+}
+
+// TestAPIRestrictedWebroot checks that a user-limited token cannot point a site at a
+// webroot of its choosing: the dirs above it would be chowned to the user.
+func TestAPIRestrictedWebroot(t *testing.T) {
+	s := &Server{}
+	if code := restrictedCall(s.apiSiteAdd, `{"domain":"a.example.com","webroot":"/etc/public"}`); code != http.StatusForbidden {
+		t.Errorf("add with webroot: HTTP %d, want 403", code)
+	}
+	if code := restrictedCall(s.apiSiteEdit, `{"webroot":"/etc/public"}`, "a.example.com"); code != http.StatusForbidden {
+		t.Errorf("edit with webroot: HTTP %d, want 403", code)
+	}
+}
+
+// TestAPIRestrictedProxy checks that a user-limited token cannot set up a proxy or
+// its upstream targets, which could point at any address the server reaches.
+func TestAPIRestrictedProxy(t *testing.T) {
+	s := &Server{}
+	for _, c := range []struct {
+		name string
+		h    func(http.ResponseWriter, *http.Request, []string)
+		body string
+		args []string
+	}{
+		{"add proxy", s.apiSiteAdd, `{"domain":"a.example.com","mode":"proxy"}`, nil},
+		{"add targets", s.apiSiteAdd, `{"domain":"a.example.com","proxy_targets":["127.0.0.1:6379"]}`, nil},
+		{"target upsert", s.apiTargetUpsert, `{"target":"127.0.0.1:6379"}`, []string{"a.example.com"}},
+	} {
+		if code := restrictedCall(c.h, c.body, c.args...); code != http.StatusForbidden {
+			t.Errorf("%s: HTTP %d, want 403", c.name, code)
+		}
+	}
+}
+
+// TestApplyNeedsDomain checks that an apply with neither a domain nor all is refused
+// by the panel and the API instead of applying every pending site unapproved.
+func TestApplyNeedsDomain(t *testing.T) {
+	s := &Server{}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/apply", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	s.apiApply(w, r, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("API apply without domain: HTTP %d, want 400", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/ui/apply", strings.NewReader("domain=&all=false"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	s.handleApply(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("panel apply without domain: HTTP %d, want 400", w.Code)
+	}
+}
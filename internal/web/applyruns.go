@@ -0,0 +1,150 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// handleApplyRuns serves /ui/apply/runs: the newest stored apply runs.
+func (s *Server) handleApplyRuns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	runs, err := s.core.ApplyRuns(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Apply Runs", "apply_runs", map[string]any{
+		"Runs": runs,
+	})
+}
+
+// handleApplyRun serves /ui/apply/run?id=N: a stored run rendered like a fresh
+// apply result.
+func (s *Server) handleApplyRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("id")), 10, 64)
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid run id", http.StatusBadRequest)
+		return
+	}
+	run, err := s.core.ApplyRunGet(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Apply Result", "apply_result", map[string]any{
+		"Result": run.Decoded,
+		"Run":    run.ApplyRun,
+		"Error":  run.Error,
+	})
+}
+
+// handleApplyHistory serves /ui/apply/history?domain=d: a site's lines of the newest
+// apply runs, with their status, render hash and error.
+func (s *Server) handleApplyHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	domain := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain")))
+	var runs []store.ApplyRunSite
+	if domain != "" {
+		var err error
+		if runs, err = s.core.SiteApplyHistory(domain, 200); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.render(w, r, "Apply History", "apply_history", map[string]any{
+		"Domain": domain,
+		"Runs":   runs,
+	})
+}
+
+const applyRunsHTML = `{{define "apply_runs"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "apply.runs"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "apply.runs_subtitle"}} <a href="/ui/apply/history">{{t .Lang "history.by_site"}}</a></p>
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "history.run"}}</th>
+        <th>{{t .Lang "events.time"}}</th>
+        <th align="left">{{t .Lang "apply.request"}}</th>
+        <th>{{t .Lang "apply.actor"}}</th>
+        <th>{{t .Lang "apply.reloaded"}}</th>
+        <th align="left">{{t .Lang "col.error"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Runs}}
+      <tr>
+        <td align="center"><a href="/ui/apply/run?id={{.ID}}">#{{.ID}}</a></td>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .StartedAt}}</td>
+        <td><code>{{.Request}}</code></td>
+        <td align="center">{{.Actor}}</td>
+        <td align="center">{{if .Reloaded}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}</td>
+        <td style="white-space:pre-wrap; color:#b00;">{{.Error}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="6" style="opacity:.7;">{{t .Lang "apply.runs_none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
+
+const applyHistoryHTML = `{{define "apply_history"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "history.title"}}{{with .Domain}}: {{.}}{{end}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "history.subtitle"}}</p>
+
+  {{if .Session.Admin}}
+  <form method="get" action="/ui/apply/history" style="margin-bottom:12px;">
+    <input name="domain" value="{{.Domain}}" placeholder="{{t .Lang "col.domain"}}">
+    <button type="submit">{{t .Lang "history.show"}}</button>
+  </form>
+  {{end}}
+
+  {{if .Domain}}
+  <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "history.run"}}</th>
+        <th>{{t .Lang "events.time"}}</th>
+        <th>{{t .Lang "col.action"}}</th>
+        <th>{{t .Lang "col.status"}}</th>
+        <th>{{t .Lang "history.hash"}}</th>
+        <th align="left">{{t .Lang "col.error"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Runs}}
+      <tr>
+        <td align="center">{{if $.Session.Admin}}<a href="/ui/apply/run?id={{.RunID}}">#{{.RunID}}</a>{{else}}#{{.RunID}}{{end}}</td>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+        <td align="center">{{.Action}}</td>
+        <td align="center" style="color:{{if eq .Status "fail"}}#b00{{else}}inherit{{end}};">{{.Status}}</td>
+        <td align="center"><code title="{{.RenderHash}}">{{if gt (len .RenderHash) 12}}{{slice .RenderHash 0 12}}{{else}}{{.RenderHash}}{{end}}</code></td>
+        <td style="white-space:pre-wrap;">{{.Message}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="6" style="opacity:.7;">{{t .Lang "history.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+  {{end}}
+{{end}}`
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"mynginx/internal/app"
+)
+
+// applyStreamPing keeps an idle event stream (and the proxies in front of it) open.
+const applyStreamPing = 15 * time.Second
+
+// handleApplyStream serves /ui/apply/stream: the progress of the applies run by
+// `ngm serve` as Server-Sent Events, a "progress" event per app.ApplyEvent (JSON)
+// until one of them finishes ("done"). The apply form and the job page open it
+// before the apply starts, so a stream may wait for one first.
+func (s *Server) handleApplyStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	events, stop := s.core.WatchApply()
+	defer stop()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx in front: do not buffer the stream
+	w.WriteHeader(http.StatusOK)
+
+	// each write gets its own deadline, past the server-wide write timeout
+	send := func(event string, ev app.ApplyEvent) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(applyStreamPing * 2))
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	// joining a running apply: start from its current step
+	if st := s.core.ApplyStatus(); st.Running {
+		if !send("progress", app.ApplyEvent{At: st.StepAt, Holder: st.Holder, Step: st.Step}) {
+			return
+		}
+	} else if rc.Flush() != nil {
+		return
+	}
+
+	ping := time.NewTicker(applyStreamPing)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		case ev := <-events:
+			if ev.Done {
+				send("done", ev)
+				return
+			}
+			if !send("progress", ev) {
+				return
+			}
+		case <-ping.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(applyStreamPing * 2))
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// applyLiveHTML is the live log of an apply, fed by /ui/apply/stream. The including
+// page calls watchApply() when the apply starts (or is already running).
+const applyLiveHTML = `{{define "apply_live"}}
+  <div id="apply-live" style="display:none; margin-top:14px;">
+    <h3 style="margin:0 0 6px 0;">{{t .Lang "apply.live"}}</h3>
+    <pre id="apply-log" style="max-height:420px; overflow:auto; margin:0; padding:8px; border:1px solid #ccc; border-radius:6px; white-space:pre-wrap;"></pre>
+  </div>
+  <script>
+    function watchApply() {
+      const box = document.getElementById("apply-live"), log = document.getElementById("apply-log");
+      const es = new EventSource("/ui/apply/stream");
+      const line = (ev, text) => {
+        box.style.display = "";
+        log.textContent += new Date(ev.at).toLocaleTimeString() + "  " + text + "\n";
+        log.scrollTop = log.scrollHeight;
+      };
+      es.addEventListener("progress", m => {
+        const ev = JSON.parse(m.data);
+        if (ev.holder) line(ev, "== " + ev.holder);
+        if (ev.domain) line(ev, ev.domain + "  " + ev.action + "  " + ev.status + (ev.error ? "  " + ev.error : ""));
+        else if (ev.status) line(ev, ev.step + ": " + ev.status + (ev.error ? "\n" + ev.error : ""));
+        else if (ev.step && !ev.holder) line(ev, ev.step);
+      });
+      es.addEventListener("done", m => { line(JSON.parse(m.data), "== {{t .Lang "apply.live_done"}}"); es.close(); });
+    }
+  </script>
+{{end}}`
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/store"
+)
+
+// requestChange files a change request (security.approvals) instead of running the
+// operation, then shows where it waits: the approvals page for admins, the
+// activity feed for role=user sessions.
+func (s *Server) requestChange(w http.ResponseWriter, r *http.Request, request func(by string) (store.ChangeRequest, error)) {
+	sess, _ := s.sessionFromCtx(r)
+	if _, err := request(sess.Username); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !sess.Admin() {
+		http.Redirect(w, r, "/ui/activity", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/ui/approvals", http.StatusFound)
+}
+
+// handleApprovals lists the change requests, the pending ones with approve and
+// reject buttons.
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderApprovals(w, r, "")
+}
+
+func (s *Server) renderApprovals(w http.ResponseWriter, r *http.Request, errMsg string) {
+	changes, err := s.core.ChangeRequests(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Approvals", "approvals", map[string]any{
+		"Changes": changes,
+		"Enabled": s.core.ApprovalsRequired(),
+		"Error":   errMsg,
+	})
+}
+
+func (s *Server) handleApprovalApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	sess, _ := s.sessionFromCtx(r)
+	id, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+	c, err := s.core.ApproveChange(r.Context(), id, sess.Username)
+	switch {
+	case err != nil:
+		s.renderApprovals(w, r, err.Error())
+	case c.Status == store.ChangeFailed:
+		s.renderApprovals(w, r, c.Note)
+	default:
+		http.Redirect(w, r, "/ui/approvals", http.StatusFound)
+	}
+}
+
+func (s *Server) handleApprovalReject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	sess, _ := s.sessionFromCtx(r)
+	id, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+	if _, err := s.core.RejectChange(id, sess.Username, r.FormValue("reason")); err != nil {
+		s.renderApprovals(w, r, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/ui/approvals", http.StatusFound)
+}
+
+const approvalsHTML = `{{define "approvals"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "approvals.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{if .Enabled}}{{t .Lang "approvals.subtitle"}}{{else}}{{t .Lang "approvals.disabled"}}{{end}}</p>
+  {{if .Error}}<pre style="color:#b00; white-space:pre-wrap;">{{.Error}}</pre>{{end}}
+
+  {{if not .Changes}}
+    <p style="opacity:.7;">{{t .Lang "approvals.none"}}</p>
+  {{else}}
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>#</th>
+        <th align="left">{{t .Lang "approvals.change"}}</th>
+        <th>{{t .Lang "approvals.requested"}}</th>
+        <th>{{t .Lang "approvals.status"}}</th>
+        <th>{{t .Lang "approvals.decided"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Changes}}
+      <tr>
+        <td align="center">{{.ID}}</td>
+        <td>{{t $.Lang (printf "approvals.kind.%s" .Kind)}} <code>{{if .Target}}{{.Target}}{{else}}{{t $.Lang "approvals.all_sites"}}{{end}}</code>{{if .Params}} <span style="opacity:.7;">{{.Params}}</span>{{end}}</td>
+        <td align="center" style="white-space:nowrap;">{{.RequestedBy}}<br><span style="opacity:.7;">{{fmtTime $.Lang .CreatedAt}}</span></td>
+        <td align="center">{{.Status}}{{if .Note}}<br><span style="opacity:.7;">{{.Note}}</span>{{end}}</td>
+        <td align="center" style="white-space:nowrap;">{{if .DecidedBy}}{{.DecidedBy}}<br><span style="opacity:.7;">{{fmtTime $.Lang .DecidedAt}}</span>{{end}}</td>
+        <td align="center" style="white-space:nowrap;">
+          {{if eq .Status "pending"}}
+          {{if ne .RequestedBy $.Session.Username}}
+          <form method="post" action="/ui/approvals/approve" style="display:inline;" onsubmit="return confirm('{{t $.Lang "approvals.approve_confirm" .ID}}');">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="id" value="{{.ID}}">
+            <button>{{t $.Lang "approvals.approve"}}</button>
+          </form>
+          {{end}}
+          <form method="post" action="/ui/approvals/reject" style="display:inline;">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="id" value="{{.ID}}">
+            <input name="reason" placeholder="{{t $.Lang "approvals.reason"}}" style="padding:2px; width:120px;">
+            <button>{{if eq .RequestedBy $.Session.Username}}{{t $.Lang "approvals.withdraw"}}{{else}}{{t $.Lang "approvals.reject"}}{{end}}</button>
+          </form>
+          {{end}}
+        </td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+  {{end}}
+{{end}}`
@@ -0,0 +1,262 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/app"
+	"mynginx/internal/store"
+)
+
+// ctxAudit carries the *auditActor of a mutating request, filled in by the auth layers.
+const ctxAudit ctxKey = 3
+
+// auditMaxBody is the largest form or JSON body whose fields are recorded.
+const auditMaxBody = 1 << 20
+
+// auditActor is who a request turned out to be, once requireAuth or the API's token
+// check has run ("" = unauthenticated: not recorded).
+type auditActor struct {
+	name string
+}
+
+// setAuditActor names the actor of r for its audit entry.
+func setAuditActor(r *http.Request, name string) {
+	if a, ok := r.Context().Value(ctxAudit).(*auditActor); ok {
+		a.name = name
+	}
+}
+
+// audit records every authenticated POST/PUT/PATCH/DELETE to the panel and the API
+// in the audit trail: the form or JSON fields (secrets redacted), the domain it acts
+// on with the site settings it changed, and whether it failed (status >= 400).
+func (s *Server) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		via := "ui"
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			via = "api"
+		} else if !strings.HasPrefix(r.URL.Path, "/ui/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		params := auditParams(r)
+		target := params["domain"]
+		if via == "api" {
+			if parts := apiPath(r.URL.Path); len(parts) > 1 && (parts[0] == "sites" || parts[0] == "certs") {
+				target = parts[1]
+			}
+		}
+		act := s.core.StartAudit(via, r.Method+" "+r.URL.Path, target)
+
+		actor := &auditActor{}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), ctxAudit, actor)))
+		if actor.name == "" {
+			return
+		}
+		act.Actor, act.Remote, act.Params = actor.name, remoteHost(r), params
+		var err error
+		if rec.code >= 400 {
+			err = fmt.Errorf("HTTP %d", rec.code)
+		}
+		s.core.FinishAudit(act, err)
+	})
+}
+
+// auditSecretFields are the fields of a path whose values are never recorded, on
+// top of those app.AuditParam redacts by name: passwords posted as "current" or
+// "confirm", setup codes, reset tokens and deploy repository URLs.
+var auditSecretFields = map[string][]string{
+	"/ui/login":            {"password"},
+	"/ui/setup":            {"password", "confirm", "code"},
+	"/ui/password/reset":   {"password", "confirm", "token"},
+	"/ui/password/change":  {"current", "password", "confirm"},
+	"/ui/profile/password": {"current", "password", "confirm"},
+	reauthPath:             {"password"},
+	"/ui/users/create":     {"password"},
+	"/ui/sites/deploy":     {"repo"},
+}
+
+// auditParams reads the fields of a form or JSON body (and the query string) for
+// the audit entry, leaving r.Body as it was. Form plumbing (CSRF, idempotency keys)
+// is left out.
+func auditParams(r *http.Request) map[string]string {
+	out := map[string]string{}
+	add := func(k, v string) {
+		switch k {
+		case "csrf", "csrf_token", "idempotency_key":
+			return
+		}
+		if slices.Contains(auditSecretFields[r.URL.Path], k) && v != "" {
+			out[k] = "[redacted]"
+			return
+		}
+		out[k] = app.AuditParam(k, v)
+	}
+	for k, vs := range r.URL.Query() {
+		add(k, strings.Join(vs, ","))
+	}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Body == nil || r.ContentLength > auditMaxBody || (ct != "application/x-www-form-urlencoded" && ct != "application/json") {
+		return out
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, auditMaxBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil || len(body) > auditMaxBody {
+		return out
+	}
+	if ct == "application/json" {
+		var fields map[string]any
+		if json.Unmarshal(body, &fields) == nil {
+			for k, v := range fields {
+				if str, ok := v.(string); ok {
+					add(k, str)
+				} else if b, err := json.Marshal(v); err == nil {
+					add(k, string(b))
+				}
+			}
+		}
+		return out
+	}
+	if form, err := url.ParseQuery(string(body)); err == nil {
+		for k, vs := range form {
+			add(k, strings.Join(vs, ","))
+		}
+	}
+	return out
+}
+
+// handleAudit serves /ui/audit: the audit trail, filtered by actor, domain and channel.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := store.AuditQuery{
+		Actor:  strings.TrimSpace(r.URL.Query().Get("actor")),
+		Target: strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain"))),
+		Via:    strings.TrimSpace(r.URL.Query().Get("via")),
+		Limit:  200,
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+		q.Limit = n
+	}
+	entries, err := s.core.AuditEntries(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rows := make([]auditRow, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, newAuditRow(e))
+	}
+	s.render(w, r, "Audit", "audit", map[string]any{
+		"Query":   q,
+		"Entries": rows,
+	})
+}
+
+// auditRow is an audit entry with its JSON columns decoded for the page.
+type auditRow struct {
+	store.AuditEntry
+	Params  []auditField
+	Changes []auditField
+}
+
+type auditField struct {
+	Name, Old, New string
+}
+
+func newAuditRow(e store.AuditEntry) auditRow {
+	row := auditRow{AuditEntry: e}
+	var params, old, cur map[string]string
+	_ = json.Unmarshal([]byte(e.Params), &params)
+	_ = json.Unmarshal([]byte(e.Old), &old)
+	_ = json.Unmarshal([]byte(e.New), &cur)
+	for _, k := range sortedKeys(params) {
+		row.Params = append(row.Params, auditField{Name: k, New: params[k]})
+	}
+	seen := map[string]bool{}
+	for _, m := range []map[string]string{old, cur} {
+		for _, k := range sortedKeys(m) {
+			if !seen[k] {
+				seen[k] = true
+				row.Changes = append(row.Changes, auditField{Name: k, Old: old[k], New: cur[k]})
+			}
+		}
+	}
+	return row
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const auditHTML = `{{define "audit"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "audit.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "audit.subtitle"}}</p>
+
+  <form method="get" action="/ui/audit" style="margin-bottom:12px;">
+    <input name="actor" value="{{.Query.Actor}}" placeholder="{{t .Lang "audit.actor"}}">
+    <input name="domain" value="{{.Query.Target}}" placeholder="{{t .Lang "col.domain"}}">
+    <select name="via">
+      <option value="">{{t .Lang "audit.via_any"}}</option>
+      <option value="cli"{{if eq .Query.Via "cli"}} selected{{end}}>cli</option>
+      <option value="ui"{{if eq .Query.Via "ui"}} selected{{end}}>ui</option>
+      <option value="api"{{if eq .Query.Via "api"}} selected{{end}}>api</option>
+    </select>
+    <button type="submit">{{t .Lang "audit.filter"}}</button>
+  </form>
+
+  {{if not .Entries}}
+    <p style="opacity:.7;">{{t .Lang "audit.none"}}</p>
+  {{else}}
+  <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "audit.when"}}</th>
+        <th>{{t .Lang "audit.actor"}}</th>
+        <th align="left">{{t .Lang "audit.action"}}</th>
+        <th>{{t .Lang "col.domain"}}</th>
+        <th align="left">{{t .Lang "audit.changes"}}</th>
+        <th>{{t .Lang "jobs.status"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Entries}}
+      <tr>
+        <td style="white-space:nowrap;">{{fmtTime $.Lang .At}}</td>
+        <td align="center">{{.Actor}}<br><span style="opacity:.7;">{{.Via}}{{with .Remote}} {{.}}{{end}}</span></td>
+        <td><code>{{.Action}}</code>
+          {{with .Params}}<details><summary style="opacity:.7;">{{t $.Lang "audit.params"}}</summary>{{range .}}<code>{{.Name}}</code>={{.New}}<br>{{end}}</details>{{end}}</td>
+        <td align="center">{{with .Target}}<a href="/ui/audit?domain={{.}}">{{.}}</a>{{end}}</td>
+        <td>{{range .Changes}}<code>{{.Name}}</code>: <span style="color:#b00;">{{.Old}}</span> &rarr; <span style="color:#070;">{{.New}}</span><br>{{end}}</td>
+        <td align="center">{{.Status}}{{with .Error}}<br><span style="color:#b00;">{{.}}</span>{{end}}</td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+  {{end}}
+{{end}}`
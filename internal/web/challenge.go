@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleCertChallenge serves POST /ui/cert/challenge: puts a token in the ACME
+// webroot, fetches it through the site's public URL and shows what came back.
+func (s *Server) handleCertChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	rep, err := s.core.CertChallengeTest(ctx, d)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "ACME challenge", "cert_challenge", map[string]any{"Report": rep, "OK": rep.OK()})
+}
+
+const certChallengeHTML = `{{define "cert_challenge"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "challenge.title" .Report.Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "challenge.subtitle"}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Report.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/certs">{{t .Lang "common.back_certs"}}</a>
+  </p>
+
+  {{if .Report.Problem}}
+    <p style="color:#b00;">{{.Report.Problem}}</p>
+  {{else}}
+    <p>{{t .Lang "challenge.url"}} <code>{{.Report.URL}}</code></p>
+    {{if .OK}}
+      <p style="padding:8px; border:1px solid #9c9; background:#efe;">{{t .Lang "challenge.ok"}}</p>
+    {{else}}
+      <p style="padding:8px; border:1px solid #c99; background:#fee;">{{t .Lang "challenge.fail"}}</p>
+    {{end}}
+    <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+      <tr>
+        <th align="left">{{t .Lang "challenge.addr"}}</th>
+        <th align="left">{{t .Lang "challenge.redirects"}}</th>
+        <th>{{t .Lang "challenge.status"}}</th>
+        <th align="left">{{t .Lang "challenge.result"}}</th>
+      </tr>
+      {{range .Report.Probes}}
+      <tr>
+        <td style="white-space:nowrap;"><code>{{.Addr}}</code></td>
+        <td>{{range .Hops}}<div><code style="word-break:break-all;">{{.}}</code></div>{{else}}-{{end}}</td>
+        <td align="center">{{if .Status}}{{.Status}}{{else}}-{{end}}</td>
+        <td>{{if .OK}}<b style="color:#2a2;">OK</b>{{else}}<span style="color:#b00;">{{.Problem}}</span>
+          {{if .Body}}<pre style="margin:6px 0 0; white-space:pre-wrap; word-break:break-all; opacity:.7;">{{.Body}}</pre>{{end}}{{end}}</td>
+      </tr>
+      {{end}}
+    </table>
+  {{end}}
+
+  <form method="post" action="/ui/cert/challenge" style="margin-top:12px;">
+    <input type="hidden" name="domain" value="{{.Report.Domain}}">
+    <button>{{t .Lang "challenge.retest"}}</button>
+  </form>
+{{end}}`
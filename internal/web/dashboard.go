@@ -0,0 +1,111 @@
+package web
+
+import "net/http"
+
+// handleDashboard serves /ui/dashboard: sites by state, certificates running out,
+// the last apply, nginx and the failures of the last day on one page.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d, err := s.core.Dashboard(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Dashboard", "dashboard", map[string]any{
+		"Dash": d,
+	})
+}
+
+const dashboardHTML = `{{define "dashboard"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "dash.title"}}</h2>
+
+  <div style="display:grid; grid-template-columns: repeat(auto-fit, minmax(220px, 1fr)); gap:12px; margin-bottom:18px;">
+    <div style="border:1px solid #ccc; border-radius:6px; padding:12px;">
+      <b>{{t .Lang "menu.sites"}}: {{.Dash.Sites.Total}}</b>
+      <div style="margin-top:6px;">
+        {{t .Lang "state.OK"}}: {{.Dash.Sites.OK}}<br>
+        <span style="color:{{if .Dash.Sites.Pending}}#b60{{else}}inherit{{end}};">{{t .Lang "state.PENDING"}}: {{.Dash.Sites.Pending}}</span><br>
+        <span style="color:{{if .Dash.Sites.Error}}#b00{{else}}inherit{{end}};">{{t .Lang "state.ERROR"}}: {{.Dash.Sites.Error}}</span><br>
+        {{t .Lang "state.DISABLED"}}: {{.Dash.Sites.Disabled}}
+      </div>
+      <div style="margin-top:6px;"><a href="/ui/sites">{{t .Lang "dash.open"}}</a></div>
+    </div>
+
+    <div style="border:1px solid #ccc; border-radius:6px; padding:12px;">
+      <b>{{t .Lang "menu.certs"}}</b>
+      <div style="margin-top:6px;">
+        <span style="color:{{if .Dash.Expiring7}}#b00{{else}}inherit{{end}};">{{t .Lang "dash.expiring" 7}}: {{.Dash.Expiring7}}</span><br>
+        <span style="color:{{if .Dash.Expiring}}#b60{{else}}inherit{{end}};">{{t .Lang "dash.expiring" 30}}: {{len .Dash.Expiring}}</span>
+      </div>
+      <div style="margin-top:6px;"><a href="/ui/certs">{{t .Lang "dash.open"}}</a></div>
+    </div>
+
+    <div style="border:1px solid #ccc; border-radius:6px; padding:12px;">
+      <b>{{t .Lang "dash.last_apply"}}</b>
+      <div style="margin-top:6px;">
+      {{with .Dash.LastApply}}
+        <a href="/ui/apply/run?id={{.ID}}">#{{.ID}}</a> {{fmtTime $.Lang .StartedAt}}<br>
+        <code>{{.Request}}</code> &middot; {{.Actor}}<br>
+        {{if .Error}}<span style="color:#b00; white-space:pre-wrap;">{{.Error}}</span>{{else}}<span style="color:#070;">{{t $.Lang "dash.apply_ok"}}</span>{{end}}
+      {{else}}
+        <span style="opacity:.7;">{{t .Lang "apply.runs_none"}}</span>
+      {{end}}
+      </div>
+      <div style="margin-top:6px;"><a href="/ui/apply/runs">{{t .Lang "dash.open"}}</a></div>
+    </div>
+
+    <div style="border:1px solid #ccc; border-radius:6px; padding:12px;">
+      <b>nginx</b>
+      <div style="margin-top:6px;">
+        {{if .Dash.Nginx.Running}}<span style="color:#070;">{{t .Lang "dash.nginx_running"}}</span>{{else}}<span style="color:#b00;">{{t .Lang "dash.nginx_down"}}</span>{{end}}<br>
+        {{with .Dash.NginxVersion}}<code>{{.}}</code><br>{{end}}
+        {{with .Dash.NginxUptime}}{{t $.Lang "dash.uptime"}}: {{.}}{{end}}
+      </div>
+      <div style="margin-top:6px;"><a href="/ui/events?source=nginx">{{t .Lang "menu.events"}}</a></div>
+    </div>
+  </div>
+
+  {{if .Dash.Expiring}}
+  <h3>{{t .Lang "dash.expiring" 30}}</h3>
+  <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; margin-bottom:18px;">
+    <thead><tr><th align="left">{{t .Lang "col.domain"}}</th><th>{{t .Lang "dash.not_after"}}</th><th>{{t .Lang "certs.days"}}</th></tr></thead>
+    <tbody>
+    {{range .Dash.Expiring}}
+      <tr>
+        <td><a href="/ui/cert/info?domain={{.Domain}}">{{.Domain}}</a></td>
+        <td align="center">{{fmtTime $.Lang .NotAfter}}</td>
+        <td align="center" style="color:{{if le .DaysLeft 7}}#b00{{else}}#b60{{end}};">{{.DaysLeft}}</td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+  {{end}}
+
+  <h3>{{t .Lang "dash.failures"}}</h3>
+  {{if or .Dash.FailedSites .Dash.Failures}}
+  <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <tbody>
+    {{range .Dash.FailedSites}}
+      <tr>
+        <td style="white-space:nowrap;">{{with .LastAppliedAt}}{{fmtTime $.Lang .}}{{end}}</td>
+        <td align="center" style="color:#b00;">{{t $.Lang "state.ERROR"}}</td>
+        <td><a href="/ui/sites/edit?domain={{.Domain}}">{{.Domain}}</a>: <span style="white-space:pre-wrap;">{{.LastApplyError}}</span></td>
+      </tr>
+    {{end}}
+    {{range .Dash.Failures}}
+      <tr>
+        <td style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+        <td align="center">{{.Source}}</td>
+        <td style="white-space:pre-wrap;">{{.Message}}</td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+  <p><a href="/ui/events">{{t .Lang "menu.events"}}</a></p>
+  {{else}}
+  <p style="opacity:.7;">{{t .Lang "dash.no_failures"}}</p>
+  {{end}}
+{{end}}`
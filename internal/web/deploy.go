@@ -0,0 +1,252 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mynginx/internal/app"
+)
+
+// deployHookPrefix is where /api/v1/sites/{domain}/deploy is routed.
+const deployHookPrefix = "/api/v1/sites/"
+
+// deployLogRows is how many runs the deploy page shows.
+const deployLogRows = 30
+
+// handleDeployHook accepts GitHub and GitLab push webhooks for a site. The delivery
+// authenticates itself (HMAC signature or token, per site), so there is no session
+// or API token; anything that does not verify gets the same 403.
+func (s *Server) handleDeployHook(w http.ResponseWriter, r *http.Request) {
+	domain, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, deployHookPrefix), "/")
+	if domain == "" || rest != "deploy" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	hook := app.DeployHook{
+		Event:     r.Header.Get("X-GitHub-Event"),
+		Signature: r.Header.Get("X-Hub-Signature-256"),
+		Token:     r.Header.Get("X-Gitlab-Token"),
+		Body:      body,
+	}
+	if hook.Event == "" {
+		hook.Event = r.Header.Get("X-Gitlab-Event")
+	}
+
+	started, msg, err := s.core.DeployWebhook(domain, hook)
+	var ve *app.ValidationError
+	switch {
+	case errors.Is(err, app.ErrDeployDenied):
+		log.Printf("deploy webhook for %q from %s denied", domain, remoteHost(r))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	case errors.As(err, &ve):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if started {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"deploying": started, "message": msg})
+}
+
+// handleSiteDeploy shows the git deploy of a site (GET) and saves, rotates or turns
+// it off (POST action=save|rotate|off). Like token creation it is not wrapped in
+// idempotent(): save and rotate answer with the webhook secret.
+func (s *Server) handleSiteDeploy(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderSiteDeploy(w, r, strings.TrimSpace(r.URL.Query().Get("domain")), map[string]any{})
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	data := map[string]any{}
+	var err error
+	switch r.FormValue("action") {
+	case "save":
+		prev := ""
+		if old, gerr := s.core.SiteDeploy(domain); gerr == nil {
+			prev = old.Secret
+		}
+		dep, serr := s.core.SiteDeploySet(domain, r.FormValue("repo"), r.FormValue("branch"))
+		if err = serr; err == nil && dep.Secret != prev {
+			data["Secret"] = dep.Secret
+		}
+	case "rotate":
+		dep, rerr := s.core.SiteDeployRotate(domain)
+		if err = rerr; err == nil {
+			data["Secret"] = dep.Secret
+		}
+	case "off":
+		err = s.core.SiteDeployOff(domain)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if !deployFormError(w, err, data) {
+		return
+	}
+	s.renderSiteDeploy(w, r, domain, data)
+}
+
+// handleSiteDeployRun deploys the configured branch now and shows the run.
+func (s *Server) handleSiteDeployRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+	run, err := s.core.Deploy(ctx, domain, "ui")
+	data := map[string]any{}
+	if run.ID > 0 {
+		data["Run"] = run
+	}
+	if !deployFormError(w, err, data) {
+		return
+	}
+	s.renderSiteDeploy(w, r, domain, data)
+}
+
+// deployFormError puts a user error into data for the page; other errors are
+// answered here (false: nothing more to render).
+func deployFormError(w http.ResponseWriter, err error, data map[string]any) bool {
+	var ve *app.ValidationError
+	switch {
+	case err == nil:
+	case errors.As(err, &ve), data["Run"] != nil:
+		data["Error"] = err.Error()
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func (s *Server) renderSiteDeploy(w http.ResponseWriter, r *http.Request, domain string, data map[string]any) {
+	site, err := s.st.GetSiteByDomain(strings.ToLower(domain))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if dep, err := s.core.SiteDeploy(site.Domain); err == nil {
+		data["Deploy"] = dep
+	}
+	runs, err := s.core.DeployRuns(site.Domain, deployLogRows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data["Domain"] = site.Domain
+	data["Webroot"] = site.Webroot
+	data["HookURL"] = s.core.DeployWebhookURL(site.Domain)
+	data["Runs"] = runs
+	s.render(w, r, "Git deploy", "site_deploy", data)
+}
+
+const siteDeployHTML = `{{define "site_deploy"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "deploy.title" .Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "deploy.subtitle" .Webroot}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <form method="post" action="/ui/sites/deploy" style="margin:10px 0;">
+    <input type="hidden" name="domain" value="{{.Domain}}">
+    <input type="hidden" name="action" value="save">
+    <label>{{t .Lang "deploy.repo"}} <input name="repo" size="50" value="{{with .Deploy}}{{.Repo}}{{end}}" placeholder="https://github.com/org/site.git" style="font-family:monospace;"></label>
+    <label>{{t .Lang "deploy.branch"}} <input name="branch" size="16" value="{{with .Deploy}}{{.Branch}}{{else}}main{{end}}" style="font-family:monospace;"></label>
+    <button>{{t .Lang "deploy.save"}}</button>
+  </form>
+
+  {{with .Deploy}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; margin:10px 0;">
+      <tr><th align="left">{{t $.Lang "deploy.webhook"}}</th><td><code>{{$.HookURL}}</code></td></tr>
+      <tr><th align="left">{{t $.Lang "deploy.secret"}}</th><td>
+        {{if $.Secret}}<code>{{$.Secret}}</code><br><b>{{t $.Lang "deploy.secret_once"}}</b>{{else}}{{t $.Lang "deploy.secret_hidden"}}{{end}}
+      </td></tr>
+    </table>
+    <p style="opacity:.8;">{{t $.Lang "deploy.howto"}}</p>
+    <div style="display:flex; gap:8px; margin:10px 0;">
+      <form method="post" action="/ui/sites/deploy/run">
+        <input type="hidden" name="domain" value="{{$.Domain}}">
+        <button>{{t $.Lang "deploy.run"}}</button>
+      </form>
+      <form method="post" action="/ui/sites/deploy">
+        <input type="hidden" name="domain" value="{{$.Domain}}">
+        <input type="hidden" name="action" value="rotate">
+        <button>{{t $.Lang "deploy.rotate"}}</button>
+      </form>
+      <form method="post" action="/ui/sites/deploy">
+        <input type="hidden" name="domain" value="{{$.Domain}}">
+        <input type="hidden" name="action" value="off">
+        <button>{{t $.Lang "deploy.off"}}</button>
+      </form>
+    </div>
+  {{else}}
+    <p>{{t .Lang "deploy.not_set"}}</p>
+  {{end}}
+
+  <h3>{{t .Lang "deploy.log"}}</h3>
+  {{if .Runs}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+      <thead>
+        <tr>
+          <th>{{t .Lang "events.time"}}</th>
+          <th>{{t .Lang "deploy.trigger"}}</th>
+          <th>{{t .Lang "deploy.ref"}}</th>
+          <th>{{t .Lang "deploy.commit"}}</th>
+          <th>{{t .Lang "col.status"}}</th>
+          <th align="left">{{t .Lang "deploy.output"}}</th>
+        </tr>
+      </thead>
+      <tbody>
+      {{range .Runs}}
+        <tr>
+          <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .StartedAt}}</td>
+          <td align="center">{{.Trigger}}</td>
+          <td><code>{{.Ref}}</code></td>
+          <td align="center">{{with .Commit}}<code title="{{.}}">{{printf "%.12s" .}}</code>{{end}}</td>
+          <td align="center"{{if eq .Status "fail"}} style="color:#b00;"{{end}}>{{.Status}}</td>
+          <td>{{if .Output}}<details{{if and $.Run (eq $.Run.ID .ID)}} open{{end}}><summary>{{t $.Lang "deploy.output"}}</summary><pre style="white-space:pre-wrap; margin:0;">{{.Output}}</pre></details>{{end}}</td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+  {{else}}
+    <p style="opacity:.8;">{{t .Lang "deploy.no_runs"}}</p>
+  {{end}}
+{{end}}`
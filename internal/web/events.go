@@ -0,0 +1,157 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	source := strings.TrimSpace(r.URL.Query().Get("source"))
+	events, err := s.core.Events(source, 200)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Events", "events", map[string]any{
+		"Events": events,
+		"Source": source,
+	})
+}
+
+// handleActivity serves /ui/activity?user=u: the activity feed of a hosting user
+// (a role=user session always sees its own).
+func (s *Server) handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := strings.TrimSpace(r.URL.Query().Get("user"))
+	if sess, _ := s.sessionFromCtx(r); !sess.Admin() {
+		user = sess.Owner
+	}
+	entries, err := s.core.OwnerActivity(user, 200)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Activity", "activity", map[string]any{
+		"User":    user,
+		"Entries": entries,
+	})
+}
+
+// handleNginxControl serves /ui/nginx/start and /ui/nginx/restart.
+func (s *Server) handleNginxControl(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var err error
+	switch strings.TrimPrefix(r.URL.Path, "/ui/nginx/") {
+	case "start":
+		err = s.core.NginxStart(r.Context())
+	case "restart":
+		err = s.core.NginxRestart(r.Context())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/ui/events?source=nginx", http.StatusFound)
+}
+
+const nginxBannerHTML = `{{define "nginx_banner"}}
+  <div style="margin-bottom:16px; padding:12px 14px; border:2px solid #b00; border-radius:6px; background:#fee;">
+    <b style="color:#b00;">{{t .Lang "nginx.down" (fmtTime .Lang .Nginx.DownSince)}}</b>
+    {{if .Nginx.LastError}}<div style="margin-top:6px; font-size:.9em; white-space:pre-wrap;">{{.Nginx.LastError}}</div>{{end}}
+    {{if not .Nginx.NextRetry.IsZero}}<div style="margin-top:6px; font-size:.9em;">{{t .Lang "nginx.next_retry" (fmtTime .Lang .Nginx.NextRetry)}}</div>{{end}}
+    <div style="margin-top:8px;">
+      <form method="post" action="/ui/nginx/start" style="display:inline;">
+        <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+        <button>{{t .Lang "nginx.start"}}</button>
+      </form>
+      <form method="post" action="/ui/nginx/restart" style="display:inline; margin-left:6px;"
+            onsubmit="return confirm('{{t .Lang "confirm.nginx_restart"}}');">
+        <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+        <button>{{t .Lang "nginx.restart"}}</button>
+      </form>
+      <a href="/ui/events?source=nginx" style="margin-left:10px;">{{t .Lang "menu.events"}}</a>
+    </div>
+  </div>
+{{end}}`
+
+const eventsHTML = `{{define "events"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "events.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "events.subtitle"}}</p>
+
+  <form method="get" action="/ui/events" style="margin-bottom:12px;">
+    <label>{{t .Lang "events.source"}}</label>
+    <input name="source" value="{{.Source}}" placeholder="nginx" style="padding:4px;">
+    <button>{{t .Lang "events.filter"}}</button>
+    {{if .Source}}<a href="/ui/events" style="margin-left:8px;">{{t .Lang "events.all"}}</a>{{end}}
+  </form>
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "events.time"}}</th>
+        <th>{{t .Lang "events.level"}}</th>
+        <th>{{t .Lang "events.source"}}</th>
+        <th align="left">{{t .Lang "events.message"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Events}}
+      <tr>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+        <td align="center" style="color:{{if eq .Level "error"}}#b00{{else if eq .Level "warn"}}#b60{{else}}inherit{{end}};">{{.Level}}</td>
+        <td align="center"><a href="/ui/events?source={{.Source}}">{{.Source}}</a></td>
+        <td style="white-space:pre-wrap;">{{.Message}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="4" style="opacity:.7;">{{t .Lang "events.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
+
+const activityHTML = `{{define "activity"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "activity.title" .User}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "activity.subtitle"}}</p>
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "events.time"}}</th>
+        <th>{{t .Lang "col.domain"}}</th>
+        <th>{{t .Lang "events.source"}}</th>
+        <th align="left">{{t .Lang "events.message"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Entries}}
+      <tr>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .Time}}</td>
+        <td align="center">{{if .Domain}}<a href="/ui/sites/edit?domain={{.Domain}}">{{.Domain}}</a>{{else}}-{{end}}</td>
+        <td align="center">{{.Source}}</td>
+        <td style="white-space:pre-wrap; color:{{if eq .Level "error"}}#b00{{else if or (eq .Level "warn") (eq .Level "warning")}}#b60{{else}}inherit{{end}};">{{.Message}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="4" style="opacity:.7;">{{t .Lang "activity.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
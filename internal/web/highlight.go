@@ -0,0 +1,91 @@
+package web
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// highlightNginx renders nginx config as HTML with spans for comments (c),
+// directives (d), quoted strings (s) and variables (v); see siteConfigHTML for
+// the colors.
+func highlightNginx(src []byte) template.HTML {
+	var b strings.Builder
+	span := func(class, text string) {
+		b.WriteString(`<span class="`)
+		b.WriteString(class)
+		b.WriteString(`">`)
+		b.WriteString(html.EscapeString(text))
+		b.WriteString(`</span>`)
+	}
+
+	stmtStart := true // next word is a directive name
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		i := 0
+		for i < len(line) {
+			c := line[i]
+			switch {
+			case c == '#':
+				rest := strings.TrimRight(line[i:], "\n")
+				span("c", rest)
+				i += len(rest)
+			case c == '"' || c == '\'':
+				j := i + 1
+				for j < len(line) && line[j] != c {
+					if line[j] == '\\' {
+						j++
+					}
+					j++
+				}
+				if j >= len(line) {
+					j = len(line) - 1
+				}
+				span("s", line[i:j+1])
+				i = j + 1
+				stmtStart = false
+			case c == '$':
+				j := i + 1
+				if j < len(line) && line[j] == '{' {
+					for j < len(line) && line[j] != '}' {
+						j++
+					}
+					j++
+				} else {
+					for j < len(line) && isVarChar(line[j]) {
+						j++
+					}
+				}
+				if j > len(line) {
+					j = len(line)
+				}
+				span("v", line[i:j])
+				i = j
+				stmtStart = false
+			case c == ';' || c == '{' || c == '}':
+				b.WriteByte(c)
+				i++
+				stmtStart = true
+			case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+				b.WriteByte(c)
+				i++
+			default:
+				j := i
+				for j < len(line) && !strings.ContainsRune(" \t\r\n;{}\"'$", rune(line[j])) {
+					j++
+				}
+				if stmtStart {
+					span("d", line[i:j])
+					stmtStart = false
+				} else {
+					b.WriteString(html.EscapeString(line[i:j]))
+				}
+				i = j
+			}
+		}
+	}
+	return template.HTML(b.String())
+}
+
+func isVarChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// Locale is one UI language loaded from locales/<code>.json.
+// Keys starting with "_" are formatting settings, not UI strings.
+type Locale struct {
+	Code    string
+	Name    string
+	Strings map[string]string
+
+	DateFormat   string // Go layout, e.g. "2006-01-02 15:04"
+	DecimalSep   string
+	ThousandsSep string
+}
+
+// Catalog holds all known locales and the fallback language.
+type Catalog struct {
+	locales  map[string]*Locale
+	fallback string
+}
+
+func loadCatalog(fallback string) (*Catalog, error) {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("read locales: %w", err)
+	}
+	c := &Catalog{locales: map[string]*Locale{}, fallback: "en"}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		b, err := localeFS.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read locale %s: %w", e.Name(), err)
+		}
+		raw := map[string]string{}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, fmt.Errorf("parse locale %s: %w", e.Name(), err)
+		}
+		code := strings.TrimSuffix(e.Name(), ".json")
+		loc := &Locale{
+			Code:         code,
+			Name:         raw["_name"],
+			Strings:      raw,
+			DateFormat:   raw["_date_format"],
+			DecimalSep:   raw["_decimal_sep"],
+			ThousandsSep: raw["_thousands_sep"],
+		}
+		if loc.Name == "" {
+			loc.Name = code
+		}
+		if loc.DateFormat == "" {
+			loc.DateFormat = "2006-01-02 15:04"
+		}
+		if loc.DecimalSep == "" {
+			loc.DecimalSep = "."
+		}
+		c.locales[code] = loc
+	}
+	if _, ok := c.locales["en"]; !ok {
+		return nil, fmt.Errorf("locales: en.json is required")
+	}
+	if _, ok := c.locales[fallback]; ok {
+		c.fallback = fallback
+	}
+	return c, nil
+}
+
+// Has reports whether lang is a known locale code.
+func (c *Catalog) Has(lang string) bool {
+	_, ok := c.locales[lang]
+	return ok
+}
+
+// Languages returns the known locales sorted by code (for language pickers).
+func (c *Catalog) Languages() []*Locale {
+	out := make([]*Locale, 0, len(c.locales))
+	for _, l := range c.locales {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+func (c *Catalog) locale(lang string) *Locale {
+	if l, ok := c.locales[lang]; ok {
+		return l
+	}
+	return c.locales[c.fallback]
+}
+
+// T translates key for lang, falling back to English and finally to the key itself.
+// Extra args are applied with fmt.Sprintf when present.
+func (c *Catalog) T(lang, key string, args ...any) string {
+	msg, ok := c.locale(lang).Strings[key]
+	if !ok {
+		if msg, ok = c.locales["en"].Strings[key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// FormatTime formats time.Time / *time.Time using the locale's date layout ("-" for nil/zero).
+func (c *Catalog) FormatTime(lang string, v any) string {
+	var t time.Time
+	switch x := v.(type) {
+	case time.Time:
+		t = x
+	case *time.Time:
+		if x == nil {
+			return "-"
+		}
+		t = *x
+	default:
+		return fmt.Sprint(v)
+	}
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(c.locale(lang).DateFormat)
+}
+
+// FormatNumber formats ints/floats with the locale's separators.
+func (c *Catalog) FormatNumber(lang string, v any) string {
+	l := c.locale(lang)
+	var s string
+	switch x := v.(type) {
+	case int:
+		s = strconv.FormatInt(int64(x), 10)
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case float64:
+		s = strconv.FormatFloat(x, 'f', 2, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	intPart, frac, hasFrac := strings.Cut(s, ".")
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(l.ThousandsSep)
+		}
+		b.WriteRune(r)
+	}
+	out := b.String()
+	if hasFrac {
+		out += l.DecimalSep + frac
+	}
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// FromRequest picks a locale from Accept-Language (used before login).
+func (c *Catalog) FromRequest(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		tag = strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		if c.Has(tag) {
+			return tag
+		}
+	}
+	return c.fallback
+}
+
+func (c *Catalog) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"t":       c.T,
+		"fmtTime": c.FormatTime,
+		"fmtNum":  c.FormatNumber,
+	}
+}
+
+// ---------------- handler ----------------
+
+// handleLang stores the chosen UI language on the panel user and the current session.
+func (s *Server) handleLang(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	lang := strings.TrimSpace(r.FormValue("lang"))
+	if !s.i18n.Has(lang) {
+		http.Error(w, "unknown language", http.StatusBadRequest)
+		return
+	}
+	sess, _ := s.sessionFromCtx(r)
+	if err := s.st.UpdatePanelUserLanguage(sess.UserID, lang); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.sessions.SetLang(sess.Token, lang)
+
+	// only follow same-site paths from the Referer
+	back := "/ui/sites"
+	if u, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(u.Path, "/ui/") {
+		back = u.RequestURI()
+	}
+	http.Redirect(w, r, back, http.StatusFound)
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"mynginx/internal/store"
+	"mynginx/internal/util"
+)
+
+// idempotencyTTL is how long a stored response can be replayed.
+const idempotencyTTL = 24 * time.Hour
+
+// newIdemKey generates a per-render key for forms (protects against double submits).
+func newIdemKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// idempotent makes a mutating handler safe to retry: a request carrying an
+// Idempotency-Key header (or idempotency_key form field) runs once per user (or API
+// token) and key; retries get the stored response back. Must be wrapped by
+// requireAuth or run behind the API's token check.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+		if key == "" {
+			_ = r.ParseForm()
+			key = strings.TrimSpace(r.PostFormValue("idempotency_key"))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 200 {
+			http.Error(w, "idempotency key too long", http.StatusBadRequest)
+			return
+		}
+
+		sess, _ := s.sessionFromCtx(r)
+		scoped := fmt.Sprintf("%d:%s", sess.UserID, key)
+		if name, ok := apiTokenFromCtx(r); ok {
+			scoped = "token:" + name + ":" + key
+		}
+		fp := util.Sha256Hex([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+
+		_ = s.st.PurgeIdempotent(time.Now().Add(-idempotencyTTL))
+		rec, err := s.st.BeginIdempotent(scoped, fp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rec != nil {
+			switch {
+			case rec.Fingerprint != fp:
+				http.Error(w, "idempotency key was already used for a different request", http.StatusUnprocessableEntity)
+			case !rec.Done:
+				http.Error(w, "a request with this idempotency key is still in progress", http.StatusConflict)
+			default:
+				replayIdempotent(w, rec)
+			}
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+
+		// server errors are not cached so the client can retry them
+		if rw.status >= 500 {
+			if err := s.st.ReleaseIdempotent(scoped); err != nil {
+				log.Printf("idempotency release %s: %v", scoped, err)
+			}
+			return
+		}
+		err = s.st.CompleteIdempotent(store.IdempotencyRecord{
+			Key:         scoped,
+			Status:      rw.status,
+			ContentType: rw.Header().Get("Content-Type"),
+			Location:    rw.Header().Get("Location"),
+			Body:        rw.buf.Bytes(),
+		})
+		if err != nil {
+			log.Printf("idempotency store %s: %v", scoped, err)
+		}
+	}
+}
+
+func replayIdempotent(w http.ResponseWriter, rec *store.IdempotencyRecord) {
+	if rec.ContentType != "" {
+		w.Header().Set("Content-Type", rec.ContentType)
+	}
+	if rec.Location != "" {
+		w.Header().Set("Location", rec.Location)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// recordingWriter passes the response through while keeping a copy for replay.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.buf.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
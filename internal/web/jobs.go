@@ -0,0 +1,177 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynginx/internal/app"
+	"mynginx/internal/store"
+)
+
+// handleJobs lists the newest background jobs.
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobs, err := s.core.Jobs(100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Jobs", "jobs", map[string]any{
+		"Jobs": jobs,
+	})
+}
+
+// handleJob serves /ui/jobs/view?id=N: one job, polled until it finishes.
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	j, ok := s.queryJob(w, r)
+	if !ok {
+		return
+	}
+	s.render(w, r, "Job", "job", map[string]any{
+		"Job": j,
+	})
+}
+
+// handleJobStatus is a job as JSON, polled by the job page.
+func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	j, ok := s.queryJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":   j.Status,
+		"finished": j.Finished(),
+		"step":     j.Step,
+		"progress": j.Progress,
+		"elapsed":  jobElapsed(j.Job).String(),
+	})
+}
+
+// queryJob loads the job named by the "id" query value. A role=user session only
+// sees the jobs of its own sites (404 otherwise).
+func (s *Server) queryJob(w http.ResponseWriter, r *http.Request) (app.JobView, bool) {
+	id, _ := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("id")), 10, 64)
+	j, err := s.core.Job(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return j, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return j, false
+	}
+	if sess, _ := s.sessionFromCtx(r); !sess.Admin() && (j.Target == "" || !s.core.SiteOwnedBy(j.Target, sess.Owner)) {
+		http.NotFound(w, r)
+		return j, false
+	}
+	return j, true
+}
+
+// startJob answers a form that queued a job with its page.
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request, j store.Job, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/jobs/view?id="+strconv.FormatInt(j.ID, 10), http.StatusFound)
+}
+
+// jobElapsed is how long a job has been running, or ran (0 while queued).
+func jobElapsed(j store.Job) time.Duration {
+	switch {
+	case j.StartedAt == nil:
+		return 0
+	case j.FinishedAt != nil:
+		return j.FinishedAt.Sub(*j.StartedAt).Round(time.Second)
+	default:
+		return time.Since(*j.StartedAt).Round(time.Second)
+	}
+}
+
+const jobsHTML = `{{define "jobs"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "jobs.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "jobs.subtitle"}}</p>
+
+  {{if not .Jobs}}
+    <p style="opacity:.7;">{{t .Lang "jobs.none"}}</p>
+  {{else}}
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>#</th>
+        <th align="left">{{t .Lang "jobs.job"}}</th>
+        <th>{{t .Lang "apply.actor"}}</th>
+        <th>{{t .Lang "jobs.queued"}}</th>
+        <th>{{t .Lang "jobs.status"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Jobs}}
+      <tr>
+        <td align="center"><a href="/ui/jobs/view?id={{.ID}}">{{.ID}}</a></td>
+        <td>{{t $.Lang (printf "jobs.kind.%s" .Kind)}} <code>{{if .Target}}{{.Target}}{{else}}{{t $.Lang "approvals.all_sites"}}{{end}}</code></td>
+        <td align="center">{{.Actor}}</td>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+        <td align="center">{{.Status}}{{if .Error}}<br><span style="color:#b00;">{{.Error}}</span>{{end}}</td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+  {{end}}
+{{end}}`
+
+const jobHTML = `{{define "job"}}
+  {{with .Job}}
+  <h2 style="margin:0 0 10px 0;">{{t $.Lang "jobs.job"}} #{{.ID}}: {{t $.Lang (printf "jobs.kind.%s" .Kind)}} <code>{{if .Target}}{{.Target}}{{else}}{{t $.Lang "approvals.all_sites"}}{{end}}</code></h2>
+  <p style="opacity:.8; margin-top:0;">
+    {{t $.Lang "jobs.queued"}}: {{fmtTime $.Lang .CreatedAt}}
+    {{with .Actor}}&nbsp; {{t $.Lang "apply.actor"}}: {{.}}{{end}}
+    {{if .StartedAt}}&nbsp; {{t $.Lang "jobs.started"}}: {{fmtTime $.Lang .StartedAt}}{{end}}
+    {{if .FinishedAt}}&nbsp; {{t $.Lang "jobs.finished"}}: {{fmtTime $.Lang .FinishedAt}}{{end}}
+  </p>
+  <p>{{t $.Lang "jobs.status"}}: <b id="job-status">{{.Status}}</b> <span id="job-step" style="opacity:.8;">{{.Step}}</span></p>
+  <p id="job-progress"{{if not .Progress}} style="display:none;"{{end}}>{{t $.Lang "jobs.progress"}}: <span>{{.Progress}}</span></p>
+  {{if .Error}}<pre style="color:#b00; white-space:pre-wrap;">{{.Error}}</pre>{{end}}
+  {{if .RunID}}<p><a href="/ui/apply/run?id={{.RunID}}">{{t $.Lang "apply.run_id" .RunID}}</a></p>{{end}}
+
+  {{if and (not .Finished) (eq .Kind "apply") $.Session.Admin}}
+  {{template "apply_live" $}}
+  <script>watchApply();</script>
+  {{end}}
+  {{if not .Finished}}
+  <script>
+    (function poll() {
+      fetch("/ui/jobs/status?id={{.ID}}", {credentials: "same-origin"}).then(r => r.json()).then(s => {
+        if (s.finished) { location.reload(); return; }
+        document.getElementById("job-status").textContent = s.status;
+        document.getElementById("job-step").textContent = (s.step ? s.step + " " : "") + "(" + s.elapsed + ")";
+        if (s.progress) {
+          const p = document.getElementById("job-progress");
+          p.style.display = "";
+          p.querySelector("span").textContent = s.progress;
+        }
+        setTimeout(poll, 2000);
+      }).catch(() => setTimeout(poll, 5000));
+    })();
+  </script>
+  {{end}}
+  {{end}}
+{{end}}`
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http"
+	"time"
+)
+
+// handleUpload registers h as an upload route: its body may be up to
+// api.limits.max_upload_mb and the connection deadlines are pushed to
+// api.limits.upload_timeout, past the server-wide read/write timeouts.
+func (s *Server) handleUpload(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	s.uploads[pattern] = true
+	mux.HandleFunc(pattern, h)
+}
+
+// limitRequests caps request bodies (413 when Content-Length says so up front,
+// a read error once a streamed body crosses the cap).
+func (s *Server) limitRequests(next http.Handler) http.Handler {
+	lim := s.cfg.API.Limits
+	maxBody := int64(lim.MaxBodyMB) << 20
+	maxUpload := int64(lim.MaxUploadMB) << 20
+	uploadTimeout := lim.Durations().Upload
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		max := maxBody
+		if s.uploads[r.URL.Path] {
+			max = maxUpload
+			rc := http.NewResponseController(w)
+			deadline := time.Now().Add(uploadTimeout)
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline)
+		}
+		if r.ContentLength > max {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
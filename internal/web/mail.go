@@ -0,0 +1,86 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// handleMail lists the outgoing mail queue with each message's delivery status.
+func (s *Server) handleMail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list, err := s.st.ListMail(200)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Mail", "mail", map[string]any{
+		"Mail":    list,
+		"Enabled": s.mailer.Enabled(),
+		"Relay":   s.cfg.Notify.SMTP.Host,
+	})
+}
+
+// handleMailTest sends a test message now; its outcome is the newest row of /ui/mail.
+func (s *Server) handleMailTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if _, err := s.mailer.Test(strings.TrimSpace(r.FormValue("to"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/mail", http.StatusFound)
+}
+
+const mailHTML = `{{define "mail"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "outbox.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "outbox.subtitle"}}</p>
+
+  {{if .Enabled}}
+  <form method="post" action="/ui/mail/test" style="margin-bottom:12px;">
+    <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+    <label>{{t .Lang "outbox.test_to"}}</label>
+    <input name="to" type="email" required placeholder="admin@example.com" style="padding:4px;">
+    <button>{{t .Lang "outbox.send_test"}}</button>
+    <span style="opacity:.7; margin-left:8px;">{{t .Lang "outbox.relay" .Relay}}</span>
+  </form>
+  {{else}}
+  <p style="color:#b60;">{{t .Lang "outbox.disabled"}}</p>
+  {{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th>{{t .Lang "events.time"}}</th>
+        <th align="left">{{t .Lang "outbox.to"}}</th>
+        <th align="left">{{t .Lang "outbox.subject"}}</th>
+        <th>{{t .Lang "col.status"}}</th>
+        <th>{{t .Lang "outbox.attempts"}}</th>
+        <th align="left">{{t .Lang "col.error"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Mail}}
+      <tr>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+        <td>{{.To}}</td>
+        <td>{{.Subject}}</td>
+        <td align="center" style="white-space:nowrap; color:{{if eq .Status "failed"}}#b00{{else if eq .Status "queued"}}#b60{{else}}inherit{{end}};">
+          {{t $.Lang (printf "outbox.status.%s" .Status)}}
+          {{if eq .Status "sent"}}{{with .SentAt}}<br><span style="font-size:85%; opacity:.7;">{{fmtTime $.Lang .}}</span>{{end}}{{end}}
+          {{if eq .Status "queued"}}{{with .NextAttemptAt}}<br><span style="font-size:85%; opacity:.7;">{{t $.Lang "outbox.next" (fmtTime $.Lang .)}}</span>{{end}}{{end}}
+        </td>
+        <td align="center">{{.Attempts}}</td>
+        <td style="white-space:pre-wrap;">{{.LastError}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="6" style="opacity:.7;">{{t .Lang "outbox.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
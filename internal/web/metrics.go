@@ -0,0 +1,309 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/app"
+	"mynginx/internal/auth"
+	"mynginx/internal/monitoring"
+	"mynginx/internal/store"
+)
+
+// MetricsPath serves the panel's Prometheus metrics (Authorization: Bearer <api token
+// with the metrics scope>), on api.listen or on api.metrics_listen when that is set.
+const MetricsPath = "/metrics"
+
+// httpBuckets are the upper bounds of the request duration histogram.
+var httpBuckets = []time.Duration{
+	5 * time.Millisecond, 25 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	time.Second, 5 * time.Second, 30 * time.Second,
+}
+
+type httpKey struct {
+	route, method string
+	code          int
+}
+
+type httpRoute struct {
+	count   int64
+	total   time.Duration
+	buckets []int64
+}
+
+// httpMetrics counts the requests of the panel listener by mux route, method and
+// status, and times them per route.
+type httpMetrics struct {
+	mu       sync.Mutex
+	requests map[httpKey]int64
+	routes   map[string]*httpRoute
+}
+
+func (m *httpMetrics) observe(route, method string, code int, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.requests == nil {
+		m.requests = map[httpKey]int64{}
+		m.routes = map[string]*httpRoute{}
+	}
+	m.requests[httpKey{route, method, code}]++
+	rt := m.routes[route]
+	if rt == nil {
+		rt = &httpRoute{buckets: make([]int64, len(httpBuckets))}
+		m.routes[route] = rt
+	}
+	rt.count++
+	rt.total += took
+	for i, le := range httpBuckets {
+		if took <= le {
+			rt.buckets[i]++
+		}
+	}
+}
+
+func (m *httpMetrics) write(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]httpKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	fmt.Fprintf(b, "# HELP %s Panel and API requests by route, method and status.\n# TYPE %[1]s counter\n", monitoring.MetricHTTPRequests)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s{route=%q,method=%q,code=\"%d\"} %d\n", monitoring.MetricHTTPRequests, k.route, k.method, k.code, m.requests[k])
+	}
+	routes := make([]string, 0, len(m.routes))
+	for r := range m.routes {
+		routes = append(routes, r)
+	}
+	sort.Strings(routes)
+	fmt.Fprintf(b, "# HELP %s Panel and API request latency by route.\n# TYPE %[1]s histogram\n", monitoring.MetricHTTPDuration)
+	for _, r := range routes {
+		rt := m.routes[r]
+		writeHistogram(b, monitoring.MetricHTTPDuration, fmt.Sprintf("route=%q", r), httpBuckets, rt.buckets, rt.count, rt.total)
+	}
+}
+
+// writeHistogram writes the series of one histogram; labels is "" or `a="b",...`.
+func writeHistogram(b *strings.Builder, name, labels string, bounds []time.Duration, buckets []int64, count int64, sum time.Duration) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, le := range bounds {
+		fmt.Fprintf(b, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, le.Seconds(), buckets[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(b, "%s_sum%s %g\n%[1]s_count%[2]s %[4]d\n", name, labels, sum.Seconds(), count)
+}
+
+// statusRecorder keeps the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// instrument wraps next (the whole middleware chain) and records each request under
+// the mux pattern it routes to, so paths with IDs do not make a series each.
+func (s *Server) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "other"
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		method := r.Method
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		default:
+			method = "other"
+		}
+		s.httpStats.observe(route, method, rec.code, time.Since(start))
+	})
+}
+
+// serveMetrics serves only MetricsPath on listen (api.metrics_listen) until ctx ends.
+func (s *Server) serveMetrics(ctx context.Context, listen string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(MetricsPath, s.handleMetrics)
+	srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second, WriteTimeout: time.Minute}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+	log.Printf("metrics listening on %s", listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("metrics listener: %v", err)
+	}
+}
+
+// storeMetrics is implemented by stores that time their queries (the sqlite store).
+type storeMetrics interface {
+	Metrics() store.StoreMetrics
+}
+
+// handleMetrics writes the store's query counters, latency histogram and connection
+// pool wait statistics, plus the site metrics, in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.apiAuth(r, auth.ScopeMetrics) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var b strings.Builder
+	if sm, ok := s.st.(storeMetrics); ok {
+		writeStoreMetrics(&b, sm.Metrics())
+	}
+	site, err := s.core.SiteMetrics()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeSiteMetrics(&b, site)
+	s.httpStats.write(&b)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// writeStoreMetrics writes the store's query counters, latency histogram and pool stats.
+func writeStoreMetrics(b *strings.Builder, m store.StoreMetrics) {
+	b.WriteString("# HELP ngm_store_ops_total Store operations by kind.\n# TYPE ngm_store_ops_total counter\n")
+	for _, o := range m.Ops {
+		fmt.Fprintf(b, "ngm_store_ops_total{op=%q} %d\n", o.Op, o.Count)
+	}
+	b.WriteString("# HELP ngm_store_errors_total Store operations that failed.\n# TYPE ngm_store_errors_total counter\n")
+	for _, o := range m.Ops {
+		fmt.Fprintf(b, "ngm_store_errors_total{op=%q} %d\n", o.Op, o.Errors)
+	}
+	b.WriteString("# HELP ngm_store_op_seconds Store operation latency.\n# TYPE ngm_store_op_seconds histogram\n")
+	for _, o := range m.Ops {
+		for i, le := range store.QueryBuckets {
+			fmt.Fprintf(b, "ngm_store_op_seconds_bucket{op=%q,le=\"%g\"} %d\n", o.Op, le.Seconds(), o.Buckets[i])
+		}
+		fmt.Fprintf(b, "ngm_store_op_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", o.Op, o.Count)
+		fmt.Fprintf(b, "ngm_store_op_seconds_sum{op=%q} %g\n", o.Op, o.Total.Seconds())
+		fmt.Fprintf(b, "ngm_store_op_seconds_count{op=%q} %d\n", o.Op, o.Count)
+	}
+	fmt.Fprintf(b, "# HELP ngm_store_slow_total Store operations over storage.slow_query.\n# TYPE ngm_store_slow_total counter\nngm_store_slow_total %d\n", m.Slow)
+	fmt.Fprintf(b, "# HELP ngm_store_conns_in_use Store connections in use.\n# TYPE ngm_store_conns_in_use gauge\nngm_store_conns_in_use %d\n", m.InUse)
+	fmt.Fprintf(b, "# HELP ngm_store_waits_total Callers that had to wait for the store connection.\n# TYPE ngm_store_waits_total counter\nngm_store_waits_total %d\n", m.WaitCount)
+	fmt.Fprintf(b, "# HELP ngm_store_wait_seconds_total Time spent waiting for the store connection.\n# TYPE ngm_store_wait_seconds_total counter\nngm_store_wait_seconds_total %g\n", m.WaitTotal.Seconds())
+}
+
+// writeSiteMetrics writes certificate expiry, the latest uptime check of each site
+// and the apply outcome (the metrics the monitoring starter pack alerts on).
+func writeSiteMetrics(b *strings.Builder, m app.SiteMetrics) {
+	fmt.Fprintf(b, "# HELP %s Sites by state.\n# TYPE %[1]s gauge\n", monitoring.MetricSites)
+	fmt.Fprintf(b, "%s{state=\"enabled\"} %d\n", monitoring.MetricSites, m.SitesEnabled)
+	fmt.Fprintf(b, "%s{state=\"disabled\"} %d\n", monitoring.MetricSites, m.Sites-m.SitesEnabled)
+
+	fmt.Fprintf(b, "# HELP %s Certificate notAfter (unix time).\n# TYPE %[1]s gauge\n", monitoring.MetricCertExpiry)
+	for _, c := range m.Certs {
+		fmt.Fprintf(b, "%s{domain=%q,lineage=%q} %d\n", monitoring.MetricCertExpiry, c.Domain, c.Lineage, c.NotAfter.Unix())
+	}
+
+	fmt.Fprintf(b, "# HELP %s Sites by list state.\n# TYPE %[1]s gauge\n", monitoring.MetricSiteStates)
+	for _, st := range []string{"OK", "PENDING", "ERROR", "DISABLED"} {
+		fmt.Fprintf(b, "%s{state=%q} %d\n", monitoring.MetricSiteStates, st, m.States[st])
+	}
+
+	fmt.Fprintf(b, "# HELP %s Days until the certificate expires (negative = expired).\n# TYPE %[1]s gauge\n", monitoring.MetricCertDaysLeft)
+	for _, c := range m.Certs {
+		fmt.Fprintf(b, "%s{domain=%q,lineage=%q} %.2f\n", monitoring.MetricCertDaysLeft, c.Domain, c.Lineage, time.Until(c.NotAfter).Hours()/24)
+	}
+
+	fmt.Fprintf(b, "# HELP %s Latest uptime check of the site passed (1) or failed (0).\n# TYPE %[1]s gauge\n", monitoring.MetricSiteUp)
+	for _, c := range m.Checks {
+		up := 0
+		if c.OK {
+			up = 1
+		}
+		fmt.Fprintf(b, "%s{domain=%q,location=%q} %d\n", monitoring.MetricSiteUp, c.Domain, c.Location, up)
+	}
+	fmt.Fprintf(b, "# HELP %s Latency of the latest uptime check.\n# TYPE %[1]s gauge\n", monitoring.MetricSiteLatency)
+	for _, c := range m.Checks {
+		fmt.Fprintf(b, "%s{domain=%q,location=%q} %g\n", monitoring.MetricSiteLatency, c.Domain, c.Location, c.Latency.Seconds())
+	}
+	fmt.Fprintf(b, "# HELP %s Time of the latest uptime check (unix time).\n# TYPE %[1]s gauge\n", monitoring.MetricSiteChecked)
+	for _, c := range m.Checks {
+		fmt.Fprintf(b, "%s{domain=%q,location=%q} %d\n", monitoring.MetricSiteChecked, c.Domain, c.Location, c.CheckedAt.Unix())
+	}
+
+	fmt.Fprintf(b, "# HELP %s Finish time of the newest successful apply (unix time, 0 = none).\n# TYPE %[1]s gauge\n%[1]s %d\n",
+		monitoring.MetricApplySuccess, unixOrZero(m.LastApplyOK))
+	fmt.Fprintf(b, "# HELP %s Finish time of the newest failed apply (unix time, 0 = none).\n# TYPE %[1]s gauge\n%[1]s %d\n",
+		monitoring.MetricApplyFailure, unixOrZero(m.LastApplyFail))
+
+	fmt.Fprintf(b, "# HELP %s Apply runs of this process by result.\n# TYPE %[1]s counter\n", monitoring.MetricApplyRuns)
+	for _, r := range []string{"ok", "failed", "dry_run", "busy"} {
+		fmt.Fprintf(b, "%s{result=%q} %d\n", monitoring.MetricApplyRuns, r, m.Applies.Results[r])
+	}
+	fmt.Fprintf(b, "# HELP %s Duration of the apply runs of this process.\n# TYPE %[1]s histogram\n", monitoring.MetricApplyDuration)
+	writeHistogram(b, monitoring.MetricApplyDuration, "", app.ApplyBuckets, m.Applies.Buckets, m.Applies.Count, m.Applies.Total)
+
+	fmt.Fprintf(b, "# HELP %s nginx reloads run by this process.\n# TYPE %[1]s counter\n%[1]s %d\n", monitoring.MetricReloads, m.Reloads)
+	fmt.Fprintf(b, "# HELP %s nginx reloads of this process that failed.\n# TYPE %[1]s counter\n%[1]s %d\n", monitoring.MetricReloadFailures, m.ReloadFailures)
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// apiAuth reports whether r carries a bearer token with scope (an api token from the
+// database, including imported api.tokens entries); the use is recorded on it. Tokens
+// limited to some sites are refused: the metrics cover every site.
+func (s *Server) apiAuth(r *http.Request, scope string) bool {
+	tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	acc, err := s.core.APITokenAuth(tok, scope, remoteHost(r))
+	return err == nil && !acc.Restricted()
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// handleNginxModules lists the dynamic nginx modules with their capability on
+// this nginx and whether the panel loads them.
+func (s *Server) handleNginxModules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderNginxModules(w, r, "")
+}
+
+func (s *Server) renderNginxModules(w http.ResponseWriter, r *http.Request, errMsg string) {
+	mods, err := s.core.NginxModules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Nginx modules", "nginx_modules", map[string]any{
+		"Modules": mods,
+		"Conf":    s.core.NginxModulesConf(),
+		"Error":   errMsg,
+	})
+}
+
+// handleNginxModuleSet enables or disables a module; a failed nginx -t is shown on
+// the page (the previous include is already restored).
+func (s *Server) handleNginxModuleSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if err := s.core.NginxModuleSet(r.Context(), strings.TrimSpace(r.FormValue("name")), parseBool(r.FormValue("enable"), false)); err != nil {
+		s.renderNginxModules(w, r, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/ui/nginx/modules", http.StatusFound)
+}
+
+const nginxModulesHTML = `{{define "nginx_modules"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "modules.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "modules.subtitle" .Conf}}</p>
+  {{if .Error}}<pre style="color:#b00; white-space:pre-wrap;">{{.Error}}</pre>{{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "modules.module"}}</th>
+        <th>{{t .Lang "modules.available"}}</th>
+        <th align="left">{{t .Lang "modules.files"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Modules}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td align="center">
+          {{if .BuiltIn}}{{t $.Lang "modules.built_in"}}
+          {{else if .Installed}}{{t $.Lang "common.yes"}}
+          {{else}}<span style="opacity:.7;">{{t $.Lang "modules.missing" .Dir}}</span>{{end}}
+        </td>
+        <td><code>{{range $i, $f := .Files}}{{if $i}}, {{end}}{{$f}}{{end}}</code></td>
+        <td align="center">
+          {{if .Enabled}}
+          <form method="post" action="/ui/nginx/modules/set" style="display:inline;">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="name" value="{{.Name}}">
+            <input type="hidden" name="enable" value="false">
+            <button>{{t $.Lang "action.disable"}}</button>
+          </form>
+          {{else if and .Installed (not .BuiltIn)}}
+          <form method="post" action="/ui/nginx/modules/set" style="display:inline;">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="name" value="{{.Name}}">
+            <input type="hidden" name="enable" value="true">
+            <button>{{t $.Lang "action.enable"}}</button>
+          </form>
+          {{else}}-{{end}}
+        </td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
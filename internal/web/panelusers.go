@@ -0,0 +1,244 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/auth"
+	"mynginx/internal/store"
+)
+
+// handlePanelUsers lists the panel users, with forms to add and change them.
+func (s *Server) handlePanelUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderPanelUsers(w, r, "")
+}
+
+func (s *Server) renderPanelUsers(w http.ResponseWriter, r *http.Request, errMsg string) {
+	users, err := s.st.ListPanelUsers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Panel users", "panel_users", map[string]any{
+		"Users": users,
+		"Roles": auth.Roles,
+		"Error": errMsg,
+	})
+}
+
+func (s *Server) handlePanelUserCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	username := strings.TrimSpace(r.FormValue("username"))
+	role := strings.TrimSpace(r.FormValue("role"))
+	email := strings.TrimSpace(r.FormValue("email"))
+	switch {
+	case username == "":
+		s.renderPanelUsers(w, r, "username is required")
+		return
+	case !auth.ValidRole(role):
+		s.renderPanelUsers(w, r, fmt.Sprintf("invalid role %q", role))
+		return
+	case email != "" && !validEmail(email):
+		s.renderPanelUsers(w, r, fmt.Sprintf("invalid email %q", email))
+		return
+	}
+	if _, err := s.st.GetPanelUserByUsername(username); err == nil {
+		s.renderPanelUsers(w, r, fmt.Sprintf("panel user %q already exists", username))
+		return
+	}
+	hash, err := s.hashPassword(r.FormValue("password"))
+	if err != nil {
+		s.renderPanelUsers(w, r, err.Error())
+		return
+	}
+	u, err := s.st.CreatePanelUser(username, hash, role, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if h := strings.TrimSpace(r.FormValue("hosting_user")); h != "" {
+		_ = s.st.SetPanelUserHostingUser(u.ID, h)
+	}
+	if email != "" {
+		_ = s.st.UpdatePanelUserEmail(u.ID, email)
+	}
+	if parseBool(r.FormValue("must_change"), false) {
+		_ = s.st.SetPanelUserMustChangePassword(u.ID, true)
+	}
+	sess, _ := s.sessionFromCtx(r)
+	s.core.AuditOwner(u.Username, "info", "auth", "panel user %q (%s) created by %q", u.Username, role, sess.Username)
+	http.Redirect(w, r, "/ui/users", http.StatusFound)
+}
+
+// handlePanelUserUpdate changes the role, hosting user link and enabled flag of a
+// panel user. Its sessions are signed out, so a new role or a disable applies at once.
+func (s *Server) handlePanelUserUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	u, ok := s.formPanelUser(w, r)
+	if !ok {
+		return
+	}
+	prev := u
+	u.Role = strings.TrimSpace(r.FormValue("role"))
+	u.HostingUser = strings.TrimSpace(r.FormValue("hosting_user"))
+	u.Enabled = parseBool(r.FormValue("enabled"), false)
+	if !auth.ValidRole(u.Role) {
+		s.renderPanelUsers(w, r, fmt.Sprintf("invalid role %q", u.Role))
+		return
+	}
+	if err := s.keepAdmin(r, prev, u.Role == auth.RoleAdmin && u.Enabled); err != nil {
+		s.renderPanelUsers(w, r, err.Error())
+		return
+	}
+	if err := s.st.UpdatePanelUser(u); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if u.Role != prev.Role || u.HostingUser != prev.HostingUser || !u.Enabled {
+		s.sessions.DeleteUser(u.ID, "")
+	}
+	sess, _ := s.sessionFromCtx(r)
+	s.core.AuditOwner(u.Username, "info", "auth", "panel user %q updated by %q: role %s, enabled %t", u.Username, sess.Username, u.Role, u.Enabled)
+	http.Redirect(w, r, "/ui/users", http.StatusFound)
+}
+
+func (s *Server) handlePanelUserDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	u, ok := s.formPanelUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.keepAdmin(r, u, false); err != nil {
+		s.renderPanelUsers(w, r, err.Error())
+		return
+	}
+	if err := s.st.DeletePanelUser(u.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.sessions.DeleteUser(u.ID, "")
+	sess, _ := s.sessionFromCtx(r)
+	s.core.AuditOwner(u.Username, "warning", "auth", "panel user %q deleted by %q", u.Username, sess.Username)
+	http.Redirect(w, r, "/ui/users", http.StatusFound)
+}
+
+// formPanelUser loads the panel user named by the "id" form value (404 if none).
+func (s *Server) formPanelUser(w http.ResponseWriter, r *http.Request) (store.PanelUser, bool) {
+	id, _ := strconv.ParseInt(strings.TrimSpace(r.FormValue("id")), 10, 64)
+	u, err := s.st.GetPanelUserByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return u, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return u, false
+	}
+	return u, true
+}
+
+// keepAdmin refuses a change that leaves u no longer an enabled admin (stillAdmin
+// false) when u is the signed-in user or the last enabled admin, so the panel
+// always keeps someone who can manage it.
+func (s *Server) keepAdmin(r *http.Request, u store.PanelUser, stillAdmin bool) error {
+	if stillAdmin || u.Role != auth.RoleAdmin || !u.Enabled {
+		return nil
+	}
+	if sess, _ := s.sessionFromCtx(r); sess.UserID == u.ID {
+		return errors.New("you cannot demote, disable or delete your own account")
+	}
+	users, err := s.st.ListPanelUsers()
+	if err != nil {
+		return err
+	}
+	for _, o := range users {
+		if o.ID != u.ID && o.Role == auth.RoleAdmin && o.Enabled {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is the last enabled admin", u.Username)
+}
+
+const panelUsersHTML = `{{define "panel_users"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "panel_users.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "panel_users.subtitle"}}</p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <form method="post" action="/ui/users/create" style="margin-bottom:12px;">
+    <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+    <label>{{t .Lang "login.username"}}</label>
+    <input name="username" required style="padding:4px; width:110px;">
+    <label style="margin-left:6px;">{{t .Lang "login.password"}}</label>
+    <input name="password" type="password" required autocomplete="new-password" style="padding:4px; width:130px;">
+    <label style="margin-left:6px;">{{t .Lang "profile.role"}}</label>
+    <select name="role" style="padding:4px;">
+      {{range .Roles}}<option value="{{.}}">{{.}}</option>{{end}}
+    </select>
+    <label style="margin-left:6px;" title="{{t .Lang "panel_users.hosting_user_help"}}">{{t .Lang "panel_users.hosting_user"}}</label>
+    <input name="hosting_user" style="padding:4px; width:100px;">
+    <label style="margin-left:6px;">{{t .Lang "profile.email"}}</label>
+    <input name="email" type="email" style="padding:4px; width:160px;">
+    <label style="margin-left:6px;"><input type="checkbox" name="must_change" value="true" checked> {{t .Lang "panel_users.must_change"}}</label>
+    <button>{{t .Lang "panel_users.create"}}</button>
+  </form>
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "login.username"}}</th>
+        <th>{{t .Lang "profile.email"}}</th>
+        <th>{{t .Lang "profile.last_login"}}</th>
+        <th>{{t .Lang "panel_users.access"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Users}}
+      <tr{{if not .Enabled}} style="opacity:.6;"{{end}}>
+        <td>{{.Username}}{{if eq .ID $.Session.UserID}} <span style="opacity:.7;">({{t $.Lang "panel_users.you"}})</span>{{end}}</td>
+        <td align="center">{{.Email}}{{if and .Email (not .EmailVerified)}} <span style="opacity:.7;">({{t $.Lang "profile.not_verified"}})</span>{{end}}</td>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .LastLoginAt}}</td>
+        <td align="center" style="white-space:nowrap;">
+          <form method="post" action="/ui/users/update" style="display:inline;">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="id" value="{{.ID}}">
+            <select name="role" style="padding:2px;">
+              {{$role := .Role}}{{range $.Roles}}<option value="{{.}}" {{if eq . $role}}selected{{end}}>{{.}}</option>{{end}}
+            </select>
+            <input name="hosting_user" value="{{.HostingUser}}" placeholder="{{.Username}}" title="{{t $.Lang "panel_users.hosting_user_help"}}" style="padding:2px; width:90px;">
+            <label><input type="checkbox" name="enabled" value="true" {{if .Enabled}}checked{{end}}> {{t $.Lang "panel_users.enabled"}}</label>
+            <button>{{t $.Lang "action.save"}}</button>
+          </form>
+        </td>
+        <td align="center">
+          <form method="post" action="/ui/users/delete" style="display:inline;" onsubmit="return confirm('{{t $.Lang "panel_users.delete_confirm" .Username}}');">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="id" value="{{.ID}}">
+            <button>{{t $.Lang "action.delete"}}</button>
+          </form>
+        </td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
@@ -0,0 +1,215 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mynginx/internal/app"
+	"mynginx/internal/store"
+)
+
+// usageBadge is the "used/max" label shown next to a hosting user.
+type usageBadge struct {
+	Text string
+	Full bool // at or over the plan limit
+}
+
+// usageBadges maps hosting username -> site usage badge (only users with a site limit).
+func usageBadges(items []app.UserUsage) map[string]usageBadge {
+	out := map[string]usageBadge{}
+	for _, it := range items {
+		if it.Plan == nil || it.Plan.MaxSites == 0 {
+			continue
+		}
+		out[it.User.Username] = usageBadge{
+			Text: strconv.Itoa(it.Sites) + "/" + strconv.Itoa(it.Plan.MaxSites),
+			Full: it.Sites >= it.Plan.MaxSites,
+		}
+	}
+	return out
+}
+
+func (s *Server) handlePlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderPlans(w, r, "")
+}
+
+func (s *Server) renderPlans(w http.ResponseWriter, r *http.Request, errMsg string) {
+	plans, err := s.core.PlanList()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users, err := s.core.UserUsageList()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Plans", "plans", map[string]any{
+		"Plans": plans,
+		"Users": users,
+		"Error": errMsg,
+	})
+}
+
+func (s *Server) handlePlanSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	p := store.Plan{
+		Name:            strings.TrimSpace(r.FormValue("name")),
+		MaxSites:        atoiDef(r.FormValue("max_sites"), 0),
+		MaxProxyTargets: atoiDef(r.FormValue("max_targets"), 0),
+		BandwidthMB:     int64(atoiDef(r.FormValue("bandwidth_mb"), 0)),
+		DiskMB:          int64(atoiDef(r.FormValue("disk_mb"), 0)),
+	}
+	for _, v := range strings.FieldsFunc(r.FormValue("php"), func(c rune) bool { return c == ',' || c == ' ' }) {
+		p.PHPVersions = append(p.PHPVersions, v)
+	}
+	if _, err := s.core.PlanSave(p); err != nil {
+		s.renderPlans(w, r, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/ui/plans", http.StatusFound)
+}
+
+func (s *Server) handlePlanDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if err := s.core.PlanDelete(r.FormValue("name")); err != nil {
+		s.renderPlans(w, r, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/ui/plans", http.StatusFound)
+}
+
+func (s *Server) handleUserPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if err := s.core.UserSetPlan(r.FormValue("user"), r.FormValue("plan")); err != nil {
+		s.renderPlans(w, r, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/ui/plans", http.StatusFound)
+}
+
+func atoiDef(v string, def int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+const plansHTML = `{{define "plans"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "plans.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "plans.subtitle"}}</p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "plans.name"}}</th>
+        <th>{{t .Lang "plans.max_sites"}}</th>
+        <th>{{t .Lang "plans.max_targets"}}</th>
+        <th>{{t .Lang "plans.php"}}</th>
+        <th>{{t .Lang "plans.bandwidth"}}</th>
+        <th>{{t .Lang "plans.disk"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Plans}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td align="center">{{if .MaxSites}}{{.MaxSites}}{{else}}∞{{end}}</td>
+        <td align="center">{{if .MaxProxyTargets}}{{.MaxProxyTargets}}{{else}}∞{{end}}</td>
+        <td align="center">{{if .PHPVersions}}{{range $i, $v := .PHPVersions}}{{if $i}}, {{end}}{{$v}}{{end}}{{else}}{{t $.Lang "plans.any"}}{{end}}</td>
+        <td align="center">{{if .BandwidthMB}}{{fmtNum $.Lang .BandwidthMB}} MB{{else}}∞{{end}}</td>
+        <td align="center">{{if .DiskMB}}{{fmtNum $.Lang .DiskMB}} MB{{else}}∞{{end}}</td>
+        <td align="center">
+          <form method="post" action="/ui/plans/delete" style="display:inline;"
+                onsubmit="return confirm('{{t $.Lang "confirm.delete_plan" .Name}}');">
+            <input type="hidden" name="name" value="{{.Name}}">
+            <button>{{t $.Lang "action.delete"}}</button>
+          </form>
+        </td>
+      </tr>
+    {{else}}
+      <tr><td colspan="7" style="opacity:.7;">{{t .Lang "plans.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+
+  <h3>{{t .Lang "plans.add_update"}}</h3>
+  <form method="post" action="/ui/plans/save" style="max-width:720px;">
+    <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+      <label>{{t .Lang "plans.name"}}</label>
+      <input name="name" style="padding:8px;" placeholder="e.g. basic">
+
+      <label>{{t .Lang "plans.max_sites"}}</label>
+      <input name="max_sites" style="padding:8px;" value="0">
+
+      <label>{{t .Lang "plans.max_targets"}}</label>
+      <input name="max_targets" style="padding:8px;" value="0">
+
+      <label>{{t .Lang "plans.php"}}</label>
+      <input name="php" style="padding:8px;" placeholder="e.g. 8.3, 8.4">
+
+      <label>{{t .Lang "plans.bandwidth"}} (MB)</label>
+      <input name="bandwidth_mb" style="padding:8px;" value="0">
+
+      <label>{{t .Lang "plans.disk"}} (MB)</label>
+      <input name="disk_mb" style="padding:8px;" value="0">
+    </div>
+    <p style="opacity:.75;">{{t .Lang "plans.zero_hint"}}</p>
+    <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+  </form>
+
+  <h3>{{t .Lang "plans.users"}}</h3>
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "col.owner"}}</th>
+        <th>{{t .Lang "plans.sites"}}</th>
+        <th>{{t .Lang "plans.plan"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Users}}
+      <tr>
+        <td><a href="/ui/activity?user={{.User.Username}}">{{.User.Username}}</a></td>
+        <td align="center">
+          {{if and .Plan .Plan.MaxSites}}
+            <span style="padding:2px 6px; border-radius:4px; background:{{if ge .Sites .Plan.MaxSites}}#fdd{{else}}#dfd{{end}};">{{.Sites}}/{{.Plan.MaxSites}}</span>
+          {{else}}{{.Sites}}{{end}}
+        </td>
+        <td align="center">
+          <form method="post" action="/ui/users/plan" style="display:inline;">
+            <input type="hidden" name="user" value="{{.User.Username}}">
+            <select name="plan" onchange="this.form.submit()" style="padding:2px;">
+              <option value="">{{t $.Lang "plans.no_plan"}}</option>
+              {{$cur := .Plan}}
+              {{range $.Plans}}
+                <option value="{{.Name}}" {{if and $cur (eq $cur.ID .ID)}}selected{{end}}>{{.Name}}</option>
+              {{end}}
+            </select>
+          </form>
+        </td>
+      </tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/config"
+)
+
+// bucketIdle is how long an unused bucket is kept; a refilled bucket is the same as
+// no bucket, so dropping it loses nothing.
+const bucketIdle = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a set of token buckets keyed by client (IP or API token).
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: perSecond, burst: float64(burst), buckets: map[string]*bucket{}}
+}
+
+// allow takes a token from key's bucket. When it is empty it returns false and how
+// long until the next token.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.swept) > bucketIdle {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdle {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// rateLimits holds the limiters of api.rate_limit (nil when disabled).
+type rateLimits struct {
+	ip    *rateLimiter
+	token *rateLimiter
+	login *rateLimiter
+}
+
+func newRateLimits(cfg config.RateLimitConfig) *rateLimits {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &rateLimits{
+		ip:    newRateLimiter(cfg.PerIP, cfg.PerIPBurst),
+		token: newRateLimiter(cfg.PerToken, cfg.PerTokenBurst),
+		login: newRateLimiter(cfg.LoginPerMinute/60, cfg.LoginBurst),
+	}
+}
+
+// loginPaths are the public form posts that check credentials or send mail.
+var loginPaths = map[string]bool{
+	"/ui/login":           true,
+	"/ui/password/forgot": true,
+	"/ui/password/reset":  true,
+	"/ui/reauth":          true,
+	"/ui/setup":           true, // the one-time setup code
+}
+
+// rateLimit answers 429 with Retry-After once a client has used up its bucket:
+// JSON API requests count against their source IP and bearer token, login,
+// password-reset and setup posts against their source IP. Everything else passes.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.limits == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		ip := remoteHost(r)
+		ok, wait := true, time.Duration(0)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			ok, wait = s.limits.ip.allow(ip, now)
+			if tok, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && found && tok != "" {
+				// keyed by a hash so the limiter never holds a credential
+				sum := sha256.Sum256([]byte(tok))
+				ok, wait = s.limits.token.allow(hex.EncodeToString(sum[:8]), now)
+			}
+		case r.Method == http.MethodPost && loginPaths[r.URL.Path]:
+			ok, wait = s.limits.login.allow(ip, now)
+		}
+		if !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			if secs < 1 {
+				secs = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
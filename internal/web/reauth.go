@@ -0,0 +1,89 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// reauthPath asks for the password again before a destructive action.
+const reauthPath = "/ui/reauth"
+
+// requireReauth lets a POST through only when the session's password entry is more
+// recent than security.session.reauth; otherwise the user is sent to the password
+// prompt, which leads back to the page the action was started from. Wrap it around
+// idempotent() so the redirect is not stored as the action's response.
+func (s *Server) requireReauth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, _ := s.sessionFromCtx(r)
+		_, _, window := s.cfg.Security.Session.Durations()
+		if r.Method != http.MethodPost || window <= 0 || time.Since(sess.AuthAt) <= window {
+			next(w, r)
+			return
+		}
+		back := "/ui/sites"
+		if u, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(u.Path, "/ui/") {
+			back = u.RequestURI()
+		}
+		http.Redirect(w, r, reauthPath+"?next="+url.QueryEscape(back), http.StatusSeeOther)
+	}
+}
+
+// localNext is next when it is a panel path, /ui/sites otherwise (no open redirects).
+func localNext(next string) string {
+	u, err := url.Parse(next)
+	if err != nil || u.IsAbs() || u.Host != "" || !strings.HasPrefix(u.Path, "/ui/") {
+		return "/ui/sites"
+	}
+	return u.RequestURI()
+}
+
+func (s *Server) handleReauth(w http.ResponseWriter, r *http.Request) {
+	sess, _ := s.sessionFromCtx(r)
+	lang := s.lang(r)
+	next := localNext(r.FormValue("next"))
+	data := map[string]any{"Next": next}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.render(w, r, "Confirm Password", "reauth", data)
+
+	case http.MethodPost:
+		u, err := s.st.GetPanelUserByID(sess.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(r.FormValue("password"))) != nil {
+			s.core.AuditOwner(u.Username, "warning", "auth", "re-authentication of %q failed from %s", u.Username, remoteHost(r))
+			data["Error"] = s.i18n.T(lang, "password.wrong_current")
+			s.render(w, r, "Confirm Password", "reauth", data)
+			return
+		}
+		s.sessions.Reauthenticated(sess.Token)
+		s.core.AuditOwner(u.Username, "info", "auth", "re-authenticated %q from %s", u.Username, remoteHost(r))
+		http.Redirect(w, r, next, http.StatusFound)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+const reauthHTML = `{{define "reauth"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "reauth.title"}}</h2>
+  <p style="opacity:.8;">{{t .Lang "reauth.hint"}}</p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <form method="post" action="/ui/reauth" style="max-width:420px;">
+    <input type="hidden" name="next" value="{{.Next}}">
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "password.current"}}</label><br/>
+      <input type="password" name="password" autocomplete="current-password" autofocus style="width:100%; padding:8px;" />
+    </div>
+    <button style="padding:10px 14px;">{{t .Lang "reauth.confirm"}}</button>
+    <a href="{{.Next}}" style="margin-left:10px;">{{t .Lang "action.cancel"}}</a>
+  </form>
+{{end}}`
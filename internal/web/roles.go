@@ -0,0 +1,124 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"mynginx/internal/app"
+	"mynginx/internal/store"
+)
+
+// userPaths are the panel pages a role=user session may open. The site-scoped ones
+// (true) also need a "domain" of the session's own hosting user and never act on
+// all sites; everything not listed is admin-only.
+var userPaths = map[string]bool{
+	"/ui/logout":           false,
+	"/ui/lang":             false,
+	"/ui/password/change":  false,
+	"/ui/profile":          false,
+	"/ui/profile/password": false,
+	reauthPath:             false,
+	"/ui/sites":            false, // lists only the user's sites
+	"/ui/sites/new":        false, // adds sites for the user's hosting user only
+	"/ui/activity":         false, // the user's own feed
+	"/ui/jobs/view":        false, // jobs of the user's own sites only
+	"/ui/jobs/status":      false,
+
+	"/ui/sites/edit":        true,
+	"/ui/sites/disable":     true,
+	"/ui/sites/enable":      true,
+	"/ui/sites/delete":      true,
+	"/ui/sites/redirect":    true,
+	"/ui/sites/placeholder": true,
+	"/ui/sites/harden":      true,
+	"/ui/sites/reapply":     true,
+	"/ui/sites/config":      true,
+	"/ui/sites/preview":     true,
+	"/ui/sites/logs":        true,
+	"/ui/sites/logs/stream": true,
+	"/ui/sites/trace":       true,
+	"/ui/sites/headers":     true,
+	"/ui/sites/preloads":    true,
+	"/ui/sites/expiry":      true,
+	"/ui/sites/reach":       true,
+	"/ui/sites/logsample":   true,
+	"/ui/apply":             true,
+	"/ui/apply/history":     true,
+	"/ui/cert/info":         true,
+}
+
+// authorize fills in the hosting user of a role=user session (panel user u) and
+// reports whether it may make request r; admin sessions may make any.
+func (s *Server) authorize(r *http.Request, sess *Session, u store.PanelUser) bool {
+	if sess.Admin() {
+		return true
+	}
+	sess.Owner = app.PanelUserOwner(u)
+
+	scoped, ok := userPaths[r.URL.Path]
+	if !ok || !scoped {
+		return ok
+	}
+	form := peekForm(r)
+	if parseBool(form.Get("all"), false) {
+		return false
+	}
+	return s.core.SiteOwnedBy(strings.TrimSpace(form.Get("domain")), sess.Owner)
+}
+
+// peekForm parses the form of r on a copy, leaving the body in place for
+// idempotent() and the handler.
+func peekForm(r *http.Request) url.Values {
+	c := r.Clone(r.Context())
+	if r.Body != nil {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		c.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	_ = c.ParseForm()
+	return c.Form
+}
+
+// userSiteAdd checks a site a role=user session adds: the domain must be new or
+// already its own (re-adding someone else's site would move it), and not a proxy.
+func (s *Server) userSiteAdd(sess Session, domain, mode string) error {
+	if owner, ok := s.core.SiteOwner(domain); ok && owner != sess.Owner {
+		return fmt.Errorf("%s belongs to another account", strings.ToLower(strings.TrimSpace(domain)))
+	}
+	if strings.TrimSpace(mode) == "proxy" {
+		return errProxyAdminOnly
+	}
+	return nil
+}
+
+// userSiteMode checks the mode a role=user session sets on its site: proxy sites
+// (upstream targets anywhere on the network) are set up by an admin, so a user
+// may keep one but not switch to it.
+func (s *Server) userSiteMode(domain, mode string) error {
+	if strings.TrimSpace(mode) != "proxy" {
+		return nil
+	}
+	if cur, err := s.st.GetSiteByDomain(strings.ToLower(domain)); err == nil && cur.Mode == "proxy" {
+		return nil
+	}
+	return errProxyAdminOnly
+}
+
+var errProxyAdminOnly = errors.New("proxy sites are set up by an admin")
+
+// forbidden answers a request the session's role may not make.
+func (s *Server) forbidden(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
+	s.render(w, r, "Forbidden", "forbidden", nil)
+}
+
+const forbiddenHTML = `{{define "forbidden"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "forbidden.title"}}</h2>
+  <p style="opacity:.8;">{{t .Lang "forbidden.hint"}}</p>
+  <p><a href="/ui/sites">{{t .Lang "common.back_sites"}}</a></p>
+{{end}}`
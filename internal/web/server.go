@@ -2,18 +2,31 @@ package web
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"html/template"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"mynginx/internal/app"
+	"mynginx/internal/auth"
+	"mynginx/internal/cluster"
 	"mynginx/internal/config"
+	"mynginx/internal/health"
+	"mynginx/internal/notify"
+	"mynginx/internal/sdnotify"
 	"mynginx/internal/store"
+	"mynginx/internal/util"
 )
 
 const cookieName = "ngm_session"
@@ -30,36 +43,126 @@ type Server struct {
 
 	sessions *SessionStore
 	tpl      *template.Template
+	i18n     *Catalog
+
+	mailer      *notify.Mailer
+	health      *health.Checker
+	tokenSecret string        // HMAC key for emailed reset/verify links
+	tokenTTL    time.Duration // lifetime of emailed links
+
+	uploads map[string]bool // routes registered with handleUpload
+	limits  *rateLimits     // api.rate_limit (nil = off)
+
+	// httpStats counts requests per route for /metrics
+	httpStats httpMetrics
+
+	// stopping is closed when Serve shuts down, ending the open event streams
+	stopping chan struct{}
+
+	// exec runs the external commands of the panel, for the systemd watchdog
+	exec *util.TrackRunner
+
+	// logFollows counts the open log streams per panel user
+	logFollows logFollows
+
+	// setupCode unlocks the first-run setup while no panel user exists ("" = closed)
+	setupMu   sync.Mutex
+	setupCode string
 }
 
-func New(cfg *config.Config, paths config.Paths, st store.SiteStore) (*Server, error) {
-	core, err := app.New(cfg, paths, st)
+func New(cfg *config.Config, paths config.Paths, st store.SiteStore, run util.Runner) (*Server, error) {
+	exec := &util.TrackRunner{Next: run}
+	core, err := app.New(cfg, paths, st, exec)
+	if err != nil {
+		return nil, err
+	}
+	if err := core.ImportConfigTokens(); err != nil {
+		return nil, err
+	}
+
+	cat, err := loadCatalog(cfg.UI.DefaultLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.TokenSecret(st)
 	if err != nil {
 		return nil, err
 	}
+	ttl, _ := time.ParseDuration(cfg.Security.ResetTokenTTL) // validated in config
 
-	tpl := template.New("root")
+	tpl := template.New("root").Funcs(cat.funcMap())
 	template.Must(tpl.New("layout").Parse(layoutHTML))
 	template.Must(tpl.New("menu").Parse(menuHTML))
         template.Must(tpl.New("content").Parse(contentHTML))
 	template.Must(tpl.New("login").Parse(loginHTML))
+	template.Must(tpl.New("setup").Parse(setupHTML))
 	template.Must(tpl.New("sites").Parse(sitesHTML))
 	template.Must(tpl.New("site_form").Parse(siteFormHTML))
+	template.Must(tpl.New("site_config").Parse(siteConfigHTML))
+	template.Must(tpl.New("site_render").Parse(siteRenderHTML))
+	template.Must(tpl.New("site_logs").Parse(siteLogsHTML))
+	template.Must(tpl.New("site_trace").Parse(siteTraceHTML))
+	template.Must(tpl.New("site_deploy").Parse(siteDeployHTML))
         template.Must(tpl.New("proxy_targets").Parse(proxyTargetsHTML))
 	template.Must(tpl.New("apply_form").Parse(applyFormHTML))
 	template.Must(tpl.New("apply_result").Parse(applyResultHTML))
+	template.Must(tpl.New("apply_runs").Parse(applyRunsHTML))
+	template.Must(tpl.New("apply_history").Parse(applyHistoryHTML))
+	template.Must(tpl.New("dashboard").Parse(dashboardHTML))
 	template.Must(tpl.New("certs").Parse(certsHTML))
 	template.Must(tpl.New("cert_info").Parse(certInfoHTML))
 	template.Must(tpl.New("cert_check").Parse(certCheckHTML))
-
-	return &Server{
+	template.Must(tpl.New("cert_challenge").Parse(certChallengeHTML))
+	template.Must(tpl.New("password_forgot").Parse(passwordForgotHTML))
+	template.Must(tpl.New("password_reset").Parse(passwordResetHTML))
+	template.Must(tpl.New("password_change").Parse(passwordChangeHTML))
+	template.Must(tpl.New("reauth").Parse(reauthHTML))
+	template.Must(tpl.New("forbidden").Parse(forbiddenHTML))
+	template.Must(tpl.New("panel_users").Parse(panelUsersHTML))
+	template.Must(tpl.New("nginx_modules").Parse(nginxModulesHTML))
+	template.Must(tpl.New("approvals").Parse(approvalsHTML))
+	template.Must(tpl.New("jobs").Parse(jobsHTML))
+	template.Must(tpl.New("job").Parse(jobHTML))
+	template.Must(tpl.New("audit").Parse(auditHTML))
+	template.Must(tpl.New("profile").Parse(profileHTML))
+	template.Must(tpl.New("plans").Parse(plansHTML))
+	template.Must(tpl.New("status").Parse(statusHTML))
+	template.Must(tpl.New("uptime").Parse(uptimeHTML))
+	template.Must(tpl.New("tls_report").Parse(tlsReportHTML))
+	template.Must(tpl.New("tls_grade_badge").Parse(tlsGradeBadgeHTML))
+	template.Must(tpl.New("events").Parse(eventsHTML))
+	template.Must(tpl.New("activity").Parse(activityHTML))
+	template.Must(tpl.New("mail").Parse(mailHTML))
+	template.Must(tpl.New("tokens").Parse(tokensHTML))
+	template.Must(tpl.New("nginx_banner").Parse(nginxBannerHTML))
+	template.Must(tpl.New("apply_banner").Parse(applyBannerHTML))
+	template.Must(tpl.New("apply_live").Parse(applyLiveHTML))
+
+	mailer := core.Mailer()
+
+	srv := &Server{
 		cfg:      cfg,
 		paths:    paths,
 		st:       st,
 		core:     core,
-		sessions: NewSessionStore(12 * time.Hour),
+		sessions: newSessionStore(cfg.Security.Session),
 		tpl:      tpl,
-	}, nil
+		i18n:     cat,
+
+		mailer:      mailer,
+		health:      health.NewChecker(cfg.Health, st, mailer),
+		tokenSecret: secret,
+		tokenTTL:    ttl,
+		uploads:     map[string]bool{},
+		limits:      newRateLimits(cfg.API.RateLimit),
+		stopping:    make(chan struct{}),
+		exec:        exec,
+	}
+	if err := srv.initSetup(); err != nil {
+		return nil, err
+	}
+	return srv, nil
 }
 
 func (s *Server) Handler() http.Handler {
@@ -71,46 +174,219 @@ func (s *Server) Handler() http.Handler {
 
 	// auth
 	mux.HandleFunc("/ui/login", s.handleLogin)
+	mux.HandleFunc("/ui/setup", s.handleSetup)
 	mux.HandleFunc("/ui/logout", s.requireAuth(s.handleLogout))
+	mux.HandleFunc("/ui/lang", s.requireAuth(s.handleLang))
+
+	// public status page; uptime (admin); results from external check locations
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/ui/uptime", s.requireAuth(s.handleUptime))
+	if s.cfg.Health.ReportSecret != "" {
+		mux.HandleFunc(health.ReportPath, s.handleHealthReport)
+	}
+
+	// account: password reset (public), forced/voluntary change, email verification
+	mux.HandleFunc("/ui/password/forgot", s.handlePasswordForgot)
+	mux.HandleFunc("/ui/password/reset", s.handlePasswordReset)
+	mux.HandleFunc("/ui/password/change", s.requireAuth(s.handlePasswordChange))
+	mux.HandleFunc("/ui/profile", s.requireAuth(s.handleProfile))
+	mux.HandleFunc("/ui/profile/password", s.requireAuth(s.handlePasswordChange))
+	mux.HandleFunc(reauthPath, s.requireAuth(s.handleReauth))
+	mux.HandleFunc("/ui/email/verify", s.handleEmailVerify)
+
+	// overview (admin)
+	mux.HandleFunc("/ui/dashboard", s.requireAuth(s.handleDashboard))
 
 	// sites
 	mux.HandleFunc("/ui/sites", s.requireAuth(s.handleSites))
-	mux.HandleFunc("/ui/sites/new", s.requireAuth(s.handleSiteNew))
-	mux.HandleFunc("/ui/sites/edit", s.requireAuth(s.handleSiteEdit))
-	mux.HandleFunc("/ui/sites/disable", s.requireAuth(s.handleSiteDisable))
-	mux.HandleFunc("/ui/sites/enable", s.requireAuth(s.handleSiteEnable))
-	mux.HandleFunc("/ui/sites/delete", s.requireAuth(s.handleSiteDelete))
+	mux.HandleFunc("/ui/sites/new", s.requireAuth(s.idempotent(s.handleSiteNew)))
+	mux.HandleFunc("/ui/sites/edit", s.requireAuth(s.idempotent(s.handleSiteEdit)))
+	mux.HandleFunc("/ui/sites/disable", s.requireAuth(s.idempotent(s.handleSiteDisable)))
+	mux.HandleFunc("/ui/sites/enable", s.requireAuth(s.idempotent(s.handleSiteEnable)))
+	mux.HandleFunc("/ui/sites/delete", s.requireAuth(s.requireReauth(s.idempotent(s.handleSiteDelete))))
 
         // proxy targets
         mux.HandleFunc("/ui/sites/targets", s.requireAuth(s.handleProxyTargets))
-        mux.HandleFunc("/ui/sites/targets/add", s.requireAuth(s.handleProxyTargetAdd))
-        mux.HandleFunc("/ui/sites/targets/del", s.requireAuth(s.handleProxyTargetDel))
-
+        mux.HandleFunc("/ui/sites/targets/add", s.requireAuth(s.idempotent(s.handleProxyTargetAdd)))
+        mux.HandleFunc("/ui/sites/targets/del", s.requireAuth(s.idempotent(s.handleProxyTargetDel)))
+        mux.HandleFunc("/ui/sites/cutover", s.requireAuth(s.idempotent(s.handleSiteCutover)))
+        mux.HandleFunc("/ui/sites/mirror", s.requireAuth(s.idempotent(s.handleSiteMirror)))
+        mux.HandleFunc("/ui/sites/discovery", s.requireAuth(s.idempotent(s.handleSiteDiscovery)))
+        mux.HandleFunc("/ui/sites/syslog", s.requireAuth(s.idempotent(s.handleSiteSyslog)))
+        mux.HandleFunc("/ui/sites/logsample", s.requireAuth(s.idempotent(s.handleSiteLogSample)))
+        mux.HandleFunc("/ui/sites/keepalive", s.requireAuth(s.idempotent(s.handleSiteKeepalive)))
+        mux.HandleFunc("/ui/sites/backendhealth", s.requireAuth(s.idempotent(s.handleSiteBackendHealth)))
+        mux.HandleFunc("/ui/sites/redirect", s.requireAuth(s.idempotent(s.handleSiteRedirect)))
+        mux.HandleFunc("/ui/sites/placeholder", s.requireAuth(s.idempotent(s.handleSitePlaceholder)))
+        mux.HandleFunc("/ui/sites/harden", s.requireAuth(s.idempotent(s.handleSiteHarden)))
+        mux.HandleFunc("/ui/sites/reapply", s.requireAuth(s.idempotent(s.handleSiteReapply)))
+        mux.HandleFunc("/ui/sites/config", s.requireAuth(s.handleSiteConfig))
+        mux.HandleFunc("/ui/sites/preview", s.requireAuth(s.handleSiteRender))
+        mux.HandleFunc("/ui/sites/logs", s.requireAuth(s.handleSiteLogs))
+        mux.HandleFunc("/ui/sites/logs/stream", s.requireAuth(s.handleSiteLogStream))
+        mux.HandleFunc("/ui/sites/trace", s.requireAuth(s.handleSiteTrace))
+        mux.HandleFunc("/ui/sites/headers", s.requireAuth(s.idempotent(s.handleSiteHeaders)))
+        mux.HandleFunc("/ui/sites/vars", s.requireAuth(s.idempotent(s.handleSiteVars)))
+        mux.HandleFunc("/ui/sites/preloads", s.requireAuth(s.idempotent(s.handleSitePreloads)))
+        mux.HandleFunc("/ui/sites/expiry", s.requireAuth(s.idempotent(s.handleSiteExpiry)))
+        mux.HandleFunc("/ui/sites/reach", s.requireAuth(s.idempotent(s.handleSiteReach)))
+        // git deploy: save/rotate answer with the webhook secret, so they skip idempotent()
+        mux.HandleFunc("/ui/sites/deploy", s.requireAuth(s.handleSiteDeploy))
+        mux.HandleFunc("/ui/sites/deploy/run", s.requireAuth(s.idempotent(s.handleSiteDeployRun)))
+
+
+	// plans (quotas) + assignment to hosting users
+	mux.HandleFunc("/ui/plans", s.requireAuth(s.handlePlans))
+	mux.HandleFunc("/ui/plans/save", s.requireAuth(s.idempotent(s.handlePlanSave)))
+	mux.HandleFunc("/ui/plans/delete", s.requireAuth(s.idempotent(s.handlePlanDelete)))
+	mux.HandleFunc("/ui/users/plan", s.requireAuth(s.idempotent(s.handleUserPlan)))
+
+	// panel users (admin): the accounts that can sign in to this panel
+	mux.HandleFunc("/ui/users", s.requireAuth(s.handlePanelUsers))
+	mux.HandleFunc("/ui/users/create", s.requireAuth(s.idempotent(s.handlePanelUserCreate)))
+	mux.HandleFunc("/ui/users/update", s.requireAuth(s.idempotent(s.handlePanelUserUpdate)))
+	mux.HandleFunc("/ui/users/delete", s.requireAuth(s.requireReauth(s.idempotent(s.handlePanelUserDelete))))
 
 	// apply
-	mux.HandleFunc("/ui/apply", s.requireAuth(s.handleApply))
+	mux.HandleFunc("/ui/apply", s.requireAuth(s.idempotent(s.handleApply)))
+	mux.HandleFunc("/ui/apply/status", s.requireAuth(s.handleApplyStatus))
+	mux.HandleFunc("/ui/apply/stream", s.requireAuth(s.handleApplyStream))
+	mux.HandleFunc("/ui/apply/runs", s.requireAuth(s.handleApplyRuns))
+	mux.HandleFunc("/ui/apply/history", s.requireAuth(s.handleApplyHistory))
+	mux.HandleFunc("/ui/apply/run", s.requireAuth(s.handleApplyRun))
+
+	// background jobs (cert issue/renew, bulk apply) and their progress
+	mux.HandleFunc("/ui/jobs", s.requireAuth(s.handleJobs))
+	mux.HandleFunc("/ui/jobs/view", s.requireAuth(s.handleJob))
+	mux.HandleFunc("/ui/jobs/status", s.requireAuth(s.handleJobStatus))
+
+	// audit trail of every mutating action (CLI, panel, API)
+	mux.HandleFunc("/ui/audit", s.requireAuth(s.handleAudit))
+
+	// two-person rule (security.approvals): pending site deletes and apply-all runs
+	mux.HandleFunc("/ui/approvals", s.requireAuth(s.handleApprovals))
+	mux.HandleFunc("/ui/approvals/approve", s.requireAuth(s.requireReauth(s.idempotent(s.handleApprovalApprove))))
+	mux.HandleFunc("/ui/approvals/reject", s.requireAuth(s.idempotent(s.handleApprovalReject)))
 
 	// certs
 	mux.HandleFunc("/ui/certs", s.requireAuth(s.handleCerts))
 	mux.HandleFunc("/ui/cert/info", s.requireAuth(s.handleCertInfo))
-	mux.HandleFunc("/ui/cert/issue", s.requireAuth(s.handleCertIssue))
-	mux.HandleFunc("/ui/cert/renew", s.requireAuth(s.handleCertRenew))
+	mux.HandleFunc("/ui/cert/issue", s.requireAuth(s.idempotent(s.handleCertIssue)))
+	mux.HandleFunc("/ui/cert/renew", s.requireAuth(s.idempotent(s.handleCertRenew)))
+	mux.HandleFunc("/ui/cert/revoke", s.requireAuth(s.requireReauth(s.idempotent(s.handleCertRevoke))))
 	mux.HandleFunc("/ui/cert/check", s.requireAuth(s.handleCertCheck))
+	mux.HandleFunc("/ui/cert/dual", s.requireAuth(s.idempotent(s.handleCertDual)))
+	mux.HandleFunc("/ui/cert/source", s.requireAuth(s.idempotent(s.handleCertSource)))
+	mux.HandleFunc("/ui/cert/ca", s.requireAuth(s.idempotent(s.handleCertCA)))
+	mux.HandleFunc("/ui/cert/dns", s.requireAuth(s.idempotent(s.handleCertDNS)))
+	mux.HandleFunc("/ui/cert/challenge", s.requireAuth(s.idempotent(s.handleCertChallenge)))
+	mux.HandleFunc("/ui/tls", s.requireAuth(s.handleTLSReport))
+	mux.HandleFunc("/ui/tls/scan", s.requireAuth(s.idempotent(s.handleTLSScan)))
+
+	// nginx supervision and event log
+	mux.HandleFunc("/ui/events", s.requireAuth(s.handleEvents))
+	mux.HandleFunc("/ui/activity", s.requireAuth(s.handleActivity))
+	mux.HandleFunc("/ui/mail", s.requireAuth(s.handleMail))
+	mux.HandleFunc("/ui/mail/test", s.requireAuth(s.idempotent(s.handleMailTest)))
+	// API tokens: create/rotate answer with the new secret, so they skip idempotent()
+	mux.HandleFunc("/ui/tokens", s.requireAuth(s.handleTokens))
+	mux.HandleFunc("/ui/tokens/create", s.requireAuth(s.handleTokenCreate))
+	mux.HandleFunc("/ui/tokens/rotate", s.requireAuth(s.handleTokenRotate))
+	mux.HandleFunc("/ui/tokens/revoke", s.requireAuth(s.idempotent(s.handleTokenRevoke)))
+	mux.HandleFunc("/ui/nginx/start", s.requireAuth(s.idempotent(s.handleNginxControl)))
+	mux.HandleFunc("/ui/nginx/restart", s.requireAuth(s.idempotent(s.handleNginxControl)))
+	mux.HandleFunc("/ui/nginx/modules", s.requireAuth(s.handleNginxModules))
+	mux.HandleFunc("/ui/nginx/modules/set", s.requireAuth(s.idempotent(s.handleNginxModuleSet)))
+
+	// JSON API (bearer tokens); also routes the signed push webhooks of git deploys
+	mux.HandleFunc(apiPrefix, s.handleAPI)
+
+	// Prometheus metrics (api.tokens bearer), unless on api.metrics_listen
+	if s.cfg.API.MetricsListen == "" {
+		mux.HandleFunc(MetricsPath, s.handleMetrics)
+	}
+
+	// cluster agent API (sealed node-to-node calls)
+	if s.core.Cluster().Enabled() {
+		mux.HandleFunc(cluster.PathLock, s.handleAgentLock)
+		mux.HandleFunc(cluster.PathCert, s.handleAgentCert)
+		mux.HandleFunc(cluster.PathSnapshot, s.handleAgentSnapshot)
+	}
 
-	return mux
+	return s.instrument(mux, s.realIP(s.rateLimit(s.limitRequests(s.statusHostOnly(s.allowIPs(s.audit(mux)))))))
 }
 
 func (s *Server) Serve(ctx context.Context, listen string) error {
+	lim := s.cfg.API.Limits.Durations()
 	srv := &http.Server{
 		Addr:              listen,
 		Handler:           s.Handler(),
-		ReadHeaderTimeout: 10 * time.Second,
+		ReadHeaderTimeout: lim.ReadHeader,
+		ReadTimeout:       lim.Read,
+		WriteTimeout:      lim.Write,
+		IdleTimeout:       lim.Idle,
+		MaxHeaderBytes:    s.cfg.API.Limits.MaxHeaderKB << 10,
 	}
+	srv.RegisterOnShutdown(func() {
+		close(s.stopping)
+		_, _ = sdnotify.Notify("STOPPING=1")
+	})
 	go func() {
 		<-ctx.Done()
 		_ = srv.Shutdown(context.Background())
 	}()
-	return srv.ListenAndServe()
+	if s.cfg.API.MetricsListen != "" {
+		go s.serveMetrics(ctx, s.cfg.API.MetricsListen)
+	}
+	if s.cfg.Health.Enabled {
+		go s.health.Run(ctx)
+	}
+	if s.cfg.TLSScan.Enabled {
+		go s.core.RunTLSScans(ctx)
+	}
+	if s.cfg.Supervisor.Enabled {
+		go s.core.RunSupervisor(ctx)
+	}
+	if s.cfg.Expiry.Enabled {
+		go s.core.RunSiteExpiry(ctx, s.mailer)
+	}
+	go s.core.RunJobs(ctx)
+	go s.core.RunPlaceholders(ctx)
+	go s.core.RunRetired(ctx)
+	go s.core.RunReapply(ctx)
+	go s.core.RunDiscovery(ctx)
+	go s.core.RunNameCheck(ctx)
+	if s.cfg.Cluster.Standby.Primary != "" {
+		go s.core.RunStandby(ctx)
+	}
+	if s.mailer.Enabled() {
+		go s.mailer.RunQueue(ctx)
+	}
+	if s.cfg.Saturation.Enabled {
+		go s.core.RunSaturation(ctx, s.mailer)
+	}
+	if s.cfg.Snapshots.Enabled {
+		go s.core.RunSnapshots(ctx, s.mailer)
+	}
+	if s.cfg.GC.Enabled {
+		go s.core.RunGC(ctx)
+	}
+	if err := s.core.CheckSitesIncluded(); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	if err := s.core.SyncSFTPJails(); err != nil {
+		log.Printf("sftp: %v", err)
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	// listening: systemd (Type=notify) may start what depends on the panel
+	if _, err := sdnotify.Notify("READY=1\nSTATUS=listening on " + listen); err != nil {
+		log.Printf("sd_notify: %v", err)
+	}
+	go s.runWatchdog(ctx, listen)
+	return srv.Serve(ln)
 }
 
 func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
@@ -120,7 +396,24 @@ func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 			http.Redirect(w, r, "/ui/login", http.StatusFound)
 			return
 		}
+		// a disabled or deleted account, or a password changed elsewhere, ends the session
+		u, err := s.st.GetPanelUserByID(sess.UserID)
+		if err != nil || !u.Enabled || sess.Stamp != auth.Stamp(u.PasswordHash) {
+			s.sessions.Delete(sess.Token)
+			http.Redirect(w, r, "/ui/login", http.StatusFound)
+			return
+		}
+		if sess.MustChangePassword && !allowedDuringForcedChange(r.URL.Path) {
+			http.Redirect(w, r, "/ui/password/change", http.StatusFound)
+			return
+		}
+		setAuditActor(r, sess.Username)
+		allowed := s.authorize(r, &sess, u)
 		ctx := context.WithValue(r.Context(), ctxSession, sess)
+		if !allowed {
+			s.forbidden(w, r.WithContext(ctx))
+			return
+		}
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -170,21 +463,43 @@ func (s *Server) render(w http.ResponseWriter, r *http.Request, title, page stri
 	}
 	data["Title"] = title
 	data["Page"] = page
+	data["Languages"] = s.i18n.Languages()
+	data["IdemKey"] = newIdemKey()
 	if sess, ok := s.sessionFromCtx(r); ok {
 		data["Authed"] = true
 		data["Session"] = sess
+		data["Lang"] = s.lang(r)
+		if s.cfg.Supervisor.Enabled {
+			data["Nginx"] = s.core.NginxState()
+		}
+		data["Apply"] = s.core.ApplyStatus()
+		data["Approvals"] = s.core.ApprovalsRequired()
 	} else {
 		data["Authed"] = false
+		data["Lang"] = s.i18n.FromRequest(r)
 	}
 	_ = s.tpl.ExecuteTemplate(w, "layout", data)
 }
 
+// lang returns the UI language for the current request (session preference first).
+func (s *Server) lang(r *http.Request) string {
+	if sess, ok := s.sessionFromCtx(r); ok && s.i18n.Has(sess.Lang) {
+		return sess.Lang
+	}
+	return s.i18n.FromRequest(r)
+}
+
 // ---------------- auth ----------------
 
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	lang := s.i18n.FromRequest(r)
 	switch r.Method {
 	case http.MethodGet:
-		_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": ""})
+		if s.needsSetup() {
+			http.Redirect(w, r, "/ui/setup", http.StatusFound)
+			return
+		}
+		_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "", "Lang": lang, "CanReset": s.mailLinks()})
 		return
 
 	case http.MethodPost:
@@ -194,22 +509,34 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 		u, err := s.st.GetPanelUserByUsername(username)
 		if err != nil || !u.Enabled {
-			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "Invalid credentials"})
+			s.core.Audit("warning", "auth", "login failed for %q from %s (unknown or disabled user)", username, remoteHost(r))
+			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "login.invalid", "Lang": lang, "CanReset": s.mailLinks()})
 			return
 		}
 		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(pass)) != nil {
-			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "Invalid credentials"})
+			s.core.AuditOwner(u.Username, "warning", "auth", "login failed for %q from %s (bad password)", username, remoteHost(r))
+			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "login.invalid", "Lang": lang, "CanReset": s.mailLinks()})
 			return
 		}
 
-		sess, err := s.sessions.New(u.ID, u.Username, u.Role)
+		if s.i18n.Has(u.Language) {
+			lang = u.Language
+		}
+		sess, err := s.sessions.New(u.ID, u.Username, u.Role, lang)
 		if err != nil {
-			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "Login failed"})
+			_ = s.tpl.ExecuteTemplate(w, "login", map[string]any{"Error": "login.failed", "Lang": lang})
 			return
 		}
 
+		s.sessions.SetStamp(sess.Token, auth.Stamp(u.PasswordHash))
 		_ = s.st.UpdatePanelUserLastLogin(u.ID)
+		s.core.AuditOwner(u.Username, "info", "auth", "login %q (%s) from %s", u.Username, u.Role, remoteHost(r))
 		s.setSessionCookie(w, r, sess.Token)
+		if u.MustChangePassword {
+			s.sessions.SetMustChangePassword(sess.Token, true)
+			http.Redirect(w, r, "/ui/password/change", http.StatusFound)
+			return
+		}
 		http.Redirect(w, r, "/ui/sites", http.StatusFound)
 		return
 
@@ -230,44 +557,205 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 // ---------------- sites ----------------
 
 func (s *Server) handleSites(w http.ResponseWriter, r *http.Request) {
-	items, err := s.core.SiteList(r.Context())
+	sortBy := "domain"
+	for _, c := range store.SiteSortColumns {
+		if c == r.URL.Query().Get("sort") {
+			sortBy = c
+		}
+	}
+	desc := r.URL.Query().Get("desc") == "1"
+	sess, _ := s.sessionFromCtx(r)
+	f := siteFilterFromQuery(r.URL.Query(), sess)
+	opts := store.SiteListOptions{Sort: sortBy, Desc: desc, Owner: f.Owner, Search: f.Search, Mode: f.Mode, State: f.State}
+	total, err := s.core.SiteListCount(opts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-        // Optional enrich for UI: owner username + cert info
-        owners := map[string]string{}
-        certs := map[string]any{} // domain -> *certs.CertInfo (stored as interface for templates)
-        for _, it := range items {
-                if it.Site.UserID != 0 {
-                        if u, err := s.st.GetUserByID(it.Site.UserID); err == nil {
-                                owners[it.Site.Domain] = u.Username
-                        }
+	page := 1
+	if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && n > 1 {
+		page = n
+	}
+	pages := (total + sitesPerPage - 1) / sitesPerPage
+	if page > pages && pages > 0 {
+		page = pages
+	}
+	opts.Limit, opts.Offset = sitesPerPage, (page-1)*sitesPerPage
+	items, err := s.core.SiteListQuery(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+        usage := map[string]usageBadge{}
+        if uu, err := s.core.UserUsageList(); err == nil {
+                usage = usageBadges(uu)
+        }
+
+        // drift is about the whole nginx tree: admins only
+        var drift *app.DriftReport
+        if sess.Admin() {
+                if rep, err := s.core.Drift(); err != nil {
+                        log.Printf("drift: %v", err)
+                } else if !rep.Empty() {
+                        drift = &rep
                 }
-                if ci, err := s.core.CertInfo(it.Site.Domain); err == nil && ci != nil && ci.Exists {
-                        certs[it.Site.Domain] = ci
+        }
+
+        // so are server_name conflicts: they involve foreign files and other owners' sites
+        var conflicts []app.NameConflict
+        if sess.Admin() {
+                if conflicts, err = s.core.ServerNameConflicts(); err != nil {
+                        log.Printf("server names: %v", err)
                 }
         }
 
         s.render(w, r, "Sites", "sites", map[string]any{
-                "Items":  items,
-                "Owners": owners,
-                "Certs":  certs,
+                "Items":     items,
+                "Cols":      siteSortCols(sortBy, desc, f.query()),
+                "Sort":      sortBy,
+                "Desc":      desc,
+                "Filter":    f,
+                "Pager":     newSitePager(page, pages, total, len(items), sortBy, desc, f.query()),
+                "Modes":     []string{"php", "proxy", "static", "redirect"},
+                "States":    store.SiteStates,
+                "Usage":     usage,
+                "Drift":     drift,
+                "Conflicts": conflicts,
+                "Now":       time.Now(),
         })
 
 }
 
+// siteSortCol is a sortable column header of the site list.
+type siteSortCol struct {
+	Label string // locale key
+	Href  string
+	Arrow string // "▲"/"▼" on the current sort column
+}
+
+// siteSortCols are the site list headers: clicking the current sort column flips
+// its direction, any other column sorts ascending by it. filter (the encoded
+// filters of the list) is kept; the page goes back to the first.
+func siteSortCols(sortBy string, desc bool, filter string) map[string]siteSortCol {
+	labels := map[string]string{"cert": "col.tls"}
+	out := map[string]siteSortCol{}
+	for _, c := range store.SiteSortColumns {
+		col := siteSortCol{Label: labels[c], Href: "/ui/sites?sort=" + c}
+		if filter != "" {
+			col.Href += "&" + filter
+		}
+		if col.Label == "" {
+			col.Label = "col." + c
+		}
+		if c == sortBy {
+			col.Arrow = "▲"
+			if desc {
+				col.Arrow = "▼"
+			} else {
+				col.Href += "&desc=1"
+			}
+		}
+		out[c] = col
+	}
+	return out
+}
+
+// sitesPerPage is the page size of the site list.
+const sitesPerPage = 50
+
+// siteFilter is the search form of the site list.
+type siteFilter struct {
+	Search, Owner, Mode, State string
+}
+
+// siteFilterFromQuery reads the filters of the site list from q, dropping values
+// that are not a mode or state. A role=user session only ever sees its own sites.
+func siteFilterFromQuery(q url.Values, sess Session) siteFilter {
+	f := siteFilter{
+		Search: strings.TrimSpace(q.Get("q")),
+		Owner:  strings.TrimSpace(q.Get("owner")),
+		Mode:   strings.ToLower(q.Get("mode")),
+		State:  strings.ToUpper(q.Get("state")),
+	}
+	switch f.Mode {
+	case "php", "proxy", "static", "redirect":
+	default:
+		f.Mode = ""
+	}
+	if !slices.Contains(store.SiteStates, f.State) {
+		f.State = ""
+	}
+	if !sess.Admin() {
+		f.Owner = sess.Owner
+	}
+	return f
+}
+
+// query encodes the filters for links ("" when none is set); the owner of a
+// role=user session is implied, not linked.
+func (f siteFilter) query() string {
+	v := url.Values{}
+	for k, val := range map[string]string{"q": f.Search, "owner": f.Owner, "mode": f.Mode, "state": f.State} {
+		if val != "" {
+			v.Set(k, val)
+		}
+	}
+	return v.Encode()
+}
+
+// Set reports whether any filter beyond the implied owner of sess is set.
+func (f siteFilter) Set(sess Session) bool {
+	return f.Search != "" || f.Mode != "" || f.State != "" || (f.Owner != "" && sess.Admin())
+}
+
+// sitePager is the paging line under the site list.
+type sitePager struct {
+	Page, Pages, Total int
+	From, To           int // 1-based rows shown
+	Prev, Next         string
+}
+
+func newSitePager(page, pages, total, shown int, sortBy string, desc bool, filter string) sitePager {
+	p := sitePager{Page: page, Pages: pages, Total: total}
+	if shown > 0 {
+		p.From = (page-1)*sitesPerPage + 1
+		p.To = p.From + shown - 1
+	}
+	link := func(n int) string {
+		v, _ := url.ParseQuery(filter)
+		v.Set("sort", sortBy)
+		if desc {
+			v.Set("desc", "1")
+		}
+		v.Set("page", strconv.Itoa(n))
+		return "/ui/sites?" + v.Encode()
+	}
+	if page > 1 {
+		p.Prev = link(page - 1)
+	}
+	if page < pages {
+		p.Next = link(page + 1)
+	}
+	return p
+}
+
 func (s *Server) handleSiteNew(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
+		sess, _ := s.sessionFromCtx(r)
 		s.render(w, r, "Add Site", "site_form", map[string]any{
 			"Mode": "new",
 			"Form": map[string]any{
+				"user":      sess.Owner,
 				"mode":      "php",
 				"http3":     "true",
 				"provision": "true",
 				"applynow":  "true",
                                 "targets":   "",
+
+				"redirect_code": "301",
+				"keep_path":     "false",
 			},
 		})
 		return
@@ -288,6 +776,21 @@ func (s *Server) handleSiteNew(w http.ResponseWriter, r *http.Request) {
 			SkipCert:  parseBool(r.FormValue("skipcert"), false),
 			ApplyNow:  parseBool(r.FormValue("applynow"), true),
                         ProxyTargets: targets,
+
+			RedirectTo:       strings.TrimSpace(r.FormValue("redirect_to")),
+			RedirectKeepPath: parseBool(r.FormValue("keep_path"), false),
+			Placeholder:      parseBool(r.FormValue("placeholder"), false),
+			Hardened:         parseBool(r.FormValue("hardened"), false),
+			DNSRecords:       parseBool(r.FormValue("dns_records"), false),
+		}
+		req.RedirectCode, _ = strconv.Atoi(strings.TrimSpace(r.FormValue("redirect_code")))
+
+		if sess, _ := s.sessionFromCtx(r); !sess.Admin() {
+			req.User, req.Webroot = sess.Owner, ""
+			if err := s.userSiteAdd(sess, req.Domain, req.Mode); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 		}
 
 		// Avoid "apply-now failed" warnings for proxy mode.
@@ -306,6 +809,13 @@ func (s *Server) handleSiteNew(w http.ResponseWriter, r *http.Request) {
 					"skipcert":  boolStr(req.SkipCert),
 					"applynow":  boolStr(req.ApplyNow),
 					"targets":   targetsRaw,
+
+					"redirect_to":   req.RedirectTo,
+					"redirect_code": strconv.Itoa(req.RedirectCode),
+					"keep_path":     boolStr(req.RedirectKeepPath),
+					"placeholder":   boolStr(req.Placeholder),
+					"hardened":      boolStr(req.Hardened),
+					"dns_records":   boolStr(req.DNSRecords),
 				},
 			})
 			return
@@ -328,6 +838,13 @@ func (s *Server) handleSiteNew(w http.ResponseWriter, r *http.Request) {
 					"skipcert":  boolStr(req.SkipCert),
 					"applynow":  boolStr(req.ApplyNow),
                                         "targets":   targetsRaw,
+
+					"redirect_to":   req.RedirectTo,
+					"redirect_code": strconv.Itoa(req.RedirectCode),
+					"keep_path":     boolStr(req.RedirectKeepPath),
+					"placeholder":   boolStr(req.Placeholder),
+					"hardened":      boolStr(req.Hardened),
+					"dns_records":   boolStr(req.DNSRecords),
 				},
 			})
 			return
@@ -362,8 +879,53 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
                         }
                 }
 
+		expiresAt := ""
+		if cur.ExpiresAt != nil {
+			expiresAt = cur.ExpiresAt.Local().Format("2006-01-02T15:04")
+		}
+
+		history, err := s.core.SiteApplyHistory(cur.Domain, 10)
+		if err != nil {
+			log.Printf("apply history %s: %v", cur.Domain, err)
+		}
+		headers, err := s.core.SiteHeaders(r.Context(), cur.Domain)
+		if err != nil {
+			log.Printf("headers %s: %v", cur.Domain, err)
+		}
+		preloads, err := s.core.SitePreloads(r.Context(), cur.Domain)
+		if err != nil {
+			log.Printf("preloads %s: %v", cur.Domain, err)
+		}
+		vars, err := s.core.SiteVars(r.Context(), cur.Domain)
+		if err != nil {
+			log.Printf("template vars %s: %v", cur.Domain, err)
+		}
+		var hardening []app.HardeningCheck
+		if cur.Mode == "" || cur.Mode == "php" {
+			if hardening, err = s.core.SiteHardening(r.Context(), cur.Domain); err != nil {
+				log.Printf("hardening %s: %v", cur.Domain, err)
+			}
+		}
+		var reach *app.ReachReport
+		if rep, err := s.core.SiteReach(cur.Domain); err == nil {
+			reach = &rep
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("reach %s: %v", cur.Domain, err)
+		}
+
+		w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(cur.Revision, 10)))
 		s.render(w, r, "Edit Site", "site_form", map[string]any{
-			"Mode": "edit",
+			"Mode":     "edit",
+			"History":  history,
+			"Headers":  headers,
+			"Preloads": preloads,
+			"Vars":     vars,
+			"Reach":    reach,
+
+			"Hardening": hardening,
+
+			"KeepaliveDefault": s.cfg.Hosting.UpstreamKeepalive,
+			"BackendHealth":    s.cfg.Health.Backend,
 			"Form": map[string]any{
 				"domain":   cur.Domain,
                                 "user":     owner,
@@ -373,6 +935,22 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
 				"http3":    boolStr(cur.EnableHTTP3),
 				"enabled":  boolStr(cur.Enabled),
 				"applynow": "false",
+				"revision": strconv.FormatInt(cur.Revision, 10),
+
+				"access_syslog": cur.AccessSyslog,
+				"log_sample":    cur.AccessLogSample,
+				"ka_conns":      intOrEmpty(cur.KeepaliveConns),
+				"ka_requests":   intOrEmpty(cur.KeepaliveRequests),
+				"ka_timeout":    cur.KeepaliveTimeout,
+				"backend_health": cur.BackendHealth,
+				"redirect_to":   cur.RedirectURL,
+				"redirect_code": strconv.Itoa(cur.RedirectCode),
+				"keep_path":     boolStr(cur.RedirectKeepPath),
+				"placeholder":   boolStr(cur.Placeholder),
+				"hardened":      boolStr(cur.Hardened),
+				"reapply_cron":  cur.ReapplyCron,
+				"expires_at":    expiresAt,
+				"expiry_notify": cur.ExpiryNotify,
 			},
 		})
 		return
@@ -394,6 +972,15 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
 			HTTP3:    &http3,
 			Enabled:  &enabled,
 			ApplyNow: applyNow,
+
+			ExpectedRevision: expectedRevision(r),
+		}
+		if sess, _ := s.sessionFromCtx(r); !sess.Admin() {
+			req.User, req.Webroot = "", ""
+			if err := s.userSiteMode(domain, req.Mode); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 		}
 
 
@@ -428,6 +1015,7 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
 							"http3":    boolStr(http3),
 							"enabled":  boolStr(enabled),
 							"applynow": boolStr(applyNow),
+							"revision": r.FormValue("revision"),
 						},
 					})
 					return
@@ -437,9 +1025,15 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
 
 		updated, err := s.core.SiteEdit(r.Context(), req)
 		if err != nil {
+			msg := err.Error()
+			if errors.Is(err, store.ErrRevisionConflict) {
+				msg = s.i18n.T(s.lang(r), "site_form.conflict")
+				w.WriteHeader(http.StatusConflict)
+			}
 			s.render(w, r, "Edit Site", "site_form", map[string]any{
 				"Mode":  "edit",
-				"Error": err.Error(),
+				"Error": msg,
+				"Reload": errors.Is(err, store.ErrRevisionConflict),
 				"Form": map[string]any{
 					"domain":   req.Domain,
 					"user":     req.User,
@@ -449,6 +1043,7 @@ func (s *Server) handleSiteEdit(w http.ResponseWriter, r *http.Request) {
 					"http3":    boolStr(http3),
 					"enabled":  boolStr(enabled),
 					"applynow": boolStr(applyNow),
+					"revision": r.FormValue("revision"),
 				},
 			})
 			return
@@ -472,6 +1067,23 @@ func (s *Server) handleSiteDisable(w http.ResponseWriter, r *http.Request) {
 	}
 	_ = r.ParseForm()
 	domain := strings.TrimSpace(r.FormValue("domain"))
+
+	// retire = "<status>:<grace>" disables gracefully (e.g. "410:24h")
+	if v := strings.TrimSpace(r.FormValue("retire")); v != "" {
+		code, grace, _ := strings.Cut(v, ":")
+		status, _ := strconv.Atoi(code)
+		d, err := time.ParseDuration(grace)
+		if err != nil {
+			http.Error(w, "invalid grace period "+strconv.Quote(grace), http.StatusBadRequest)
+			return
+		}
+		if _, err := s.core.SiteRetire(r.Context(), domain, d, status); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/ui/sites", http.StatusFound)
+		return
+	}
 	if err := s.core.SiteDisable(r.Context(), domain); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -501,6 +1113,10 @@ func (s *Server) handleSiteDelete(w http.ResponseWriter, r *http.Request) {
     }
     _ = r.ParseForm()
     domain := strings.TrimSpace(r.FormValue("domain"))
+    if s.core.ApprovalsRequired() {
+        s.requestChange(w, r, func(by string) (store.ChangeRequest, error) { return s.core.RequestSiteDelete(domain, by) })
+        return
+    }
     if err := s.core.SiteDelete(r.Context(), domain); err != nil {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
@@ -520,7 +1136,11 @@ func (s *Server) handleProxyTargets(w http.ResponseWriter, r *http.Request) {
                 http.Error(w, "domain is required", http.StatusBadRequest)
                 return
         }
+        s.renderProxyTargets(w, r, domain, "")
+}
 
+// renderProxyTargets shows the targets page, optionally with an error from a failed change.
+func (s *Server) renderProxyTargets(w http.ResponseWriter, r *http.Request, domain, errMsg string) {
         site, err := s.core.SiteGet(r.Context(), domain)
         if err != nil {
                 http.Error(w, err.Error(), http.StatusBadRequest)
@@ -537,9 +1157,32 @@ func (s *Server) handleProxyTargets(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
+        // distinct named groups, in first-seen order, for the cutover buttons
+        var groups []string
+        seen := map[string]bool{}
+        for _, t := range targets {
+                if t.Group != "" && !seen[t.Group] {
+                        seen[t.Group] = true
+                        groups = append(groups, t.Group)
+                }
+        }
+
+        // per-target traffic over the last minutes (best-effort: the page works without it)
+        targetStats, err := s.core.ProxyTargetStats(r.Context(), domain)
+        if err != nil {
+                log.Printf("targets: stats for %s: %v", domain, err)
+        }
+
+        kind, name, _ := strings.Cut(site.Discovery, ":")
         s.render(w, r, "Proxy Targets", "proxy_targets", map[string]any{
                 "Site":    site,
                 "Targets": targets,
+                "Groups":  groups,
+                "Stats":   targetStats,
+                "Error":   errMsg,
+
+                "DiscoveryKind": kind,
+                "DiscoveryName": name,
         })
 }
 
@@ -560,17 +1203,12 @@ func (s *Server) handleProxyTargetAdd(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        site, err := s.core.SiteGet(r.Context(), domain)
-        if err != nil {
-                http.Error(w, err.Error(), http.StatusBadRequest)
-                return
-        }
-        if strings.TrimSpace(site.Mode) != "proxy" {
-                http.Error(w, "site is not in proxy mode", http.StatusBadRequest)
-                return
-        }
-
-        if err := s.st.UpsertProxyTarget(site.ID, target, weight, backup, enabled); err != nil {
+        if err := s.core.ProxyTargetUpsert(r.Context(), domain, target, weight, backup, enabled, r.FormValue("group")); err != nil {
+                if errors.Is(err, app.ErrPlanLimit) {
+                        w.WriteHeader(http.StatusForbidden)
+                        s.renderProxyTargets(w, r, domain, err.Error())
+                        return
+                }
                 http.Error(w, err.Error(), http.StatusBadRequest)
                 return
         }
@@ -603,76 +1241,587 @@ func (s *Server) handleProxyTargetDel(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/ui/sites/targets?domain="+url.QueryEscape(domain), http.StatusFound)
 }
 
-
-
-
-
-// ---------------- apply ----------------
-
-func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.render(w, r, "Apply", "apply_form", map[string]any{})
-		return
-
-	case http.MethodPost:
-		_ = r.ParseForm()
-		domain := strings.TrimSpace(r.FormValue("domain"))
-		all := parseBool(r.FormValue("all"), false)
-		dry := parseBool(r.FormValue("dry"), false)
-		limit, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("limit")))
-
-		res, err := s.core.Apply(r.Context(), app.ApplyRequest{
-			Domain: domain,
-			All:    all,
-			DryRun: dry,
-			Limit:  limit,
-		})
-		if err != nil {
-			s.render(w, r, "Apply Result", "apply_result", map[string]any{
-				"Result": res,
-				"Error":  err.Error(),
-			})
-			return
-		}
-
-		s.render(w, r, "Apply Result", "apply_result", map[string]any{
-			"Result": res,
-		})
-		return
-
-	default:
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-	}
+// handleSiteCutover switches the proxy upstream to another target group (blue/green).
+func (s *Server) handleSiteCutover(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+        }
+        _ = r.ParseForm()
+        domain := strings.TrimSpace(r.FormValue("domain"))
+        if domain == "" {
+                http.Error(w, "domain is required", http.StatusBadRequest)
+                return
+        }
+        if err := s.core.SiteCutover(r.Context(), domain, r.FormValue("group")); err != nil {
+                w.WriteHeader(http.StatusConflict)
+                s.renderProxyTargets(w, r, domain, err.Error())
+                return
+        }
+        http.Redirect(w, r, "/ui/sites/targets?domain="+url.QueryEscape(domain), http.StatusFound)
 }
 
-// ---------------- certs ----------------
+// handleSiteMirror sets or clears the shadow upstream of a proxy site.
+func (s *Server) handleSiteMirror(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost {
+                http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+                return
+        }
+        _ = r.ParseForm()
+        domain := strings.TrimSpace(r.FormValue("domain"))
+        if domain == "" {
+                http.Error(w, "domain is required", http.StatusBadRequest)
+                return
+        }
+        target := strings.TrimSpace(r.FormValue("target"))
+        if parseBool(r.FormValue("off"), false) {
+                target = ""
+        }
+        percent, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("percent")))
+        if err := s.core.SiteMirror(r.Context(), domain, target, percent); err != nil {
+                w.WriteHeader(http.StatusBadRequest)
+                s.renderProxyTargets(w, r, domain, err.Error())
+                return
+        }
+        http.Redirect(w, r, "/ui/sites/targets?domain="+url.QueryEscape(domain), http.StatusFound)
+}
 
-func (s *Server) handleCerts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleSiteDiscovery sets or clears where a proxy site's targets are discovered.
+func (s *Server) handleSiteDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	items, err := s.core.CertList()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
-	s.render(w, r, "Certificates", "certs", map[string]any{"Items": items})
-}
-
-func (s *Server) handleCertInfo(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+	spec := ""
+	if name := strings.TrimSpace(r.FormValue("name")); name != "" && !parseBool(r.FormValue("off"), false) {
+		spec = r.FormValue("kind") + ":" + name
 	}
-	d := strings.TrimSpace(r.URL.Query().Get("domain"))
-	info, err := s.core.CertInfo(d)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if _, err := s.core.SiteDiscovery(r.Context(), domain, spec); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		s.renderProxyTargets(w, r, domain, err.Error())
 		return
 	}
-	s.render(w, r, "Certificate Info", "cert_info", map[string]any{"Info": info})
+	http.Redirect(w, r, "/ui/sites/targets?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+
+
+
+
+func (s *Server) handleSiteSyslog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	server := strings.TrimSpace(r.FormValue("server"))
+	if parseBool(r.FormValue("off"), false) {
+		server = ""
+	}
+	if err := s.core.SiteAccessSyslog(r.Context(), domain, server); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteLogSample(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	sample := strings.TrimSpace(r.FormValue("sample"))
+	if sample == "rate" {
+		sample = "1/" + strings.TrimSpace(r.FormValue("rate"))
+	}
+	if err := s.core.SiteAccessLogSample(r.Context(), domain, sample); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+// handleSiteKeepalive sets the upstream keepalive pool of a proxy site; empty
+// fields follow hosting.upstream_keepalive.
+func (s *Server) handleSiteKeepalive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var n [2]int
+	for i, k := range []string{"connections", "requests"} {
+		if v := strings.TrimSpace(r.FormValue(k)); v != "" {
+			var err error
+			if n[i], err = strconv.Atoi(v); err != nil {
+				http.Error(w, k+" must be a number", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if err := s.core.SiteKeepalive(r.Context(), domain, n[0], n[1], r.FormValue("timeout")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+// handleSiteBackendHealth exposes (or, with an empty path, stops exposing) the
+// backend health endpoint of a proxy site.
+func (s *Server) handleSiteBackendHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SiteBackendHealth(r.Context(), domain, r.FormValue("path")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteRedirect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	code, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("redirect_code")))
+	if err := s.core.SiteRedirect(r.Context(), domain, r.FormValue("redirect_to"), code, parseBool(r.FormValue("keep_path"), false)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSitePlaceholder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SitePlaceholder(r.Context(), domain, !parseBool(r.FormValue("off"), false)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteHarden(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SiteHarden(r.Context(), domain, !parseBool(r.FormValue("off"), false)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+// handleSiteReapply sets or clears the re-render schedule of a site.
+func (s *Server) handleSiteReapply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	expr := r.FormValue("cron")
+	if parseBool(r.FormValue("off"), false) {
+		expr = ""
+	}
+	if err := s.core.SiteReapply(domain, expr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteHeaders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if name := strings.TrimSpace(r.FormValue("remove")); name != "" {
+		err = s.core.SiteHeaderRemove(r.Context(), domain, name)
+	} else {
+		err = s.core.SiteHeaderSet(r.Context(), domain, r.FormValue("name"), r.FormValue("value"), parseBool(r.FormValue("hide"), false))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+// handleSiteVars sets or removes a template variable of a site.
+func (s *Server) handleSiteVars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if name := strings.TrimSpace(r.FormValue("remove")); name != "" {
+		err = s.core.SiteVarRemove(r.Context(), domain, name)
+	} else {
+		err = s.core.SiteVarSet(r.Context(), domain, r.FormValue("name"), r.FormValue("value"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSitePreloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if u := strings.TrimSpace(r.FormValue("remove")); u != "" {
+		err = s.core.SitePreloadRemove(r.Context(), domain, u)
+	} else {
+		err = s.core.SitePreloadSet(r.Context(), domain, r.FormValue("url"), r.FormValue("as"), parseBool(r.FormValue("crossorigin"), false))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteExpiry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var at *time.Time
+	if v := strings.TrimSpace(r.FormValue("at")); v != "" && !parseBool(r.FormValue("off"), false) {
+		t, err := app.ParseExpiry(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		at = &t
+	}
+	if err := s.core.SiteExpiry(r.Context(), domain, at, r.FormValue("notify")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+func (s *Server) handleSiteReach(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	domain := strings.TrimSpace(r.FormValue("domain"))
+	if domain == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+	if _, err := s.core.SiteReachCheck(ctx, domain); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/sites/edit?domain="+url.QueryEscape(domain), http.StatusFound)
+}
+
+// ---------------- apply ----------------
+
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.render(w, r, "Apply", "apply_form", map[string]any{})
+		return
+
+	case http.MethodPost:
+		_ = r.ParseForm()
+		domain := strings.TrimSpace(r.FormValue("domain"))
+		all := parseBool(r.FormValue("all"), false)
+		dry := parseBool(r.FormValue("dry"), false)
+		limit, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("limit")))
+
+		// without a domain an apply touches every pending site: that is only done as
+		// an apply of all sites, behind approvals and as a job
+		if domain == "" && !all && !dry {
+			http.Error(w, "domain is required (or all)", http.StatusBadRequest)
+			return
+		}
+		if all && !dry && s.core.ApprovalsRequired() {
+			s.requestChange(w, r, func(by string) (store.ChangeRequest, error) { return s.core.RequestApplyAll(limit, by) })
+			return
+		}
+		actor := ""
+		if sess, ok := s.sessionFromCtx(r); ok {
+			actor = sess.Username
+		}
+		// a bulk apply runs as a background job; its page follows the progress
+		if all && !dry {
+			j, err := s.core.EnqueueApply(app.ApplyRequest{All: true, Limit: limit, Actor: actor})
+			s.startJob(w, r, j, err)
+			return
+		}
+		// never queue behind a running apply: show its progress instead
+		res, err := s.core.Apply(r.Context(), app.ApplyRequest{
+			Domain: domain,
+			All:    all,
+			DryRun: dry,
+			Limit:  limit,
+			NoWait: true,
+			Actor:  actor,
+		})
+		if errors.Is(err, app.ErrApplyBusy) {
+			w.WriteHeader(http.StatusConflict)
+			s.render(w, r, "Apply", "apply_form", map[string]any{})
+			return
+		}
+		if err != nil {
+			s.render(w, r, "Apply Result", "apply_result", map[string]any{
+				"Result": res,
+				"Error":  err.Error(),
+			})
+			return
+		}
+
+		s.render(w, r, "Apply Result", "apply_result", map[string]any{
+			"Result": res,
+		})
+		return
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleApplyStatus is the apply lock holder as JSON, polled by the apply page.
+func (s *Server) handleApplyStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st := s.core.ApplyStatus()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"running": st.Running,
+		"holder":  st.Holder,
+		"process": st.Process,
+		"pid":     st.PID,
+		"started": st.StartedAt,
+		"elapsed": st.Elapsed().String(),
+		"step":    st.Step,
+	})
+}
+
+// ---------------- certs ----------------
+
+func (s *Server) handleCerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	items, err := s.core.CertList()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	grades, err := s.core.TLSGrades()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Certificates", "certs", map[string]any{"Items": items, "Grades": grades})
+}
+
+func (s *Server) handleCertInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d := strings.TrimSpace(r.URL.Query().Get("domain"))
+	info, err := s.core.CertInfo(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data := map[string]any{"Info": info}
+	if alt, err := s.core.CertAltInfo(d); err == nil && alt != nil {
+		data["Alt"] = alt
+	}
+	if site, err := s.core.SiteGet(r.Context(), d); err == nil {
+		data["Site"] = site
+	}
+	data["Domain"] = d
+	data["CA"], data["CAIssuedBy"] = s.core.CertCA(d)
+	data["CAs"] = s.core.ACMECAs()
+	data["DefaultCA"] = s.cfg.Certs.CA
+	data["DNSAvailable"] = s.cfg.Certs.AcmeDNS.Server != ""
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if st, err := s.core.AcmeDNSStatus(ctx, d); err == nil {
+		data["DNS"] = st
+	}
+	s.render(w, r, "Certificate Info", "cert_info", data)
+}
+
+// handleCertDNS registers (or with off=true removes) the acme-dns delegation of a domain.
+func (s *Server) handleCertDNS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if parseBool(r.FormValue("off"), false) {
+		err = s.core.AcmeDNSRemove(r.Context(), d)
+	} else {
+		_, err = s.core.AcmeDNSRegister(r.Context(), d)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/cert/info?domain="+url.QueryEscape(d), http.StatusFound)
+}
+
+func (s *Server) handleCertDual(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SiteDualCert(r.Context(), d, parseBool(r.FormValue("on"), false)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/ui/cert/info?domain="+url.QueryEscape(d), http.StatusFound)
+}
+
+func (s *Server) handleCertSource(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SiteCertSource(r.Context(), d, r.FormValue("source"), r.FormValue("cert"), r.FormValue("key"), r.FormValue("lineage")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/cert/info?domain="+url.QueryEscape(d), http.StatusFound)
+}
+
+// handleCertCA sets the ACME CA of a site (empty ca = certs.ca).
+func (s *Server) handleCertCA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	if err := s.core.SiteACMECA(r.Context(), d, r.FormValue("ca")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/ui/cert/info?domain="+url.QueryEscape(d), http.StatusFound)
 }
 
 func (s *Server) handleCertIssue(w http.ResponseWriter, r *http.Request) {
@@ -686,14 +1835,24 @@ func (s *Server) handleCertIssue(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "domain is required", http.StatusBadRequest)
 		return
 	}
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
-	defer cancel()
+	sess, _ := s.sessionFromCtx(r)
+	j, err := s.core.EnqueueCertIssue(d, sess.Username)
+	s.startJob(w, r, j, err)
+}
 
-	if err := s.core.CertIssue(ctx, d, true); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// handleCertRevoke revokes a certificate (behind requireReauth).
+func (s *Server) handleCertRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if err := s.core.CertRevoke(r.Context(), d, strings.TrimSpace(r.FormValue("reason"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	http.Redirect(w, r, "/ui/certs", http.StatusFound)
+	http.Redirect(w, r, "/ui/cert/info?domain="+url.QueryEscape(d), http.StatusFound)
 }
 
 func (s *Server) handleCertRenew(w http.ResponseWriter, r *http.Request) {
@@ -705,14 +1864,9 @@ func (s *Server) handleCertRenew(w http.ResponseWriter, r *http.Request) {
 	d := strings.TrimSpace(r.FormValue("domain"))
 	all := parseBool(r.FormValue("all"), false)
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
-	defer cancel()
-
-	if err := s.core.CertRenew(ctx, d, all, true); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	http.Redirect(w, r, "/ui/certs", http.StatusFound)
+	sess, _ := s.sessionFromCtx(r)
+	j, err := s.core.EnqueueCertRenew(d, all, sess.Username)
+	s.startJob(w, r, j, err)
 }
 
 func (s *Server) handleCertCheck(w http.ResponseWriter, r *http.Request) {
@@ -741,6 +1895,16 @@ func (s *Server) handleCertCheck(w http.ResponseWriter, r *http.Request) {
 
 // ---------------- helpers ----------------
 
+// expectedRevision reads the site revision the client edited, from the form or an If-Match header.
+func expectedRevision(r *http.Request) int64 {
+	v := strings.TrimSpace(r.FormValue("revision"))
+	if v == "" {
+		v = strings.Trim(strings.TrimPrefix(strings.TrimSpace(r.Header.Get("If-Match")), "W/"), `"`)
+	}
+	n, _ := strconv.ParseInt(v, 10, 64)
+	return n
+}
+
 func parseBool(v string, def bool) bool {
 	v = strings.TrimSpace(strings.ToLower(v))
 	if v == "" {
@@ -756,6 +1920,14 @@ func boolStr(b bool) string {
 	return "false"
 }
 
+// intOrEmpty is n as a form value, "" for 0 (the default).
+func intOrEmpty(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
 
 func splitLines(s string) []string {
         s = strings.ReplaceAll(s, "\r\n", "\n")
@@ -775,7 +1947,7 @@ func splitLines(s string) []string {
 // ---------------- templates ----------------
 
 const layoutHTML = `<!doctype html>
-<html>
+<html lang="{{.Lang}}">
 <head>
   <meta charset="utf-8">
   <title>{{.Title}}</title>
@@ -783,6 +1955,8 @@ const layoutHTML = `<!doctype html>
 <body style="font-family:system-ui; margin:24px;">
   {{if .Authed}}{{template "menu" .}}{{end}}
   <div style="max-width:1100px;">
+    {{with .Nginx}}{{if .Down}}{{template "nginx_banner" $}}{{end}}{{end}}
+    {{with .Apply}}{{if and .Running (ne $.Page "apply_form")}}{{template "apply_banner" $}}{{end}}{{end}}
     {{template "content" .}}
   </div>
 </body>
@@ -793,10 +1967,26 @@ const contentHTML = `{{define "content"}}
     {{template "sites" .}}
   {{- else if eq .Page "site_form" -}}
     {{template "site_form" .}}
+  {{- else if eq .Page "site_config" -}}
+    {{template "site_config" .}}
+  {{- else if eq .Page "site_render" -}}
+    {{template "site_render" .}}
+  {{- else if eq .Page "site_logs" -}}
+    {{template "site_logs" .}}
+  {{- else if eq .Page "site_trace" -}}
+    {{template "site_trace" .}}
+  {{- else if eq .Page "site_deploy" -}}
+    {{template "site_deploy" .}}
   {{- else if eq .Page "apply_form" -}}
     {{template "apply_form" .}}
   {{- else if eq .Page "apply_result" -}}
     {{template "apply_result" .}}
+  {{- else if eq .Page "apply_runs" -}}
+    {{template "apply_runs" .}}
+  {{- else if eq .Page "apply_history" -}}
+    {{template "apply_history" .}}
+  {{- else if eq .Page "dashboard" -}}
+    {{template "dashboard" .}}
   {{- else if eq .Page "certs" -}}
     {{template "certs" .}}
   {{- else if eq .Page "cert_info" -}}
@@ -805,8 +1995,44 @@ const contentHTML = `{{define "content"}}
     {{template "proxy_targets" .}}
   {{- else if eq .Page "cert_check" -}}
     {{template "cert_check" .}}
+  {{- else if eq .Page "cert_challenge" -}}
+    {{template "cert_challenge" .}}
+  {{- else if eq .Page "password_change" -}}
+    {{template "password_change" .}}
+  {{- else if eq .Page "profile" -}}
+    {{template "profile" .}}
+  {{- else if eq .Page "plans" -}}
+    {{template "plans" .}}
+  {{- else if eq .Page "uptime" -}}
+    {{template "uptime" .}}
+  {{- else if eq .Page "tls_report" -}}
+    {{template "tls_report" .}}
+  {{- else if eq .Page "events" -}}
+    {{template "events" .}}
+  {{- else if eq .Page "activity" -}}
+    {{template "activity" .}}
+  {{- else if eq .Page "mail" -}}
+    {{template "mail" .}}
+  {{- else if eq .Page "tokens" -}}
+    {{template "tokens" .}}
+  {{- else if eq .Page "reauth" -}}
+    {{template "reauth" .}}
+  {{- else if eq .Page "forbidden" -}}
+    {{template "forbidden" .}}
+  {{- else if eq .Page "panel_users" -}}
+    {{template "panel_users" .}}
+  {{- else if eq .Page "nginx_modules" -}}
+    {{template "nginx_modules" .}}
+  {{- else if eq .Page "approvals" -}}
+    {{template "approvals" .}}
+  {{- else if eq .Page "jobs" -}}
+    {{template "jobs" .}}
+  {{- else if eq .Page "audit" -}}
+    {{template "audit" .}}
+  {{- else if eq .Page "job" -}}
+    {{template "job" .}}
   {{- else -}}
-    <h2>Unknown page</h2>
+    <h2>{{t .Lang "common.unknown_page"}}</h2>
     <p>Page: <code>{{.Page}}</code></p>
   {{- end -}}
 {{end}}`
@@ -815,117 +2041,210 @@ const contentHTML = `{{define "content"}}
 const menuHTML = `{{define "menu"}}
   <div style="display:flex; gap:12px; align-items:center; margin-bottom:18px;">
     <div style="font-weight:700;">NGM</div>
-    <a href="/ui/sites">Sites</a>
-    <a href="/ui/sites/new">Add Site</a>
-    <a href="/ui/apply">Apply</a>
-    <a href="/ui/certs">Certificates</a>
+    {{if .Session.Admin}}<a href="/ui/dashboard">{{t .Lang "menu.dashboard"}}</a>{{end}}
+    <a href="/ui/sites">{{t .Lang "menu.sites"}}</a>
+    <a href="/ui/sites/new">{{t .Lang "menu.add_site"}}</a>
+    {{if .Session.Admin}}
+    <a href="/ui/apply">{{t .Lang "menu.apply"}}</a>
+    <a href="/ui/jobs">{{t .Lang "menu.jobs"}}</a>
+    <a href="/ui/certs">{{t .Lang "menu.certs"}}</a>
+    <a href="/ui/plans">{{t .Lang "menu.plans"}}</a>
+    <a href="/ui/uptime">{{t .Lang "menu.uptime"}}</a>
+    <a href="/ui/events">{{t .Lang "menu.events"}}</a>
+    <a href="/ui/audit">{{t .Lang "menu.audit"}}</a>
+    <a href="/ui/mail">{{t .Lang "menu.mail"}}</a>
+    <a href="/ui/tokens">{{t .Lang "menu.tokens"}}</a>
+    <a href="/ui/users">{{t .Lang "menu.users"}}</a>
+    <a href="/ui/nginx/modules">{{t .Lang "menu.modules"}}</a>
+    {{if .Approvals}}<a href="/ui/approvals">{{t .Lang "menu.approvals"}}</a>{{end}}
+    {{else}}
+    <a href="/ui/activity">{{t .Lang "menu.activity"}}</a>
+    {{end}}
 
     <div style="margin-left:auto; display:flex; gap:10px; align-items:center;">
-      <div style="opacity:.75;">{{.Session.Username}}</div>
-      <a href="/ui/logout">Logout</a>
+      <form method="post" action="/ui/lang" style="display:inline;">
+        <select name="lang" onchange="this.form.submit()" style="padding:2px;">
+          {{range .Languages}}
+            <option value="{{.Code}}" {{if eq .Code $.Lang}}selected{{end}}>{{.Name}}</option>
+          {{end}}
+        </select>
+      </form>
+      <a href="/ui/profile" title="{{t .Lang "menu.profile"}}" style="opacity:.75;">{{.Session.Username}}</a>
+      <a href="/ui/logout">{{t .Lang "menu.logout"}}</a>
     </div>
   </div>
 {{end}}`
 
 const loginHTML = `<!doctype html>
-<html><head><meta charset="utf-8"><title>NGM Login</title></head>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><title>{{t .Lang "login.title"}}</title></head>
 <body style="font-family:system-ui; max-width:520px; margin:40px auto;">
-  <h2>NGM Panel Login</h2>
-  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+  <h2>{{t .Lang "login.heading"}}</h2>
+  {{if .Error}}<p style="color:#b00;">{{t .Lang .Error}}</p>{{end}}
   <form method="post" action="/ui/login">
     <div style="margin:10px 0;">
-      <label>Username</label><br/>
+      <label>{{t .Lang "login.username"}}</label><br/>
       <input name="username" style="width:100%; padding:8px;" />
     </div>
     <div style="margin:10px 0;">
-      <label>Password</label><br/>
+      <label>{{t .Lang "login.password"}}</label><br/>
       <input type="password" name="password" style="width:100%; padding:8px;" />
     </div>
-    <button style="padding:10px 14px;">Login</button>
+    <button style="padding:10px 14px;">{{t .Lang "login.submit"}}</button>
   </form>
+  {{if .CanReset}}<p><a href="/ui/password/forgot">{{t .Lang "login.forgot"}}</a></p>{{end}}
 </body></html>`
 
 const sitesHTML = `{{define "sites"}}
-  <h2 style="margin:0 0 10px 0;">Sites</h2>
-  <p style="opacity:.8; margin-top:0;">Manage sites and apply nginx changes.</p>
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "sites.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "sites.subtitle"}}</p>
+  {{with .Drift}}
+  <div style="padding:10px; border:1px solid #c90; background:#fff8e6; margin-bottom:12px;">
+    <b>{{t $.Lang "drift.title"}}</b>
+    <ul style="margin:6px 0;">
+      {{range .Orphans}}<li>{{t $.Lang "drift.orphan"}} <code>{{.File}}</code> ({{if eq .Site "disabled"}}{{t $.Lang "drift.site_disabled"}}{{else}}{{t $.Lang "drift.no_site"}}{{end}}, {{.ModTime.Format "2006-01-02 15:04"}})</li>{{end}}
+      {{range .Missing}}<li>{{t $.Lang "drift.missing"}} <code>{{.}}</code></li>{{end}}
+    </ul>
+    {{if .Orphans}}<span style="opacity:.8;">{{t $.Lang "drift.prune_help"}} <code>ngm prune --orphans --yes</code></span>{{end}}
+  </div>
+  {{end}}
+  {{with .Conflicts}}
+  <div style="padding:10px; border:1px solid #c90; background:#fff8e6; margin-bottom:12px;">
+    <b>{{t $.Lang "names.title"}}</b>
+    <ul style="margin:6px 0;">
+      {{range .}}<li><code>{{.Name}}</code> ({{t $.Lang (printf "names.%s" .Kind)}}): {{range $i, $c := .Claims}}{{if $i}}, {{end}}{{if $c.File}}<code>{{$c.File}}</code>{{else}}<a href="/ui/sites/edit?domain={{$c.Site}}">{{$c.Site}}</a>{{if $c.Preview}} ({{t $.Lang "names.preview"}}){{end}}{{end}}{{end}}
+        <br><span style="opacity:.8;">{{.Hint}}</span></li>{{end}}
+    </ul>
+    <span style="opacity:.8;">{{t $.Lang "names.help"}}</span>
+  </div>
+  {{end}}
+
+  <form method="get" action="/ui/sites" style="margin-bottom:12px;">
+    <input type="hidden" name="sort" value="{{.Sort}}">
+    {{if .Desc}}<input type="hidden" name="desc" value="1">{{end}}
+    <input name="q" value="{{.Filter.Search}}" placeholder="{{t .Lang "sites.search"}}" style="padding:4px;">
+    {{if .Session.Admin}}<input name="owner" value="{{.Filter.Owner}}" placeholder="{{t .Lang "col.owner"}}" style="padding:4px; width:120px;">{{end}}
+    <select name="mode">
+      <option value="">{{t .Lang "sites.any_mode"}}</option>
+      {{range .Modes}}<option value="{{.}}"{{if eq . $.Filter.Mode}} selected{{end}}>{{.}}</option>{{end}}
+    </select>
+    <select name="state">
+      <option value="">{{t .Lang "sites.any_state"}}</option>
+      {{range .States}}<option value="{{.}}"{{if eq . $.Filter.State}} selected{{end}}>{{t $.Lang (printf "state.%s" .)}}</option>{{end}}
+    </select>
+    <button>{{t .Lang "events.filter"}}</button>
+    {{if .Filter.Set $.Session}}<a href="/ui/sites" style="margin-left:8px;">{{t .Lang "sites.clear"}}</a>{{end}}
+  </form>
 
   <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
     <thead>
       <tr>
-        <th align="left">Domain</th>
-        <th>Owner</th>
-        <th>Mode</th>
-        <th>Enabled</th>
-        <th>TLS</th>
-        <th>State</th>
-        <th>Last Applied</th>
-        <th>PHP</th>
-        <th>Actions</th>
+        {{with .Cols.domain}}<th align="left"><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.owner}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.mode}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.enabled}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.cert}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.state}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.last_applied}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        {{with .Cols.php}}<th><a href="{{.Href}}">{{t $.Lang .Label}}</a> {{.Arrow}}</th>{{end}}
+        <th>{{t .Lang "col.actions"}}</th>
       </tr>
     </thead>
     <tbody>
     {{range .Items}}
       <tr>
         <td>{{.Site.Domain}}</td>
-        <td align="center">{{index $.Owners .Site.Domain}}</td>
+        <td align="center">
+          {{.Owner}}
+          {{ with index $.Usage .Owner }}<span title="{{t $.Lang "plans.sites"}}" style="font-size:85%; padding:1px 5px; border-radius:4px; background:{{if .Full}}#fdd{{else}}#eee{{end}};">{{.Text}}</span>{{end}}
+        </td>
         <td align="center">{{.Site.Mode}}</td>
-        <td align="center">{{if .Site.Enabled}}yes{{else}}no{{end}}</td>
         <td align="center">
-          {{ $ci := index $.Certs .Site.Domain }}
-          {{ if $ci }}
-            yes ({{ $ci.DaysLeft }}d)
+          {{if .Site.Enabled}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}
+          {{with .Site.ExpiresAt}}<br><span style="font-size:85%; padding:1px 5px; border-radius:4px; background:{{if $.Now.After .}}#fdd{{else}}#eee{{end}};">{{if $.Now.After .}}{{t $.Lang "expiry.expired" (fmtTime $.Lang .)}}{{else}}{{t $.Lang "expiry.until" (fmtTime $.Lang .)}}{{end}}</span>{{end}}
+        </td>
+        <td align="center">
+          {{ if .Cert }}
+            {{t $.Lang "common.yes"}} ({{t $.Lang "sites.days_short" .CertDays}})
           {{ else }}
-            no
+            {{t $.Lang "common.no"}}
           {{ end }}
         </td>
-        <td align="center">{{.State}}</td>
-        <td align="center">{{.Last}}</td>
+        <td align="center">{{t $.Lang (printf "state.%s" .State)}}{{if .Site.RetireUntil}}<br/><small style="opacity:.7;">{{t $.Lang "site.retiring" .Site.RetireStatus (fmtTime $.Lang .Site.RetireUntil)}}</small>{{end}}</td>
+        <td align="center">{{fmtTime $.Lang .Site.LastAppliedAt}}</td>
         <td align="center">{{.Site.PHPVersion}}</td>
         <td align="center" style="white-space:nowrap;">
           <form method="post" action="/ui/apply" style="display:inline;">
             <input type="hidden" name="domain" value="{{.Site.Domain}}">
-            <button>Apply</button>
+            <button>{{t $.Lang "action.apply"}}</button>
           </form>
-          {{if eq .Site.Mode "proxy"}}
-            <a href="/ui/sites/targets?domain={{.Site.Domain}}" style="margin-left:8px;">Targets</a>
+          {{if and (eq .Site.Mode "proxy") $.Session.Admin}}
+            <a href="/ui/sites/targets?domain={{.Site.Domain}}" style="margin-left:8px;">{{t $.Lang "action.targets"}}</a>
           {{end}}
-          <a href="/ui/sites/edit?domain={{.Site.Domain}}" style="margin-left:8px;">Edit</a>
+          <a href="/ui/sites/edit?domain={{.Site.Domain}}" style="margin-left:8px;">{{t $.Lang "action.edit"}}</a>
+          <a href="/ui/sites/config?domain={{.Site.Domain}}" style="margin-left:8px;">{{t $.Lang "action.view_config"}}</a>
 
 {{if .Site.Enabled}}
             <form method="post" action="/ui/sites/disable" style="display:inline; margin-left:8px;"
-                  onsubmit="return confirm('Disable {{.Site.Domain}} ?');">
+                  onsubmit="return confirm('{{t $.Lang "confirm.disable" .Site.Domain}}');">
               <input type="hidden" name="domain" value="{{.Site.Domain}}">
-              <button>Disable</button>
+              <select name="retire" title="{{t $.Lang "site.retire_hint"}}">
+                <option value="">{{t $.Lang "site.retire_now"}}</option>
+                <option value="410:24h">{{t $.Lang "site.retire_for" 410 "24h"}}</option>
+                <option value="503:24h">{{t $.Lang "site.retire_for" 503 "24h"}}</option>
+                <option value="410:168h">{{t $.Lang "site.retire_for" 410 "7d"}}</option>
+              </select>
+              <button>{{t $.Lang "action.disable"}}</button>
             </form>
           {{else}}
             <form method="post" action="/ui/sites/enable" style="display:inline; margin-left:8px;"
-                  onsubmit="return confirm('Enable {{.Site.Domain}} ?');">
+                  onsubmit="return confirm('{{t $.Lang "confirm.enable" .Site.Domain}}');">
               <input type="hidden" name="domain" value="{{.Site.Domain}}">
-              <button>Enable</button>
+              <button>{{t $.Lang "action.enable"}}</button>
             </form>
             <form method="post" action="/ui/sites/delete" style="display:inline; margin-left:8px;"
-                  onsubmit="return confirm('DELETE {{.Site.Domain}} permanently? This cannot be undone.');">
+                  onsubmit="return confirm('{{t $.Lang "confirm.delete" .Site.Domain}}');">
               <input type="hidden" name="domain" value="{{.Site.Domain}}">
-              <button>Delete</button>
+              <button>{{t $.Lang "action.delete"}}</button>
             </form>
           {{end}}
 
         </td>
       </tr>
+    {{else}}
+      <tr><td colspan="9" style="opacity:.7;">{{t .Lang "sites.none"}}</td></tr>
     {{end}}
     </tbody>
   </table>
+  {{with .Pager}}{{if gt .Pages 1}}
+  <p>
+    {{if .Prev}}<a href="{{.Prev}}">&larr; {{t $.Lang "sites.prev"}}</a>{{end}}
+    <span style="margin:0 10px;">{{t $.Lang "sites.page" .From .To .Total .Page .Pages}}</span>
+    {{if .Next}}<a href="{{.Next}}">{{t $.Lang "sites.next"}} &rarr;</a>{{end}}
+  </p>
+  {{end}}{{end}}
 {{end}}`
 
 const siteFormHTML = `{{define "site_form"}}
-  {{if eq .Mode "new"}}<h2>Add Site</h2>{{end}}
-  {{if eq .Mode "edit"}}<h2>Edit Site</h2>{{end}}
-  {{if eq .Mode "result"}}<h2>Result</h2>{{end}}
+  {{if eq .Mode "new"}}<h2>{{t .Lang "site_form.add"}}</h2>{{end}}
+  {{if eq .Mode "edit"}}<h2>{{t .Lang "site_form.edit"}}</h2>
+    <p><a href="/ui/sites/config?domain={{index .Form "domain"}}">{{t .Lang "action.view_config"}}</a>
+      &nbsp;|&nbsp; <a href="/ui/sites/preview?domain={{index .Form "domain"}}">{{t .Lang "action.render"}}</a>
+      &nbsp;|&nbsp; <a href="/ui/sites/logs?domain={{index .Form "domain"}}">{{t .Lang "action.logs"}}</a>
+      &nbsp;|&nbsp; <a href="/ui/sites/trace?domain={{index .Form "domain"}}">{{t .Lang "action.trace"}}</a>
+      {{if .Session.Admin}}&nbsp;|&nbsp; <a href="/ui/sites/deploy?domain={{index .Form "domain"}}">{{t .Lang "action.deploy"}}</a>{{end}}</p>
+    {{if .Session.Admin}}
+    <form method="post" action="/ui/cert/challenge" style="margin:0 0 12px;">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <button>{{t .Lang "action.test_challenge"}}</button>
+    </form>
+    {{end}}
+  {{end}}
+  {{if eq .Mode "result"}}<h2>{{t .Lang "site_form.result"}}</h2>{{end}}
 
   {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
   {{if .Warnings}}
     <div style="border:1px solid #cc0; padding:10px; margin:10px 0;">
-      <div style="font-weight:700;">Warnings</div>
+      <div style="font-weight:700;">{{t .Lang "site_form.warnings"}}</div>
       <ul>
         {{range .Warnings}}<li>{{.}}</li>{{end}}
       </ul>
@@ -934,28 +2253,32 @@ const siteFormHTML = `{{define "site_form"}}
 
   {{if eq .Mode "result"}}
     <pre style="background:#f6f6f6; padding:12px; overflow:auto;">{{printf "%+v" .Site}}</pre>
-    <p><a href="/ui/sites">Back to Sites</a></p>
+    <p><a href="/ui/sites">{{t .Lang "common.back_sites"}}</a></p>
   {{else}}
+    {{if .Reload}}<p><a href="/ui/sites/edit?domain={{index .Form "domain"}}">{{t .Lang "site_form.reload"}}</a></p>{{end}}
     <form method="post" action="{{if eq .Mode "new"}}/ui/sites/new{{else}}/ui/sites/edit{{end}}">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      {{if eq .Mode "edit"}}<input type="hidden" name="revision" value="{{index .Form "revision"}}">{{end}}
       <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px; max-width:820px;">
-        <label>Domain</label>
+        <label>{{t .Lang "col.domain"}}</label>
         <input name="domain" value="{{index .Form "domain"}}" style="padding:8px;" {{if eq .Mode "edit"}}readonly{{end}}>
 
-        <label>User (owner)</label>
-        <input name="user" value="{{index .Form "user"}}" style="padding:8px;" placeholder="e.g. chris">
+        <label>{{t .Lang "site_form.user"}}</label>
+        <input name="user" value="{{index .Form "user"}}" style="padding:8px;" placeholder="e.g. chris" {{if not .Session.Admin}}readonly{{end}}>
 
-        <label>Mode</label>
+        <label>{{t .Lang "col.mode"}}</label>
         <select name="mode" style="padding:8px;">
           <option value="php" {{if eq (index .Form "mode") "php"}}selected{{end}}>php</option>
-          <option value="proxy" {{if eq (index .Form "mode") "proxy"}}selected{{end}}>proxy</option>
+          {{if or .Session.Admin (eq (index .Form "mode") "proxy")}}<option value="proxy" {{if eq (index .Form "mode") "proxy"}}selected{{end}}>proxy</option>{{end}}
           <option value="static" {{if eq (index .Form "mode") "static"}}selected{{end}}>static</option>
+          <option value="redirect" {{if eq (index .Form "mode") "redirect"}}selected{{end}}>redirect</option>
         </select>
 
-        <label>PHP Version</label>
+        <label>{{t .Lang "site_form.php"}}</label>
         <input name="php" value="{{index .Form "php"}}" style="padding:8px;" placeholder="e.g. 8.4">
 
-        <label>Webroot</label>
-        <input name="webroot" value="{{index .Form "webroot"}}" style="padding:8px;" placeholder="optional">
+        <label>{{t .Lang "site_form.webroot"}}</label>
+        <input name="webroot" value="{{index .Form "webroot"}}" style="padding:8px;" placeholder="{{t .Lang "common.optional"}}" {{if not .Session.Admin}}readonly{{end}}>
 
         <label>HTTP/3</label>
         <select name="http3" style="padding:8px;">
@@ -964,39 +2287,68 @@ const siteFormHTML = `{{define "site_form"}}
         </select>
 
         {{if eq .Mode "new"}}
-          <label>Proxy Targets (one per line)</label>
+          <label>{{t .Lang "site_form.targets"}}</label>
           <textarea name="targets" style="padding:8px; min-height:90px;"
             placeholder="127.0.0.1:8080&#10;10.0.0.2:8080 50 (optional weight)">{{index .Form "targets"}}</textarea>
 
           <div style="grid-column: 1 / span 2; opacity:.75; font-size:13px;">
-            Used only when Mode=proxy. If empty, create site first, then add targets from the Targets page.
+            {{t .Lang "site_form.targets_hint"}}
           </div>
 
-          <label>Provision</label>
+          <label>{{t .Lang "redirect.target"}}</label>
+          <input name="redirect_to" value="{{index .Form "redirect_to"}}" style="padding:8px;" placeholder="https://example.com">
+
+          <label>{{t .Lang "redirect.code"}}</label>
+          <select name="redirect_code" style="padding:8px;">
+            <option value="301" {{if eq (index .Form "redirect_code") "301"}}selected{{end}}>301</option>
+            <option value="302" {{if eq (index .Form "redirect_code") "302"}}selected{{end}}>302</option>
+            <option value="307" {{if eq (index .Form "redirect_code") "307"}}selected{{end}}>307</option>
+            <option value="308" {{if eq (index .Form "redirect_code") "308"}}selected{{end}}>308</option>
+          </select>
+
+          <label>{{t .Lang "redirect.keep_path"}}</label>
+          <label><input type="checkbox" name="keep_path" value="true" {{if eq (index .Form "keep_path") "true"}}checked{{end}}> {{t .Lang "redirect.keep_path_help"}}</label>
+
+          <div style="grid-column: 1 / span 2; opacity:.75; font-size:13px;">
+            {{t .Lang "site_form.redirect_hint"}}
+          </div>
+
+          <label>{{t .Lang "site_form.placeholder"}}</label>
+          <label><input type="checkbox" name="placeholder" value="true" {{if eq (index .Form "placeholder") "true"}}checked{{end}}> {{t .Lang "site_form.placeholder_help"}}</label>
+
+          <label>{{t .Lang "site_form.hardened"}}</label>
+          <label><input type="checkbox" name="hardened" value="true" {{if eq (index .Form "hardened") "true"}}checked{{end}}> {{t .Lang "site_form.hardened_help"}}</label>
+
+          {{if eq .Mode "new"}}
+          <label>{{t .Lang "site_form.dns_records"}}</label>
+          <label><input type="checkbox" name="dns_records" value="true" {{if eq (index .Form "dns_records") "true"}}checked{{end}}> {{t .Lang "site_form.dns_records_help"}}</label>
+          {{end}}
+
+          <label>{{t .Lang "site_form.provision"}}</label>
           <select name="provision" style="padding:8px;">
             <option value="true" {{if eq (index .Form "provision") "true"}}selected{{end}}>true</option>
             <option value="false" {{if eq (index .Form "provision") "false"}}selected{{end}}>false</option>
           </select>
 
-          <label>Apply Now</label>
+          <label>{{t .Lang "site_form.apply_now"}}</label>
           <select name="applynow" style="padding:8px;">
             <option value="true" {{if eq (index .Form "applynow") "true"}}selected{{end}}>true</option>
             <option value="false" {{if eq (index .Form "applynow") "false"}}selected{{end}}>false</option>
           </select>
 
-          <label>Skip Cert</label>
+          <label>{{t .Lang "site_form.skip_cert"}}</label>
           <select name="skipcert" style="padding:8px;">
             <option value="false" {{if eq (index .Form "skipcert") "false"}}selected{{end}}>false</option>
             <option value="true" {{if eq (index .Form "skipcert") "true"}}selected{{end}}>true</option>
           </select>
         {{else}}
-          <label>Enabled</label>
+          <label>{{t .Lang "col.enabled"}}</label>
           <select name="enabled" style="padding:8px;">
             <option value="true" {{if eq (index .Form "enabled") "true"}}selected{{end}}>true</option>
             <option value="false" {{if eq (index .Form "enabled") "false"}}selected{{end}}>false</option>
           </select>
 
-          <label>Apply Now</label>
+          <label>{{t .Lang "site_form.apply_now"}}</label>
           <select name="applynow" style="padding:8px;">
             <option value="false" {{if eq (index .Form "applynow") "false"}}selected{{end}}>false</option>
             <option value="true" {{if eq (index .Form "applynow") "true"}}selected{{end}}>true</option>
@@ -1005,51 +2357,441 @@ const siteFormHTML = `{{define "site_form"}}
       </div>
 
       <div style="margin-top:14px;">
-        <button style="padding:10px 14px;">Save</button>
-        <a href="/ui/sites" style="margin-left:10px;">Cancel</a>
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+        <a href="/ui/sites" style="margin-left:10px;">{{t .Lang "action.cancel"}}</a>
+      </div>
+    </form>
+
+    {{if eq .Mode "edit"}}
+    {{if eq (index .Form "mode") "php"}}
+    <h3 style="margin-top:18px;">{{t .Lang "harden.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "harden.subtitle"}}</p>
+    {{if .Hardening}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%; margin-bottom:10px;">
+      <tbody>
+      {{range .Hardening}}
+        <tr>
+          <td align="center">{{if .OK}}&#10003;{{else}}&#10007;{{end}}</td>
+          <td><code>{{.Name}}</code></td>
+          <td>{{.Detail}}</td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    {{end}}
+    <form method="post" action="/ui/sites/harden" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      {{if eq (index .Form "hardened") "true"}}
+        <button name="off" value="true" style="padding:10px 14px;">{{t .Lang "harden.off"}}</button>
+      {{else}}
+        <button style="padding:10px 14px;">{{t .Lang "harden.on"}}</button>
+      {{end}}
+    </form>
+    {{end}}
+
+    {{if or (eq (index .Form "mode") "php") (eq (index .Form "mode") "static")}}
+    <h3 style="margin-top:18px;">{{t .Lang "placeholder.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "placeholder.subtitle"}}</p>
+    <form method="post" action="/ui/sites/placeholder" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      {{if eq (index .Form "placeholder") "true"}}
+        <p>{{t .Lang "placeholder.active"}}</p>
+        <button name="off" value="true" style="padding:10px 14px;">{{t .Lang "placeholder.off"}}</button>
+      {{else}}
+        <button style="padding:10px 14px;">{{t .Lang "placeholder.on"}}</button>
+      {{end}}
+    </form>
+    {{end}}
+
+    {{if ne (index .Form "mode") "redirect"}}
+    <h3 style="margin-top:18px;">{{t .Lang "reapply.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "reapply.subtitle"}}</p>
+    <form method="post" action="/ui/sites/reapply" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <input name="cron" value="{{index .Form "reapply_cron"}}" style="padding:8px; width:220px;" placeholder="*/15 * * * *">
+      <button style="padding:10px 14px;">{{t .Lang "reapply.save"}}</button>
+      {{if index .Form "reapply_cron"}}
+        <button name="off" value="true" style="padding:10px 14px;">{{t .Lang "reapply.off"}}</button>
+      {{end}}
+    </form>
+    {{end}}
+
+    <h3 style="margin-top:18px;">{{t .Lang "redirect.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "redirect.subtitle"}}</p>
+    <form method="post" action="/ui/sites/redirect" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "redirect.target"}}</label>
+        <input name="redirect_to" value="{{index .Form "redirect_to"}}" style="padding:8px;" placeholder="https://example.com">
+        <label>{{t .Lang "redirect.code"}}</label>
+        <select name="redirect_code" style="padding:8px;">
+          <option value="301" {{if eq (index .Form "redirect_code") "301"}}selected{{end}}>301</option>
+          <option value="302" {{if eq (index .Form "redirect_code") "302"}}selected{{end}}>302</option>
+          <option value="307" {{if eq (index .Form "redirect_code") "307"}}selected{{end}}>307</option>
+          <option value="308" {{if eq (index .Form "redirect_code") "308"}}selected{{end}}>308</option>
+        </select>
+        <label>{{t .Lang "redirect.keep_path"}}</label>
+        <label><input type="checkbox" name="keep_path" value="true" {{if eq (index .Form "keep_path") "true"}}checked{{end}}> {{t .Lang "redirect.keep_path_help"}}</label>
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+
+    {{if .Session.Admin}}
+    <h3 style="margin-top:18px;">{{t .Lang "syslog.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "syslog.subtitle"}}</p>
+    <form method="post" action="/ui/sites/syslog" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "syslog.server"}}</label>
+        <input name="server" value="{{index .Form "access_syslog"}}" style="padding:8px;" placeholder="10.0.0.5:514">
+      </div>
+      <div style="margin-top:12px; display:flex; gap:10px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+        {{if index .Form "access_syslog"}}<button name="off" value="true" style="padding:10px 14px;">{{t .Lang "syslog.off"}}</button>{{end}}
+      </div>
+    </form>
+    {{end}}
+
+    <h3 style="margin-top:18px;">{{t .Lang "logsample.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "logsample.subtitle"}}</p>
+    {{$ls := index .Form "log_sample"}}
+    <form method="post" action="/ui/sites/logsample" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label><input type="radio" name="sample" value="" {{if eq $ls ""}}checked{{end}}> {{t .Lang "logsample.all"}}</label>
+        <span></span>
+        <label><input type="radio" name="sample" value="errors" {{if eq $ls "errors"}}checked{{end}}> {{t .Lang "logsample.errors"}}</label>
+        <span></span>
+        <label><input type="radio" name="sample" value="rate" {{if and (ne $ls "") (ne $ls "errors")}}checked{{end}}> {{t .Lang "logsample.rate"}}</label>
+        <input name="rate" value="{{if and (ne $ls "") (ne $ls "errors")}}{{slice $ls 2}}{{else}}100{{end}}" style="padding:8px; width:120px;" inputmode="numeric">
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+
+    {{if and (eq (index .Form "mode") "proxy") .Session.Admin}}
+    <h3 style="margin-top:18px;">{{t .Lang "keepalive.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "keepalive.subtitle"}}</p>
+    <form method="post" action="/ui/sites/keepalive" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "keepalive.connections"}}</label>
+        <input name="connections" value="{{index .Form "ka_conns"}}" style="padding:8px; width:120px;" inputmode="numeric" placeholder="{{.KeepaliveDefault.Connections}}">
+        <label>{{t .Lang "keepalive.requests"}}</label>
+        <input name="requests" value="{{index .Form "ka_requests"}}" style="padding:8px; width:120px;" inputmode="numeric" placeholder="{{.KeepaliveDefault.Requests}}">
+        <label>{{t .Lang "keepalive.timeout"}}</label>
+        <input name="timeout" value="{{index .Form "ka_timeout"}}" style="padding:8px; width:120px;" placeholder="{{.KeepaliveDefault.Timeout}}">
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+
+    <h3 style="margin-top:18px;">{{t .Lang "backendhealth.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "backendhealth.subtitle"}} <code>{{.BackendHealth.Location}}</code> &larr; {{range $i, $ip := .BackendHealth.Allow}}{{if $i}}, {{end}}<code>{{$ip}}</code>{{end}}</p>
+    <form method="post" action="/ui/sites/backendhealth" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "backendhealth.path"}}</label>
+        <input name="path" value="{{index .Form "backend_health"}}" style="padding:8px; width:240px;" placeholder="/healthz">
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+    {{end}}
+
+    <h3 style="margin-top:18px;">{{t .Lang "headers.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "headers.subtitle"}}</p>
+    {{if .Headers}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%; margin-bottom:10px;">
+      <tbody>
+      {{range .Headers}}
+        <tr>
+          <td><code>{{.Name}}</code></td>
+          <td>{{if .Hide}}<i>{{t $.Lang "headers.hidden"}}</i>{{else}}<code>{{.Value}}</code>{{end}}</td>
+          <td align="center">
+            <form method="post" action="/ui/sites/headers" style="display:inline;">
+              <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+              <input type="hidden" name="domain" value="{{index $.Form "domain"}}">
+              <button name="remove" value="{{.Name}}" style="padding:4px 8px;">{{t $.Lang "headers.remove"}}</button>
+            </form>
+          </td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    {{end}}
+    <form method="post" action="/ui/sites/headers" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "headers.name"}}</label>
+        <input name="name" style="padding:8px;" placeholder="X-Frame-Options">
+        <label>{{t .Lang "headers.value"}}</label>
+        <input name="value" style="padding:8px;" placeholder="SAMEORIGIN">
+        <label>{{t .Lang "headers.hide"}}</label>
+        <label><input type="checkbox" name="hide" value="true"> {{t .Lang "headers.hide_help"}}</label>
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+
+    {{if .Session.Admin}}
+    <h3 style="margin-top:18px;">{{t .Lang "vars.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "vars.subtitle"}}</p>
+    {{if .Vars}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%; margin-bottom:10px;">
+      <tbody>
+      {{range .Vars}}
+        <tr>
+          <td><code>.Vars.{{.Name}}</code></td>
+          <td><code>{{.Value}}</code></td>
+          <td align="center">
+            <form method="post" action="/ui/sites/vars" style="display:inline;">
+              <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+              <input type="hidden" name="domain" value="{{index $.Form "domain"}}">
+              <button name="remove" value="{{.Name}}" style="padding:4px 8px;">{{t $.Lang "headers.remove"}}</button>
+            </form>
+          </td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    {{end}}
+    <form method="post" action="/ui/sites/vars" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "vars.name"}}</label>
+        <input name="name" style="padding:8px;" placeholder="feature_beta">
+        <label>{{t .Lang "headers.value"}}</label>
+        <input name="value" style="padding:8px;" placeholder="on">
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+    {{end}}
+
+    {{if ne (index .Form "mode") "static"}}
+    <h3 style="margin-top:18px;">{{t .Lang "preloads.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "preloads.subtitle"}}</p>
+    {{if .Preloads}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%; margin-bottom:10px;">
+      <tbody>
+      {{range .Preloads}}
+        <tr>
+          <td><code>{{.URL}}</code></td>
+          <td>{{.As}}{{if .Crossorigin}}, crossorigin{{end}}</td>
+          <td align="center">
+            <form method="post" action="/ui/sites/preloads" style="display:inline;">
+              <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+              <input type="hidden" name="domain" value="{{index $.Form "domain"}}">
+              <button name="remove" value="{{.URL}}" style="padding:4px 8px;">{{t $.Lang "preloads.remove"}}</button>
+            </form>
+          </td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    {{end}}
+    <form method="post" action="/ui/sites/preloads" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "preloads.url"}}</label>
+        <input name="url" style="padding:8px;" placeholder="/assets/app.css">
+        <label>{{t .Lang "preloads.as"}}</label>
+        <select name="as" style="padding:8px;">
+          <option value="style">style</option>
+          <option value="script">script</option>
+          <option value="font">font</option>
+          <option value="image">image</option>
+          <option value="fetch">fetch</option>
+        </select>
+        <label>CORS</label>
+        <label><input type="checkbox" name="crossorigin" value="true"> {{t .Lang "preloads.crossorigin_help"}}</label>
+      </div>
+      <div style="margin-top:12px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      </div>
+    </form>
+    {{end}}
+
+    <h3 style="margin-top:18px;">{{t .Lang "expiry.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "expiry.subtitle"}}</p>
+    <form method="post" action="/ui/sites/expiry" style="max-width:820px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+        <label>{{t .Lang "expiry.at"}}</label>
+        <input type="datetime-local" name="at" value="{{index .Form "expires_at"}}" style="padding:8px;">
+        <label>{{t .Lang "expiry.notify"}}</label>
+        <input type="email" name="notify" value="{{index .Form "expiry_notify"}}" style="padding:8px;" placeholder="owner@example.com">
+      </div>
+      <div style="margin-top:12px; display:flex; gap:10px;">
+        <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+        {{if index .Form "expires_at"}}<button name="off" value="true" style="padding:10px 14px;">{{t .Lang "expiry.off"}}</button>{{end}}
       </div>
     </form>
+
+    <h3 style="margin-top:18px;">{{t .Lang "reach.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "reach.subtitle"}}</p>
+    {{with .Reach}}
+    {{if .Mismatch}}<p style="color:#b00;">{{t $.Lang "reach.mismatch"}}</p>{{end}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%; margin-bottom:10px;">
+      <thead>
+        <tr>
+          <th>{{t $.Lang "reach.family"}}</th>
+          <th align="left">{{t $.Lang "reach.address"}}</th>
+          <th>{{t $.Lang "col.status"}}</th>
+          <th>{{t $.Lang "reach.cert"}}</th>
+          <th align="left">{{t $.Lang "col.error"}}</th>
+        </tr>
+      </thead>
+      <tbody>
+      {{range .Families}}
+        <tr>
+          <td align="center">{{if eq .Family "ipv6"}}IPv6{{else}}IPv4{{end}}</td>
+          <td><code>{{.Address}}</code></td>
+          <td align="center" style="color:{{if .OK}}#080{{else}}#b00{{end}};">{{if .StatusCode}}HTTP {{.StatusCode}} · {{.LatencyMS}} ms{{else}}{{t $.Lang "reach.unreachable"}}{{end}}</td>
+          <td align="center" style="color:{{if eq .Cert "mismatch"}}#b00{{else}}inherit{{end}};">{{with .Cert}}{{t $.Lang (printf "reach.cert_%s" .)}}{{else}}-{{end}}</td>
+          <td>{{.Error}}</td>
+        </tr>
+      {{end}}
+      </tbody>
+    </table>
+    <p style="opacity:.7; margin-top:0;">{{t $.Lang "reach.checked" (fmtTime $.Lang .CheckedAt)}}</p>
+    {{else}}
+    <p style="opacity:.7;">{{t .Lang "reach.never"}}</p>
+    {{end}}
+    <form method="post" action="/ui/sites/reach">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{index .Form "domain"}}">
+      <button style="padding:10px 14px;">{{t .Lang "reach.check"}}</button>
+    </form>
+
+    <h3 style="margin-top:18px;">{{t .Lang "history.title"}}</h3>
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; max-width:820px; width:100%;">
+      <thead>
+        <tr>
+          <th>{{t .Lang "history.run"}}</th>
+          <th>{{t .Lang "events.time"}}</th>
+          <th>{{t .Lang "col.action"}}</th>
+          <th>{{t .Lang "col.status"}}</th>
+          <th align="left">{{t .Lang "col.error"}}</th>
+        </tr>
+      </thead>
+      <tbody>
+      {{range .History}}
+        <tr>
+          <td align="center"><a href="/ui/apply/run?id={{.RunID}}">#{{.RunID}}</a></td>
+          <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .CreatedAt}}</td>
+          <td align="center">{{.Action}}</td>
+          <td align="center" style="color:{{if eq .Status "fail"}}#b00{{else}}inherit{{end}};">{{.Status}}</td>
+          <td style="white-space:pre-wrap;">{{.Message}}</td>
+        </tr>
+      {{else}}
+        <tr><td colspan="5" style="opacity:.7;">{{t .Lang "history.none"}}</td></tr>
+      {{end}}
+      </tbody>
+    </table>
+    <p><a href="/ui/apply/history?domain={{index .Form "domain"}}">{{t .Lang "history.all"}}</a></p>
+    {{end}}
   {{end}}
 {{end}}`
 
 
 const proxyTargetsHTML = `{{define "proxy_targets"}}
-  <h2>Proxy Targets: {{.Site.Domain}}</h2>
+  <h2>{{t .Lang "targets.title" .Site.Domain}}</h2>
   <p style="opacity:.8; margin-top:0;">
-    Manage upstream targets for this proxy site.
+    {{t .Lang "targets.subtitle"}}
   </p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
 
   <div style="margin:10px 0; display:flex; gap:10px; align-items:center;">
     <form method="post" action="/ui/apply" style="display:inline;">
       <input type="hidden" name="domain" value="{{.Site.Domain}}">
-      <button style="padding:8px 10px;">Apply</button>
+      <button style="padding:8px 10px;">{{t .Lang "action.apply"}}</button>
     </form>
-    <a href="/ui/sites">Back to Sites</a>
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </div>
+
+  {{if .Groups}}
+  <div style="margin:10px 0; padding:10px; border:1px solid #ccc; max-width:880px;">
+    <b>{{t .Lang "targets.cutover"}}</b>
+    <span style="opacity:.8;">
+      {{if .Site.ActiveGroup}}{{t .Lang "targets.active_group" .Site.ActiveGroup}}{{else}}{{t .Lang "targets.active_all"}}{{end}}
+    </span>
+    <div style="margin-top:8px; display:flex; gap:8px;">
+    {{range .Groups}}
+      <form method="post" action="/ui/sites/cutover" style="display:inline;"
+            onsubmit="return confirm('{{t $.Lang "confirm.cutover" .}}');">
+        <input type="hidden" name="domain" value="{{$.Site.Domain}}">
+        <input type="hidden" name="group" value="{{.}}">
+        <button {{if eq . $.Site.ActiveGroup}}disabled{{end}}>{{t $.Lang "targets.switch_to" .}}</button>
+      </form>
+    {{end}}
+    {{if .Site.ActiveGroup}}
+      <form method="post" action="/ui/sites/cutover" style="display:inline;">
+        <input type="hidden" name="domain" value="{{.Site.Domain}}">
+        <input type="hidden" name="group" value="">
+        <button>{{t .Lang "targets.switch_all"}}</button>
+      </form>
+    {{end}}
+    </div>
   </div>
+  {{end}}
 
   <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
     <thead>
       <tr>
-        <th align="left">Target</th>
-        <th>Weight</th>
-        <th>Backup</th>
-        <th>Enabled</th>
-        <th>Actions</th>
+        <th align="left">{{t .Lang "col.target"}}</th>
+        <th>{{t .Lang "col.group"}}</th>
+        <th>{{t .Lang "col.weight"}}</th>
+        <th>{{t .Lang "col.backup"}}</th>
+        <th>{{t .Lang "col.enabled"}}</th>
+        <th title="{{t .Lang "targets.stats_hint"}}">{{t .Lang "targets.requests"}}</th>
+        <th>{{t .Lang "targets.error_rate"}}</th>
+        <th>{{t .Lang "targets.latency"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
       </tr>
     </thead>
     <tbody>
     {{range .Targets}}
-      <tr>
-        <td>{{.Addr}}</td>
+      {{$st := index $.Stats .Addr}}
+      <tr{{if $st.Degraded}} style="background:#fde8e8;"{{end}}>
+        <td>{{.Addr}}{{if .Discovered}} <span style="font-size:85%; opacity:.7;">{{t $.Lang "discovery.tag"}}</span>{{end}}{{if $st.Degraded}} <b style="color:#b00;" title="{{t $.Lang "targets.degraded_hint"}}">{{t $.Lang "targets.degraded"}}</b>{{end}}</td>
+        <td align="center">{{if .Group}}{{.Group}}{{if eq .Group $.Site.ActiveGroup}} ●{{end}}{{else}}<span style="opacity:.6;">{{t $.Lang "targets.shared"}}</span>{{end}}</td>
         <td align="center">{{.Weight}}</td>
-        <td align="center">{{if .Backup}}yes{{else}}no{{end}}</td>
-        <td align="center">{{if .Enabled}}yes{{else}}no{{end}}</td>
+        <td align="center">{{if .Backup}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}</td>
+        <td align="center">{{if .Enabled}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}</td>
+        {{if $st.Requests}}
+        <td align="right">{{fmtNum $.Lang $st.Requests}}</td>
+        <td align="right"{{if ge $st.ErrorRate 5.0}} style="color:#b00;"{{end}}>{{printf "%.1f" $st.ErrorRate}}%</td>
+        <td align="right">{{printf "%.0f" $st.AvgMS}} / {{printf "%.0f" $st.P95MS}} ms</td>
+        {{else}}
+        <td align="center" colspan="3" style="opacity:.6;">{{t $.Lang "targets.no_traffic"}}</td>
+        {{end}}
         <td align="center">
           <form method="post" action="/ui/sites/targets/del" style="display:inline;"
-                onsubmit="return confirm('Disable target {{.Addr}} ?');">
+                onsubmit="return confirm('{{t $.Lang "confirm.disable_target" .Addr}}');">
             <input type="hidden" name="domain" value="{{$.Site.Domain}}">
             <input type="hidden" name="target" value="{{.Addr}}">
-            <button>Disable</button>
+            <button>{{t $.Lang "action.disable"}}</button>
           </form>
         </td>
       </tr>
@@ -1057,85 +2799,169 @@ const proxyTargetsHTML = `{{define "proxy_targets"}}
     </tbody>
   </table>
 
-  <h3 style="margin-top:18px;">Add / Update target</h3>
+  <h3 style="margin-top:18px;">{{t .Lang "targets.add_update"}}</h3>
   <form method="post" action="/ui/sites/targets/add" style="max-width:900px;">
     <input type="hidden" name="domain" value="{{.Site.Domain}}">
     <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
-      <label>Target</label>
+      <label>{{t .Lang "col.target"}}</label>
       <input name="target" style="padding:8px;" placeholder="127.0.0.1:8080 or unix:/run/app.sock">
 
-      <label>Weight</label>
+      <label>{{t .Lang "col.weight"}}</label>
       <input name="weight" style="padding:8px;" value="100">
 
-      <label>Backup</label>
+      <label>{{t .Lang "col.group"}}</label>
+      <input name="group" style="padding:8px;" placeholder="{{t .Lang "targets.group_hint"}}">
+
+      <label>{{t .Lang "col.backup"}}</label>
       <select name="backup" style="padding:8px;">
         <option value="false" selected>false</option>
         <option value="true">true</option>
       </select>
 
-      <label>Enabled</label>
+      <label>{{t .Lang "col.enabled"}}</label>
       <select name="enabled" style="padding:8px;">
         <option value="true" selected>true</option>
         <option value="false">false</option>
       </select>
     </div>
     <div style="margin-top:12px;">
-      <button style="padding:10px 14px;">Save Target</button>
+      <button style="padding:10px 14px;">{{t .Lang "targets.save"}}</button>
+    </div>
+  </form>
+
+  <h3 style="margin-top:18px;">{{t .Lang "mirror.title"}}</h3>
+  <p style="opacity:.8; margin-top:0;">
+    {{if .Site.MirrorTarget}}{{t .Lang "mirror.active" .Site.MirrorPercent .Site.MirrorTarget}}{{else}}{{t .Lang "mirror.subtitle"}}{{end}}
+  </p>
+  <form method="post" action="/ui/sites/mirror" style="max-width:900px;">
+    <input type="hidden" name="domain" value="{{.Site.Domain}}">
+    <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
+      <label>{{t .Lang "mirror.target"}}</label>
+      <input name="target" style="padding:8px;" value="{{.Site.MirrorTarget}}" placeholder="10.0.0.20:8080">
+
+      <label>{{t .Lang "mirror.percent"}}</label>
+      <input name="percent" style="padding:8px;" value="{{if .Site.MirrorPercent}}{{.Site.MirrorPercent}}{{else}}10{{end}}">
+    </div>
+    <div style="margin-top:12px; display:flex; gap:10px;">
+      <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+      {{if .Site.MirrorTarget}}<button name="off" value="true" style="padding:10px 14px;">{{t .Lang "mirror.off"}}</button>{{end}}
     </div>
   </form>
+
+  <h3 style="margin-top:18px;">{{t .Lang "discovery.title"}}</h3>
+  <p style="opacity:.8; margin-top:0;">
+    {{if .Site.Discovery}}{{t .Lang "discovery.active" .Site.Discovery}}{{else}}{{t .Lang "discovery.subtitle"}}{{end}}
+  </p>
+  <form method="post" action="/ui/sites/discovery" style="max-width:900px;">
+    <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+    <input type="hidden" name="domain" value="{{.Site.Domain}}">
+    <select name="kind" style="padding:8px;">
+      <option value="srv" {{if eq .DiscoveryKind "srv"}}selected{{end}}>DNS SRV</option>
+      <option value="consul" {{if eq .DiscoveryKind "consul"}}selected{{end}}>Consul</option>
+    </select>
+    <input name="name" value="{{.DiscoveryName}}" style="padding:8px; width:320px;" placeholder="_http._tcp.api.example.com / api">
+    <button style="padding:10px 14px;">{{t .Lang "action.save"}}</button>
+    {{if .Site.Discovery}}<button name="off" value="true" style="padding:10px 14px;">{{t .Lang "discovery.off"}}</button>{{end}}
+  </form>
 {{end}}`
 
 
 
 const applyFormHTML = `{{define "apply_form"}}
-  <h2>Apply</h2>
-  <p style="opacity:.8;">Renders/publishes nginx vhosts and reloads when needed.</p>
+  <h2>{{t .Lang "apply.title"}}</h2>
+  <p style="opacity:.8;">{{t .Lang "apply.subtitle"}}</p>
 
   <form method="post" action="/ui/apply" style="max-width:720px;">
+    <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
     <div style="display:grid; grid-template-columns: 180px 1fr; gap:10px;">
-      <label>Domain (optional)</label>
+      <label>{{t .Lang "apply.domain"}}</label>
       <input name="domain" style="padding:8px;" placeholder="example.com">
 
-      <label>All (apply even if not pending)</label>
+      <label>{{t .Lang "apply.all"}}</label>
       <select name="all" style="padding:8px;">
         <option value="false" selected>false</option>
         <option value="true">true</option>
       </select>
 
-      <label>Dry run</label>
+      <label>{{t .Lang "apply.dry"}}</label>
       <select name="dry" style="padding:8px;">
         <option value="false" selected>false</option>
         <option value="true">true</option>
       </select>
 
-      <label>Limit (0 = unlimited)</label>
+      <label>{{t .Lang "apply.limit"}}</label>
       <input name="limit" style="padding:8px;" value="0">
     </div>
 
     <div style="margin-top:14px;">
-      <button style="padding:10px 14px;">Run Apply</button>
+      {{if .Apply.Running}}
+      <button id="apply-run" style="padding:10px 14px;" disabled>{{t .Lang "apply.in_progress"}}</button>
+      <span id="apply-step" style="margin-left:10px;">{{.Apply.Step}}</span>
+      {{else}}
+      <button id="apply-run" style="padding:10px 14px;">{{t .Lang "apply.run"}}</button>
+      {{end}}
+      <a href="/ui/apply/runs" style="margin-left:10px;">{{t .Lang "apply.runs"}}</a>
     </div>
   </form>
+  {{if .Apply.Running}}
+  <p style="opacity:.8;">{{t .Lang "apply.busy" .Apply.Holder .Apply.Process (fmtTime .Lang .Apply.StartedAt)}}</p>
+  <script>
+    (function poll() {
+      fetch("/ui/apply/status", {credentials: "same-origin"}).then(r => r.json()).then(s => {
+        if (!s.running) { location.href = "/ui/apply"; return; }
+        document.getElementById("apply-step").textContent = s.step + " (" + s.elapsed + ")";
+        setTimeout(poll, 2000);
+      }).catch(() => setTimeout(poll, 5000));
+    })();
+  </script>
+  {{end}}
+  {{if .Session.Admin}}
+  {{template "apply_live" .}}
+  <script>
+    {{if .Apply.Running}}watchApply();{{end}}
+    // the page stays up until the result arrives: show the progress meanwhile
+    document.querySelector('form[action="/ui/apply"]').addEventListener("submit", () => watchApply());
+  </script>
+  {{end}}
+{{end}}`
+
+const applyBannerHTML = `{{define "apply_banner"}}
+  <div style="margin-bottom:16px; padding:8px 14px; border:1px solid #c90; border-radius:6px; background:#ffe;">
+    {{t .Lang "apply.banner" .Apply.Holder .Apply.Step}}
+    <a href="/ui/apply" style="margin-left:10px;">{{t .Lang "menu.apply"}}</a>
+  </div>
 {{end}}`
 
 const applyResultHTML = `{{define "apply_result"}}
-  <h2>Apply Result</h2>
+  <h2>{{t .Lang "apply.result"}}{{if .Result.RunID}} <a href="/ui/apply/run?id={{.Result.RunID}}" style="font-size:60%; font-weight:normal;">{{t .Lang "apply.run_id" .Result.RunID}}</a>{{end}}</h2>
+  {{with .Run}}
+    <p style="opacity:.8;">
+      {{fmtTime $.Lang .StartedAt}} &nbsp; {{t $.Lang "apply.request"}}: <code>{{.Request}}</code>
+      {{with .Actor}}&nbsp; {{t $.Lang "apply.actor"}}: {{.}}{{end}}
+      {{if .DryRun}}&nbsp; <b>{{t $.Lang "apply.dry"}}</b>{{end}}
+    </p>
+  {{end}}
   {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
 
   {{with .Result}}
+    {{if .Warning}}<p style="color:#b60;"><b>{{t $.Lang "apply.not_wired"}}</b><br><code>{{.Warning}}</code></p>{{end}}
     <p style="opacity:.8;">
-      Reloaded: <b>{{.Reloaded}}</b>
-      &nbsp; Changed: <b>{{len .Changed}}</b>
+      {{t $.Lang "apply.reloaded"}}: <b>{{.Reloaded}}</b>
+      &nbsp; {{t $.Lang "apply.changed"}}: <b>{{len .Changed}}</b>
+      {{with .PHPReloaded}}&nbsp; {{t $.Lang "apply.php_reloaded"}}:{{range .}} <code>{{.}}</code>{{end}}{{end}}
+      {{if gt .Batches 1}}&nbsp; {{t $.Lang "apply.batches"}}: <b>{{.Batches}}</b>{{end}}
     </p>
+    {{with .Remaining}}<p style="color:#b60;">{{t $.Lang "apply.remaining" .}}</p>{{end}}
 
     <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
       <thead>
         <tr>
-          <th align="left">Domain</th>
-          <th>Action</th>
-          <th>Status</th>
-          <th>Changed</th>
-          <th align="left">Error</th>
+          <th align="left">{{t $.Lang "col.domain"}}</th>
+          <th>{{t $.Lang "col.action"}}</th>
+          <th>{{t $.Lang "col.status"}}</th>
+          <th>{{t $.Lang "apply.changed"}}</th>
+          <th>{{t $.Lang "apply.hash"}}</th>
+          <th align="left">{{t $.Lang "col.error"}}</th>
         </tr>
       </thead>
       <tbody>
@@ -1144,57 +2970,111 @@ const applyResultHTML = `{{define "apply_result"}}
           <td>{{.Domain}}</td>
           <td align="center">{{.Action}}</td>
           <td align="center">{{.Status}}</td>
-          <td align="center">{{if .Changed}}yes{{else}}no{{end}}</td>
+          <td align="center">{{if .Changed}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}</td>
+          <td align="center">{{with .RenderHash}}<code title="{{.}}">{{printf "%.12s" .}}</code>{{end}}</td>
 	  <td><pre style="white-space:pre-wrap; margin:0;">{{.Error}}</pre></td>
         </tr>
       {{end}}
       </tbody>
     </table>
+
+    {{with .Diagnostics}}
+      <h3 style="margin-top:18px;">{{t $.Lang "apply.diagnostics"}}</h3>
+      <pre style="background:#f6f6f6; padding:12px; overflow:auto; white-space:pre-wrap;">{{.}}</pre>
+    {{end}}
+
+    {{with .Impact}}
+      <h3 style="margin-top:18px;">{{t $.Lang "impact.title"}}</h3>
+      <p style="opacity:.8; margin-top:0;">{{t $.Lang "impact.summary" (len .Sites) (printf "%.1f" .ReqPerMin)}}</p>
+      {{if .Restart}}
+        <div style="padding:10px; border:1px solid #b00; color:#b00; margin-bottom:10px;">
+          <b>{{t $.Lang "impact.restart"}}</b>
+          <ul style="margin:6px 0 0 0;">{{range .Reasons}}<li><code>{{.}}</code></li>{{end}}</ul>
+        </div>
+      {{end}}
+      <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse;">
+        <thead>
+          <tr>
+            <th align="left">{{t $.Lang "col.domain"}}</th>
+            <th>{{t $.Lang "col.action"}}</th>
+            <th>{{t $.Lang "impact.lines"}}</th>
+            <th>{{t $.Lang "impact.traffic"}}</th>
+          </tr>
+        </thead>
+        <tbody>
+        {{range .Sites}}
+          <tr>
+            <td>{{.Domain}}</td>
+            <td align="center">{{.Action}}</td>
+            <td align="center"><span style="color:#080;">+{{.Added}}</span> <span style="color:#b00;">-{{.Removed}}</span></td>
+            <td align="right">{{if ge .ReqPerMin 0.0}}{{printf "%.1f" .ReqPerMin}}{{else}}-{{end}}</td>
+          </tr>
+        {{end}}
+        </tbody>
+      </table>
+      {{if .Listeners}}<p><b>{{t $.Lang "impact.listeners"}}</b><br>{{range .Listeners}}<code>{{.}}</code><br>{{end}}</p>{{end}}
+      {{if .Zones}}<p><b>{{t $.Lang "impact.zones"}}</b><br>{{range .Zones}}<code>{{.}}</code><br>{{end}}</p>{{end}}
+    {{end}}
   {{end}}
 
   <p style="margin-top:14px;">
-    <a href="/ui/sites">Back to Sites</a>
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/apply">{{t .Lang "apply.again"}}</a>
     &nbsp;|&nbsp;
-    <a href="/ui/apply">Apply again</a>
+    <a href="/ui/apply/runs">{{t .Lang "apply.runs"}}</a>
   </p>
 {{end}}`
 
 const certsHTML = `{{define "certs"}}
-  <h2>Certificates</h2>
+  <h2>{{t .Lang "certs.title"}}</h2>
 
   <div style="margin:10px 0; padding:10px; border:1px solid #ddd;">
     <form method="get" action="/ui/cert/check" style="display:flex; gap:10px; align-items:center;">
-      <div>Check expiring within</div>
+      <div>{{t .Lang "certs.check_within"}}</div>
       <input name="days" value="30" style="padding:6px; width:80px;">
-      <div>days</div>
-      <button style="padding:8px 10px;">Check</button>
+      <div>{{t .Lang "certs.days"}}</div>
+      <button style="padding:8px 10px;">{{t .Lang "certs.check"}}</button>
     </form>
   </div>
 
   <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
     <thead>
       <tr>
-        <th align="left">Domain</th>
-        <th>Days Left</th>
-        <th>Not Before</th>
-        <th>Not After</th>
-        <th>Actions</th>
+        <th align="left">{{t .Lang "col.domain"}}</th>
+        <th>{{t .Lang "col.key_type"}}</th>
+        <th>{{t .Lang "col.days_left"}}</th>
+        <th>{{t .Lang "col.not_before"}}</th>
+        <th>{{t .Lang "col.not_after"}}</th>
+        <th>{{t .Lang "col.tls_grade"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
       </tr>
     </thead>
     <tbody>
     {{range .Items}}
       <tr>
-        <td>{{.Domain}}</td>
-        <td align="center">{{.DaysLeft}}</td>
-        <td align="center">{{.NotBefore.Format "2006-01-02 15:04"}}</td>
-        <td align="center">{{.NotAfter.Format "2006-01-02 15:04"}}</td>
+        <td>{{.Domain}}{{if .Source}} <small style="opacity:.7;">({{.Source}})</small>{{end}}</td>
+        <td align="center">{{.KeyType}}</td>
+        <td align="center">{{fmtNum $.Lang .DaysLeft}}</td>
+        <td align="center">{{fmtTime $.Lang .NotBefore}}</td>
+        <td align="center">{{fmtTime $.Lang .NotAfter}}</td>
+        <td align="center">
+          {{$g := index $.Grades .Domain}}
+          {{if $g.Grade}}<a href="/ui/tls?domain={{.Domain}}" title="{{fmtTime $.Lang $g.ScannedAt}}">{{template "tls_grade_badge" $g.Grade}}</a>{{else}}-{{end}}
+        </td>
         <td align="center" style="white-space:nowrap;">
-          <a href="/ui/cert/info?domain={{.Domain}}">Info</a>
+          <a href="/ui/cert/info?domain={{.Domain}}">{{t $.Lang "action.info"}}</a>
+          <form method="post" action="/ui/tls/scan" style="display:inline; margin-left:8px;">
+            <input type="hidden" name="domain" value="{{.Domain}}">
+            <button>{{t $.Lang "action.tls_scan"}}</button>
+          </form>
+          {{if not .Source}}
           <form method="post" action="/ui/cert/issue" style="display:inline; margin-left:8px;"
-                onsubmit="return confirm('Issue/renew certificate for {{.Domain}} ?');">
+                onsubmit="return confirm('{{t $.Lang "confirm.issue" .Domain}}');">
             <input type="hidden" name="domain" value="{{.Domain}}">
-            <button>Issue</button>
+            <button>{{t $.Lang "action.issue"}}</button>
           </form>
+          {{end}}
         </td>
       </tr>
     {{end}}
@@ -1202,57 +3082,152 @@ const certsHTML = `{{define "certs"}}
   </table>
 
   <div style="margin-top:14px; padding:10px; border:1px solid #ddd;">
-    <form method="post" action="/ui/cert/renew" onsubmit="return confirm('Renew ALL certificates?');">
+    <form method="post" action="/ui/cert/renew" onsubmit="return confirm('{{t .Lang "confirm.renew_all"}}');">
       <input type="hidden" name="all" value="true">
-      <button style="padding:10px 14px;">Renew All</button>
+      <button style="padding:10px 14px;">{{t .Lang "certs.renew_all"}}</button>
     </form>
   </div>
 {{end}}`
 
 const certInfoHTML = `{{define "cert_info"}}
-  <h2>Certificate Info</h2>
+  <h2>{{t .Lang "cert_info.title"}}</h2>
 
   {{if or (not .Info) (not .Info.Exists)}}
-    <p>Certificate does not exist.</p>
+    <p>{{t .Lang "cert_info.missing"}}</p>
   {{else}}
     <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
-      <tr><td><b>Domain</b></td><td>{{.Info.Domain}}</td></tr>
-      <tr><td><b>Cert Path</b></td><td>{{.Info.CertPath}}</td></tr>
-      <tr><td><b>Key Path</b></td><td>{{.Info.KeyPath}}</td></tr>
-      <tr><td><b>Not Before</b></td><td>{{.Info.NotBefore.Format "2006-01-02 15:04:05"}}</td></tr>
-      <tr><td><b>Not After</b></td><td>{{.Info.NotAfter.Format "2006-01-02 15:04:05"}}</td></tr>
-      <tr><td><b>Days Left</b></td><td>{{.Info.DaysLeft}}</td></tr>
+      <tr><td><b>{{t .Lang "col.domain"}}</b></td><td>{{.Info.Domain}}</td></tr>
+      <tr><td><b>{{t .Lang "col.cert_path"}}</b></td><td>{{.Info.CertPath}}</td></tr>
+      <tr><td><b>{{t .Lang "col.key_path"}}</b></td><td>{{.Info.KeyPath}}</td></tr>
+      {{if .Info.Source}}<tr><td><b>{{t .Lang "certsource.title"}}</b></td><td>{{.Info.Source}}</td></tr>{{end}}
+      <tr><td><b>{{t .Lang "col.key_type"}}</b></td><td>{{.Info.KeyType}}</td></tr>
+      <tr><td><b>{{t .Lang "col.not_before"}}</b></td><td>{{fmtTime .Lang .Info.NotBefore}}</td></tr>
+      <tr><td><b>{{t .Lang "col.not_after"}}</b></td><td>{{fmtTime .Lang .Info.NotAfter}}</td></tr>
+      <tr><td><b>{{t .Lang "col.days_left"}}</b></td><td>{{fmtNum .Lang .Info.DaysLeft}}</td></tr>
     </table>
 
+    {{if not .Info.Source}}
     <div style="margin-top:12px;">
       <form method="post" action="/ui/cert/issue" style="display:inline;"
-            onsubmit="return confirm('Issue/renew certificate for {{.Info.Domain}} ?');">
+            onsubmit="return confirm('{{t .Lang "confirm.issue" .Info.Domain}}');">
         <input type="hidden" name="domain" value="{{.Info.Domain}}">
-        <button style="padding:10px 14px;">Issue / Renew</button>
+        <button style="padding:10px 14px;">{{t .Lang "cert_info.issue_renew"}}</button>
       </form>
 
       <form method="post" action="/ui/cert/renew" style="display:inline; margin-left:10px;">
         <input type="hidden" name="domain" value="{{.Info.Domain}}">
-        <button style="padding:10px 14px;">Renew (single)</button>
+        <button style="padding:10px 14px;">{{t .Lang "cert_info.renew_single"}}</button>
+      </form>
+
+      <form method="post" action="/ui/cert/revoke" style="display:inline; margin-left:10px;"
+            onsubmit="return confirm('{{t .Lang "confirm.revoke" .Info.Domain}}');">
+        <input type="hidden" name="domain" value="{{.Info.Domain}}">
+        <select name="reason" style="padding:8px;">
+          <option value="unspecified">{{t .Lang "cert_info.revoke_reason"}}</option>
+          <option value="keycompromise">keycompromise</option>
+          <option value="superseded">superseded</option>
+          <option value="cessationofoperation">cessationofoperation</option>
+          <option value="affiliationchanged">affiliationchanged</option>
+        </select>
+        <button style="padding:10px 14px;">{{t .Lang "cert_info.revoke"}}</button>
       </form>
     </div>
+    {{end}}
+
+    {{if and .Site (not .Info.Source)}}
+    <h3 style="margin-top:18px;">{{t .Lang "dualcert.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "dualcert.subtitle"}}</p>
+    {{with .Alt}}
+    <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
+      <tr><td><b>{{t $.Lang "col.key_type"}}</b></td><td>{{.KeyType}}</td></tr>
+      <tr><td><b>{{t $.Lang "col.cert_path"}}</b></td><td>{{.CertPath}}</td></tr>
+      <tr><td><b>{{t $.Lang "col.not_after"}}</b></td><td>{{fmtTime $.Lang .NotAfter}}</td></tr>
+      <tr><td><b>{{t $.Lang "col.days_left"}}</b></td><td>{{fmtNum $.Lang .DaysLeft}}</td></tr>
+    </table>
+    {{end}}
+    <form method="post" action="/ui/cert/dual" style="margin-top:10px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{.Site.Domain}}">
+      {{if .Site.DualCert}}
+        <input type="hidden" name="on" value="false">
+        <button style="padding:10px 14px;">{{t .Lang "dualcert.off"}}</button>
+      {{else}}
+        <input type="hidden" name="on" value="true">
+        <button style="padding:10px 14px;">{{t .Lang "dualcert.on"}}</button>
+      {{end}}
+    </form>
+    {{end}}
+  {{end}}
+
+  {{with .Site}}
+    <h3 style="margin-top:18px;">{{t $.Lang "certsource.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t $.Lang "certsource.subtitle"}}</p>
+    <form method="post" action="/ui/cert/source" style="margin-top:10px;">
+      <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+      <input type="hidden" name="domain" value="{{.Domain}}">
+      <select name="source">
+        <option value="letsencrypt"{{if or (eq .CertSource "") (eq .CertSource "letsencrypt")}} selected{{end}}>{{t $.Lang "certsource.letsencrypt"}}</option>
+        <option value="path"{{if eq .CertSource "path"}} selected{{end}}>{{t $.Lang "certsource.path"}}</option>
+        <option value="remote"{{if eq .CertSource "remote"}} selected{{end}}>{{t $.Lang "certsource.remote"}}</option>
+        <option value="shared"{{if eq .CertSource "shared"}} selected{{end}}>{{t $.Lang "certsource.shared"}}</option>
+      </select>
+      <input name="cert" value="{{.TLSCertPath}}" placeholder="/etc/ssl/example/fullchain.pem" style="width:300px;">
+      <input name="key" value="{{.TLSKeyPath}}" placeholder="/etc/ssl/example/privkey.pem" style="width:300px;">
+      <input name="lineage" value="{{.CertLineage}}" placeholder="{{t $.Lang "certsource.lineage"}}" style="width:200px;">
+      <button style="padding:6px 10px;">{{t $.Lang "action.save"}}</button>
+    </form>
+
+    {{if or (eq .CertSource "") (eq .CertSource "letsencrypt")}}
+    <h3 style="margin-top:18px;">{{t $.Lang "acmeca.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t $.Lang "acmeca.subtitle"}}</p>
+    {{with $.CAIssuedBy}}<p>{{t $.Lang "acmeca.issued_by"}} <code>{{.}}</code></p>{{end}}
+    <form method="post" action="/ui/cert/ca" style="margin-top:10px;">
+      <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+      <input type="hidden" name="domain" value="{{.Domain}}">
+      <select name="ca">
+        <option value=""{{if eq .ACMECA ""}} selected{{end}}>{{t $.Lang "acmeca.default" $.DefaultCA}}</option>
+        {{range $.CAs}}<option value="{{.}}"{{if eq $.Site.ACMECA .}} selected{{end}}>{{.}}</option>{{end}}
+      </select>
+      <button style="padding:6px 10px;">{{t $.Lang "action.save"}}</button>
+    </form>
+    {{end}}
+  {{end}}
+
+  {{if or .DNS .DNSAvailable}}
+    <h3 style="margin-top:18px;">{{t .Lang "acmedns.title"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "acmedns.subtitle"}}</p>
+    <form method="post" action="/ui/cert/dns" style="margin-top:10px;">
+      <input type="hidden" name="idempotency_key" value="{{.IdemKey}}">
+      <input type="hidden" name="domain" value="{{.Domain}}">
+    {{with .DNS}}
+      <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
+        <tr><td><b>{{t $.Lang "acmedns.record"}}</b></td><td><code>{{.Record}}. CNAME {{.Target}}.</code></td></tr>
+        <tr><td><b>{{t $.Lang "acmedns.server"}}</b></td><td>{{.Server}}</td></tr>
+        <tr><td><b>{{t $.Lang "col.status"}}</b></td><td>{{if .Delegated}}{{t $.Lang "acmedns.ok"}}{{else}}<span style="color:#b00;">{{t $.Lang "acmedns.missing"}}</span> ({{.CheckError}}){{end}}</td></tr>
+      </table>
+      <input type="hidden" name="off" value="true">
+      <button style="padding:10px 14px; margin-top:10px;">{{t $.Lang "acmedns.off"}}</button>
+    {{else}}
+      <button style="padding:10px 14px;">{{t .Lang "acmedns.on"}}</button>
+    {{end}}
+    </form>
   {{end}}
 
-  <p style="margin-top:14px;"><a href="/ui/certs">Back to Certificates</a></p>
+  <p style="margin-top:14px;"><a href="/ui/certs">{{t .Lang "common.back_certs"}}</a></p>
 {{end}}`
 
 const certCheckHTML = `{{define "cert_check"}}
-  <h2>Certificates expiring within {{.Days}} days</h2>
+  <h2>{{t .Lang "cert_check.title" .Days}}</h2>
 
   {{if not .Items}}
-    <p>No certificates expiring soon.</p>
+    <p>{{t .Lang "cert_check.none"}}</p>
   {{else}}
     <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
       <thead>
         <tr>
-          <th align="left">Domain</th>
-          <th>Days Left</th>
-          <th>Expires</th>
+          <th align="left">{{t .Lang "col.domain"}}</th>
+          <th>{{t .Lang "col.days_left"}}</th>
+          <th>{{t .Lang "col.expires"}}</th>
         </tr>
       </thead>
       <tbody>
@@ -1260,8 +3235,8 @@ const certCheckHTML = `{{define "cert_check"}}
         {{if le .DaysLeft $.Days}}
           <tr>
             <td>{{.Domain}}</td>
-            <td align="center">{{.DaysLeft}}</td>
-            <td align="center">{{.NotAfter.Format "2006-01-02 15:04"}}</td>
+            <td align="center">{{fmtNum $.Lang .DaysLeft}}</td>
+            <td align="center">{{fmtTime $.Lang .NotAfter}}</td>
           </tr>
         {{end}}
       {{end}}
@@ -1269,5 +3244,5 @@ const certCheckHTML = `{{define "cert_check"}}
     </table>
   {{end}}
 
-  <p style="margin-top:14px;"><a href="/ui/certs">Back to Certificates</a></p>
+  <p style="margin-top:14px;"><a href="/ui/certs">{{t .Lang "common.back_certs"}}</a></p>
 {{end}}`
@@ -3,8 +3,12 @@ package web
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sort"
 	"sync"
 	"time"
+
+	"mynginx/internal/auth"
+	"mynginx/internal/config"
 )
 
 type Session struct {
@@ -12,41 +16,110 @@ type Session struct {
 	UserID  int64
 	Username string
 	Role    string
+	Lang    string
 	Expires time.Time
+
+	// Created is the login time, LastSeen the latest request and AuthAt the latest
+	// password entry (login or re-authentication).
+	Created  time.Time
+	LastSeen time.Time
+	AuthAt   time.Time
+
+	// MustChangePassword restricts the session to the password change page.
+	MustChangePassword bool
+
+	// Stamp is auth.Stamp of the password hash the session was opened with; once the
+	// stored hash differs (changed elsewhere, e.g. `ngm panel-user passwd`) the session
+	// ends on its next request.
+	Stamp string
+
+	// Owner is the hosting user whose sites a role=user session manages (looked up
+	// per request by requireAuth, so a changed link applies at once).
+	Owner string
+}
+
+// Admin reports whether the session has full panel access. Any role but admin gets
+// the user restrictions, so an unknown role never widens access.
+func (s Session) Admin() bool {
+	return s.Role == auth.RoleAdmin
 }
 
 type SessionStore struct {
 	mu   sync.Mutex
 	data map[string]Session
 	ttl  time.Duration
+	idle time.Duration // 0 = no idle timeout
+	max  int           // sessions per user, 0 = unlimited
+}
+
+// newSessionStore builds the store from security.session.
+func newSessionStore(cfg config.SessionConfig) *SessionStore {
+	ttl, idle, _ := cfg.Durations()
+	return NewSessionStore(ttl, idle, cfg.MaxPerUser)
 }
 
-func NewSessionStore(ttl time.Duration) *SessionStore {
+// NewSessionStore keeps sessions for ttl, or until idle passes without a request
+// (0 = off); a user gets at most maxPerUser sessions (0 = unlimited).
+func NewSessionStore(ttl, idle time.Duration, maxPerUser int) *SessionStore {
 	return &SessionStore{
 		data: map[string]Session{},
 		ttl:  ttl,
+		idle: idle,
+		max:  maxPerUser,
 	}
 }
 
-func (s *SessionStore) New(userID int64, username, role string) (Session, error) {
+func (s *SessionStore) New(userID int64, username, role, lang string) (Session, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
 		return Session{}, err
 	}
 	tok := hex.EncodeToString(b)
+	now := time.Now()
 	sess := Session{
 		Token:   tok,
 		UserID:  userID,
 		Username: username,
 		Role:    role,
-		Expires: time.Now().Add(s.ttl),
+		Lang:    lang,
+		Expires: now.Add(s.ttl),
+		Created:  now,
+		LastSeen: now,
+		AuthAt:   now,
 	}
 	s.mu.Lock()
+	s.evictLocked(userID, now)
 	s.data[tok] = sess
 	s.mu.Unlock()
 	return sess, nil
 }
 
+// evictLocked makes room for one more session of userID: expired sessions go,
+// then the oldest ones beyond the per-user limit.
+func (s *SessionStore) evictLocked(userID int64, now time.Time) {
+	var mine []Session
+	for tok, sess := range s.data {
+		if s.expired(sess, now) {
+			delete(s.data, tok)
+			continue
+		}
+		if sess.UserID == userID {
+			mine = append(mine, sess)
+		}
+	}
+	if s.max <= 0 || len(mine) < s.max {
+		return
+	}
+	sort.Slice(mine, func(i, j int) bool { return mine[i].Created.Before(mine[j].Created) })
+	for _, sess := range mine[:len(mine)-s.max+1] {
+		delete(s.data, sess.Token)
+	}
+}
+
+func (s *SessionStore) expired(sess Session, now time.Time) bool {
+	return now.After(sess.Expires) || (s.idle > 0 && now.Sub(sess.LastSeen) > s.idle)
+}
+
 func (s *SessionStore) Get(token string) (Session, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -54,15 +127,74 @@ func (s *SessionStore) Get(token string) (Session, bool) {
 	if !ok {
 		return Session{}, false
 	}
-	if time.Now().After(sess.Expires) {
+	now := time.Now()
+	if s.expired(sess, now) {
 		delete(s.data, token)
 		return Session{}, false
 	}
+	sess.LastSeen = now
+	s.data[token] = sess
 	return sess, true
 }
 
+// Reauthenticated records a fresh password entry on a live session.
+func (s *SessionStore) Reauthenticated(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.data[token]; ok {
+		sess.AuthAt = time.Now()
+		s.data[token] = sess
+	}
+}
+
+// DeleteUser signs out every session of userID except keep (e.g. after a password
+// change); it returns how many went.
+func (s *SessionStore) DeleteUser(userID int64, keep string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for tok, sess := range s.data {
+		if sess.UserID == userID && tok != keep {
+			delete(s.data, tok)
+			n++
+		}
+	}
+	return n
+}
+
 func (s *SessionStore) Delete(token string) {
 	s.mu.Lock()
 	delete(s.data, token)
 	s.mu.Unlock()
 }
+
+// SetLang updates the UI language of a live session.
+func (s *SessionStore) SetLang(token, lang string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.data[token]; ok {
+		sess.Lang = lang
+		s.data[token] = sess
+	}
+}
+
+// SetStamp records the password stamp of a live session (at login, and after the
+// session itself changed the password).
+func (s *SessionStore) SetStamp(token, stamp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.data[token]; ok {
+		sess.Stamp = stamp
+		s.data[token] = sess
+	}
+}
+
+// SetMustChangePassword updates the forced-change flag of a live session.
+func (s *SessionStore) SetMustChangePassword(token string, must bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.data[token]; ok {
+		sess.MustChangePassword = must
+		s.data[token] = sess
+	}
+}
@@ -0,0 +1,213 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"mynginx/internal/app"
+	"mynginx/internal/auth"
+)
+
+// initSetup arms the first-run setup when there is no panel user yet. The setup
+// code goes to the serve log only, so reaching the port first is not enough to
+// claim the panel.
+func (s *Server) initSetup() error {
+	need, err := s.core.NeedsSetup()
+	if err != nil || !need {
+		return err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	code := hex.EncodeToString(b)
+	s.setupMu.Lock()
+	s.setupCode = code
+	s.setupMu.Unlock()
+	log.Printf("no panel user yet: open /ui/setup and enter the setup code %s", code)
+	return nil
+}
+
+// setupCodeOK compares code with the setup code in constant time; a closed setup
+// accepts none.
+func (s *Server) setupCodeOK(code string) bool {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+	return s.setupCode != "" && subtle.ConstantTimeCompare([]byte(code), []byte(s.setupCode)) == 1
+}
+
+// needsSetup reports whether the first-run setup is still open. It closes for good
+// once a panel user exists, however it was created.
+func (s *Server) needsSetup() bool {
+	s.setupMu.Lock()
+	defer s.setupMu.Unlock()
+	if s.setupCode == "" {
+		return false
+	}
+	if need, err := s.core.NeedsSetup(); err == nil && !need {
+		s.setupCode = ""
+		return false
+	}
+	return true
+}
+
+// handleSetup is the first-run setup: the first admin, a look at the nginx and
+// certbot paths and the ACME email. It logs the new admin in.
+func (s *Server) handleSetup(w http.ResponseWriter, r *http.Request) {
+	if !s.needsSetup() {
+		http.Redirect(w, r, "/ui/login", http.StatusFound)
+		return
+	}
+	lang := s.i18n.FromRequest(r)
+	data := map[string]any{
+		"Lang":      lang,
+		"Policy":    s.cfg.Security.PasswordPolicy,
+		"ACMEEmail": s.cfg.Certs.Email,
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		_ = r.ParseForm()
+		username := strings.TrimSpace(r.FormValue("username"))
+		email := strings.TrimSpace(r.FormValue("email"))
+		acme := strings.TrimSpace(r.FormValue("acme_email"))
+		pass := r.FormValue("password")
+		data["Username"], data["Email"], data["ACMEEmail"] = username, email, acme
+
+		if !s.setupCodeOK(strings.TrimSpace(r.FormValue("code"))) {
+			s.core.Audit("warning", "auth", "setup refused from %s (wrong setup code)", remoteHost(r))
+			data["Error"] = s.i18n.T(lang, "setup.bad_code")
+			break
+		}
+		switch {
+		case username == "":
+			data["Error"] = s.i18n.T(lang, "setup.username_required")
+		case pass != r.FormValue("confirm"):
+			data["Error"] = s.i18n.T(lang, "password.mismatch")
+		case email != "" && !validEmail(email):
+			data["Error"] = s.i18n.T(lang, "setup.bad_email", email)
+		}
+		if data["Error"] != nil {
+			break
+		}
+		hash, err := s.hashPassword(pass)
+		if err != nil {
+			data["Error"] = err.Error()
+			break
+		}
+		if err := s.core.SetACMEEmail(acme); err != nil {
+			var ve *app.ValidationError
+			if !errors.As(err, &ve) {
+				log.Printf("setup: %v", err)
+			}
+			data["Error"] = err.Error()
+			break
+		}
+
+		s.setupMu.Lock()
+		if need, err := s.core.NeedsSetup(); err != nil || !need {
+			s.setupCode = ""
+			s.setupMu.Unlock()
+			http.Redirect(w, r, "/ui/login", http.StatusFound)
+			return
+		}
+		u, err := s.st.CreatePanelUser(username, hash, "admin", true)
+		if err == nil {
+			s.setupCode = ""
+		}
+		s.setupMu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if email != "" {
+			_ = s.st.UpdatePanelUserEmail(u.ID, email)
+		}
+		_ = s.st.UpdatePanelUserLanguage(u.ID, lang)
+		s.core.AuditOwner(u.Username, "info", "auth", "first-run setup: admin %q created from %s", u.Username, remoteHost(r))
+
+		sess, err := s.sessions.New(u.ID, u.Username, u.Role, lang)
+		if err != nil {
+			http.Redirect(w, r, "/ui/login", http.StatusFound)
+			return
+		}
+		s.sessions.SetStamp(sess.Token, auth.Stamp(u.PasswordHash))
+		_ = s.st.UpdatePanelUserLastLogin(u.ID)
+		s.setSessionCookie(w, r, sess.Token)
+		http.Redirect(w, r, "/ui/sites", http.StatusFound)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data["Report"] = s.core.SetupReport(r.Context())
+	_ = s.tpl.ExecuteTemplate(w, "setup", data)
+}
+
+func validEmail(v string) bool {
+	addr, err := mail.ParseAddress(v)
+	return err == nil && addr.Address == v
+}
+
+const setupHTML = `<!doctype html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8"><title>{{t .Lang "setup.title"}}</title></head>
+<body style="font-family:system-ui; max-width:720px; margin:40px auto;">
+  <h2>{{t .Lang "setup.title"}}</h2>
+  <p style="opacity:.8;">{{t .Lang "setup.intro"}}</p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  <h3>{{t .Lang "setup.paths"}}</h3>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "setup.paths_hint" .Report.Path}}</p>
+  <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    {{range .Report.Checks}}
+      <tr>
+        <td align="center" style="color:{{if eq .Level "error"}}#b00{{else if eq .Level "warn"}}#b60{{else}}#080{{end}};">{{.Level}}</td>
+        <td><code>{{if .Item}}{{.Item}}{{else}}{{.Section}}{{end}}</code></td>
+        <td>{{.Message}}</td>
+      </tr>
+    {{end}}
+  </table>
+  {{if .Report.Errors}}<p style="color:#b00;">{{t .Lang "setup.paths_errors" .Report.Errors}}</p>{{end}}
+
+  <form method="post" action="/ui/setup">
+    <h3>{{t .Lang "setup.admin"}}</h3>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "login.username"}}</label><br/>
+      <input name="username" value="{{.Username}}" autocomplete="username" style="width:100%; padding:8px;" />
+    </div>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "login.password"}}</label><br/>
+      <input type="password" name="password" autocomplete="new-password" style="width:100%; padding:8px;" />
+    </div>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "password.confirm"}}</label><br/>
+      <input type="password" name="confirm" autocomplete="new-password" style="width:100%; padding:8px;" />
+    </div>
+    ` + passwordPolicyHTML + `
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "setup.email"}}</label><br/>
+      <input name="email" value="{{.Email}}" style="width:100%; padding:8px;" />
+    </div>
+
+    <h3>{{t .Lang "setup.acme"}}</h3>
+    <div style="margin:10px 0;">
+      <label>{{t .Lang "setup.acme_email"}}</label><br/>
+      <input name="acme_email" value="{{.ACMEEmail}}" style="width:100%; padding:8px;" />
+    </div>
+
+    <h3>{{t .Lang "setup.code"}}</h3>
+    <p style="opacity:.8; margin-top:0;">{{t .Lang "setup.code_hint"}}</p>
+    <div style="margin:10px 0;">
+      <input name="code" autocomplete="off" style="width:100%; padding:8px; font-family:monospace;" />
+    </div>
+    <button style="padding:10px 14px;">{{t .Lang "setup.submit"}}</button>
+  </form>
+</body></html>`
@@ -0,0 +1,16 @@
+package web
+
+import "testing"
+
+func TestSetupCodeOK(t *testing.T) {
+	s := &Server{}
+	if s.setupCodeOK("") {
+		t.Error("closed setup accepted an empty code")
+	}
+	s.setupCode = "0123456789abcdef"
+	for code, want := range map[string]bool{"0123456789abcdef": true, "0123456789abcde": false, "": false} {
+		if got := s.setupCodeOK(code); got != want {
+			t.Errorf("setupCodeOK(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// handleSiteConfig serves /ui/sites/config?domain=d: the generated vhost (live and,
+// if different, staged), read-only. &download=live|staged returns the raw file.
+func (s *Server) handleSiteConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	conf, err := s.core.SiteConfig(r.Context(), r.URL.Query().Get("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch dl := strings.TrimSpace(r.URL.Query().Get("download")); dl {
+	case "":
+	case "live", "staged":
+		body, name := conf.Live, conf.Domain+".conf"
+		if dl == "staged" {
+			body, name = conf.Staged, conf.Domain+".staged.conf"
+		}
+		if body == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, _ = w.Write(body)
+		return
+	default:
+		http.Error(w, "download must be live or staged", http.StatusBadRequest)
+		return
+	}
+
+	data := map[string]any{
+		"Conf":          conf,
+		"StagedDiffers": conf.StagedDiffers(),
+	}
+	if conf.Live != nil {
+		data["LiveHTML"] = highlightNginx(conf.Live)
+	}
+	if conf.StagedDiffers() {
+		data["StagedHTML"] = highlightNginx(conf.Staged)
+	}
+	s.render(w, r, "Site config", "site_config", data)
+}
+
+// handleSiteRender serves /ui/sites/preview?domain=d: the vhost the next apply
+// would publish, rendered from the current settings without touching any file, and
+// its diff against the live one. &download=1 returns the raw render.
+func (s *Server) handleSiteRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rend, err := s.core.SiteRender(r.Context(), r.URL.Query().Get("domain"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		// a render error is what an apply would fail with: show it
+		s.render(w, r, "Site render", "site_render", map[string]any{
+			"Domain": strings.ToLower(strings.TrimSpace(r.URL.Query().Get("domain"))),
+			"Error":  err.Error(),
+		})
+		return
+	}
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+rend.Domain+`.render.conf"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		_, _ = w.Write(rend.Conf)
+		return
+	}
+	s.render(w, r, "Site render", "site_render", map[string]any{
+		"Domain":    rend.Domain,
+		"Render":    rend,
+		"ConfHTML":  highlightNginx(rend.Conf),
+		"DiffLines": diffLines(rend.Diff),
+	})
+}
+
+// diffLine is a line of a unified diff with the class it is shown in.
+type diffLine struct {
+	Class string // "add" | "del" | "c" (headers and hunks) | ""
+	Text  string
+}
+
+func diffLines(diff string) []diffLine {
+	var out []diffLine
+	for _, l := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		cls := ""
+		switch {
+		case strings.HasPrefix(l, "+++"), strings.HasPrefix(l, "---"), strings.HasPrefix(l, "@@"):
+			cls = "c"
+		case strings.HasPrefix(l, "+"):
+			cls = "add"
+		case strings.HasPrefix(l, "-"):
+			cls = "del"
+		}
+		out = append(out, diffLine{Class: cls, Text: l})
+	}
+	return out
+}
+
+const siteConfigHTML = `{{define "site_config"}}
+  <style>
+    pre.ngconf { background:#f7f7f7; border:1px solid #ddd; padding:10px; overflow-x:auto; font-size:13px; line-height:1.4; }
+    pre.ngconf .c { color:#888; font-style:italic; }
+    pre.ngconf .d { color:#05a; font-weight:600; }
+    pre.ngconf .s { color:#080; }
+    pre.ngconf .v { color:#909; }
+  </style>
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "siteconf.title" .Conf.Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "siteconf.subtitle"}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Conf.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites/preview?domain={{.Conf.Domain}}">{{t .Lang "action.render"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </p>
+
+  <h3>{{t .Lang "siteconf.live"}} <code style="font-size:70%; font-weight:normal;">{{.Conf.LivePath}}</code></h3>
+  {{if .LiveHTML}}
+    <p><a href="/ui/sites/config?domain={{.Conf.Domain}}&download=live">{{t .Lang "siteconf.download"}}</a></p>
+    <pre class="ngconf">{{.LiveHTML}}</pre>
+  {{else}}
+    <p style="opacity:.7;">{{t .Lang "siteconf.no_live"}}</p>
+  {{end}}
+
+  {{if .StagedDiffers}}
+    <h3>{{t .Lang "siteconf.staged"}} <code style="font-size:70%; font-weight:normal;">{{.Conf.StagedPath}}</code></h3>
+    <p style="color:#b60;">{{t .Lang "siteconf.staged_differs"}}</p>
+    <p><a href="/ui/sites/config?domain={{.Conf.Domain}}&download=staged">{{t .Lang "siteconf.download"}}</a></p>
+    <pre class="ngconf">{{.StagedHTML}}</pre>
+  {{else if .LiveHTML}}
+    <p style="opacity:.7;">{{t .Lang "siteconf.staged_same"}}</p>
+  {{end}}
+{{end}}`
+
+const siteRenderHTML = `{{define "site_render"}}
+  <style>
+    pre.ngconf { background:#f7f7f7; border:1px solid #ddd; padding:10px; overflow-x:auto; font-size:13px; line-height:1.4; }
+    pre.ngconf .c { color:#888; font-style:italic; }
+    pre.ngconf .d { color:#05a; font-weight:600; }
+    pre.ngconf .s { color:#080; }
+    pre.ngconf .v { color:#909; }
+    pre.ngconf .add { color:#070; }
+    pre.ngconf .del { color:#b00; }
+  </style>
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "siterender.title" .Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "siterender.subtitle"}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites/config?domain={{.Domain}}">{{t .Lang "action.view_config"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </p>
+
+  {{with .Error}}
+    <p style="color:#b00;">{{t $.Lang "siterender.failed"}}</p>
+    <pre style="white-space:pre-wrap;">{{.}}</pre>
+  {{end}}
+  {{with .Render}}
+    {{if not .Enabled}}<p style="color:#b60;">{{t $.Lang "siterender.disabled"}}</p>{{end}}
+    <p>{{t $.Lang "history.hash"}}: <code>{{.Hash}}</code></p>
+
+    <h3>{{t $.Lang "siterender.changes"}}</h3>
+    {{if not .Live}}
+      <p style="opacity:.7;">{{t $.Lang "siteconf.no_live"}}</p>
+    {{else if .Diff}}
+      <p>{{t $.Lang "siterender.diff" .Added .Removed}}</p>
+      <pre class="ngconf">{{range $.DiffLines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>
+    {{else}}
+      <p style="opacity:.7;">{{t $.Lang "siterender.same"}}</p>
+    {{end}}
+
+    <h3>{{t $.Lang "siterender.conf"}}</h3>
+    <p><a href="/ui/sites/preview?domain={{.Domain}}&download=1">{{t $.Lang "siteconf.download"}}</a></p>
+    <pre class="ngconf">{{$.ConfHTML}}</pre>
+  {{end}}
+{{end}}`
@@ -0,0 +1,296 @@
+package web
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mynginx/internal/app"
+)
+
+// siteLogSizes are the line counts offered on the log page.
+var siteLogSizes = []int{100, app.DefaultLogLines, 500, 1000, app.MaxLogLines}
+
+// Limits of the live log streams (/ui/sites/logs/stream).
+const (
+	logFollowIdle    = 10 * time.Minute // a stream with no new line for this long is closed
+	logFollowPerUser = 3                // open streams per panel user
+)
+
+// logFollows counts the open log streams per panel user.
+type logFollows struct {
+	mu sync.Mutex
+	n  map[int64]int
+}
+
+// acquire takes a stream for user, false when it has logFollowPerUser open.
+func (f *logFollows) acquire(user int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == nil {
+		f.n = map[int64]int{}
+	}
+	if f.n[user] >= logFollowPerUser {
+		return false
+	}
+	f.n[user]++
+	return true
+}
+
+func (f *logFollows) release(user int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n[user]--; f.n[user] <= 0 {
+		delete(f.n, user)
+	}
+}
+
+// handleSiteLogs serves /ui/sites/logs?domain=d&log=access|error&n=N: the last N
+// lines of one of the site's logs, newest last, with warnings and errors marked.
+func (s *Server) handleSiteLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	name := strings.TrimSpace(q.Get("log"))
+	if name == "" {
+		name = "error"
+	}
+	n, _ := strconv.Atoi(q.Get("n"))
+	tail, err := s.core.SiteLogTail(q.Get("domain"), name, n)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	var ve *app.ValidationError
+	if errors.As(err, &ve) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case n <= 0:
+		n = app.DefaultLogLines
+	case n > app.MaxLogLines:
+		n = app.MaxLogLines
+	}
+	data := map[string]any{
+		"Domain": tail.Domain,
+		"Log":    name,
+		"N":      n,
+		"Sizes":  siteLogSizes,
+		"Tail":   tail,
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	} else {
+		var warns, errs int
+		for _, l := range tail.Lines {
+			switch l.Level {
+			case "warn":
+				warns++
+			case "error":
+				errs++
+			}
+		}
+		data["Warns"], data["Errs"] = warns, errs
+	}
+	s.render(w, r, "Site logs", "site_logs", data)
+}
+
+// logStreamChunk is a "lines" event of a log stream.
+type logStreamChunk struct {
+	Lines   []logStreamLine `json:"lines"`
+	Skipped int             `json:"skipped,omitempty"` // lines left out (rate limit)
+	Bytes   int64           `json:"skipped_bytes,omitempty"`
+	Rotated bool            `json:"rotated,omitempty"`
+}
+
+type logStreamLine struct {
+	Text  string `json:"text"`
+	Level string `json:"level,omitempty"`
+}
+
+// handleSiteLogStream serves /ui/sites/logs/stream?domain=d&log=access|error: the
+// lines appended to the log as Server-Sent Events ("lines", JSON), at most
+// app.FollowMaxLines per app.FollowPoll. The stream ends with "idle" once nothing
+// was logged for logFollowIdle, or "error" when the log can no longer be read.
+func (s *Server) handleSiteLogStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := s.sessionFromCtx(r)
+	if !s.logFollows.acquire(sess.UserID) {
+		http.Error(w, fmt.Sprintf("at most %d log streams at a time", logFollowPerUser), http.StatusTooManyRequests)
+		return
+	}
+	defer s.logFollows.release(sess.UserID)
+
+	q := r.URL.Query()
+	follow, err := s.core.FollowSiteLog(q.Get("domain"), strings.TrimSpace(q.Get("log")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	var ve *app.ValidationError
+	if errors.As(err, &ve) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer follow.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx in front: do not buffer the stream
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
+	}
+
+	// each write gets its own deadline, past the server-wide write timeout
+	send := func(event string, v any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(applyStreamPing * 2))
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	poll := time.NewTicker(app.FollowPoll)
+	defer poll.Stop()
+	ping := time.NewTicker(applyStreamPing)
+	defer ping.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopping:
+			return
+		case <-poll.C:
+			c, err := follow.Next()
+			if err != nil {
+				send("error", map[string]string{"error": err.Error()})
+				return
+			}
+			if len(c.Lines) == 0 && c.Skipped == 0 && c.SkippedBytes == 0 && !c.Rotated {
+				if time.Since(last) > logFollowIdle {
+					send("idle", map[string]string{"idle": logFollowIdle.String()})
+					return
+				}
+				continue
+			}
+			last = time.Now()
+			ev := logStreamChunk{Lines: []logStreamLine{}, Skipped: c.Skipped, Bytes: c.SkippedBytes, Rotated: c.Rotated}
+			for _, l := range c.Lines {
+				ev.Lines = append(ev.Lines, logStreamLine{Text: l.Text, Level: l.Level})
+			}
+			if !send("lines", ev) {
+				return
+			}
+		case <-ping.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(applyStreamPing * 2))
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+const siteLogsHTML = `{{define "site_logs"}}
+  <style>
+    pre.sitelog { background:#f7f7f7; border:1px solid #ddd; padding:10px; overflow-x:auto; font-size:12px; line-height:1.35; }
+    pre.sitelog .warn { color:#a60; }
+    pre.sitelog .error { color:#b00; font-weight:600; }
+  </style>
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "sitelogs.title" .Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "sitelogs.subtitle"}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </p>
+
+  <form method="get" action="/ui/sites/logs" style="margin-bottom:12px;">
+    <input type="hidden" name="domain" value="{{.Domain}}">
+    <select name="log">
+      <option value="error"{{if eq .Log "error"}} selected{{end}}>error.log</option>
+      <option value="access"{{if eq .Log "access"}} selected{{end}}>access.log</option>
+    </select>
+    <select name="n">
+      {{range .Sizes}}<option value="{{.}}"{{if eq . $.N}} selected{{end}}>{{t $.Lang "sitelogs.lines" .}}</option>{{end}}
+    </select>
+    <button type="submit">{{t .Lang "sitelogs.show"}}</button>
+    <button type="button" id="log-follow">{{t .Lang "sitelogs.follow"}}</button>
+    <span id="log-follow-state" style="margin-left:8px; opacity:.8;"></span>
+  </form>
+
+  {{with .Error}}
+    <p style="color:#b00;">{{t $.Lang "sitelogs.failed"}}</p>
+    <pre style="white-space:pre-wrap;">{{.}}</pre>
+  {{else}}{{with .Tail}}
+    <p style="opacity:.8;"><code>{{.Path}}</code>{{if not .Missing}} &middot; {{fmtNum $.Lang .Size}} B &middot; {{fmtTime $.Lang .ModTime}}{{end}}</p>
+    {{if .Missing}}
+      <p style="opacity:.7;">{{t $.Lang "sitelogs.missing"}}</p>
+    {{else if not .Lines}}
+      <p style="opacity:.7;">{{t $.Lang "sitelogs.empty"}}</p>
+    {{else}}
+      <p>{{t $.Lang "sitelogs.count" (len .Lines) $.Warns $.Errs}}</p>
+    {{end}}
+    <pre class="sitelog" id="log-lines"{{if not .Lines}} style="display:none;"{{end}}>{{range .Lines}}<span class="{{.Level}}">{{.Text}}</span>
+{{end}}</pre>
+  {{end}}{{end}}
+  <script>
+    (function () {
+      const btn = document.getElementById("log-follow"), state = document.getElementById("log-follow-state");
+      const pre = document.getElementById("log-lines");
+      let es = null;
+      const add = (text, cls) => {
+        const span = document.createElement("span");
+        span.className = cls || "";
+        span.textContent = text;
+        pre.append(span, "\n");
+        pre.style.display = "";
+        pre.scrollTop = pre.scrollHeight;
+        window.scrollTo(0, document.body.scrollHeight);
+      };
+      const stop = (msg) => {
+        if (es) { es.close(); es = null; }
+        btn.textContent = "{{t .Lang "sitelogs.follow"}}";
+        state.textContent = msg || "";
+      };
+      btn.addEventListener("click", () => {
+        if (es) { stop(); return; }
+        if (!pre) return;
+        es = new EventSource("/ui/sites/logs/stream?domain={{.Domain}}&log={{.Log}}");
+        btn.textContent = "{{t .Lang "sitelogs.unfollow"}}";
+        state.textContent = "{{t .Lang "sitelogs.following"}}";
+        es.addEventListener("lines", m => {
+          const ev = JSON.parse(m.data);
+          if (ev.rotated) add("-- {{t .Lang "sitelogs.rotated"}} --", "warn");
+          if (ev.skipped || ev.skipped_bytes) add("-- {{t .Lang "sitelogs.skipped"}} --", "warn");
+          ev.lines.forEach(l => add(l.text, l.level));
+        });
+        es.addEventListener("idle", () => stop("{{t .Lang "sitelogs.idle"}}"));
+        es.addEventListener("error", m => stop(m.data ? JSON.parse(m.data).error : "{{t .Lang "sitelogs.disconnected"}}"));
+      });
+    })();
+  </script>
+{{end}}`
@@ -0,0 +1,212 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"mynginx/internal/health"
+)
+
+// statusHostOnly restricts requests for the dedicated status domain to the status page,
+// so pointing a public host name at the NGM listener never exposes the panel.
+func (s *Server) statusHostOnly(next http.Handler) http.Handler {
+	domain := strings.ToLower(strings.TrimSpace(s.cfg.Status.Domain))
+	if !s.cfg.Status.Enabled || domain == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, domain) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path != "/" && r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		s.handleStatus(w, r)
+	})
+}
+
+// handleStatus serves the public status page (no login).
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.Status.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rep, err := s.core.StatusReport(r.Context())
+	if err != nil {
+		http.Error(w, "status unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	_ = s.tpl.ExecuteTemplate(w, "status", map[string]any{
+		"Lang":   s.i18n.FromRequest(r),
+		"Report": rep,
+	})
+}
+
+func (s *Server) handleUptime(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sites, incidents, err := s.core.UptimeList(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "Uptime", "uptime", map[string]any{
+		"Sites":     sites,
+		"Incidents": incidents,
+		"Enabled":   s.cfg.Health.Enabled,
+	})
+}
+
+// handleHealthReport accepts check results from external check locations
+// (JSON array of health.Report, Authorization: Bearer <health.report_secret>).
+func (s *Server) handleHealthReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(tok), []byte(s.cfg.Health.ReportSecret)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var reports []health.Report
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&reports); err != nil {
+		http.Error(w, "bad json: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var errs []string
+	for _, rep := range reports {
+		if err := s.health.Accept(r.Context(), rep); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"accepted": len(reports) - len(errs), "errors": errs})
+}
+
+const statusHTML = `<!doctype html>
+<html lang="{{.Lang}}"><head><meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Report.Title}}</title></head>
+<body style="font-family:system-ui; max-width:900px; margin:30px auto; padding:0 12px;">
+  <h2>{{.Report.Title}}</h2>
+
+  {{if .Report.AllUp}}
+    <div style="padding:12px; background:#dfd; border:1px solid #9c9;">{{t .Lang "status.all_up"}}</div>
+  {{else}}
+    <div style="padding:12px; background:#fdd; border:1px solid #c99;">{{t .Lang "status.outage" .Report.Down}}</div>
+  {{end}}
+
+  {{range .Report.Sites}}
+    <div style="margin:18px 0;">
+      <div style="display:flex; justify-content:space-between;">
+        <b>{{.Domain}}</b>
+        <span>
+          {{if eq .State "up"}}<span style="color:#070;">{{t $.Lang "status.up"}}</span>
+          {{else if eq .State "down"}}<span style="color:#b00;">{{t $.Lang "status.down"}}</span>
+          {{else}}<span style="opacity:.6;">{{t $.Lang "status.unknown"}}</span>{{end}}
+          · {{fmtNum $.Lang .Uptime}}%
+        </span>
+      </div>
+      <div style="display:flex; gap:2px; margin-top:6px;">
+        {{range .Days}}
+          <span title="{{fmtTime $.Lang .Day}}: {{if .Total}}{{fmtNum $.Lang .Uptime}}%{{else}}{{t $.Lang "status.no_data"}}{{end}}"
+                style="flex:1; height:28px; border-radius:2px; background:{{if eq .Level "up"}}#3b3{{else if eq .Level "degraded"}}#eb3{{else if eq .Level "down"}}#d33{{else}}#ddd{{end}};"></span>
+        {{end}}
+      </div>
+      {{if .LastChecked}}<div style="opacity:.6; font-size:.85em; margin-top:4px;">{{t $.Lang "status.last_checked"}} {{fmtTime $.Lang .LastChecked}}</div>{{end}}
+    </div>
+  {{else}}
+    <p style="opacity:.7;">{{t .Lang "status.none"}}</p>
+  {{end}}
+
+  <p style="opacity:.6; font-size:.85em;">{{t .Lang "status.generated"}} {{fmtTime .Lang .Report.GeneratedAt}}</p>
+</body></html>`
+
+const uptimeHTML = `{{define "uptime"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "uptime.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "uptime.subtitle"}}</p>
+  {{if not .Enabled}}<p style="color:#b00;">{{t .Lang "uptime.disabled"}}</p>{{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "col.domain"}}</th>
+        <th>{{t .Lang "uptime.state"}}</th>
+        <th>{{t .Lang "uptime.last"}}</th>
+        <th>{{t .Lang "uptime.latency"}}</th>
+        <th>24h</th>
+        <th>30d</th>
+        <th>90d</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Sites}}
+      <tr>
+        <td>{{.Domain}}</td>
+        <td align="center">
+          {{if .Open}}<span style="color:#b00;">{{t $.Lang "status.down"}}</span>
+          {{else if not .Last}}<span style="opacity:.6;">{{t $.Lang "status.unknown"}}</span>
+          {{else if .Last.OK}}<span style="color:#070;">{{t $.Lang "status.up"}}</span>
+          {{else}}<span style="color:#b60;">{{t $.Lang "uptime.failing"}}</span>{{end}}
+        </td>
+        <td align="center">
+          {{if .Last}}{{fmtTime $.Lang .Last.CheckedAt}}<br>
+            <span style="opacity:.7; font-size:.9em;">{{.Last.Location}}{{if .Last.StatusCode}} · HTTP {{.Last.StatusCode}}{{end}}{{if .Last.Error}} · {{.Last.Error}}{{end}}</span>
+          {{else}}-{{end}}
+        </td>
+        <td align="center">{{if .Last}}{{.Last.LatencyMS}} ms{{else}}-{{end}}{{if .Day.HasData}}<br><span style="opacity:.7; font-size:.9em;">{{t $.Lang "uptime.avg"}} {{.Day.AvgLatency}} ms</span>{{end}}</td>
+        <td align="center">{{if .Day.HasData}}{{fmtNum $.Lang .Day.Percent}}%{{else}}-{{end}}</td>
+        <td align="center">{{if .Month.HasData}}{{fmtNum $.Lang .Month.Percent}}%{{else}}-{{end}}</td>
+        <td align="center">{{if .Season.HasData}}{{fmtNum $.Lang .Season.Percent}}%{{else}}-{{end}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="7" style="opacity:.7;">{{t .Lang "status.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+
+  <h3>{{t .Lang "uptime.incidents"}}</h3>
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "col.domain"}}</th>
+        <th>{{t .Lang "uptime.started"}}</th>
+        <th>{{t .Lang "uptime.ended"}}</th>
+        <th>{{t .Lang "uptime.duration"}}</th>
+        <th align="left">{{t .Lang "uptime.cause"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Incidents}}
+      <tr>
+        <td>{{.Domain}}</td>
+        <td align="center">{{fmtTime $.Lang .StartedAt}}</td>
+        <td align="center">{{if .EndedAt}}{{fmtTime $.Lang .EndedAt}}{{else}}<span style="color:#b00;">{{t $.Lang "uptime.ongoing"}}</span>{{end}}</td>
+        <td align="center">{{.Duration}}</td>
+        <td>{{.Cause}}</td>
+      </tr>
+    {{else}}
+      <tr><td colspan="5" style="opacity:.7;">{{t .Lang "uptime.no_incidents"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func (s *Server) handleTLSReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d := strings.TrimSpace(r.URL.Query().Get("domain"))
+	rep, err := s.core.TLSReport(d)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.render(w, r, "TLS", "tls_report", map[string]any{"Domain": d})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "TLS", "tls_report", map[string]any{"Domain": d, "Report": rep})
+}
+
+func (s *Server) handleTLSScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	d := strings.TrimSpace(r.FormValue("domain"))
+	if d == "" {
+		http.Error(w, "domain is required", http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+	if _, err := s.core.TLSScan(ctx, d, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/ui/tls?domain="+url.QueryEscape(d), http.StatusFound)
+}
+
+// tls_grade_badge renders a grade with SSL Labs-like colors.
+const tlsGradeBadgeHTML = `{{define "tls_grade_badge"}}<b style="display:inline-block; min-width:26px; padding:2px 6px; border-radius:4px; color:#fff; background:
+{{- if or (eq . "A+") (eq . "A") (eq . "A-")}}#2a2{{else if eq . "B"}}#e90{{else if eq . "-"}}#999{{else}}#c22{{end}};">{{.}}</b>{{end}}`
+
+const tlsReportHTML = `{{define "tls_report"}}
+  <h2>{{t .Lang "tls.title" .Domain}}</h2>
+  <div style="margin:10px 0; display:flex; gap:10px; align-items:center;">
+    <form method="post" action="/ui/tls/scan" style="display:inline;">
+      <input type="hidden" name="domain" value="{{.Domain}}">
+      <button style="padding:8px 10px;">{{t .Lang "action.tls_scan"}}</button>
+    </form>
+    <a href="/ui/certs">{{t .Lang "common.back_certs"}}</a>
+  </div>
+
+  {{with .Report}}
+  <p style="font-size:1.6em; margin:8px 0;">{{template "tls_grade_badge" .Grade}}</p>
+  <p style="opacity:.7;">{{t $.Lang "tls.scanned" (fmtTime $.Lang .ScannedAt) .Address}}</p>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  {{if .Findings}}
+  <h3>{{t $.Lang "tls.findings"}}</h3>
+  <ul>{{range .Findings}}<li>{{.}}</li>{{end}}</ul>
+  {{end}}
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%; max-width:900px;">
+    <tr><th align="left" style="width:240px;">{{t $.Lang "tls.protocols"}}</th>
+      <td>{{range .Protocols}}<span style="margin-right:12px; {{if .Enabled}}font-weight:600;{{else}}opacity:.5;{{end}}">{{.Name}}: {{if .Enabled}}{{t $.Lang "common.yes"}}{{else}}{{t $.Lang "common.no"}}{{end}}</span>{{end}}</td></tr>
+    <tr><th align="left">{{t $.Lang "tls.ciphers"}}</th>
+      <td>
+        {{range .TLS13}}<div>{{.}} <span style="opacity:.6;">(TLS 1.3)</span></div>{{end}}
+        {{range .Ciphers}}<div {{if .Insecure}}style="color:#b00;"{{else if or .NoPFS .Weak}}style="color:#b60;"{{end}}>{{.Name}}{{if .Insecure}} — {{t $.Lang "tls.insecure"}}{{else if .NoPFS}} — {{t $.Lang "tls.no_pfs"}}{{else if .Weak}} — {{t $.Lang "tls.weak"}}{{end}}</div>{{end}}
+      </td></tr>
+    <tr><th align="left">{{t $.Lang "tls.certificate"}}</th>
+      <td>{{.CertSubject}} ← {{.CertIssuer}}<br><span style="opacity:.7;">{{t $.Lang "col.not_after"}}: {{fmtTime $.Lang .CertNotAfter}}</span></td></tr>
+    <tr><th align="left">{{t $.Lang "tls.chain"}}</th>
+      <td>{{.ChainLength}} ·
+        {{if not .Trusted}}<span style="color:#b00;">{{t $.Lang "tls.untrusted"}}</span>
+        {{else if .ChainComplete}}{{t $.Lang "tls.chain_complete"}}
+        {{else}}<span style="color:#b60;">{{t $.Lang "tls.chain_incomplete"}}</span>{{end}}
+        · {{if .HostnameOK}}{{t $.Lang "tls.hostname_ok"}}{{else}}<span style="color:#b00;">{{t $.Lang "tls.hostname_bad"}}</span>{{end}}
+      </td></tr>
+    <tr><th align="left">HSTS</th>
+      <td>{{if .HSTS}}max-age={{.HSTSMaxAge}}{{else}}<span style="opacity:.7;">{{t $.Lang "common.no"}}</span>{{end}}</td></tr>
+    <tr><th align="left">OCSP</th><td>{{.OCSP}}</td></tr>
+  </table>
+  {{else}}
+  <p style="opacity:.7;">{{t .Lang "tls.never"}}</p>
+  {{end}}
+{{end}}`
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynginx/internal/app"
+	"mynginx/internal/auth"
+)
+
+// handleTokens lists the API tokens (never their secrets).
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.renderTokens(w, r, "", "")
+}
+
+func (s *Server) renderTokens(w http.ResponseWriter, r *http.Request, name, secret string) {
+	list, err := s.core.APITokens()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.render(w, r, "API tokens", "tokens", map[string]any{
+		"Tokens":    list,
+		"Scopes":    auth.Scopes,
+		"NewName":   name,
+		"NewSecret": secret,
+		"Now":       time.Now(),
+	})
+}
+
+// handleTokenCreate creates a token and shows its secret in this response only. It
+// is not wrapped in idempotent(): a replayed response would keep the secret around.
+func (s *Server) handleTokenCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	days, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("days")))
+	lim := app.APITokenLimit{User: r.FormValue("user")}
+	if d := strings.TrimSpace(r.FormValue("domains")); d != "" {
+		lim.Domains = strings.FieldsFunc(d, func(c rune) bool { return c == ',' || c == ' ' })
+	}
+	tok, t, err := s.core.APITokenCreate(r.FormValue("name"), r.Form["scope"], time.Duration(days)*24*time.Hour, lim)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+	s.renderTokens(w, r, t.Name, tok)
+}
+
+// handleTokenRotate issues a new secret for a token (shown once, like on create).
+func (s *Server) handleTokenRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	grace, err := time.ParseDuration(strings.TrimSpace(r.FormValue("grace")))
+	if err != nil {
+		http.Error(w, "invalid grace period", http.StatusBadRequest)
+		return
+	}
+	name := r.FormValue("name")
+	tok, err := s.core.APITokenRotate(name, grace)
+	if err != nil {
+		tokenError(w, err)
+		return
+	}
+	s.renderTokens(w, r, name, tok)
+}
+
+func (s *Server) handleTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if err := s.core.APITokenRevoke(r.FormValue("name")); err != nil {
+		tokenError(w, err)
+		return
+	}
+	http.Redirect(w, r, "/ui/tokens", http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, err error) {
+	var ve *app.ValidationError
+	if errors.As(err, &ve) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+const tokensHTML = `{{define "tokens"}}
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "tokens.title"}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "tokens.subtitle"}}</p>
+
+  {{if .NewSecret}}
+  <div style="padding:10px; margin-bottom:12px; border:1px solid #9c9; background:#efe;">
+    <div>{{t .Lang "tokens.new_secret" .NewName}}</div>
+    <code style="display:block; margin-top:6px; font-size:110%; user-select:all;">{{.NewSecret}}</code>
+  </div>
+  {{end}}
+
+  <form method="post" action="/ui/tokens/create" style="margin-bottom:12px;">
+    <label>{{t .Lang "tokens.name"}}</label>
+    <input name="name" required placeholder="prometheus" style="padding:4px;">
+    {{range .Scopes}}
+      <label style="margin-left:6px;" title="{{t $.Lang (printf "tokens.scope.%s" .)}}"><input type="checkbox" name="scope" value="{{.}}"> {{.}}</label>
+    {{end}}
+    <label style="margin-left:6px;">{{t .Lang "tokens.days"}}</label>
+    <input name="days" type="number" min="0" value="90" style="padding:4px; width:70px;">
+    <label style="margin-left:6px;" title="{{t .Lang "tokens.limit_help"}}">{{t .Lang "tokens.domains"}}</label>
+    <input name="domains" placeholder="example.com, shop.example.org" style="padding:4px;">
+    <label style="margin-left:6px;">{{t .Lang "tokens.user"}}</label>
+    <input name="user" style="padding:4px; width:100px;">
+    <button>{{t .Lang "tokens.create"}}</button>
+  </form>
+
+  <table cellpadding="8" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+    <thead>
+      <tr>
+        <th align="left">{{t .Lang "tokens.name"}}</th>
+        <th>{{t .Lang "tokens.id"}}</th>
+        <th>{{t .Lang "tokens.scopes"}}</th>
+        <th>{{t .Lang "tokens.sites"}}</th>
+        <th>{{t .Lang "tokens.expires"}}</th>
+        <th>{{t .Lang "tokens.last_used"}}</th>
+        <th>{{t .Lang "tokens.uses"}}</th>
+        <th>{{t .Lang "col.actions"}}</th>
+      </tr>
+    </thead>
+    <tbody>
+    {{range .Tokens}}
+      <tr{{if .RevokedAt}} style="opacity:.5;"{{end}}>
+        <td>{{.Name}}</td>
+        <td align="center"><code>ngm_{{.Prefix}}</code></td>
+        <td align="center">{{range $i, $s := .Scopes}}{{if $i}}, {{end}}{{$s}}{{end}}</td>
+        <td align="center">
+          {{if or .Domains .HostingUser}}{{range $i, $d := .Domains}}{{if $i}}, {{end}}{{$d}}{{end}}{{with .HostingUser}}{{if $.Domains}} {{end}}<span style="opacity:.8;">{{t $.Lang "tokens.user"}}: {{.}}</span>{{end}}
+          {{else}}{{t $.Lang "tokens.all_sites"}}{{end}}
+        </td>
+        <td align="center" style="white-space:nowrap;">
+          {{if .RevokedAt}}{{t $.Lang "tokens.revoked" (fmtTime $.Lang .RevokedAt)}}
+          {{else if .ExpiresAt}}<span{{if $.Now.After .ExpiresAt}} style="color:#b00;"{{end}}>{{fmtTime $.Lang .ExpiresAt}}</span>
+          {{else}}{{t $.Lang "tokens.never"}}{{end}}
+        </td>
+        <td align="center" style="white-space:nowrap;">{{fmtTime $.Lang .LastUsedAt}}{{with .LastUsedIP}}<br><span style="font-size:85%; opacity:.7;">{{.}}</span>{{end}}</td>
+        <td align="center">{{.Uses}}</td>
+        <td align="center" style="white-space:nowrap;">
+          {{if not .RevokedAt}}
+          <form method="post" action="/ui/tokens/rotate" style="display:inline;">
+            <input type="hidden" name="name" value="{{.Name}}">
+            <select name="grace" style="padding:2px;">
+              <option value="0s">{{t $.Lang "tokens.grace_none"}}</option>
+              <option value="1h">1h</option>
+              <option value="24h">24h</option>
+            </select>
+            <button>{{t $.Lang "tokens.rotate"}}</button>
+          </form>
+          <form method="post" action="/ui/tokens/revoke" style="display:inline;" onsubmit="return confirm('{{t $.Lang "tokens.revoke_confirm" .Name}}');">
+            <input type="hidden" name="idempotency_key" value="{{$.IdemKey}}">
+            <input type="hidden" name="name" value="{{.Name}}">
+            <button>{{t $.Lang "tokens.revoke"}}</button>
+          </form>
+          {{end}}
+        </td>
+      </tr>
+    {{else}}
+      <tr><td colspan="8" style="opacity:.7;">{{t .Lang "tokens.none"}}</td></tr>
+    {{end}}
+    </tbody>
+  </table>
+{{end}}`
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"mynginx/internal/app"
+)
+
+// traceSlowMin and traceSlowTop bound the slow request list of the trace page.
+const (
+	traceSlowMin = time.Second
+	traceSlowTop = 20
+)
+
+// handleSiteTrace serves /ui/sites/trace?domain=d[&id=x]: the request with id x and
+// the log lines around it, or the slowest recent requests when no id is given.
+func (s *Server) handleSiteTrace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d := strings.TrimSpace(r.URL.Query().Get("domain"))
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	data := map[string]any{"Domain": d, "ID": id, "SlowMin": traceSlowMin.String()}
+
+	if id != "" {
+		tr, err := s.core.SiteTrace(d, id)
+		var ve *app.ValidationError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.NotFound(w, r)
+			return
+		case errors.As(err, &ve):
+			data["Error"] = err.Error()
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		default:
+			data["Trace"] = tr
+		}
+	}
+
+	slow, err := s.core.SiteSlowRequests(d, traceSlowMin, traceSlowTop)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data["Slow"] = slow
+	s.render(w, r, "Request trace", "site_trace", data)
+}
+
+const siteTraceHTML = `{{define "site_trace"}}
+  <style>
+    pre.logl { background:#f7f7f7; border:1px solid #ddd; padding:10px; overflow-x:auto; font-size:13px; line-height:1.4; white-space:pre-wrap; word-break:break-all; }
+  </style>
+  <h2 style="margin:0 0 10px 0;">{{t .Lang "trace.title" .Domain}}</h2>
+  <p style="opacity:.8; margin-top:0;">{{t .Lang "trace.subtitle"}}</p>
+  <p>
+    <a href="/ui/sites/edit?domain={{.Domain}}">{{t .Lang "action.edit"}}</a>
+    &nbsp;|&nbsp;
+    <a href="/ui/sites">{{t .Lang "common.back_sites"}}</a>
+  </p>
+
+  <form method="get" action="/ui/sites/trace" style="margin:10px 0;">
+    <input type="hidden" name="domain" value="{{.Domain}}">
+    <label>{{t .Lang "trace.id"}} <input name="id" value="{{.ID}}" size="40" style="font-family:monospace;"></label>
+    <button>{{t .Lang "trace.search"}}</button>
+  </form>
+  {{if .Error}}<p style="color:#b00;">{{.Error}}</p>{{end}}
+
+  {{with .Trace}}
+    {{if .Requests}}
+      <h3>{{t $.Lang "trace.requests"}}</h3>
+      {{range .Requests}}
+        <p>{{fmtTime $.Lang .Time}} · {{t $.Lang "trace.duration"}}: <b>{{.Duration}}</b></p>
+        <pre class="logl">{{.Line}}</pre>
+      {{end}}
+    {{else}}
+      <p style="opacity:.7;">{{t $.Lang "trace.not_found"}}</p>
+    {{end}}
+    <h3>{{t $.Lang "trace.related"}}</h3>
+    {{if .Related}}
+      <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+      {{range .Related}}
+        <tr><td style="white-space:nowrap; vertical-align:top;"><code>{{.File}}</code></td><td><code style="white-space:pre-wrap; word-break:break-all;">{{.Line}}</code></td></tr>
+      {{end}}
+      </table>
+    {{else}}
+      <p style="opacity:.7;">{{t $.Lang "trace.no_related"}}</p>
+    {{end}}
+  {{end}}
+
+  <h3>{{t .Lang "trace.slow" .SlowMin}}</h3>
+  {{if .Slow}}
+    <table cellpadding="6" cellspacing="0" border="1" style="border-collapse:collapse; width:100%;">
+      <tr><th align="left">{{t .Lang "trace.duration"}}</th><th align="left">{{t .Lang "trace.id"}}</th><th align="left">{{t .Lang "trace.requests"}}</th></tr>
+    {{range .Slow}}
+      <tr>
+        <td style="white-space:nowrap;">{{.Duration}}</td>
+        <td><a href="/ui/sites/trace?domain={{$.Domain}}&id={{.ID}}"><code>{{.ID}}</code></a></td>
+        <td><code style="white-space:pre-wrap; word-break:break-all;">{{.Line}}</code></td>
+      </tr>
+    {{end}}
+    </table>
+  {{else}}
+    <p style="opacity:.7;">{{t .Lang "trace.no_slow"}}</p>
+  {{end}}
+{{end}}`
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"mynginx/internal/sdnotify"
+)
+
+// runWatchdog pings the systemd watchdog (WatchdogSec= in the unit) every half of
+// its interval until ctx is done. While an external command has been running for
+// longer than watchdog.max_exec the pings stop, so that systemd restarts the
+// panel instead of leaving it stuck on that command.
+func (s *Server) runWatchdog(ctx context.Context, listen string) {
+	interval := sdnotify.WatchdogInterval()
+	if interval <= 0 {
+		return
+	}
+	maxExec := s.cfg.Watchdog.MaxExecDuration()
+	log.Printf("systemd watchdog: every %s (max_exec %s)", interval, maxExec)
+
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	stuck := ""
+	for {
+		if cmd, ok := s.exec.Oldest(); ok && time.Since(cmd.Since) > maxExec {
+			if stuck != cmd.Line {
+				stuck = cmd.Line
+				log.Printf("systemd watchdog: %s has been running since %s: no longer pinging",
+					cmd.Line, cmd.Since.Format(time.RFC3339))
+				_, _ = sdnotify.Notify("STATUS=stuck on " + cmd.Line)
+			}
+		} else {
+			state := "WATCHDOG=1"
+			if stuck != "" {
+				stuck = ""
+				state += "\nSTATUS=listening on " + listen
+			}
+			if _, err := sdnotify.Notify(state); err != nil {
+				log.Printf("sd_notify: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}